@@ -5,9 +5,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -15,11 +19,26 @@ import (
 	"time"
 
 	admin_api "cloud/load_balancer/internal/adminapi"
+	autoscale_pkg "cloud/load_balancer/internal/autoscale"
 	balancer_pkg "cloud/load_balancer/internal/balancer"
+	cache_pkg "cloud/load_balancer/internal/cache"
+	concurrency_pkg "cloud/load_balancer/internal/concurrency"
 	cfg_pkg "cloud/load_balancer/internal/config"
+	connlimit_pkg "cloud/load_balancer/internal/connlimit"
 	httputil_pkg "cloud/load_balancer/internal/httputil"
+	idempotency_pkg "cloud/load_balancer/internal/idempotency"
+	lifecycle_pkg "cloud/load_balancer/internal/lifecycle"
+	listener_pkg "cloud/load_balancer/internal/listener"
+	loadshed_pkg "cloud/load_balancer/internal/loadshed"
+	memlimit_pkg "cloud/load_balancer/internal/memlimit"
+	metrics_pkg "cloud/load_balancer/internal/metrics"
 	mw_pkg "cloud/load_balancer/internal/middleware"
+	policy_pkg "cloud/load_balancer/internal/policy"
+	priority_pkg "cloud/load_balancer/internal/priority"
 	rl_pkg "cloud/load_balancer/internal/ratelimiter"
+	selftest_pkg "cloud/load_balancer/internal/selftest"
+	sticky_pkg "cloud/load_balancer/internal/sticky"
+	traffic_pkg "cloud/load_balancer/internal/traffic"
 
 	sqlite_store "cloud/load_balancer/storage/sqlite"
 )
@@ -28,6 +47,7 @@ func main() {
 	// 1. Обработка флагов командной строки
 	// Определяем флаг -config для указания пути к файлу конфигурации.
 	configPath := flag.String("config", "config.yaml", "Path to the configuration file (e.g., config.yaml)")
+	checkOnly := flag.Bool("check", false, "Run the startup self-test and exit")
 	flag.Parse()
 
 	// 2. Загрузка и логирование конфигурации
@@ -37,18 +57,48 @@ func main() {
 		// Критическая ошибка при загрузке или валидации конфигурации.
 		log.Fatalf("FATAL: Failed to load configuration: %v", err)
 	}
+	// Лимит памяти применяется до создания пула и хранилищ, чтобы действовать с самого начала
+	if err := memlimit_pkg.Apply(memlimit_pkg.Settings{
+		MemoryLimit: cfg.Runtime.MemoryLimit,
+		GCPercent:   cfg.Runtime.GCPercent,
+	}); err != nil {
+		log.Fatalf("FATAL: Invalid runtime configuration: %v", err)
+	}
 
 	// Логируем загруженную конфигурацию для информации.
 	log.Println("--- Configuration Loaded ---")
-	log.Printf("INFO: Listening on port: %s", cfg.Port)
-	log.Printf("INFO: Backend servers: %s", strings.Join(cfg.Backends, ", "))
+	log.Printf("INFO: Listening on port: %s (network: %s)", cfg.Port, cfg.ListenNetwork)
+	backendSpecs := newBackendSpecs(cfg.Backends)
+	backendURLs := make([]string, 0, len(cfg.Backends))
+	for _, b := range cfg.Backends {
+		backendURLs = append(backendURLs, b.URL)
+	}
+	log.Printf("INFO: Backend servers: %s", strings.Join(backendURLs, ", "))
+	log.Printf("INFO: Balancing strategy: %s", cfg.Strategy)
+	if cfg.PanicThreshold > 0 {
+		log.Printf("INFO: Panic routing threshold: %.0f%% healthy backends", cfg.PanicThreshold)
+	}
 	log.Printf("INFO: Health check interval: %v", cfg.HealthCheckInterval)
 	log.Printf("INFO: Health check timeout: %v", cfg.HealthCheckTimeout)
+	log.Printf("INFO: Health check thresholds: healthy %d, unhealthy %d", cfg.HealthCheck.HealthyThreshold, cfg.HealthCheck.UnhealthyThreshold)
+	if cfg.HealthCheck.Mode == balancer_pkg.HealthCheckHTTP {
+		log.Printf("INFO: HTTP health checks: %s %s (expected status: %v)", cfg.HealthCheck.Method, cfg.HealthCheck.Path, cfg.HealthCheck.ExpectedStatuses)
+	}
+	if cfg.HealthCheck.Mode == balancer_pkg.HealthCheckGRPC {
+		log.Printf("INFO: gRPC health checks: grpc.health.v1.Health/Check (service %q)", cfg.HealthCheck.GRPCService)
+	}
+	log.Printf("INFO: Backend drain timeout: %v", cfg.DrainTimeout)
+	if cfg.SlowStart > 0 {
+		log.Printf("INFO: Backend slow start window: %v", cfg.SlowStart)
+	}
+	if cfg.FlapDetection.Enabled {
+		log.Printf("INFO: Flap detection: %d transitions in %v (hold-down: %v)", cfg.FlapDetection.Transitions, cfg.FlapDetection.Window, cfg.FlapDetection.HoldDown)
+	}
 	log.Printf("INFO: Rate Limiter Enabled: %t", cfg.RateLimiter.Enabled)
 	if cfg.RateLimiter.Enabled {
 		log.Printf("INFO:   Default Capacity: %d", cfg.RateLimiter.DefaultCapacity)
 		log.Printf("INFO:   Default Refill Rate: %.2f/s", cfg.RateLimiter.DefaultRefillRate)
-		log.Printf("INFO:   Cleanup Interval: %v", cfg.RateLimiter.CleanupInterval)
+		log.Printf("INFO:   Cleanup Interval: %v (mode: %s)", cfg.RateLimiter.CleanupInterval, cfg.RateLimiter.CleanupMode)
 		if cfg.RateLimiter.DB.Driver == "sqlite" && cfg.RateLimiter.DB.Path != "" {
 			log.Printf("INFO:   Custom Limits DB: %s (driver: %s)", cfg.RateLimiter.DB.Path, cfg.RateLimiter.DB.Driver)
 		} else if cfg.RateLimiter.DB.Driver != "" {
@@ -59,10 +109,16 @@ func main() {
 	}
 	log.Println("--------------------------")
 
+	// Компоненты запускаются в порядке регистрации (хранилище -> rate limiter -> пул ->
+	// остальные) перед серверами и останавливаются в обратном порядке после них (см. шаг 9).
+	mgr := lifecycle_pkg.New()
+
 	// 3. Инициализация Хранилища Лимитов
 	var limitProvider rl_pkg.LimitProvider                          // Провайдер для чтения лимитов
 	var limitManager rl_pkg.LimitManager                            // Менеджер для CRUD операций (может быть тем же объектом)
 	var limitStoreCloser func() error = func() error { return nil } // Функция закрытия хранилища
+	var limitStorePing func(ctx context.Context) error              // Проверка хранилища при самопроверке (nil - не настроено)
+	var usageStore rl_pkg.UsageStore                                // Хранилище счетчиков использования лимитов (nil - не настроено)
 
 	if cfg.RateLimiter.Enabled && cfg.RateLimiter.DB.Driver == "sqlite" && cfg.RateLimiter.DB.Path != "" {
 		sqliteStore, err := sqlite_store.New(cfg.RateLimiter.DB.Path)
@@ -72,13 +128,14 @@ func main() {
 			limitProvider = sqliteStore
 			limitManager = sqliteStore
 			limitStoreCloser = sqliteStore.Closer
+			limitStorePing = sqliteStore.Ping
+			usageStore = sqliteStore
 			log.Println("INFO: SQLite Limit Provider & Manager initialized.")
-			defer func() {
-				log.Println("INFO: Closing Limit Store...")
-				if err := limitStoreCloser(); err != nil {
-					log.Printf("ERROR: Failed to close limit store: %v", err)
-				}
-			}()
+			mgr.Add(lifecycle_pkg.Component{
+				Name:   "limit store",
+				Stop:   func(context.Context) error { return limitStoreCloser() },
+				Health: limitStorePing,
+			})
 		}
 	} else {
 		log.Println("INFO: Custom limit database is not configured. Admin API will not be available.")
@@ -87,102 +144,987 @@ func main() {
 
 	// 4. Инициализация Rate Limiter
 	var limiter *rl_pkg.Limiter
+	var breachWebhook *rl_pkg.BreachWebhook
 	if cfg.RateLimiter.Enabled {
-		bucketStore := rl_pkg.NewBucketStore(
+		bucketStore, err := rl_pkg.NewBucketStore(
 			cfg.RateLimiter.DefaultCapacity,
 			cfg.RateLimiter.DefaultRefillRate,
 			limitProvider,
 		)
-		if bucketStore == nil {
-			log.Fatal("FATAL: Failed to create bucket store (invalid default config?)")
+		if err != nil {
+			log.Fatalf("FATAL: Failed to create bucket store: %v", err)
+		}
+		limiter, err = rl_pkg.NewLimiter(bucketStore, cfg.RateLimiter.CleanupInterval)
+		if err != nil {
+			log.Fatalf("FATAL: Failed to create rate limiter: %v", err)
+		}
+		if err := limiter.SetCleanupPolicy(rl_pkg.CleanupPolicy{
+			Mode:           cfg.RateLimiter.CleanupMode,
+			SweepThreshold: cfg.RateLimiter.SweepThreshold,
+		}); err != nil {
+			log.Fatalf("FATAL: Failed to configure rate limiter cleanup: %v", err)
 		}
-		limiter = rl_pkg.NewLimiter(bucketStore, cfg.RateLimiter.CleanupInterval)
-		if limiter == nil {
-			log.Fatal("FATAL: Failed to create rate limiter")
+		limiter.SetBanPolicy(rl_pkg.BanPolicy{
+			Enabled:    cfg.RateLimiter.Ban.Enabled,
+			Violations: cfg.RateLimiter.Ban.Violations,
+			Window:     cfg.RateLimiter.Ban.Window,
+			Duration:   cfg.RateLimiter.Ban.Duration,
+		})
+		if err := limiter.SetTenantPolicy(rl_pkg.TenantPolicy{
+			Enabled:    cfg.RateLimiter.Tenant.Enabled,
+			Header:     cfg.RateLimiter.Tenant.Header,
+			Capacity:   cfg.RateLimiter.Tenant.Capacity,
+			RefillRate: cfg.RateLimiter.Tenant.RefillRate,
+			MaxTenants: cfg.RateLimiter.Tenant.MaxTenants,
+		}); err != nil {
+			log.Fatalf("FATAL: Invalid rate_limiter.tenant configuration: %v", err)
+		}
+		if err := limiter.SetBypassPolicy(rl_pkg.BypassPolicy{
+			Enabled: cfg.RateLimiter.Bypass.Enabled,
+			Key:     cfg.RateLimiter.Bypass.Key,
+			Header:  cfg.RateLimiter.Bypass.Header,
+			MaxTTL:  cfg.RateLimiter.Bypass.MaxTTL,
+		}); err != nil {
+			log.Fatalf("FATAL: Invalid rate_limiter.bypass configuration: %v", err)
+		}
+		rules := make([]rl_pkg.RequestRule, 0, len(cfg.RateLimiter.Rules))
+		for _, rc := range cfg.RateLimiter.Rules {
+			rules = append(rules, rl_pkg.RequestRule{
+				Name:        rc.Name,
+				Methods:     rc.Methods,
+				PathPrefix:  rc.PathPrefix,
+				ContentType: rc.ContentType,
+				Capacity:    rc.Capacity,
+				RefillRate:  rc.RefillRate,
+			})
+		}
+		if err := limiter.SetRequestRules(rules); err != nil {
+			log.Fatalf("FATAL: Invalid rate_limiter.rules configuration: %v", err)
+		}
+		limiter.SetTarpitPolicy(rl_pkg.TarpitPolicy{
+			Enabled:   cfg.RateLimiter.Tarpit.Enabled,
+			Threshold: cfg.RateLimiter.Tarpit.Threshold,
+			MaxDelay:  cfg.RateLimiter.Tarpit.MaxDelay,
+		})
+		if err := limiter.SetAdaptivePolicy(rl_pkg.AdaptivePolicy{
+			Enabled:   cfg.RateLimiter.Adaptive.Enabled,
+			MinFactor: cfg.RateLimiter.Adaptive.MinFactor,
+			Decrease:  cfg.RateLimiter.Adaptive.Decrease,
+			Recovery:  cfg.RateLimiter.Adaptive.Recovery,
+		}); err != nil {
+			log.Fatalf("FATAL: Invalid rate_limiter.adaptive settings: %v", err)
+		}
+		usagePolicy := rl_pkg.UsagePolicy{Enabled: cfg.RateLimiter.Usage.Enabled, MaxClients: cfg.RateLimiter.Usage.MaxClients}
+		if cfg.RateLimiter.Usage.Enabled && cfg.RateLimiter.Usage.Persist {
+			if usageStore == nil {
+				log.Println("WARN: rate_limiter.usage.persist requires rate_limiter.db. Usage counters are kept in memory only.")
+			}
+			usagePolicy.Store = usageStore
+		}
+		if err := limiter.SetUsagePolicy(usagePolicy); err != nil {
+			log.Printf("ERROR: Failed to restore rate limit usage counters: %v. Starting with empty counters.", err)
+		}
+		if bw := cfg.RateLimiter.BreachWebhook; bw.Enabled {
+			breachWebhook, err = rl_pkg.NewBreachWebhook(bw.URL, bw.Timeout)
+			if err != nil {
+				log.Fatalf("FATAL: Invalid rate_limiter.breach_webhook settings: %v", err)
+			}
+			if err := limiter.SetBreachPolicy(rl_pkg.BreachPolicy{
+				Enabled:    true,
+				Rejections: bw.Rejections,
+				Window:     bw.Window,
+				Debounce:   bw.Debounce,
+				MaxClients: bw.MaxClients,
+				Notify:     breachWebhook.Notify,
+			}); err != nil {
+				log.Fatalf("FATAL: Invalid rate_limiter.breach_webhook settings: %v", err)
+			}
+			log.Printf("INFO: Rate limit breach webhook enabled: %d rejections within %v (debounce %v).", bw.Rejections, bw.Window, bw.Debounce)
 		}
 		log.Println("INFO: Rate Limiter initialized and running background cleanup task.")
-		defer func() {
-			log.Println("INFO: Stopping Rate Limiter...")
-			limiter.Stop()
-		}()
+		mgr.Add(lifecycle_pkg.Component{
+			Name: "rate limiter",
+			Stop: func(context.Context) error {
+				limiter.Stop()
+				// Webhook останавливается после лимитера, чтобы доставить последние уведомления
+				if breachWebhook != nil {
+					breachWebhook.Stop()
+				}
+				return nil
+			},
+		})
 	} else {
 		log.Println("INFO: Rate Limiter is disabled by configuration.")
 	}
 
 	// 5. Инициализация Пула Бэкендов
 	log.Println("INFO: Initializing backend server pool...")
-	serverPool := balancer_pkg.NewServerPool(cfg.Backends, cfg.HealthCheckInterval, cfg.HealthCheckTimeout)
-	if len(serverPool.GetBackends()) == 0 {
-		log.Fatal("FATAL: No valid backend servers were initialized. Check config file and logs for errors.")
+	newPool := balancer_pkg.NewNamedServerPool
+	if cfg.EtcdRegistry.Enabled || cfg.BackendsFile.Path != "" {
+		// Бэкенды регистрируются в etcd или перечислены в отдельном файле, поэтому статический
+		// список может быть пустым
+		newPool = balancer_pkg.NewDynamicServerPool
+	}
+	serverPool, err := newPool(backendSpecs, cfg.HealthCheckInterval, cfg.HealthCheckTimeout)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to initialize backend pool: %v. Check config file and logs for errors.", err)
+	}
+	configurePool(serverPool, cfg, cfg.HealthCheck, cfg.Strategy)
+	if cfg.HashOn != "" {
+		log.Printf("INFO: Requests are pinned to backends by %s (requests without it use %s).", cfg.HashOn, serverPool.StrategyName())
+	}
+	var stickyStore sticky_pkg.SessionStore
+	if cfg.StickySessions.Enabled {
+		sc := cfg.StickySessions
+		codec, err := sticky_pkg.NewCodec(sc.CookieMode, sc.Key)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid sticky_sessions configuration: %v", err)
+		}
+		switch sc.Storage {
+		case "memory":
+			stickyStore = sticky_pkg.NewMemoryStore()
+		case "redis":
+			stickyStore = sticky_pkg.NewRedisStore(sc.Redis.Addr, sc.Redis.Password, sc.Redis.KeyPrefix, sc.Redis.Timeout)
+		}
+		if err := serverPool.SetStickyPolicy(balancer_pkg.StickyPolicy{
+			Enabled:    true,
+			CookieName: sc.CookieName,
+			TTL:        sc.TTL,
+			Secure:     sc.Secure,
+			HTTPOnly:   sc.HTTPOnly,
+			Codec:      codec,
+			Store:      stickyStore,
+		}); err != nil {
+			log.Fatalf("FATAL: Invalid sticky_sessions configuration: %v", err)
+		}
+		log.Printf("INFO: Sticky sessions enabled (cookie: %s, mode: %s, storage: %s).", sc.CookieName, sc.CookieMode, sc.Storage)
+	}
+	if cfg.SlowRequests.Threshold > 0 {
+		log.Printf("INFO: Slow request logging enabled (threshold %v).", cfg.SlowRequests.Threshold)
+	}
+	if cfg.Retries.MaxRetries > 0 {
+		log.Printf("INFO: Retries on connection errors enabled (max %d, body buffer %d bytes in memory, up to %d bytes, retry on statuses %v).",
+			cfg.Retries.MaxRetries, cfg.Retries.MemoryBufferBytes, cfg.Retries.MaxBodyBytes, cfg.Retries.RetryOnStatuses)
+	}
+	for i, sr := range cfg.StaticResponses {
+		err := serverPool.SetStaticResponse(&balancer_pkg.StaticResponse{
+			PathPrefix: sr.PathPrefix,
+			Status:     sr.Status,
+			Headers:    sr.Headers,
+			Body:       sr.Body,
+		})
+		if err != nil {
+			log.Fatalf("FATAL: Invalid static_responses[%d] configuration: %v", i, err)
+		}
+		log.Printf("INFO: Static response enabled for path prefix '%s' (status %d). Matching requests will not be proxied.", sr.PathPrefix, sr.Status)
+	}
+	if err := serverPool.SetStartupGate(balancer_pkg.StartupGate{
+		MinHealthy: cfg.Startup.MinHealthyBackends,
+		Timeout:    cfg.Startup.Timeout,
+	}); err != nil {
+		log.Fatalf("FATAL: Invalid startup configuration: %v", err)
+	}
+	if serverPool.HasDNSDiscovery() {
+		serverPool.SetDNSDiscovery(balancer_pkg.DNSDiscoveryPolicy{
+			RefreshInterval: cfg.DNSRefreshInterval,
+			DrainTimeout:    cfg.DrainTimeout,
+		})
+		log.Printf("INFO: DNS discovery: re-resolving backend names every %v.", cfg.DNSRefreshInterval)
+	}
+	if er := cfg.EtcdRegistry; er.Enabled {
+		if err := serverPool.SetEtcdRegistry(balancer_pkg.EtcdRegistryPolicy{
+			Endpoints:    er.Endpoints,
+			Prefix:       er.Prefix,
+			Username:     er.Username,
+			Password:     er.Password,
+			DrainTimeout: cfg.DrainTimeout,
+		}); err != nil {
+			log.Fatalf("FATAL: Invalid etcd_registry configuration: %v", err)
+		}
+		log.Printf("INFO: etcd registry: watching %s at %s.", er.Prefix, strings.Join(er.Endpoints, ", "))
+	}
+	if bf := cfg.BackendsFile; bf.Path != "" {
+		if err := serverPool.SetBackendsFile(balancer_pkg.BackendsFilePolicy{
+			Path:         bf.Path,
+			PollInterval: bf.PollInterval,
+			DrainTimeout: cfg.DrainTimeout,
+		}); err != nil {
+			log.Fatalf("FATAL: Failed to load backends_file: %v", err)
+		}
+		log.Printf("INFO: Backends file: watching %s for changes (also checking every %v).", bf.Path, bf.PollInterval)
+	}
+	// Проверки состояния и обнаружение через DNS - фоновые задачи, которые отменяются после
+	// остановки всех серверов, до остановки пула.
+	mgr.Add(lifecycle_pkg.Component{
+		Name: "backend pool",
+		Start: func(context.Context) error {
+			mgr.Go("health check", serverPool.HealthCheck)
+			if serverPool.HasDNSDiscovery() {
+				mgr.Go("DNS discovery", serverPool.RunDNSDiscovery)
+			}
+			if cfg.EtcdRegistry.Enabled {
+				mgr.Go("etcd registry", serverPool.RunEtcdRegistry)
+			}
+			if cfg.BackendsFile.Path != "" {
+				mgr.Go("backends file", serverPool.RunBackendsFile)
+			}
+			return nil
+		},
+		Stop: func(context.Context) error {
+			if stickyStore != nil {
+				return stickyStore.Close()
+			}
+			return nil
+		},
+		Health: func(context.Context) error { return poolHealth(serverPool) },
+	})
+
+	// Дополнительные пулы получают запросы по правилам routing_rules, хосту и префиксу пути;
+	// остальные запросы обслуживает пул по умолчанию. Реестр etcd, backends_file, sticky-сессии
+	// и Admin API работают с основным пулом.
+	poolRoutes := make([]balancer_pkg.PoolRoute, 0, len(cfg.Pools)+len(cfg.VirtualHosts.Hosts)+len(cfg.RoutingRules))
+	poolsByName := map[string]*balancer_pkg.ServerPool{"": serverPool}
+	for _, pc := range cfg.Pools {
+		pool, err := balancer_pkg.NewNamedServerPool(newBackendSpecs(pc.Backends), cfg.HealthCheckInterval, cfg.HealthCheckTimeout)
+		if err != nil {
+			log.Fatalf("FATAL: Failed to initialize pool '%s': %v", pc.Name, err)
+		}
+		strategy := pc.Strategy
+		if strategy == "" {
+			strategy = cfg.Strategy
+		}
+		pool.SetName(pc.Name)
+		configurePool(pool, cfg, pc.HealthCheck.Policy, strategy)
+		if pool.HasDNSDiscovery() {
+			pool.SetDNSDiscovery(balancer_pkg.DNSDiscoveryPolicy{
+				RefreshInterval: cfg.DNSRefreshInterval,
+				DrainTimeout:    cfg.DrainTimeout,
+			})
+		}
+		poolsByName[pc.Name] = pool
+		for _, prefix := range pc.PathPrefixes {
+			poolRoutes = append(poolRoutes, balancer_pkg.PoolRoute{PathPrefix: prefix, Pool: pool})
+		}
+		mgr.Add(lifecycle_pkg.Component{
+			Name: "backend pool " + pc.Name,
+			Start: func(context.Context) error {
+				mgr.Go("health check "+pc.Name, pool.HealthCheck)
+				if pool.HasDNSDiscovery() {
+					mgr.Go("DNS discovery "+pc.Name, pool.RunDNSDiscovery)
+				}
+				return nil
+			},
+			Health: func(context.Context) error { return poolHealth(pool) },
+		})
+		log.Printf("INFO: Pool '%s': %d backend(s), strategy %s, path prefixes %s.", pc.Name, len(pool.GetBackends()), pool.StrategyName(), strings.Join(pc.PathPrefixes, ", "))
+	}
+	allPools := []*balancer_pkg.ServerPool{serverPool}
+	for _, pc := range cfg.Pools {
+		allPools = append(allPools, poolsByName[pc.Name])
+	}
+	if len(cfg.Pools) > 0 {
+		// Admin API и метрики находят бэкенд по имени, поэтому имена уникальны во всех пулах.
+		if err := balancer_pkg.JoinPools(allPools...); err != nil {
+			log.Fatalf("FATAL: Invalid pools: %v", err)
+		}
+	}
+
+	for _, rule := range cfg.RoutingRules {
+		poolRoutes = append(poolRoutes, balancer_pkg.PoolRoute{
+			Host:       rule.Host,
+			PathPrefix: rule.PathPrefix,
+			Methods:    rule.Methods,
+			Headers:    rule.Headers,
+			Query:      rule.Query,
+			Pool:       poolsByName[rule.Pool],
+		})
+		log.Printf("INFO: Routing rule '%s' sends matching requests to pool '%s'.", rule.Name, poolName(rule.Pool))
+	}
+	for _, vh := range cfg.VirtualHosts.Hosts {
+		poolRoutes = append(poolRoutes, balancer_pkg.PoolRoute{Host: vh.Host, Pool: poolsByName[vh.Pool]})
+		log.Printf("INFO: Virtual host '%s' is served by pool '%s'.", vh.Host, poolName(vh.Pool))
+	}
+	defaultPool := poolsByName[cfg.VirtualHosts.DefaultPool]
+	if cfg.VirtualHosts.DefaultPool != "" {
+		log.Printf("INFO: Requests to other hosts are served by pool '%s'.", cfg.VirtualHosts.DefaultPool)
+	}
+
+	if cfg.Autoscale.Enabled {
+		hook, err := autoscale_pkg.NewHook(serverPool, autoscale_pkg.Config{
+			TargetRequestsPerBackend: cfg.Autoscale.TargetRequestsPerBackend,
+			ScaleOutThreshold:        cfg.Autoscale.ScaleOutThreshold,
+			ScaleInThreshold:         cfg.Autoscale.ScaleInThreshold,
+			CheckInterval:            cfg.Autoscale.CheckInterval,
+			Cooldown:                 cfg.Autoscale.Cooldown,
+			WebhookURL:               cfg.Autoscale.WebhookURL,
+			Command:                  cfg.Autoscale.Command,
+		})
+		if err != nil {
+			log.Fatalf("FATAL: Failed to configure autoscale hook: %v", err)
+		}
+		mgr.Add(lifecycle_pkg.Component{
+			Name:  "autoscale",
+			Start: func(context.Context) error { hook.Start(); return nil },
+			Stop:  func(context.Context) error { hook.Stop(); return nil },
+		})
+	}
+
+	var shedder *loadshed_pkg.Shedder
+	if cfg.LoadShedding.Enabled {
+		var err error
+		shedder, err = loadshed_pkg.NewShedder(loadshed_pkg.Config{
+			MaxGoroutines:  cfg.LoadShedding.MaxGoroutines,
+			MaxHeapBytes:   uint64(cfg.LoadShedding.MaxHeapMB) << 20,
+			MaxLatency:     cfg.LoadShedding.MaxLatency,
+			CheckInterval:  cfg.LoadShedding.CheckInterval,
+			Step:           cfg.LoadShedding.StepPercent / 100,
+			MaxShedPercent: cfg.LoadShedding.MaxShedPercent,
+		})
+		if err != nil {
+			log.Fatalf("FATAL: Failed to configure load shedding: %v", err)
+		}
+		mgr.Add(lifecycle_pkg.Component{
+			Name:  "load shedding",
+			Start: func(context.Context) error { shedder.Start(); return nil },
+			Stop:  func(context.Context) error { shedder.Stop(); return nil },
+		})
+	}
+
+	var classifier *priority_pkg.Classifier
+	if cfg.Priority.Enabled {
+		defaultClass, err := priority_pkg.ParseClass(cfg.Priority.DefaultClass)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid priority.default_class: %v", err)
+		}
+		rules := make([]priority_pkg.Rule, 0, len(cfg.Priority.Rules))
+		for i, rc := range cfg.Priority.Rules {
+			class, err := priority_pkg.ParseClass(rc.Class)
+			if err != nil {
+				log.Fatalf("FATAL: Invalid priority.rules[%d].class: %v", i, err)
+			}
+			rules = append(rules, priority_pkg.Rule{
+				Class:       class,
+				Header:      rc.Header,
+				HeaderValue: rc.HeaderValue,
+				PathPrefix:  rc.PathPrefix,
+				Clients:     rc.Clients,
+			})
+		}
+		classifier, err = priority_pkg.NewClassifier(rules, defaultClass)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid priority configuration: %v", err)
+		}
 	}
-	go serverPool.HealthCheck()
 
 	// 6. Настройка HTTP Роутера и Middleware
-	router := http.NewServeMux()
+	// Конфликтующие регистрации не приводят к panic, а сообщаются самопроверкой
+	router := httputil_pkg.NewRouter()
 
 	// Настраиваем обработчик балансировщика
 	loadBalancerHandler := balancer_pkg.NewLoadBalancerHandler(serverPool)
+	if len(poolRoutes) > 0 || defaultPool != serverPool {
+		// Статические ответы (static_responses, /admin/static-response) хранит основной пул;
+		// они проверяются до выбора пула, поэтому действуют для всех пулов.
+		loadBalancerHandler = serverPool.WithStaticResponses(balancer_pkg.NewPoolRouter(defaultPool, poolRoutes))
+	}
 	var finalBalancerHandler http.Handler = loadBalancerHandler
+	var staleStore *cache_pkg.Store
+	if len(cfg.StaleOnError.Routes) > 0 {
+		// Сохраненные ответы заменяют только ошибки бэкендов, поэтому middleware - самый внутренний слой
+		rules := make([]cache_pkg.StaleRule, 0, len(cfg.StaleOnError.Routes))
+		for _, rc := range cfg.StaleOnError.Routes {
+			rules = append(rules, cache_pkg.StaleRule{PathPrefix: rc.PathPrefix, MaxStale: rc.MaxStale})
+		}
+		staleStore = cache_pkg.NewStore(cfg.StaleOnError.MaxEntries)
+		finalBalancerHandler = cache_pkg.StaleOnError(staleStore, rules, cfg.StaleOnError.MaxBodyBytes)(finalBalancerHandler)
+		log.Printf("INFO: Stale-on-error enabled for %d route(s).", len(rules))
+	}
+	if len(cfg.EdgeResponses) > 0 {
+		// Ответы из сохраненных копий выдаются внутри авторизации, политик и Rate Limiter,
+		// чтобы HEAD не обходил проверки, которые прошел бы GET
+		rules := make([]cache_pkg.EdgeRule, 0, len(cfg.EdgeResponses))
+		for _, rc := range cfg.EdgeResponses {
+			rules = append(rules, cache_pkg.EdgeRule{PathPrefix: rc.PathPrefix, Allow: rc.Allow, HeadFromCache: rc.HeadFromCache})
+		}
+		finalBalancerHandler = cache_pkg.EdgeResponses(staleStore, rules)(finalBalancerHandler)
+		log.Printf("INFO: OPTIONS/HEAD edge responses enabled for %d route(s).", len(rules))
+	}
+	if cfg.Idempotency.Enabled {
+		// Повторы с Idempotency-Key обслуживаются внутри Rate Limiter и расходуют токены как обычные запросы
+		var store idempotency_pkg.Store
+		if cfg.Idempotency.Storage == "redis" {
+			rc := cfg.Idempotency.Redis
+			store = idempotency_pkg.NewRedisStore(rc.Addr, rc.Password, rc.KeyPrefix, rc.Timeout)
+		} else {
+			store = idempotency_pkg.NewMemoryStore()
+		}
+		mgr.Add(lifecycle_pkg.Component{
+			Name: "idempotency store",
+			Stop: func(context.Context) error { return store.Close() },
+		})
+		finalBalancerHandler = idempotency_pkg.Middleware(store, idempotency_pkg.Config{
+			Window:       cfg.Idempotency.Window,
+			Lease:        cfg.Idempotency.Lease,
+			MaxBodyBytes: cfg.Idempotency.MaxBodyBytes,
+		})(finalBalancerHandler)
+		log.Printf("INFO: Idempotency-Key deduplication enabled (storage: %s, window: %v).", cfg.Idempotency.Storage, cfg.Idempotency.Window)
+	}
+	if cfg.ExtAuth.Enabled {
+		// Авторизация выполняется внутри Rate Limiter, чтобы лимиты защищали и сервис авторизации
+		extAuth, err := mw_pkg.ExtAuth(mw_pkg.ExtAuthConfig{
+			URL:             cfg.ExtAuth.URL,
+			Timeout:         cfg.ExtAuth.Timeout,
+			ForwardHeaders:  cfg.ExtAuth.ForwardHeaders,
+			UpstreamHeaders: cfg.ExtAuth.UpstreamHeaders,
+		})
+		if err != nil {
+			log.Fatalf("FATAL: Invalid ext_auth: %v", err)
+		}
+		finalBalancerHandler = extAuth(finalBalancerHandler)
+		log.Printf("INFO: External auth enabled: %s (timeout %v).", cfg.ExtAuth.URL, cfg.ExtAuth.Timeout)
+	}
 	if limiter != nil {
 		// Применяем Rate Limiter middleware ТОЛЬКО к балансировщику
-		finalBalancerHandler = mw_pkg.RateLimit(limiter)(finalBalancerHandler)
+		var key func(*http.Request) string
+		if cfg.RateLimiter.KeyExpression != "" {
+			var err error
+			if key, err = policy_pkg.KeyFunc(cfg.RateLimiter.KeyExpression); err != nil {
+				log.Fatalf("FATAL: Invalid rate_limiter.key_expression: %v", err)
+			}
+			log.Printf("INFO: Rate limit key: %s", cfg.RateLimiter.KeyExpression)
+		}
+		finalBalancerHandler = mw_pkg.RateLimitByKey(limiter, key)(finalBalancerHandler)
 		log.Println("INFO: Rate Limiter Middleware enabled for the load balancer.")
 	}
+	if classifier != nil && cfg.Priority.ShortageThreshold > 0 {
+		finalBalancerHandler = priority_pkg.ShortageGuard(func() float64 {
+			return balancer_pkg.AvailableShare(allPools...)
+		}, cfg.Priority.ShortageThreshold)(finalBalancerHandler)
+		log.Printf("INFO: Low-priority requests will be rejected while less than %.0f%% of backends are available.", cfg.Priority.ShortageThreshold)
+	}
+	if shedder != nil {
+		// Сброс нагрузки выполняется до Rate Limiter, чтобы отклоненные запросы не расходовали токены
+		finalBalancerHandler = shedder.Middleware(finalBalancerHandler)
+		log.Println("INFO: Load shedding enabled for the load balancer.")
+	}
+	if classifier != nil {
+		// Классификация выполняется до сброса нагрузки, чтобы первыми отклонялись запросы низкого приоритета
+		finalBalancerHandler = classifier.Middleware(finalBalancerHandler)
+		log.Printf("INFO: Request priority classification enabled (%d rule(s)).", len(cfg.Priority.Rules))
+	}
+	if len(cfg.Policies) > 0 {
+		// Политики применяются до Rate Limiter: отклоненные правилом запросы не расходуют токены,
+		// а измененные заголовки видны лимитам, авторизации и бэкендам
+		specs := make([]policy_pkg.RuleSpec, 0, len(cfg.Policies))
+		for _, pc := range cfg.Policies {
+			specs = append(specs, policy_pkg.RuleSpec{
+				Name:          pc.Name,
+				When:          pc.When,
+				Backends:      pc.Backends,
+				SetHeaders:    pc.SetHeaders,
+				RemoveHeaders: pc.RemoveHeaders,
+				RejectStatus:  pc.RejectStatus,
+			})
+		}
+		engine, err := policy_pkg.NewEngine(specs)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid policies: %v", err)
+		}
+		for _, name := range engine.Backends() {
+			if findBackend(allPools, name) == nil {
+				log.Printf("WARN: Policy refers to unknown backend '%s'. Matching requests will get 503 until it is added.", name)
+			}
+		}
+		finalBalancerHandler = engine.Middleware(finalBalancerHandler)
+		log.Printf("INFO: Request policies enabled (%d rule(s)).", len(specs))
+	}
+	if len(cfg.CORS) > 0 {
+		// CORS применяется снаружи Rate Limiter, чтобы preflight-запросы не расходовали токены
+		rules := make([]mw_pkg.CORSRule, 0, len(cfg.CORS))
+		for _, rc := range cfg.CORS {
+			rules = append(rules, mw_pkg.CORSRule{
+				PathPrefix:       rc.PathPrefix,
+				AllowedOrigins:   rc.AllowedOrigins,
+				AllowedMethods:   rc.AllowedMethods,
+				AllowedHeaders:   rc.AllowedHeaders,
+				ExposedHeaders:   rc.ExposedHeaders,
+				MaxAge:           rc.MaxAge,
+				AllowCredentials: rc.AllowCredentials,
+			})
+		}
+		finalBalancerHandler = mw_pkg.CORS(rules)(finalBalancerHandler)
+		log.Printf("INFO: CORS handling enabled for %d route(s).", len(rules))
+	}
+	if cfg.ConcurrencyLimit.Enabled {
+		// Лимит применяется снаружи остальных middleware, чтобы ожидающие запросы не занимали
+		// ресурсы авторизации, политик и Rate Limiter
+		limitCfg := concurrency_pkg.Config{
+			MaxInFlight:  cfg.ConcurrencyLimit.MaxInFlight,
+			MaxQueue:     cfg.ConcurrencyLimit.MaxQueue,
+			QueueTimeout: cfg.ConcurrencyLimit.QueueTimeout,
+		}
+		if shedder != nil {
+			// Порог load_shedding.max_latency сравнивается со временем ожидания в очереди
+			limitCfg.ObserveWait = shedder.ObserveQueueWait
+		}
+		concurrencyLimiter, err := concurrency_pkg.NewLimiter(limitCfg)
+		if err != nil {
+			log.Fatalf("FATAL: Failed to configure concurrency limit: %v", err)
+		}
+		finalBalancerHandler = concurrencyLimiter.Middleware(finalBalancerHandler)
+		log.Printf("INFO: Concurrency limit enabled: %d in flight, queue of %d (timeout %v).",
+			cfg.ConcurrencyLimit.MaxInFlight, cfg.ConcurrencyLimit.MaxQueue, cfg.ConcurrencyLimit.QueueTimeout)
+	}
+	if len(cfg.HeaderRules) > 0 {
+		// Заголовки изменяются снаружи остальных middleware, чтобы изменения ответа затрагивали
+		// и ответы, сформированные балансировщиком
+		rules := make([]mw_pkg.HeaderRule, 0, len(cfg.HeaderRules))
+		for _, rc := range cfg.HeaderRules {
+			rules = append(rules, mw_pkg.HeaderRule{
+				PathPrefix: rc.PathPrefix,
+				Request:    mw_pkg.HeaderActions{Remove: rc.Request.Remove, Set: rc.Request.Set, Add: rc.Request.Add},
+				Response:   mw_pkg.HeaderActions{Remove: rc.Response.Remove, Set: rc.Response.Set, Add: rc.Response.Add},
+			})
+		}
+		finalBalancerHandler = mw_pkg.HeaderRewrite(rules)(finalBalancerHandler)
+		log.Printf("INFO: Header rewrite enabled (%d rule(s)).", len(rules))
+	}
+	// Сводка трафика учитывает все запросы к балансировщику, включая отклоненные middleware
+	trafficRecorder := traffic_pkg.NewRecorder()
+	finalBalancerHandler = trafficRecorder.Middleware(finalBalancerHandler)
 	// Регистрируем обработчик балансировщика для корневого пути "/"
 	router.Handle("/", finalBalancerHandler)
 
+	// Admin API и метрики обслуживаются отдельным адресом со своим роутером, если он задан
+	separateAdmin := cfg.AdminListener.Addr != ""
+	adminRouter := router
+	if separateAdmin {
+		adminRouter = httputil_pkg.NewRouter()
+	}
+
 	// Настраиваем и регистрируем обработчик Admin API, если менеджер лимитов доступен
 	if limitManager != nil {
 		adminHandler := admin_api.NewAdminHandler(limitManager)
 		// Регистрируем для пути /admin/limits/ (слеш в конце важен для ServeMux)
-		router.Handle("/admin/limits/", http.StripPrefix("/admin/limits", adminHandler))
+		adminRouter.Handle("/admin/limits/", http.StripPrefix("/admin/limits", adminHandler))
 		log.Println("INFO: Admin API for limits enabled at /admin/limits/")
 	} else {
 		// Регистрируем заглушку, если Admin API не доступен
-		router.HandleFunc("/admin/limits/", func(w http.ResponseWriter, r *http.Request) {
+		adminRouter.HandleFunc("/admin/limits/", func(w http.ResponseWriter, r *http.Request) {
 			httputil_pkg.RespondWithError(w, http.StatusNotImplemented, "Admin API is disabled (database not configured)")
 		})
 		log.Println("INFO: Admin API is disabled (database not configured). Endpoint /admin/limits/ will return 501.")
 	}
 
-	//7. Настройка и Запуск HTTP Сервера
+	if limiter != nil {
+		bansHandler := http.StripPrefix("/admin/bans", admin_api.NewBansHandler(limiter))
+		adminRouter.Handle("/admin/bans", bansHandler)
+		adminRouter.Handle("/admin/bans/", bansHandler)
+		adminRouter.Handle("/admin/ratelimiter/store", admin_api.NewRateLimiterStoreHandler(limiter))
+		if limiter.UsageEnabled() {
+			adminRouter.Handle("/admin/usage/", admin_api.NewUsageHandler(limiter))
+		}
+		if cfg.RateLimiter.Bypass.Enabled {
+			adminRouter.Handle("/admin/ratelimiter/bypass-tokens", admin_api.NewBypassTokensHandler(limiter))
+		}
+	}
+
+	// Admin API для бэкендов и метрики доступны всегда
+	backendsHandler := http.StripPrefix("/admin/backends", admin_api.NewBackendsHandler(poolsByName, cfg.DrainTimeout))
+	adminRouter.Handle("/admin/backends", backendsHandler)
+	adminRouter.Handle("/admin/backends/", backendsHandler)
+	adminRouter.Handle("/admin/static-response", admin_api.NewStaticResponseHandler(serverPool))
+	adminRouter.Handle("/admin/traffic", admin_api.NewTrafficHandler(trafficRecorder))
+	adminRouter.Handle("/admin/stats", admin_api.NewStatsHandler(poolsByName))
+	adminRouter.Handle("/admin/components", admin_api.NewComponentsHandler(mgr))
+	adminRouter.Handle("/admin/config/plan", admin_api.NewConfigPlanHandler(cfg, poolsByName))
+	adminRouter.Handle("/metrics", metrics_pkg.Default.Handler())
+	adminRouter.Handle("/readyz", admin_api.NewReadinessHandler(serverPool))
+	if separateAdmin {
+		// Проверка готовности остается и на основном адресе для внешних балансировщиков
+		router.Handle("/readyz", admin_api.NewReadinessHandler(serverPool))
+	}
+
+	// Нормализация URL и подмена метода выполняются до маршрутизации и rate limiting,
+	// поэтому оборачивают весь роутер (нормализация - внешний слой). Отдельный адрес
+	// Admin API получает свою цепочку: ограничение доступа и нормализацию.
+	var adminAccess func(http.Handler) http.Handler
+	if cfg.AdminAccess.Enabled {
+		clientIPResolver, err := mw_pkg.NewClientIPResolver(cfg.TrustedProxies)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid trusted_proxies: %v", err)
+		}
+		adminAccess, err = mw_pkg.AdminAccess(cfg.AdminAccess.AllowedCIDRs, clientIPResolver)
+		if err != nil {
+			log.Fatalf("FATAL: Invalid admin_access: %v", err)
+		}
+		log.Printf("INFO: Admin API and metrics restricted to: %s", strings.Join(cfg.AdminAccess.AllowedCIDRs, ", "))
+	} else if !separateAdmin {
+		log.Println("WARN: Admin API and /metrics are served on the main listener without access restriction; enable admin_access or admin_listener.")
+	}
+	normalize := func(h http.Handler) http.Handler { return h }
+	if cfg.Normalization.Enabled {
+		normalize = mw_pkg.Normalize(mw_pkg.NormalizeOptions{
+			RejectEncodedSlash: cfg.Normalization.RejectEncodedSlash,
+		})
+		log.Println("INFO: Request URL normalization enabled.")
+	}
+
+	var rootHandler http.Handler = router
+	if len(cfg.ResponseTimeouts) > 0 {
+		// Дедлайн задается после нормализации, чтобы маршрут определялся по итоговому пути
+		routes := make([]mw_pkg.ResponseTimeoutRoute, 0, len(cfg.ResponseTimeouts))
+		for _, rt := range cfg.ResponseTimeouts {
+			routes = append(routes, mw_pkg.ResponseTimeoutRoute{PathPrefix: rt.PathPrefix, Timeout: rt.Timeout})
+		}
+		rootHandler = mw_pkg.ResponseTimeouts(routes)(rootHandler)
+		log.Printf("INFO: Per-route response timeouts enabled for %d route(s).", len(routes))
+	}
+	if adminAccess != nil && !separateAdmin {
+		// Проверяется после нормализации, чтобы пути вида //admin не обходили ограничение
+		rootHandler = adminAccess(rootHandler)
+	}
+	if cfg.MethodOverride.Enabled {
+		rootHandler = mw_pkg.MethodOverride(cfg.MethodOverride.AllowedMethods)(rootHandler)
+		log.Printf("INFO: Method override enabled for: %s", strings.Join(cfg.MethodOverride.AllowedMethods, ", "))
+	}
+	rootHandler = normalize(rootHandler)
+
+	var adminRootHandler http.Handler
+	if separateAdmin {
+		adminRootHandler = adminRouter
+		if adminAccess != nil {
+			adminRootHandler = adminAccess(adminRootHandler)
+		}
+		adminRootHandler = normalize(adminRootHandler)
+	}
+
+	// Самопроверка: все отказы сообщаются вместе, до начала приема запросов
+	listener, listenErr := listener_pkg.Listen(cfg.Port, cfg.ListenNetwork, cfg.UnixSocketMode)
+	checks := []selftest_pkg.Check{
+		{Name: "listener " + cfg.Port, Run: func(context.Context) error { return listenErr }},
+		{Name: "routes", Run: func(context.Context) error { return router.Conflicts() }},
+	}
+	if len(cfg.Backends) > 0 {
+		checks = append(checks, selftest_pkg.Check{Name: "backend DNS", Run: func(ctx context.Context) error {
+			urls := make([]*url.URL, 0)
+			for _, b := range serverPool.GetBackends() {
+				urls = append(urls, b.URL)
+			}
+			return selftest_pkg.ResolveAnyBackend(ctx, urls)
+		}})
+	}
+	if cfg.EtcdRegistry.Enabled {
+		checks = append(checks, selftest_pkg.Check{Name: "etcd registry", Run: serverPool.CheckEtcdRegistry})
+	}
+	if tlsBackends := backendsWithTLSFiles(cfg); len(tlsBackends) > 0 {
+		checks = append(checks, selftest_pkg.Check{Name: "backend TLS files", Run: func(context.Context) error {
+			var errs []error
+			for _, b := range tlsBackends {
+				if err := newBackendTLS(b.TLS).Validate(); err != nil {
+					errs = append(errs, fmt.Errorf("backend %s: %w", b.URL, err))
+				}
+			}
+			return errors.Join(errs...)
+		}})
+	}
+	if limitStorePing != nil {
+		checks = append(checks, selftest_pkg.Check{Name: "limit store", Run: limitStorePing})
+	}
+	var adminListener net.Listener
+	if separateAdmin {
+		var adminListenErr error
+		adminListener, adminListenErr = listener_pkg.Listen(cfg.AdminListener.Addr, cfg.ListenNetwork, cfg.UnixSocketMode)
+		checks = append(checks,
+			selftest_pkg.Check{Name: "admin listener " + cfg.AdminListener.Addr, Run: func(context.Context) error { return adminListenErr }},
+			selftest_pkg.Check{Name: "admin routes", Run: func(context.Context) error { return adminRouter.Conflicts() }},
+		)
+	}
+	if err := selftest_pkg.Run(checks, 5*time.Second); err != nil {
+		log.Fatalf("FATAL: Startup self-test failed: %v", err)
+	}
+	if *checkOnly {
+		log.Println("INFO: Self-test passed. Exiting (-check).")
+		listener.Close()
+		if adminListener != nil {
+			adminListener.Close()
+		}
+		return
+	}
+
+	// Запуск компонентов в порядке зависимостей; серверы запускаются после них
+	if err := mgr.Start(context.Background()); err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	//7. Настройка и Запуск HTTP Серверов
+	// Каждый адрес обслуживается своим сервером со своей цепочкой middleware и таймаутами.
+	// При остановке сначала завершается прием трафика, затем Admin API, чтобы состояние
+	// балансировщика оставалось доступным до последнего запроса.
 	log.Println("INFO: Configuring HTTP server...")
-	server := &http.Server{
-		Addr:         cfg.Port,
-		Handler:      router, // Используем созданный роутер
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  30 * time.Second,
+	traffic := lifecycle_pkg.Server{
+		Name:            "traffic",
+		Server:          newHTTPServer(cfg.Port, rootHandler, cfg.ServerTimeouts),
+		Listener:        listener,
+		ShutdownOrder:   0,
+		ShutdownTimeout: cfg.ServerTimeouts.Shutdown,
+	}
+	if cfg.Startup.DelayTraffic && cfg.Startup.MinHealthyBackends > 0 {
+		traffic.BeforeServe = func(ctx context.Context) {
+			// До готовности пула соединения ожидают в очереди слушающего сокета.
+			log.Printf("INFO: Delaying traffic until %d backends are healthy (timeout %v)...", cfg.Startup.MinHealthyBackends, cfg.Startup.Timeout)
+			_ = serverPool.WaitReady(ctx)
+		}
+	}
+	connLimits := connlimit_pkg.Limits{MaxRequests: cfg.ClientConnections.MaxRequests, MaxLifetime: cfg.ClientConnections.MaxLifetime}
+	if connLimits.Enabled() {
+		connlimit_pkg.Apply(traffic.Server, connLimits)
+		log.Printf("INFO: Client connection limits: %d request(s), lifetime %v (0 - unlimited).", connLimits.MaxRequests, connLimits.MaxLifetime)
+	}
+	mgr.Serve(traffic)
+	if separateAdmin {
+		admin := lifecycle_pkg.Server{
+			Name:            "admin",
+			Server:          newHTTPServer(cfg.AdminListener.Addr, adminRootHandler, cfg.AdminListener.Timeouts),
+			Listener:        adminListener,
+			ShutdownOrder:   1,
+			ShutdownTimeout: cfg.AdminListener.Timeouts.Shutdown,
+		}
+		mgr.Serve(admin)
 	}
 
 	// 8. Настройка Graceful Shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	log.Println("INFO: Server started. Press Ctrl+C to shut down.")
 
-	// Запускаем сервер в отдельной горутине, чтобы не блокировать основной поток.
-	go func() {
-		log.Printf("INFO: Starting server on %s", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			// Критическая ошибка при запуске сервера (кроме штатного закрытия).
-			log.Fatalf("FATAL: Could not start server on %s: %v", server.Addr, err)
+	// 9. Ожидание сигнала завершения (или ошибки одного из серверов) и Graceful Shutdown
+	serveErr := mgr.Wait(quit)
+	shutdownErr := mgr.Shutdown(5 * time.Second)
+	if shutdownErr != nil {
+		log.Printf("WARN: Shutdown was not graceful: %v", shutdownErr)
+	}
+	// Отчет формируется после остановки серверов, когда все запросы уже учтены
+	report := trafficRecorder.ShutdownReport(shutdownErr)
+	report.Log()
+	if cfg.ShutdownReport.WebhookURL != "" {
+		// URL вебхука - секрет (см. shutdown_report.webhook_url), поэтому в лог не пишется.
+		if err := report.Send(cfg.ShutdownReport.WebhookURL, cfg.ShutdownReport.WebhookTimeout); err != nil {
+			log.Printf("WARN: Failed to send shutdown report to the webhook: %v", err)
+		} else {
+			log.Println("INFO: Shutdown report sent to the webhook")
 		}
-	}()
-	log.Println("INFO: Server started. Press Ctrl+C to shut down.")
+	}
+	if serveErr != nil {
+		log.Fatalf("FATAL: %v", serveErr)
+	}
+
+	log.Println("INFO: Server shut down gracefully. Exiting.")
+}
 
-	// 9. Ожидание сигнала завершения и Graceful Shutdown
-	// Блокируем основной поток, ожидая сигнала в канал quit.
-	<-quit
-	log.Println("INFO: Received shutdown signal. Starting graceful shutdown...")
+// newBackendTLS преобразует TLS-настройки бэкенда из конфигурации.
+func newBackendTLS(t cfg_pkg.BackendTLSConfig) balancer_pkg.BackendTLS {
+	return balancer_pkg.BackendTLS{
+		CAFile:             t.CAFile,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		CertFile:           t.CertFile,
+		KeyFile:            t.KeyFile,
+	}
+}
 
-	// Создаем контекст с таймаутом для graceful shutdown.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// backendsWithTLSFiles возвращает бэкенды всех пулов, для которых заданы файлы TLS
+// (ca_file, cert_file или key_file).
+func backendsWithTLSFiles(cfg *cfg_pkg.Config) []cfg_pkg.BackendConfig {
+	var result []cfg_pkg.BackendConfig
+	add := func(backends []cfg_pkg.BackendConfig) {
+		for _, b := range backends {
+			if b.TLS.CAFile != "" || b.TLS.CertFile != "" || b.TLS.KeyFile != "" {
+				result = append(result, b)
+			}
+		}
+	}
+	add(cfg.Backends)
+	for _, pc := range cfg.Pools {
+		add(pc.Backends)
+	}
+	return result
+}
 
-	// Пытаемся грациозно завершить работу сервера.
-	if err := server.Shutdown(ctx); err != nil {
-		// Ошибка при graceful shutdown (например, истек таймаут).
-		log.Fatalf("FATAL: Server forced to shutdown: %v", err)
+// newBackendSpecs преобразует бэкенды из конфигурации в описания для пула.
+func newBackendSpecs(backends []cfg_pkg.BackendConfig) []balancer_pkg.BackendSpec {
+	specs := make([]balancer_pkg.BackendSpec, 0, len(backends))
+	for _, b := range backends {
+		var dial balancer_pkg.DialContextFunc
+		if b.DialVia != "" {
+			var err error
+			if dial, err = balancer_pkg.NewProxyDialer(b.DialVia); err != nil {
+				log.Fatalf("FATAL: Invalid dial_via for backend '%s': %v", b.URL, err)
+			}
+		}
+		specs = append(specs, balancer_pkg.BackendSpec{
+			Name:     b.Name,
+			URL:      b.URL,
+			MaxRPS:   b.MaxRPS,
+			MaxConns: b.MaxConns,
+			HealthCheck: balancer_pkg.HealthCheckOverride{
+				Interval: b.HealthCheck.Interval,
+				Timeout:  b.HealthCheck.Timeout,
+				Mode:     b.HealthCheck.Mode,
+				Path:     b.HealthCheck.Path,
+				Scheme:   b.HealthCheck.Scheme,
+				Headers:  b.HealthCheck.Headers,
+			},
+			TLS:      newBackendTLS(b.TLS),
+			Dial:     dial,
+			Protocol: b.Protocol,
+		})
 	}
+	return specs
+}
 
-	log.Println("INFO: Server shut down gracefully. Exiting.")
+// configurePool применяет к пулу pool общие параметры балансировки и соединений с бэкендами
+// из cfg, политику проверок состояния hc и стратегию strategy.
+func configurePool(pool *balancer_pkg.ServerPool, cfg *cfg_pkg.Config, hc cfg_pkg.HealthCheckConfig, strategy string) {
+	if err := pool.SetStrategy(strategy); err != nil {
+		log.Fatalf("FATAL: Invalid balancing strategy: %v", err)
+	}
+	if cfg.HashOn != "" {
+		if err := pool.SetHashOn(cfg.HashOn); err != nil {
+			log.Fatalf("FATAL: Invalid hash_on: %v", err)
+		}
+	}
+	pool.SetPanicThreshold(cfg.PanicThreshold)
+	pool.SetSlowStart(cfg.SlowStart)
+	if err := pool.SetHealthCheckPolicy(balancer_pkg.HealthCheckPolicy{
+		Mode:               hc.Mode,
+		Path:               hc.Path,
+		Method:             hc.Method,
+		ExpectedStatuses:   hc.ExpectedStatuses,
+		HealthyThreshold:   hc.HealthyThreshold,
+		UnhealthyThreshold: hc.UnhealthyThreshold,
+		ExpectedBody:       hc.ExpectedBody,
+		ExpectedBodyRegex:  hc.ExpectedBodyRegex,
+		Jitter:             hc.Jitter,
+		MaxBackoff:         hc.MaxBackoff,
+		DegradedLatency:    hc.DegradedLatency,
+		GRPCService:        hc.GRPCService,
+		Headers:            hc.Headers,
+	}); err != nil {
+		log.Fatalf("FATAL: Invalid health_check: %v", err)
+	}
+	pool.SetFlapDetection(balancer_pkg.FlapDetection{
+		Enabled:     cfg.FlapDetection.Enabled,
+		Transitions: cfg.FlapDetection.Transitions,
+		Window:      cfg.FlapDetection.Window,
+		HoldDown:    cfg.FlapDetection.HoldDown,
+	})
+	if err := pool.SetTransportSettings(balancer_pkg.TransportSettings{
+		MaxIdleConnsPerHost:   cfg.BackendTransport.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.BackendTransport.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.BackendTransport.IdleConnTimeout,
+		ResponseHeaderTimeout: cfg.BackendTransport.ResponseHeaderTimeout,
+		DialTimeout:           cfg.BackendTransport.DialTimeout,
+		TLSHandshakeTimeout:   cfg.BackendTransport.TLSHandshakeTimeout,
+		TCPKeepAlive:          cfg.BackendTransport.TCPKeepAlive,
+		DisableKeepAlives:     cfg.BackendTransport.DisableKeepAlives,
+		Protocol:              cfg.BackendTransport.Protocol,
+	}); err != nil {
+		log.Fatalf("FATAL: Invalid backend_transport configuration: %v", err)
+	}
+	if err := pool.SetEgressProxy(balancer_pkg.EgressProxy{
+		Mode:    cfg.BackendTransport.Proxy.Mode,
+		URL:     cfg.BackendTransport.Proxy.URL,
+		NoProxy: cfg.BackendTransport.Proxy.NoProxy,
+	}); err != nil {
+		log.Fatalf("FATAL: Invalid backend_transport.proxy configuration: %v", err)
+	}
+	if err := pool.SetHostPolicy(balancer_pkg.HostPolicy{
+		Mode:     cfg.HostHeader.Mode,
+		Override: cfg.HostHeader.Override,
+	}); err != nil {
+		log.Fatalf("FATAL: Invalid host_header configuration: %v", err)
+	}
+	if err := pool.SetProtocolPolicy(balancer_pkg.ProtocolPolicy{
+		ExpectContinue:        cfg.Protocol.ExpectContinue,
+		ExpectContinueTimeout: cfg.Protocol.ExpectContinueTimeout,
+		HTTP10Connection:      cfg.Protocol.HTTP10Connection,
+	}); err != nil {
+		log.Fatalf("FATAL: Invalid protocol configuration: %v", err)
+	}
+	if cfg.SlowRequests.Threshold > 0 {
+		pool.SetSlowRequestPolicy(balancer_pkg.SlowRequestPolicy{
+			Threshold:            cfg.SlowRequests.Threshold,
+			SampledTraceResponse: cfg.SlowRequests.SampledTraceResponse,
+		})
+	}
+	pool.SetUpgradePolicy(balancer_pkg.UpgradePolicy{
+		IdleTimeout: cfg.WebSocket.IdleTimeout,
+		MaxLifetime: cfg.WebSocket.MaxLifetime,
+	})
+	rewrites := make([]balancer_pkg.PathRewrite, 0, len(cfg.PathRewrites))
+	for _, rc := range cfg.PathRewrites {
+		rewrites = append(rewrites, balancer_pkg.PathRewrite{
+			PathPrefix:  rc.PathPrefix,
+			StripPrefix: rc.StripPrefix,
+			AddPrefix:   rc.AddPrefix,
+			Regex:       rc.Regex,
+			Replacement: rc.Replacement,
+		})
+	}
+	if err := pool.SetPathRewrites(rewrites); err != nil {
+		log.Fatalf("FATAL: Invalid path_rewrites: %v", err)
+	}
+	if cfg.Retries.MaxRetries > 0 {
+		pool.SetRetryPolicy(balancer_pkg.RetryPolicy{
+			MaxRetries:        cfg.Retries.MaxRetries,
+			MemoryBufferBytes: cfg.Retries.MemoryBufferBytes,
+			MaxBodyBytes:      cfg.Retries.MaxBodyBytes,
+			TempDir:           cfg.Retries.TempDir,
+			RetryStatuses:     cfg.Retries.RetryOnStatuses,
+		})
+	}
+}
+
+// poolName возвращает имя пула для логов ("" - основной пул).
+func poolName(name string) string {
+	if name == "" {
+		return "main"
+	}
+	return name
+}
+
+// poolHealth сообщает о неисправности пула: пул еще не готов (см. balancer.StartupGate) или
+// нет ни одного исправного бэкенда.
+func poolHealth(pool *balancer_pkg.ServerPool) error {
+	if !pool.Ready() {
+		return errors.New("waiting for healthy backends")
+	}
+	for _, b := range pool.GetBackends() {
+		if b.IsAlive() {
+			return nil
+		}
+	}
+	return errors.New("no healthy backends")
+}
+
+// findBackend возвращает бэкенд с именем name из любого пула pools или nil, если такого нет.
+func findBackend(pools []*balancer_pkg.ServerPool, name string) *balancer_pkg.Backend {
+	for _, pool := range pools {
+		if b := pool.GetBackendByName(name); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// newHTTPServer создает HTTP-сервер адреса addr с таймаутами timeouts.
+func newHTTPServer(addr string, handler http.Handler, timeouts cfg_pkg.ServerTimeoutsConfig) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  timeouts.Read,
+		WriteTimeout: timeouts.Write,
+		IdleTimeout:  timeouts.Idle,
+	}
 }
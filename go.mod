@@ -1,12 +1,17 @@
 module cloud/load_balancer
 
-go 1.22.2
+// Go 1.24 нужен для http.Protocols: HTTP/2 без TLS (h2c) к бэкендам и в проверках
+// состояния настраивается стандартной библиотекой, без зависимости от golang.org/x/net.
+go 1.24
 
 require (
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/mattn/go-sqlite3 v1.14.28
 	gopkg.in/yaml.v3 v3.0.1
 )
 
+require golang.org/x/sys v0.13.0 // indirect
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -0,0 +1,491 @@
+package adminapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud/load_balancer/internal/balancer"
+	"cloud/load_balancer/internal/httputil"
+)
+
+// Структура для ответа с информацией о бэкенде
+type backendResponse struct {
+	Pool                string               `json:"pool,omitempty"` // Пусто - основной пул.
+	Name                string               `json:"name"`
+	URL                 string               `json:"url"`
+	Alive               bool                 `json:"alive"`
+	State               balancer.HealthState `json:"state"`
+	Enabled             bool                 `json:"enabled"` // false - выключен администратором.
+	Reason              string               `json:"reason"`
+	Since               time.Time            `json:"since"`
+	LastCheck           *time.Time           `json:"last_check,omitempty"`
+	LastError           string               `json:"last_error,omitempty"`
+	ConsecutiveFailures int                  `json:"consecutive_failures"`
+	ActiveRequests      int64                `json:"active_requests"`
+	MaxConns            int64                `json:"max_conns,omitempty"` // 0 - без ограничения.
+	Protocol            string               `json:"protocol"`
+	OpenConnections     int64                `json:"open_connections"`
+	DrainComplete       *bool                `json:"drain_complete,omitempty"` // Только в режиме drain.
+}
+
+// Структура для ответа с историей состояния бэкенда
+type backendHistoryResponse struct {
+	Backend       string                      `json:"backend"`
+	State         balancer.HealthState        `json:"state"`
+	Flapping      bool                        `json:"flapping"`
+	HoldDownUntil *time.Time                  `json:"hold_down_until,omitempty"`
+	Transitions   []balancer.HealthTransition `json:"transitions"`
+}
+
+// Структура для ответа на удаление бэкенда
+type removeBackendResponse struct {
+	Backend      string `json:"backend"`
+	Status       string `json:"status"`
+	DrainTimeout string `json:"drain_timeout"`
+}
+
+// Структура запроса на добавление бэкенда
+type addBackendRequest struct {
+	Name     string  `json:"name"`
+	URL      string  `json:"url"`
+	MaxRPS   float64 `json:"max_rps"`
+	MaxConns int     `json:"max_conns"`
+	Protocol string  `json:"protocol"` // Пусто - протокол пула.
+}
+
+// validate проверяет поля запроса на добавление бэкенда.
+func (req addBackendRequest) validate() httputil.ValidationErrors {
+	var errs httputil.ValidationErrors
+	if req.URL == "" {
+		errs.Add("url", "is required", req.URL)
+	}
+	if strings.Contains(req.Name, "/") {
+		errs.Add("name", "must not contain '/'", req.Name)
+	}
+	if req.MaxRPS < 0 {
+		errs.Add("max_rps", "must not be negative", req.MaxRPS)
+	}
+	if req.MaxConns < 0 {
+		errs.Add("max_conns", "must not be negative", req.MaxConns)
+	}
+	switch req.Protocol {
+	case "", balancer.ProtocolAuto, balancer.ProtocolHTTP1, balancer.ProtocolHTTP2:
+	default:
+		errs.Add("protocol", "must be auto, http1 or http2", req.Protocol)
+	}
+	return errs
+}
+
+// Структура запроса на замену списка бэкендов
+type replaceBackendsRequest struct {
+	Backends []addBackendRequest `json:"backends"`
+}
+
+// validate проверяет все бэкенды списка.
+func (req replaceBackendsRequest) validate() httputil.ValidationErrors {
+	var errs httputil.ValidationErrors
+	if req.Backends == nil {
+		errs.Add("backends", "is required", nil)
+	}
+	for i, b := range req.Backends {
+		for _, fe := range b.validate() {
+			errs.Add(fmt.Sprintf("backends[%d].%s", i, fe.Field), fe.Constraint, fe.Value)
+		}
+	}
+	return errs
+}
+
+// Структура запроса на изменение бэкенда
+type updateBackendRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Reason  string `json:"reason"` // Причина для истории состояния (необязательно).
+}
+
+// Структура запроса на перевод бэкенда в режим drain
+type drainBackendRequest struct {
+	Timeout string `json:"timeout"` // Пусто - drain_timeout из конфигурации.
+	Reason  string `json:"reason"`
+}
+
+// Структура для ответа на перевод бэкенда в режим drain
+type drainBackendResponse struct {
+	Backend      string `json:"backend"`
+	Status       string `json:"status"`
+	DrainTimeout string `json:"drain_timeout"`
+}
+
+// Структура для ответа на принудительное закрытие простаивающих соединений
+type closeIdleResponse struct {
+	Backend string `json:"backend"`
+	Status  string `json:"status"`
+}
+
+// BackendsHandler обрабатывает запросы к Admin API для бэкендов (/admin/backends).
+// Бэкенды добавляются и заменяются только в основном пуле; бэкенды дополнительных пулов
+// перечисляются вместе с именем пула, и к ним применяются операции над бэкендом по имени
+// (выключение, drain, удаление), так как имена бэкендов уникальны во всех пулах (см.
+// balancer.JoinPools).
+type BackendsHandler struct {
+	pool         *balancer.ServerPool            // Основной пул.
+	pools        map[string]*balancer.ServerPool // "" - основной пул.
+	drainTimeout time.Duration
+}
+
+// NewBackendsHandler создает новый обработчик Admin API для бэкендов.
+// pools - пулы по имени (основной пул - под пустым именем); drainTimeout ограничивает время
+// ожидания завершения активных запросов при удалении бэкенда.
+func NewBackendsHandler(pools map[string]*balancer.ServerPool, drainTimeout time.Duration) *BackendsHandler {
+	if pools[""] == nil {
+		panic("ServerPool cannot be nil for BackendsHandler")
+	}
+	return &BackendsHandler{pool: pools[""], pools: pools, drainTimeout: drainTimeout}
+}
+
+// poolNameOf возвращает имя пула, которому принадлежит бэкенд b ("" - основной пул).
+func (h *BackendsHandler) poolNameOf(b *balancer.Backend) string {
+	for name, pool := range h.pools {
+		if pool.GetBackendByName(b.Name()) == b {
+			return name
+		}
+	}
+	return ""
+}
+
+// poolOf возвращает пул, содержащий бэкенд с именем name, или основной пул, если такого
+// бэкенда нет.
+func (h *BackendsHandler) poolOf(name string) *balancer.ServerPool {
+	for _, pool := range h.pools {
+		if pool.GetBackendByName(name) != nil {
+			return pool
+		}
+	}
+	return h.pool
+}
+
+// ServeHTTP основной маршрутизатор для /admin/backends
+func (h *BackendsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/backends")
+	path = strings.Trim(path, "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "":
+		switch r.Method {
+		case http.MethodGet:
+			h.handleListBackends(w, r)
+		case http.MethodPost:
+			h.handleAddBackend(w, r)
+		case http.MethodPut:
+			h.handleReplaceBackends(w, r)
+		default:
+			httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "history":
+		if r.Method != http.MethodGet {
+			httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+			return
+		}
+		h.handleGetHistory(w, r, parts[0])
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "close-idle":
+		if r.Method != http.MethodPost {
+			httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+			return
+		}
+		h.handleCloseIdle(w, r, parts[0])
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "drain":
+		switch r.Method {
+		case http.MethodPost:
+			h.handleDrainBackend(w, r, parts[0])
+		case http.MethodDelete:
+			h.handleUndrainBackend(w, r, parts[0])
+		default:
+			httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			h.handleGetBackend(w, r, parts[0])
+		case http.MethodPatch:
+			h.handleUpdateBackend(w, r, parts[0])
+		case http.MethodDelete:
+			h.handleRemoveBackend(w, r, parts[0])
+		default:
+			httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+	default:
+		httputil.RespondWithError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// handleListBackends обрабатывает GET /admin/backends: бэкенды основного пула, затем
+// дополнительных пулов в порядке имен.
+func (h *BackendsHandler) handleListBackends(w http.ResponseWriter, r *http.Request) {
+	resp := make([]backendResponse, 0)
+	for _, name := range sortedPoolNames(h.pools) {
+		for _, b := range h.pools[name].GetBackends() {
+			item := newBackendResponse(b)
+			item.Pool = name
+			resp = append(resp, item)
+		}
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// sortedPoolNames возвращает имена пулов: основной пул ("") первым, остальные по алфавиту.
+func sortedPoolNames(pools map[string]*balancer.ServerPool) []string {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newBackendResponse описывает бэкенд b вместе с именем его пула.
+func (h *BackendsHandler) newBackendResponse(b *balancer.Backend) backendResponse {
+	resp := newBackendResponse(b)
+	resp.Pool = h.poolNameOf(b)
+	return resp
+}
+
+// handleGetBackend обрабатывает GET /admin/backends/{name}
+func (h *BackendsHandler) handleGetBackend(w http.ResponseWriter, r *http.Request, name string) {
+	backend := h.poolOf(name).GetBackendByName(name)
+	if backend == nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, h.newBackendResponse(backend))
+}
+
+func newBackendResponse(b *balancer.Backend) backendResponse {
+	state := b.State()
+	check := b.CheckStatus()
+	resp := backendResponse{
+		Name:                b.Name(),
+		URL:                 b.URL.String(),
+		Alive:               b.IsAlive(),
+		State:               state.State,
+		Enabled:             !b.AdminDown(),
+		Reason:              state.Reason,
+		Since:               state.Since,
+		LastError:           check.LastError,
+		ConsecutiveFailures: check.ConsecutiveFailures,
+		ActiveRequests:      b.ActiveRequests(),
+		MaxConns:            b.MaxConns(),
+		Protocol:            b.Protocol(),
+		OpenConnections:     b.OpenConnections(),
+	}
+	if !check.LastCheck.IsZero() {
+		resp.LastCheck = &check.LastCheck
+	}
+	if draining, complete := b.DrainStatus(); draining {
+		resp.DrainComplete = &complete
+	}
+	return resp
+}
+
+// handleGetHistory обрабатывает GET /admin/backends/{name}/history
+func (h *BackendsHandler) handleGetHistory(w http.ResponseWriter, r *http.Request, name string) {
+	backend := h.poolOf(name).GetBackendByName(name)
+	if backend == nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+		return
+	}
+
+	flapping, holdDownUntil := backend.FlapStatus()
+	resp := backendHistoryResponse{
+		Backend:     backend.Name(),
+		State:       backend.State().State,
+		Flapping:    flapping,
+		Transitions: backend.HealthHistory(),
+	}
+	if holdDownUntil.After(time.Now()) {
+		resp.HoldDownUntil = &holdDownUntil
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// handleAddBackend обрабатывает POST /admin/backends.
+// Бэкенд добавляется без перезапуска и получает трафик после первой успешной проверки.
+func (h *BackendsHandler) handleAddBackend(w http.ResponseWriter, r *http.Request) {
+	var req addBackendRequest
+	if err := httputil.DecodeJSONBody(r, &req); err != nil {
+		httputil.RespondWithValidationError(w, err)
+		return
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		httputil.RespondWithValidationErrors(w, errs)
+		return
+	}
+
+	backend, err := h.pool.AddBackend(balancer.BackendSpec{Name: req.Name, URL: req.URL, MaxRPS: req.MaxRPS, MaxConns: req.MaxConns, Protocol: req.Protocol})
+	if err != nil {
+		if errors.Is(err, balancer.ErrDuplicateBackend) {
+			httputil.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		httputil.RespondWithError(w, http.StatusBadRequest, "Invalid backend: "+err.Error())
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusCreated, h.newBackendResponse(backend))
+}
+
+// handleReplaceBackends обрабатывает PUT /admin/backends: замена всего списка бэкендов пула.
+// Список применяется целиком или не применяется вовсе; удаляемые и заменяемые бэкенды
+// выводятся из пула с drain.
+func (h *BackendsHandler) handleReplaceBackends(w http.ResponseWriter, r *http.Request) {
+	var req replaceBackendsRequest
+	if err := httputil.DecodeJSONBody(r, &req); err != nil {
+		httputil.RespondWithValidationError(w, err)
+		return
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		httputil.RespondWithValidationErrors(w, errs)
+		return
+	}
+
+	specs := make([]balancer.BackendSpec, 0, len(req.Backends))
+	for _, b := range req.Backends {
+		specs = append(specs, balancer.BackendSpec{Name: b.Name, URL: b.URL, MaxRPS: b.MaxRPS, MaxConns: b.MaxConns, Protocol: b.Protocol})
+	}
+	result, err := h.pool.ReplaceBackends(specs, h.drainTimeout)
+	if err != nil {
+		if errors.Is(err, balancer.ErrBackendsManaged) || errors.Is(err, balancer.ErrBackendRemoving) {
+			httputil.RespondWithError(w, http.StatusConflict, "Failed to replace backends: "+err.Error())
+			return
+		}
+		httputil.RespondWithError(w, http.StatusBadRequest, "Invalid backends: "+err.Error())
+		return
+	}
+	log.Printf("INFO: Backends replaced via Admin API: added %v, updated %v, removed %v", result.Added, result.Updated, result.Removed)
+	httputil.RespondWithJSON(w, http.StatusOK, result)
+}
+
+// handleUpdateBackend обрабатывает PATCH /admin/backends/{name}: включение и выключение
+// бэкенда ({"enabled": false}). Выключенный бэкенд остается в пуле, но не получает трафик.
+func (h *BackendsHandler) handleUpdateBackend(w http.ResponseWriter, r *http.Request, name string) {
+	pool := h.poolOf(name)
+	backend := pool.GetBackendByName(name)
+	if backend == nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+		return
+	}
+	var req updateBackendRequest
+	if err := httputil.DecodeJSONBody(r, &req); err != nil {
+		httputil.RespondWithValidationError(w, err)
+		return
+	}
+	if req.Enabled == nil {
+		var errs httputil.ValidationErrors
+		errs.Add("enabled", "is required", nil)
+		httputil.RespondWithValidationErrors(w, errs)
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "disabled via Admin API"
+		if *req.Enabled {
+			reason = "enabled via Admin API"
+		}
+	}
+	if err := pool.SetBackendEnabled(name, *req.Enabled, reason); err != nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+		return
+	}
+	log.Printf("INFO: Backend %s set to enabled=%t via Admin API (%s)", name, *req.Enabled, reason)
+	httputil.RespondWithJSON(w, http.StatusOK, h.newBackendResponse(backend))
+}
+
+// handleRemoveBackend обрабатывает DELETE /admin/backends/{name}.
+// Бэкенд сразу перестает получать новые запросы и удаляется из пула после drain.
+func (h *BackendsHandler) handleRemoveBackend(w http.ResponseWriter, r *http.Request, name string) {
+	if _, err := h.poolOf(name).RemoveBackend(name, h.drainTimeout); err != nil {
+		if errors.Is(err, balancer.ErrBackendNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+			return
+		}
+		httputil.RespondWithError(w, http.StatusConflict, "Failed to remove backend: "+err.Error())
+		return
+	}
+
+	resp := removeBackendResponse{
+		Backend:      name,
+		Status:       "draining",
+		DrainTimeout: h.drainTimeout.String(),
+	}
+	httputil.RespondWithJSON(w, http.StatusAccepted, resp)
+}
+
+// handleDrainBackend обрабатывает POST /admin/backends/{name}/drain.
+// Бэкенд перестает получать новые запросы, но остается в пуле; начатые запросы завершаются.
+func (h *BackendsHandler) handleDrainBackend(w http.ResponseWriter, r *http.Request, name string) {
+	var req drainBackendRequest
+	if r.ContentLength != 0 {
+		if err := httputil.DecodeJSONBody(r, &req); err != nil {
+			httputil.RespondWithValidationError(w, err)
+			return
+		}
+	}
+	timeout := h.drainTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d < 0 {
+			var errs httputil.ValidationErrors
+			errs.Add("timeout", "must be a non-negative duration (e.g. 30s)", req.Timeout)
+			httputil.RespondWithValidationErrors(w, errs)
+			return
+		}
+		timeout = d
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "drained via Admin API"
+	}
+
+	if _, err := h.poolOf(name).DrainBackend(name, timeout, reason); err != nil {
+		if errors.Is(err, balancer.ErrBackendNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+			return
+		}
+		httputil.RespondWithError(w, http.StatusConflict, "Failed to drain backend: "+err.Error())
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusAccepted, drainBackendResponse{Backend: name, Status: "draining", DrainTimeout: timeout.String()})
+}
+
+// handleUndrainBackend обрабатывает DELETE /admin/backends/{name}/drain: возврат бэкенда
+// из режима drain в ротацию.
+func (h *BackendsHandler) handleUndrainBackend(w http.ResponseWriter, r *http.Request, name string) {
+	pool := h.poolOf(name)
+	backend := pool.GetBackendByName(name)
+	if backend == nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+		return
+	}
+	if err := pool.UndrainBackend(name, "returned to rotation via Admin API"); err != nil {
+		if errors.Is(err, balancer.ErrBackendNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+			return
+		}
+		httputil.RespondWithError(w, http.StatusConflict, "Failed to undrain backend: "+err.Error())
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, h.newBackendResponse(backend))
+}
+
+// handleCloseIdle обрабатывает POST /admin/backends/{name}/close-idle.
+// Закрывает простаивающие keep-alive соединения к бэкенду, не затрагивая активные запросы.
+func (h *BackendsHandler) handleCloseIdle(w http.ResponseWriter, r *http.Request, name string) {
+	if err := h.poolOf(name).CloseIdleConnections(name); err != nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "Backend not found: "+name)
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, closeIdleResponse{Backend: name, Status: "idle connections closed"})
+}
@@ -0,0 +1,58 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud/load_balancer/internal/balancer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBackendsHandler_Pools проверяет, что бэкенды дополнительных пулов перечисляются
+// с именем пула и управляются по имени, а добавляются бэкенды только в основной пул.
+func TestBackendsHandler_Pools(t *testing.T) {
+	primary, err := balancer.NewNamedServerPool([]balancer.BackendSpec{{Name: "app-1", URL: "http://10.0.0.1:8080"}}, time.Second, time.Second)
+	require.NoError(t, err)
+	api, err := balancer.NewNamedServerPool([]balancer.BackendSpec{{Name: "api-1", URL: "http://10.0.1.1:8080"}}, time.Second, time.Second)
+	require.NoError(t, err)
+	pools := map[string]*balancer.ServerPool{"": primary, "api": api}
+	handler := http.StripPrefix("/admin/backends", NewBackendsHandler(pools, time.Second))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/admin/backends", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list []backendResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "app-1", list[0].Name)
+	assert.Empty(t, list[0].Pool, "Main pool has no name")
+	assert.Equal(t, "api-1", list[1].Name)
+	assert.Equal(t, "api", list[1].Pool)
+
+	rr = serve(http.MethodPatch, "/admin/backends/api-1", `{"enabled": false}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.True(t, api.GetBackendByName("api-1").AdminDown(), "Backend of an extra pool is disabled in its pool")
+	assert.Contains(t, rr.Body.String(), `"pool":"api"`)
+
+	rr = serve(http.MethodPost, "/admin/backends", `{"name": "app-2", "url": "http://10.0.0.2:8080"}`)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	assert.NotNil(t, primary.GetBackendByName("app-2"), "New backends are added to the main pool")
+
+	rr = httptest.NewRecorder()
+	NewStatsHandler(pools).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/stats", nil))
+	var stats statsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, map[string]string{"api": balancer.StrategyRoundRobin}, stats.PoolStrategies)
+	require.Len(t, stats.Backends, 3)
+	assert.Equal(t, "api", stats.Backends[2].Pool)
+}
@@ -0,0 +1,48 @@
+package adminapi
+
+import (
+	"net/http"
+	"strings"
+
+	"cloud/load_balancer/internal/httputil"
+	rl "cloud/load_balancer/internal/ratelimiter"
+)
+
+// Структура для ответа на снятие банов
+type clearBansResponse struct {
+	Cleared int `json:"cleared"`
+}
+
+// BansHandler обрабатывает запросы к Admin API для банов rate limiter (/admin/bans).
+type BansHandler struct {
+	limiter *rl.Limiter
+}
+
+// NewBansHandler создает новый обработчик Admin API для банов.
+func NewBansHandler(limiter *rl.Limiter) *BansHandler {
+	if limiter == nil {
+		panic("Limiter cannot be nil for BansHandler")
+	}
+	return &BansHandler{limiter: limiter}
+}
+
+// ServeHTTP обрабатывает GET /admin/bans (список активных банов),
+// DELETE /admin/bans (снять все баны) и DELETE /admin/bans/{client_id}.
+func (h *BansHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	clientID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/bans"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && clientID == "":
+		httputil.RespondWithJSON(w, http.StatusOK, h.limiter.Bans())
+	case r.Method == http.MethodDelete && clientID == "":
+		httputil.RespondWithJSON(w, http.StatusOK, clearBansResponse{Cleared: h.limiter.ClearBans()})
+	case r.Method == http.MethodDelete:
+		if !h.limiter.Unban(clientID) {
+			httputil.RespondWithError(w, http.StatusNotFound, "Client is not banned: "+clientID)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
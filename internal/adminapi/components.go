@@ -0,0 +1,50 @@
+package adminapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/lifecycle"
+)
+
+// componentHealthTimeout ограничивает время проверок состояния компонентов.
+const componentHealthTimeout = 2 * time.Second
+
+// Структура для ответа /admin/components
+type componentsResponse struct {
+	Healthy    bool                        `json:"healthy"`
+	Components []lifecycle.ComponentStatus `json:"components"`
+}
+
+// ComponentsHandler обрабатывает запросы к /admin/components: состояние компонентов
+// приложения (хранилище лимитов, rate limiter, пул бэкендов и т.п.).
+type ComponentsHandler struct {
+	manager *lifecycle.Manager
+}
+
+// NewComponentsHandler создает новый обработчик состояния компонентов.
+func NewComponentsHandler(manager *lifecycle.Manager) *ComponentsHandler {
+	if manager == nil {
+		panic("lifecycle Manager cannot be nil for ComponentsHandler")
+	}
+	return &ComponentsHandler{manager: manager}
+}
+
+// ServeHTTP обрабатывает GET /admin/components: 200, если все компоненты запущены и
+// исправны, иначе 503.
+func (h *ComponentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), componentHealthTimeout)
+	defer cancel()
+	statuses, healthy := h.manager.Health(ctx)
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusServiceUnavailable
+	}
+	httputil.RespondWithJSON(w, status, componentsResponse{Healthy: healthy, Components: statuses})
+}
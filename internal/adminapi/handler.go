@@ -1,9 +1,14 @@
 package adminapi
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"cloud/load_balancer/internal/httputil"
 	rl "cloud/load_balancer/internal/ratelimiter"
@@ -11,16 +16,90 @@ import (
 
 // Структура для запроса на создание/обновление лимита
 type setLimitRequest struct {
-	ClientID string  `json:"client_id"`
-	Capacity int64   `json:"capacity"`
-	Rate     float64 `json:"rate"`
+	ClientID    string  `json:"client_id"`
+	Capacity    int64   `json:"capacity"`
+	Rate        float64 `json:"rate"`
+	Description string  `json:"description"`
 }
 
 // Структура для ответа с информацией о лимите
 type limitResponse struct {
-	ClientID string  `json:"client_id"`
-	Capacity int64   `json:"capacity"`
-	Rate     float64 `json:"rate"`
+	ClientID    string     `json:"client_id"`
+	Capacity    int64      `json:"capacity"`
+	Rate        float64    `json:"rate"`
+	Description string     `json:"description,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	UpdatedBy   string     `json:"updated_by,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	Version     int64      `json:"version"`
+}
+
+// AdminUserHeader - заголовок с именем оператора, выполняющего изменение
+// (обычно выставляется аутентифицирующим прокси перед Admin API).
+const AdminUserHeader = "X-Admin-User"
+
+func newLimitResponse(limit rl.ClientLimit) limitResponse {
+	resp := limitResponse{
+		ClientID:    limit.ClientID,
+		Capacity:    limit.Capacity,
+		Rate:        limit.Rate,
+		Description: limit.Description,
+		CreatedBy:   limit.CreatedBy,
+		UpdatedBy:   limit.UpdatedBy,
+		Version:     limit.Version,
+	}
+	if !limit.UpdatedAt.IsZero() {
+		resp.UpdatedAt = &limit.UpdatedAt
+	}
+	return resp
+}
+
+// validate проверяет поля запроса и возвращает ошибки всех невалидных полей.
+func (req setLimitRequest) validate() httputil.ValidationErrors {
+	var errs httputil.ValidationErrors
+	if req.ClientID == "" {
+		errs.Add("client_id", "is required", req.ClientID)
+	}
+	if req.Capacity <= 0 {
+		errs.Add("capacity", "must be positive", req.Capacity)
+	}
+	if req.Rate <= 0 {
+		errs.Add("rate", "must be positive", req.Rate)
+	}
+	return errs
+}
+
+// limitETag возвращает ETag лимита, построенный по его версии.
+func limitETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch извлекает ожидаемую версию лимита из заголовка If-Match.
+// Возвращает ok=false, если заголовок отсутствует.
+func parseIfMatch(r *http.Request) (version int64, ok bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, nil
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err = strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, true, fmt.Errorf("invalid If-Match header: expected ETag returned by GET /admin/limits/{client_id}")
+	}
+	return version, true, nil
+}
+
+// adminActor возвращает автора изменения: значение AdminUserHeader или,
+// если заголовок не задан, IP-адрес клиента Admin API.
+func adminActor(r *http.Request) string {
+	if user := strings.TrimSpace(r.Header.Get(AdminUserHeader)); user != "" {
+		return user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // AdminHandler обрабатывает запросы к Admin API.
@@ -46,15 +125,16 @@ func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		if path == "" {
 			h.handleSetLimit(w, r)
+		} else if clientID, ok := strings.CutSuffix(path, "/restore"); ok && clientID != "" {
+			h.handleRestoreLimit(w, r, clientID)
 		} else {
-			httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed (POST expects no client ID in path)")
+			httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed (POST expects no client ID in path or /{client_id}/restore)")
 		}
 	case http.MethodGet:
 		if path != "" {
 			h.handleGetLimit(w, r, path)
 		} else {
-			// GET /admin/limits
-			httputil.RespondWithError(w, http.StatusNotImplemented, "Listing limits is not implemented")
+			h.handleListLimits(w, r)
 		}
 	case http.MethodDelete:
 		// DELETE /admin/limits/{client_id} - Удаление лимита
@@ -71,39 +151,113 @@ func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // handleSetLimit обрабатывает POST /admin/limits
 func (h *AdminHandler) handleSetLimit(w http.ResponseWriter, r *http.Request) {
 	var req setLimitRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		httputil.RespondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+	if err := httputil.DecodeJSONBody(r, &req); err != nil {
+		httputil.RespondWithValidationError(w, err)
+		return
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		httputil.RespondWithValidationErrors(w, errs)
 		return
 	}
-	defer r.Body.Close()
 
-	if req.ClientID == "" {
-		httputil.RespondWithError(w, http.StatusBadRequest, "client_id is required")
+	// Обновление существующего лимита требует If-Match с его текущим ETag,
+	// чтобы параллельные правки не перезаписывали друг друга.
+	expectedVersion, hasIfMatch, err := parseIfMatch(r)
+	if err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if req.Capacity <= 0 {
-		httputil.RespondWithError(w, http.StatusBadRequest, "capacity must be positive")
+
+	limit := rl.ClientLimit{
+		ClientID:    req.ClientID,
+		Capacity:    req.Capacity,
+		Rate:        req.Rate,
+		Description: req.Description,
+		UpdatedBy:   adminActor(r),
+		Version:     expectedVersion,
+	}
+	err = h.manager.SetLimit(limit)
+	if err != nil {
+		if errors.Is(err, rl.ErrVersionConflict) {
+			if !hasIfMatch {
+				httputil.RespondWithError(w, http.StatusPreconditionRequired, "Limit already exists for client "+req.ClientID+"; If-Match with its ETag is required to update it")
+				return
+			}
+			httputil.RespondWithError(w, http.StatusPreconditionFailed, "Limit was modified concurrently (ETag mismatch); re-read it and retry")
+			return
+		}
+		httputil.RespondWithError(w, http.StatusInternalServerError, "Failed to set limit: "+err.Error())
 		return
 	}
-	if req.Rate <= 0 {
-		httputil.RespondWithError(w, http.StatusBadRequest, "rate must be positive")
+
+	// Перечитываем запись, чтобы вернуть метаданные и версию, заполненные хранилищем.
+	if stored, found, err := h.manager.GetClientLimit(req.ClientID); err == nil && found {
+		limit = stored
+		w.Header().Set("ETag", limitETag(limit.Version))
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, newLimitResponse(limit))
+}
+
+// handleListLimits обрабатывает GET /admin/limits?min_rate=&max_rate=&min_capacity=&max_capacity=&updated_since=
+// updated_since принимает время в формате RFC 3339 или длительность относительно текущего момента (например, 720h).
+func (h *AdminHandler) handleListLimits(w http.ResponseWriter, r *http.Request) {
+	filter, errs := parseLimitFilter(r.URL.Query())
+	if len(errs) > 0 {
+		httputil.RespondWithValidationErrors(w, errs)
 		return
 	}
 
-	err := h.manager.SetLimit(req.ClientID, req.Capacity, req.Rate)
+	limits, err := h.manager.ListLimits(filter)
 	if err != nil {
-		httputil.RespondWithError(w, http.StatusInternalServerError, "Failed to set limit: "+err.Error())
+		httputil.RespondWithError(w, http.StatusInternalServerError, "Failed to list limits: "+err.Error())
 		return
 	}
 
-	resp := limitResponse{
-		ClientID: req.ClientID,
-		Capacity: req.Capacity,
-		Rate:     req.Rate,
+	resp := make([]limitResponse, 0, len(limits))
+	for _, limit := range limits {
+		resp = append(resp, newLimitResponse(limit))
 	}
 	httputil.RespondWithJSON(w, http.StatusOK, resp)
 }
 
+// parseLimitFilter разбирает параметры фильтра списка лимитов и возвращает ошибки
+// всех невалидных параметров.
+func parseLimitFilter(q url.Values) (rl.LimitFilter, httputil.ValidationErrors) {
+	var filter rl.LimitFilter
+	var errs httputil.ValidationErrors
+	var err error
+	for _, p := range []struct {
+		name string
+		dst  *float64
+	}{{"min_rate", &filter.MinRate}, {"max_rate", &filter.MaxRate}} {
+		if v := q.Get(p.name); v != "" {
+			if *p.dst, err = strconv.ParseFloat(v, 64); err != nil || *p.dst < 0 {
+				errs.Add(p.name, "must be a non-negative number", v)
+			}
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"min_capacity", &filter.MinCapacity}, {"max_capacity", &filter.MaxCapacity}} {
+		if v := q.Get(p.name); v != "" {
+			if *p.dst, err = strconv.ParseInt(v, 10, 64); err != nil || *p.dst < 0 {
+				errs.Add(p.name, "must be a non-negative integer", v)
+			}
+		}
+	}
+	if v := q.Get("updated_since"); v != "" {
+		if since, err := time.Parse(time.RFC3339, v); err == nil {
+			filter.UpdatedSince = since
+		} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			filter.UpdatedSince = time.Now().Add(-d)
+		} else {
+			errs.Add("updated_since", "must be an RFC 3339 time or a positive duration", v)
+		}
+	}
+	return filter, errs
+}
+
 // handleGetLimit обрабатывает GET /admin/limits/{client_id}
 func (h *AdminHandler) handleGetLimit(w http.ResponseWriter, r *http.Request, clientID string) {
 	if clientID == "" { // Дополнительная проверка
@@ -111,18 +265,18 @@ func (h *AdminHandler) handleGetLimit(w http.ResponseWriter, r *http.Request, cl
 		return
 	}
 
-	capacity, rate, found := h.manager.GetLimit(clientID)
+	limit, found, err := h.manager.GetClientLimit(clientID)
+	if err != nil {
+		httputil.RespondWithError(w, http.StatusInternalServerError, "Failed to get limit: "+err.Error())
+		return
+	}
 	if !found {
 		httputil.RespondWithError(w, http.StatusNotFound, "Limit not found for client "+clientID)
 		return
 	}
 
-	resp := limitResponse{
-		ClientID: clientID,
-		Capacity: capacity,
-		Rate:     rate,
-	}
-	httputil.RespondWithJSON(w, http.StatusOK, resp)
+	w.Header().Set("ETag", limitETag(limit.Version))
+	httputil.RespondWithJSON(w, http.StatusOK, newLimitResponse(limit))
 }
 
 // handleDeleteLimit обрабатывает DELETE /admin/limits/{client_id}
@@ -141,3 +295,24 @@ func (h *AdminHandler) handleDeleteLimit(w http.ResponseWriter, r *http.Request,
 	// Успешное удаление (или лимит не был найден)
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// handleRestoreLimit обрабатывает POST /admin/limits/{client_id}/restore
+func (h *AdminHandler) handleRestoreLimit(w http.ResponseWriter, r *http.Request, clientID string) {
+	found, err := h.manager.RestoreLimit(clientID)
+	if err != nil {
+		httputil.RespondWithError(w, http.StatusInternalServerError, "Failed to restore limit: "+err.Error())
+		return
+	}
+	if !found {
+		httputil.RespondWithError(w, http.StatusNotFound, "No deleted limit found for client "+clientID)
+		return
+	}
+
+	limit, found, err := h.manager.GetClientLimit(clientID)
+	if err != nil || !found {
+		httputil.RespondWithError(w, http.StatusInternalServerError, "Limit restored but could not be read back")
+		return
+	}
+	w.Header().Set("ETag", limitETag(limit.Version))
+	httputil.RespondWithJSON(w, http.StatusOK, newLimitResponse(limit))
+}
@@ -0,0 +1,91 @@
+package adminapi
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud/load_balancer/internal/httputil"
+	rl "cloud/load_balancer/internal/ratelimiter"
+)
+
+// RateLimiterStoreHandler обрабатывает запросы к /admin/ratelimiter/store: размер хранилища
+// бакетов, заполненность шардов, скорости создания и удаления бакетов и оценка памяти.
+type RateLimiterStoreHandler struct {
+	limiter *rl.Limiter
+}
+
+// NewRateLimiterStoreHandler создает новый обработчик состояния хранилища бакетов.
+func NewRateLimiterStoreHandler(limiter *rl.Limiter) *RateLimiterStoreHandler {
+	if limiter == nil {
+		panic("Limiter cannot be nil for RateLimiterStoreHandler")
+	}
+	return &RateLimiterStoreHandler{limiter: limiter}
+}
+
+// ServeHTTP обрабатывает GET /admin/ratelimiter/store.
+func (h *RateLimiterStoreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, h.limiter.StoreStats())
+}
+
+// Структура запроса на выдачу токена обхода rate limiting
+type issueBypassTokenRequest struct {
+	Subject string `json:"subject"`
+	TTL     string `json:"ttl"` // Срок действия в формате time.Duration ("" - максимальный).
+}
+
+// BypassTokensHandler обрабатывает запросы к /admin/ratelimiter/bypass-tokens:
+// выдача подписанных токенов обхода rate limiting для доверенных внутренних задач.
+type BypassTokensHandler struct {
+	limiter *rl.Limiter
+}
+
+// NewBypassTokensHandler создает новый обработчик выдачи токенов обхода.
+func NewBypassTokensHandler(limiter *rl.Limiter) *BypassTokensHandler {
+	if limiter == nil {
+		panic("Limiter cannot be nil for BypassTokensHandler")
+	}
+	return &BypassTokensHandler{limiter: limiter}
+}
+
+// ServeHTTP обрабатывает POST /admin/ratelimiter/bypass-tokens.
+func (h *BypassTokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var req issueBypassTokenRequest
+	if err := httputil.DecodeJSONBody(r, &req); err != nil {
+		httputil.RespondWithValidationError(w, err)
+		return
+	}
+
+	var errs httputil.ValidationErrors
+	if req.Subject == "" || strings.ContainsAny(req.Subject, "\r\n") {
+		errs.Add("subject", "must be a non-empty single line", req.Subject)
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		maxTTL := h.limiter.BypassMaxTTL()
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			errs.Add("ttl", "must be a duration (e.g. 30m)", req.TTL)
+		} else if ttl < 0 || ttl > maxTTL {
+			errs.Add("ttl", "must be between 0 and "+maxTTL.String(), req.TTL)
+		}
+	}
+	if len(errs) > 0 {
+		httputil.RespondWithValidationErrors(w, errs)
+		return
+	}
+	token, err := h.limiter.IssueBypassToken(req.Subject, ttl, adminActor(r))
+	if err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusCreated, token)
+}
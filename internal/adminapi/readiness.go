@@ -0,0 +1,40 @@
+package adminapi
+
+import (
+	"net/http"
+
+	"cloud/load_balancer/internal/balancer"
+	"cloud/load_balancer/internal/httputil"
+)
+
+// Структура для ответа /readyz
+type readinessResponse struct {
+	Status string `json:"status"` // ready | starting
+}
+
+// ReadinessHandler обрабатывает запросы к /readyz: готовность балансировщика принимать
+// трафик с учетом условия запуска пула (см. balancer.StartupGate).
+type ReadinessHandler struct {
+	pool *balancer.ServerPool
+}
+
+// NewReadinessHandler создает новый обработчик готовности.
+func NewReadinessHandler(pool *balancer.ServerPool) *ReadinessHandler {
+	if pool == nil {
+		panic("ServerPool cannot be nil for ReadinessHandler")
+	}
+	return &ReadinessHandler{pool: pool}
+}
+
+// ServeHTTP обрабатывает GET /readyz: 200, если пул готов, иначе 503.
+func (h *ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	if !h.pool.Ready() {
+		httputil.RespondWithJSON(w, http.StatusServiceUnavailable, readinessResponse{Status: "starting"})
+		return
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, readinessResponse{Status: "ready"})
+}
@@ -0,0 +1,68 @@
+package adminapi
+
+import (
+	"log"
+	"net/http"
+
+	"cloud/load_balancer/internal/balancer"
+	"cloud/load_balancer/internal/httputil"
+)
+
+// StaticResponseHandler обрабатывает запросы к /admin/static-response:
+// переключение маршрутов между проксированием и статическим ответом.
+type StaticResponseHandler struct {
+	pool *balancer.ServerPool
+}
+
+// NewStaticResponseHandler создает новый обработчик управления статическими ответами.
+func NewStaticResponseHandler(pool *balancer.ServerPool) *StaticResponseHandler {
+	if pool == nil {
+		panic("ServerPool cannot be nil for StaticResponseHandler")
+	}
+	return &StaticResponseHandler{pool: pool}
+}
+
+// ServeHTTP обрабатывает GET (статические ответы маршрутов), PUT (включить статический ответ
+// для маршрута) и DELETE (вернуть проксирование маршруту ?path_prefix=... или всем маршрутам).
+func (h *StaticResponseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		httputil.RespondWithJSON(w, http.StatusOK, h.pool.StaticResponses())
+	case http.MethodPut:
+		var req balancer.StaticResponse
+		if err := httputil.DecodeJSONBody(r, &req); err != nil {
+			httputil.RespondWithValidationError(w, err)
+			return
+		}
+		if req.PathPrefix == "" {
+			req.PathPrefix = "/"
+		}
+		if req.Status == 0 {
+			req.Status = http.StatusServiceUnavailable
+		}
+		if err := h.pool.SetStaticResponse(&req); err != nil {
+			httputil.RespondWithValidationError(w, err)
+			return
+		}
+		log.Printf("INFO: Static response enabled via Admin API for path prefix '%s' (status %d)", req.PathPrefix, req.Status)
+		httputil.RespondWithJSON(w, http.StatusOK, req)
+	case http.MethodDelete:
+		prefix := r.URL.Query().Get("path_prefix")
+		if prefix == "" {
+			for _, sr := range h.pool.StaticResponses() {
+				h.pool.RemoveStaticResponse(sr.PathPrefix)
+			}
+			log.Println("INFO: Static responses disabled via Admin API for all routes, proxying resumed")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !h.pool.RemoveStaticResponse(prefix) {
+			httputil.RespondWithError(w, http.StatusNotFound, "No static response for path prefix: "+prefix)
+			return
+		}
+		log.Printf("INFO: Static response disabled via Admin API for path prefix '%s', proxying resumed", prefix)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
@@ -0,0 +1,56 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud/load_balancer/internal/balancer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStaticResponseHandler проверяет включение и отключение статических ответов маршрутов.
+func TestStaticResponseHandler(t *testing.T) {
+	pool, err := balancer.NewServerPool([]string{"http://10.0.0.1:8080"}, time.Second, time.Second)
+	require.NoError(t, err)
+	handler := NewStaticResponseHandler(pool)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+	list := func() []balancer.StaticResponse {
+		rr := do(http.MethodGet, "/admin/static-response", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var responses []balancer.StaticResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &responses))
+		return responses
+	}
+
+	assert.Empty(t, list())
+
+	rr := do(http.MethodPut, "/admin/static-response", `{"path_prefix": "/v1/", "status": 410, "body": "Gone"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = do(http.MethodPut, "/admin/static-response", `{"body": "maintenance"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, []balancer.StaticResponse{
+		{PathPrefix: "/v1/", Status: http.StatusGone, Body: "Gone"},
+		{PathPrefix: "/", Status: http.StatusServiceUnavailable, Body: "maintenance"},
+	}, list(), "Prefix defaults to / and status to 503")
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/static-response", `{"path_prefix": "v2", "status": 410}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/static-response", `{"status": 700}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/static-response?path_prefix=/v1/", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/static-response?path_prefix=/v1/", "").Code)
+	assert.Len(t, list(), 1)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/static-response", "").Code)
+	assert.Empty(t, list(), "DELETE without path_prefix resumes proxying for all routes")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPost, "/admin/static-response", "").Code)
+}
@@ -0,0 +1,107 @@
+package adminapi
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"cloud/load_balancer/internal/balancer"
+	"cloud/load_balancer/internal/httputil"
+)
+
+// Структура для ответа со статистикой нагрузки бэкенда
+type backendStatsResponse struct {
+	Pool             string  `json:"pool,omitempty"` // Пусто - основной пул.
+	Name             string  `json:"name"`
+	Available        bool    `json:"available"`
+	ActiveRequests   int64   `json:"active_requests"`
+	OutstandingBytes int64   `json:"outstanding_bytes"`
+	LatencyEWMAMs    float64 `json:"latency_ewma_ms"`
+	SlowStartWeight  float64 `json:"slow_start_weight"` // Доля трафика в окне медленного старта (1 - полная).
+	// Процент времени за последний час и сутки, в течение которого бэкенд проходил проверки
+	// состояния (отсутствует, если бэкенд еще не проверялся).
+	Availability1hPercent  *float64 `json:"availability_1h_percent,omitempty"`
+	Availability24hPercent *float64 `json:"availability_24h_percent,omitempty"`
+	// Процент запросов по keep-alive соединениям и TLS-рукопожатий с возобновлением сессии
+	// с момента добавления бэкенда (отсутствует, пока соединений или рукопожатий не было).
+	KeepAliveReusePercent *float64 `json:"keepalive_reuse_percent,omitempty"`
+	TLSResumptionPercent  *float64 `json:"tls_resumption_percent,omitempty"`
+}
+
+// Структура для ответа /admin/stats
+type statsResponse struct {
+	Strategy string `json:"strategy"`
+	// Стратегии дополнительных пулов по имени (отсутствует, если пул один).
+	PoolStrategies map[string]string      `json:"pool_strategies,omitempty"`
+	Backends       []backendStatsResponse `json:"backends"`
+}
+
+// StatsHandler обрабатывает запросы к /admin/stats: текущая нагрузка и задержка бэкендов
+// всех пулов, используемые стратегиями балансировки.
+type StatsHandler struct {
+	pools map[string]*balancer.ServerPool // "" - основной пул.
+}
+
+// NewStatsHandler создает новый обработчик статистики бэкендов. pools - пулы по имени
+// (основной пул - под пустым именем).
+func NewStatsHandler(pools map[string]*balancer.ServerPool) *StatsHandler {
+	if pools[""] == nil {
+		panic("ServerPool cannot be nil for StatsHandler")
+	}
+	return &StatsHandler{pools: pools}
+}
+
+// ServeHTTP обрабатывает GET /admin/stats.
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	resp := statsResponse{
+		Strategy: h.pools[""].StrategyName(),
+		Backends: make([]backendStatsResponse, 0),
+	}
+	for _, name := range sortedPoolNames(h.pools) {
+		pool := h.pools[name]
+		if name != "" {
+			if resp.PoolStrategies == nil {
+				resp.PoolStrategies = make(map[string]string)
+			}
+			resp.PoolStrategies[name] = pool.StrategyName()
+		}
+		for _, b := range pool.GetBackends() {
+			reuse := b.ConnReuse()
+			resp.Backends = append(resp.Backends, backendStatsResponse{
+				Pool:             name,
+				Name:             b.Name(),
+				Available:        b.IsAvailable(),
+				ActiveRequests:   b.ActiveRequests(),
+				OutstandingBytes: b.OutstandingBytes(),
+				LatencyEWMAMs:    float64(b.LatencyEWMA().Microseconds()) / 1000,
+				SlowStartWeight:  pool.SlowStartWeight(b),
+
+				Availability1hPercent:  availabilityPercent(b, balancer.AvailabilityWindowHour),
+				Availability24hPercent: availabilityPercent(b, balancer.AvailabilityWindowDay),
+				KeepAliveReusePercent:  percent(reuse.KeepAliveReuseRatio()),
+				TLSResumptionPercent:   percent(reuse.TLSResumptionRatio()),
+			})
+		}
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// availabilityPercent возвращает доступность бэкенда b за окно window в процентах
+// (nil - бэкенд еще не проверялся).
+func availabilityPercent(b *balancer.Backend, window time.Duration) *float64 {
+	return percent(b.Availability(window))
+}
+
+// percent переводит долю в проценты с точностью до тысячных (nil, если ok ложно).
+func percent(ratio float64, ok bool) *float64 {
+	if !ok {
+		return nil
+	}
+	p := math.Round(ratio*100000) / 1000
+	return &p
+}
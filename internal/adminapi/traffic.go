@@ -0,0 +1,46 @@
+package adminapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/traffic"
+)
+
+// defaultTrafficTop - число клиентов и путей в сводке, если параметр top не задан.
+const defaultTrafficTop = 10
+
+// TrafficHandler обрабатывает запросы к /admin/traffic: сводка трафика за последнюю минуту.
+type TrafficHandler struct {
+	recorder *traffic.Recorder
+}
+
+// NewTrafficHandler создает новый обработчик сводки трафика.
+func NewTrafficHandler(recorder *traffic.Recorder) *TrafficHandler {
+	if recorder == nil {
+		panic("Recorder cannot be nil for TrafficHandler")
+	}
+	return &TrafficHandler{recorder: recorder}
+}
+
+// ServeHTTP обрабатывает GET /admin/traffic[?top=N].
+func (h *TrafficHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	top := defaultTrafficTop
+	if raw := r.URL.Query().Get("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			var errs httputil.ValidationErrors
+			errs.Add("top", "must be a non-negative integer", raw)
+			httputil.RespondWithValidationErrors(w, errs)
+			return
+		}
+		top = n
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, h.recorder.Snapshot(top))
+}
@@ -0,0 +1,88 @@
+package adminapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud/load_balancer/internal/httputil"
+	rl "cloud/load_balancer/internal/ratelimiter"
+)
+
+// Структуры для ответа об использовании лимитов клиентом
+type usageWindowResponse struct {
+	Window  string `json:"window"`
+	Allowed int64  `json:"allowed"`
+	Denied  int64  `json:"denied"`
+}
+
+type usageBucketResponse struct {
+	Capacity        int64   `json:"capacity"`
+	RefillRate      float64 `json:"refill_rate"`
+	TokensAvailable int64   `json:"tokens_available"`
+}
+
+type usageResponse struct {
+	ClientID string                `json:"client_id"`
+	LastSeen time.Time             `json:"last_seen"`
+	Windows  []usageWindowResponse `json:"windows"`
+	Bucket   *usageBucketResponse  `json:"bucket,omitempty"`
+}
+
+// UsageHandler обрабатывает запросы к /admin/usage/{client_id}: число разрешенных
+// и отклоненных запросов клиента за последние окна и текущее состояние его бакета.
+type UsageHandler struct {
+	limiter *rl.Limiter
+}
+
+// NewUsageHandler создает новый обработчик Admin API для использования лимитов.
+func NewUsageHandler(limiter *rl.Limiter) *UsageHandler {
+	if limiter == nil {
+		panic("Limiter cannot be nil for UsageHandler")
+	}
+	return &UsageHandler{limiter: limiter}
+}
+
+// ServeHTTP обрабатывает GET /admin/usage/{client_id}.
+func (h *UsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httputil.RespondWithError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	clientID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/usage"), "/")
+	if clientID == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "Client ID is required")
+		return
+	}
+
+	usage, found := h.limiter.Usage(clientID)
+	if !found {
+		httputil.RespondWithError(w, http.StatusNotFound, "No usage recorded for client: "+clientID)
+		return
+	}
+	resp := usageResponse{ClientID: usage.ClientID, LastSeen: usage.LastSeen}
+	for _, window := range usage.Windows {
+		resp.Windows = append(resp.Windows, usageWindowResponse{
+			Window:  formatWindow(window.Window),
+			Allowed: window.Allowed,
+			Denied:  window.Denied,
+		})
+	}
+	if usage.Bucket != nil {
+		resp.Bucket = &usageBucketResponse{
+			Capacity:        usage.Bucket.Capacity,
+			RefillRate:      usage.Bucket.RefillRate,
+			TokensAvailable: usage.Bucket.Tokens,
+		}
+	}
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// formatWindow форматирует окно в часах или минутах ("24h", "5m").
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,238 @@
+// Package autoscale реализует хук масштабирования пула бэкендов: при превышении порогов
+// загрузки здоровых бэкендов вызывается настроенный webhook и/или внешняя команда
+// (например, для увеличения Auto Scaling Group).
+package autoscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/balancer"
+	"cloud/load_balancer/internal/metrics"
+)
+
+// Направления масштабирования.
+const (
+	DirectionOut = "out"
+	DirectionIn  = "in"
+)
+
+// actionTimeout ограничивает время выполнения webhook или команды.
+const actionTimeout = 30 * time.Second
+
+var (
+	triggersTotal = metrics.NewCounterVec("lb_autoscale_triggers_total",
+		"Number of autoscaling hook invocations.", "direction", "result")
+	utilizationGauge = metrics.NewGaugeVec("lb_autoscale_utilization",
+		"Current utilization of healthy backend capacity (0..1, may exceed 1).")
+)
+
+// Config содержит параметры хука масштабирования.
+type Config struct {
+	TargetRequestsPerBackend int           // Допустимое число активных запросов на один здоровый бэкенд.
+	ScaleOutThreshold        float64       // Порог загрузки для увеличения пула.
+	ScaleInThreshold         float64       // Порог загрузки для уменьшения пула (0 - не использовать).
+	CheckInterval            time.Duration // Как часто оценивать загрузку.
+	Cooldown                 time.Duration // Минимальный интервал между срабатываниями.
+	WebhookURL               string        // URL, на который отправляется POST с событием.
+	Command                  string        // Команда, выполняемая через "sh -c".
+}
+
+// Event описывает срабатывание хука. Отправляется в теле webhook в формате JSON.
+type Event struct {
+	Direction       string    `json:"direction"`
+	Utilization     float64   `json:"utilization"`
+	HealthyBackends int       `json:"healthy_backends"`
+	ActiveRequests  int64     `json:"active_requests"`
+	Time            time.Time `json:"time"`
+}
+
+// Pool - источник информации о бэкендах пула.
+type Pool interface {
+	GetBackends() []*balancer.Backend
+}
+
+// Hook периодически оценивает загрузку пула и вызывает действия масштабирования.
+type Hook struct {
+	pool        Pool
+	cfg         Config
+	client      *http.Client
+	lastTrigger time.Time
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewHook создает хук масштабирования. Возвращает ошибку при невалидной конфигурации.
+// Для запуска фоновой проверки нужно вызвать Start.
+func NewHook(pool Pool, cfg Config) (*Hook, error) {
+	if pool == nil {
+		return nil, fmt.Errorf("autoscale: pool cannot be nil")
+	}
+	if cfg.TargetRequestsPerBackend <= 0 {
+		return nil, fmt.Errorf("autoscale: target_requests_per_backend must be positive")
+	}
+	if cfg.ScaleOutThreshold <= 0 {
+		return nil, fmt.Errorf("autoscale: scale_out_threshold must be positive")
+	}
+	if cfg.ScaleInThreshold < 0 || cfg.ScaleInThreshold >= cfg.ScaleOutThreshold {
+		return nil, fmt.Errorf("autoscale: scale_in_threshold must be in [0, scale_out_threshold)")
+	}
+	if cfg.WebhookURL == "" && cfg.Command == "" {
+		return nil, fmt.Errorf("autoscale: either webhook_url or command must be set")
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = 15 * time.Second
+	}
+	return &Hook{
+		pool:     pool,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: actionTimeout},
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+// Start запускает фоновую оценку загрузки.
+func (h *Hook) Start() {
+	h.wg.Add(1)
+	go h.run()
+}
+
+// Stop останавливает фоновую оценку и ожидает ее завершения.
+func (h *Hook) Stop() {
+	close(h.stopChan)
+	h.wg.Wait()
+}
+
+func (h *Hook) run() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(h.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	log.Printf("INFO: Autoscale hook started (interval: %v, scale-out at %.2f, scale-in at %.2f)",
+		h.cfg.CheckInterval, h.cfg.ScaleOutThreshold, h.cfg.ScaleInThreshold)
+	for {
+		select {
+		case <-ticker.C:
+			h.evaluate(time.Now())
+		case <-h.stopChan:
+			log.Println("INFO: Autoscale hook stopping.")
+			return
+		}
+	}
+}
+
+// evaluate вычисляет текущую загрузку и при необходимости вызывает действие масштабирования.
+func (h *Hook) evaluate(now time.Time) {
+	event := h.measure(now)
+	utilizationGauge.With().Set(event.Utilization)
+
+	switch {
+	case event.Utilization >= h.cfg.ScaleOutThreshold:
+		event.Direction = DirectionOut
+	case h.cfg.ScaleInThreshold > 0 && event.Utilization <= h.cfg.ScaleInThreshold:
+		event.Direction = DirectionIn
+	default:
+		return
+	}
+
+	if !h.lastTrigger.IsZero() && now.Sub(h.lastTrigger) < h.cfg.Cooldown {
+		triggersTotal.With(event.Direction, "cooldown").Inc()
+		return
+	}
+	h.lastTrigger = now
+
+	log.Printf("INFO: Autoscale: triggering scale-%s (utilization %.2f, healthy backends %d, active requests %d)",
+		event.Direction, event.Utilization, event.HealthyBackends, event.ActiveRequests)
+	if err := h.trigger(event); err != nil {
+		log.Printf("ERROR: Autoscale: scale-%s action failed: %v", event.Direction, err)
+		triggersTotal.With(event.Direction, "error").Inc()
+		return
+	}
+	triggersTotal.With(event.Direction, "success").Inc()
+}
+
+// measure собирает текущие показатели пула.
+func (h *Hook) measure(now time.Time) Event {
+	event := Event{Time: now}
+	for _, b := range h.pool.GetBackends() {
+		if !b.IsAvailable() {
+			continue
+		}
+		event.HealthyBackends++
+		event.ActiveRequests += b.ActiveRequests()
+	}
+	if event.HealthyBackends == 0 {
+		// Здоровой емкости нет совсем - это всегда перегрузка.
+		event.Utilization = math.Inf(1)
+		return event
+	}
+	event.Utilization = float64(event.ActiveRequests) / float64(event.HealthyBackends*h.cfg.TargetRequestsPerBackend)
+	return event
+}
+
+// trigger выполняет настроенные действия: отправку webhook и/или запуск команды.
+func (h *Hook) trigger(event Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	defer cancel()
+
+	if h.cfg.WebhookURL != "" {
+		if err := h.callWebhook(ctx, event); err != nil {
+			return err
+		}
+	}
+	if h.cfg.Command != "" {
+		cmd := exec.CommandContext(ctx, "sh", "-c", h.cfg.Command)
+		cmd.Env = append(os.Environ(),
+			"LB_SCALE_DIRECTION="+event.Direction,
+			fmt.Sprintf("LB_UTILIZATION=%.4f", event.Utilization),
+			fmt.Sprintf("LB_HEALTHY_BACKENDS=%d", event.HealthyBackends),
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("command failed: %w (output: %s)", err, bytes.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+func (h *Hook) callWebhook(ctx context.Context, event Event) error {
+	payload := event
+	if math.IsInf(payload.Utilization, 1) {
+		// JSON не поддерживает бесконечность.
+		payload.Utilization = math.MaxFloat64
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		// URL вебхука может содержать секрет, поэтому в ошибку не включается.
+		return errors.New("failed to create webhook request: invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// *url.Error содержит URL запроса.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package autoscale
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud/load_balancer/internal/balancer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticPool []*balancer.Backend
+
+func (p staticPool) GetBackends() []*balancer.Backend { return p }
+
+// TestHook_ScaleOutWithCooldown проверяет срабатывание scale-out при отсутствии
+// здоровых бэкендов и подавление повторного срабатывания во время cooldown.
+func TestHook_ScaleOutWithCooldown(t *testing.T) {
+	events := make(chan Event, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		events <- e
+	}))
+	defer server.Close()
+
+	hook, err := NewHook(staticPool{&balancer.Backend{}}, Config{
+		TargetRequestsPerBackend: 10,
+		ScaleOutThreshold:        0.8,
+		Cooldown:                 time.Minute,
+		WebhookURL:               server.URL,
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	hook.evaluate(now)
+	select {
+	case e := <-events:
+		assert.Equal(t, DirectionOut, e.Direction)
+		assert.Equal(t, 0, e.HealthyBackends)
+	default:
+		t.Fatal("Expected scale-out webhook call")
+	}
+
+	hook.evaluate(now.Add(30 * time.Second))
+	assert.Len(t, events, 0, "Hook must not fire during cooldown")
+}
+
+// TestNewHook_Validation проверяет валидацию конфигурации.
+func TestNewHook_Validation(t *testing.T) {
+	_, err := NewHook(staticPool{}, Config{TargetRequestsPerBackend: 10, ScaleOutThreshold: 0.8})
+	assert.Error(t, err, "Either webhook or command is required")
+
+	_, err = NewHook(staticPool{}, Config{TargetRequestsPerBackend: 10, ScaleOutThreshold: 0.5, ScaleInThreshold: 0.6, Command: "true"})
+	assert.Error(t, err, "scale_in_threshold must be below scale_out_threshold")
+}
@@ -0,0 +1,82 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// hashAffinity выбирает бэкенд по хешу атрибута запроса (rendezvous hashing): запросы
+// с одинаковым ключом попадают на один бэкенд, а при изменении состава пула перемещается
+// только доля ключей выбывшего или добавленного бэкенда. Запросы без ключа обрабатываются
+// стратегией fallback.
+type hashAffinity struct {
+	key      func(r *http.Request) string
+	fallback Strategy
+}
+
+func (h *hashAffinity) Next(backends []*Backend, r *http.Request) *Backend {
+	key := ""
+	if r != nil {
+		key = h.key(r)
+	}
+	if key == "" {
+		return h.fallback.Next(backends, r)
+	}
+	var best *Backend
+	var bestScore uint64
+	for _, b := range backends {
+		hash := fnv.New64a()
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(b.Name()))
+		if score := hash.Sum64(); best == nil || score > bestScore {
+			best, bestScore = b, score
+		}
+	}
+	return best
+}
+
+// parseHashOn разбирает атрибут запроса для хеширования: "header:<имя>" или "path".
+func parseHashOn(spec string) (func(r *http.Request) string, error) {
+	switch {
+	case spec == "path":
+		return func(r *http.Request) string { return r.URL.Path }, nil
+	case strings.HasPrefix(spec, "header:") && len(spec) > len("header:"):
+		name := http.CanonicalHeaderKey(strings.TrimPrefix(spec, "header:"))
+		return func(r *http.Request) string { return r.Header.Get(name) }, nil
+	default:
+		return nil, fmt.Errorf("invalid hash_on %q (expected \"header:<name>\" or \"path\")", spec)
+	}
+}
+
+// SetHashOn включает привязку запросов к бэкендам по атрибуту запроса: "header:<имя>"
+// (например, "header:X-Tenant-ID") или "path". Запросы с одинаковым значением атрибута
+// направляются на один бэкенд, пока он доступен, что позволяет использовать его прогретый
+// кеш. Запросы без атрибута распределяются текущей стратегией (см. SetStrategy), поэтому
+// SetHashOn вызывается после SetStrategy. Пустая строка отключает привязку.
+func (s *ServerPool) SetHashOn(spec string) error {
+	var key func(r *http.Request) string
+	if spec != "" {
+		var err error
+		if key, err = parseHashOn(spec); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if affinity, ok := s.strategy.(*hashAffinity); ok {
+		s.strategy = affinity.fallback
+	}
+	if key == nil {
+		return nil
+	}
+	fallback := s.strategy
+	if fallback == nil {
+		fallback = &s.defaultStrategy
+	}
+	s.strategy = &hashAffinity{key: key, fallback: fallback}
+	return nil
+}
@@ -0,0 +1,92 @@
+package balancer
+
+import "time"
+
+// Окна, за которые рассчитывается доступность бэкенда (см. Backend.Availability).
+const (
+	AvailabilityWindowHour = time.Hour
+	AvailabilityWindowDay  = 24 * time.Hour
+)
+
+// Доступность учитывается поминутно за последние сутки и текущую неполную минуту.
+const (
+	availabilityBucket  = time.Minute
+	availabilityBuckets = int(AvailabilityWindowDay/availabilityBucket) + 1
+)
+
+type availabilityBucketData struct {
+	minute   int64         // Номер минуты (Unix-время / 60), к которой относится ячейка.
+	up       time.Duration // Время в обслуживающем состоянии.
+	observed time.Duration // Учтенное время (с момента первой проверки).
+}
+
+// availabilityTracker учитывает время, проведенное бэкендом в обслуживающем состоянии по
+// результатам проверок. Не потокобезопасен, доступ защищается мьютексом Backend.
+type availabilityTracker struct {
+	buckets [availabilityBuckets]availabilityBucketData
+	started bool
+	serving bool
+	since   time.Time // Время, до которого учтено состояние.
+}
+
+// set учитывает время с последнего вызова в прежнем состоянии и запоминает новое.
+// Время до первого вызова не учитывается.
+func (a *availabilityTracker) set(serving bool, now time.Time) {
+	a.advance(now)
+	if !a.started {
+		a.started, a.since = true, now
+	}
+	a.serving = serving
+}
+
+// advance распределяет время от a.since до now по минутным ячейкам.
+func (a *availabilityTracker) advance(now time.Time) {
+	if !a.started {
+		return
+	}
+	for a.since.Before(now) {
+		end := a.since.Truncate(availabilityBucket).Add(availabilityBucket)
+		if end.After(now) {
+			end = now
+		}
+		minute := a.since.Unix() / int64(availabilityBucket/time.Second)
+		bucket := &a.buckets[minute%int64(availabilityBuckets)]
+		if bucket.minute != minute {
+			*bucket = availabilityBucketData{minute: minute}
+		}
+		d := end.Sub(a.since)
+		bucket.observed += d
+		if a.serving {
+			bucket.up += d
+		}
+		a.since = end
+	}
+}
+
+// ratio возвращает долю времени в обслуживающем состоянии за окно window до now (с точностью
+// до минуты) и false, если за окно нет учтенного времени.
+func (a *availabilityTracker) ratio(window time.Duration, now time.Time) (float64, bool) {
+	a.advance(now)
+	current := now.Unix() / int64(availabilityBucket/time.Second)
+	oldest := current - int64(window/availabilityBucket) // Текущая неполная минута и window до нее.
+	var up, observed time.Duration
+	for i := range a.buckets {
+		if b := &a.buckets[i]; b.minute >= oldest && b.minute <= current {
+			up += b.up
+			observed += b.observed
+		}
+	}
+	if observed <= 0 {
+		return 0, false
+	}
+	return float64(up) / float64(observed), true
+}
+
+// Availability возвращает долю времени за последнее окно window (не больше суток), в течение
+// которого бэкенд проходил проверки состояния (без учета drain и административного
+// отключения), и false, если бэкенд еще не проверялся. Время до первой проверки не учитывается.
+func (b *Backend) Availability(window time.Duration) (float64, bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.availability.ratio(min(window, AvailabilityWindowDay), time.Now())
+}
@@ -1,27 +1,258 @@
 package balancer
 
 import (
+	"crypto/tls"
+	"log"
+	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
 )
 
 type Backend struct {
-	URL          *url.URL
-	Alive        bool
-	mux          sync.RWMutex
+	URL *url.URL
+	mux sync.RWMutex
+	// Прокси запросов к бэкенду. Заменяется при смене протокола (под mux, см.
+	// updateBackendLocked), поэтому во время работы читается через proxyHandler.
 	ReverseProxy *httputil.ReverseProxy
+
+	// Состояние бэкенда (защищено mux): итоговое состояние, причина и время перехода,
+	// а также его составляющие - результат проверок и административные флаги.
+	state      HealthState
+	reason     string
+	stateSince time.Time
+	checkState HealthState
+	draining   bool // Бэкенд в режиме drain: новые запросы не направляются.
+	adminDown  bool // Бэкенд выключен администратором.
+	// Бэкенд удаляется из пула (drain перед удалением, см. RemoveBackend); иначе drain -
+	// режим обслуживания (см. DrainBackend).
+	removing bool
+	// Активные запросы завершились или истек таймаут drain, и номер текущего цикла drain.
+	drainComplete bool
+	drainGen      uint64
+
+	activeRequests atomic.Int64 // Количество запросов, обрабатываемых бэкендом в данный момент.
+	openConns      atomic.Int64 // Количество открытых соединений с бэкендом. См. OpenConnections.
+	// Объем данных, передаваемых через бэкенд в данный момент (для стратегии least_bytes).
+	outstandingBytes atomic.Int64
+	// Скользящее среднее времени обработки запроса в секундах (float64 в битах). См. LatencyEWMA.
+	latencyEWMA atomic.Uint64
+
+	// Счетчики подряд идущих успешных и неудачных активных проверок (защищено mux).
+	// См. HealthCheckPolicy.HealthyThreshold.
+	checkPasses   int
+	checkFailures int
+	checked       bool
+	// Время последней проверки и причина последней неудачной проверки (защищено mux).
+	lastCheck      time.Time
+	lastCheckError string
+	// Переопределение параметров проверки и время следующей проверки (используется только
+	// циклом проверок). См. HealthCheckOverride.
+	healthOverride HealthCheckOverride
+	nextCheck      time.Time
+	probing        atomic.Bool // Проверка бэкенда выполняется.
+
+	history       healthHistory
+	availability  availabilityTracker // Доступность за скользящие окна. См. Availability.
+	flapping      bool
+	holdDownUntil time.Time
+
+	// Медленный старт (защищено mux): момент перехода в обслуживающее состояние и признак
+	// возврата в ротацию после недоступности. См. ServerPool.SetSlowStart.
+	servingSince  time.Time
+	everServed    bool
+	returnedSince bool
+
+	// Значение заголовка Host для бэкенда ("" - передается Host клиента). См. SetHostPolicy.
+	upstreamHost string
+
+	id string // Имя бэкенда из конфигурации или канонический идентификатор URL (см. CanonicalID).
+
+	socketPath string // Путь к Unix-сокету для бэкендов со схемой unix ("" - TCP). См. SchemeUnix.
+	// Способ установки соединений (nil - прямое TCP-соединение) и TLS-настройки для https-бэкенда
+	// (nil - настройки по умолчанию). Задаются при создании пула.
+	dial      DialContextFunc
+	tlsConfig *tls.Config
+	// Таймаут установки соединения и TCP keep-alive из настроек пула. См. countConnections.
+	dialSettings TransportSettings
+	// Кеш TLS-сессий для возобновления при новых соединениях. См. applySessionCache.
+	tlsSessions tls.ClientSessionCache
+	reuse       connReuseCounters // Переиспользование соединений. См. ConnReuse.
+	// Выбор egress-прокси для соединений с бэкендом (nil - напрямую). См. SetEgressProxy.
+	proxy func(*http.Request) (*url.URL, error)
+
+	// Лимиты бэкенда и протокол изменяются на месте под s.mu пула и mux (см.
+	// updateBackendLocked): при выборе бэкенда они читаются под s.mu, в остальных случаях - под mux.
+	rateLimit *rl.Bucket // Лимит запросов в секунду к бэкенду (nil - без ограничения).
+	maxRPS    float64    // Значение лимита rateLimit (0 - без ограничения).
+	maxConns  int64      // Лимит одновременных запросов к бэкенду (0 - без ограничения).
+	// Протокол соединений из BackendSpec ("" - протокол пула) и используемый протокол.
+	// См. applyProtocol.
+	protocol         string
+	upstreamProtocol string
+
+	slowRequests  SlowRequestPolicy // Порог медленных запросов. См. SetSlowRequestPolicy.
+	upgradePolicy UpgradePolicy     // Ограничения WebSocket-соединений. См. SetUpgradePolicy.
+	pathRewrites  []PathRewrite     // Изменение пути запросов. См. SetPathRewrites.
+	expectLocal   bool              // 100 Continue отвечает балансировщик. См. SetProtocolPolicy.
+}
+
+// Name возвращает идентификатор бэкенда, используемый в Admin API, метриках и логах.
+func (b *Backend) Name() string {
+	if b.id == "" {
+		return b.URL.Host
+	}
+	return b.id
 }
 
-func (b *Backend) SetAlive(alive bool) {
+// SetAlive записывает результат проверки без подробностей: healthy или unhealthy
+// с указанной причиной.
+func (b *Backend) SetAlive(alive bool, reason string) {
 	b.mux.Lock()
 	defer b.mux.Unlock()
-	b.Alive = alive
+	state := StateUnhealthy
+	if alive {
+		state = StateHealthy
+	}
+	b.setCheckStateLocked(state, reason, time.Now())
+}
+
+// IsAlive сообщает, проходит ли бэкенд проверки состояния (healthy или degraded),
+// без учета drain и административного отключения.
+func (b *Backend) IsAlive() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.checkState.Serving()
+}
+
+// IsAvailable сообщает, может ли бэкенд принимать новые запросы:
+// итоговое состояние должно быть healthy или degraded.
+func (b *Backend) IsAvailable() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.state.Serving()
+}
+
+// IsDraining сообщает, находится ли бэкенд в режиме drain.
+func (b *Backend) IsDraining() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.draining
 }
 
-func (b *Backend) IsAlive() (alive bool) {
+// DrainStatus сообщает, находится ли бэкенд в режиме drain и завершен ли drain (активные
+// запросы завершились или истек таймаут).
+func (b *Backend) DrainStatus() (draining, complete bool) {
 	b.mux.RLock()
 	defer b.mux.RUnlock()
-	alive = b.Alive
-	return
+	return b.draining, b.drainComplete
+}
+
+// ActiveRequests возвращает количество запросов, обрабатываемых бэкендом в данный момент.
+func (b *Backend) ActiveRequests() int64 {
+	return b.activeRequests.Load()
+}
+
+// ServeHTTP проксирует запрос на бэкенд, учитывая его в счетчике активных запросов.
+// Соединение с переключением протокола (WebSocket) учитывается как активный запрос до его
+// закрытия.
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.activeRequests.Add(1)
+	defer b.activeRequests.Add(-1)
+	if r.ContentLength > 0 {
+		b.outstandingBytes.Add(r.ContentLength)
+		defer b.outstandingBytes.Add(-r.ContentLength)
+	}
+	var upgrade *upgradeWriter
+	if isUpgradeRequest(r) {
+		upgrade = &upgradeWriter{ResponseWriter: w, backend: b}
+		w = upgrade
+	}
+	r, timings := b.startTimings(r)
+	start := time.Now()
+	b.proxyHandler().ServeHTTP(w, b.withConnTrace(r, timings))
+	if upgrade != nil && upgrade.upgraded {
+		// Время жизни соединения не является временем обработки запроса.
+		return
+	}
+	b.observeLatency(time.Since(start))
+	b.logIfSlow(r, timings)
+}
+
+// proxyHandler возвращает текущий прокси запросов к бэкенду.
+func (b *Backend) proxyHandler() *httputil.ReverseProxy {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.ReverseProxy
+}
+
+// closeIdleConnections закрывает простаивающие keep-alive соединения к бэкенду.
+// trigger указывает причину закрытия для метрик (admin, drain).
+func (b *Backend) closeIdleConnections(trigger string) {
+	proxy := b.proxyHandler()
+	if proxy == nil {
+		return
+	}
+	if transport, ok := proxy.Transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+		backendIdleClosesTotal.With(b.Name(), trigger).Inc()
+	}
+}
+
+// HealthHistory возвращает последние переходы состояния бэкенда (от старых к новым).
+func (b *Backend) HealthHistory() []HealthTransition {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.history.snapshot()
+}
+
+// FlapStatus возвращает признак нестабильности бэкенда и время окончания hold-down
+// (нулевое время, если hold-down не активен).
+func (b *Backend) FlapStatus() (flapping bool, holdDownUntil time.Time) {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.flapping, b.holdDownUntil
+}
+
+// applyHealthCheckResult применяет результат проверки состояния с учетом обнаружения
+// нестабильности. Пока действует hold-down, бэкенд остается выведенным из ротации.
+// Возвращает итоговое состояние бэкенда.
+func (b *Backend) applyHealthCheckResult(state HealthState, reason string, fd FlapDetection, now time.Time) HealthState {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if now.Before(b.holdDownUntil) {
+		b.setCheckStateLocked(StateUnhealthy, "held down after flapping", now)
+		return b.state
+	}
+
+	changed := b.setCheckStateLocked(state, reason, now)
+	if !fd.Enabled {
+		return b.state
+	}
+
+	transitions := b.history.countSince(now.Add(-fd.Window))
+	flapping := transitions >= fd.Transitions
+	if flapping && changed && !b.flapping {
+		log.Printf("WARN: Backend %s is flapping (%d transitions in %v)", b.Name(), transitions, fd.Window)
+		backendFlapsTotal.With(b.Name()).Inc()
+		if fd.HoldDown > 0 {
+			b.holdDownUntil = now.Add(fd.HoldDown)
+			b.setCheckStateLocked(StateUnhealthy, "held down after flapping", now)
+			log.Printf("WARN: Backend %s is held down until %s", b.Name(), b.holdDownUntil.Format(time.RFC3339))
+		}
+	}
+	if flapping != b.flapping {
+		b.flapping = flapping
+		if flapping {
+			backendFlapping.With(b.Name()).Set(1)
+		} else {
+			backendFlapping.With(b.Name()).Set(0)
+		}
+	}
+	return b.state
 }
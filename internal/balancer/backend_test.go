@@ -0,0 +1,159 @@
+package balancer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBackend_FlapDetection_HoldDown проверяет, что частые переходы состояния
+// помечают бэкенд как нестабильный и выводят его из ротации на время hold-down.
+func TestBackend_FlapDetection_HoldDown(t *testing.T) {
+	b := newTestBackend("http://backend1:8081", false)
+	fd := FlapDetection{Enabled: true, Transitions: 3, Window: time.Minute, HoldDown: 30 * time.Second}
+	now := time.Now()
+
+	assert.True(t, b.applyHealthCheckResult(StateHealthy, "ok", fd, now).Serving())
+	assert.False(t, b.applyHealthCheckResult(StateUnhealthy, "down", fd, now.Add(time.Second)).Serving())
+	// Третий переход в окне - бэкенд признается нестабильным и удерживается выключенным.
+	assert.False(t, b.applyHealthCheckResult(StateHealthy, "ok", fd, now.Add(2*time.Second)).Serving())
+
+	flapping, holdDownUntil := b.FlapStatus()
+	assert.True(t, flapping)
+	assert.Equal(t, now.Add(32*time.Second), holdDownUntil)
+
+	// Во время hold-down успешные проверки не возвращают бэкенд в ротацию.
+	assert.False(t, b.applyHealthCheckResult(StateHealthy, "ok", fd, now.Add(10*time.Second)).Serving())
+	// После окончания hold-down бэкенд снова доступен.
+	assert.True(t, b.applyHealthCheckResult(StateHealthy, "ok", fd, now.Add(40*time.Second)).Serving())
+
+	history := b.HealthHistory()
+	require.Len(t, history, 5)
+	assert.True(t, history[0].Alive)
+	assert.Equal(t, StateUnhealthy, history[3].State)
+	assert.Equal(t, "held down after flapping", history[3].Reason)
+	assert.True(t, history[len(history)-1].Alive)
+}
+
+// TestHealthHistory_RingBuffer проверяет, что кольцевой буфер хранит только последние записи.
+func TestHealthHistory_RingBuffer(t *testing.T) {
+	var h healthHistory
+	start := time.Now()
+	for i := 0; i < healthHistorySize+5; i++ {
+		h.add(HealthTransition{Time: start.Add(time.Duration(i) * time.Second), Alive: i%2 == 0, aliveChanged: true})
+	}
+
+	snapshot := h.snapshot()
+	require.Len(t, snapshot, healthHistorySize)
+	assert.Equal(t, start.Add(5*time.Second), snapshot[0].Time)
+	assert.Equal(t, 3, h.countSince(start.Add(time.Duration(healthHistorySize+2)*time.Second)))
+}
+
+// TestAvailabilityTracker проверяет расчет доступности за скользящие окна: время до первой
+// проверки не учитывается, а старые интервалы выходят из окна.
+func TestAvailabilityTracker(t *testing.T) {
+	var a availabilityTracker
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, ok := a.ratio(AvailabilityWindowHour, start)
+	assert.False(t, ok, "No checks yet")
+
+	a.set(false, start)
+	a.set(true, start.Add(30*time.Minute))
+	ratio, ok := a.ratio(AvailabilityWindowHour, start.Add(2*time.Hour))
+	require.True(t, ok)
+	assert.InDelta(t, 1.0, ratio, 0.001, "Downtime is outside the last hour")
+	ratio, _ = a.ratio(AvailabilityWindowDay, start.Add(2*time.Hour))
+	assert.InDelta(t, 0.75, ratio, 0.001)
+
+	a.set(false, start.Add(2*time.Hour+45*time.Minute))
+	ratio, _ = a.ratio(AvailabilityWindowHour, start.Add(3*time.Hour))
+	assert.InDelta(t, 0.75, ratio, 0.001)
+	ratio, _ = a.ratio(AvailabilityWindowDay, start.Add(27*time.Hour))
+	assert.InDelta(t, 0.0, ratio, 0.001, "Only the last day is counted")
+}
+
+// TestBackend_StatePriority проверяет, что drain и административное отключение
+// имеют приоритет над результатами проверок и не сбрасываются ими.
+func TestBackend_StatePriority(t *testing.T) {
+	b := newTestBackend("http://backend1:8081", true)
+	assert.Equal(t, StateHealthy, b.State().State)
+
+	b.SetAdminDown(true, "maintenance")
+	b.applyHealthCheckResult(StateHealthy, "ok", FlapDetection{}, time.Now())
+	assert.Equal(t, StateAdminDown, b.State().State)
+	assert.Equal(t, "maintenance", b.State().Reason)
+	assert.False(t, b.IsAvailable())
+	assert.True(t, b.IsAlive(), "Health check result is still tracked")
+
+	b.SetAdminDown(false, "maintenance finished")
+	assert.Equal(t, StateHealthy, b.State().State)
+
+	b.applyHealthCheckResult(StateDegraded, "slow", FlapDetection{}, time.Now())
+	assert.True(t, b.IsAvailable(), "Degraded backend still receives traffic")
+
+	require.True(t, b.startDraining("removal"))
+	assert.Equal(t, StateDraining, b.State().State)
+	assert.False(t, b.IsAvailable())
+}
+
+// TestBackend_ConnTrace проверяет учет новых и переиспользованных соединений с бэкендом.
+func TestBackend_ConnTrace(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	b := newBackend(u)
+	defer b.closeIdleConnections("test")
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	var buf bytes.Buffer
+	metrics.Default.WriteText(&buf)
+	assert.Contains(t, buf.String(), fmt.Sprintf(`lb_backend_connections_total{backend="%s",type="new"} 1`, b.Name()))
+	assert.Contains(t, buf.String(), fmt.Sprintf(`lb_backend_connections_total{backend="%s",type="reused"} 2`, b.Name()))
+	assert.Contains(t, buf.String(), fmt.Sprintf(`lb_backend_phase_duration_seconds_count{backend="%s",phase="connect"} 1`, b.Name()))
+	assert.Contains(t, buf.String(), fmt.Sprintf(`lb_backend_phase_duration_seconds_count{backend="%s",phase="ttfb"} 3`, b.Name()))
+}
+
+// TestBackend_SlowRequestPolicy проверяет учет медленного запроса и принудительную
+// отметку трассировки как сохраняемой.
+func TestBackend_SlowRequestPolicy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	pool, err := NewServerPool([]string{upstream.URL}, time.Second, time.Second)
+	require.NoError(t, err)
+	pool.SetSlowRequestPolicy(SlowRequestPolicy{Threshold: 10 * time.Millisecond, SampledTraceResponse: true})
+	backend := pool.GetBackends()[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	rr := httptest.NewRecorder()
+	backend.ServeHTTP(rr, req)
+
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", rr.Header().Get("traceresponse"))
+	var buf bytes.Buffer
+	metrics.Default.WriteText(&buf)
+	assert.Contains(t, buf.String(), fmt.Sprintf(`lb_slow_requests_total{backend="%s"} 1`, backend.Name()))
+
+	_, ok := sampledTraceparent("invalid")
+	assert.False(t, ok)
+}
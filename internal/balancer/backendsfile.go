@@ -0,0 +1,240 @@
+package balancer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultBackendsFilePollInterval - интервал проверки файла со списком бэкендов по умолчанию.
+	defaultBackendsFilePollInterval = 2 * time.Second
+	// backendsFileDebounce - задержка применения файла после события файловой системы:
+	// запись файла порождает несколько событий подряд.
+	backendsFileDebounce = 100 * time.Millisecond
+)
+
+// BackendsFilePolicy задает файл со списком бэкендов, изменения которого применяются к пулу
+// без перезапуска: новые бэкенды добавляются, исчезнувшие удаляются с drain.
+type BackendsFilePolicy struct {
+	Path string
+	// Интервал проверки изменения файла (0 - 2s). Изменения применяются по событиям файловой
+	// системы, а проверка по интервалу нужна там, где события не доставляются.
+	PollInterval time.Duration
+	// Время на завершение запросов к удаленному из файла бэкенду (см. RemoveBackend).
+	DrainTimeout time.Duration
+}
+
+// backendsFile - состояние файла со списком бэкендов.
+type backendsFile struct {
+	policy  BackendsFilePolicy
+	members *dynamicMembers // Имя (или URL) -> бэкенд.
+	modTime time.Time
+	size    int64
+	content []byte // Последнее примененное содержимое.
+}
+
+// backendsFileEntry - бэкенд в YAML-файле: строка с URL или объект.
+type backendsFileEntry struct {
+	Name     string  `yaml:"name"`
+	URL      string  `yaml:"url"`
+	MaxRPS   float64 `yaml:"max_rps"`
+	MaxConns int     `yaml:"max_conns"`
+}
+
+func (e *backendsFileEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.URL = node.Value
+		return nil
+	}
+	type plain backendsFileEntry
+	return node.Decode((*plain)(e))
+}
+
+// ParseBackendsFile разбирает список бэкендов. Файл с расширением .yaml или .yml - YAML-список
+// URL или объектов {name, url, max_rps, max_conns} (список может быть и под ключом backends); иначе -
+// один URL на строку, пустые строки и строки с # пропускаются.
+func ParseBackendsFile(path string, data []byte) ([]BackendSpec, error) {
+	var specs []BackendSpec
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var entries []backendsFileEntry
+		if err := yaml.Unmarshal(data, &entries); err != nil {
+			var wrapped struct {
+				Backends []backendsFileEntry `yaml:"backends"`
+			}
+			if err2 := yaml.Unmarshal(data, &wrapped); err2 != nil {
+				return nil, err
+			}
+			entries = wrapped.Backends
+		}
+		for i, e := range entries {
+			if e.URL == "" {
+				return nil, fmt.Errorf("entry %d: url must be specified", i)
+			}
+			specs = append(specs, BackendSpec{Name: e.Name, URL: e.URL, MaxRPS: e.MaxRPS, MaxConns: e.MaxConns})
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			specs = append(specs, BackendSpec{URL: line})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		key := backendsFileKey(spec)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate backend %s", key)
+		}
+		seen[key] = true
+	}
+	return specs, nil
+}
+
+// backendsFileKey возвращает ключ бэкенда файла: имя или URL.
+func backendsFileKey(spec BackendSpec) string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	return spec.URL
+}
+
+// SetBackendsFile задает файл со списком бэкендов и сразу добавляет перечисленные в нем
+// бэкенды. Возвращает ошибку, если файл не читается или некорректен. Должен вызываться до
+// RunBackendsFile.
+func (s *ServerPool) SetBackendsFile(policy BackendsFilePolicy) error {
+	if policy.Path == "" {
+		return errors.New("backends file path is required")
+	}
+	if policy.PollInterval <= 0 {
+		policy.PollInterval = defaultBackendsFilePollInterval
+	}
+	s.backendsFile = &backendsFile{policy: policy, members: newDynamicMembers(s, "backends file", policy.DrainTimeout)}
+	_, err := s.reloadBackendsFile()
+	return err
+}
+
+// RunBackendsFile отслеживает файл со списком бэкендов (см. SetBackendsFile) через fsnotify
+// и применяет изменения. Отслеживается каталог файла, поэтому замена файла через rename или
+// символическую ссылку (ConfigMap в Kubernetes) тоже обнаруживается. Кроме того, файл
+// проверяется каждые PollInterval: на сетевых файловых системах события не доставляются,
+// а если отслеживание недоступно (например, исчерпан лимит inotify), остается только проверка
+// по интервалу. Некорректный файл не изменяет пул. Блокируется до отмены ctx.
+func (s *ServerPool) RunBackendsFile(ctx context.Context) {
+	f := s.backendsFile
+	if f == nil {
+		return
+	}
+	reload := func() {
+		if _, err := s.reloadBackendsFile(); err != nil {
+			log.Printf("WARN: Backends file %s: %v. Keeping current backends.", f.policy.Path, err)
+		}
+	}
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := watchBackendsFile(f.policy.Path)
+	if err != nil {
+		log.Printf("WARN: Backends file %s: cannot watch for changes: %v. Checking every %v.", f.policy.Path, err, f.policy.PollInterval)
+	} else {
+		defer watcher.Close()
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	ticker := time.NewTicker(f.policy.PollInterval)
+	defer ticker.Stop()
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reload()
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if debounce == nil {
+				debounce = time.After(backendsFileDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			reload()
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			log.Printf("WARN: Backends file %s: watch error: %v", f.policy.Path, err)
+		}
+	}
+}
+
+// watchBackendsFile создает отслеживание каталога файла path. Событие по любому файлу
+// каталога приводит лишь к проверке времени изменения и размера файла (см. reloadBackendsFile).
+func watchBackendsFile(path string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// reloadBackendsFile применяет содержимое файла, если оно изменилось с последней проверки.
+// Возвращает, были ли применены изменения.
+func (s *ServerPool) reloadBackendsFile() (bool, error) {
+	f := s.backendsFile
+	info, err := os.Stat(f.policy.Path)
+	if err != nil {
+		return false, err
+	}
+	if f.content != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(f.policy.Path)
+	if err != nil {
+		return false, err
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	if f.content != nil && bytes.Equal(data, f.content) {
+		return false, nil
+	}
+	specs, err := ParseBackendsFile(f.policy.Path, data)
+	if err != nil {
+		// Файл запоминается, чтобы ошибка не повторялась в логе до следующего изменения.
+		f.content = data
+		return false, fmt.Errorf("invalid backends file: %w", err)
+	}
+	f.content = data
+
+	keyed := make(map[string]BackendSpec, len(specs))
+	for _, spec := range specs {
+		keyed[backendsFileKey(spec)] = spec
+	}
+	f.members.sync(keyed)
+	log.Printf("INFO: Backends file %s applied: %d backends.", f.policy.Path, len(specs))
+	return true, nil
+}
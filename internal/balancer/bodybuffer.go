@@ -0,0 +1,186 @@
+package balancer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+// Буфер тела запроса для его повторной отправки: тело, превышающее лимит памяти,
+// сохраняется во временный файл, который удаляется при освобождении буфера.
+
+var (
+	retryBodySpillsTotal = metrics.NewCounterVec("lb_retry_body_spills_total",
+		"Request bodies buffered for retries that exceeded the in-memory buffer and were spilled to a temporary file.")
+	retryBodyOverflowsTotal = metrics.NewCounterVec("lb_retry_body_overflows_total",
+		"Request bodies that exceeded max_body_bytes, so the request could not be retried.")
+)
+
+// errStaleAttempt возвращается при чтении тела запроса предыдущей попыткой после rewind.
+var errStaleAttempt = errors.New("request body was rewound for a retry")
+
+// spillBuffer хранит первые memLimit байт в памяти, остальные - во временном файле в dir.
+type spillBuffer struct {
+	memLimit int64
+	dir      string
+	mem      bytes.Buffer
+	file     *os.File
+	size     int64
+}
+
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	n := 0
+	if room := b.memLimit - int64(b.mem.Len()); room > 0 && b.file == nil {
+		k := int(min(int64(len(p)), room))
+		b.mem.Write(p[:k])
+		n, p = k, p[k:]
+	}
+	if len(p) > 0 {
+		if b.file == nil {
+			f, err := os.CreateTemp(b.dir, "lb-body-*")
+			if err != nil {
+				b.size += int64(n)
+				return n, err
+			}
+			b.file = f
+			retryBodySpillsTotal.With().Inc()
+		}
+		m, err := b.file.Write(p)
+		n += m
+		if err != nil {
+			b.size += int64(n)
+			return n, err
+		}
+	}
+	b.size += int64(n)
+	return n, nil
+}
+
+// reader возвращает чтение содержимого буфера с начала.
+func (b *spillBuffer) reader() io.Reader {
+	r := io.Reader(bytes.NewReader(b.mem.Bytes()))
+	if b.file != nil {
+		r = io.MultiReader(r, io.NewSectionReader(b.file, 0, b.size-int64(b.mem.Len())))
+	}
+	return r
+}
+
+// release освобождает память и удаляет временный файл.
+func (b *spillBuffer) release() {
+	b.mem = bytes.Buffer{}
+	if b.file != nil {
+		name := b.file.Name()
+		_ = b.file.Close()
+		if err := os.Remove(name); err != nil {
+			log.Printf("WARN: Failed to remove request body buffer %s: %v", name, err)
+		}
+		b.file = nil
+	}
+}
+
+// replayableBody запоминает прочитанную часть тела запроса, чтобы отправить его повторно
+// (например, на другой бэкенд). Тело читается из источника по мере отправки, поэтому запрос не задерживается до
+// получения всего тела. Если тело больше maxBytes, буфер освобождается и повтор невозможен.
+type replayableBody struct {
+	mu       sync.Mutex
+	src      io.Reader
+	buf      spillBuffer
+	maxBytes int64
+	overflow bool      // Тело не помещается в буфер (или ошибка записи в буфер).
+	replay   io.Reader // Непрочитанная при повторе часть буфера (nil - чтение из src).
+	gen      int       // Номер текущей попытки; чтение прежними попытками запрещено.
+}
+
+// newReplayableBody возвращает буфер тела src: первые memLimit байт хранятся в памяти,
+// остальные - во временном файле в dir ("" - системный каталог), тело больше maxBytes
+// не запоминается.
+func newReplayableBody(src io.Reader, memLimit, maxBytes int64, dir string) *replayableBody {
+	return &replayableBody{
+		src:      src,
+		buf:      spillBuffer{memLimit: memLimit, dir: dir},
+		maxBytes: maxBytes,
+	}
+}
+
+// attempt возвращает тело запроса для очередной попытки.
+func (b *replayableBody) attempt() io.ReadCloser {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &attemptBody{body: b, gen: b.gen}
+}
+
+// replayable сообщает, может ли тело быть отправлено повторно.
+func (b *replayableBody) replayable() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.overflow
+}
+
+// rewind начинает новую попытку: тело снова читается с начала. Транспорт может дочитывать
+// тело прежней попытки в своей горутине, поэтому ее чтение после rewind завершается ошибкой.
+func (b *replayableBody) rewind() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.overflow {
+		return false
+	}
+	b.gen++
+	b.replay = b.buf.reader()
+	return true
+}
+
+// release освобождает буфер.
+func (b *replayableBody) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.gen++
+	b.replay = nil
+	b.buf.release()
+}
+
+func (b *replayableBody) read(gen int, p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.gen {
+		return 0, errStaleAttempt
+	}
+	if b.replay != nil {
+		n, err := b.replay.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		b.replay = nil
+		if n > 0 {
+			return n, nil
+		}
+	}
+	n, err := b.src.Read(p)
+	if n > 0 && !b.overflow {
+		if b.buf.size+int64(n) > b.maxBytes {
+			b.overflow = true
+			retryBodyOverflowsTotal.With().Inc()
+			b.buf.release()
+		} else if _, werr := b.buf.Write(p[:n]); werr != nil {
+			log.Printf("WARN: Failed to buffer request body for retries: %v", werr)
+			b.overflow = true
+			b.buf.release()
+		}
+	}
+	return n, err
+}
+
+// attemptBody - тело запроса одной попытки. Закрытие транспортом не закрывает источник:
+// тело запроса клиента закрывает HTTP-сервер.
+type attemptBody struct {
+	body *replayableBody
+	gen  int
+}
+
+func (a *attemptBody) Read(p []byte) (int, error) { return a.body.read(a.gen, p) }
+
+func (a *attemptBody) Close() error { return nil }
@@ -0,0 +1,67 @@
+package balancer
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// unknownLengthWeight - условный объем данных, которым учитывается ответ без Content-Length
+// (chunked-стриминг) на все время его передачи.
+const unknownLengthWeight = 1 << 20
+
+// OutstandingBytes возвращает объем данных (в байтах), передаваемых через бэкенд в данный момент:
+// непрочитанный остаток тел ответов и тела активных запросов.
+func (b *Backend) OutstandingBytes() int64 {
+	return b.outstandingBytes.Load()
+}
+
+// trackResponseBytes оборачивает тело ответа, чтобы учитывать еще не переданные байты.
+// Используется как ReverseProxy.ModifyResponse.
+func (b *Backend) trackResponseBytes(resp *http.Response) error {
+	weight := int64(unknownLengthWeight)
+	known := resp.ContentLength >= 0
+	if known {
+		weight = resp.ContentLength
+	}
+	b.outstandingBytes.Add(weight)
+	resp.Body = &countingBody{ReadCloser: resp.Body, backend: b, remaining: weight, known: known}
+	return nil
+}
+
+// countingBody уменьшает счетчик передаваемых байт бэкенда по мере чтения тела ответа
+// и списывает остаток при закрытии.
+type countingBody struct {
+	io.ReadCloser
+	backend   *Backend
+	mu        sync.Mutex
+	remaining int64
+	known     bool
+	closed    bool
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 && c.known {
+		c.mu.Lock()
+		consumed := int64(n)
+		if consumed > c.remaining {
+			consumed = c.remaining
+		}
+		c.remaining -= consumed
+		c.mu.Unlock()
+		c.backend.outstandingBytes.Add(-consumed)
+	}
+	return n, err
+}
+
+func (c *countingBody) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		c.backend.outstandingBytes.Add(-c.remaining)
+		c.remaining = 0
+	}
+	c.mu.Unlock()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,49 @@
+package balancer
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// OpenConnections возвращает количество открытых соединений балансировщика с бэкендом
+// (активных и простаивающих keep-alive; соединения проверок состояния не учитываются).
+func (b *Backend) OpenConnections() int64 {
+	return b.openConns.Load()
+}
+
+// countConnections оборачивает dial (nil - прямое соединение, см. TransportSettings.dialer)
+// так, чтобы установленные соединения учитывались в OpenConnections до их закрытия.
+// Установка соединения ограничивается TransportSettings.DialTimeout пула и для dial,
+// заданного для бэкенда (Unix-сокет, dial_via).
+func (b *Backend) countConnections(dial DialContextFunc) DialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		settings := b.dialSettings
+		connect := dial
+		if connect == nil {
+			connect = settings.dialer().DialContext
+		} else if settings.DialTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, settings.DialTimeout)
+			defer cancel()
+		}
+		conn, err := connect(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		b.openConns.Add(1)
+		return &countedConn{Conn: conn, backend: b}, nil
+	}
+}
+
+// countedConn уменьшает счетчик открытых соединений бэкенда при первом закрытии.
+type countedConn struct {
+	net.Conn
+	backend *Backend
+	once    sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.backend.openConns.Add(-1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,132 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SchemeUnix - схема URL бэкенда, доступного через Unix domain socket: unix:///run/app.sock.
+// Запросы к такому бэкенду передаются по HTTP через сокет.
+const SchemeUnix = "unix"
+
+// DialContextFunc устанавливает соединение с бэкендом (сигнатура http.Transport.DialContext).
+// Позволяет подключаться к бэкендам, доступным только через промежуточный узел
+// (например, SOCKS- или HTTP CONNECT-прокси на бастионе, см. NewProxyDialer).
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// validateScheme проверяет, что схема URL бэкенда поддерживается.
+func validateScheme(u *url.URL) error {
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("missing host")
+		}
+		return nil
+	case SchemeUnix:
+		if unixSocketPath(u) == "" {
+			return fmt.Errorf("missing socket path (expected unix:///path/to.sock)")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported scheme %q (expected http, https or unix)", u.Scheme)
+	}
+}
+
+// unixSocketPath возвращает путь к сокету для URL со схемой unix ("" для остальных схем).
+func unixSocketPath(u *url.URL) string {
+	if !strings.EqualFold(u.Scheme, SchemeUnix) {
+		return ""
+	}
+	if u.Path != "" {
+		return u.Path
+	}
+	return u.Opaque
+}
+
+// unixDialer возвращает DialContextFunc, соединяющийся с Unix-сокетом path независимо
+// от адреса, запрошенного Transport.
+func unixDialer(path string) DialContextFunc {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+}
+
+// proxyTarget возвращает URL, по которому выполняются HTTP-запросы к бэкенду: URL бэкенда
+// или, для Unix-сокета, http://localhost (соединение устанавливается с сокетом).
+func (b *Backend) proxyTarget() *url.URL {
+	if b.socketPath == "" {
+		return b.URL
+	}
+	return &url.URL{Scheme: "http", Host: "localhost"}
+}
+
+// dialAddress возвращает сеть и адрес для установки соединения с бэкендом.
+func (b *Backend) dialAddress() (network, address string) {
+	if b.socketPath != "" {
+		return "unix", b.socketPath
+	}
+	return "tcp", b.URL.Host
+}
+
+// applyDialer переносит способ установки соединений, egress-прокси и TLS-настройки бэкенда
+// в Transport.
+func (b *Backend) applyDialer(t *http.Transport) {
+	t.Proxy = b.proxy
+	if b.dial != nil {
+		t.DialContext = b.dial
+	}
+	if b.tlsConfig != nil {
+		t.TLSClientConfig = b.tlsConfig.Clone()
+	}
+}
+
+// applyProxyTransport настраивает Transport, через который проксируются запросы к бэкенду:
+// помимо applyDialer учитывает открытые соединения (см. OpenConnections) и возобновляет
+// TLS-сессии. Может вызываться повторно при изменении настроек бэкенда.
+func (b *Backend) applyProxyTransport(t *http.Transport) {
+	b.applyDialer(t)
+	b.applySessionCache(t)
+	t.DialContext = b.countConnections(b.dial)
+}
+
+// dialTimeout устанавливает соединение с бэкендом способом, заданным для него (см. DialContextFunc).
+func (b *Backend) dialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	if b.dial == nil {
+		return net.DialTimeout(network, address, timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return b.dial(ctx, network, address)
+}
+
+// setConnectivity задает TLS-настройки и способ установки соединений бэкенда и применяет
+// их к его Transport. TLS-настройки допустимы только для https-бэкендов, а dial - только
+// для бэкендов, доступных по TCP.
+func (b *Backend) setConnectivity(tlsSettings BackendTLS, dial DialContextFunc) error {
+	if !tlsSettings.isZero() {
+		if !strings.EqualFold(b.URL.Scheme, "https") {
+			return fmt.Errorf("tls settings require an https backend URL")
+		}
+		cfg, err := tlsSettings.config()
+		if err != nil {
+			return err
+		}
+		b.tlsConfig = cfg
+	}
+	if dial != nil {
+		if b.socketPath != "" {
+			return fmt.Errorf("custom dialer is not supported for unix socket backends")
+		}
+		b.dial = dial
+	}
+	if transport, ok := b.ReverseProxy.Transport.(*http.Transport); ok {
+		b.applyProxyTransport(transport)
+	}
+	return nil
+}
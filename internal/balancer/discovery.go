@@ -0,0 +1,221 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DNSDiscoveryPrefix - префикс схемы URL бэкенда, заданного DNS-именем: каждая запись A/AAAA
+// имени становится отдельным бэкендом (например, dns+http://app.internal:8080).
+const DNSDiscoveryPrefix = "dns+"
+
+// dnsLookupTimeout ограничивает время одного разрешения имени.
+const dnsLookupTimeout = 5 * time.Second
+
+// lookupIPAddr разрешает имя в адреса (подменяется в тестах).
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// DNSDiscoveryPolicy задает периодическое разрешение бэкендов, заданных DNS-именем.
+type DNSDiscoveryPolicy struct {
+	// Интервал повторного разрешения имен (0 - имена разрешаются только при запуске).
+	RefreshInterval time.Duration
+	// Время на завершение запросов к бэкенду, адрес которого исчез из ответа DNS (см. RemoveBackend).
+	DrainTimeout time.Duration
+}
+
+// dnsSource - бэкенд, заданный DNS-именем, и бэкенды, созданные по его адресам.
+// Состояние изменяется только конструктором пула и затем горутиной RunDNSDiscovery.
+type dnsSource struct {
+	spec    BackendSpec // Описание бэкенда; URL - без префикса dns+.
+	url     *url.URL
+	members map[string]string // Адрес -> имя бэкенда в пуле ("" - бэкенд не добавлен).
+}
+
+// IsDNSDiscoveryURL сообщает, задан ли бэкенд DNS-именем (см. DNSDiscoveryPrefix).
+func IsDNSDiscoveryURL(rawURL string) bool {
+	return len(rawURL) > len(DNSDiscoveryPrefix) && strings.EqualFold(rawURL[:len(DNSDiscoveryPrefix)], DNSDiscoveryPrefix)
+}
+
+// newDNSSource проверяет описание бэкенда с URL вида dns+http://name:port.
+func newDNSSource(spec BackendSpec) (*dnsSource, error) {
+	u, err := url.Parse(spec.URL[len(DNSDiscoveryPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("invalid URL: unsupported scheme %q for DNS discovery (expected dns+http or dns+https)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid URL: missing host")
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		return nil, fmt.Errorf("invalid URL: DNS discovery requires a host name, not an IP address")
+	}
+	spec.URL = u.String()
+	return &dnsSource{spec: spec, url: u, members: make(map[string]string)}, nil
+}
+
+// resolve возвращает отсортированные адреса имени источника.
+func (src *dnsSource) resolve(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	addrs, err := lookupIPAddr(ctx, src.url.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP.String())
+	}
+	slices.Sort(ips)
+	return slices.Compact(ips), nil
+}
+
+// memberSpec возвращает описание бэкенда для адреса ip. Имя бэкенда - имя источника (или
+// DNS-имя) и адрес; для https сертификат проверяется по DNS-имени, если не задан ServerName.
+func (src *dnsSource) memberSpec(ip string) BackendSpec {
+	u := *src.url
+	u.Host = ip
+	if port := src.url.Port(); port != "" {
+		u.Host = net.JoinHostPort(ip, port)
+	} else if strings.Contains(ip, ":") {
+		u.Host = "[" + ip + "]"
+	}
+	spec := src.spec
+	spec.URL = u.String()
+	base := src.spec.Name
+	if base == "" {
+		base = src.url.Hostname()
+	}
+	spec.Name = base + "-" + ip
+	if strings.EqualFold(u.Scheme, "https") && spec.TLS.ServerName == "" {
+		spec.TLS.ServerName = src.url.Hostname()
+	}
+	return spec
+}
+
+// SetDNSDiscovery задает параметры повторного разрешения бэкендов, заданных DNS-именем.
+// Должен вызываться до RunDNSDiscovery.
+func (s *ServerPool) SetDNSDiscovery(policy DNSDiscoveryPolicy) {
+	s.dnsDiscovery = policy
+}
+
+// HasDNSDiscovery сообщает, есть ли в пуле бэкенды, заданные DNS-именем.
+func (s *ServerPool) HasDNSDiscovery() bool {
+	return len(s.dnsSources) > 0
+}
+
+// RunDNSDiscovery периодически (см. SetDNSDiscovery) разрешает имена бэкендов, заданных
+// DNS-именем: для новых адресов добавляет бэкенды (см. AddBackend), бэкенды исчезнувших
+// адресов удаляет с drain (см. RemoveBackend). Если имя не разрешилось или ответ пуст,
+// текущие бэкенды сохраняются. Блокируется до отмены ctx.
+func (s *ServerPool) RunDNSDiscovery(ctx context.Context) {
+	if len(s.dnsSources) == 0 || s.dnsDiscovery.RefreshInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.dnsDiscovery.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, src := range s.dnsSources {
+				s.refreshDNSSource(ctx, src)
+			}
+		}
+	}
+}
+
+// refreshDNSSource приводит бэкенды источника в соответствие с текущим ответом DNS.
+func (s *ServerPool) refreshDNSSource(ctx context.Context, src *dnsSource) {
+	ips, err := src.resolve(ctx)
+	if err != nil || len(ips) == 0 {
+		if ctx.Err() == nil {
+			log.Printf("WARN: DNS discovery for %s failed: %v. Keeping %d current backends.", src.url.Host, err, len(src.members))
+		}
+		return
+	}
+
+	for _, ip := range ips {
+		if _, ok := src.members[ip]; ok {
+			continue
+		}
+		backend, err := s.AddBackend(src.memberSpec(ip))
+		if errors.Is(err, ErrDuplicateBackend) {
+			// Например, бэкенд этого адреса еще не удален после исчезновения из DNS;
+			// попытка повторяется при следующем разрешении.
+			log.Printf("DEBUG: DNS discovery for %s: backend for %s is not added yet: %v", src.url.Host, ip, err)
+			continue
+		}
+		if err != nil {
+			log.Printf("WARN: DNS discovery for %s: cannot add backend for %s: %v", src.url.Host, ip, err)
+			src.members[ip] = ""
+			continue
+		}
+		src.members[ip] = backend.Name()
+	}
+
+	for ip, name := range src.members {
+		if slices.Contains(ips, ip) {
+			continue
+		}
+		delete(src.members, ip)
+		if name == "" {
+			continue
+		}
+		log.Printf("INFO: DNS discovery for %s: address %s is gone. Removing backend %s.", src.url.Host, ip, name)
+		if _, err := s.removeBackend(name, s.dnsDiscovery.DrainTimeout, false); err != nil && !errors.Is(err, ErrBackendNotFound) {
+			log.Printf("WARN: DNS discovery for %s: cannot remove backend %s: %v", src.url.Host, name, err)
+		}
+	}
+}
+
+// expandDNSSpecs заменяет в specs бэкенды, заданные DNS-именем, бэкендами по адресам,
+// полученным при первом разрешении, и запоминает источники в пуле.
+func (s *ServerPool) expandDNSSpecs(specs []BackendSpec) []BackendSpec {
+	expanded := make([]BackendSpec, 0, len(specs))
+	for _, spec := range specs {
+		if !IsDNSDiscoveryURL(spec.URL) {
+			expanded = append(expanded, spec)
+			continue
+		}
+		src, err := newDNSSource(spec)
+		if err != nil {
+			log.Printf("ERROR: Invalid backend '%s': %v. Skipping.", spec.URL, err)
+			continue
+		}
+		s.dnsSources = append(s.dnsSources, src)
+		ips, err := src.resolve(context.Background())
+		if err != nil {
+			log.Printf("ERROR: DNS discovery for %s failed: %v. Backends will be added after the next successful resolution.", src.url.Host, err)
+			continue
+		}
+		log.Printf("INFO: DNS discovery for %s resolved %d addresses: %s", src.url.Host, len(ips), strings.Join(ips, ", "))
+		for _, ip := range ips {
+			member := src.memberSpec(ip)
+			src.members[ip] = member.Name
+			expanded = append(expanded, member)
+		}
+	}
+	return expanded
+}
+
+// pruneDNSMembers забывает адреса, бэкенды которых не попали в пул при создании
+// (например, дубликаты), чтобы они были добавлены при следующем разрешении.
+func (s *ServerPool) pruneDNSMembers() {
+	for _, src := range s.dnsSources {
+		for ip, name := range src.members {
+			if s.GetBackendByName(name) == nil {
+				delete(src.members, ip)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package balancer
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"time"
+)
+
+// ErrBackendNotFound возвращается, если бэкенд с указанным именем отсутствует в пуле.
+var ErrBackendNotFound = errors.New("backend not found")
+
+// Ошибки перевода бэкенда в режим drain и обратно.
+var (
+	ErrBackendRemoving    = errors.New("backend is already being removed")
+	ErrBackendDraining    = errors.New("backend is already draining")
+	ErrBackendNotDraining = errors.New("backend is not draining")
+)
+
+// drainPollInterval - как часто проверяется завершение активных запросов при drain.
+const drainPollInterval = 100 * time.Millisecond
+
+// RemoveBackend удаляет бэкенд из пула с предварительным "сливом" соединений (drain).
+// Бэкенд сразу перестает получать новые запросы, но уже начатые запросы могут
+// завершиться в течение drainTimeout. После этого (или по истечении таймаута) бэкенд
+// удаляется из пула, а его простаивающие keep-alive соединения закрываются.
+// Удаление выполняется асинхронно; возвращаемый канал закрывается по его завершении.
+// Административное отключение имени (см. SetBackendEnabled) при этом снимается.
+func (s *ServerPool) RemoveBackend(name string, drainTimeout time.Duration) (<-chan struct{}, error) {
+	return s.removeBackend(name, drainTimeout, true)
+}
+
+// removeBackend удаляет бэкенд как RemoveBackend. Если forget равен false, административное
+// отключение имени сохраняется для бэкенда, которого источник (DNS, реестр etcd, файл
+// со списком бэкендов) заменяет или добавит заново.
+func (s *ServerPool) removeBackend(name string, drainTimeout time.Duration, forget bool) (<-chan struct{}, error) {
+	backend := s.GetBackendByName(name)
+	if backend == nil {
+		return nil, ErrBackendNotFound
+	}
+	if !backend.startDraining("removal requested") {
+		return nil, ErrBackendRemoving
+	}
+	if forget {
+		s.mu.Lock()
+		delete(s.disabled, name)
+		s.mu.Unlock()
+	}
+	return s.finishRemoval(backend, drainTimeout), nil
+}
+
+// finishRemoval удаляет из пула бэкенд, уже переведенный в режим удаления (startDraining),
+// после завершения его активных запросов или по истечении drainTimeout. Возвращаемый канал
+// закрывается по завершении удаления.
+func (s *ServerPool) finishRemoval(backend *Backend, drainTimeout time.Duration) <-chan struct{} {
+	name := backend.Name()
+	log.Printf("INFO: Draining backend %s (active requests: %d, timeout: %v)", name, backend.ActiveRequests(), drainTimeout)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		waitForRequests(backend, drainTimeout, func() bool { return false })
+		backend.completeDrain(backend.drainGeneration())
+
+		s.mu.Lock()
+		for i, b := range s.backends {
+			if b == backend {
+				s.backends = append(s.backends[:i:i], s.backends[i+1:]...)
+				break
+			}
+		}
+		// Бэкенд с тем же именем мог быть добавлен во время drain: его серии метрик сохраняются.
+		replaced := slices.ContainsFunc(s.backends, func(b *Backend) bool { return b.Name() == name })
+		s.mu.Unlock()
+
+		backend.closeIdleConnections("drain")
+		if !replaced {
+			deleteBackendMetrics(name)
+		}
+		log.Printf("INFO: Backend %s removed from pool", name)
+	}()
+	return done
+}
+
+// deleteBackendMetrics удаляет серии метрик удаленного бэкенда name, чтобы /metrics не
+// накапливал серии бэкендов, исчезнувших после обнаружения через DNS или замены списка.
+// lb_upgraded_connections не удаляется: соединения, переключенные на другой протокол,
+// продолжают работать после удаления бэкенда и уменьшают gauge при закрытии.
+func deleteBackendMetrics(name string) {
+	for _, v := range []interface{ DeleteLabel(name, value string) }{
+		backendStateGauge,
+		backendFlapsTotal,
+		backendFlapping,
+		backendRateLimitedTotal,
+		backendSaturatedTotal,
+		backendIdleClosesTotal,
+		backendConnectionsTotal,
+		backendDNSLookupsTotal,
+		backendTLSHandshakesTotal,
+		backendTLSSessionsTotal,
+		backendPhaseDuration,
+		upstreamRetriesTotal,
+		slowRequestsTotal,
+		upgradedClosesTotal,
+	} {
+		v.DeleteLabel("backend", name)
+	}
+}
+
+// DrainBackend переводит бэкенд в режим drain без удаления из пула (например, на время
+// выкатки новой версии бэкенда): новые запросы на него не направляются, а начатые
+// завершаются. Когда активные запросы завершились или истек drainTimeout, drain считается
+// завершенным (см. Backend.DrainStatus) и простаивающие соединения закрываются; запросы,
+// не завершившиеся за drainTimeout, не прерываются. Возвращаемый канал закрывается по
+// завершении drain или при возврате бэкенда в ротацию (см. UndrainBackend).
+func (s *ServerPool) DrainBackend(name string, drainTimeout time.Duration, reason string) (<-chan struct{}, error) {
+	backend := s.GetBackendByName(name)
+	if backend == nil {
+		return nil, ErrBackendNotFound
+	}
+	gen, err := backend.setDraining(true, reason)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("INFO: Draining backend %s for maintenance (active requests: %d, timeout: %v)", name, backend.ActiveRequests(), drainTimeout)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Цикл прерывается, если бэкенд вернули в ротацию или начали удалять.
+		cancelled := func() bool {
+			draining, _ := backend.DrainStatus()
+			return !draining || backend.drainGeneration() != gen
+		}
+		if !waitForRequests(backend, drainTimeout, cancelled) {
+			return
+		}
+		if backend.completeDrain(gen) {
+			backend.closeIdleConnections("drain")
+			log.Printf("INFO: Backend %s drained", name)
+		}
+	}()
+	return done, nil
+}
+
+// UndrainBackend возвращает бэкенд из режима drain (см. DrainBackend) в ротацию. Как и после
+// добавления, бэкенд получает трафик, если проходит проверки состояния.
+func (s *ServerPool) UndrainBackend(name, reason string) error {
+	backend := s.GetBackendByName(name)
+	if backend == nil {
+		return ErrBackendNotFound
+	}
+	if _, err := backend.setDraining(false, reason); err != nil {
+		return err
+	}
+	log.Printf("INFO: Backend %s returned to rotation after drain", name)
+	return nil
+}
+
+// waitForRequests ожидает завершения активных запросов бэкенда не дольше timeout.
+// Возвращает false, если ожидание прервано (cancelled вернула true).
+func waitForRequests(backend *Backend, timeout time.Duration, cancelled func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for backend.ActiveRequests() > 0 && time.Now().Before(deadline) {
+		if cancelled() {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	if cancelled() {
+		return false
+	}
+	if active := backend.ActiveRequests(); active > 0 {
+		log.Printf("WARN: Drain timeout for backend %s expired with %d requests still active", backend.Name(), active)
+	}
+	return true
+}
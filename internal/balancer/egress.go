@@ -0,0 +1,132 @@
+package balancer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Режимы выбора прокси для исходящих соединений с бэкендами.
+const (
+	// EgressProxyEnvironment - прокси из переменных окружения HTTP_PROXY, HTTPS_PROXY и
+	// NO_PROXY (поведение по умолчанию).
+	EgressProxyEnvironment = "environment"
+	// EgressProxyStatic - прокси из EgressProxy.URL для всех бэкендов, кроме EgressProxy.NoProxy.
+	EgressProxyStatic = "static"
+	// EgressProxyNone - соединения с бэкендами устанавливаются напрямую.
+	EgressProxyNone = "none"
+)
+
+// EgressProxy задает прокси, через который проходят соединения с бэкендами (например,
+// корпоративный egress-прокси). Бэкенды за Unix-сокетом всегда подключаются напрямую.
+type EgressProxy struct {
+	Mode string // EgressProxyEnvironment, EgressProxyStatic или EgressProxyNone.
+	URL  string // URL прокси для режима EgressProxyStatic: http, https или socks5.
+	// NoProxy - хосты, доменные суффиксы (".corp.local" или "corp.local"), IP и CIDR,
+	// соединения с которыми в режиме EgressProxyStatic устанавливаются напрямую; "*" - все.
+	NoProxy []string
+}
+
+// proxyFunc возвращает функцию выбора прокси для http.Transport.Proxy (nil - без прокси).
+func (p EgressProxy) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	switch p.Mode {
+	case "", EgressProxyEnvironment:
+		return http.ProxyFromEnvironment, nil
+	case EgressProxyNone:
+		return nil, nil
+	case EgressProxyStatic:
+		proxyURL, err := url.Parse(p.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid egress proxy URL: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported egress proxy scheme %q (expected http, https or socks5)", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid egress proxy URL %q: missing host", p.URL)
+		}
+		bypass, err := parseNoProxy(p.NoProxy)
+		if err != nil {
+			return nil, err
+		}
+		return func(req *http.Request) (*url.URL, error) {
+			if bypass(req.URL.Hostname()) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown egress proxy mode %q (expected %s, %s or %s)", p.Mode, EgressProxyEnvironment, EgressProxyStatic, EgressProxyNone)
+	}
+}
+
+// parseNoProxy разбирает список исключений и возвращает функцию, сообщающую, нужно ли
+// подключаться к хосту напрямую.
+func parseNoProxy(entries []string) (func(host string) bool, error) {
+	var (
+		all      bool
+		networks []*net.IPNet
+		hosts    []string
+	)
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			all = true
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid no_proxy entry %q: %w", entry, err)
+			}
+			networks = append(networks, network)
+		default:
+			hosts = append(hosts, strings.TrimPrefix(entry, "."))
+		}
+	}
+	return func(host string) bool {
+		if all {
+			return true
+		}
+		host = strings.ToLower(host)
+		if ip := net.ParseIP(host); ip != nil {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					return true
+				}
+			}
+		}
+		for _, h := range hosts {
+			if host == h || strings.HasSuffix(host, "."+h) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// SetEgressProxy задает прокси для соединений со всеми бэкендами пула, включая проверки
+// состояния. Вызывается при запуске, до начала обработки запросов и запуска HealthCheck.
+func (s *ServerPool) SetEgressProxy(p EgressProxy) error {
+	proxy, err := p.proxyFunc()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.egressProxy, s.egressSet = proxy, true
+	for _, b := range s.backends {
+		if b.socketPath != "" {
+			continue
+		}
+		b.proxy = proxy
+		if transport, ok := b.ReverseProxy.Transport.(*http.Transport); ok {
+			transport.Proxy = proxy
+		}
+	}
+	return nil
+}
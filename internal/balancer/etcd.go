@@ -0,0 +1,169 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Параметры повторного подключения к etcd после ошибки.
+const (
+	etcdRetryMin = time.Second
+	etcdRetryMax = 30 * time.Second
+)
+
+// EtcdRegistryPolicy задает реестр бэкендов в etcd: бэкенды регистрируются сами, записывая
+// ключ под префиксом Prefix с lease (TTL), а пул отслеживает префикс и добавляет или
+// удаляет бэкенды при появлении и удалении (истечении lease) ключей.
+//
+// Значение ключа - URL бэкенда или JSON {"name": "...", "url": "...", "max_rps": 0, "max_conns": 0}; без
+// имени бэкенд называется по ключу без префикса.
+type EtcdRegistryPolicy struct {
+	Endpoints []string // Адреса JSON-шлюза etcd (http://etcd-1:2379).
+	Prefix    string
+	// Имя и пароль пользователя etcd ("" - без аутентификации).
+	Username string
+	Password string
+	// Время на завершение запросов к бэкенду, ключ которого удален (см. RemoveBackend).
+	DrainTimeout time.Duration
+}
+
+// etcdRegistry - состояние реестра бэкендов в etcd.
+type etcdRegistry struct {
+	policy  EtcdRegistryPolicy
+	client  *etcdClient
+	members *dynamicMembers // Ключ etcd -> бэкенд.
+}
+
+// etcdBackendValue - значение ключа реестра в формате JSON.
+type etcdBackendValue struct {
+	Name     string  `json:"name"`
+	URL      string  `json:"url"`
+	MaxRPS   float64 `json:"max_rps"`
+	MaxConns int     `json:"max_conns"`
+}
+
+// SetEtcdRegistry задает реестр бэкендов в etcd. Должен вызываться до RunEtcdRegistry.
+func (s *ServerPool) SetEtcdRegistry(policy EtcdRegistryPolicy) error {
+	if len(policy.Endpoints) == 0 {
+		return errors.New("at least one etcd endpoint is required")
+	}
+	for _, e := range policy.Endpoints {
+		if !strings.HasPrefix(e, "http://") && !strings.HasPrefix(e, "https://") {
+			return fmt.Errorf("invalid etcd endpoint %q (expected http:// or https://)", e)
+		}
+	}
+	if policy.Prefix == "" {
+		return errors.New("etcd prefix is required")
+	}
+	s.etcd = &etcdRegistry{
+		policy:  policy,
+		client:  newEtcdClient(policy.Endpoints, policy.Username, policy.Password),
+		members: newDynamicMembers(s, "etcd registry", policy.DrainTimeout),
+	}
+	return nil
+}
+
+// CheckEtcdRegistry проверяет доступность etcd чтением префикса реестра (для самопроверки
+// при запуске).
+func (s *ServerPool) CheckEtcdRegistry(ctx context.Context) error {
+	if s.etcd == nil {
+		return errors.New("etcd registry is not configured")
+	}
+	_, _, err := s.etcd.client.rangePrefix(ctx, s.etcd.policy.Prefix)
+	return err
+}
+
+// RunEtcdRegistry читает бэкенды из etcd (см. SetEtcdRegistry) и затем отслеживает изменения
+// префикса. После ошибки подключения или обрыва отслеживания состояние перечитывается с
+// нарастающей паузой; бэкенды при этом сохраняются. Блокируется до отмены ctx.
+func (s *ServerPool) RunEtcdRegistry(ctx context.Context) {
+	reg := s.etcd
+	if reg == nil {
+		return
+	}
+	retry := etcdRetryMin
+	for {
+		revision, err := s.syncEtcd(ctx)
+		if err == nil {
+			retry = etcdRetryMin
+			err = reg.client.watchPrefix(ctx, reg.policy.Prefix, revision+1, func(events []etcdEvent) {
+				for _, e := range events {
+					if e.Type == "DELETE" {
+						reg.members.remove(string(e.KV.Key))
+					} else {
+						reg.put(string(e.KV.Key), e.KV.Value)
+					}
+				}
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("WARN: etcd registry %s: %v. Retrying in %v.", reg.policy.Prefix, err, retry)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, etcdRetryMax)
+	}
+}
+
+// syncEtcd приводит бэкенды реестра в соответствие с текущими ключами и возвращает ревизию,
+// с которой нужно отслеживать изменения.
+func (s *ServerPool) syncEtcd(ctx context.Context) (int64, error) {
+	reg := s.etcd
+	kvs, revision, err := reg.client.rangePrefix(ctx, reg.policy.Prefix)
+	if err != nil {
+		return 0, err
+	}
+	specs := make(map[string]BackendSpec, len(kvs))
+	for _, kv := range kvs {
+		key := string(kv.Key)
+		spec, err := reg.memberSpec(key, kv.Value)
+		if err != nil {
+			log.Printf("WARN: etcd registry: ignoring key %s: %v", key, err)
+			continue
+		}
+		specs[key] = spec
+	}
+	reg.members.sync(specs)
+	log.Printf("INFO: etcd registry %s: %d backends registered (revision %d).", reg.policy.Prefix, len(specs), revision)
+	return revision, nil
+}
+
+// memberSpec возвращает описание бэкенда по ключу и значению.
+func (reg *etcdRegistry) memberSpec(key string, value []byte) (BackendSpec, error) {
+	var spec BackendSpec
+	v := etcdBackendValue{URL: strings.TrimSpace(string(value))}
+	if strings.HasPrefix(v.URL, "{") {
+		v = etcdBackendValue{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return spec, fmt.Errorf("invalid value: %w", err)
+		}
+	}
+	if v.URL == "" {
+		return spec, errors.New("empty backend URL")
+	}
+	spec.Name, spec.URL, spec.MaxRPS, spec.MaxConns = v.Name, v.URL, v.MaxRPS, v.MaxConns
+	if spec.Name == "" {
+		spec.Name = strings.TrimPrefix(key, reg.policy.Prefix)
+	}
+	return spec, nil
+}
+
+// put добавляет или заменяет бэкенд ключа key; ключ с некорректным значением удаляет бэкенд.
+func (reg *etcdRegistry) put(key string, value []byte) {
+	spec, err := reg.memberSpec(key, value)
+	if err != nil {
+		log.Printf("WARN: etcd registry: ignoring key %s: %v", key, err)
+		reg.members.remove(key)
+		return
+	}
+	reg.members.put(key, spec)
+}
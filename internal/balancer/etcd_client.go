@@ -0,0 +1,241 @@
+package balancer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// etcdClient - минимальный клиент etcd v3 через JSON-шлюз (/v3/kv/range, /v3/watch):
+// чтение ключей по префиксу и отслеживание их изменений. Эндпоинты перебираются по кругу
+// при сетевых ошибках.
+type etcdClient struct {
+	endpoints []string
+	username  string
+	password  string
+	http      *http.Client
+
+	mu      sync.Mutex
+	current int    // Индекс текущего эндпоинта.
+	token   string // Токен аутентификации ("" - не получен).
+}
+
+// errEtcdUnauthenticated - токен отсутствует или истек.
+var errEtcdUnauthenticated = errors.New("etcd: unauthenticated")
+
+// etcdInt - целое etcd, которое JSON-шлюз передает строкой.
+type etcdInt int64
+
+func (n *etcdInt) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("etcd: invalid integer %s", data)
+	}
+	*n = etcdInt(v)
+	return nil
+}
+
+type etcdKV struct {
+	Key         []byte  `json:"key"`
+	Value       []byte  `json:"value"`
+	ModRevision etcdInt `json:"mod_revision"`
+}
+
+type etcdHeader struct {
+	Revision etcdInt `json:"revision"`
+}
+
+type etcdEvent struct {
+	Type string `json:"type"` // PUT (пусто) или DELETE.
+	KV   etcdKV `json:"kv"`
+}
+
+type etcdWatchResult struct {
+	Header          etcdHeader  `json:"header"`
+	Created         bool        `json:"created"`
+	Canceled        bool        `json:"canceled"`
+	CancelReason    string      `json:"cancel_reason"`
+	CompactRevision etcdInt     `json:"compact_revision"`
+	Events          []etcdEvent `json:"events"`
+}
+
+type etcdError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newEtcdClient(endpoints []string, username, password string) *etcdClient {
+	trimmed := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		trimmed = append(trimmed, strings.TrimRight(e, "/"))
+	}
+	return &etcdClient{endpoints: trimmed, username: username, password: password, http: &http.Client{}}
+}
+
+// endpoint возвращает текущий эндпоинт; failover переключает на следующий.
+func (c *etcdClient) endpoint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoints[c.current]
+}
+
+func (c *etcdClient) failover() {
+	c.mu.Lock()
+	c.current = (c.current + 1) % len(c.endpoints)
+	c.mu.Unlock()
+}
+
+// post отправляет JSON-запрос к path текущего эндпоинта и возвращает ответ со статусом 200.
+// При сетевой ошибке клиент переключается на следующий эндпоинт.
+func (c *etcdClient) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	if c.username != "" && path != "/v3/auth/authenticate" {
+		if err := c.authenticate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := c.endpoint()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.mu.Lock()
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	}
+	c.mu.Unlock()
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.failover()
+		}
+		return nil, fmt.Errorf("etcd %s: %w", endpoint, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var e etcdError
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", errEtcdUnauthenticated, e.Message)
+	}
+	return nil, fmt.Errorf("etcd %s%s: status %d: %s", endpoint, path, resp.StatusCode, e.Message)
+}
+
+// authenticate получает токен по имени и паролю, если он еще не получен.
+func (c *etcdClient) authenticate(ctx context.Context) error {
+	c.mu.Lock()
+	hasToken := c.token != ""
+	c.mu.Unlock()
+	if hasToken {
+		return nil
+	}
+	resp, err := c.post(ctx, "/v3/auth/authenticate", map[string]string{"name": c.username, "password": c.password})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.Token == "" {
+		return fmt.Errorf("etcd: invalid authenticate response: %v", err)
+	}
+	c.mu.Lock()
+	c.token = out.Token
+	c.mu.Unlock()
+	return nil
+}
+
+// prefixRangeEnd возвращает конец диапазона ключей с префиксом prefix.
+func prefixRangeEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0} // Все ключи.
+}
+
+// rangePrefix возвращает ключи с префиксом prefix и ревизию хранилища на момент чтения.
+func (c *etcdClient) rangePrefix(ctx context.Context, prefix string) ([]etcdKV, int64, error) {
+	resp, err := c.post(ctx, "/v3/kv/range", map[string][]byte{"key": []byte(prefix), "range_end": prefixRangeEnd(prefix)})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Header etcdHeader `json:"header"`
+		KVs    []etcdKV   `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, 0, fmt.Errorf("etcd: invalid range response: %w", err)
+	}
+	return out.KVs, int64(out.Header.Revision), nil
+}
+
+// watchPrefix отслеживает изменения ключей с префиксом prefix начиная с ревизии startRevision
+// и передает их в handle. Блокируется до отмены ctx или обрыва потока; всегда возвращает
+// ошибку (ctx.Err() при отмене).
+func (c *etcdClient) watchPrefix(ctx context.Context, prefix string, startRevision int64, handle func([]etcdEvent)) error {
+	resp, err := c.post(ctx, "/v3/watch", map[string]any{"create_request": map[string]any{
+		"key":            []byte(prefix),
+		"range_end":      prefixRangeEnd(prefix),
+		"start_revision": strconv.FormatInt(startRevision, 10),
+	}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var msg struct {
+			Result *etcdWatchResult `json:"result"`
+			Error  *etcdError       `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return errors.New("etcd: watch stream closed")
+			}
+			return fmt.Errorf("etcd: watch stream: %w", err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("etcd: watch: %s", msg.Error.Message)
+		}
+		if msg.Result == nil {
+			continue
+		}
+		if msg.Result.Canceled {
+			if msg.Result.CompactRevision > 0 {
+				return fmt.Errorf("etcd: watch revision %d compacted (compact revision %d)", startRevision, msg.Result.CompactRevision)
+			}
+			return fmt.Errorf("etcd: watch canceled: %s", msg.Result.CancelReason)
+		}
+		if len(msg.Result.Events) > 0 {
+			handle(msg.Result.Events)
+		}
+	}
+}
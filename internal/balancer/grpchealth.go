@@ -0,0 +1,192 @@
+package balancer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Проверка состояния по протоколу gRPC Health Checking (grpc.health.v1.Health/Check).
+// Вызов выполняется клиентом HTTP/2 стандартной библиотеки (http.Transport с Protocols):
+// результат определяется по статусу gRPC из trailers (grpc-status) и сообщению
+// HealthCheckResponse.
+
+// grpcHealthCheckPath - метод стандартного сервиса проверки состояния gRPC.
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// grpcServing - статус SERVING в grpc.health.v1.HealthCheckResponse.
+const grpcServing = 1
+
+// grpcServingStatuses - имена значений grpc.health.v1.HealthCheckResponse.ServingStatus.
+var grpcServingStatuses = []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}
+
+// grpcCodes - имена кодов статуса gRPC (grpc-status).
+var grpcCodes = []string{"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED"}
+
+// probeBackendGRPC проверяет бэкенд вызовом grpc.health.v1.Health/Check для сервиса
+// policy.GRPCService (пусто - сервер в целом). Для https-бэкендов (или Scheme https)
+// используется TLS с ALPN h2, иначе HTTP/2 без шифрования (h2c). Возвращает unhealthy, если
+// вызов не выполнен в течение таймаута, завершился ненулевым grpc-status или статус
+// не SERVING, иначе healthy; а также причину.
+func probeBackendGRPC(b *Backend, policy HealthCheckPolicy, timeout time.Duration) (HealthState, string) {
+	target := b.proxyTarget().JoinPath(grpcHealthCheckPath)
+	if policy.Scheme != "" {
+		target.Scheme = policy.Scheme
+	}
+	if !strings.EqualFold(target.Scheme, "https") {
+		target.Scheme = "http"
+	}
+	req, err := http.NewRequest(http.MethodPost, target.String(), bytes.NewReader(grpcHealthRequest(policy.GRPCService)))
+	if err != nil {
+		return StateUnhealthy, "invalid grpc check request: " + err.Error()
+	}
+	for name, value := range policy.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", max(timeout.Milliseconds(), 1)))
+
+	// Каждая проверка устанавливает новое соединение; используется только HTTP/2.
+	transport := &http.Transport{DisableKeepAlives: true}
+	b.applyDialer(transport)
+	transport.Protocols = upstreamProtocols(ProtocolHTTP2, target.Scheme)
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return StateUnhealthy, "grpc check failed: " + err.Error()
+	}
+	// Trailers доступны после чтения тела до конца.
+	message, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody+1))
+	_ = resp.Body.Close()
+	if err != nil {
+		return StateUnhealthy, "grpc check failed to read response: " + err.Error()
+	}
+	if len(message) > maxHealthCheckBody {
+		return StateUnhealthy, "grpc check failed: health check response is too large"
+	}
+	if resp.StatusCode != http.StatusOK {
+		return StateUnhealthy, fmt.Sprintf("grpc check failed: backend returned HTTP status %d (not a gRPC server?)", resp.StatusCode)
+	}
+	if err := grpcCallStatus(resp); err != nil {
+		return StateUnhealthy, "grpc check failed: " + err.Error()
+	}
+
+	status, err := parseGRPCHealthResponse(message)
+	if err != nil {
+		return StateUnhealthy, "grpc check failed: " + err.Error()
+	}
+	if status != grpcServing {
+		return StateUnhealthy, "grpc check returned " + grpcStatusName(status)
+	}
+	return StateHealthy, "grpc check returned SERVING"
+}
+
+// grpcCallStatus возвращает ошибку, если вызов завершился ненулевым статусом gRPC. Статус
+// передается в trailers, а в ответе без сообщения (trailers-only) - в заголовках ответа.
+func grpcCallStatus(resp *http.Response) error {
+	code, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if code == "" {
+		return errors.New("backend response has no grpc-status (not a gRPC server?)")
+	}
+	if code == "0" {
+		return nil
+	}
+	name := "code " + code
+	if n, err := strconv.Atoi(code); err == nil && n >= 0 && n < len(grpcCodes) {
+		name = grpcCodes[n]
+	}
+	if message != "" {
+		return fmt.Errorf("call failed with status %s: %s", name, message)
+	}
+	return fmt.Errorf("call failed with status %s", name)
+}
+
+// grpcStatusName возвращает имя статуса HealthCheckResponse.
+func grpcStatusName(status uint64) string {
+	if status < uint64(len(grpcServingStatuses)) {
+		return grpcServingStatuses[status]
+	}
+	return fmt.Sprintf("status %d", status)
+}
+
+// grpcHealthRequest кодирует сообщение gRPC с HealthCheckRequest{service}.
+func grpcHealthRequest(service string) []byte {
+	var msg []byte
+	if service != "" {
+		msg = append(msg, 0x0a) // Поле 1 (service), тип length-delimited.
+		msg = binary.AppendUvarint(msg, uint64(len(service)))
+		msg = append(msg, service...)
+	}
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// parseGRPCHealthResponse извлекает статус из сообщения gRPC с HealthCheckResponse.
+// Вызов с grpc-status 0 должен вернуть сообщение.
+func parseGRPCHealthResponse(message []byte) (uint64, error) {
+	if len(message) < 5 {
+		return 0, errors.New("backend returned no HealthCheckResponse")
+	}
+	if message[0] != 0 {
+		return 0, errors.New("compressed HealthCheckResponse is not supported")
+	}
+	size := binary.BigEndian.Uint32(message[1:5])
+	if uint64(len(message)-5) < uint64(size) {
+		return 0, errors.New("truncated HealthCheckResponse")
+	}
+	msg := message[5 : 5+size]
+	var status uint64 // Отсутствующее поле - значение по умолчанию UNKNOWN.
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed HealthCheckResponse")
+		}
+		msg = msg[n:]
+		var size int
+		switch tag & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed HealthCheckResponse")
+			}
+			if tag>>3 == 1 {
+				status = v
+			}
+			size = n
+		case 1: // fixed64
+			size = 8
+		case 2: // length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || l > uint64(len(msg)-n) {
+				return 0, errors.New("malformed HealthCheckResponse")
+			}
+			size = n + int(l)
+		case 5: // fixed32
+			size = 4
+		default:
+			return 0, errors.New("malformed HealthCheckResponse")
+		}
+		if size > len(msg) {
+			return 0, errors.New("malformed HealthCheckResponse")
+		}
+		msg = msg[size:]
+	}
+	return status, nil
+}
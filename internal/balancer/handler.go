@@ -11,24 +11,34 @@ import (
 
 // NewLoadBalancerHandler создает новый http.Handler, который распределяет входящие запросы
 // между доступными бэкендами из предоставленного ServerPool.
-// Если пул не настроен или не содержит бэкендов, возвращает обработчик, отвечающий ошибкой 500.
+// Если пул не настроен, возвращает обработчик, отвечающий ошибкой 500. Пул может быть пустым
+// при создании обработчика (бэкенды добавляет реестр etcd, файл со списком или Admin API):
+// пока доступных бэкендов нет, запросы получают 503.
 func NewLoadBalancerHandler(pool *ServerPool) http.Handler {
-	if pool == nil || len(pool.GetBackends()) == 0 {
+	if pool == nil {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("ERROR: Load balancer is not configured or has no valid backends. Request [%s %s]", r.Method, r.URL.Path)
+			log.Printf("ERROR: Load balancer is not configured. Request [%s %s]", r.Method, r.URL.Path)
 			httputil_pkg.RespondWithError(w, http.StatusInternalServerError, "Load Balancer Configuration Error")
 		})
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("INFO: Received request: %s %s %s from %s", r.Method, r.Host, r.URL.Path, r.RemoteAddr)
+		pool.applyHTTP10Policy(w, r)
+
+		if pool.serveStaticResponse(w, r) {
+			return
+		}
 
 		attempts := 0
 		maxAttempts := len(pool.GetBackends())
-		var peer *Backend
+		peer, binding := pool.stickyPeer(r)
+		if peer != nil {
+			stickyRequestsTotal.With("hit").Inc()
+		}
 
-		for attempts < maxAttempts {
-			peer = pool.GetNextPeer()
+		for peer == nil && attempts < maxAttempts {
+			peer = pool.NextPeer(r)
 			if peer != nil {
 				break
 			}
@@ -43,10 +53,53 @@ func NewLoadBalancerHandler(pool *ServerPool) http.Handler {
 			return
 		}
 
-		log.Printf("INFO: Forwarding request [%s %s] to backend %s", r.Method, r.URL.Path, peer.URL)
+		rt := pool.newRetrier(r)
+		if rt != nil {
+			defer rt.close()
+		}
+		for {
+			log.Printf("INFO: Forwarding request [%s %s] to backend %s", r.Method, r.URL.Path, peer.URL)
+			if binding.backend != peer.Name() {
+				pool.bindSticky(w, peer, binding)
+			}
 
-		ctx := context.WithValue(r.Context(), Retry, attempts)
+			if tracked, ok := r.Context().Value(peerKey{}).(*trackedPeer); ok {
+				tracked.name = peer.Name()
+			}
+			req := r.WithContext(context.WithValue(r.Context(), Retry, attempts))
+			if rt == nil {
+				peer.ServeHTTP(w, req)
+				return
+			}
 
-		peer.ReverseProxy.ServeHTTP(w, r.WithContext(ctx))
+			peer.ServeHTTP(w, rt.prepare(req, peer))
+			err := rt.failed()
+			if err == nil {
+				return
+			}
+			failed := peer
+			if peer = rt.next(); peer == nil {
+				log.Printf("ERROR: No backend to retry request [%s %s] after connection error to %s: %v", r.Method, r.URL.Path, failed.URL, err)
+				http.Error(w, "Bad Gateway: Error connecting to backend", http.StatusBadGateway)
+				return
+			}
+			log.Printf("WARN: Retrying request [%s %s] on backend %s after connection error to %s: %v", r.Method, r.URL.Path, peer.URL, failed.URL, err)
+			attempts++
+		}
 	})
 }
+
+type peerKey struct{}
+
+type trackedPeer struct {
+	name string
+}
+
+// WithPeerTracking возвращает запрос, для которого обработчик балансировщика запомнит
+// выбранный бэкенд, и функцию, возвращающую имя этого бэкенда после обработки запроса
+// ("" - запрос не был направлен на бэкенд).
+func WithPeerTracking(r *http.Request) (*http.Request, func() string) {
+	tracked := &trackedPeer{}
+	r = r.WithContext(context.WithValue(r.Context(), peerKey{}, tracked))
+	return r, func() string { return tracked.name }
+}
@@ -1,60 +1,495 @@
 package balancer
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"log"
-	"net"
-	"net/url"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
 
-// HealthCheck запускает периодическую проверку состояния всех бэкендов в пуле.
-// Сначала выполняется немедленная проверка, затем проверки повторяются с интервалом s.healthCheckInterval.
-func (s *ServerPool) HealthCheck() {
+// Режимы проверки состояния бэкендов.
+const (
+	// HealthCheckTCP - бэкенд считается доступным, если к нему устанавливается TCP-соединение.
+	HealthCheckTCP = "tcp"
+	// HealthCheckHTTP - бэкенд считается доступным, если на HTTP-запрос к HealthCheckPolicy.Path
+	// он отвечает ожидаемым статусом.
+	HealthCheckHTTP = "http"
+	// HealthCheckGRPC - бэкенд считается доступным, если на вызов grpc.health.v1.Health/Check
+	// (протокол gRPC Health Checking) он отвечает статусом SERVING.
+	HealthCheckGRPC = "grpc"
+)
+
+// HealthCheckPolicy задает способ проверки состояния бэкендов пула.
+type HealthCheckPolicy struct {
+	Mode   string // HealthCheckTCP (по умолчанию), HealthCheckHTTP или HealthCheckGRPC.
+	Path   string // Путь проверки относительно URL бэкенда, например "/healthz".
+	Method string // HTTP-метод проверки (по умолчанию GET).
+	// ExpectedStatuses - статусы ответа, при которых бэкенд считается доступным
+	// (пусто - любой статус 2xx).
+	ExpectedStatuses []int
+	// HealthyThreshold - число подряд успешных проверок, после которого недоступный бэкенд
+	// возвращается в ротацию; UnhealthyThreshold - число подряд неудачных проверок, после
+	// которого бэкенд выводится из ротации. 0 или 1 - по первой проверке.
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	// Scheme - схема запроса HTTP-проверки: http или https (пусто - схема URL бэкенда).
+	Scheme string
+	// ExpectedBody - подстрока, а ExpectedBodyRegex - регулярное выражение, которым должно
+	// соответствовать тело ответа проверки (пусто - тело не проверяется). Нужны, если бэкенд
+	// отвечает 200 и в деградированном состоянии. Проверяются первые maxHealthCheckBody байт.
+	ExpectedBody      string
+	ExpectedBodyRegex string
+	bodyRegex         *regexp.Regexp
+	// Jitter - доля интервала (0..1), на которую срок каждой проверки случайно смещается
+	// в обе стороны, чтобы проверки множества бэкендов не совпадали по времени (0 - без смещения).
+	Jitter float64
+	// MaxBackoff - предельный интервал проверки бэкенда, неудачно проверяемого подряд: интервал
+	// удваивается с каждой неудачной проверкой после первой, но не превышает MaxBackoff
+	// (0 - без увеличения интервала).
+	MaxBackoff time.Duration
+	// DegradedLatency - длительность успешной проверки, после которой бэкенд считается
+	// degraded (0 - состояние degraded по времени проверки не используется).
+	DegradedLatency time.Duration
+	// GRPCService - имя сервиса в запросе gRPC-проверки (пусто - состояние сервера в целом).
+	GRPCService string
+	// Headers - заголовки запроса HTTP- и gRPC-проверки (например, Authorization или
+	// User-Agent). Заголовок Host задает имя хоста запроса (:authority для gRPC), если бэкенд
+	// выбирает виртуальный хост по нему.
+	Headers map[string]string
+}
+
+// maxHealthCheckBody - максимальный размер тела ответа проверки, который читается и
+// сравнивается с ожидаемым.
+const maxHealthCheckBody = 64 << 10
+
+// HealthCheckOverride переопределяет параметры проверки состояния пула для отдельного бэкенда
+// (например, реже проверять бэкенд с "дорогим" эндпоинтом проверки). Нулевые значения -
+// параметры пула.
+type HealthCheckOverride struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	Mode     string // HealthCheckTCP, HealthCheckHTTP или HealthCheckGRPC.
+	Path     string
+	Scheme   string // http или https.
+	// Заголовки проверки бэкенда; дополняют и переопределяют HealthCheckPolicy.Headers.
+	Headers map[string]string
+}
+
+// validate проверяет корректность переопределения.
+func (o HealthCheckOverride) validate() error {
+	if o.Interval < 0 || o.Timeout < 0 {
+		return fmt.Errorf("health check interval and timeout must not be negative")
+	}
+	switch o.Mode {
+	case "", HealthCheckTCP, HealthCheckHTTP, HealthCheckGRPC:
+	default:
+		return fmt.Errorf("unknown health check mode %q (expected %s, %s or %s)", o.Mode, HealthCheckTCP, HealthCheckHTTP, HealthCheckGRPC)
+	}
+	if o.Path != "" && !strings.HasPrefix(o.Path, "/") {
+		return fmt.Errorf("health check path %q must start with '/'", o.Path)
+	}
+	if err := validateCheckHeaders(o.Headers); err != nil {
+		return err
+	}
+	return validateCheckScheme(o.Scheme)
+}
+
+// validateCheckScheme проверяет схему запроса HTTP-проверки.
+func validateCheckScheme(scheme string) error {
+	switch scheme {
+	case "", "http", "https":
+		return nil
+	default:
+		return fmt.Errorf("unknown health check scheme %q (expected http or https)", scheme)
+	}
+}
+
+// validateCheckHeaders проверяет имена и значения заголовков проверки.
+func validateCheckHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid health check header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("health check header %s must not contain line breaks", name)
+		}
+	}
+	return nil
+}
+
+// SetHealthCheckPolicy задает способ проверки состояния бэкендов. Таймаут проверки -
+// health check timeout пула. Должен вызываться до запуска HealthCheck.
+func (s *ServerPool) SetHealthCheckPolicy(policy HealthCheckPolicy) error {
+	switch policy.Mode {
+	case "", HealthCheckTCP, HealthCheckGRPC:
+	case HealthCheckHTTP:
+		if !strings.HasPrefix(policy.Path, "/") {
+			return fmt.Errorf("health check path %q must start with '/'", policy.Path)
+		}
+		if policy.Method == "" {
+			policy.Method = http.MethodGet
+		}
+		for _, status := range policy.ExpectedStatuses {
+			if status < 100 || status > 599 {
+				return fmt.Errorf("invalid expected health check status %d", status)
+			}
+		}
+		if policy.ExpectedBodyRegex != "" {
+			re, err := regexp.Compile(policy.ExpectedBodyRegex)
+			if err != nil {
+				return fmt.Errorf("invalid health check body regex: %w", err)
+			}
+			policy.bodyRegex = re
+		}
+		if policy.checksBody() && policy.Method == http.MethodHead {
+			return fmt.Errorf("health check body matching requires a method other than HEAD")
+		}
+	default:
+		return fmt.Errorf("unknown health check mode %q (expected %s, %s or %s)", policy.Mode, HealthCheckTCP, HealthCheckHTTP, HealthCheckGRPC)
+	}
+	if policy.HealthyThreshold < 0 || policy.UnhealthyThreshold < 0 {
+		return fmt.Errorf("health check thresholds must not be negative")
+	}
+	if policy.Jitter < 0 || policy.Jitter >= 1 {
+		return fmt.Errorf("health check jitter must be in [0, 1)")
+	}
+	if policy.MaxBackoff < 0 {
+		return fmt.Errorf("health check max backoff must not be negative")
+	}
+	if err := validateCheckScheme(policy.Scheme); err != nil {
+		return err
+	}
+	if err := validateCheckHeaders(policy.Headers); err != nil {
+		return err
+	}
+	s.healthCheck = policy
+	return nil
+}
+
+// HealthCheck запускает периодическую проверку состояния всех бэкендов в пуле и блокируется
+// до отмены ctx. Сначала выполняется немедленная проверка всех бэкендов, затем каждый бэкенд
+// проверяется со своим интервалом (s.healthCheckInterval или HealthCheckOverride.Interval).
+// Проверки бэкендов с одинаковым интервалом равномерно распределяются по интервалу, чтобы не
+// создавать синхронных всплесков нагрузки. При отмене ctx начатые проверки завершаются
+// (не дольше таймаута проверки).
+func (s *ServerPool) HealthCheck(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
 	log.Println("INFO: Starting initial health check...")
-	s.runHealthCheckCycle()
+	s.runHealthCheckCycle(time.Now())
 	log.Println("INFO: Initial health check completed.")
 
-	ticker := time.NewTicker(s.healthCheckInterval)
-	defer ticker.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	timer := time.NewTimer(time.Until(s.nextHealthCheckDue()))
+	defer timer.Stop()
 
 	for {
-		<-ticker.C
-		s.runHealthCheckCycle()
+		select {
+		case <-timer.C:
+			// Проверки выполняются в фоне, чтобы медленный бэкенд не задерживал проверки остальных.
+			s.startHealthChecks(time.Now(), &wg)
+			timer.Reset(time.Until(s.nextHealthCheckDue()))
+		case <-s.healthWake:
+			// Добавлен бэкенд - его первая проверка выполняется без ожидания интервала.
+			timer.Stop()
+			timer.Reset(time.Until(s.nextHealthCheckDue()))
+		case <-ctx.Done():
+			log.Println("INFO: Health check loop stopped.")
+			return
+		}
+	}
+}
+
+// nextHealthCheckDue возвращает ближайший срок проверки среди бэкендов пула.
+func (s *ServerPool) nextHealthCheckDue() time.Time {
+	next := time.Now().Add(s.healthCheckInterval)
+	for _, b := range s.GetBackends() {
+		if b.nextCheck.Before(next) {
+			next = b.nextCheck
+		}
+	}
+	return next
+}
+
+// healthCheckFor возвращает политику, таймаут и интервал проверки бэкенда b с учетом
+// его переопределений (см. HealthCheckOverride).
+func (s *ServerPool) healthCheckFor(b *Backend) (HealthCheckPolicy, time.Duration, time.Duration) {
+	policy, timeout, interval := s.healthCheck, s.healthCheckTimeout, s.healthCheckInterval
+	o := b.healthOverride
+	if o.Interval > 0 {
+		interval = o.Interval
+	}
+	if o.Timeout > 0 {
+		timeout = o.Timeout
+	}
+	if o.Mode != "" {
+		policy.Mode = o.Mode
+	}
+	if o.Path != "" {
+		policy.Path = o.Path
+	}
+	if o.Scheme != "" {
+		policy.Scheme = o.Scheme
+	}
+	if len(o.Headers) > 0 {
+		headers := make(map[string]string, len(policy.Headers)+len(o.Headers))
+		for name, value := range policy.Headers {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+		for name, value := range o.Headers {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+		policy.Headers = headers
+	}
+	if policy.Method == "" {
+		policy.Method = http.MethodGet
+	}
+	return policy, timeout, interval
+}
+
+// runHealthCheckCycle выполняет один цикл проверки состояния для бэкендов пула, срок проверки
+// которых наступил не позже due, и дожидается его завершения.
+func (s *ServerPool) runHealthCheckCycle(due time.Time) {
+	var wg sync.WaitGroup
+	if checked := s.startHealthChecks(due, &wg); checked > 0 {
+		log.Println("INFO: Starting health check cycle...")
+		wg.Wait()
+		log.Printf("INFO: Health check cycle completed (%d backends checked).", checked)
 	}
 }
 
-// runHealthCheckCycle выполняет один цикл проверки состояния для всех бэкендов в пуле.
-// Проверки выполняются параллельно для ускорения.
-func (s *ServerPool) runHealthCheckCycle() {
-	log.Println("INFO: Starting health check cycle...")
-	wg := sync.WaitGroup{}
+// startHealthChecks запускает параллельные проверки бэкендов, срок проверки которых наступил
+// не позже due, и планирует их следующие проверки. Возвращает число запущенных проверок.
+// Бэкенд, предыдущая проверка которого еще не завершилась, пропускается.
+func (s *ServerPool) startHealthChecks(due time.Time, wg *sync.WaitGroup) int {
 	backends := s.GetBackends()
 
-	for _, b := range backends {
+	checked := 0
+	for i, b := range backends {
+		if b.nextCheck.After(due) {
+			continue
+		}
+		policy, timeout, interval := s.healthCheckFor(b)
+		interval = policy.checkInterval(interval, b.CheckStatus().ConsecutiveFailures)
+		b.nextCheck = nextCheckTime(b.nextCheck, due, interval, i, len(backends))
+		if !b.probing.CompareAndSwap(false, true) {
+			continue
+		}
+		checked++
+
 		wg.Add(1)
 		go func(backend *Backend) {
 			defer wg.Done()
-			status := "up"
-			alive := isBackendAlive(backend.URL, s.healthCheckTimeout)
-			backend.SetAlive(alive)
-			if !alive {
-				status = "down"
+			defer backend.probing.Store(false)
+			var checkState HealthState
+			var reason string
+			start := time.Now()
+			switch policy.Mode {
+			case HealthCheckHTTP:
+				checkState, reason = probeBackendHTTP(backend, policy, timeout)
+			case HealthCheckGRPC:
+				checkState, reason = probeBackendGRPC(backend, policy, timeout)
+			default:
+				checkState, reason = probeBackend(backend, timeout)
 			}
-			log.Printf("INFO: Health Check: Backend %s is %s", backend.URL, status)
+			checkState, reason = policy.applyDegradedLatency(checkState, reason, time.Since(start))
+			checkState, reason = backend.applyThresholds(checkState, reason, policy)
+			state := backend.applyHealthCheckResult(checkState, reason, s.flapDetection, time.Now())
+			log.Printf("INFO: Health Check: Backend %s is %s (%s)", backend.URL, state, backend.State().Reason)
 		}(b)
 	}
-	wg.Wait()
-	log.Println("INFO: Health check cycle completed.")
+	return checked
+}
+
+// applyDegradedLatency переводит успешную проверку, занявшую больше DegradedLatency,
+// в состояние degraded.
+func (p HealthCheckPolicy) applyDegradedLatency(state HealthState, reason string, elapsed time.Duration) (HealthState, string) {
+	if state != StateHealthy || p.DegradedLatency <= 0 || elapsed <= p.DegradedLatency {
+		return state, reason
+	}
+	return StateDegraded, fmt.Sprintf("slow check: %v (%s)", elapsed.Round(time.Millisecond), reason)
+}
+
+// checkInterval возвращает интервал до следующей проверки бэкенда, последние failures проверок
+// которого были неудачными: с экспоненциальным увеличением до MaxBackoff и случайным
+// смещением Jitter.
+func (p HealthCheckPolicy) checkInterval(interval time.Duration, failures int) time.Duration {
+	if p.MaxBackoff > interval {
+		for i := 1; i < failures && interval < p.MaxBackoff; i++ {
+			interval *= 2
+		}
+		interval = min(interval, p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		interval += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(interval))
+	}
+	return interval
+}
+
+// nextCheckTime возвращает срок следующей проверки бэкенда с индексом index из count после
+// проверки со сроком prev, выполненной в due. После первой проверки (prev нулевое) сроки
+// бэкендов сдвигаются на долю интервала по индексу, после чего сохраняются с шагом interval.
+func nextCheckTime(prev, due time.Time, interval time.Duration, index, count int) time.Time {
+	if prev.IsZero() {
+		return due.Add(interval + interval*time.Duration(index)/time.Duration(count))
+	}
+	next := prev.Add(interval)
+	if !next.After(due) {
+		// Проверка опоздала больше чем на интервал - отсчет от фактического времени.
+		next = due.Add(interval)
+	}
+	return next
+}
+
+// probeBackend проверяет доступность одного бэкенда путем попытки установить соединение
+// (TCP или с Unix-сокетом бэкенда; для https-бэкенда - с TLS-рукопожатием). Возвращает unhealthy, если соединение не установлено
+// в течение таймаута, иначе healthy; а также причину.
+func probeBackend(b *Backend, timeout time.Duration) (HealthState, string) {
+	network, address := b.dialAddress()
+	start := time.Now()
+	conn, err := b.dialTimeout(network, address, timeout)
+	if err != nil {
+		return StateUnhealthy, network + " dial failed: " + err.Error()
+	}
+	defer conn.Close()
+	if b.socketPath == "" && strings.EqualFold(b.URL.Scheme, "https") {
+		// Открытый порт еще не означает работоспособный TLS-эндпоинт.
+		_ = conn.SetDeadline(start.Add(timeout))
+		if err := tls.Client(conn, b.clientTLSConfig()).Handshake(); err != nil {
+			return StateUnhealthy, "tls handshake failed: " + err.Error()
+		}
+		network = "tls"
+	}
+	return StateHealthy, network + " dial succeeded"
 }
 
-// isBackendAlive проверяет доступность одного бэкенда путем попытки установить TCP-соединение.
-// Возвращает true, если соединение успешно установлено в течение заданного таймаута, иначе false.
-func isBackendAlive(u *url.URL, timeout time.Duration) bool {
-	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+// probeBackendHTTP проверяет бэкенд HTTP-запросом согласно политике policy. Возвращает
+// unhealthy, если запрос не выполнен в течение таймаута или статус ответа не ожидаемый,
+// иначе healthy; а также причину.
+func probeBackendHTTP(b *Backend, policy HealthCheckPolicy, timeout time.Duration) (HealthState, string) {
+	target := b.proxyTarget().JoinPath(policy.Path)
+	if policy.Scheme != "" {
+		target.Scheme = policy.Scheme
+	}
+	req, err := http.NewRequest(policy.Method, target.String(), nil)
+	if err != nil {
+		return StateUnhealthy, "invalid health check request: " + err.Error()
+	}
+	for name, value := range policy.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	// Каждая проверка устанавливает новое соединение, как и TCP-проверка.
+	transport := &http.Transport{DisableKeepAlives: true}
+	b.applyDialer(transport)
+	transport.Protocols = upstreamProtocols(b.Protocol(), target.Scheme)
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
 	if err != nil {
+		return StateUnhealthy, "http check failed: " + err.Error()
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody))
+	_ = resp.Body.Close()
+
+	if !policy.expectedStatus(resp.StatusCode) {
+		return StateUnhealthy, fmt.Sprintf("http check %s %s returned unexpected status %d", policy.Method, policy.Path, resp.StatusCode)
+	}
+	if policy.checksBody() {
+		if err != nil {
+			return StateUnhealthy, "http check failed to read body: " + err.Error()
+		}
+		if !policy.expectedBody(body) {
+			return StateUnhealthy, fmt.Sprintf("http check %s %s returned status %d with unexpected body", policy.Method, policy.Path, resp.StatusCode)
+		}
+	}
+	return StateHealthy, fmt.Sprintf("http check returned %d", resp.StatusCode)
+}
+
+// expectedStatus сообщает, считается ли статус ответа проверки успешным.
+func (p HealthCheckPolicy) expectedStatus(status int) bool {
+	if len(p.ExpectedStatuses) == 0 {
+		return status >= 200 && status < 300
+	}
+	return slices.Contains(p.ExpectedStatuses, status)
+}
+
+// checksBody сообщает, проверяется ли тело ответа проверки.
+func (p HealthCheckPolicy) checksBody() bool {
+	return p.ExpectedBody != "" || p.bodyRegex != nil
+}
+
+// expectedBody сообщает, соответствует ли тело ответа проверки ожидаемому: содержит
+// ExpectedBody и соответствует ExpectedBodyRegex (если заданы).
+func (p HealthCheckPolicy) expectedBody(body []byte) bool {
+	if p.ExpectedBody != "" && !bytes.Contains(body, []byte(p.ExpectedBody)) {
 		return false
 	}
-	_ = conn.Close()
-	return true
+	return p.bodyRegex == nil || p.bodyRegex.Match(body)
+}
+
+// CheckStatus - сводка активных проверок состояния бэкенда.
+type CheckStatus struct {
+	LastCheck           time.Time // Время последней проверки (нулевое - проверок еще не было).
+	LastError           string    // Причина последней неудачной проверки ("" - неудач не было).
+	ConsecutiveFailures int       // Число подряд неудачных проверок.
+}
+
+// CheckStatus возвращает сводку активных проверок состояния бэкенда.
+func (b *Backend) CheckStatus() CheckStatus {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return CheckStatus{LastCheck: b.lastCheck, LastError: b.lastCheckError, ConsecutiveFailures: b.checkFailures}
+}
+
+// applyThresholds учитывает результат проверки в счетчиках подряд идущих успешных и неудачных
+// проверок и возвращает результат с учетом порогов policy: пока порог не достигнут, бэкенд
+// остается в прежнем состоянии. Первая проверка бэкенда применяется сразу, чтобы при запуске
+// бэкенды не ждали нескольких интервалов.
+func (b *Backend) applyThresholds(state HealthState, reason string, policy HealthCheckPolicy) (HealthState, string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	passing := state.Serving()
+	b.lastCheck = time.Now()
+	if passing {
+		b.checkPasses++
+		b.checkFailures = 0
+	} else {
+		b.checkFailures++
+		b.checkPasses = 0
+		b.lastCheckError = reason
+	}
+	if !b.checked {
+		b.checked = true
+		return state, reason
+	}
+
+	current := b.checkState
+	switch {
+	case passing && !current.Serving() && b.checkPasses < policy.HealthyThreshold:
+		return current, fmt.Sprintf("%s (passed %d of %d checks required to recover)", reason, b.checkPasses, policy.HealthyThreshold)
+	case !passing && current.Serving() && b.checkFailures < policy.UnhealthyThreshold:
+		return current, fmt.Sprintf("%s (failed %d of %d checks required to mark down)", reason, b.checkFailures, policy.UnhealthyThreshold)
+	}
+	return state, reason
 }
@@ -0,0 +1,457 @@
+package balancer
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProbeBackendHTTP проверяет HTTP-проверку состояния: путь, метод и ожидаемые статусы.
+func TestProbeBackendHTTP(t *testing.T) {
+	status := http.StatusOK
+	var gotMethod, gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL + "/app")
+	require.NoError(t, err)
+	b := newBackend(u)
+
+	policy := HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/healthz", Method: http.MethodHead}
+	state, _ := probeBackendHTTP(b, policy, time.Second)
+	assert.Equal(t, StateHealthy, state)
+	assert.Equal(t, http.MethodHead, gotMethod)
+	assert.Equal(t, "/app/healthz", gotPath)
+
+	status = http.StatusInternalServerError
+	state, reason := probeBackendHTTP(b, policy, time.Second)
+	assert.Equal(t, StateUnhealthy, state, "TCP-reachable backend returning 500 must be unhealthy")
+	assert.Contains(t, reason, "500")
+
+	policy.ExpectedStatuses = []int{http.StatusServiceUnavailable, http.StatusInternalServerError}
+	state, _ = probeBackendHTTP(b, policy, time.Second)
+	assert.Equal(t, StateHealthy, state)
+
+	server.Close()
+	state, _ = probeBackendHTTP(b, policy, time.Second)
+	assert.Equal(t, StateUnhealthy, state)
+}
+
+// TestProbeBackendHTTP_ExpectedBody проверяет, что бэкенд, отвечающий 200 с телом
+// деградированного состояния, считается недоступным.
+func TestProbeBackendHTTP_ExpectedBody(t *testing.T) {
+	body := `{"status":"ok"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	b := newBackend(u)
+
+	pool := &ServerPool{}
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{
+		Mode:              HealthCheckHTTP,
+		Path:              "/healthz",
+		ExpectedBody:      `"status":"ok"`,
+		ExpectedBodyRegex: `^\{.*\}$`,
+	}))
+	state, reason := probeBackendHTTP(b, pool.healthCheck, time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+
+	body = `{"status":"degraded"}`
+	state, reason = probeBackendHTTP(b, pool.healthCheck, time.Second)
+	assert.Equal(t, StateUnhealthy, state)
+	assert.Contains(t, reason, "unexpected body")
+
+	body = `"status":"ok"`
+	state, _ = probeBackendHTTP(b, pool.healthCheck, time.Second)
+	assert.Equal(t, StateUnhealthy, state, "Both substring and regex must match")
+
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/", ExpectedBodyRegex: "("}))
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/", Method: http.MethodHead, ExpectedBody: "ok"}))
+}
+
+// TestProbeBackendHTTP_Headers проверяет заголовки HTTP-проверки: заголовки пула дополняются
+// и переопределяются заголовками бэкенда, а Host задает имя хоста запроса.
+func TestProbeBackendHTTP_Headers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "app.internal" || r.Header.Get("Authorization") != "Bearer backend" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, r.UserAgent())
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	b := newBackend(u)
+
+	pool := &ServerPool{}
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{
+		Mode:         HealthCheckHTTP,
+		Path:         "/healthz",
+		ExpectedBody: "lb-probe",
+		Headers:      map[string]string{"Authorization": "Bearer pool", "User-Agent": "lb-probe", "Host": "app.internal"},
+	}))
+	policy, _, _ := pool.healthCheckFor(b)
+	state, reason := probeBackendHTTP(b, policy, time.Second)
+	assert.Equal(t, StateUnhealthy, state)
+	assert.Contains(t, reason, "401")
+
+	b.healthOverride = HealthCheckOverride{Headers: map[string]string{"authorization": "Bearer backend"}}
+	policy, _, _ = pool.healthCheckFor(b)
+	state, reason = probeBackendHTTP(b, policy, time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+	assert.Equal(t, "Bearer pool", pool.healthCheck.Headers["Authorization"], "Pool headers must not be modified")
+
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/", Headers: map[string]string{"Bad Name": "x"}}))
+	assert.Error(t, HealthCheckOverride{Headers: map[string]string{"X-Token": "a\r\nInjected: 1"}}.validate())
+}
+
+// TestSetHealthCheckPolicy проверяет валидацию политики проверки состояния.
+func TestSetHealthCheckPolicy(t *testing.T) {
+	pool := &ServerPool{}
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/healthz"}))
+	assert.Equal(t, http.MethodGet, pool.healthCheck.Method, "GET is the default method")
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "healthz"}))
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/", ExpectedStatuses: []int{999}}))
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: "udp"}))
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{}))
+}
+
+// TestBackend_ApplyThresholds проверяет, что бэкенд выводится из ротации и возвращается
+// в нее только после заданного числа подряд идущих неудачных и успешных проверок.
+func TestBackend_ApplyThresholds(t *testing.T) {
+	b := newTestBackend("http://backend1:8081", false)
+	policy := HealthCheckPolicy{HealthyThreshold: 2, UnhealthyThreshold: 3}
+	check := func(state HealthState) HealthState {
+		state, reason := b.applyThresholds(state, "check", policy)
+		return b.applyHealthCheckResult(state, reason, FlapDetection{}, time.Now())
+	}
+
+	assert.Equal(t, StateHealthy, check(StateHealthy), "First check is applied immediately")
+
+	assert.Equal(t, StateHealthy, check(StateUnhealthy))
+	assert.Equal(t, StateHealthy, check(StateUnhealthy))
+	assert.Equal(t, StateHealthy, check(StateHealthy), "Success resets the failure count")
+	assert.Equal(t, StateHealthy, check(StateUnhealthy))
+	assert.Equal(t, StateHealthy, check(StateUnhealthy))
+	assert.Equal(t, StateUnhealthy, check(StateUnhealthy), "Third consecutive failure marks backend down")
+
+	assert.Equal(t, StateUnhealthy, check(StateHealthy))
+	assert.Equal(t, StateUnhealthy, check(StateUnhealthy))
+	assert.Equal(t, StateUnhealthy, check(StateHealthy))
+	assert.Equal(t, StateDegraded, check(StateDegraded), "Second consecutive success restores backend")
+}
+
+// TestServerPool_HealthCheckOverride проверяет, что бэкенд с переопределенными параметрами
+// проверяется по своему пути и со своим интервалом.
+func TestServerPool_HealthCheckOverride(t *testing.T) {
+	var fastPaths, slowPaths []string
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastPaths = append(fastPaths, r.URL.Path)
+	}))
+	defer fast.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowPaths = append(slowPaths, r.URL.Path)
+	}))
+	defer slow.Close()
+
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{URL: fast.URL},
+		{URL: slow.URL, HealthCheck: HealthCheckOverride{Interval: time.Minute, Timeout: 5 * time.Second, Path: "/deep"}},
+		{URL: "http://invalid:8080", HealthCheck: HealthCheckOverride{Path: "deep"}},
+	}, 10*time.Second, time.Second)
+	require.NoError(t, err)
+	require.Len(t, pool.GetBackends(), 2, "Backend with invalid override is skipped")
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/healthz"}))
+
+	now := time.Now()
+	pool.runHealthCheckCycle(now)
+	pool.runHealthCheckCycle(now.Add(11 * time.Second))
+	pool.runHealthCheckCycle(now.Add(22 * time.Second))
+	assert.Equal(t, []string{"/healthz", "/healthz", "/healthz"}, fastPaths)
+	assert.Equal(t, []string{"/deep"}, slowPaths, "Backend with 1m interval is checked once")
+
+	// Второй бэкенд из двух сдвинут на половину своего интервала.
+	pool.runHealthCheckCycle(now.Add(61 * time.Second))
+	assert.Len(t, slowPaths, 1)
+	pool.runHealthCheckCycle(now.Add(91 * time.Second))
+	assert.Len(t, slowPaths, 2)
+
+	policy, timeout, interval := pool.healthCheckFor(pool.GetBackends()[1])
+	assert.Equal(t, "/deep", policy.Path)
+	assert.Equal(t, 5*time.Second, timeout)
+	assert.Equal(t, time.Minute, interval)
+}
+
+// TestServerPool_HealthCheckStops проверяет, что цикл проверок завершается при отмене контекста.
+func TestServerPool_HealthCheckStops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pool, err := NewServerPool([]string{server.URL}, 10*time.Millisecond, time.Second)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.HealthCheck(ctx)
+	}()
+	require.Eventually(t, func() bool { return pool.GetBackends()[0].IsAlive() }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("HealthCheck did not return after context cancellation")
+	}
+
+	// С уже отмененным контекстом проверка не запускается.
+	pool.HealthCheck(ctx)
+}
+
+// TestBackend_CheckStatus проверяет сводку активных проверок: время последней проверки,
+// последнюю ошибку и число подряд неудачных проверок.
+func TestBackend_CheckStatus(t *testing.T) {
+	b := newTestBackend("http://backend1:8081", false)
+	assert.True(t, b.CheckStatus().LastCheck.IsZero(), "No checks yet")
+
+	b.applyThresholds(StateUnhealthy, "tcp dial failed: refused", HealthCheckPolicy{})
+	b.applyThresholds(StateUnhealthy, "tcp dial failed: timeout", HealthCheckPolicy{})
+	status := b.CheckStatus()
+	assert.False(t, status.LastCheck.IsZero())
+	assert.Equal(t, "tcp dial failed: timeout", status.LastError)
+	assert.Equal(t, 2, status.ConsecutiveFailures)
+
+	b.applyThresholds(StateHealthy, "tcp dial succeeded", HealthCheckPolicy{})
+	status = b.CheckStatus()
+	assert.Equal(t, "tcp dial failed: timeout", status.LastError, "Last error is kept after recovery")
+	assert.Zero(t, status.ConsecutiveFailures)
+}
+
+// TestServerPool_HealthCheckStagger проверяет, что после первой проверки сроки проверок
+// бэкендов равномерно распределяются по интервалу и затем сохраняют свой сдвиг.
+func TestServerPool_HealthCheckStagger(t *testing.T) {
+	pool, err := NewServerPool([]string{"http://127.0.0.1:1", "http://127.0.0.1:2", "http://127.0.0.1:3", "http://127.0.0.1:4"}, 10*time.Second, 100*time.Millisecond)
+	require.NoError(t, err)
+
+	now := time.Now()
+	pool.runHealthCheckCycle(now)
+	backends := pool.GetBackends()
+	for i, offset := range []time.Duration{0, 2500 * time.Millisecond, 5 * time.Second, 7500 * time.Millisecond} {
+		assert.Equal(t, now.Add(10*time.Second+offset), backends[i].nextCheck, "backend %d", i)
+	}
+	assert.Equal(t, now.Add(10*time.Second), pool.nextHealthCheckDue())
+
+	// В срок проверяется только первый бэкенд; его сдвиг сохраняется.
+	pool.runHealthCheckCycle(now.Add(10*time.Second + 100*time.Millisecond))
+	assert.Equal(t, now.Add(20*time.Second), backends[0].nextCheck)
+	assert.Equal(t, now.Add(12500*time.Millisecond), backends[1].nextCheck)
+
+	// Опоздавшая больше чем на интервал проверка отсчитывается от фактического времени.
+	late := now.Add(time.Minute)
+	assert.Equal(t, late.Add(10*time.Second), nextCheckTime(now.Add(10*time.Second), late, 10*time.Second, 0, 4))
+}
+
+// TestHealthCheckPolicy_CheckInterval проверяет экспоненциальное увеличение интервала для
+// неудачно проверяемого бэкенда и случайное смещение сроков.
+func TestHealthCheckPolicy_CheckInterval(t *testing.T) {
+	policy := HealthCheckPolicy{MaxBackoff: time.Minute}
+	for failures, want := range []time.Duration{10 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		assert.Equal(t, want, policy.checkInterval(10*time.Second, failures), "failures %d", failures)
+	}
+	assert.Equal(t, 10*time.Second, HealthCheckPolicy{}.checkInterval(10*time.Second, 5), "Backoff is disabled by default")
+
+	policy = HealthCheckPolicy{Jitter: 0.2}
+	seen := make(map[time.Duration]bool)
+	for range 100 {
+		interval := policy.checkInterval(10*time.Second, 0)
+		assert.GreaterOrEqual(t, interval, 8*time.Second)
+		assert.LessOrEqual(t, interval, 12*time.Second)
+		seen[interval] = true
+	}
+	assert.Greater(t, len(seen), 1, "Intervals are randomized")
+
+	pool := &ServerPool{}
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Jitter: 1}))
+	assert.Error(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{MaxBackoff: -time.Second}))
+}
+
+// TestServerPool_StartupGate проверяет готовность пула после запуска: по числу бэкендов,
+// прошедших первую проверку, или по истечении таймаута.
+func TestServerPool_StartupGate(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	pool, err := NewServerPool([]string{up.URL, "http://127.0.0.1:1"}, time.Second, 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.Error(t, pool.SetStartupGate(StartupGate{MinHealthy: 3, Timeout: time.Minute}))
+	assert.Error(t, pool.SetStartupGate(StartupGate{MinHealthy: 1}))
+
+	require.NoError(t, pool.SetStartupGate(StartupGate{MinHealthy: 1, Timeout: time.Minute}))
+	assert.False(t, pool.Ready(), "No backend checked yet")
+	pool.runHealthCheckCycle(time.Now())
+	assert.True(t, pool.Ready())
+	pool.GetBackends()[0].SetAlive(false, "test")
+	assert.True(t, pool.Ready(), "Readiness is kept once reached")
+	require.NoError(t, pool.WaitReady(context.Background()))
+
+	timedOut, err := NewServerPool([]string{"http://127.0.0.1:1"}, time.Second, 100*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, timedOut.SetStartupGate(StartupGate{MinHealthy: 1, Timeout: 50 * time.Millisecond}))
+	timedOut.runHealthCheckCycle(time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, timedOut.WaitReady(ctx), "Pool becomes ready after startup timeout")
+}
+
+// TestProbeBackend_TLS проверяет, что TCP-проверка https-бэкенда выполняет TLS-рукопожатие
+// с проверкой сертификата по CA бэкенда и SNI.
+func TestProbeBackend_TLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+	// Порт, принимающий соединения без TLS.
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	plainURL := strings.Replace(plain.URL, "http://", "https://", 1)
+
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "trusted", URL: upstream.URL, TLS: BackendTLS{CAFile: caFile, ServerName: "example.com"}},
+		{Name: "wrong-sni", URL: strings.Replace(upstream.URL, "127.0.0.1", "localhost", 1), TLS: BackendTLS{CAFile: caFile, ServerName: "other.test"}},
+		{Name: "plain", URL: plainURL, TLS: BackendTLS{CAFile: caFile}},
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+
+	state, reason := probeBackend(pool.GetBackendByName("trusted"), time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+	assert.Contains(t, reason, "tls")
+	for _, name := range []string{"wrong-sni", "plain"} {
+		state, reason = probeBackend(pool.GetBackendByName(name), time.Second)
+		assert.Equal(t, StateUnhealthy, state, name)
+		assert.Contains(t, reason, "tls handshake failed", name)
+	}
+}
+
+// TestProbeBackendGRPC проверяет проверку по протоколу gRPC Health Checking: статус сервиса
+// из ответа, ответ без сообщения (ошибка gRPC) и бэкенд без поддержки HTTP/2.
+func TestProbeBackendGRPC(t *testing.T) {
+	statuses := map[string]byte{"": 1, "billing": 2}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != grpcHealthCheckPath || r.Header.Get("Content-Type") != "application/grpc" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		if string(body) == string(grpcHealthRequest("failing")) {
+			// Сообщение со статусом SERVING, но вызов завершен ошибкой в trailers.
+			w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+			_, _ = w.Write([]byte{0, 0, 0, 0, 2, 0x08, 1})
+			w.Header().Set("Grpc-Status", "14")
+			w.Header().Set("Grpc-Message", "shutting down")
+			return
+		}
+		for service, status := range statuses {
+			if string(body) == string(grpcHealthRequest(service)) {
+				w.Header().Set("Trailer", "Grpc-Status")
+				_, _ = w.Write([]byte{0, 0, 0, 0, 2, 0x08, status})
+				w.Header().Set("Grpc-Status", "0")
+				return
+			}
+		}
+		w.Header().Set("Grpc-Status", "12") // UNIMPLEMENTED без сообщения (trailers-only).
+	})
+	upstream := httptest.NewUnstartedServer(handler)
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+	cleartext := httptest.NewUnstartedServer(handler)
+	cleartext.Config.Protocols = new(http.Protocols)
+	cleartext.Config.Protocols.SetUnencryptedHTTP2(true)
+	cleartext.Start()
+	defer cleartext.Close()
+	// Бэкенд без HTTP/2.
+	http1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer http1.Close()
+
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "grpc", URL: upstream.URL, TLS: BackendTLS{InsecureSkipVerify: true}},
+		{Name: "h2c", URL: cleartext.URL},
+		{Name: "http1", URL: http1.URL, TLS: BackendTLS{InsecureSkipVerify: true}},
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckGRPC}))
+	backend := pool.GetBackendByName("grpc")
+
+	state, reason := probeBackendGRPC(backend, HealthCheckPolicy{}, time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+	assert.Equal(t, "grpc check returned SERVING", reason)
+
+	state, reason = probeBackendGRPC(pool.GetBackendByName("h2c"), HealthCheckPolicy{}, time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+
+	state, reason = probeBackendGRPC(backend, HealthCheckPolicy{GRPCService: "billing"}, time.Second)
+	assert.Equal(t, StateUnhealthy, state)
+	assert.Equal(t, "grpc check returned NOT_SERVING", reason)
+
+	state, reason = probeBackendGRPC(backend, HealthCheckPolicy{GRPCService: "unknown"}, time.Second)
+	assert.Equal(t, StateUnhealthy, state)
+	assert.Equal(t, "grpc check failed: call failed with status UNIMPLEMENTED", reason)
+
+	state, reason = probeBackendGRPC(backend, HealthCheckPolicy{GRPCService: "failing"}, time.Second)
+	assert.Equal(t, StateUnhealthy, state, "Non-zero grpc-status in trailers fails the check")
+	assert.Equal(t, "grpc check failed: call failed with status UNAVAILABLE: shutting down", reason)
+
+	state, reason = probeBackendGRPC(pool.GetBackendByName("http1"), HealthCheckPolicy{}, time.Second)
+	assert.Equal(t, StateUnhealthy, state, reason)
+}
+
+// TestParseGRPCHealthResponse проверяет разбор HealthCheckResponse, включая неизвестные поля.
+func TestParseGRPCHealthResponse(t *testing.T) {
+	status, err := parseGRPCHealthResponse([]byte{0, 0, 0, 0, 5, 0x12, 1, 'x', 0x08, 2})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), status)
+
+	status, err = parseGRPCHealthResponse([]byte{0, 0, 0, 0, 0})
+	require.NoError(t, err)
+	assert.Equal(t, "UNKNOWN", grpcStatusName(status), "Missing field is UNKNOWN")
+
+	_, err = parseGRPCHealthResponse([]byte{0, 0, 0, 0, 3, 0x08})
+	assert.Error(t, err, "Truncated message")
+	_, err = parseGRPCHealthResponse([]byte{1, 0, 0, 0, 0})
+	assert.Error(t, err, "Compressed message")
+}
+
+// TestHealthCheckPolicy_DegradedLatency проверяет перевод медленной успешной проверки в degraded
+// только при заданном DegradedLatency.
+func TestHealthCheckPolicy_DegradedLatency(t *testing.T) {
+	state, _ := HealthCheckPolicy{}.applyDegradedLatency(StateHealthy, "tcp dial succeeded", time.Minute)
+	assert.Equal(t, StateHealthy, state, "Check duration is ignored by default")
+
+	policy := HealthCheckPolicy{DegradedLatency: 100 * time.Millisecond}
+	state, _ = policy.applyDegradedLatency(StateHealthy, "tcp dial succeeded", 50*time.Millisecond)
+	assert.Equal(t, StateHealthy, state)
+	state, reason := policy.applyDegradedLatency(StateHealthy, "http check returned 200", 150*time.Millisecond)
+	assert.Equal(t, StateDegraded, state)
+	assert.Equal(t, "slow check: 150ms (http check returned 200)", reason)
+	state, _ = policy.applyDegradedLatency(StateUnhealthy, "tcp dial failed", 150*time.Millisecond)
+	assert.Equal(t, StateUnhealthy, state, "Failed check stays unhealthy")
+}
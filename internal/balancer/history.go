@@ -0,0 +1,79 @@
+package balancer
+
+import (
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+// healthHistorySize - количество последних переходов состояния, хранимых для каждого бэкенда.
+const healthHistorySize = 32
+
+var (
+	backendFlapsTotal = metrics.NewCounterVec("lb_backend_flaps_total",
+		"Number of times a backend was detected as flapping.", "backend")
+	backendFlapping = metrics.NewGaugeVec("lb_backend_flapping",
+		"Whether the backend is currently considered flapping (1) or not (0).", "backend")
+)
+
+// HealthTransition описывает одно изменение состояния бэкенда.
+type HealthTransition struct {
+	Time   time.Time   `json:"time"`
+	Alive  bool        `json:"alive"` // Получает ли бэкенд трафик после перехода.
+	State  HealthState `json:"state"`
+	Reason string      `json:"reason"`
+
+	aliveChanged bool // Переход изменил признак Alive (учитывается при обнаружении нестабильности).
+}
+
+// FlapDetection задает параметры обнаружения "мигающих" бэкендов:
+// если за окно Window произошло не меньше Transitions переходов состояния,
+// бэкенд считается нестабильным. При HoldDown > 0 такой бэкенд принудительно
+// выводится из ротации на указанное время, даже если проверки проходят.
+type FlapDetection struct {
+	Enabled     bool
+	Transitions int
+	Window      time.Duration
+	HoldDown    time.Duration
+}
+
+// healthHistory - кольцевой буфер последних переходов состояния.
+// Не потокобезопасен, доступ защищается мьютексом Backend.
+type healthHistory struct {
+	entries [healthHistorySize]HealthTransition
+	next    int
+	count   int
+}
+
+func (h *healthHistory) add(t HealthTransition) {
+	h.entries[h.next] = t
+	h.next = (h.next + 1) % healthHistorySize
+	if h.count < healthHistorySize {
+		h.count++
+	}
+}
+
+// snapshot возвращает копию истории в хронологическом порядке (от старых к новым).
+func (h *healthHistory) snapshot() []HealthTransition {
+	result := make([]HealthTransition, 0, h.count)
+	start := (h.next - h.count + healthHistorySize) % healthHistorySize
+	for i := 0; i < h.count; i++ {
+		result = append(result, h.entries[(start+i)%healthHistorySize])
+	}
+	return result
+}
+
+// countSince возвращает количество переходов up <-> down, произошедших не раньше since.
+func (h *healthHistory) countSince(since time.Time) int {
+	n := 0
+	for i := 0; i < h.count; i++ {
+		idx := (h.next - 1 - i + healthHistorySize) % healthHistorySize
+		if h.entries[idx].Time.Before(since) {
+			break
+		}
+		if h.entries[idx].aliveChanged {
+			n++
+		}
+	}
+	return n
+}
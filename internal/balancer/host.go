@@ -0,0 +1,68 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Режимы формирования заголовка Host, отправляемого бэкенду.
+const (
+	// HostPreserve - передавать Host клиента без изменений (поведение по умолчанию).
+	HostPreserve = "preserve"
+	// HostBackend - использовать хост из URL бэкенда (для name-based virtual hosts).
+	HostBackend = "backend"
+	// HostFixed - использовать фиксированное значение из HostPolicy.Override.
+	HostFixed = "fixed"
+)
+
+// HostPolicy задает, какой заголовок Host получает бэкенд.
+type HostPolicy struct {
+	Mode     string
+	Override string // Значение Host для режима HostFixed.
+}
+
+// upstreamHost возвращает значение Host для бэкенда или "" для сохранения Host клиента.
+func (p HostPolicy) upstreamHost(b *Backend) string {
+	switch p.Mode {
+	case HostBackend:
+		return b.URL.Host
+	case HostFixed:
+		return p.Override
+	default:
+		return ""
+	}
+}
+
+// SetHostPolicy устанавливает политику заголовка Host для всех бэкендов пула.
+// Исходный Host клиента при замене передается в заголовке X-Forwarded-Host.
+// Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetHostPolicy(policy HostPolicy) error {
+	switch policy.Mode {
+	case "", HostPreserve, HostBackend:
+	case HostFixed:
+		if policy.Override == "" {
+			return fmt.Errorf("host override must be specified for %q mode", HostFixed)
+		}
+	default:
+		return fmt.Errorf("unknown host header mode %q (expected %s, %s or %s)", policy.Mode, HostPreserve, HostBackend, HostFixed)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hostPolicy = policy
+	for _, b := range s.backends {
+		b.upstreamHost = policy.upstreamHost(b)
+	}
+	return nil
+}
+
+// rewriteHost подменяет Host исходящего запроса согласно политике бэкенда.
+func (b *Backend) rewriteHost(req *http.Request) {
+	if b.upstreamHost == "" || req.Host == b.upstreamHost {
+		return
+	}
+	if req.Header.Get("X-Forwarded-Host") == "" && req.Host != "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+	req.Host = b.upstreamHost
+}
@@ -0,0 +1,28 @@
+package balancer
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// CanonicalID возвращает канонический идентификатор бэкенда по его URL: хост в нижнем регистре
+// с явным портом (80/443 по умолчанию для http/https) и путем без завершающего слеша.
+// URL, указывающие на один и тот же бэкенд ("http://Host" и "http://host:80/"), получают
+// одинаковый идентификатор. Для Unix-сокета идентификатор - "unix:" и путь к сокету.
+func CanonicalID(u *url.URL) string {
+	if path := unixSocketPath(u); path != "" {
+		return SchemeUnix + ":" + path
+	}
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "https":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(host, port) + strings.TrimRight(u.EscapedPath(), "/")
+}
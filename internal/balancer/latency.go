@@ -0,0 +1,38 @@
+package balancer
+
+import (
+	"math"
+	"time"
+)
+
+// latencyEWMAWeight - вес нового замера в скользящем среднем задержки бэкенда.
+const latencyEWMAWeight = 0.2
+
+// observeLatency учитывает время обработки запроса в скользящем среднем (EWMA) задержки бэкенда.
+func (b *Backend) observeLatency(d time.Duration) {
+	sample := d.Seconds()
+	for {
+		old := b.latencyEWMA.Load()
+		updated := sample
+		if old != 0 {
+			updated = math.Float64frombits(old)*(1-latencyEWMAWeight) + sample*latencyEWMAWeight
+		}
+		if b.latencyEWMA.CompareAndSwap(old, math.Float64bits(updated)) {
+			return
+		}
+	}
+}
+
+// LatencyEWMA возвращает скользящее среднее времени обработки запросов бэкендом
+// (0 - запросов еще не было).
+func (b *Backend) LatencyEWMA() time.Duration {
+	return time.Duration(math.Float64frombits(b.latencyEWMA.Load()) * float64(time.Second))
+}
+
+// lessResponseTime сравнивает бэкенды по средней задержке. Бэкенды без замеров считаются
+// самыми быстрыми, чтобы получить первые запросы; при равенстве предпочитается бэкенд
+// с меньшим числом активных запросов.
+func lessResponseTime(a, b *Backend) bool {
+	la, lb := a.LatencyEWMA(), b.LatencyEWMA()
+	return la < lb || (la == lb && a.ActiveRequests() < b.ActiveRequests())
+}
@@ -0,0 +1,119 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ErrDuplicateBackend возвращается при добавлении бэкенда, URL или имя которого уже есть в пуле.
+var ErrDuplicateBackend = errors.New("backend already exists")
+
+// AddBackend добавляет бэкенд spec в работающий пул с текущими параметрами пула (пул
+// соединений, заголовок Host, egress-прокси и т.д.). Как и при запуске, бэкенд получает
+// трафик только после успешной проверки состояния; первая проверка запускается сразу.
+// Возвращает ErrDuplicateBackend, если бэкенд с тем же URL (см. CanonicalID) или именем
+// уже есть в пуле, в том числе в режиме drain, или если имя занято в другом пуле группы
+// (см. JoinPools).
+func (s *ServerPool) AddBackend(spec BackendSpec) (*Backend, error) {
+	backend, err := buildBackend(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.lockGroup()
+	defer unlock()
+	if err := s.usedByOtherPool(backend.Name()); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	id := CanonicalID(backend.URL)
+	for _, b := range s.backends {
+		if CanonicalID(b.URL) == id || b.Name() == backend.Name() {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s (%s)", ErrDuplicateBackend, b.Name(), b.URL)
+		}
+	}
+	s.configureBackendLocked(backend)
+	s.backends = append(s.backends, backend)
+	s.mu.Unlock()
+
+	log.Printf("INFO: Added backend %s at runtime: %s", backend.Name(), spec.URL)
+	s.wakeHealthCheck()
+	return backend, nil
+}
+
+// wakeHealthCheck запускает внеочередную проверку, чтобы добавленные бэкенды проверялись сразу.
+func (s *ServerPool) wakeHealthCheck() {
+	select {
+	case s.healthWake <- struct{}{}:
+	default:
+	}
+}
+
+// configureBackendLocked применяет к новому бэкенду параметры, заданные для всех бэкендов
+// пула (см. SetTransportSettings, SetHostPolicy, SetProtocolPolicy, SetSlowRequestPolicy,
+// SetEgressProxy), и административное отключение его имени (см. SetBackendEnabled).
+// Вызывающий должен удерживать s.mu.
+func (s *ServerPool) configureBackendLocked(b *Backend) {
+	b.dialSettings = s.transportSettings
+	transport, _ := b.ReverseProxy.Transport.(*http.Transport)
+	if transport != nil {
+		s.configureTransportLocked(b, transport)
+	}
+	if reason, ok := s.disabled[b.Name()]; ok {
+		b.SetAdminDown(true, reason)
+	}
+	b.upstreamHost = s.hostPolicy.upstreamHost(b)
+	b.expectLocal = s.protocolPolicy.ExpectContinue == ExpectLocal
+	b.slowRequests = s.slowRequests
+	b.upgradePolicy = s.upgradePolicy
+	b.pathRewrites = s.pathRewrites
+	if s.egressSet && b.socketPath == "" {
+		b.proxy = s.egressProxy
+		if transport != nil {
+			transport.Proxy = s.egressProxy
+		}
+	}
+}
+
+// configureTransportLocked применяет к Transport бэкенда b параметры пула соединений, протокол
+// и таймаут ожидания 100 Continue. Вызывающий должен удерживать s.mu.
+func (s *ServerPool) configureTransportLocked(b *Backend, transport *http.Transport) {
+	s.transportSettings.apply(transport)
+	b.applyProtocol(transport, s.transportSettings.Protocol)
+	if s.protocolPolicy.ExpectContinueTimeout > 0 {
+		transport.ExpectContinueTimeout = s.protocolPolicy.ExpectContinueTimeout
+	}
+}
+
+// SetBackendEnabled включает или административно выключает бэкенд name. Выключенный бэкенд
+// остается в пуле в состоянии admin_down и не получает трафик независимо от результатов
+// проверок. Флаг хранится пулом по имени бэкенда, поэтому сохраняется и для бэкенда, который
+// источник (DNS, реестр etcd, файл со списком бэкендов) заменяет или добавляет заново;
+// удаление бэкенда через RemoveBackend или ReplaceBackends снимает флаг. Возвращает ErrBackendNotFound, если бэкенда нет в пуле.
+func (s *ServerPool) SetBackendEnabled(name string, enabled bool, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var backend *Backend
+	for _, b := range s.backends {
+		if b.Name() == name {
+			backend = b
+			break
+		}
+	}
+	if backend == nil {
+		return ErrBackendNotFound
+	}
+	if enabled {
+		delete(s.disabled, name)
+	} else {
+		if s.disabled == nil {
+			s.disabled = make(map[string]string)
+		}
+		s.disabled[name] = reason
+	}
+	backend.SetAdminDown(!enabled, reason)
+	return nil
+}
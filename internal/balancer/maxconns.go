@@ -0,0 +1,25 @@
+package balancer
+
+import "cloud/load_balancer/internal/metrics"
+
+var backendSaturatedTotal = metrics.NewCounterVec("lb_backend_saturated_total",
+	"Times a backend was skipped because it reached its max_conns in-flight requests.", "backend")
+
+// hasCapacity сообщает, может ли бэкенд принять еще один запрос с учетом лимита
+// одновременных запросов (см. BackendSpec.MaxConns). Лимит проверяется при выборе бэкенда,
+// поэтому одновременно выбранные запросы могут ненадолго превысить его на единицы.
+// Вызывающий должен удерживать s.mu пула.
+func (b *Backend) hasCapacity() bool {
+	if b.maxConns <= 0 || b.activeRequests.Load() < b.maxConns {
+		return true
+	}
+	backendSaturatedTotal.With(b.Name()).Inc()
+	return false
+}
+
+// MaxConns возвращает лимит одновременных запросов к бэкенду (0 - без ограничения).
+func (b *Backend) MaxConns() int64 {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.maxConns
+}
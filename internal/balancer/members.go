@@ -0,0 +1,131 @@
+package balancer
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// dynamicMembers - бэкенды пула, которые внешний источник (реестр etcd, файл со списком
+// бэкендов) добавляет, заменяет и удаляет по ключам.
+type dynamicMembers struct {
+	pool         *ServerPool
+	source       string // Название источника для логов.
+	drainTimeout time.Duration
+
+	mu      sync.Mutex
+	members map[string]*dynamicMember // Ключ -> бэкенд.
+}
+
+// dynamicMember - бэкенд, заданный ключом источника.
+type dynamicMember struct {
+	spec  BackendSpec
+	added bool   // Бэкенд добавлен в пул.
+	name  string // Имя добавленного бэкенда.
+}
+
+func newDynamicMembers(pool *ServerPool, source string, drainTimeout time.Duration) *dynamicMembers {
+	return &dynamicMembers{pool: pool, source: source, drainTimeout: drainTimeout, members: make(map[string]*dynamicMember)}
+}
+
+// sameSpec сообщает, описывают ли a и b один и тот же бэкенд.
+func sameSpec(a, b BackendSpec) bool {
+	return a.Name == b.Name && a.URL == b.URL && a.MaxRPS == b.MaxRPS && a.MaxConns == b.MaxConns
+}
+
+// put добавляет бэкенд ключа key или заменяет его, если описание изменилось: прежний
+// бэкенд удаляется с drain, новый добавляется после его удаления.
+func (m *dynamicMembers) put(key string, spec BackendSpec) {
+	m.mu.Lock()
+	old := m.members[key]
+	if old != nil && sameSpec(old.spec, spec) {
+		added := old.added
+		m.mu.Unlock()
+		if !added {
+			// Например, бэкенд не добавлен из-за дубликата; повторная попытка при следующем put.
+			m.add(key, old, nil)
+		}
+		return
+	}
+	member := &dynamicMember{spec: spec}
+	m.members[key] = member
+	m.mu.Unlock()
+
+	var drained <-chan struct{}
+	if old != nil && old.added {
+		drained = m.drain(key, old)
+	}
+	m.add(key, member, drained)
+}
+
+// add добавляет бэкенд member в пул после завершения drained (nil - сразу), если ключ
+// по-прежнему указывает на него.
+func (m *dynamicMembers) add(key string, member *dynamicMember, drained <-chan struct{}) {
+	add := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.members[key] != member || member.added {
+			return
+		}
+		backend, err := m.pool.AddBackend(member.spec)
+		if err != nil {
+			log.Printf("WARN: %s: cannot add backend %s for %s: %v", m.source, member.spec.URL, key, err)
+			return
+		}
+		member.added, member.name = true, backend.Name()
+	}
+	if drained == nil {
+		add()
+		return
+	}
+	go func() {
+		<-drained
+		add()
+	}()
+}
+
+// remove удаляет бэкенд ключа key с drain.
+func (m *dynamicMembers) remove(key string) {
+	m.mu.Lock()
+	member := m.members[key]
+	delete(m.members, key)
+	m.mu.Unlock()
+	if member != nil && member.added {
+		m.drain(key, member)
+	}
+}
+
+// sync приводит бэкенды в соответствие с полным состоянием источника specs (ключ -> бэкенд).
+func (m *dynamicMembers) sync(specs map[string]BackendSpec) {
+	for key, spec := range specs {
+		m.put(key, spec)
+	}
+	m.mu.Lock()
+	var gone []string
+	for key := range m.members {
+		if _, ok := specs[key]; !ok {
+			gone = append(gone, key)
+		}
+	}
+	m.mu.Unlock()
+	for _, key := range gone {
+		m.remove(key)
+	}
+}
+
+// drain удаляет бэкенд member из пула с drain и возвращает канал завершения.
+func (m *dynamicMembers) drain(key string, member *dynamicMember) <-chan struct{} {
+	name := member.name
+	log.Printf("INFO: %s: %s is gone or changed. Removing backend %s.", m.source, key, name)
+	done, err := m.pool.removeBackend(name, m.drainTimeout, false)
+	if err != nil {
+		if !errors.Is(err, ErrBackendNotFound) {
+			log.Printf("WARN: %s: cannot remove backend %s: %v", m.source, name, err)
+		}
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	return done
+}
@@ -0,0 +1,111 @@
+package balancer
+
+import (
+	"log"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var poolPanicMode = metrics.NewGaugeVec("lb_pool_panic_mode",
+	"Whether the pool is in panic routing mode (1) or not (0), by pool.", "pool")
+
+// SetName задает имя пула для логов и метрики lb_pool_panic_mode (по умолчанию "main").
+// Должен вызываться до начала обработки запросов.
+func (s *ServerPool) SetName(name string) {
+	s.name = name
+}
+
+// displayName возвращает имя пула для логов и метрик.
+func (s *ServerPool) displayName() string {
+	if s.name == "" {
+		return "main"
+	}
+	return s.name
+}
+
+// SetPanicThreshold задает порог panic-маршрутизации в процентах (0 - отключено).
+// Если доля здоровых бэкендов среди участвующих в балансировке (не в drain и не выключенных
+// администратором) опускается ниже порога, состояние проверок игнорируется и трафик
+// распределяется по всем таким бэкендам, чтобы не перегрузить немногих оставшихся (как в Envoy).
+func (s *ServerPool) SetPanicThreshold(percent float64) {
+	s.panicThreshold = percent
+}
+
+// IsEligible сообщает, участвует ли бэкенд в балансировке в принципе:
+// он не находится в режиме drain и не выключен администратором.
+func (b *Backend) IsEligible() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return !b.draining && !b.adminDown
+}
+
+// candidateFilter возвращает предикат отбора бэкендов для текущего запроса.
+// В обычном режиме это IsAvailable, в panic-режиме - IsEligible.
+// Вызывающий должен удерживать s.mu на чтение.
+func (s *ServerPool) candidateFilter() func(*Backend) bool {
+	if s.panicThreshold <= 0 {
+		return (*Backend).IsAvailable
+	}
+
+	eligible, healthy := s.countEligibleLocked()
+	panicking := eligible > 0 && float64(healthy)*100 < s.panicThreshold*float64(eligible)
+
+	if s.panicking.CompareAndSwap(!panicking, panicking) {
+		if panicking {
+			log.Printf("WARN: Pool %s entered panic mode: %d of %d backends healthy (threshold %.0f%%). Ignoring health status.", s.displayName(), healthy, eligible, s.panicThreshold)
+			poolPanicMode.With(s.displayName()).Set(1)
+		} else {
+			log.Printf("INFO: Pool %s left panic mode: %d of %d backends healthy.", s.displayName(), healthy, eligible)
+			poolPanicMode.With(s.displayName()).Set(0)
+		}
+	}
+
+	if panicking {
+		return (*Backend).IsEligible
+	}
+	return (*Backend).IsAvailable
+}
+
+// AvailableShare возвращает долю доступных бэкендов (от 0 до 1) среди участвующих
+// в балансировке. Если участвующих бэкендов нет, возвращает 0.
+func (s *ServerPool) AvailableShare() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	eligible, healthy := s.countEligibleLocked()
+	if eligible == 0 {
+		return 0
+	}
+	return float64(healthy) / float64(eligible)
+}
+
+// AvailableShare возвращает долю доступных бэкендов (от 0 до 1) среди участвующих
+// в балансировке во всех пулах pools. Если участвующих бэкендов нет, возвращает 0.
+func AvailableShare(pools ...*ServerPool) float64 {
+	var eligible, healthy int
+	for _, s := range pools {
+		s.mu.RLock()
+		e, h := s.countEligibleLocked()
+		s.mu.RUnlock()
+		eligible += e
+		healthy += h
+	}
+	if eligible == 0 {
+		return 0
+	}
+	return float64(healthy) / float64(eligible)
+}
+
+// countEligibleLocked подсчитывает бэкенды, участвующие в балансировке, и доступные среди них.
+// Вызывающий должен удерживать s.mu на чтение.
+func (s *ServerPool) countEligibleLocked() (eligible, healthy int) {
+	for _, b := range s.backends {
+		if !b.IsEligible() {
+			continue
+		}
+		eligible++
+		if b.IsAvailable() {
+			healthy++
+		}
+	}
+	return eligible, healthy
+}
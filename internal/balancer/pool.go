@@ -1,99 +1,371 @@
 package balancer
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
 )
 
+// ErrNoBackends возвращается, если пул не содержит ни одного валидного бэкенда.
+var ErrNoBackends = errors.New("no valid backends configured")
+
 type ctxKey int
 
 const Retry ctxKey = iota
 
 // ServerPool управляет списком доступных бэкендов и выбором следующего бэкенда для обработки запроса.
 type ServerPool struct {
+	name                string // Имя пула в логах и метриках ("" - основной пул).
 	backends            []*Backend
-	current             atomic.Uint64
+	mu                  sync.RWMutex // Защищает срез backends при добавлении/удалении бэкендов.
+	replaceMu           sync.Mutex   // Упорядочивает замены списка бэкендов (см. ReplaceBackends).
+	group               *poolGroup   // Пулы того же балансировщика (см. JoinPools); nil - пул один.
 	healthCheckInterval time.Duration
 	healthCheckTimeout  time.Duration
+	healthCheck         HealthCheckPolicy
+	flapDetection       FlapDetection
+	strategy            Strategy // nil - defaultStrategy (round robin).
+	strategyName        string
+	defaultStrategy     roundRobin
+	panicThreshold      float64     // Порог panic-маршрутизации в процентах (0 - отключено).
+	panicking           atomic.Bool // Пул находится в panic-режиме.
+	// Статические ответы вместо проксирования по префиксам пути, по убыванию длины префикса
+	// (nil - все маршруты проксируются).
+	staticResponses atomic.Pointer[[]*StaticResponse]
+	// Параметры пула соединений к бэкендам.
+	transportSettings TransportSettings
+	// Политика заголовка Host для бэкендов.
+	hostPolicy HostPolicy
+	// Обработка Expect: 100-continue и клиентов HTTP/1.0.
+	protocolPolicy ProtocolPolicy
+	// Сессионная привязка клиентов к бэкендам.
+	sticky StickyPolicy
+	// Окно медленного старта бэкендов, вернувшихся в ротацию (0 - отключено).
+	slowStart time.Duration
+	// Условие готовности после запуска, начало его отсчета и достигнутая готовность.
+	startupGate  StartupGate
+	startupSince time.Time
+	ready        atomic.Bool
+	// Параметры бэкендов, применяемые и к бэкендам, добавленным во время работы (см. AddBackend):
+	// порог медленных запросов и egress-прокси (egressSet - прокси задан через SetEgressProxy).
+	slowRequests SlowRequestPolicy
+	egressProxy  func(*http.Request) (*url.URL, error)
+	egressSet    bool
+	// Ограничения соединений с переключением протокола (см. SetUpgradePolicy).
+	upgradePolicy UpgradePolicy
+	// Изменение пути запросов к бэкендам (см. SetPathRewrites).
+	pathRewrites []PathRewrite
+	// Сигнал циклу проверок о добавлении бэкенда (см. AddBackend).
+	healthWake chan struct{}
+	// Повтор запросов на другом бэкенде при ошибке соединения (см. SetRetryPolicy).
+	retryPolicy RetryPolicy
+	// Административно выключенные бэкенды: имя -> причина (см. SetBackendEnabled).
+	disabled map[string]string
+	// Бэкенды, заданные DNS-именем, и параметры их повторного разрешения (см. RunDNSDiscovery).
+	dnsSources   []*dnsSource
+	dnsDiscovery DNSDiscoveryPolicy
+	// Реестр бэкендов в etcd (nil - не задан, см. RunEtcdRegistry).
+	etcd *etcdRegistry
+	// Файл со списком бэкендов (nil - не задан, см. RunBackendsFile).
+	backendsFile *backendsFile
+}
+
+// BackendSpec описывает бэкенд пула: URL и необязательное стабильное имя.
+// Если имя не задано, используется канонический идентификатор URL (см. CanonicalID).
+type BackendSpec struct {
+	Name   string
+	URL    string
+	MaxRPS float64 // Лимит запросов в секунду к бэкенду (0 - без ограничения).
+	// Лимит одновременных запросов к бэкенду (0 - без ограничения): бэкенд, достигший его,
+	// пропускается при выборе.
+	MaxConns int
+	// Переопределение параметров проверки состояния пула для этого бэкенда.
+	HealthCheck HealthCheckOverride
+	// TLS-настройки соединений с https-бэкендом (пусто - системные корневые сертификаты).
+	TLS BackendTLS
+	// Способ установки соединений с бэкендом (nil - напрямую), например через NewProxyDialer.
+	Dial DialContextFunc
+	// Протокол соединений с бэкендом: ProtocolAuto, ProtocolHTTP1 или ProtocolHTTP2
+	// ("" - протокол пула, см. TransportSettings.Protocol).
+	Protocol string
 }
 
 // NewServerPool создает новый ServerPool с заданными URL бэкендов и параметрами проверки состояния.
+// Бэкенды получают имена по каноническому идентификатору URL. См. NewNamedServerPool.
+func NewServerPool(backendUrls []string, checkInterval, checkTimeout time.Duration) (*ServerPool, error) {
+	specs := make([]BackendSpec, 0, len(backendUrls))
+	for _, u := range backendUrls {
+		specs = append(specs, BackendSpec{URL: u})
+	}
+	return NewNamedServerPool(specs, checkInterval, checkTimeout)
+}
+
+// NewNamedServerPool создает новый ServerPool с заданными бэкендами и параметрами проверки состояния.
 // Он парсит URL, создает ReverseProxy для каждого бэкенда и настраивает обработчик ошибок прокси.
-func NewServerPool(backendUrls []string, checkInterval, checkTimeout time.Duration) *ServerPool {
+// Невалидные URL, дубликаты (с одинаковым CanonicalID) и повторяющиеся имена пропускаются;
+// если не осталось ни одного бэкенда, возвращается ErrNoBackends. Бэкенд с URL dns+http://...
+// (см. DNSDiscoveryPrefix) заменяется бэкендами по адресам имени; пул только из таких бэкендов
+// может быть пустым, пока имена не разрешатся (см. RunDNSDiscovery).
+func NewNamedServerPool(specs []BackendSpec, checkInterval, checkTimeout time.Duration) (*ServerPool, error) {
+	return newServerPool(specs, checkInterval, checkTimeout, false)
+}
+
+// NewDynamicServerPool создает ServerPool так же, как NewNamedServerPool, но допускает пустой
+// пул: бэкенды добавляются во время работы (см. RunEtcdRegistry, SetBackendsFile, AddBackend).
+func NewDynamicServerPool(specs []BackendSpec, checkInterval, checkTimeout time.Duration) (*ServerPool, error) {
+	return newServerPool(specs, checkInterval, checkTimeout, true)
+}
+
+func newServerPool(specs []BackendSpec, checkInterval, checkTimeout time.Duration, allowEmpty bool) (*ServerPool, error) {
 	pool := &ServerPool{
 		backends:            make([]*Backend, 0),
 		healthCheckInterval: checkInterval,
 		healthCheckTimeout:  checkTimeout,
+		healthWake:          make(chan struct{}, 1),
 	}
 
-	for _, backendURLStr := range backendUrls {
-		backendURL, err := url.Parse(backendURLStr)
+	seenIDs := make(map[string]string, len(specs))
+	seenNames := make(map[string]string, len(specs))
+	for _, spec := range pool.expandDNSSpecs(specs) {
+		backend, err := buildBackend(spec)
 		if err != nil {
-			log.Printf("ERROR: Invalid backend URL '%s': %v. Skipping.", backendURLStr, err)
+			log.Printf("ERROR: Invalid backend '%s': %v. Skipping.", spec.URL, err)
+			continue
+		}
+
+		// Дубликаты искажают распределение нагрузки (бэкенд получает кратную долю запросов).
+		id := CanonicalID(backend.URL)
+		if first, ok := seenIDs[id]; ok {
+			log.Printf("WARN: Duplicate backend URL '%s' (same backend as '%s', id %s). Skipping.", spec.URL, first, id)
+			continue
+		}
+		if first, ok := seenNames[backend.Name()]; ok {
+			log.Printf("WARN: Duplicate backend name '%s' for URL '%s' (already used by '%s'). Skipping.", backend.Name(), spec.URL, first)
 			continue
 		}
+		seenIDs[id] = spec.URL
+		seenNames[backend.Name()] = spec.URL
 
-		proxy := httputil.NewSingleHostReverseProxy(backendURL)
+		pool.backends = append(pool.backends, backend)
+		log.Printf("INFO: Added backend %s: %s", backend.Name(), spec.URL)
+	}
 
-		backend := &Backend{
-			URL:          backendURL,
-			Alive:        false,
-			ReverseProxy: proxy,
+	pool.pruneDNSMembers()
+
+	if len(pool.backends) == 0 {
+		switch {
+		case len(pool.dnsSources) > 0:
+			log.Println("WARN: No backends resolved yet. Waiting for DNS discovery.")
+		case allowEmpty:
+			log.Println("INFO: Backend pool is empty. Waiting for backends to be registered.")
+		default:
+			return nil, ErrNoBackends
 		}
+	}
 
-		proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, e error) {
-			log.Printf("ERROR: Proxy error connecting to backend %s: %v", backend.URL, e)
+	return pool, nil
+}
 
-			retries := GetRetryFromContext(request)
-			if retries < 1 {
-				log.Printf("WARN: Marking backend %s as down due to connection error: %v", backend.URL, e)
-				backend.SetAlive(false)
-			} else {
-				log.Printf("WARN: Backend %s connection error on retry %d: %v", backend.URL, retries, e)
-			}
+// buildBackend создает Backend по описанию spec с проверкой URL и параметров бэкенда.
+func buildBackend(spec BackendSpec) (*Backend, error) {
+	backendURL, err := url.Parse(spec.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := validateScheme(backendURL); err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
 
-			http.Error(writer, "Bad Gateway: Error connecting to backend", http.StatusBadGateway)
+	backend := newBackend(backendURL)
+	if spec.Name != "" {
+		backend.id = spec.Name
+	}
+	if spec.MaxRPS > 0 {
+		if err := backend.setRateLimit(spec.MaxRPS); err != nil {
+			return nil, fmt.Errorf("invalid max_rps %.2f: %w", spec.MaxRPS, err)
 		}
+	}
+	if spec.MaxConns < 0 {
+		return nil, fmt.Errorf("invalid max_conns %d: must not be negative", spec.MaxConns)
+	}
+	backend.maxConns = int64(spec.MaxConns)
+	backend.maxRPS = spec.MaxRPS
+	if err := spec.HealthCheck.validate(); err != nil {
+		return nil, fmt.Errorf("invalid health check override: %w", err)
+	}
+	backend.healthOverride = spec.HealthCheck
+	if err := backend.setConnectivity(spec.TLS, spec.Dial); err != nil {
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	if err := validateProtocol(spec.Protocol); err != nil {
+		return nil, err
+	}
+	backend.protocol = spec.Protocol
+	if transport, ok := backend.ReverseProxy.Transport.(*http.Transport); ok {
+		backend.applyProtocol(transport, "")
+	}
+	return backend, nil
+}
 
-		pool.backends = append(pool.backends, backend)
-		log.Printf("INFO: Added backend: %s", backendURLStr)
+// newBackend создает Backend для указанного URL с собственным ReverseProxy и Transport
+// и настраивает обработчик ошибок прокси.
+func newBackend(backendURL *url.URL) *Backend {
+	backend := &Backend{
+		id:         CanonicalID(backendURL),
+		URL:        backendURL,
+		socketPath: unixSocketPath(backendURL),
+		state:      StateUnhealthy,
+		checkState: StateUnhealthy,
+		reason:     "awaiting first health check",
+		stateSince: time.Now(),
+
+		tlsSessions: tls.NewLRUClientSessionCache(0),
+	}
+	proxy := httputil.NewSingleHostReverseProxy(backend.proxyTarget())
+	// Собственный Transport позволяет закрывать простаивающие соединения конкретного бэкенда.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if backend.socketPath != "" {
+		backend.dial = unixDialer(backend.socketPath)
+	} else {
+		backend.proxy = http.ProxyFromEnvironment
 	}
+	backend.applyProxyTransport(transport)
+	proxy.Transport = transport
+	backend.ReverseProxy = proxy
 
-	if len(pool.backends) == 0 {
-		log.Printf("WARN: ServerPool initialized, but contains no valid backends.")
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		rl.RecordUpstreamStatus(resp.Request, resp.StatusCode)
+		if st := retryStateFrom(resp.Request); st != nil {
+			if err := st.retryResponse(resp); err != nil {
+				return err
+			}
+		}
+		backend.setSampledTraceResponse(resp)
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			// ReverseProxy передает данные переключенного соединения через тело ответа
+			// (io.ReadWriteCloser), поэтому оно не оборачивается для учета байт.
+			return nil
+		}
+		return backend.trackResponseBytes(resp)
+	}
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		backend.rewritePath(req)
+		director(req)
+		backend.rewriteHost(req)
+		backend.rewriteExpect(req)
 	}
 
-	return pool
-}
+	proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, e error) {
+		if errors.Is(e, errRetryStatus) {
+			// Бэкенд ответил, поэтому он не считается недоступным; запрос будет повторен.
+			return
+		}
+		log.Printf("ERROR: Proxy error connecting to backend %s: %v", backend.URL, e)
 
-// GetNextPeer выбирает следующий доступный (Alive) бэкенд с использованием Round Robin.
-// Если доступных бэкендов нет, возвращает nil.
-func (s *ServerPool) GetNextPeer() *Backend {
-	numBackends := uint64(len(s.backends))
-	if numBackends == 0 {
-		return nil
+		retries := GetRetryFromContext(request)
+		if retries < 1 {
+			log.Printf("WARN: Marking backend %s as down due to connection error: %v", backend.URL, e)
+			backend.SetAlive(false, "proxy connection error: "+e.Error())
+		} else {
+			log.Printf("WARN: Backend %s connection error on retry %d: %v", backend.URL, retries, e)
+		}
+
+		// Ответ клиенту не отправляется, если запрос будет повторен на другом бэкенде.
+		if st := retryStateFrom(request); st != nil && st.deferError(e) {
+			return
+		}
+		http.Error(writer, "Bad Gateway: Error connecting to backend", http.StatusBadGateway)
 	}
 
-	currentIdx := s.current.Load()
+	return backend
+}
 
-	for i := uint64(0); i < numBackends; i++ {
-		nextIdx := (currentIdx + 1 + i) % numBackends
+// GetNextPeer выбирает следующий бэкенд вне контекста запроса. См. NextPeer.
+func (s *ServerPool) GetNextPeer() *Backend {
+	return s.NextPeer(nil)
+}
 
-		if s.backends[nextIdx].IsAlive() {
-			s.current.Store(nextIdx)
-			return s.backends[nextIdx]
+// NextPeer выбирает для запроса r доступный (Alive и не в режиме drain) бэкенд согласно
+// настроенной стратегии (по умолчанию Round Robin, см. SetStrategy). В panic-режиме
+// (см. SetPanicThreshold) состояние проверок игнорируется. Бэкенды, исчерпавшие свой лимит
+// запросов в секунду или одновременных запросов (см. BackendSpec.MaxRPS и MaxConns),
+// пропускаются - запрос переходит на другой бэкенд.
+// Для запроса с маршрутом (см. WithRoute) выбор ограничен бэкендами маршрута.
+// Если доступных бэкендов нет или все они исчерпали лимиты, возвращает nil.
+func (s *ServerPool) NextPeer(r *http.Request) *Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	isCandidate := s.candidateFilter()
+	candidates := make([]*Backend, 0, len(s.backends))
+	for _, b := range s.backends {
+		if isCandidate(b) && routeAllows(r, b) && !retryExcludes(r, b) {
+			candidates = append(candidates, b)
 		}
 	}
 
+	strategy := s.strategy
+	if strategy == nil {
+		strategy = &s.defaultStrategy
+	}
+	now := time.Now()
+	for len(candidates) > 0 {
+		peer := strategy.Next(candidates, r)
+		if peer == nil {
+			return nil
+		}
+		if !slices.Contains(candidates, peer) {
+			// Пользовательская стратегия вернула бэкенд не из списка кандидатов: он не может
+			// быть исключен из списка, поэтому выбор выполняется стратегией по умолчанию.
+			peer = s.defaultStrategy.Next(candidates, r)
+		}
+		// Бэкенд в медленном старте принимает только часть запросов; последний кандидат
+		// принимает запрос в любом случае. Исчерпавший лимит бэкенд исключается.
+		admitted := len(candidates) == 1 || peer.admitSlowStart(s.slowStart, now)
+		if admitted && peer.hasCapacity() && peer.takeRateToken() {
+			return peer
+		}
+		candidates = slices.DeleteFunc(candidates, func(b *Backend) bool { return b == peer })
+	}
 	return nil
 }
 
+// GetBackends возвращает копию текущего списка бэкендов.
 func (s *ServerPool) GetBackends() []*Backend {
-	return s.backends
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	backends := make([]*Backend, len(s.backends))
+	copy(backends, s.backends)
+	return backends
+}
+
+// GetBackendByName возвращает бэкенд с указанным именем или nil, если такого нет.
+func (s *ServerPool) GetBackendByName(name string) *Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, b := range s.backends {
+		if b.Name() == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// SetFlapDetection задает параметры обнаружения нестабильных бэкендов.
+// Должен вызываться до запуска HealthCheck.
+func (s *ServerPool) SetFlapDetection(fd FlapDetection) {
+	s.flapDetection = fd
 }
 
 // GetRetryFromContext извлекает количество попыток перенаправления из контекста запроса.
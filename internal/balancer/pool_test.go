@@ -1,10 +1,28 @@
 package balancer
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"cloud/load_balancer/internal/metrics"
+	"cloud/load_balancer/internal/sticky"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -12,10 +30,11 @@ import (
 // newTestBackend создает мок Backend для тестов.
 func newTestBackend(rawURL string, alive bool) *Backend {
 	u, _ := url.Parse(rawURL)
-	return &Backend{
-		URL:   u,
-		Alive: alive,
+	b := &Backend{URL: u, state: StateUnhealthy, checkState: StateUnhealthy}
+	if alive {
+		b.SetAlive(true, "test")
 	}
+	return b
 }
 
 // TestServerPool_GetNextPeer_RoundRobin проверяет базовую логику Round Robin.
@@ -91,7 +110,1668 @@ func TestServerPool_GetNextPeer_Empty(t *testing.T) {
 // (Простой тест, просто проверяем, что ErrorHandler не nil)
 func TestServerPool_NewServerPool_ErrorHandler(t *testing.T) {
 	urls := []string{"http://localhost:9999"}
-	pool := NewServerPool(urls, 1*time.Second, 1*time.Second)
+	pool, err := NewServerPool(urls, 1*time.Second, 1*time.Second)
+	require.NoError(t, err)
 	require.Len(t, pool.backends, 1, "Should have one backend")
 	assert.NotNil(t, pool.backends[0].ReverseProxy.ErrorHandler, "ErrorHandler should be set")
 }
+
+// TestServerPool_RemoveBackend_Drain проверяет, что удаляемый бэкенд сразу исключается
+// из выбора, но удаляется из пула только после завершения активных запросов.
+func TestServerPool_RemoveBackend_Drain(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	pool := &ServerPool{backends: []*Backend{b1, b2}}
+
+	b2.activeRequests.Add(1)
+	done, err := pool.RemoveBackend("backend2:8082", 5*time.Second)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		assert.Same(t, b1, pool.GetNextPeer(), "Draining backend must not receive new requests")
+	}
+	assert.Len(t, pool.GetBackends(), 2, "Backend must stay in pool while requests are active")
+
+	b2.activeRequests.Add(-1)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Backend was not removed after active requests completed")
+	}
+	assert.Len(t, pool.GetBackends(), 1)
+	assert.Nil(t, pool.GetBackendByName("backend2:8082"))
+
+	_, err = pool.RemoveBackend("backend2:8082", time.Second)
+	assert.ErrorIs(t, err, ErrBackendNotFound)
+}
+
+// TestServerPool_RemoveBackend_DeletesMetrics проверяет, что серии метрик удаленного бэкенда
+// исчезают из /metrics, а серии остальных бэкендов сохраняются.
+func TestServerPool_RemoveBackend_DeletesMetrics(t *testing.T) {
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "metrics-kept", URL: "http://10.0.0.1:8080"},
+		{Name: "metrics-removed", URL: "http://10.0.0.2:8080"},
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+	for _, name := range []string{"metrics-kept", "metrics-removed"} {
+		backendStateGauge.With(name, "up").Set(1)
+		backendFlapping.With(name).Set(0)
+		backendRateLimitedTotal.With(name).Inc()
+		backendConnectionsTotal.With(name, "new").Inc()
+		backendPhaseDuration.With(name, phaseTTFB).Observe(0.1)
+	}
+
+	done, err := pool.RemoveBackend("metrics-removed", time.Second)
+	require.NoError(t, err)
+	<-done
+
+	var buf bytes.Buffer
+	metrics.Default.WriteText(&buf)
+	assert.NotContains(t, buf.String(), `backend="metrics-removed"`)
+	assert.Contains(t, buf.String(), `lb_backend_state{backend="metrics-kept",state="up"} 1`)
+	assert.Contains(t, buf.String(), `lb_backend_phase_duration_seconds_count{backend="metrics-kept",phase="ttfb"} 1`)
+}
+
+func TestServerPool_ReplaceBackends(t *testing.T) {
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "a", URL: "http://10.0.0.1:8080"},
+		{Name: "b", URL: "http://10.0.0.2:8080"},
+		{Name: "c", URL: "http://10.0.0.3:8080"},
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+	names := func() []string {
+		var result []string
+		for _, b := range pool.GetBackends() {
+			result = append(result, b.Name()+"="+b.URL.Host)
+		}
+		return result
+	}
+
+	_, err = pool.ReplaceBackends([]BackendSpec{{Name: "a", URL: "http://10.0.0.1:8080"}, {Name: "x", URL: "ftp://10.0.0.9"}}, 0)
+	assert.Error(t, err, "Invalid backend")
+	_, err = pool.ReplaceBackends([]BackendSpec{{Name: "a", URL: "http://10.0.0.1:8080"}, {Name: "a", URL: "http://10.0.0.5:8080"}}, 0)
+	assert.ErrorIs(t, err, ErrDuplicateBackend)
+	assert.Equal(t, []string{"a=10.0.0.1:8080", "b=10.0.0.2:8080", "c=10.0.0.3:8080"}, names(), "Invalid list does not change the pool")
+
+	b := pool.GetBackendByName("b")
+	b.activeRequests.Add(1)
+	result, err := pool.ReplaceBackends([]BackendSpec{
+		{Name: "a", URL: "http://10.0.0.1:8080"},
+		{Name: "b", URL: "http://10.0.0.4:8080"},
+		{Name: "d", URL: "http://10.0.0.3:8080"},
+		{Name: "e", URL: "http://10.0.0.5:8080"},
+	}, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, ReplaceResult{Added: []string{"d", "e"}, Updated: []string{"b"}, Removed: []string{"c"}, Unchanged: []string{"a"}}, result)
+	assert.Equal(t, StateDraining, b.State().State)
+	assert.Contains(t, names(), "e=10.0.0.5:8080", "New backend is added immediately")
+
+	b.activeRequests.Add(-1)
+	assert.Eventually(t, func() bool { return len(pool.GetBackends()) == 4 && pool.GetBackendByName("d") != nil },
+		2*time.Second, 10*time.Millisecond, "Replaced backends are added after drain")
+	assert.ElementsMatch(t, []string{"a=10.0.0.1:8080", "b=10.0.0.4:8080", "d=10.0.0.3:8080", "e=10.0.0.5:8080"}, names())
+
+	result, err = pool.ReplaceBackends([]BackendSpec{{Name: "a", URL: "http://10.0.0.1:8080"}}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, result.Unchanged)
+	assert.ElementsMatch(t, []string{"b", "d", "e"}, result.Removed)
+}
+
+// TestServerPool_ReplaceBackends_UpdateInPlace проверяет, что изменение только лимитов и
+// протокола применяется к бэкенду без drain: он продолжает обслуживать запросы.
+func TestServerPool_ReplaceBackends_UpdateInPlace(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}))
+	upstream.Config.Protocols = new(http.Protocols)
+	upstream.Config.Protocols.SetHTTP1(true)
+	upstream.Config.Protocols.SetUnencryptedHTTP2(true)
+	upstream.Start()
+	defer upstream.Close()
+
+	pool, err := NewNamedServerPool([]BackendSpec{{Name: "a", URL: upstream.URL}}, time.Second, time.Second)
+	require.NoError(t, err)
+	backend := pool.GetBackends()[0]
+	backend.SetAlive(true, "test")
+	handler := NewLoadBalancerHandler(pool)
+	proto := func() string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	assert.Equal(t, "HTTP/1.1", proto())
+
+	backend.activeRequests.Add(1)
+	result, err := pool.ReplaceBackends([]BackendSpec{{Name: "a", URL: upstream.URL, MaxRPS: 100, MaxConns: 5, Protocol: ProtocolHTTP2}}, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, result.Updated)
+	assert.Equal(t, StateHealthy, backend.State().State, "Backend is not drained")
+	assert.Equal(t, []*Backend{backend}, pool.GetBackends())
+	assert.Equal(t, 100.0, backend.MaxRPS())
+	assert.Equal(t, int64(5), backend.MaxConns())
+	assert.Equal(t, ProtocolHTTP2, backend.Protocol())
+	assert.Equal(t, "HTTP/2.0", proto(), "Backend keeps serving with the new protocol")
+	backend.activeRequests.Add(-1)
+
+	result, err = pool.ReplaceBackends([]BackendSpec{{Name: "a", URL: upstream.URL, MaxConns: 1}}, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, result.Updated)
+	assert.Equal(t, 0.0, backend.MaxRPS())
+	assert.Equal(t, "HTTP/1.1", proto())
+	backend.activeRequests.Add(1)
+	assert.Nil(t, pool.GetNextPeer(), "New max_conns is applied")
+	backend.activeRequests.Add(-1)
+}
+
+func TestServerPool_DrainBackend(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	pool := &ServerPool{backends: []*Backend{b1, b2}}
+
+	b2.activeRequests.Add(1)
+	done, err := pool.DrainBackend("backend2:8082", 5*time.Second, "deploy")
+	require.NoError(t, err)
+	assert.Equal(t, StateDraining, b2.State().State)
+	for i := 0; i < 4; i++ {
+		assert.Same(t, b1, pool.GetNextPeer(), "Draining backend must not receive new requests")
+	}
+	_, complete := b2.DrainStatus()
+	assert.False(t, complete, "Drain is not complete while requests are active")
+	_, err = pool.DrainBackend("backend2:8082", time.Second, "again")
+	assert.ErrorIs(t, err, ErrBackendDraining)
+
+	b2.activeRequests.Add(-1)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Drain did not complete after active requests completed")
+	}
+	draining, complete := b2.DrainStatus()
+	assert.True(t, draining && complete)
+	assert.Len(t, pool.GetBackends(), 2, "Drained backend stays in pool")
+
+	require.NoError(t, pool.UndrainBackend("backend2:8082", "deployed"))
+	assert.Equal(t, StateHealthy, b2.State().State)
+	assert.ErrorIs(t, pool.UndrainBackend("backend2:8082", "again"), ErrBackendNotDraining)
+
+	// Удаление бэкенда в режиме drain запрещает возврат в ротацию.
+	_, err = pool.DrainBackend("backend2:8082", time.Hour, "deploy")
+	require.NoError(t, err)
+	removed, err := pool.RemoveBackend("backend2:8082", time.Second)
+	require.NoError(t, err)
+	assert.ErrorIs(t, pool.UndrainBackend("backend2:8082", "deployed"), ErrBackendRemoving)
+	<-removed
+	assert.Nil(t, pool.GetBackendByName("backend2:8082"))
+}
+
+// TestServerPool_GetNextPeer_LeastBytes проверяет выбор бэкенда с наименьшим объемом передаваемых данных.
+func TestServerPool_GetNextPeer_LeastBytes(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	b3 := newTestBackend("http://backend3:8083", false)
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3}}
+	require.NoError(t, pool.SetStrategy(StrategyLeastBytes))
+
+	b1.outstandingBytes.Add(10 << 20)
+	b2.outstandingBytes.Add(1 << 10)
+	assert.Same(t, b2, pool.GetNextPeer(), "Backend with fewer outstanding bytes should be chosen")
+
+	resp := &http.Response{ContentLength: 20 << 20, Body: io.NopCloser(strings.NewReader(""))}
+	require.NoError(t, b2.trackResponseBytes(resp))
+	assert.Same(t, b1, pool.GetNextPeer(), "Streaming response should shift traffic away")
+
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, int64(1<<10), b2.OutstandingBytes(), "Closed response should release its bytes")
+
+	assert.Error(t, pool.SetStrategy("unknown"))
+}
+
+// TestServerPool_GetNextPeer_LeastConnections проверяет выбор бэкенда с наименьшим числом
+// активных запросов и чередование бэкендов с равной нагрузкой.
+func TestServerPool_GetNextPeer_LeastConnections(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	b3 := newTestBackend("http://backend3:8083", false)
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3}}
+	require.NoError(t, pool.SetStrategy(StrategyLeastConnections))
+
+	b1.activeRequests.Add(3)
+	b2.activeRequests.Add(1)
+	assert.Same(t, b2, pool.GetNextPeer(), "Backend with fewer active requests should be chosen")
+
+	b2.activeRequests.Add(2)
+	first, second := pool.GetNextPeer(), pool.GetNextPeer()
+	assert.NotSame(t, first, second, "Equally loaded backends should alternate")
+	assert.NotSame(t, b3, first, "Unavailable backend must not be chosen")
+	assert.NotSame(t, b3, second, "Unavailable backend must not be chosen")
+}
+
+// TestServerPool_GetNextPeer_P2C проверяет, что из двух кандидатов выбирается менее
+// загруженный, а недоступные бэкенды не выбираются.
+func TestServerPool_GetNextPeer_P2C(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	b3 := newTestBackend("http://backend3:8083", false)
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3}}
+	require.NoError(t, pool.SetStrategy(StrategyP2C))
+
+	b1.activeRequests.Add(5)
+	for i := 0; i < 20; i++ {
+		assert.Same(t, b2, pool.GetNextPeer(), "Less loaded of the two available backends should be chosen")
+	}
+
+	b2.SetAlive(false, "test")
+	assert.Same(t, b1, pool.GetNextPeer(), "Single available backend should be chosen")
+}
+
+// TestServerPool_GetNextPeer_Random проверяет, что случайный выбор затрагивает все доступные
+// бэкенды и не выбирает недоступные.
+func TestServerPool_GetNextPeer_Random(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	b3 := newTestBackend("http://backend3:8083", false)
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3}}
+	require.NoError(t, pool.SetStrategy(StrategyRandom))
+
+	seen := make(map[*Backend]int)
+	for i := 0; i < 200; i++ {
+		seen[pool.GetNextPeer()]++
+	}
+	assert.Zero(t, seen[b3], "Unavailable backend must not be chosen")
+	assert.Positive(t, seen[b1])
+	assert.Positive(t, seen[b2])
+}
+
+// TestServerPool_GetNextPeer_LeastResponseTime проверяет выбор бэкенда с наименьшей
+// средней задержкой и приоритет бэкендов без замеров.
+func TestServerPool_GetNextPeer_LeastResponseTime(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	b3 := newTestBackend("http://backend3:8083", true)
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3}}
+	require.NoError(t, pool.SetStrategy(StrategyLeastResponseTime))
+
+	b1.observeLatency(200 * time.Millisecond)
+	b2.observeLatency(50 * time.Millisecond)
+	assert.Same(t, b3, pool.GetNextPeer(), "Backend without samples should be tried first")
+
+	b3.observeLatency(100 * time.Millisecond)
+	assert.Same(t, b2, pool.GetNextPeer())
+
+	for i := 0; i < 10; i++ {
+		b2.observeLatency(time.Second)
+	}
+	assert.Same(t, b3, pool.GetNextPeer(), "Growing latency should shift traffic away")
+	assert.Equal(t, StrategyLeastResponseTime, pool.StrategyName())
+}
+
+// TestServerPool_CustomStrategy проверяет регистрацию пользовательской стратегии,
+// которая получает только доступных кандидатов и сам запрос.
+func TestServerPool_CustomStrategy(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", false)
+	b3 := newTestBackend("http://backend3:8083", true)
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3}}
+	// Бэкенд не из пула, исчерпавший лимит одновременных запросов.
+	foreign := newTestBackend("http://backend4:8084", true)
+	foreign.maxConns = 1
+	foreign.activeRequests.Add(1)
+
+	require.NoError(t, RegisterStrategy("test_header", func() Strategy {
+		return StrategyFunc(func(backends []*Backend, r *http.Request) *Backend {
+			assert.NotContains(t, backends, b2, "Unavailable backends must not be offered")
+			if r != nil && r.Header.Get("X-Backend") == "last" {
+				return backends[len(backends)-1]
+			}
+			if r != nil && r.Header.Get("X-Backend") == "foreign" {
+				return foreign
+			}
+			return backends[0]
+		})
+	}))
+	assert.Error(t, RegisterStrategy("test_header", func() Strategy { return nil }), "Duplicate name must be rejected")
+	assert.Contains(t, Strategies(), "test_header")
+	require.NoError(t, pool.SetStrategy("test_header"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Same(t, b1, pool.NextPeer(req))
+	req.Header.Set("X-Backend", "last")
+	assert.Same(t, b3, pool.NextPeer(req))
+	req.Header.Set("X-Backend", "foreign")
+	assert.Contains(t, []*Backend{b1, b3}, pool.NextPeer(req), "Backend outside the candidates falls back to round robin")
+}
+
+// TestServerPool_NewServerPool_NoBackends проверяет ошибку при отсутствии валидных бэкендов.
+func TestServerPool_NewServerPool_NoBackends(t *testing.T) {
+	pool, err := NewServerPool([]string{"://invalid"}, time.Second, time.Second)
+	assert.ErrorIs(t, err, ErrNoBackends)
+	assert.Nil(t, pool)
+}
+
+// TestServerPool_SetBackendEnabled проверяет, что административное отключение не сбрасывается
+// проверками состояния, сохраняется для бэкенда, который источник добавил заново с тем же
+// именем, и снимается при удалении бэкенда через RemoveBackend и ReplaceBackends.
+func TestServerPool_SetBackendEnabled(t *testing.T) {
+	pool, err := NewDynamicServerPool(nil, time.Second, time.Second)
+	require.NoError(t, err)
+	backend, err := pool.AddBackend(BackendSpec{Name: "app-1", URL: "http://backend1:8081"})
+	require.NoError(t, err)
+	backend.SetAlive(true, "test")
+
+	require.NoError(t, pool.SetBackendEnabled("app-1", false, "maintenance"))
+	backend.SetAlive(true, "health check passed")
+	assert.Equal(t, StateAdminDown, backend.State().State)
+	assert.True(t, backend.AdminDown())
+	assert.Nil(t, pool.GetNextPeer(), "Disabled backend must not receive traffic")
+
+	// Источник бэкендов заменяет бэкенд: флаг сохраняется по имени.
+	removed, err := pool.removeBackend("app-1", time.Second, false)
+	require.NoError(t, err)
+	<-removed
+	backend, err = pool.AddBackend(BackendSpec{Name: "app-1", URL: "http://backend1:9091"})
+	require.NoError(t, err)
+	backend.SetAlive(true, "test")
+	assert.Equal(t, StateAdminDown, backend.State().State)
+	assert.Equal(t, "maintenance", backend.State().Reason)
+
+	require.NoError(t, pool.SetBackendEnabled("app-1", true, "maintenance finished"))
+	assert.Equal(t, StateHealthy, backend.State().State)
+	assert.Same(t, backend, pool.GetNextPeer())
+	assert.ErrorIs(t, pool.SetBackendEnabled("app-2", false, ""), ErrBackendNotFound)
+
+	require.NoError(t, pool.SetBackendEnabled("app-1", false, "maintenance"))
+	removed, err = pool.RemoveBackend("app-1", time.Second)
+	require.NoError(t, err)
+	<-removed
+	backend, err = pool.AddBackend(BackendSpec{Name: "app-1", URL: "http://backend1:8081"})
+	require.NoError(t, err)
+	assert.False(t, backend.AdminDown(), "RemoveBackend clears the flag")
+
+	require.NoError(t, pool.SetBackendEnabled("app-1", false, "maintenance"))
+	_, err = pool.ReplaceBackends([]BackendSpec{{Name: "app-2", URL: "http://backend2:8082"}}, time.Second)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return pool.GetBackendByName("app-1") == nil }, time.Second, 10*time.Millisecond)
+	backend, err = pool.AddBackend(BackendSpec{Name: "app-1", URL: "http://backend1:8081"})
+	require.NoError(t, err)
+	assert.False(t, backend.AdminDown(), "Removal by ReplaceBackends clears the flag")
+}
+
+// TestServerPool_GetNextPeer_PanicMode проверяет, что при доле здоровых бэкендов ниже
+// порога трафик распределяется по всем бэкендам, кроме выведенных администратором.
+func TestServerPool_GetNextPeer_PanicMode(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", false)
+	b3 := newTestBackend("http://backend3:8083", false)
+	b4 := newTestBackend("http://backend4:8084", true)
+	b4.SetAdminDown(true, "test")
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3, b4}}
+	pool.SetName("panic-test")
+	panicMetric := func() string {
+		var buf bytes.Buffer
+		metrics.Default.WriteText(&buf)
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, `lb_pool_panic_mode{pool="panic-test"}`) {
+				return line
+			}
+		}
+		return ""
+	}
+
+	pool.SetPanicThreshold(50)
+	results := make(map[*Backend]int)
+	for i := 0; i < 6; i++ {
+		results[pool.GetNextPeer()]++
+	}
+	assert.Equal(t, 2, results[b1])
+	assert.Equal(t, 2, results[b2])
+	assert.Equal(t, 2, results[b3])
+	assert.Zero(t, results[b4], "Admin-down backend must not receive traffic even in panic mode")
+	assert.Equal(t, `lb_pool_panic_mode{pool="panic-test"} 1`, panicMetric())
+
+	b2.SetAlive(true, "recovered")
+	for i := 0; i < 4; i++ {
+		peer := pool.GetNextPeer()
+		assert.NotSame(t, b3, peer, "Unhealthy backend must not be used after leaving panic mode")
+	}
+	assert.Equal(t, `lb_pool_panic_mode{pool="panic-test"} 0`, panicMetric())
+}
+
+// TestServerPool_TransportSettings проверяет применение параметров пула соединений к бэкендам.
+func TestServerPool_TransportSettings(t *testing.T) {
+	pool, err := NewServerPool([]string{"http://backend1:8081"}, time.Second, time.Second)
+	require.NoError(t, err)
+
+	pool.SetTransportSettings(TransportSettings{MaxIdleConnsPerHost: 16, IdleConnTimeout: 30 * time.Second})
+	transport := pool.GetBackends()[0].ReverseProxy.Transport.(*http.Transport)
+	assert.Equal(t, 16, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 30*time.Second, transport.IdleConnTimeout)
+	assert.Equal(t, 0, transport.MaxConnsPerHost)
+	assert.Equal(t, 10*time.Second, transport.TLSHandshakeTimeout, "Default of http.DefaultTransport")
+
+	require.NoError(t, pool.SetTransportSettings(TransportSettings{
+		TLSHandshakeTimeout: 2 * time.Second,
+		DialTimeout:         50 * time.Millisecond,
+		DisableKeepAlives:   true,
+	}))
+	assert.Equal(t, 2*time.Second, transport.TLSHandshakeTimeout)
+	assert.True(t, transport.DisableKeepAlives)
+	// Таймаут установки соединения ограничивает и dial, заданный для бэкенда.
+	hanging := pool.GetBackends()[0].countConnections(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	started := time.Now()
+	_, err = hanging(context.Background(), "tcp", "backend1:8081")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), time.Second)
+
+	assert.NoError(t, pool.CloseIdleConnections("backend1:8081"))
+	assert.ErrorIs(t, pool.CloseIdleConnections("unknown:1"), ErrBackendNotFound)
+}
+
+// TestServerPool_HostPolicy проверяет формирование заголовка Host для бэкенда в разных режимах.
+func TestServerPool_HostPolicy(t *testing.T) {
+	var gotHost, gotForwardedHost string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotForwardedHost = r.Host, r.Header.Get("X-Forwarded-Host")
+	}))
+	defer upstream.Close()
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+
+	pool, err := NewServerPool([]string{upstream.URL}, time.Second, time.Second)
+	require.NoError(t, err)
+	backend := pool.GetBackends()[0]
+
+	tests := []struct {
+		policy        HostPolicy
+		wantHost      string
+		wantForwarded string
+	}{
+		{HostPolicy{Mode: HostPreserve}, "client.example.com", ""},
+		{HostPolicy{Mode: HostBackend}, upstreamHost, "client.example.com"},
+		{HostPolicy{Mode: HostFixed, Override: "internal.example.com"}, "internal.example.com", "client.example.com"},
+	}
+	for _, tt := range tests {
+		require.NoError(t, pool.SetHostPolicy(tt.policy))
+		req := httptest.NewRequest(http.MethodGet, "http://client.example.com/", nil)
+		backend.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, tt.wantHost, gotHost, "mode %s", tt.policy.Mode)
+		assert.Equal(t, tt.wantForwarded, gotForwardedHost, "mode %s", tt.policy.Mode)
+	}
+
+	assert.Error(t, pool.SetHostPolicy(HostPolicy{Mode: HostFixed}))
+	assert.Error(t, pool.SetHostPolicy(HostPolicy{Mode: "rewrite"}))
+}
+
+// TestNewServerPool_DeduplicatesBackends проверяет, что URL одного и того же бэкенда
+// в разной записи добавляются в пул один раз и получают канонический идентификатор.
+func TestNewServerPool_DeduplicatesBackends(t *testing.T) {
+	pool, err := NewServerPool([]string{
+		"http://Backend1",
+		"http://backend1:80/",
+		"https://backend1",
+		"http://backend2:8082",
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+
+	backends := pool.GetBackends()
+	require.Len(t, backends, 3)
+	assert.Equal(t, "backend1:80", backends[0].Name())
+	assert.Equal(t, "backend1:443", backends[1].Name())
+	assert.Equal(t, "backend2:8082", backends[2].Name())
+	assert.Same(t, backends[0], pool.GetBackendByName("backend1:80"))
+}
+
+// TestNewNamedServerPool проверяет, что заданные в конфигурации имена используются
+// как идентификаторы бэкендов, а повторяющиеся имена пропускаются.
+func TestNewNamedServerPool(t *testing.T) {
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "api-1", URL: "http://10.0.0.1:8081"},
+		{URL: "http://10.0.0.2:8082"},
+		{Name: "api-1", URL: "http://10.0.0.3:8083"},
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+
+	backends := pool.GetBackends()
+	require.Len(t, backends, 2)
+	assert.Equal(t, "api-1", backends[0].Name())
+	assert.Equal(t, "10.0.0.2:8082", backends[1].Name())
+	assert.Equal(t, "10.0.0.1:8081", pool.GetBackendByName("api-1").URL.Host)
+}
+
+// TestServerPool_BackendMaxRPS проверяет, что запросы сверх лимита бэкенда
+// переходят на другие бэкенды, а при исчерпании всех лимитов бэкенд не выбирается.
+func TestServerPool_BackendMaxRPS(t *testing.T) {
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "fragile", URL: "http://backend1:8081", MaxRPS: 1},
+		{Name: "sturdy", URL: "http://backend2:8082", MaxRPS: 2},
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+	for _, b := range pool.GetBackends() {
+		b.SetAlive(true, "test")
+	}
+
+	picked := map[string]int{}
+	for i := 0; i < 3; i++ {
+		peer := pool.GetNextPeer()
+		require.NotNil(t, peer)
+		picked[peer.Name()]++
+	}
+	assert.Equal(t, map[string]int{"fragile": 1, "sturdy": 2}, picked)
+	assert.Nil(t, pool.GetNextPeer(), "All backends exhausted their max_rps")
+}
+
+// TestServerPool_BackendMaxConns проверяет, что бэкенд, достигший лимита одновременных
+// запросов, пропускается, а при насыщении всех бэкендов бэкенд не выбирается.
+func TestServerPool_BackendMaxConns(t *testing.T) {
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "small", URL: "http://backend1:8081", MaxConns: 1},
+		{Name: "large", URL: "http://backend2:8082", MaxConns: 2},
+	}, time.Second, time.Second)
+	require.NoError(t, err)
+	for _, b := range pool.GetBackends() {
+		b.SetAlive(true, "test")
+	}
+	small, large := pool.GetBackendByName("small"), pool.GetBackendByName("large")
+
+	small.activeRequests.Add(1)
+	for i := 0; i < 3; i++ {
+		assert.Same(t, large, pool.GetNextPeer(), "Saturated backend spills over to the next one")
+	}
+	large.activeRequests.Add(2)
+	assert.Nil(t, pool.GetNextPeer(), "All backends are saturated")
+
+	small.activeRequests.Add(-1)
+	assert.Same(t, small, pool.GetNextPeer())
+
+	_, err = NewNamedServerPool([]BackendSpec{{URL: "http://backend1:8081", MaxConns: -1}}, time.Second, time.Second)
+	assert.Error(t, err)
+}
+
+// TestServerPool_ProtocolPolicy проверяет локальный ответ на Expect: 100-continue
+// и принудительное закрытие соединений клиентов HTTP/1.0.
+func TestServerPool_ProtocolPolicy(t *testing.T) {
+	var gotExpect string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotExpect = r.Header.Get("Expect")
+	}))
+	defer upstream.Close()
+
+	pool, err := NewServerPool([]string{upstream.URL}, time.Second, time.Second)
+	require.NoError(t, err)
+	pool.GetBackends()[0].SetAlive(true, "test")
+	require.NoError(t, pool.SetProtocolPolicy(ProtocolPolicy{ExpectContinue: ExpectLocal, HTTP10Connection: HTTP10Close}))
+	handler := NewLoadBalancerHandler(pool)
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("payload"))
+	req.Header.Set("Expect", "100-continue")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, gotExpect, "Expect must not be forwarded in local mode")
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "close", rr.Header().Get("Connection"))
+
+	assert.Error(t, pool.SetProtocolPolicy(ProtocolPolicy{ExpectContinue: "drop"}))
+}
+
+// TestLoadBalancerHandler_Sticky проверяет привязку клиента к бэкенду через cookie
+// (в самой cookie и через хранилище сессий) и перепривязку при недоступности бэкенда.
+func TestLoadBalancerHandler_Sticky(t *testing.T) {
+	var urls []string
+	urlByName := make(map[string]string)
+	for _, name := range []string{"a", "b"} {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		}))
+		defer upstream.Close()
+		urls = append(urls, upstream.URL)
+		urlByName[name] = upstream.URL
+	}
+
+	memoryStore := sticky.NewMemoryStore()
+	defer memoryStore.Close()
+	for _, store := range []sticky.SessionStore{nil, memoryStore} {
+		pool, err := NewServerPool(urls, time.Minute, time.Second)
+		require.NoError(t, err)
+		for _, b := range pool.GetBackends() {
+			b.SetAlive(true, "test")
+		}
+		codec, err := sticky.NewCodec("signed", "secret")
+		require.NoError(t, err)
+		require.NoError(t, pool.SetStickyPolicy(StickyPolicy{Enabled: true, Codec: codec, Store: store}))
+		handler := NewLoadBalancerHandler(pool)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, DefaultStickyCookie, cookies[0].Name)
+		first := rec.Body.String()
+
+		for i := 0; i < 5; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(cookies[0])
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, first, rec.Body.String(), "Request with cookie should reach the bound backend")
+			assert.Empty(t, rec.Result().Cookies(), "Cookie should not be reissued for a valid binding")
+		}
+
+		for _, b := range pool.GetBackends() {
+			if b.URL.String() == urlByName[first] {
+				b.SetAlive(false, "test")
+			}
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.NotEqual(t, first, rec.Body.String(), "Unavailable bound backend should be replaced")
+		assert.Len(t, rec.Result().Cookies(), 1, "Cookie should be reissued for the new backend")
+	}
+}
+
+// TestServerPool_HashOn проверяет, что запросы с одинаковым значением заголовка попадают
+// на один бэкенд, запросы без заголовка распределяются стратегией, а при недоступности
+// бэкенда его ключи переходят на другие.
+func TestServerPool_HashOn(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	b3 := newTestBackend("http://backend3:8083", true)
+	pool := &ServerPool{backends: []*Backend{b1, b2, b3}}
+	require.NoError(t, pool.SetHashOn("header:X-Tenant-ID"))
+	assert.Error(t, pool.SetHashOn("cookie:id"))
+
+	request := func(tenant string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant-ID", tenant)
+		}
+		return r
+	}
+
+	chosen := make(map[string]*Backend)
+	used := make(map[*Backend]bool)
+	for i := 0; i < 20; i++ {
+		tenant := fmt.Sprintf("tenant-%d", i)
+		peer := pool.NextPeer(request(tenant))
+		chosen[tenant] = peer
+		used[peer] = true
+		assert.Same(t, peer, pool.NextPeer(request(tenant)), "Same key should map to the same backend")
+	}
+	assert.Greater(t, len(used), 1, "Keys should be spread across backends")
+
+	first, second := pool.NextPeer(request("")), pool.NextPeer(request(""))
+	assert.NotSame(t, first, second, "Requests without key should use round robin")
+
+	b1.SetAlive(false, "test")
+	for tenant, peer := range chosen {
+		next := pool.NextPeer(request(tenant))
+		assert.NotSame(t, b1, next)
+		if peer != b1 {
+			assert.Same(t, peer, next, "Keys of available backends should not move")
+		}
+	}
+}
+
+// TestServerPool_GetNextPeer_SlowStart проверяет, что бэкенд, вернувшийся в ротацию,
+// получает постепенно растущую долю трафика, а впервые запущенный - полную сразу.
+func TestServerPool_GetNextPeer_SlowStart(t *testing.T) {
+	b1 := newTestBackend("http://backend1:8081", true)
+	b2 := newTestBackend("http://backend2:8082", true)
+	pool := &ServerPool{backends: []*Backend{b1, b2}}
+	pool.SetSlowStart(10 * time.Second)
+	assert.Equal(t, 1.0, pool.SlowStartWeight(b2), "Backend serving since startup is not in slow start")
+
+	b2.SetAlive(false, "test")
+	b2.SetAlive(true, "test")
+	count := func() int {
+		n := 0
+		for i := 0; i < 1000; i++ {
+			if pool.GetNextPeer() == b2 {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Less(t, count(), 50, "Backend that just returned must get almost no traffic")
+
+	b2.mux.Lock()
+	b2.servingSince = time.Now().Add(-5 * time.Second)
+	b2.mux.Unlock()
+	assert.InDelta(t, 0.5, pool.SlowStartWeight(b2), 0.05)
+	assert.InDelta(t, 250, count(), 100, "Half-way through the window backend gets about half its share")
+
+	b2.mux.Lock()
+	b2.servingSince = time.Now().Add(-11 * time.Second)
+	b2.mux.Unlock()
+	assert.Equal(t, 1.0, pool.SlowStartWeight(b2))
+	assert.Equal(t, 500, count(), "After the window backend gets its full round-robin share")
+
+	b1.SetAlive(false, "test")
+	b2.mux.Lock()
+	b2.servingSince = time.Now()
+	b2.mux.Unlock()
+	assert.Same(t, b2, pool.GetNextPeer(), "The only available backend takes requests during slow start")
+}
+
+// TestServerPool_UnixSocketBackend проверяет проксирование и проверку состояния бэкенда,
+// доступного через Unix domain socket.
+func TestServerPool_UnixSocketBackend(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "unix %s", r.URL.Path)
+	}))
+	upstream.Listener = ln
+	upstream.Start()
+	defer upstream.Close()
+
+	pool, err := NewServerPool([]string{"unix://" + socket, "unix://"}, time.Second, time.Second)
+	require.NoError(t, err)
+	require.Len(t, pool.GetBackends(), 1, "URL without socket path is skipped")
+	backend := pool.GetBackends()[0]
+	assert.Equal(t, "unix:"+socket, backend.Name())
+
+	state, _ := probeBackend(backend, time.Second)
+	assert.Equal(t, StateHealthy, state)
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/healthz"}))
+	state, _ = probeBackendHTTP(backend, pool.healthCheck, time.Second)
+	assert.Equal(t, StateHealthy, state)
+
+	backend.SetAlive(true, "test")
+	rr := httptest.NewRecorder()
+	NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "unix /orders", rr.Body.String())
+}
+
+// TestServerPool_Retry проверяет повтор запроса на другом бэкенде: при ошибке соединения -
+// любого запроса, при обрыве соединения после отправки - только идемпотентного. Тело, не
+// поместившееся в память, сохраняется во временный файл, который удаляется после обработки;
+// запрос с телом больше MaxBodyBytes, уже отправленным бэкенду, не повторяется.
+func TestServerPool_Retry(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "got %s", body)
+	}))
+	defer upstream.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadURL := "http://" + ln.Addr().String()
+	ln.Close()
+	// Бэкенд, который читает запрос и закрывает соединение, не отвечая.
+	resetLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer resetLn.Close()
+	go func() {
+		for {
+			conn, err := resetLn.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			_, _ = io.Copy(io.Discard, conn)
+			conn.Close()
+		}
+	}()
+	resetURL := "http://" + resetLn.Addr().String()
+
+	dir := t.TempDir()
+	serve := func(failing string, maxBody int64, method string) *httptest.ResponseRecorder {
+		pool, err := NewNamedServerPool([]BackendSpec{{Name: "failing", URL: failing}, {Name: "live", URL: upstream.URL}}, time.Second, time.Second)
+		require.NoError(t, err)
+		for _, b := range pool.GetBackends() {
+			b.SetAlive(true, "test")
+		}
+		pool.SetRetryPolicy(RetryPolicy{MaxRetries: 1, MemoryBufferBytes: 4, MaxBodyBytes: maxBody, TempDir: dir})
+		rr := httptest.NewRecorder()
+		NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(method, "/upload", strings.NewReader("payload-0123456789")))
+		assert.False(t, pool.GetBackendByName("failing").IsAlive(), "Request was sent to the failing backend first")
+		return rr
+	}
+
+	rr := serve(deadURL, 8, http.MethodPost)
+	assert.Equal(t, http.StatusOK, rr.Code, "Request that did not reach the backend is retried")
+	assert.Equal(t, "got payload-0123456789", rr.Body.String())
+
+	rr = serve(resetURL, 1<<20, http.MethodPut)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "got payload-0123456789", rr.Body.String(), "Body is replayed from memory and temporary file")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "Spilled body is removed")
+
+	assert.Equal(t, http.StatusBadGateway, serve(resetURL, 1<<20, http.MethodPost).Code, "Non-idempotent request is not retried")
+	assert.Equal(t, http.StatusBadGateway, serve(resetURL, 8, http.MethodPut).Code, "Body larger than max_body_bytes is not retried")
+}
+
+func TestServerPool_RetryOnStatus(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "got %s", body)
+	}))
+	defer upstream.Close()
+
+	serve := func(method string, maxRetries int, live bool) *httptest.ResponseRecorder {
+		pool, err := NewNamedServerPool([]BackendSpec{{Name: "unavailable", URL: unavailable.URL}, {Name: "live", URL: upstream.URL}}, time.Second, time.Second)
+		require.NoError(t, err)
+		pool.GetBackendByName("unavailable").SetAlive(true, "test")
+		pool.GetBackendByName("live").SetAlive(live, "test")
+		pool.SetRetryPolicy(RetryPolicy{MaxRetries: maxRetries, MemoryBufferBytes: 1 << 10, MaxBodyBytes: 1 << 20, RetryStatuses: []int{http.StatusServiceUnavailable}})
+		rr := httptest.NewRecorder()
+		NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(method, "/items", strings.NewReader("payload")))
+		assert.True(t, pool.GetBackendByName("unavailable").IsAlive(), "Backend that responded is not marked down")
+		return rr
+	}
+
+	rr := serve(http.MethodPut, 1, true)
+	assert.Equal(t, http.StatusOK, rr.Code, "Idempotent request is retried on a configured status")
+	assert.Equal(t, "got payload", rr.Body.String())
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodPost, 1, true).Code, "Non-idempotent request gets the backend response")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodPut, 0, true).Code, "Retries disabled")
+	rr = serve(http.MethodPut, 1, false)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "No backend left for the retry: the backend response is passed through")
+	assert.Equal(t, "overloaded\n", rr.Body.String())
+}
+
+// TestReplayableBody проверяет буфер тела запроса: тело, не поместившееся в память,
+// сохраняется во временный файл и отправляется повторно целиком; чтение прежней попыткой
+// после rewind запрещено; тело больше maxBytes не запоминается.
+func TestReplayableBody(t *testing.T) {
+	dir := t.TempDir()
+	body := newReplayableBody(strings.NewReader("payload-0123456789"), 4, 1<<20, dir)
+	first := body.attempt()
+	partial := make([]byte, 8)
+	_, err := io.ReadFull(first, partial)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "Body beyond the memory limit is spilled to a temporary file")
+
+	require.True(t, body.rewind())
+	_, err = first.Read(partial)
+	assert.ErrorIs(t, err, errStaleAttempt, "Previous attempt cannot read after rewind")
+	replayed, err := io.ReadAll(body.attempt())
+	require.NoError(t, err)
+	assert.Equal(t, "payload-0123456789", string(replayed), "Body is replayed from memory, the file and the source")
+
+	body.release()
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "Spilled body is removed")
+
+	large := newReplayableBody(strings.NewReader("payload-0123456789"), 4, 8, dir)
+	sent, err := io.ReadAll(large.attempt())
+	require.NoError(t, err)
+	assert.Equal(t, "payload-0123456789", string(sent), "Body larger than maxBytes is still sent")
+	assert.False(t, large.replayable())
+	assert.False(t, large.rewind(), "Body larger than maxBytes cannot be replayed")
+}
+
+func TestPoolRouter(t *testing.T) {
+	newPool := func(name string) *ServerPool {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+		}))
+		t.Cleanup(upstream.Close)
+		pool, err := NewNamedServerPool([]BackendSpec{{Name: name, URL: upstream.URL}}, time.Second, time.Second)
+		require.NoError(t, err)
+		pool.GetBackends()[0].SetAlive(true, "test")
+		return pool
+	}
+	defaultPool, api, apiV2 := newPool("default"), newPool("api"), newPool("api-v2")
+	handler := NewPoolRouter(defaultPool, []PoolRoute{
+		{PathPrefix: "/api/", Pool: api},
+		{PathPrefix: "/api/v2/", Pool: apiV2},
+		{PathPrefix: "/graphql", Pool: api},
+		{PathPrefix: "/apix", Pool: apiV2},
+	})
+
+	for path, want := range map[string]string{
+		"/api/users":     "api /api/users",
+		"/api/v2/users":  "api-v2 /api/v2/users",
+		"/graphql":       "api /graphql",
+		"/graphql/batch": "api /graphql/batch",
+		"/graphqlx":      "default /graphqlx",
+		"/static/a.css":  "default /static/a.css",
+		"/api":           "default /api",
+		"/apix":          "api-v2 /apix",
+		"/apixy":         "default /apixy",
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, rr.Body.String(), path)
+	}
+
+	www, tenants := newPool("www"), newPool("tenants")
+	handler = NewPoolRouter(www, []PoolRoute{
+		{PathPrefix: "/api/", Pool: api},
+		{Host: "api.example.com", Pool: apiV2},
+		{Host: "*.example.com", Pool: tenants},
+		{Host: "www.example.com", Pool: defaultPool},
+	})
+	for target, want := range map[string]string{
+		"http://API.example.com:8443/users": "api-v2 /users",
+		"http://api.example.com/api/users":  "api-v2 /api/users",
+		"http://acme.example.com/":          "tenants /",
+		"http://www.example.com./":          "default /",
+		"http://example.com/":               "www /",
+		"http://other.test/api/users":       "api /api/users",
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, want, rr.Body.String(), target)
+	}
+
+	beta, internal := newPool("beta"), newPool("internal")
+	handler = NewPoolRouter(defaultPool, []PoolRoute{
+		{PathPrefix: "/api/", Pool: api},
+		{Host: "www.example.com", Pool: www},
+		{Headers: map[string]string{"x-beta": "true"}, Pool: beta},
+		{Methods: []string{"post"}, Query: map[string]string{"debug": ""}, Pool: internal},
+		{Headers: map[string]string{"X-Internal": ""}, PathPrefix: "/api/", Pool: internal},
+	})
+	for _, tc := range []struct {
+		method, target string
+		header         http.Header
+		want           string
+	}{
+		{http.MethodGet, "http://www.example.com/api/users", http.Header{"X-Beta": {"true"}}, "beta /api/users"},
+		{http.MethodGet, "http://www.example.com/api/users", http.Header{"X-Beta": {"false"}}, "www /api/users"},
+		{http.MethodPost, "/api/users?debug", nil, "internal /api/users"},
+		{http.MethodGet, "/api/users?debug=1", nil, "api /api/users"},
+		{http.MethodGet, "/api/users", http.Header{"X-Internal": {"yes"}}, "internal /api/users"},
+		{http.MethodGet, "/static", http.Header{"X-Internal": {"yes"}}, "default /static"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		for name, values := range tc.header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, tc.want, rr.Body.String(), "%s %s %v", tc.method, tc.target, tc.header)
+	}
+}
+
+func TestServerPool_HTTPSBackend(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "tls %s", r.URL.Path)
+	}))
+	defer upstream.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	specs := []BackendSpec{
+		{Name: "secure", URL: upstream.URL, TLS: BackendTLS{CAFile: caFile, ServerName: "example.com"}},
+		{Name: "ftp", URL: "ftp://files.local"},
+		{Name: "plain-tls", URL: "http://localhost:8081", TLS: BackendTLS{InsecureSkipVerify: true}},
+		{Name: "bad-ca", URL: "https://localhost:8443", TLS: BackendTLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+	}
+	pool, err := NewNamedServerPool(specs, time.Second, time.Second)
+	require.NoError(t, err)
+	require.Len(t, pool.GetBackends(), 1, "unsupported scheme, TLS on http backend and unreadable CA are skipped")
+	backend := pool.GetBackends()[0]
+
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/healthz"}))
+	state, reason := probeBackendHTTP(backend, pool.healthCheck, time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+
+	backend.SetAlive(true, "test")
+	rr := httptest.NewRecorder()
+	NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "tls /orders", rr.Body.String())
+
+	// Без CA сертификат тестового сервера не проверяется.
+	untrusted, err := NewServerPool([]string{upstream.URL}, time.Second, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, untrusted.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/healthz"}))
+	state, _ = probeBackendHTTP(untrusted.GetBackends()[0], untrusted.healthCheck, time.Second)
+	assert.Equal(t, StateUnhealthy, state)
+}
+
+func TestServerPool_SetEgressProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		fmt.Fprint(w, "via egress")
+	}))
+	defer proxy.Close()
+
+	pool, err := NewServerPool([]string{"http://app.example.com:8080", "http://db.corp.local:8080"}, time.Second, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, pool.SetEgressProxy(EgressProxy{Mode: EgressProxyStatic, URL: proxy.URL, NoProxy: []string{".corp.local", "10.0.0.0/8"}}))
+	require.NoError(t, pool.SetHealthCheckPolicy(HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/healthz"}))
+	// Адрес http-бэкенда в запросе к прокси берется из заголовка Host.
+	require.NoError(t, pool.SetHostPolicy(HostPolicy{Mode: HostBackend}))
+	app, db := pool.GetBackends()[0], pool.GetBackends()[1]
+
+	state, reason := probeBackendHTTP(app, pool.healthCheck, time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+	app.SetAlive(true, "test")
+	rr := httptest.NewRecorder()
+	NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, "via egress", rr.Body.String())
+	assert.Equal(t, []string{"http://app.example.com:8080/healthz", "http://app.example.com:8080/orders"}, proxied)
+
+	req := httptest.NewRequest(http.MethodGet, "http://db.corp.local:8080/", nil)
+	proxyURL, err := db.proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL, "Hosts from no_proxy are dialed directly")
+
+	require.NoError(t, pool.SetEgressProxy(EgressProxy{Mode: EgressProxyNone}))
+	assert.Nil(t, app.proxy)
+	assert.Error(t, pool.SetEgressProxy(EgressProxy{Mode: EgressProxyStatic, URL: "ftp://proxy:21"}))
+	assert.Error(t, pool.SetEgressProxy(EgressProxy{Mode: EgressProxyStatic, URL: proxy.URL, NoProxy: []string{"10.0.0.0/33"}}))
+	assert.Error(t, pool.SetEgressProxy(EgressProxy{Mode: "pac"}))
+}
+
+func TestParseNoProxy(t *testing.T) {
+	bypass, err := parseNoProxy([]string{"corp.local", " .internal ", "10.0.0.0/8", "192.168.1.5/32", ""})
+	require.NoError(t, err)
+	for host, want := range map[string]bool{
+		"corp.local":      true,
+		"db.corp.local":   true,
+		"DB.Internal":     true,
+		"notcorp.local":   false,
+		"10.1.2.3":        true,
+		"192.168.1.5":     true,
+		"192.168.1.6":     false,
+		"app.example.com": false,
+	} {
+		assert.Equal(t, want, bypass(host), host)
+	}
+
+	all, err := parseNoProxy([]string{"*"})
+	require.NoError(t, err)
+	assert.True(t, all("anything"))
+}
+
+func TestBackend_OpenConnections(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	pool, err := NewServerPool([]string{upstream.URL}, time.Second, time.Second)
+	require.NoError(t, err)
+	backend := pool.GetBackends()[0]
+	backend.SetAlive(true, "test")
+	assert.Zero(t, backend.OpenConnections())
+
+	NewLoadBalancerHandler(pool).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, int64(1), backend.OpenConnections(), "Idle keep-alive connection is counted")
+
+	require.NoError(t, pool.CloseIdleConnections(backend.Name()))
+	require.Eventually(t, func() bool { return backend.OpenConnections() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+// TestServerPool_AddBackend проверяет добавление бэкенда в работающий пул: общие параметры
+// пула, немедленную первую проверку и отказ для дубликатов.
+func TestServerPool_AddBackend(t *testing.T) {
+	existing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer existing.Close()
+	added := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer added.Close()
+
+	pool, err := NewNamedServerPool([]BackendSpec{{Name: "app-1", URL: existing.URL}}, time.Hour, time.Second)
+	require.NoError(t, err)
+	pool.SetTransportSettings(TransportSettings{MaxIdleConnsPerHost: 16})
+	require.NoError(t, pool.SetHostPolicy(HostPolicy{Mode: HostBackend}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.HealthCheck(ctx)
+	require.Eventually(t, func() bool { return pool.GetBackendByName("app-1").IsAlive() }, time.Second, 5*time.Millisecond)
+
+	backend, err := pool.AddBackend(BackendSpec{Name: "app-2", URL: added.URL})
+	require.NoError(t, err)
+	assert.False(t, backend.IsAlive(), "New backend waits for its first health check")
+	assert.Equal(t, 16, backend.ReverseProxy.Transport.(*http.Transport).MaxIdleConnsPerHost)
+	assert.Equal(t, backend.URL.Host, backend.upstreamHost)
+	require.Eventually(t, backend.IsAlive, time.Second, 5*time.Millisecond, "First check must not wait for the hour-long interval")
+	assert.Same(t, backend, pool.GetBackendByName("app-2"))
+
+	_, err = pool.AddBackend(BackendSpec{Name: "app-3", URL: existing.URL})
+	assert.ErrorIs(t, err, ErrDuplicateBackend, "Same URL")
+	_, err = pool.AddBackend(BackendSpec{Name: "app-1", URL: "http://other:8080"})
+	assert.ErrorIs(t, err, ErrDuplicateBackend, "Same name")
+	_, err = pool.AddBackend(BackendSpec{URL: "ftp://other"})
+	assert.Error(t, err)
+	assert.Len(t, pool.GetBackends(), 2)
+}
+
+// TestJoinPools проверяет уникальность имен бэкендов во всех пулах балансировщика.
+func TestJoinPools(t *testing.T) {
+	primary, err := NewServerPool([]string{"http://backend1:8081"}, time.Second, time.Second)
+	require.NoError(t, err)
+	api, err := NewServerPool([]string{"http://BACKEND1:8081/"}, time.Second, time.Second)
+	require.NoError(t, err)
+	assert.ErrorIs(t, JoinPools(primary, api), ErrDuplicateBackend, "Same unnamed URL in two pools")
+
+	api, err = NewNamedServerPool([]BackendSpec{{Name: "api-1", URL: "http://backend1:8081"}}, time.Second, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, JoinPools(primary, api), "Named backends may share a URL")
+
+	_, err = api.AddBackend(BackendSpec{URL: "http://backend1:8081"})
+	assert.ErrorIs(t, err, ErrDuplicateBackend, "Name is taken in the main pool")
+	_, err = primary.AddBackend(BackendSpec{Name: "api-1", URL: "http://backend2:8082"})
+	assert.ErrorIs(t, err, ErrDuplicateBackend)
+	_, err = primary.ReplaceBackends([]BackendSpec{{Name: "api-1", URL: "http://backend2:8082"}}, time.Second)
+	assert.ErrorIs(t, err, ErrDuplicateBackend)
+	assert.Len(t, primary.GetBackends(), 1)
+
+	_, err = api.AddBackend(BackendSpec{Name: "api-2", URL: "http://backend2:8082"})
+	assert.NoError(t, err)
+}
+
+func TestAvailableShare(t *testing.T) {
+	primary, err := NewServerPool([]string{"http://backend1:8081", "http://backend2:8082"}, time.Second, time.Second)
+	require.NoError(t, err)
+	api, err := NewServerPool([]string{"http://backend3:8083", "http://backend4:8084"}, time.Second, time.Second)
+	require.NoError(t, err)
+	for _, b := range append(primary.GetBackends(), api.GetBackends()...) {
+		b.SetAlive(true, "test")
+	}
+	api.GetBackends()[0].SetAlive(false, "test")
+	api.GetBackends()[1].SetAlive(false, "test")
+
+	assert.Equal(t, 1.0, primary.AvailableShare())
+	assert.Equal(t, 0.5, AvailableShare(primary, api), "Share counts backends of every pool")
+	assert.Equal(t, 0.0, AvailableShare())
+}
+
+func TestServerPool_DNSDiscovery(t *testing.T) {
+	answers := map[string][]string{"workers.internal": {"10.0.0.2", "10.0.0.1"}}
+	var lookupErr error
+	defer func(orig func(context.Context, string) ([]net.IPAddr, error)) { lookupIPAddr = orig }(lookupIPAddr)
+	lookupIPAddr = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		var addrs []net.IPAddr
+		for _, ip := range answers[host] {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	}
+
+	pool, err := NewNamedServerPool([]BackendSpec{
+		{Name: "workers", URL: "dns+http://workers.internal:8080/api", MaxRPS: 5},
+		{URL: "dns+ftp://workers.internal"},
+	}, time.Hour, time.Second)
+	require.NoError(t, err)
+	require.True(t, pool.HasDNSDiscovery())
+	names := func() []string {
+		var names []string
+		for _, b := range pool.GetBackends() {
+			if !b.IsDraining() {
+				names = append(names, b.Name())
+			}
+		}
+		return names
+	}
+	assert.Equal(t, []string{"workers-10.0.0.1", "workers-10.0.0.2"}, names())
+	assert.Equal(t, "http://10.0.0.1:8080/api", pool.GetBackendByName("workers-10.0.0.1").URL.String())
+
+	pool.SetDNSDiscovery(DNSDiscoveryPolicy{RefreshInterval: time.Minute})
+	src := pool.dnsSources[0]
+	answers["workers.internal"] = []string{"10.0.0.2", "10.0.0.3"}
+	pool.refreshDNSSource(context.Background(), src)
+	assert.Equal(t, []string{"workers-10.0.0.2", "workers-10.0.0.3"}, names())
+	require.Eventually(t, func() bool { return pool.GetBackendByName("workers-10.0.0.1") == nil }, time.Second, 5*time.Millisecond)
+
+	// Сбой DNS или пустой ответ не удаляют бэкенды.
+	lookupErr = errors.New("no such host")
+	pool.refreshDNSSource(context.Background(), src)
+	lookupErr = nil
+	answers["workers.internal"] = nil
+	pool.refreshDNSSource(context.Background(), src)
+	assert.Equal(t, []string{"workers-10.0.0.2", "workers-10.0.0.3"}, names())
+}
+
+func TestNewNamedServerPool_UnresolvedDNS(t *testing.T) {
+	defer func(orig func(context.Context, string) ([]net.IPAddr, error)) { lookupIPAddr = orig }(lookupIPAddr)
+	lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) { return nil, errors.New("no such host") }
+
+	pool, err := NewNamedServerPool([]BackendSpec{{URL: "dns+https://workers.internal"}}, time.Hour, time.Second)
+	require.NoError(t, err, "Pool waits for DNS discovery")
+	assert.Empty(t, pool.GetBackends())
+	assert.Nil(t, pool.GetNextPeer())
+
+	lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("2001:db8::1")}}, nil
+	}
+	pool.refreshDNSSource(context.Background(), pool.dnsSources[0])
+	backend := pool.GetBackendByName("workers.internal-2001:db8::1")
+	require.NotNil(t, backend)
+	assert.Equal(t, "https://[2001:db8::1]", backend.URL.String())
+
+	_, err = NewNamedServerPool([]BackendSpec{{URL: "dns+http://10.0.0.1"}}, time.Hour, time.Second)
+	assert.ErrorIs(t, err, ErrNoBackends, "DNS discovery requires a name")
+}
+
+func TestServerPool_NextPeerWithRoute(t *testing.T) {
+	pool := &ServerPool{backends: []*Backend{
+		newTestBackend("http://a:80", true),
+		newTestBackend("http://b:80", true),
+	}}
+	b := pool.backends[1]
+	r := WithRoute(httptest.NewRequest(http.MethodGet, "/", nil), []string{b.Name()})
+	for range 4 {
+		assert.Same(t, b, pool.NextPeer(r))
+	}
+
+	b.SetAlive(false, "test")
+	assert.Nil(t, pool.NextPeer(r), "Routed requests don't fall back to other backends")
+	assert.NotNil(t, pool.NextPeer(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+// fakeEtcd - JSON-шлюз etcd с ключами keys на ревизии revision; события передаются в поток
+// отслеживания через events.
+type fakeEtcd struct {
+	keys       map[string]string
+	revision   int64
+	events     chan map[string]any
+	watchStart chan string
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var kvs []map[string]any
+		for k, v := range f.keys {
+			kvs = append(kvs, map[string]any{"key": []byte(k), "value": []byte(v), "mod_revision": "1"})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"header": map[string]any{"revision": strconv.FormatInt(f.revision, 10)}, "kvs": kvs})
+	case "/v3/watch":
+		f.watchStart <- req["create_request"].(map[string]any)["start_revision"].(string)
+		enc := json.NewEncoder(w)
+		_ = enc.Encode(map[string]any{"result": map[string]any{"created": true}})
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e := <-f.events:
+				_ = enc.Encode(map[string]any{"result": map[string]any{"events": []any{e}}})
+				w.(http.Flusher).Flush()
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestServerPool_EtcdRegistry(t *testing.T) {
+	etcd := &fakeEtcd{
+		keys: map[string]string{
+			"/lb/backends/app-1": "http://10.0.0.1:8080",
+			"/lb/backends/x":     `{"name": "app-2", "url": "http://10.0.0.2:8080", "max_rps": 5}`,
+		},
+		revision:   41,
+		events:     make(chan map[string]any),
+		watchStart: make(chan string, 1),
+	}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	pool, err := NewDynamicServerPool(nil, time.Hour, time.Second)
+	require.NoError(t, err, "Registry-backed pool may start empty")
+	assert.Error(t, pool.SetEtcdRegistry(EtcdRegistryPolicy{Endpoints: []string{"etcd:2379"}, Prefix: "/lb/"}))
+	require.NoError(t, pool.SetEtcdRegistry(EtcdRegistryPolicy{Endpoints: []string{server.URL}, Prefix: "/lb/backends/"}))
+	require.NoError(t, pool.CheckEtcdRegistry(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.RunEtcdRegistry(ctx)
+	assert.Equal(t, "42", <-etcd.watchStart, "Watch starts right after the listed revision")
+
+	names := func() []string {
+		var names []string
+		for _, b := range pool.GetBackends() {
+			if !b.IsDraining() {
+				names = append(names, b.Name())
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+	assert.Equal(t, []string{"app-1", "app-2"}, names())
+	assert.Equal(t, "http://10.0.0.2:8080", pool.GetBackendByName("app-2").URL.String())
+
+	etcd.events <- map[string]any{"type": "DELETE", "kv": map[string]any{"key": []byte("/lb/backends/app-1")}}
+	etcd.events <- map[string]any{"kv": map[string]any{"key": []byte("/lb/backends/app-3"), "value": []byte("http://10.0.0.3:8080")}}
+	require.Eventually(t, func() bool {
+		return pool.GetBackendByName("app-1") == nil && pool.GetBackendByName("app-3") != nil
+	}, time.Second, 5*time.Millisecond)
+
+	// Изменение URL ключа заменяет бэкенд после drain прежнего.
+	etcd.events <- map[string]any{"kv": map[string]any{"key": []byte("/lb/backends/app-3"), "value": []byte("http://10.0.0.4:8080")}}
+	require.Eventually(t, func() bool {
+		b := pool.GetBackendByName("app-3")
+		return b != nil && b.URL.Host == "10.0.0.4:8080"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"app-2", "app-3"}, names())
+}
+
+func TestParseBackendsFile(t *testing.T) {
+	specs, err := ParseBackendsFile("backends.txt", []byte("# deploy 42\nhttp://10.0.0.1:8080\n\n  http://10.0.0.2:8080  \n"))
+	require.NoError(t, err)
+	assert.Equal(t, []BackendSpec{{URL: "http://10.0.0.1:8080"}, {URL: "http://10.0.0.2:8080"}}, specs)
+
+	specs, err = ParseBackendsFile("backends.yaml", []byte("- http://10.0.0.1:8080\n- {name: app-2, url: \"http://10.0.0.2:8080\", max_rps: 5}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []BackendSpec{{URL: "http://10.0.0.1:8080"}, {Name: "app-2", URL: "http://10.0.0.2:8080", MaxRPS: 5}}, specs)
+
+	specs, err = ParseBackendsFile("backends.yml", []byte("backends:\n  - http://10.0.0.1:8080\n"))
+	require.NoError(t, err)
+	assert.Len(t, specs, 1)
+
+	_, err = ParseBackendsFile("backends.txt", []byte("http://10.0.0.1:8080\nhttp://10.0.0.1:8080\n"))
+	assert.ErrorContains(t, err, "duplicate backend")
+	_, err = ParseBackendsFile("backends.yaml", []byte("- name: app-1\n"))
+	assert.Error(t, err)
+}
+
+func TestServerPool_BackendsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backends.txt")
+	write := func(content string, age time.Duration) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		mtime := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	write("http://10.0.0.1:8080\nhttp://10.0.0.2:8080\n", time.Minute)
+
+	pool, err := NewDynamicServerPool(nil, time.Hour, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, pool.SetBackendsFile(BackendsFilePolicy{Path: path}))
+	require.Len(t, pool.GetBackends(), 2)
+
+	changed, err := pool.reloadBackendsFile()
+	require.NoError(t, err)
+	assert.False(t, changed, "Unchanged file is not re-applied")
+
+	write("http://10.0.0.2:8080\nhttp://10.0.0.3:8080\n", 0)
+	changed, err = pool.reloadBackendsFile()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	require.Eventually(t, func() bool { return len(pool.GetBackends()) == 2 }, time.Second, 5*time.Millisecond)
+	var hosts []string
+	for _, b := range pool.GetBackends() {
+		hosts = append(hosts, b.URL.Host)
+	}
+	assert.ElementsMatch(t, []string{"10.0.0.2:8080", "10.0.0.3:8080"}, hosts)
+
+	// Некорректный файл не изменяет пул.
+	write("http://10.0.0.4:8080\nhttp://10.0.0.4:8080\n", -time.Minute)
+	_, err = pool.reloadBackendsFile()
+	assert.Error(t, err)
+	assert.Len(t, pool.GetBackends(), 2)
+
+	assert.Error(t, pool.SetBackendsFile(BackendsFilePolicy{Path: filepath.Join(t.TempDir(), "missing.txt")}))
+}
+
+// TestServerPool_RunBackendsFile проверяет применение изменений файла по событиям файловой
+// системы, без ожидания интервала проверки, в том числе при замене файла через rename.
+func TestServerPool_RunBackendsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backends.txt")
+	require.NoError(t, os.WriteFile(path, []byte("http://10.0.0.1:8080\n"), 0o644))
+
+	pool, err := NewDynamicServerPool(nil, time.Hour, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, pool.SetBackendsFile(BackendsFilePolicy{Path: path, PollInterval: time.Hour}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.RunBackendsFile(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	hasBackend := func(name string) func() bool {
+		return func() bool { return pool.GetBackendByName(name) != nil }
+	}
+
+	// Отслеживание запускается асинхронно, поэтому файл перезаписывается до применения.
+	require.Eventually(t, func() bool {
+		_ = os.WriteFile(path, []byte("http://10.0.0.1:8080\nhttp://10.0.0.2:8080\n"), 0o644)
+		return hasBackend("10.0.0.2:8080")()
+	}, 2*time.Second, 50*time.Millisecond, "Written file is applied without waiting for the poll interval")
+
+	tmp := filepath.Join(dir, "backends.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("http://10.0.0.3:8080\n"), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+	assert.Eventually(t, hasBackend("10.0.0.3:8080"), 2*time.Second, 10*time.Millisecond, "Atomically replaced file is applied")
+}
+
+// TestServerPool_Upgrade проверяет проксирование соединения с переключением протокола:
+// WriteTimeout сервера не прерывает его, а простаивающее соединение закрывается по
+// UpgradePolicy.IdleTimeout.
+func TestServerPool_Upgrade(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = brw.Flush()
+		_, _ = io.Copy(conn, brw)
+	}))
+	defer upstream.Close()
+
+	pool, err := NewServerPool([]string{upstream.URL}, time.Second, time.Second)
+	require.NoError(t, err)
+	pool.GetBackends()[0].SetAlive(true, "test")
+	pool.SetUpgradePolicy(UpgradePolicy{IdleTimeout: 300 * time.Millisecond})
+	lb := httptest.NewUnstartedServer(NewLoadBalancerHandler(pool))
+	lb.Config.WriteTimeout = 100 * time.Millisecond
+	lb.Config.ReadTimeout = 100 * time.Millisecond
+	lb.Start()
+	defer lb.Close()
+
+	conn, err := net.Dial("tcp", lb.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: lb\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	require.NoError(t, err)
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Contains(t, string(buf[:n]), "101 Switching Protocols")
+
+	// Обмен данными продолжается после ReadTimeout и WriteTimeout сервера.
+	for i := 0; i < 3; i++ {
+		time.Sleep(150 * time.Millisecond)
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		n, err = conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf[:n]))
+	}
+
+	// Без передачи данных соединение закрывается по IdleTimeout.
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = conn.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Eventually(t, func() bool { return pool.GetBackends()[0].ActiveRequests() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+// TestServerPool_UpstreamProtocol проверяет выбор протокола соединений с бэкендом: h2c для
+// http-бэкенда в режиме http2, HTTP/2 по ALPN для https-бэкенда в режиме auto и HTTP/1.1
+// в режиме http1; протокол бэкенда имеет приоритет над протоколом пула.
+func TestServerPool_UpstreamProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	cleartext := httptest.NewUnstartedServer(handler)
+	cleartext.Config.Protocols = new(http.Protocols)
+	cleartext.Config.Protocols.SetHTTP1(true)
+	cleartext.Config.Protocols.SetUnencryptedHTTP2(true)
+	cleartext.Start()
+	defer cleartext.Close()
+	secure := httptest.NewUnstartedServer(handler)
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	defer secure.Close()
+
+	proto := func(pool *ServerPool) string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	newPool := func(spec BackendSpec) *ServerPool {
+		t.Helper()
+		pool, err := NewNamedServerPool([]BackendSpec{spec}, time.Second, time.Second)
+		require.NoError(t, err)
+		pool.GetBackends()[0].SetAlive(true, "test")
+		return pool
+	}
+
+	assert.Equal(t, "HTTP/1.1", proto(newPool(BackendSpec{URL: cleartext.URL})))
+	// Протокол задается при запуске, до первого запроса к бэкенду.
+	pool := newPool(BackendSpec{URL: cleartext.URL})
+	require.NoError(t, pool.SetTransportSettings(TransportSettings{Protocol: ProtocolHTTP2}))
+	assert.Equal(t, "HTTP/2.0", proto(pool))
+	assert.Equal(t, ProtocolHTTP2, pool.GetBackends()[0].Protocol())
+	state, reason := probeBackendHTTP(pool.GetBackends()[0], HealthCheckPolicy{Mode: HealthCheckHTTP, Path: "/", Method: http.MethodGet}, time.Second)
+	assert.Equal(t, StateHealthy, state, reason)
+
+	pool = newPool(BackendSpec{URL: cleartext.URL, Protocol: ProtocolHTTP1})
+	require.NoError(t, pool.SetTransportSettings(TransportSettings{Protocol: ProtocolHTTP2}))
+	assert.Equal(t, "HTTP/1.1", proto(pool), "Backend protocol overrides the pool protocol")
+
+	tlsSpec := BackendSpec{URL: secure.URL, TLS: BackendTLS{InsecureSkipVerify: true}}
+	assert.Equal(t, "HTTP/2.0", proto(newPool(tlsSpec)))
+	tlsSpec.Protocol = ProtocolHTTP1
+	assert.Equal(t, "HTTP/1.1", proto(newPool(tlsSpec)))
+
+	_, err := NewNamedServerPool([]BackendSpec{{URL: cleartext.URL, Protocol: "spdy"}}, time.Second, time.Second)
+	assert.ErrorIs(t, err, ErrNoBackends, "Backend with unknown protocol is skipped")
+	assert.Error(t, pool.SetTransportSettings(TransportSettings{Protocol: "h3"}))
+}
+
+// TestBackend_ConnReuse проверяет учет keep-alive соединений и возобновления TLS-сессий.
+func TestBackend_ConnReuse(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pool, err := NewNamedServerPool([]BackendSpec{{URL: server.URL, TLS: BackendTLS{InsecureSkipVerify: true}}}, time.Second, time.Second)
+	require.NoError(t, err)
+	backend := pool.GetBackends()[0]
+	backend.SetAlive(true, "test")
+	serve := func() {
+		rr := httptest.NewRecorder()
+		NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	_, ok := backend.ConnReuse().KeepAliveReuseRatio()
+	assert.False(t, ok)
+	serve()
+	serve()
+	backend.ReverseProxy.Transport.(*http.Transport).CloseIdleConnections()
+	serve()
+
+	stats := backend.ConnReuse()
+	assert.Equal(t, ConnReuseStats{NewConnections: 2, ReusedConnections: 1, FullHandshakes: 1, ResumedHandshakes: 1}, stats)
+	ratio, ok := stats.TLSResumptionRatio()
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, ratio)
+}
+
+// TestServerPool_PathRewrites проверяет изменение пути запроса, передаваемого бэкенду.
+func TestServerPool_PathRewrites(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.EscapedPath()+"?"+r.URL.RawQuery+" "+r.Header.Get("X-Forwarded-Prefix"))
+	}))
+	defer server.Close()
+	pool, err := NewNamedServerPool([]BackendSpec{{URL: server.URL + "/base"}}, time.Second, time.Second)
+	require.NoError(t, err)
+	pool.GetBackends()[0].SetAlive(true, "test")
+	require.NoError(t, pool.SetPathRewrites([]PathRewrite{
+		{PathPrefix: "/api/", StripPrefix: true},
+		{PathPrefix: "/api/v1/", StripPrefix: true, AddPrefix: "/v1"},
+		{PathPrefix: "/legacy/", Regex: `^/legacy/(\w+)/(\d+)$`, Replacement: "/items/$2/$1"},
+		{PathPrefix: "/app", StripPrefix: true},
+		{PathPrefix: "/a b/", StripPrefix: true},
+	}))
+	forwarded := func(target string) string {
+		rr := httptest.NewRecorder()
+		NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	assert.Equal(t, "/base/users?page=2 /api", forwarded("/api/users?page=2"))
+	assert.Equal(t, "/base/v1/users? /api/v1", forwarded("/api/v1/users"), "Longest prefix wins")
+	assert.Equal(t, "/base/a%2Fb? /api", forwarded("/api/a%2Fb"), "Escaped characters are preserved")
+	assert.Equal(t, "/base/? /api", forwarded("/api/"))
+	assert.Equal(t, "/base/items/7/book? ", forwarded("/legacy/book/7"))
+	assert.Equal(t, "/base/other? ", forwarded("/other"))
+	assert.Equal(t, "/base/users? /app", forwarded("/app/users"))
+	assert.Equal(t, "/base/? /app", forwarded("/app"))
+	assert.Equal(t, "/base/appx/users? ", forwarded("/appx/users"), "Prefix matches only on a segment boundary")
+	assert.Equal(t, "/base/x? /a b", forwarded("/a%20b/x"), "Prefix is matched and stripped on the escaped path")
+
+	spoofed := func(target string) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-Forwarded-Prefix", "/evil")
+		rr := httptest.NewRecorder()
+		NewLoadBalancerHandler(pool).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	assert.Equal(t, "/base/users? /api", spoofed("/api/users"), "Stripped prefix overwrites the client header")
+	assert.Equal(t, "/base/items/7/book? ", spoofed("/legacy/book/7"), "Client header is removed without a stripped prefix")
+	assert.Equal(t, "/base/other? ", spoofed("/other"))
+
+	assert.Error(t, pool.SetPathRewrites([]PathRewrite{{PathPrefix: "/api/"}}))
+	assert.Error(t, pool.SetPathRewrites([]PathRewrite{{PathPrefix: "/api/", Regex: "("}}))
+}
+
+// TestNewLoadBalancerHandler_EmptyDynamicPool проверяет, что обработчик, созданный для пустого
+// пула, начинает проксировать запросы после добавления бэкенда.
+func TestNewLoadBalancerHandler_EmptyDynamicPool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	pool, err := NewDynamicServerPool(nil, time.Second, time.Second)
+	require.NoError(t, err)
+	handler := NewLoadBalancerHandler(pool)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Empty pool means no backends available yet")
+
+	backend, err := pool.AddBackend(BackendSpec{URL: server.URL})
+	require.NoError(t, err)
+	backend.SetAlive(true, "test")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ok", rr.Body.String())
+}
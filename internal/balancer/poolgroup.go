@@ -0,0 +1,67 @@
+package balancer
+
+import (
+	"fmt"
+	"sync"
+)
+
+// poolGroup - пулы одного балансировщика. Имена бэкендов уникальны во всех пулах группы,
+// поэтому Admin API, метрики и журналы однозначно находят бэкенд по имени.
+type poolGroup struct {
+	mu    sync.Mutex // Упорядочивает добавление бэкендов в пулы группы.
+	pools []*ServerPool
+}
+
+// JoinPools объединяет пулы одного балансировщика в группу: после этого AddBackend
+// и ReplaceBackends отклоняют бэкенды, имя которых уже есть в другом пуле группы.
+// Возвращает ErrDuplicateBackend, если имя бэкенда уже используется в нескольких пулах
+// (например, один и тот же URL без имени задан в двух пулах). Вызывается при запуске,
+// до начала обработки запросов.
+func JoinPools(pools ...*ServerPool) error {
+	seen := make(map[string]bool)
+	for _, pool := range pools {
+		for _, b := range pool.GetBackends() {
+			if seen[b.Name()] {
+				return fmt.Errorf("%w: backend name %s is used in more than one pool (give the backends distinct names)", ErrDuplicateBackend, b.Name())
+			}
+			seen[b.Name()] = true
+		}
+	}
+	group := &poolGroup{pools: pools}
+	for _, pool := range pools {
+		pool.mu.Lock()
+		pool.group = group
+		pool.mu.Unlock()
+	}
+	return nil
+}
+
+// lockGroup захватывает блокировку группы пула, чтобы проверка имени в других пулах
+// и добавление бэкенда выполнялись атомарно. Возвращает функцию освобождения.
+func (s *ServerPool) lockGroup() func() {
+	s.mu.RLock()
+	group := s.group
+	s.mu.RUnlock()
+	if group == nil {
+		return func() {}
+	}
+	group.mu.Lock()
+	return group.mu.Unlock
+}
+
+// usedByOtherPool возвращает ошибку, если бэкенд с именем name есть в другом пуле группы.
+// Вызывающий должен удерживать блокировку группы (см. lockGroup), но не s.mu.
+func (s *ServerPool) usedByOtherPool(name string) error {
+	s.mu.RLock()
+	group := s.group
+	s.mu.RUnlock()
+	if group == nil {
+		return nil
+	}
+	for _, pool := range group.pools {
+		if pool != s && pool.GetBackendByName(name) != nil {
+			return fmt.Errorf("%w: backend name %s is used in another pool", ErrDuplicateBackend, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package balancer
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+)
+
+// PoolRoute направляет в пул Pool запросы к хосту Host с путем, начинающимся с PathPrefix.
+// Пустой Host подходит любому хосту, пустой PathPrefix - любому пути. Host сравнивается без
+// учета регистра и порта; "*.example.com" подходит поддоменам example.com.
+//
+// Маршрут с условиями на метод (Methods), заголовки (Headers) или параметры запроса (Query)
+// дополнительно требует, чтобы метод входил в Methods, а каждый заголовок и параметр имел
+// указанное значение (пустое значение - присутствует с любым значением).
+type PoolRoute struct {
+	Host       string
+	PathPrefix string
+	Methods    []string
+	Headers    map[string]string
+	Query      map[string]string
+	Pool       *ServerPool
+}
+
+// conditional сообщает, задает ли маршрут условия на метод, заголовки или параметры запроса.
+func (r PoolRoute) conditional() bool {
+	return len(r.Methods) > 0 || len(r.Headers) > 0 || len(r.Query) > 0
+}
+
+// matchesConditions сообщает, выполнены ли для запроса req условия маршрута на метод,
+// заголовки и параметры запроса.
+func (r PoolRoute) matchesConditions(req *http.Request) bool {
+	if len(r.Methods) > 0 && !slices.ContainsFunc(r.Methods, func(m string) bool { return strings.EqualFold(m, req.Method) }) {
+		return false
+	}
+	for name, want := range r.Headers {
+		values, ok := req.Header[http.CanonicalHeaderKey(name)]
+		if !ok || (want != "" && !slices.Contains(values, want)) {
+			return false
+		}
+	}
+	if len(r.Query) > 0 {
+		query := req.URL.Query()
+		for name, want := range r.Query {
+			values, ok := query[name]
+			if !ok || (want != "" && !slices.Contains(values, want)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchesHost сообщает, подходит ли маршрут хосту host (в нижнем регистре, без порта).
+func (r PoolRoute) matchesHost(host string) bool {
+	pattern := strings.ToLower(r.Host)
+	switch {
+	case pattern == "":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	default:
+		return host == pattern
+	}
+}
+
+// routeLess задает порядок проверки маршрутов: сначала маршруты с условиями (в заданном
+// порядке), затем маршруты с хостом (точные раньше масок, более длинные маски раньше
+// коротких), затем - с более длинным префиксом пути.
+func routeLess(a, b PoolRoute) bool {
+	if a.conditional() || b.conditional() {
+		return a.conditional() && !b.conditional()
+	}
+	if (a.Host != "") != (b.Host != "") {
+		return a.Host != ""
+	}
+	aWildcard, bWildcard := strings.HasPrefix(a.Host, "*."), strings.HasPrefix(b.Host, "*.")
+	if aWildcard != bWildcard {
+		return !aWildcard
+	}
+	if len(a.Host) != len(b.Host) {
+		return len(a.Host) > len(b.Host)
+	}
+	return len(a.PathPrefix) > len(b.PathPrefix)
+}
+
+// requestHost возвращает хост запроса в нижнем регистре без порта и завершающей точки.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// NewPoolRouter возвращает обработчик, который выбирает пул по первому подходящему маршруту
+// (см. PoolRoute и routeLess: маршруты с условиями проверяются в заданном порядке, затем
+// маршруты с хостом, затем выбирается самый длинный подходящий префикс пути) и передает запрос балансировщику этого пула (см.
+// NewLoadBalancerHandler). Запросы, не подошедшие ни под один маршрут, обслуживает defaultPool.
+func NewPoolRouter(defaultPool *ServerPool, routes []PoolRoute) http.Handler {
+	type route struct {
+		PoolRoute
+		handler http.Handler
+	}
+	handlers := make(map[*ServerPool]http.Handler, len(routes)+1)
+	handlerFor := func(pool *ServerPool) http.Handler {
+		if h, ok := handlers[pool]; ok {
+			return h
+		}
+		h := NewLoadBalancerHandler(pool)
+		handlers[pool] = h
+		return h
+	}
+	fallback := handlerFor(defaultPool)
+	sorted := make([]route, 0, len(routes))
+	for _, r := range routes {
+		sorted = append(sorted, route{PoolRoute: r, handler: handlerFor(r.Pool)})
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return routeLess(sorted[i].PoolRoute, sorted[j].PoolRoute) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := requestHost(r)
+		for _, route := range sorted {
+			if route.matchesHost(host) && httputil_pkg.PathHasPrefix(r.URL.Path, route.PathPrefix) && route.matchesConditions(r) {
+				route.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
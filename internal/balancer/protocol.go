@@ -0,0 +1,84 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Режимы обработки заголовка Expect: 100-continue.
+const (
+	// ExpectForward - передавать Expect бэкенду: тело запроса отправляется после ответа
+	// 100 Continue от бэкенда или по истечении ExpectContinueTimeout (поведение по умолчанию).
+	ExpectForward = "forward"
+	// ExpectLocal - отвечать 100 Continue на балансировщике и отправлять бэкенду запрос
+	// без Expect вместе с телом. Нужен для бэкендов, не поддерживающих 100-continue.
+	ExpectLocal = "local"
+)
+
+// Режимы обработки соединений клиентов HTTP/1.0.
+const (
+	// HTTP10Preserve - соединение закрывается или сохраняется согласно заголовку Connection клиента.
+	HTTP10Preserve = "preserve"
+	// HTTP10Close - соединение закрывается после каждого ответа (Connection: close),
+	// даже если клиент запросил keep-alive.
+	HTTP10Close = "close"
+)
+
+// ProtocolPolicy задает обработку Expect: 100-continue и клиентов HTTP/1.0.
+type ProtocolPolicy struct {
+	ExpectContinue string
+	// Сколько ждать 100 Continue от бэкенда перед отправкой тела в режиме ExpectForward
+	// (0 - значение по умолчанию транспорта).
+	ExpectContinueTimeout time.Duration
+	HTTP10Connection      string
+}
+
+// SetProtocolPolicy устанавливает обработку Expect: 100-continue и клиентов HTTP/1.0.
+// Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetProtocolPolicy(policy ProtocolPolicy) error {
+	switch policy.ExpectContinue {
+	case "", ExpectForward, ExpectLocal:
+	default:
+		return fmt.Errorf("unknown expect_continue mode %q (expected %s or %s)", policy.ExpectContinue, ExpectForward, ExpectLocal)
+	}
+	switch policy.HTTP10Connection {
+	case "", HTTP10Preserve, HTTP10Close:
+	default:
+		return fmt.Errorf("unknown http10_connection mode %q (expected %s or %s)", policy.HTTP10Connection, HTTP10Preserve, HTTP10Close)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.protocolPolicy = policy
+	for _, b := range s.backends {
+		b.expectLocal = policy.ExpectContinue == ExpectLocal
+		if transport, ok := b.ReverseProxy.Transport.(*http.Transport); ok && policy.ExpectContinueTimeout > 0 {
+			transport.ExpectContinueTimeout = policy.ExpectContinueTimeout
+		}
+	}
+	return nil
+}
+
+// rewriteExpect удаляет Expect из исходящего запроса, если 100 Continue отвечает балансировщик.
+// Сервер net/http отправляет клиенту 100 Continue при первом чтении тела, а в этом режиме
+// тело читается сразу, не дожидаясь бэкенда.
+func (b *Backend) rewriteExpect(req *http.Request) {
+	if b.expectLocal {
+		req.Header.Del("Expect")
+	}
+}
+
+// applyHTTP10Policy запрашивает закрытие соединения после ответа клиенту HTTP/1.0,
+// если это требуется политикой пула.
+func (s *ServerPool) applyHTTP10Policy(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoAtLeast(1, 1) {
+		return
+	}
+	s.mu.RLock()
+	forceClose := s.protocolPolicy.HTTP10Connection == HTTP10Close
+	s.mu.RUnlock()
+	if forceClose {
+		w.Header().Set("Connection", "close")
+	}
+}
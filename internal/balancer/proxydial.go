@@ -0,0 +1,191 @@
+package balancer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// NewProxyDialer возвращает DialContextFunc, устанавливающий соединения с бэкендом через
+// прокси proxyURL: socks5://[user:pass@]host:port или http://[user:pass@]host:port (метод CONNECT).
+// Используется для бэкендов, доступных только через бастион.
+func NewProxyDialer(proxyURL string) (DialContextFunc, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", proxyURL)
+	}
+	var handshake func(conn net.Conn, addr string) (net.Conn, error)
+	switch u.Scheme {
+	case "socks5":
+		handshake = func(conn net.Conn, addr string) (net.Conn, error) {
+			return conn, socks5Connect(conn, addr, u.User)
+		}
+	case "http":
+		handshake = func(conn net.Conn, addr string) (net.Conn, error) {
+			return httpConnect(conn, addr, u.User)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected socks5 or http)", u.Scheme)
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to proxy %s: %w", u.Host, err)
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		tunnel, err := handshake(conn, addr)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy %s failed to connect to %s: %w", u.Host, addr, err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return tunnel, nil
+	}, nil
+}
+
+// socks5Connect выполняет согласование SOCKS5 (RFC 1928, RFC 1929) и команду CONNECT к addr.
+func socks5Connect(conn net.Conn, addr string, user *url.Userinfo) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	method := byte(0x00) // Без аутентификации.
+	if user != nil {
+		method = 0x02 // Имя пользователя и пароль.
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return errors.New("socks5: authentication method not accepted")
+	}
+	if method == 0x02 {
+		password, _ := user.Password()
+		name := user.Username()
+		if len(name) > 255 || len(password) > 255 {
+			return errors.New("socks5: credentials too long")
+		}
+		req := append([]byte{1, byte(len(name))}, name...)
+		req = append(append(req, byte(len(password))), password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("socks5: authentication failed")
+		}
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, 1), ip4...)
+		} else {
+			req = append(append(req, 4), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		skip = int(l[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", head[3])
+	}
+	// Адрес и порт, привязанные прокси, не используются.
+	_, err = io.CopyN(io.Discard, conn, int64(skip+2))
+	return err
+}
+
+// httpConnect устанавливает туннель к addr через HTTP-прокси методом CONNECT.
+func httpConnect(conn net.Conn, addr string, user *url.Userinfo) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT returned %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// Прокси уже передал данные бэкенда - они не должны потеряться.
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn - соединение, чтение из которого начинается с уже буферизованных данных.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,159 @@
+package balancer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveProxy запускает тестовый прокси, который для каждого соединения выполняет handshake
+// и соединяет клиента с адресом, который тот вернул.
+func serveProxy(t *testing.T, handshake func(conn net.Conn, br *bufio.Reader) (string, error)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				addr, err := handshake(conn, br)
+				if err != nil {
+					return
+				}
+				upstream, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, br)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func socks5Handshake(conn net.Conn, br *bufio.Reader) (string, error) {
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return "", err
+	}
+	conn.Write([]byte{5, head[2]})
+	if head[2] == 2 {
+		// Имя пользователя и пароль: ожидается user:secret.
+		var creds []string
+		ver := make([]byte, 1)
+		io.ReadFull(br, ver)
+		for range 2 {
+			l, _ := br.ReadByte()
+			b := make([]byte, l)
+			io.ReadFull(br, b)
+			creds = append(creds, string(b))
+		}
+		if strings.Join(creds, ":") != "user:secret" {
+			conn.Write([]byte{1, 1})
+			return "", fmt.Errorf("bad credentials")
+		}
+		conn.Write([]byte{1, 0})
+	}
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil {
+		return "", err
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(br, ip)
+		host = net.IP(ip).String()
+	case 3:
+		l, _ := br.ReadByte()
+		name := make([]byte, l)
+		io.ReadFull(br, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(br, port)
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port))), nil
+}
+
+func connectHandshake(conn net.Conn, br *bufio.Reader) (string, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return "", err
+	}
+	if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+		fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return "", fmt.Errorf("rejected")
+	}
+	fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host, nil
+}
+
+func TestNewProxyDialer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "via proxy")
+	}))
+	defer upstream.Close()
+	socks := serveProxy(t, socks5Handshake)
+	connect := serveProxy(t, connectHandshake)
+
+	tests := []struct {
+		name    string
+		proxy   string
+		backend string
+		wantErr bool
+	}{
+		{name: "socks5 ip", proxy: "socks5://" + socks, backend: upstream.URL},
+		{name: "socks5 hostname with auth", proxy: "socks5://user:secret@" + socks, backend: strings.Replace(upstream.URL, "127.0.0.1", "localhost", 1)},
+		{name: "socks5 wrong password", proxy: "socks5://user:wrong@" + socks, backend: upstream.URL, wantErr: true},
+		{name: "http connect", proxy: "http://user:secret@" + connect, backend: upstream.URL},
+		{name: "http connect rejected", proxy: "http://" + connect, backend: upstream.URL, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial, err := NewProxyDialer(tt.proxy)
+			require.NoError(t, err)
+			pool, err := NewNamedServerPool([]BackendSpec{{URL: tt.backend, Dial: dial}}, time.Second, time.Second)
+			require.NoError(t, err)
+			backend := pool.GetBackends()[0]
+
+			state, reason := probeBackend(backend, time.Second)
+			if tt.wantErr {
+				assert.Equal(t, StateUnhealthy, state, reason)
+				return
+			}
+			assert.Equal(t, StateHealthy, state, reason)
+
+			backend.SetAlive(true, "test")
+			rr := httptest.NewRecorder()
+			NewLoadBalancerHandler(pool).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "via proxy", rr.Body.String())
+		})
+	}
+}
+
+func TestNewProxyDialer_InvalidURL(t *testing.T) {
+	for _, proxy := range []string{"ftp://bastion:21", "socks5://", "://bad"} {
+		_, err := NewProxyDialer(proxy)
+		assert.Error(t, err, proxy)
+	}
+}
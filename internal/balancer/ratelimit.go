@@ -0,0 +1,39 @@
+package balancer
+
+import (
+	"math"
+
+	"cloud/load_balancer/internal/metrics"
+	rl "cloud/load_balancer/internal/ratelimiter"
+)
+
+var backendRateLimitedTotal = metrics.NewCounterVec("lb_backend_rate_limited_total",
+	"Times a backend was skipped because its max_rps limit was exhausted.", "backend")
+
+// setRateLimit ограничивает число запросов к бэкенду в секунду независимо от клиентов.
+// Допускается всплеск до одной секунды трафика (не менее одного запроса).
+func (b *Backend) setRateLimit(rps float64) error {
+	bucket, err := rl.NewBucket(int64(math.Max(1, math.Ceil(rps))), rps)
+	if err != nil {
+		return err
+	}
+	b.rateLimit = bucket
+	return nil
+}
+
+// MaxRPS возвращает лимит запросов в секунду к бэкенду (0 - без ограничения).
+func (b *Backend) MaxRPS() float64 {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.maxRPS
+}
+
+// takeRateToken расходует токен лимита бэкенда. Возвращает false, если лимит исчерпан.
+// Для бэкендов без лимита всегда возвращает true. Вызывающий должен удерживать s.mu пула.
+func (b *Backend) takeRateToken() bool {
+	if b.rateLimit == nil || b.rateLimit.Allow() {
+		return true
+	}
+	backendRateLimitedTotal.With(b.Name()).Inc()
+	return false
+}
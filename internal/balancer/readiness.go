@@ -0,0 +1,85 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// StartupGate задает условие готовности пула после запуска: пул готов, когда не менее
+// MinHealthy бэкендов успешно прошли первую проверку состояния, или по истечении Timeout.
+type StartupGate struct {
+	MinHealthy int           // Минимум доступных бэкендов (0 - пул готов сразу).
+	Timeout    time.Duration // Предельное время ожидания (должно быть положительным при MinHealthy > 0).
+}
+
+// SetStartupGate задает условие готовности пула; отсчет Timeout начинается с вызова.
+// Вызывается при запуске, до HealthCheck.
+func (s *ServerPool) SetStartupGate(gate StartupGate) error {
+	if gate.MinHealthy < 0 {
+		return fmt.Errorf("min healthy backends must not be negative")
+	}
+	if gate.MinHealthy > 0 && gate.Timeout <= 0 {
+		return fmt.Errorf("startup timeout must be positive")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gate.MinHealthy > len(s.backends) {
+		return fmt.Errorf("min healthy backends %d exceeds the number of backends %d", gate.MinHealthy, len(s.backends))
+	}
+	s.startupGate = gate
+	s.startupSince = time.Now()
+	return nil
+}
+
+// Ready сообщает, готов ли пул принимать трафик согласно StartupGate. Достигнутая готовность
+// сохраняется и при последующей недоступности бэкендов.
+func (s *ServerPool) Ready() bool {
+	if s.ready.Load() {
+		return true
+	}
+	s.mu.RLock()
+	gate, since := s.startupGate, s.startupSince
+	healthy := 0
+	for _, b := range s.backends {
+		if b.passedFirstCheck() {
+			healthy++
+		}
+	}
+	s.mu.RUnlock()
+
+	switch {
+	case healthy >= gate.MinHealthy:
+		if s.ready.CompareAndSwap(false, true) && gate.MinHealthy > 0 {
+			log.Printf("INFO: Pool is ready: %d backends healthy (required %d).", healthy, gate.MinHealthy)
+		}
+	case time.Since(since) >= gate.Timeout:
+		if s.ready.CompareAndSwap(false, true) {
+			log.Printf("WARN: Startup timeout %v expired with %d of %d required backends healthy. Marking pool ready.", gate.Timeout, healthy, gate.MinHealthy)
+		}
+	}
+	return s.ready.Load()
+}
+
+// WaitReady блокируется, пока пул не станет готов (см. Ready) или не будет отменен ctx.
+func (s *ServerPool) WaitReady(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !s.Ready() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// passedFirstCheck сообщает, проверен ли бэкенд хотя бы раз и доступен ли он.
+func (b *Backend) passedFirstCheck() bool {
+	b.mux.RLock()
+	checked := b.checked
+	b.mux.RUnlock()
+	return checked && b.IsAvailable()
+}
@@ -0,0 +1,207 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ErrBackendsManaged возвращается при замене списка бэкендов пула, состав которого
+// определяет внешний источник (DNS, реестр etcd, файл со списком бэкендов).
+var ErrBackendsManaged = errors.New("backends are managed by a discovery source")
+
+// DiscoveryManaged сообщает, определяет ли состав пула обнаружение бэкендов (DNS, реестр
+// etcd, файл со списком бэкендов), а не только список из конфигурации и Admin API.
+func (s *ServerPool) DiscoveryManaged() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.discoveryManagedLocked()
+}
+
+func (s *ServerPool) discoveryManagedLocked() bool {
+	return len(s.dnsSources) > 0 || s.etcd != nil || s.backendsFile != nil
+}
+
+// ReplaceResult описывает изменения, выполненные ReplaceBackends (имена бэкендов).
+type ReplaceResult struct {
+	Added     []string `json:"added"`
+	Updated   []string `json:"updated"` // Изменены лимиты или протокол, либо заменены бэкендом с новым URL.
+	Removed   []string `json:"removed"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// ReplaceBackends приводит состав пула к списку specs: отсутствующие в пуле бэкенды
+// добавляются, отсутствующие в списке удаляются с drain, а бэкенды с измененным URL
+// заменяются (новый бэкенд с тем же именем добавляется после drain прежнего). Измененные
+// max_rps, max_conns и протокол применяются к бэкенду на месте: он продолжает обслуживать
+// запросы. Бэкенды сопоставляются по имени (без имени - по каноническому идентификатору
+// URL). Список проверяется целиком до изменений: при ошибке пул не изменяется. Новые бэкенды
+// появляются в пуле и удаляемые выводятся из ротации одновременно; как и при AddBackend,
+// новые бэкенды получают трафик после успешной проверки состояния.
+// Возвращает ErrBackendsManaged для пула с обнаружением бэкендов, ErrBackendRemoving, если
+// бэкенд из списка конфликтует с бэкендом, который еще удаляется, и ErrDuplicateBackend,
+// если имя бэкенда из списка занято в другом пуле группы (см. JoinPools).
+func (s *ServerPool) ReplaceBackends(specs []BackendSpec, drainTimeout time.Duration) (ReplaceResult, error) {
+	result := ReplaceResult{Added: []string{}, Updated: []string{}, Removed: []string{}, Unchanged: []string{}}
+	desired := make([]*Backend, 0, len(specs))
+	names := make(map[string]bool, len(specs))
+	ids := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		backend, err := buildBackend(spec)
+		if err != nil {
+			return result, fmt.Errorf("backend %s: %w", spec.URL, err)
+		}
+		id := CanonicalID(backend.URL)
+		if names[backend.Name()] || ids[id] {
+			return result, fmt.Errorf("%w: %s (%s) is listed twice", ErrDuplicateBackend, backend.Name(), spec.URL)
+		}
+		names[backend.Name()], ids[id] = true, true
+		desired = append(desired, backend)
+	}
+
+	s.replaceMu.Lock()
+	defer s.replaceMu.Unlock()
+	unlock := s.lockGroup()
+	defer unlock()
+	for _, b := range desired {
+		if err := s.usedByOtherPool(b.Name()); err != nil {
+			return result, err
+		}
+	}
+	s.mu.Lock()
+	if s.discoveryManagedLocked() {
+		s.mu.Unlock()
+		return result, ErrBackendsManaged
+	}
+
+	byName := make(map[string]*Backend, len(s.backends))
+	byID := make(map[string]*Backend, len(s.backends))
+	for _, b := range s.backends {
+		byName[b.Name()] = b
+		byID[CanonicalID(b.URL)] = b
+	}
+	var removed []*Backend
+	// Новые бэкенды и удаляемые бэкенды с тем же именем или URL, после drain которых они добавляются.
+	waits := make(map[*Backend][]*Backend)
+	var added []*Backend
+	// Бэкенды пула, к которым применяются лимиты и протокол бэкендов из списка.
+	updates := make(map[*Backend]*Backend)
+	for _, b := range desired {
+		old := byName[b.Name()]
+		if old != nil && !old.isRemoving() && CanonicalID(old.URL) == CanonicalID(b.URL) {
+			if old.maxRPS == b.maxRPS && old.maxConns == b.maxConns && old.protocol == b.protocol {
+				result.Unchanged = append(result.Unchanged, b.Name())
+			} else {
+				result.Updated = append(result.Updated, b.Name())
+				updates[old] = b
+			}
+			continue
+		}
+		for _, conflict := range []*Backend{old, byID[CanonicalID(b.URL)]} {
+			if conflict == nil || slices.Contains(waits[b], conflict) {
+				continue
+			}
+			if conflict.isRemoving() {
+				s.mu.Unlock()
+				return ReplaceResult{}, fmt.Errorf("%w: %s", ErrBackendRemoving, conflict.Name())
+			}
+			// Бэкенд с тем же URL под другим именем не может остаться в пуле: его URL занят
+			// новым бэкендом, поэтому он удаляется или заменяется.
+			waits[b] = append(waits[b], conflict)
+		}
+		added = append(added, b)
+		if old != nil {
+			result.Updated = append(result.Updated, b.Name())
+			removed = append(removed, old)
+		} else {
+			result.Added = append(result.Added, b.Name())
+		}
+	}
+	for _, b := range s.backends {
+		if !names[b.Name()] && !b.isRemoving() {
+			result.Removed = append(result.Removed, b.Name())
+			removed = append(removed, b)
+			delete(s.disabled, b.Name())
+		}
+	}
+
+	for _, b := range removed {
+		b.startDraining("removed by backends replacement")
+	}
+	for b, next := range updates {
+		s.updateBackendLocked(b, next)
+	}
+	for _, b := range added {
+		if len(waits[b]) == 0 {
+			s.configureBackendLocked(b)
+			s.backends = append(s.backends, b)
+		}
+	}
+	s.mu.Unlock()
+
+	drained := make(map[*Backend]<-chan struct{}, len(removed))
+	for _, b := range removed {
+		drained[b] = s.finishRemoval(b, drainTimeout)
+	}
+	for b, conflicts := range waits {
+		go func() {
+			for _, old := range conflicts {
+				<-drained[old]
+			}
+			unlock := s.lockGroup()
+			defer unlock()
+			if err := s.usedByOtherPool(b.Name()); err != nil {
+				log.Printf("WARN: Backend %s (%s) was not added after replacement: %v", b.Name(), b.URL, err)
+				return
+			}
+			s.mu.Lock()
+			for _, other := range s.backends {
+				if other.Name() == b.Name() || CanonicalID(other.URL) == CanonicalID(b.URL) {
+					// Бэкенд добавлен другим способом (например, POST /admin/backends) во время drain.
+					s.mu.Unlock()
+					log.Printf("WARN: Backend %s (%s) was not added after replacement: %s is already in the pool", b.Name(), b.URL, other.Name())
+					return
+				}
+			}
+			s.configureBackendLocked(b)
+			s.backends = append(s.backends, b)
+			s.mu.Unlock()
+			log.Printf("INFO: Added backend %s after drain of the backend it replaces: %s", b.Name(), b.URL)
+			s.wakeHealthCheck()
+		}()
+	}
+	log.Printf("INFO: Backends replaced: %d added, %d updated, %d removed, %d unchanged",
+		len(result.Added), len(result.Updated), len(result.Removed), len(result.Unchanged))
+	s.wakeHealthCheck()
+	return result, nil
+}
+
+// updateBackendLocked применяет к бэкенду пула b лимиты и протокол бэкенда next с тем же URL.
+// Бэкенд остается в ротации; при смене протокола запросы направляются через новый Transport
+// (протоколы Transport фиксируются при первом запросе), а простаивающие соединения прежнего
+// закрываются. Вызывающий должен удерживать s.mu.
+func (s *ServerPool) updateBackendLocked(b, next *Backend) {
+	b.mux.Lock()
+	b.rateLimit, b.maxRPS, b.maxConns = next.rateLimit, next.maxRPS, next.maxConns
+	var stale *http.Transport
+	if b.protocol != next.protocol {
+		b.protocol = next.protocol
+		if transport, ok := b.ReverseProxy.Transport.(*http.Transport); ok {
+			replacement := http.DefaultTransport.(*http.Transport).Clone()
+			b.applyProxyTransport(replacement)
+			s.configureTransportLocked(b, replacement)
+			proxy := *b.ReverseProxy
+			proxy.Transport = replacement
+			b.ReverseProxy = &proxy
+			stale = transport
+		}
+	}
+	b.mux.Unlock()
+	if stale != nil {
+		stale.CloseIdleConnections()
+	}
+	log.Printf("INFO: Backend %s updated in place: max_rps %g, max_conns %d, protocol %s", b.Name(), next.maxRPS, next.maxConns, b.Protocol())
+}
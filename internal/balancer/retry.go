@@ -0,0 +1,201 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var upstreamRetriesTotal = metrics.NewCounterVec("lb_upstream_retries_total",
+	"Requests retried on another backend, by failed backend and reason (connect_error, status).", "backend", "reason")
+
+// errRetryStatus - ответ бэкенда со статусом из RetryPolicy.RetryStatuses, вместо которого
+// запрос повторяется на другом бэкенде.
+var errRetryStatus = errors.New("backend responded with retryable status")
+
+// RetryPolicy задает повтор запроса на другом бэкенде при ошибке соединения.
+type RetryPolicy struct {
+	MaxRetries int // Максимум повторов на других бэкендах (0 - повтор отключен).
+	// Тело запроса запоминается для повтора: первые MemoryBufferBytes - в памяти, остальное -
+	// во временном файле в TempDir ("" - системный каталог). Запрос с телом больше
+	// MaxBodyBytes не повторяется.
+	MemoryBufferBytes int64
+	MaxBodyBytes      int64
+	TempDir           string
+	// Статусы ответа бэкенда (например, 502, 503, 504), при которых идемпотентный запрос
+	// повторяется на другом бэкенде (пусто - ответы не повторяются).
+	RetryStatuses []int
+}
+
+// SetRetryPolicy задает повтор запросов. Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetRetryPolicy(policy RetryPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryPolicy = policy
+}
+
+// retrier сопровождает попытки обработки одного запроса.
+type retrier struct {
+	pool       *ServerPool
+	req        *http.Request // Исходный запрос: по нему выбирается бэкенд для повтора.
+	policy     RetryPolicy
+	body       *replayableBody // nil - запрос без тела.
+	idempotent bool
+	retries    int
+	tried      []*Backend
+	current    *retryState
+	// Бэкенд для повтора, выбранный при проверке ответа со статусом из RetryStatuses.
+	pending *Backend
+}
+
+// retryState - состояние одной попытки, доступное обработчику ошибок прокси.
+type retryState struct {
+	r         *retrier
+	responded bool  // Получен ответ бэкенда: повтор невозможен.
+	err       error // Ошибка соединения, обработка которой отложена для повтора.
+}
+
+type retryKey struct{}
+
+// newRetrier возвращает retrier для запроса r или nil, если повтор отключен.
+func (s *ServerPool) newRetrier(r *http.Request) *retrier {
+	s.mu.RLock()
+	policy := s.retryPolicy
+	s.mu.RUnlock()
+	if policy.MaxRetries <= 0 {
+		return nil
+	}
+	rt := &retrier{pool: s, req: r, policy: policy, idempotent: isIdempotent(r)}
+	if r.Body != nil && r.Body != http.NoBody {
+		rt.body = newReplayableBody(r.Body, policy.MemoryBufferBytes, policy.MaxBodyBytes, policy.TempDir)
+	}
+	return rt
+}
+
+// isIdempotent сообщает, можно ли повторить запрос, который мог дойти до бэкенда
+// (по тем же правилам, что и http.Transport).
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != "" || r.Header.Get("X-Idempotency-Key") != ""
+}
+
+// prepare возвращает запрос очередной попытки на бэкенде peer.
+func (rt *retrier) prepare(r *http.Request, peer *Backend) *http.Request {
+	rt.tried = append(rt.tried, peer)
+	rt.current = &retryState{r: rt}
+	r = r.WithContext(context.WithValue(r.Context(), retryKey{}, rt.current))
+	if rt.body != nil {
+		r.Body = rt.body.attempt()
+		r.GetBody = nil
+	}
+	return r
+}
+
+// failed возвращает ошибку соединения текущей попытки, если ответ клиенту не отправлен и
+// запрос можно повторить.
+func (rt *retrier) failed() error {
+	return rt.current.err
+}
+
+// next выбирает бэкенд для повтора среди еще не использованных и возвращает тело запроса
+// к началу. Возвращает nil, если бэкендов не осталось.
+func (rt *retrier) next() *Backend {
+	failed := rt.tried[len(rt.tried)-1]
+	peer := rt.pending
+	rt.pending = nil
+	if peer == nil {
+		peer = rt.pick()
+	}
+	if peer == nil || (rt.body != nil && !rt.body.rewind()) {
+		return nil
+	}
+	rt.retries++
+	reason := "connect_error"
+	if errors.Is(rt.current.err, errRetryStatus) {
+		reason = "status"
+	}
+	upstreamRetriesTotal.With(failed.Name(), reason).Inc()
+	return peer
+}
+
+// pick выбирает бэкенд пула среди еще не использованных для запроса (nil - таких нет).
+func (rt *retrier) pick() *Backend {
+	return rt.pool.NextPeer(rt.req.WithContext(context.WithValue(rt.req.Context(), excludeKey{}, rt.tried)))
+}
+
+// close освобождает буфер тела запроса.
+func (rt *retrier) close() {
+	if rt.body != nil {
+		rt.body.release()
+	}
+}
+
+// deferError сообщает обработчику ошибок прокси, следует ли вместо ответа клиенту
+// повторить запрос на другом бэкенде. Повторяется запрос, не дошедший до бэкенда (ошибка
+// установки соединения), а идемпотентный - и при другой ошибке до получения ответа.
+func (st *retryState) deferError(err error) bool {
+	rt := st.r
+	if st.responded || rt.retries >= rt.policy.MaxRetries || errors.Is(err, errStaleAttempt) {
+		return false
+	}
+	if !rt.idempotent && !isConnectError(err) {
+		return false
+	}
+	if rt.body != nil && !rt.body.replayable() {
+		return false
+	}
+	st.err = err
+	return true
+}
+
+// retryResponse проверяет ответ бэкенда resp: если его статус входит в RetryStatuses,
+// идемпотентный запрос можно повторить и в пуле есть еще не использованный бэкенд, возвращает
+// ошибку errRetryStatus - ответ отбрасывается, и запрос повторяется на этом бэкенде. Иначе
+// ответ передается клиенту.
+func (st *retryState) retryResponse(resp *http.Response) error {
+	rt := st.r
+	if !slices.Contains(rt.policy.RetryStatuses, resp.StatusCode) || !rt.idempotent ||
+		rt.retries >= rt.policy.MaxRetries || (rt.body != nil && !rt.body.replayable()) {
+		st.responded = true
+		return nil
+	}
+	if rt.pending = rt.pick(); rt.pending == nil {
+		st.responded = true
+		return nil
+	}
+	st.err = fmt.Errorf("%w %d", errRetryStatus, resp.StatusCode)
+	return st.err
+}
+
+// isConnectError сообщает, произошла ли ошибка при установке соединения с бэкендом или
+// egress-прокси, то есть до отправки запроса.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// retryStateFrom возвращает состояние попытки запроса r (nil - повтор не используется).
+func retryStateFrom(r *http.Request) *retryState {
+	st, _ := r.Context().Value(retryKey{}).(*retryState)
+	return st
+}
+
+type excludeKey struct{}
+
+// retryExcludes сообщает, исключен ли бэкенд b из выбора для запроса r, потому что запрос
+// уже не удался на нем.
+func retryExcludes(r *http.Request, b *Backend) bool {
+	if r == nil {
+		return false
+	}
+	tried, _ := r.Context().Value(excludeKey{}).([]*Backend)
+	return slices.Contains(tried, b)
+}
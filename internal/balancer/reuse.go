@@ -0,0 +1,68 @@
+package balancer
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync/atomic"
+)
+
+// connReuseCounters считает соединения с бэкендом и TLS-рукопожатия по типам с момента
+// создания бэкенда. См. ConnReuse.
+type connReuseCounters struct {
+	newConns    atomic.Int64
+	reusedConns atomic.Int64
+	tlsFull     atomic.Int64
+	tlsResumed  atomic.Int64
+}
+
+// ConnReuseStats - переиспользование соединений с бэкендом с момента его создания.
+type ConnReuseStats struct {
+	NewConnections    int64 // Запросы, для которых установлено новое соединение.
+	ReusedConnections int64 // Запросы по keep-alive соединению.
+	FullHandshakes    int64 // Полные TLS-рукопожатия.
+	ResumedHandshakes int64 // TLS-рукопожатия с возобновлением сессии.
+}
+
+// KeepAliveReuseRatio возвращает долю запросов, отправленных по keep-alive соединению
+// (false - запросов еще не было).
+func (s ConnReuseStats) KeepAliveReuseRatio() (float64, bool) {
+	total := s.NewConnections + s.ReusedConnections
+	if total == 0 {
+		return 0, false
+	}
+	return float64(s.ReusedConnections) / float64(total), true
+}
+
+// TLSResumptionRatio возвращает долю TLS-рукопожатий с возобновлением сессии
+// (false - рукопожатий еще не было, например, у бэкенда без TLS).
+func (s ConnReuseStats) TLSResumptionRatio() (float64, bool) {
+	total := s.FullHandshakes + s.ResumedHandshakes
+	if total == 0 {
+		return 0, false
+	}
+	return float64(s.ResumedHandshakes) / float64(total), true
+}
+
+// ConnReuse возвращает статистику переиспользования соединений с бэкендом. Низкая доля
+// keep-alive или возобновленных TLS-сессий указывает на бэкенд, который закрывает соединения
+// после каждого ответа или не поддерживает возобновление сессий.
+func (b *Backend) ConnReuse() ConnReuseStats {
+	return ConnReuseStats{
+		NewConnections:    b.reuse.newConns.Load(),
+		ReusedConnections: b.reuse.reusedConns.Load(),
+		FullHandshakes:    b.reuse.tlsFull.Load(),
+		ResumedHandshakes: b.reuse.tlsResumed.Load(),
+	}
+}
+
+// applySessionCache включает возобновление TLS-сессий для соединений с https-бэкендом:
+// без кеша сессий каждое новое соединение выполняет полное рукопожатие.
+func (b *Backend) applySessionCache(t *http.Transport) {
+	if b.URL.Scheme != "https" {
+		return
+	}
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.ClientSessionCache = b.tlsSessions
+}
@@ -0,0 +1,127 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+)
+
+// PathRewrite изменяет путь запроса, передаваемого бэкенду, для запросов с путем,
+// начинающимся с PathPrefix на границе сегмента ("/api" подходит для "/api" и "/api/users",
+// но не для "/apix"). Действия выполняются в порядке: удаление префикса, добавление
+// префикса, замена по регулярному выражению. Путь, по которому выбираются пул, маршрут
+// и правила middleware, не изменяется.
+type PathRewrite struct {
+	PathPrefix  string
+	StripPrefix bool   // Удалить PathPrefix из пути ("/api/v1/users" -> "/users").
+	AddPrefix   string // Добавить префикс к пути ("/users" -> "/internal/users").
+	// Регулярное выражение для пути и замена ($1 - группы выражения, "" - без замены).
+	Regex       string
+	Replacement string
+
+	regex         *regexp.Regexp
+	escapedPrefix string
+}
+
+// compile проверяет правило и подготавливает его к применению.
+func (rw *PathRewrite) compile() error {
+	if !strings.HasPrefix(rw.PathPrefix, "/") {
+		return fmt.Errorf("path prefix %q must start with '/'", rw.PathPrefix)
+	}
+	if rw.AddPrefix != "" && !strings.HasPrefix(rw.AddPrefix, "/") {
+		return fmt.Errorf("added prefix %q must start with '/'", rw.AddPrefix)
+	}
+	if !rw.StripPrefix && rw.AddPrefix == "" && rw.Regex == "" {
+		return errors.New("rewrite must strip or add a prefix or set a regex")
+	}
+	if rw.Regex != "" {
+		re, err := regexp.Compile(rw.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %w", rw.Regex, err)
+		}
+		rw.regex = re
+	}
+	rw.escapedPrefix = (&url.URL{Path: rw.PathPrefix}).EscapedPath()
+	return nil
+}
+
+// matches сообщает, подходит ли правило для экранированного пути path (см. httputil.PathHasPrefix).
+func (rw *PathRewrite) matches(path string) bool {
+	return httputil_pkg.PathHasPrefix(path, rw.escapedPrefix)
+}
+
+// apply изменяет путь URL u, для которого подходит правило. Правило применяется
+// к экранированному пути, чтобы сохранить экранированные символы (например, %2F) при передаче
+// бэкенду. Возвращает удаленный префикс.
+func (rw *PathRewrite) apply(u *url.URL) string {
+	path := u.EscapedPath()
+	stripped := ""
+	if rw.StripPrefix {
+		path = strings.TrimPrefix(path, rw.escapedPrefix)
+		stripped = strings.TrimSuffix(rw.PathPrefix, "/")
+	}
+	if rw.AddPrefix != "" {
+		path = strings.TrimSuffix(rw.AddPrefix, "/") + "/" + strings.TrimPrefix(path, "/")
+	}
+	if rw.regex != nil {
+		path = rw.regex.ReplaceAllString(path, rw.Replacement)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return ""
+	}
+	u.Path, u.RawPath = unescaped, path
+	return stripped
+}
+
+// SetPathRewrites задает правила изменения пути запросов к бэкендам пула. Применяется правило
+// с самым длинным подходящим префиксом. Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetPathRewrites(rules []PathRewrite) error {
+	compiled := make([]PathRewrite, len(rules))
+	copy(compiled, rules)
+	for i := range compiled {
+		if err := compiled[i].compile(); err != nil {
+			return fmt.Errorf("path rewrite %s: %w", compiled[i].PathPrefix, err)
+		}
+	}
+	sort.SliceStable(compiled, func(i, j int) bool { return len(compiled[i].PathPrefix) > len(compiled[j].PathPrefix) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pathRewrites = compiled
+	for _, b := range s.backends {
+		b.pathRewrites = compiled
+	}
+	return nil
+}
+
+// rewritePath изменяет путь исходящего запроса по первому подходящему правилу бэкенда.
+// Правило выбирается по тому же экранированному пути, из которого удаляется префикс.
+// Удаленный префикс передается бэкенду в заголовке X-Forwarded-Prefix, чтобы он мог строить
+// внешние ссылки; если префикс не удалялся, присланный клиентом заголовок удаляется, чтобы
+// бэкенд не строил ссылки по подделанному значению. Вызывается до объединения пути запроса
+// с путем из URL бэкенда.
+func (b *Backend) rewritePath(req *http.Request) {
+	path := req.URL.EscapedPath()
+	for i := range b.pathRewrites {
+		rw := &b.pathRewrites[i]
+		if !rw.matches(path) {
+			continue
+		}
+		if stripped := rw.apply(req.URL); stripped != "" {
+			req.Header.Set("X-Forwarded-Prefix", stripped)
+			return
+		}
+		break
+	}
+	req.Header.Del("X-Forwarded-Prefix")
+}
@@ -0,0 +1,25 @@
+package balancer
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+type routeKey struct{}
+
+// WithRoute возвращает запрос, для которого бэкенд выбирается только среди бэкендов
+// с именами names (например, по правилу маршрутизации). Если ни один из них не доступен,
+// запрос не направляется на другие бэкенды.
+func WithRoute(r *http.Request, names []string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, names))
+}
+
+// routeAllows сообщает, может ли запрос r быть направлен на бэкенд b (см. WithRoute).
+func routeAllows(r *http.Request, b *Backend) bool {
+	if r == nil {
+		return true
+	}
+	names, ok := r.Context().Value(routeKey{}).([]string)
+	return !ok || slices.Contains(names, b.Name())
+}
@@ -0,0 +1,147 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var slowRequestsTotal = metrics.NewCounterVec("lb_slow_requests_total",
+	"Proxied requests exceeding the slow request threshold, per backend.", "backend")
+
+// SlowRequestPolicy задает порог медленных запросов. Запросы, обработка которых заняла
+// не меньше Threshold, записываются в лог с подробными таймингами.
+type SlowRequestPolicy struct {
+	Threshold time.Duration // 0 - отключено.
+	// SampledTraceResponse - если ответ бэкенда получен позже Threshold, ответ клиенту получает
+	// заголовок traceresponse с флагом sampled. Балансировщик сам не записывает трассировки:
+	// заголовок лишь сообщает клиенту и его трассировщику, что трассировку стоит сохранить.
+	SampledTraceResponse bool
+}
+
+// SetSlowRequestPolicy устанавливает порог медленных запросов для всех бэкендов пула.
+// Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetSlowRequestPolicy(policy SlowRequestPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slowRequests = policy
+	for _, b := range s.backends {
+		b.slowRequests = policy
+	}
+}
+
+// requestTimings собирает тайминги проксирования запроса через httptrace.
+type requestTimings struct {
+	start        time.Time
+	mu           sync.Mutex
+	connectStart time.Time
+	dial         time.Duration // Время установки TCP-соединения (0 - соединение переиспользовано).
+	ttfb         time.Duration // Время до первого байта ответа бэкенда.
+	reused       bool
+}
+
+type timingsKey struct{}
+
+func (t *requestTimings) connectStarted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connectStart = time.Now()
+}
+
+func (t *requestTimings) connectDone() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.connectStart.IsZero() {
+		t.dial = time.Since(t.connectStart)
+	}
+}
+
+func (t *requestTimings) gotConn(reused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reused = reused
+}
+
+func (t *requestTimings) gotFirstByte() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ttfb = time.Since(t.start)
+}
+
+func (t *requestTimings) snapshot() (dial, ttfb time.Duration, reused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dial, t.ttfb, t.reused
+}
+
+// timingsFromContext возвращает тайминги запроса или nil, если они не собираются.
+func timingsFromContext(ctx context.Context) *requestTimings {
+	t, _ := ctx.Value(timingsKey{}).(*requestTimings)
+	return t
+}
+
+// startTimings начинает сбор таймингов запроса, если задан порог медленных запросов.
+func (b *Backend) startTimings(r *http.Request) (*http.Request, *requestTimings) {
+	if b.slowRequests.Threshold <= 0 {
+		return r, nil
+	}
+	t := &requestTimings{start: time.Now()}
+	return r.WithContext(context.WithValue(r.Context(), timingsKey{}, t)), t
+}
+
+// logIfSlow записывает в лог запрос, превысивший порог медленных запросов.
+func (b *Backend) logIfSlow(r *http.Request, t *requestTimings) {
+	if t == nil {
+		return
+	}
+	total := time.Since(t.start)
+	if total < b.slowRequests.Threshold {
+		return
+	}
+	slowRequestsTotal.With(b.Name()).Inc()
+	dial, ttfb, reused := t.snapshot()
+	conn := "new"
+	if reused {
+		conn = "reused"
+	}
+	log.Printf("WARN: Slow request [%s %s] from %s to backend %s: total %v, ttfb %v, dial %v (%s connection), retries %d (threshold %v)",
+		r.Method, r.URL.Path, r.RemoteAddr, b.Name(), total, ttfb, dial, conn, GetRetryFromContext(r), b.slowRequests.Threshold)
+}
+
+// setSampledTraceResponse добавляет к медленному ответу заголовок traceresponse: если ответ
+// бэкенда получен позже порога, а запрос содержит W3C traceparent, ответ получает заголовок
+// с тем же trace-id и флагом sampled. Используется в ReverseProxy.ModifyResponse.
+func (b *Backend) setSampledTraceResponse(resp *http.Response) {
+	if !b.slowRequests.SampledTraceResponse || resp.Request == nil {
+		return
+	}
+	t := timingsFromContext(resp.Request.Context())
+	if t == nil || time.Since(t.start) < b.slowRequests.Threshold {
+		return
+	}
+	if sampled, ok := sampledTraceparent(resp.Request.Header.Get("traceparent")); ok {
+		resp.Header.Set("traceresponse", sampled)
+	}
+}
+
+// sampledTraceparent возвращает traceparent (version-traceid-parentid-flags) с установленным
+// флагом sampled. Второе значение равно false, если заголовок отсутствует или некорректен.
+func sampledTraceparent(traceparent string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return "", false
+	}
+	parts[3] = fmt.Sprintf("%02x", flags|0x01)
+	return strings.Join(parts, "-"), true
+}
@@ -0,0 +1,58 @@
+package balancer
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// SetSlowStart задает окно медленного старта: бэкенд, вернувшийся в ротацию после
+// недоступности, получает долю трафика, линейно растущую от нуля до полной за window.
+// Это дает бэкенду прогреться (JIT, пулы соединений), а не принять полную нагрузку
+// сразу после первой успешной проверки. Бэкенды, впервые вошедшие в ротацию при запуске,
+// получают трафик сразу. 0 - отключено. Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetSlowStart(window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slowStart = window
+}
+
+// SlowStartWeight возвращает долю трафика (от 0 до 1), которую бэкенд получает в окне
+// медленного старта пула; 1 - бэкенд не в медленном старте.
+func (s *ServerPool) SlowStartWeight(b *Backend) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return b.slowStartWeight(s.slowStart, time.Now())
+}
+
+// slowStartWeight вычисляет долю трафика бэкенда в окне медленного старта window.
+func (b *Backend) slowStartWeight(window time.Duration, now time.Time) float64 {
+	if window <= 0 {
+		return 1
+	}
+	b.mux.RLock()
+	returned, since := b.returnedSince, b.servingSince
+	b.mux.RUnlock()
+	if !returned {
+		return 1
+	}
+	elapsed := now.Sub(since)
+	if elapsed >= window {
+		return 1
+	}
+	return float64(elapsed) / float64(window)
+}
+
+// admitSlowStart решает, принимает ли бэкенд в медленном старте очередной запрос:
+// запрос принимается с вероятностью, равной текущей доле трафика бэкенда.
+func (b *Backend) admitSlowStart(window time.Duration, now time.Time) bool {
+	weight := b.slowStartWeight(window, now)
+	return weight >= 1 || rand.Float64() < weight
+}
+
+// markServingLocked фиксирует переход бэкенда в обслуживающее состояние для медленного
+// старта. Вызывающий должен удерживать b.mux.
+func (b *Backend) markServingLocked(now time.Time) {
+	b.returnedSince = b.everServed
+	b.everServed = true
+	b.servingSince = now
+}
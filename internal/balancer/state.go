@@ -0,0 +1,182 @@
+package balancer
+
+import (
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+// HealthState - состояние бэкенда с точки зрения балансировщика.
+type HealthState string
+
+// Возможные состояния бэкенда.
+const (
+	// StateHealthy - проверки проходят, бэкенд получает трафик.
+	StateHealthy HealthState = "healthy"
+	// StateDegraded - проверки проходят, но с признаками проблем (например, медленный ответ).
+	// Бэкенд продолжает получать трафик.
+	StateDegraded HealthState = "degraded"
+	// StateUnhealthy - проверки не проходят (или бэкенд удерживается после нестабильности).
+	StateUnhealthy HealthState = "unhealthy"
+	// StateDraining - бэкенд выводится из пула: новые запросы не направляются.
+	StateDraining HealthState = "draining"
+	// StateAdminDown - бэкенд выключен администратором, результаты проверок игнорируются.
+	StateAdminDown HealthState = "admin_down"
+)
+
+var allStates = []HealthState{StateHealthy, StateDegraded, StateUnhealthy, StateDraining, StateAdminDown}
+
+var backendStateGauge = metrics.NewGaugeVec("lb_backend_state",
+	"Current backend state (1 for the active state, 0 otherwise).", "backend", "state")
+
+// Serving сообщает, получает ли бэкенд в этом состоянии новые запросы.
+func (s HealthState) Serving() bool {
+	return s == StateHealthy || s == StateDegraded
+}
+
+// StateInfo - снимок состояния бэкенда с причиной последнего перехода.
+type StateInfo struct {
+	State  HealthState `json:"state"`
+	Reason string      `json:"reason"`
+	Since  time.Time   `json:"since"`
+}
+
+// effectiveStateLocked вычисляет итоговое состояние: административное выключение
+// и drain имеют приоритет над результатом проверок. Вызывающий должен удерживать b.mux.
+func (b *Backend) effectiveStateLocked() HealthState {
+	switch {
+	case b.adminDown:
+		return StateAdminDown
+	case b.draining:
+		return StateDraining
+	default:
+		return b.checkState
+	}
+}
+
+// updateStateLocked пересчитывает итоговое состояние и, если оно изменилось, фиксирует переход
+// с указанной причиной в истории и метриках. Вызывающий должен удерживать b.mux.
+// Возвращает true, если изменился признак Serving (бэкенд вошел в ротацию или вышел из нее).
+func (b *Backend) updateStateLocked(reason string, now time.Time) bool {
+	newState := b.effectiveStateLocked()
+	if newState == b.state {
+		return false
+	}
+	oldState := b.state
+	b.state = newState
+	b.reason = reason
+	b.stateSince = now
+
+	servingChanged := oldState.Serving() != newState.Serving()
+	if servingChanged && newState.Serving() {
+		b.markServingLocked(now)
+	}
+	b.history.add(HealthTransition{
+		Time:         now,
+		Alive:        newState.Serving(),
+		State:        newState,
+		Reason:       reason,
+		aliveChanged: servingChanged,
+	})
+	if b.URL != nil {
+		for _, st := range allStates {
+			v := 0.0
+			if st == newState {
+				v = 1
+			}
+			backendStateGauge.With(b.Name(), string(st)).Set(v)
+		}
+	}
+	return servingChanged
+}
+
+// setCheckStateLocked записывает результат проверки. Вызывающий должен удерживать b.mux.
+func (b *Backend) setCheckStateLocked(state HealthState, reason string, now time.Time) bool {
+	b.checkState = state
+	b.availability.set(state.Serving(), now)
+	return b.updateStateLocked(reason, now)
+}
+
+// State возвращает текущее состояние бэкенда и причину последнего перехода.
+func (b *Backend) State() StateInfo {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return StateInfo{State: b.state, Reason: b.reason, Since: b.stateSince}
+}
+
+// SetAdminDown включает или выключает административное отключение бэкенда.
+// Выключенный бэкенд не получает трафик независимо от результатов проверок.
+func (b *Backend) SetAdminDown(down bool, reason string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.adminDown = down
+	b.updateStateLocked(reason, time.Now())
+}
+
+// AdminDown сообщает, выключен ли бэкенд администратором (см. ServerPool.SetBackendEnabled).
+func (b *Backend) AdminDown() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.adminDown
+}
+
+// isRemoving сообщает, удаляется ли бэкенд из пула (см. RemoveBackend).
+func (b *Backend) isRemoving() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.removing
+}
+
+// startDraining переводит бэкенд в режим drain перед удалением. Бэкенд, уже находящийся в
+// режиме обслуживания, продолжает drain. Возвращает false, если бэкенд уже удаляется.
+func (b *Backend) startDraining(reason string) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.removing {
+		return false
+	}
+	b.removing = true
+	if !b.draining {
+		b.draining, b.drainComplete = true, false
+		b.drainGen++
+	}
+	b.updateStateLocked(reason, time.Now())
+	return true
+}
+
+// setDraining включает или выключает режим drain для обслуживания бэкенда (без удаления).
+// Возвращает номер нового цикла drain.
+func (b *Backend) setDraining(drain bool, reason string) (uint64, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	switch {
+	case b.removing:
+		return 0, ErrBackendRemoving
+	case drain && b.draining:
+		return 0, ErrBackendDraining
+	case !drain && !b.draining:
+		return 0, ErrBackendNotDraining
+	}
+	b.draining, b.drainComplete = drain, false
+	b.drainGen++
+	b.updateStateLocked(reason, time.Now())
+	return b.drainGen, nil
+}
+
+// completeDrain отмечает завершение цикла drain gen, если он еще текущий.
+func (b *Backend) completeDrain(gen uint64) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if !b.draining || b.drainGen != gen {
+		return false
+	}
+	b.drainComplete = true
+	return true
+}
+
+// drainGeneration возвращает номер текущего цикла drain.
+func (b *Backend) drainGeneration() uint64 {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.drainGen
+}
@@ -0,0 +1,153 @@
+package balancer
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+)
+
+// StaticResponse - статический ответ, который отдается вместо проксирования запросов с путем,
+// начинающимся с PathPrefix, когда маршрут переведен в "мягко отключенный" режим (например,
+// при выводе эндпоинта из эксплуатации).
+type StaticResponse struct {
+	PathPrefix string            `json:"path_prefix"`
+	Status     int               `json:"status"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// Validate проверяет корректность статического ответа. Ошибки полей возвращаются
+// как httputil.ValidationErrors.
+func (sr *StaticResponse) Validate() error {
+	var errs httputil_pkg.ValidationErrors
+	if !strings.HasPrefix(sr.PathPrefix, "/") {
+		errs.Add("path_prefix", "must start with /", sr.PathPrefix)
+	}
+	if sr.Status < 100 || sr.Status > 599 {
+		errs.Add("status", "must be between 100 and 599", sr.Status)
+	}
+	for name, value := range sr.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			errs.Add("headers", "must have valid header names", name)
+		} else if strings.ContainsAny(value, "\r\n") {
+			errs.Add("headers."+name, "must not contain line breaks", value)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ServeHTTP отдает статический ответ. Успешный (2xx) ответ получает сильный ETag
+// (если он не задан в Headers), а условные запросы с совпадающим If-None-Match
+// получают 304 Not Modified.
+func (sr *StaticResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for name, value := range sr.Headers {
+		w.Header().Set(name, value)
+	}
+	if sr.Status >= 200 && sr.Status < 300 {
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			etag = httputil_pkg.StrongETag([]byte(sr.Body))
+			w.Header().Set("ETag", etag)
+		}
+		if httputil_pkg.NotModified(r, etag, time.Time{}) {
+			httputil_pkg.WriteNotModified(w, w.Header())
+			return
+		}
+	}
+	w.WriteHeader(sr.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write([]byte(sr.Body))
+	}
+}
+
+// SetStaticResponse переводит маршрут sr.PathPrefix в режим статического ответа, заменяя
+// прежний ответ с тем же префиксом. Бэкенды и проверки состояния при этом продолжают работать.
+func (s *ServerPool) SetStaticResponse(sr *StaticResponse) error {
+	if err := sr.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	responses := slices.DeleteFunc(s.StaticResponses(), func(current *StaticResponse) bool {
+		return current.PathPrefix == sr.PathPrefix
+	})
+	responses = append(responses, sr)
+	// Запрос обслуживает ответ с самым длинным подходящим префиксом.
+	slices.SortFunc(responses, func(a, b *StaticResponse) int {
+		if len(a.PathPrefix) != len(b.PathPrefix) {
+			return len(b.PathPrefix) - len(a.PathPrefix)
+		}
+		return strings.Compare(a.PathPrefix, b.PathPrefix)
+	})
+	s.staticResponses.Store(&responses)
+	return nil
+}
+
+// RemoveStaticResponse возвращает проксирование для маршрута prefix. Возвращает false, если
+// статический ответ для него не задан.
+func (s *ServerPool) RemoveStaticResponse(prefix string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	responses := s.StaticResponses()
+	n := len(responses)
+	responses = slices.DeleteFunc(responses, func(current *StaticResponse) bool { return current.PathPrefix == prefix })
+	if len(responses) == n {
+		return false
+	}
+	s.staticResponses.Store(&responses)
+	return true
+}
+
+// StaticResponses возвращает копию списка статических ответов по убыванию длины префикса.
+func (s *ServerPool) StaticResponses() []*StaticResponse {
+	responses := s.staticResponses.Load()
+	if responses == nil {
+		return []*StaticResponse{}
+	}
+	return slices.Clone(*responses)
+}
+
+// WithStaticResponses возвращает обработчик, который отдает статические ответы пула s раньше
+// next. Используется перед выбором пула (см. NewPoolRouter), чтобы статические ответы
+// основного пула действовали для запросов, направляемых в любой пул.
+func (s *ServerPool) WithStaticResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.serveStaticResponse(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serveStaticResponse отдает статический ответ, если маршрут запроса r переведен в режим
+// статического ответа. Возвращает false, если запрос нужно проксировать.
+func (s *ServerPool) serveStaticResponse(w http.ResponseWriter, r *http.Request) bool {
+	static := s.staticResponseFor(r.URL.Path)
+	if static == nil {
+		return false
+	}
+	log.Printf("INFO: Serving static response %d for request [%s %s]", static.Status, r.Method, r.URL.Path)
+	static.ServeHTTP(w, r)
+	return true
+}
+
+// staticResponseFor возвращает статический ответ для пути path или nil, если маршрут
+// проксируется. Префикс сравнивается по границе сегмента, как в маршрутах пулов.
+func (s *ServerPool) staticResponseFor(path string) *StaticResponse {
+	responses := s.staticResponses.Load()
+	if responses == nil {
+		return nil
+	}
+	for _, sr := range *responses {
+		if httputil_pkg.PathHasPrefix(path, sr.PathPrefix) {
+			return sr
+		}
+	}
+	return nil
+}
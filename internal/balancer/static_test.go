@@ -0,0 +1,127 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServerPool_StaticResponses проверяет, что статический ответ заменяет проксирование только
+// для своего маршрута, а запрос обслуживает ответ с самым длинным префиксом.
+func TestServerPool_StaticResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL.Path)
+	}))
+	defer upstream.Close()
+	pool, err := NewServerPool([]string{upstream.URL}, time.Second, time.Second)
+	require.NoError(t, err)
+	pool.GetBackends()[0].SetAlive(true, "test")
+	handler := NewLoadBalancerHandler(pool)
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	require.NoError(t, pool.SetStaticResponse(&StaticResponse{PathPrefix: "/api/", Status: http.StatusServiceUnavailable, Body: "maintenance"}))
+	require.NoError(t, pool.SetStaticResponse(&StaticResponse{PathPrefix: "/api/v1/", Status: http.StatusGone, Headers: map[string]string{"X-Retired": "v1"}, Body: "retired"}))
+
+	rr := serve("/api/v1/users")
+	assert.Equal(t, http.StatusGone, rr.Code, "Longest prefix wins")
+	assert.Equal(t, "v1", rr.Header().Get("X-Retired"))
+	assert.Equal(t, "retired", rr.Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/api/v2/users").Code)
+	assert.Equal(t, "proxied /web/index", serve("/web/index").Body.String(), "Other routes are proxied")
+
+	require.NoError(t, pool.SetStaticResponse(&StaticResponse{PathPrefix: "/health", Status: http.StatusOK, Body: "ok"}))
+	assert.Equal(t, "ok", serve("/health").Body.String())
+	assert.Equal(t, "ok", serve("/health/live").Body.String())
+	assert.Equal(t, "proxied /healthz", serve("/healthz").Body.String(), "Prefix matches on a segment boundary")
+	assert.True(t, pool.RemoveStaticResponse("/health"))
+
+	require.NoError(t, pool.SetStaticResponse(&StaticResponse{PathPrefix: "/api/v1/", Status: http.StatusNotFound}))
+	assert.Equal(t, http.StatusNotFound, serve("/api/v1/users").Code, "Response for the same prefix is replaced")
+	prefixes := []string{}
+	for _, sr := range pool.StaticResponses() {
+		prefixes = append(prefixes, sr.PathPrefix)
+	}
+	assert.Equal(t, []string{"/api/v1/", "/api/"}, prefixes)
+
+	assert.True(t, pool.RemoveStaticResponse("/api/"))
+	assert.False(t, pool.RemoveStaticResponse("/api/"))
+	assert.Equal(t, "proxied /api/v2/users", serve("/api/v2/users").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve("/api/v1/users").Code)
+}
+
+// TestStaticResponse_Validate проверяет отклонение некорректных статических ответов.
+func TestStaticResponse_Validate(t *testing.T) {
+	assert.NoError(t, (&StaticResponse{PathPrefix: "/", Status: http.StatusOK}).Validate())
+
+	var errs httputil_pkg.ValidationErrors
+	err := (&StaticResponse{PathPrefix: "api", Status: 99, Headers: map[string]string{"Bad Name": "x", "X-Ok": "a\r\nb"}}).Validate()
+	require.ErrorAs(t, err, &errs)
+	fields := []string{}
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	assert.ElementsMatch(t, []string{"path_prefix", "status", "headers", "headers.X-Ok"}, fields)
+}
+
+// TestStaticResponse_ETag проверяет ETag успешного ответа и 304 для условного запроса.
+func TestStaticResponse_ETag(t *testing.T) {
+	sr := &StaticResponse{PathPrefix: "/", Status: http.StatusOK, Body: "hello"}
+	rr := httptest.NewRecorder()
+	sr.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "hello", rr.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	sr.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	sr.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String(), "HEAD gets no body")
+}
+
+// TestServerPool_WithStaticResponses проверяет, что статические ответы основного пула
+// действуют и для запросов, направляемых маршрутами в другие пулы.
+func TestServerPool_WithStaticResponses(t *testing.T) {
+	newPool := func(name string) *ServerPool {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+		}))
+		t.Cleanup(upstream.Close)
+		pool, err := NewNamedServerPool([]BackendSpec{{Name: name, URL: upstream.URL}}, time.Second, time.Second)
+		require.NoError(t, err)
+		pool.GetBackends()[0].SetAlive(true, "test")
+		return pool
+	}
+	mainPool, api := newPool("main"), newPool("api")
+	handler := mainPool.WithStaticResponses(NewPoolRouter(mainPool, []PoolRoute{{PathPrefix: "/api/", Pool: api}}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	assert.Equal(t, "api /api/users", serve("/api/users").Body.String())
+	require.NoError(t, mainPool.SetStaticResponse(&StaticResponse{PathPrefix: "/", Status: http.StatusServiceUnavailable, Body: "maintenance"}))
+	assert.Equal(t, "maintenance", serve("/api/users").Body.String(), "Static response applies to a routed pool")
+	assert.Equal(t, "maintenance", serve("/index.html").Body.String())
+
+	assert.True(t, mainPool.RemoveStaticResponse("/"))
+	assert.Equal(t, "api /api/users", serve("/api/users").Body.String())
+}
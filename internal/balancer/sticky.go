@@ -0,0 +1,170 @@
+package balancer
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+	"cloud/load_balancer/internal/sticky"
+)
+
+// DefaultStickyCookie - имя cookie сессионной привязки по умолчанию.
+const DefaultStickyCookie = "LB_STICKY"
+
+var stickyRequestsTotal = metrics.NewCounterVec("lb_sticky_requests_total",
+	"Requests with session affinity, by result (hit: routed to the bound backend; rebound: bound backend unavailable; new: no valid cookie).", "result")
+
+// StickyPolicy задает сессионную привязку клиента к бэкенду через cookie. При первом запросе
+// бэкенд выбирается стратегией пула, а ответ получает cookie с его идентификатором; следующие
+// запросы с этой cookie направляются на тот же бэкенд, пока он доступен.
+type StickyPolicy struct {
+	Enabled    bool
+	CookieName string        // Имя cookie ("" - DefaultStickyCookie).
+	TTL        time.Duration // Время жизни привязки (0 - cookie до закрытия браузера, 24h в хранилище).
+	Secure     bool
+	HTTPOnly   bool
+	// Codec кодирует значение cookie (nil - без защиты). См. sticky.NewCodec.
+	Codec sticky.Codec
+	// Store хранит соответствие сессия -> бэкенд (nil - имя бэкенда хранится в самой cookie).
+	// Общее хранилище позволяет нескольким репликам балансировщика соблюдать одну привязку.
+	Store sticky.SessionStore
+}
+
+// defaultStickyStoreTTL - время хранения привязки в хранилище для сессионных cookie.
+const defaultStickyStoreTTL = 24 * time.Hour
+
+// SetStickyPolicy включает или изменяет сессионную привязку. Вызывается при запуске,
+// до начала обработки запросов.
+func (s *ServerPool) SetStickyPolicy(policy StickyPolicy) error {
+	if policy.TTL < 0 {
+		return errors.New("sticky session TTL must not be negative")
+	}
+	if policy.CookieName == "" {
+		policy.CookieName = DefaultStickyCookie
+	}
+	if policy.Codec == nil {
+		policy.Codec, _ = sticky.NewCodec("plain", "")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sticky = policy
+	return nil
+}
+
+// stickyBinding - результат разбора cookie привязки.
+type stickyBinding struct {
+	sessionID string // Идентификатор сессии в хранилище ("" - без хранилища или cookie нет).
+	backend   string // Имя привязанного бэкенда ("" - привязки нет).
+}
+
+// stickyPeer возвращает бэкенд, к которому привязан клиент, если он может принять запрос.
+// Бэкенд, исчерпавший лимит запросов (см. BackendSpec.MaxRPS и MaxConns), не выбирается.
+func (s *ServerPool) stickyPeer(r *http.Request) (*Backend, stickyBinding) {
+	s.mu.RLock()
+	policy := s.sticky
+	s.mu.RUnlock()
+	if !policy.Enabled {
+		return nil, stickyBinding{}
+	}
+
+	binding := policy.binding(r)
+	if binding.backend == "" {
+		return nil, binding
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	isCandidate := s.candidateFilter()
+	for _, b := range s.backends {
+		if b.Name() == binding.backend {
+			if isCandidate(b) && routeAllows(r, b) && b.hasCapacity() && b.takeRateToken() {
+				return b, binding
+			}
+			break
+		}
+	}
+	return nil, binding
+}
+
+// binding разбирает cookie привязки запроса. Поврежденная или подделанная cookie,
+// как и ошибка хранилища, означает отсутствие привязки.
+func (p StickyPolicy) binding(r *http.Request) stickyBinding {
+	cookie, err := r.Cookie(p.CookieName)
+	if err != nil {
+		return stickyBinding{}
+	}
+	value, err := p.Codec.Decode(cookie.Value)
+	if err != nil {
+		log.Printf("WARN: Ignoring invalid sticky cookie from %s: %v", r.RemoteAddr, err)
+		return stickyBinding{}
+	}
+	if p.Store == nil {
+		return stickyBinding{backend: value}
+	}
+	backend, found, err := p.Store.Get(value)
+	if err != nil {
+		log.Printf("ERROR: Failed to read sticky session: %v", err)
+	}
+	if !found {
+		backend = ""
+	}
+	return stickyBinding{sessionID: value, backend: backend}
+}
+
+// bindSticky привязывает клиента к выбранному бэкенду: сохраняет привязку в хранилище
+// (если оно задано) и добавляет cookie в ответ. prev - привязка из запроса.
+func (s *ServerPool) bindSticky(w http.ResponseWriter, peer *Backend, prev stickyBinding) {
+	s.mu.RLock()
+	policy := s.sticky
+	s.mu.RUnlock()
+	if !policy.Enabled {
+		return
+	}
+	if prev.backend != "" {
+		stickyRequestsTotal.With("rebound").Inc()
+		log.Printf("INFO: Sticky backend %s is unavailable, rebinding session to %s", prev.backend, peer.Name())
+	} else {
+		stickyRequestsTotal.With("new").Inc()
+	}
+
+	value := peer.Name()
+	if policy.Store != nil {
+		sessionID := prev.sessionID
+		if sessionID == "" {
+			var err error
+			if sessionID, err = sticky.NewSessionID(); err != nil {
+				log.Printf("ERROR: Failed to create sticky session: %v", err)
+				return
+			}
+		}
+		ttl := policy.TTL
+		if ttl == 0 {
+			ttl = defaultStickyStoreTTL
+		}
+		if err := policy.Store.Set(sessionID, peer.Name(), ttl); err != nil {
+			log.Printf("ERROR: Failed to store sticky session: %v", err)
+			return
+		}
+		value = sessionID
+	}
+
+	encoded, err := policy.Codec.Encode(value)
+	if err != nil {
+		log.Printf("ERROR: Failed to encode sticky cookie: %v", err)
+		return
+	}
+	cookie := &http.Cookie{
+		Name:     policy.CookieName,
+		Value:    encoded,
+		Path:     "/",
+		Secure:   policy.Secure,
+		HttpOnly: policy.HTTPOnly,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if policy.TTL > 0 {
+		cookie.MaxAge = int(policy.TTL.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
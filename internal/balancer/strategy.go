@@ -0,0 +1,188 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Поддерживаемые стратегии выбора бэкенда.
+const (
+	// StrategyRoundRobin - поочередный выбор доступных бэкендов (по умолчанию).
+	StrategyRoundRobin = "round_robin"
+	// StrategyLeastBytes - выбор бэкенда с наименьшим объемом данных, передаваемых в данный момент.
+	// Подходит для потоковых нагрузок (видео, файлы), где один запрос может занимать канал минутами.
+	StrategyLeastBytes = "least_bytes"
+	// StrategyLeastConnections - выбор бэкенда с наименьшим числом запросов, обрабатываемых в данный момент.
+	// Подходит для запросов с сильно различающимся временем обработки.
+	StrategyLeastConnections = "least_connections"
+	// StrategyP2C - "power of two choices": из двух случайных доступных бэкендов выбирается
+	// тот, у которого меньше активных запросов. Снижает хвостовые задержки под нагрузкой
+	// без полного перебора пула и без "стадного" выбора одного наименее загруженного бэкенда.
+	StrategyP2C = "p2c"
+	// StrategyLeastResponseTime - выбор бэкенда с наименьшим скользящим средним времени
+	// обработки запросов (EWMA). Подходит для пулов с бэкендами разной производительности.
+	StrategyLeastResponseTime = "least_response_time"
+	// StrategyRandom - равновероятный выбор среди доступных бэкендов. Не использует общего
+	// счетчика, поэтому не создает конкуренции между горутинами при очень высокой нагрузке.
+	StrategyRandom = "random"
+)
+
+// Strategy выбирает бэкенд для запроса. backends содержит только кандидатов, которым
+// можно направить запрос (доступные и не исключенные лимитом), и не бывает пустым;
+// r может быть nil, если выбор выполняется вне обработки запроса. Next возвращает один из
+// backends или nil; если возвращен другой бэкенд, пул выбирает бэкенд стратегией round robin.
+// Реализации должны быть безопасны для конкурентного использования.
+type Strategy interface {
+	Next(backends []*Backend, r *http.Request) *Backend
+}
+
+// StrategyFunc позволяет использовать обычную функцию как Strategy.
+type StrategyFunc func(backends []*Backend, r *http.Request) *Backend
+
+// Next вызывает f(backends, r).
+func (f StrategyFunc) Next(backends []*Backend, r *http.Request) *Backend {
+	return f(backends, r)
+}
+
+var (
+	strategiesMu sync.RWMutex
+	// Фабрики стратегий по имени. Каждый пул получает собственный экземпляр стратегии.
+	strategies = map[string]func() Strategy{
+		StrategyRoundRobin:        func() Strategy { return &roundRobin{} },
+		StrategyLeastBytes:        func() Strategy { return &leastBy{less: lessBytes} },
+		StrategyLeastConnections:  func() Strategy { return &leastBy{less: lessConnections} },
+		StrategyP2C:               func() Strategy { return p2c{} },
+		StrategyLeastResponseTime: func() Strategy { return &leastBy{less: lessResponseTime} },
+		StrategyRandom:            func() Strategy { return random{} },
+	}
+)
+
+// RegisterStrategy регистрирует пользовательскую стратегию под именем name, после чего
+// ее можно выбрать через SetStrategy (и параметр strategy конфигурации). Фабрика вызывается
+// для каждого пула, выбирающего стратегию. Возвращает ошибку, если имя пустое или занято.
+func RegisterStrategy(name string, factory func() Strategy) error {
+	if name == "" || factory == nil {
+		return errors.New("strategy name and factory must be specified")
+	}
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, exists := strategies[name]; exists {
+		return fmt.Errorf("balancing strategy %q is already registered", name)
+	}
+	strategies[name] = factory
+	return nil
+}
+
+// Strategies возвращает имена зарегистрированных стратегий в алфавитном порядке.
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetStrategy задает стратегию выбора бэкенда по имени (встроенную или зарегистрированную
+// через RegisterStrategy). Пустое имя означает round robin.
+// Возвращает ошибку для неизвестной стратегии.
+func (s *ServerPool) SetStrategy(name string) error {
+	if name == "" {
+		name = StrategyRoundRobin
+	}
+	strategiesMu.RLock()
+	factory, ok := strategies[name]
+	strategiesMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown balancing strategy: %s", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strategy = factory()
+	s.strategyName = name
+	return nil
+}
+
+// StrategyName возвращает имя текущей стратегии выбора бэкенда.
+func (s *ServerPool) StrategyName() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.strategyName == "" {
+		return StrategyRoundRobin
+	}
+	return s.strategyName
+}
+
+// roundRobin выбирает кандидатов по очереди.
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (rr *roundRobin) Next(backends []*Backend, _ *http.Request) *Backend {
+	return backends[(rr.next.Add(1)-1)%uint64(len(backends))]
+}
+
+// leastBy выбирает кандидата, минимального по отношению less. Обход начинается
+// с очередного смещения, чтобы равные бэкенды чередовались.
+type leastBy struct {
+	less func(a, b *Backend) bool
+	next atomic.Uint64
+}
+
+func (l *leastBy) Next(backends []*Backend, _ *http.Request) *Backend {
+	n := uint64(len(backends))
+	start := l.next.Add(1) - 1
+	var best *Backend
+	for i := uint64(0); i < n; i++ {
+		b := backends[(start+i)%n]
+		if best == nil || l.less(b, best) {
+			best = b
+		}
+	}
+	return best
+}
+
+// lessBytes сравнивает бэкенды по объему передаваемых данных, затем по числу активных запросов.
+func lessBytes(a, b *Backend) bool {
+	return a.OutstandingBytes() < b.OutstandingBytes() ||
+		(a.OutstandingBytes() == b.OutstandingBytes() && a.ActiveRequests() < b.ActiveRequests())
+}
+
+// lessConnections сравнивает бэкенды по числу активных запросов.
+func lessConnections(a, b *Backend) bool {
+	return a.ActiveRequests() < b.ActiveRequests()
+}
+
+// random выбирает кандидата равновероятно.
+type random struct{}
+
+func (random) Next(backends []*Backend, _ *http.Request) *Backend {
+	return backends[rand.IntN(len(backends))]
+}
+
+// p2c выбирает из двух случайных кандидатов бэкенд с меньшим числом активных запросов.
+type p2c struct{}
+
+func (p2c) Next(backends []*Backend, _ *http.Request) *Backend {
+	if len(backends) == 1 {
+		return backends[0]
+	}
+	i := rand.IntN(len(backends))
+	j := rand.IntN(len(backends) - 1)
+	if j >= i {
+		j++ // Второй кандидат отличается от первого.
+	}
+	first, second := backends[i], backends[j]
+	if second.ActiveRequests() < first.ActiveRequests() {
+		return second
+	}
+	return first
+}
@@ -0,0 +1,74 @@
+package balancer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// BackendTLS задает параметры TLS-соединений с https-бэкендом. Нулевое значение - проверка
+// сертификата по системным корневым сертификатам и SNI по хосту из URL.
+type BackendTLS struct {
+	CAFile             string // PEM-файл с сертификатами CA для проверки сертификата бэкенда.
+	ServerName         string // Имя для SNI и проверки сертификата (по умолчанию - хост из URL).
+	InsecureSkipVerify bool   // Не проверять сертификат бэкенда (только для тестовых окружений).
+	CertFile           string // Клиентский сертификат (mTLS).
+	KeyFile            string // Ключ клиентского сертификата.
+}
+
+// isZero сообщает, заданы ли параметры TLS.
+func (t BackendTLS) isZero() bool {
+	return t == BackendTLS{}
+}
+
+// config строит tls.Config по параметрам.
+func (t BackendTLS) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New("both cert_file and key_file must be set for client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Validate проверяет, что файл CA и клиентский сертификат читаются.
+func (t BackendTLS) Validate() error {
+	_, err := t.config()
+	return err
+}
+
+// clientTLSConfig возвращает TLS-настройки соединения с бэкендом: заданные в BackendTLS
+// или настройки по умолчанию, с SNI по хосту из URL, если имя не задано явно.
+func (b *Backend) clientTLSConfig() *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if b.tlsConfig != nil {
+		cfg = b.tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = b.URL.Hostname()
+	}
+	return cfg
+}
@@ -0,0 +1,145 @@
+package balancer
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+// Фазы запроса к бэкенду в метрике lb_backend_phase_duration_seconds.
+const (
+	phaseDNS     = "dns"
+	phaseConnect = "connect"
+	phaseTLS     = "tls"
+	phaseTTFB    = "ttfb"
+)
+
+var (
+	backendConnectionsTotal = metrics.NewCounterVec("lb_backend_connections_total",
+		"Upstream connections obtained per backend, by type (new dial or reused keep-alive).", "backend", "type")
+	backendDNSLookupsTotal = metrics.NewCounterVec("lb_backend_dns_lookups_total",
+		"DNS lookups performed for upstream connections per backend.", "backend")
+	backendTLSHandshakesTotal = metrics.NewCounterVec("lb_backend_tls_handshakes_total",
+		"TLS handshakes performed for upstream connections per backend, by result.", "backend", "result")
+	backendTLSSessionsTotal = metrics.NewCounterVec("lb_backend_tls_sessions_total",
+		"Successful TLS handshakes with upstream per backend, by type (full or resumed session).", "backend", "type")
+	backendPhaseDuration = metrics.NewHistogramVec("lb_backend_phase_duration_seconds",
+		"Duration of upstream request phases per backend: dns, connect, tls, ttfb (request written to first response byte).",
+		metrics.DefaultLatencyBuckets, "backend", "phase")
+)
+
+// phaseTimer запоминает моменты начала фаз запроса. Колбэки httptrace могут вызываться
+// из разных горутин транспорта (например, параллельные подключения к нескольким адресам).
+type phaseTimer struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart map[string]time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+}
+
+// start запоминает начало фазы.
+func (p *phaseTimer) start(at *time.Time) {
+	p.mu.Lock()
+	*at = time.Now()
+	p.mu.Unlock()
+}
+
+// since возвращает длительность фазы с момента at (false - начало фазы не зафиксировано).
+func (p *phaseTimer) since(at *time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if at.IsZero() {
+		return 0, false
+	}
+	return time.Since(*at), true
+}
+
+// withConnTrace добавляет в контекст запроса httptrace.ClientTrace, который учитывает
+// в метриках новые и переиспользованные соединения, DNS-запросы и TLS-рукопожатия бэкенда,
+// а также длительность фаз запроса (DNS, подключение, TLS, ожидание первого байта ответа).
+// Это позволяет диагностировать "пересоздание" соединений (connection churn) и отличать
+// медленную сеть от медленного бэкенда.
+// Если timings не nil, в него записываются тайминги запроса для лога медленных запросов.
+func (b *Backend) withConnTrace(r *http.Request, timings *requestTimings) *http.Request {
+	name := b.Name()
+	phases := &phaseTimer{connectStart: make(map[string]time.Time)}
+	observe := func(phase string, at *time.Time) {
+		if d, ok := phases.since(at); ok {
+			backendPhaseDuration.With(name, phase).Observe(d.Seconds())
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if timings != nil {
+				timings.gotConn(info.Reused)
+			}
+			if info.Reused {
+				b.reuse.reusedConns.Add(1)
+				backendConnectionsTotal.With(name, "reused").Inc()
+			} else {
+				b.reuse.newConns.Add(1)
+				backendConnectionsTotal.With(name, "new").Inc()
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			backendDNSLookupsTotal.With(name).Inc()
+			phases.start(&phases.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			observe(phaseDNS, &phases.dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			phases.mu.Lock()
+			phases.connectStart[network+"/"+addr] = time.Now()
+			phases.mu.Unlock()
+			if timings != nil {
+				timings.connectStarted()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			phases.mu.Lock()
+			started, ok := phases.connectStart[network+"/"+addr]
+			phases.mu.Unlock()
+			if ok && err == nil {
+				backendPhaseDuration.With(name, phaseConnect).Observe(time.Since(started).Seconds())
+			}
+			if timings != nil {
+				timings.connectDone()
+			}
+		},
+		TLSHandshakeStart: func() {
+			phases.start(&phases.tlsStart)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				backendTLSHandshakesTotal.With(name, "error").Inc()
+				return
+			}
+			backendTLSHandshakesTotal.With(name, "success").Inc()
+			if state.DidResume {
+				b.reuse.tlsResumed.Add(1)
+				backendTLSSessionsTotal.With(name, "resumed").Inc()
+			} else {
+				b.reuse.tlsFull.Add(1)
+				backendTLSSessionsTotal.With(name, "full").Inc()
+			}
+			observe(phaseTLS, &phases.tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			phases.start(&phases.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			observe(phaseTTFB, &phases.wroteRequest)
+			if timings != nil {
+				timings.gotFirstByte()
+			}
+		},
+	}
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+}
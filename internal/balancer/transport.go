@@ -0,0 +1,165 @@
+package balancer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var backendIdleClosesTotal = metrics.NewCounterVec("lb_backend_idle_conn_closes_total",
+	"Forced closes of idle upstream connections per backend, by trigger (admin, drain).", "backend", "trigger")
+
+// Протоколы соединений с бэкендами (см. TransportSettings.Protocol и BackendSpec.Protocol).
+const (
+	// ProtocolAuto - HTTP/2, если https-бэкенд предлагает его при TLS-рукопожатии (ALPN),
+	// иначе HTTP/1.1 (поведение по умолчанию).
+	ProtocolAuto = "auto"
+	// ProtocolHTTP1 - только HTTP/1.1.
+	ProtocolHTTP1 = "http1"
+	// ProtocolHTTP2 - только HTTP/2: по TLS для https-бэкендов и без шифрования (h2c, без
+	// согласования протокола) для остальных. Запросы мультиплексируются в общих соединениях;
+	// переключение протокола (WebSocket) через такие соединения невозможно.
+	ProtocolHTTP2 = "http2"
+)
+
+// validateProtocol проверяет имя протокола соединений с бэкендом ("" - протокол пула).
+func validateProtocol(protocol string) error {
+	switch protocol {
+	case "", ProtocolAuto, ProtocolHTTP1, ProtocolHTTP2:
+		return nil
+	default:
+		return fmt.Errorf("unknown upstream protocol %q (expected %s, %s or %s)", protocol, ProtocolAuto, ProtocolHTTP1, ProtocolHTTP2)
+	}
+}
+
+// upstreamProtocols возвращает протоколы Transport для протокола protocol и схемы запроса
+// scheme (nil - протоколы по умолчанию).
+func upstreamProtocols(protocol, scheme string) *http.Protocols {
+	var protocols http.Protocols
+	switch protocol {
+	case ProtocolHTTP1:
+		protocols.SetHTTP1(true)
+	case ProtocolHTTP2:
+		if strings.EqualFold(scheme, "https") {
+			protocols.SetHTTP2(true)
+		} else {
+			protocols.SetUnencryptedHTTP2(true)
+		}
+	default:
+		return nil
+	}
+	return &protocols
+}
+
+// applyProtocol выбирает протокол соединений с бэкендом: заданный для бэкенда или, если он
+// не задан, протокол пула poolProtocol.
+func (b *Backend) applyProtocol(t *http.Transport, poolProtocol string) {
+	b.upstreamProtocol = b.protocol
+	if b.upstreamProtocol == "" {
+		b.upstreamProtocol = poolProtocol
+	}
+	t.Protocols = upstreamProtocols(b.upstreamProtocol, b.proxyTarget().Scheme)
+}
+
+// Protocol возвращает протокол соединений с бэкендом (ProtocolAuto, ProtocolHTTP1 или ProtocolHTTP2).
+func (b *Backend) Protocol() string {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	if b.upstreamProtocol == "" {
+		return ProtocolAuto
+	}
+	return b.upstreamProtocol
+}
+
+// TransportSettings задает параметры пула соединений к каждому бэкенду.
+// Нулевые значения означают значения по умолчанию http.DefaultTransport.
+type TransportSettings struct {
+	MaxIdleConnsPerHost int           // Максимум простаивающих keep-alive соединений к бэкенду.
+	MaxConnsPerHost     int           // Общий лимит соединений к бэкенду (0 - без ограничения).
+	IdleConnTimeout     time.Duration // Время, после которого простаивающее соединение закрывается.
+	// Максимальное время ожидания заголовков ответа бэкенда после отправки запроса (0 - без ограничения).
+	ResponseHeaderTimeout time.Duration
+	DialTimeout           time.Duration // Ограничение установки соединения, в том числе с egress-прокси.
+	TLSHandshakeTimeout   time.Duration // Ограничение TLS-рукопожатия с бэкендом.
+	// Период TCP keep-alive для прямых соединений с бэкендами (отрицательное значение - отключен).
+	TCPKeepAlive      time.Duration
+	DisableKeepAlives bool // Новое соединение для каждого запроса (без HTTP keep-alive).
+	// Протокол соединений с бэкендами, для которых он не задан в BackendSpec.Protocol
+	// ("" - ProtocolAuto).
+	Protocol string
+}
+
+// apply переносит настройки в Transport бэкенда.
+func (ts TransportSettings) apply(t *http.Transport) {
+	if ts.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = ts.MaxIdleConnsPerHost
+	}
+	if ts.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = ts.MaxConnsPerHost
+	}
+	if ts.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = ts.IdleConnTimeout
+	}
+	if ts.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = ts.ResponseHeaderTimeout
+	}
+	if ts.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = ts.TLSHandshakeTimeout
+	}
+	t.DisableKeepAlives = ts.DisableKeepAlives
+}
+
+// dialer возвращает net.Dialer для прямых соединений с бэкендами: параметры
+// http.DefaultTransport с учетом DialTimeout и TCPKeepAlive.
+func (ts TransportSettings) dialer() *net.Dialer {
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if ts.DialTimeout > 0 {
+		d.Timeout = ts.DialTimeout
+	}
+	if ts.TCPKeepAlive != 0 {
+		d.KeepAlive = ts.TCPKeepAlive
+	}
+	return d
+}
+
+// SetTransportSettings применяет параметры пула соединений ко всем бэкендам пула.
+// Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetTransportSettings(ts TransportSettings) error {
+	if err := validateProtocol(ts.Protocol); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transportSettings = ts
+	for _, b := range s.backends {
+		b.dialSettings = ts
+		if transport, ok := b.ReverseProxy.Transport.(*http.Transport); ok {
+			ts.apply(transport)
+			b.applyProtocol(transport, ts.Protocol)
+		}
+	}
+	return nil
+}
+
+// GetTransportSettings возвращает текущие параметры пула соединений.
+func (s *ServerPool) GetTransportSettings() TransportSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transportSettings
+}
+
+// CloseIdleConnections принудительно закрывает простаивающие соединения к указанному бэкенду
+// (например, перед его обслуживанием). Активные запросы не прерываются.
+// Возвращает ErrBackendNotFound, если бэкенд не найден.
+func (s *ServerPool) CloseIdleConnections(name string) error {
+	backend := s.GetBackendByName(name)
+	if backend == nil {
+		return ErrBackendNotFound
+	}
+	backend.closeIdleConnections("admin")
+	return nil
+}
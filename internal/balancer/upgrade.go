@@ -0,0 +1,178 @@
+package balancer
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var (
+	upgradedConnections = metrics.NewGaugeVec("lb_upgraded_connections",
+		"Open client connections switched to another protocol (WebSocket), per backend.", "backend")
+	upgradedClosesTotal = metrics.NewCounterVec("lb_upgraded_connection_closes_total",
+		"Upgraded connections closed by the balancer, by backend and reason (idle_timeout, max_lifetime).", "backend", "reason")
+)
+
+// UpgradePolicy задает ограничения соединений, переключенных на другой протокол
+// (Upgrade: websocket и т. п.). Таймауты сервера (ReadTimeout, WriteTimeout, response_timeouts)
+// рассчитаны на обычные запросы и к таким соединениям не применяются.
+type UpgradePolicy struct {
+	// Соединение закрывается, если данные не передавались ни в одном направлении дольше
+	// IdleTimeout (0 - без ограничения).
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration // Предельное время жизни соединения (0 - без ограничения).
+}
+
+// SetUpgradePolicy устанавливает ограничения соединений с переключением протокола для всех
+// бэкендов пула. Вызывается при запуске, до начала обработки запросов.
+func (s *ServerPool) SetUpgradePolicy(policy UpgradePolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upgradePolicy = policy
+	for _, b := range s.backends {
+		b.upgradePolicy = policy
+	}
+}
+
+// isUpgradeRequest сообщает, запрашивает ли клиент переключение протокола.
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWriter передает ReverseProxy соединение клиента при ответе бэкенда 101 Switching
+// Protocols: снимает с него дедлайны сервера и ограничивает его согласно UpgradePolicy.
+// Данные переключенного соединения передаются напрямую, без буферизации middleware.
+type upgradeWriter struct {
+	http.ResponseWriter
+	backend  *Backend
+	upgraded bool
+}
+
+func (w *upgradeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Дедлайны чтения и записи, установленные сервером для запроса, сохраняются
+	// у перехваченного соединения и прервали бы долгоживущее соединение.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	w.upgraded = true
+	return newUpgradedConn(conn, w.backend.Name(), w.backend.upgradePolicy), brw, nil
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (w *upgradeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// upgradedConn - соединение клиента после переключения протокола. Закрывается по истечении
+// IdleTimeout без передачи данных или MaxLifetime; закрытие завершает проксирование в обоих
+// направлениях.
+type upgradedConn struct {
+	net.Conn
+	backend    string
+	idle       time.Duration
+	lastActive atomic.Int64 // UnixNano последней передачи данных.
+
+	mu        sync.Mutex
+	closed    bool
+	idleTimer *time.Timer
+	lifeTimer *time.Timer
+}
+
+func newUpgradedConn(conn net.Conn, backend string, policy UpgradePolicy) *upgradedConn {
+	c := &upgradedConn{Conn: conn, backend: backend, idle: policy.IdleTimeout}
+	c.lastActive.Store(time.Now().UnixNano())
+	upgradedConnections.With(backend).Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if policy.IdleTimeout > 0 {
+		c.idleTimer = time.AfterFunc(policy.IdleTimeout, c.checkIdle)
+	}
+	if policy.MaxLifetime > 0 {
+		c.lifeTimer = time.AfterFunc(policy.MaxLifetime, func() { c.expire("max_lifetime") })
+	}
+	return c
+}
+
+func (c *upgradedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.lastActive.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *upgradedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.lastActive.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// checkIdle закрывает простаивающее соединение или откладывает проверку до момента, когда
+// оно может стать простаивающим.
+func (c *upgradedConn) checkIdle() {
+	idleFor := time.Since(time.Unix(0, c.lastActive.Load()))
+	if idleFor >= c.idle {
+		c.expire("idle_timeout")
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.idleTimer.Reset(c.idle - idleFor)
+	}
+}
+
+func (c *upgradedConn) expire(reason string) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return
+	}
+	upgradedClosesTotal.With(c.backend, reason).Inc()
+	log.Printf("INFO: Closing upgraded connection from %s to backend %s: %s", c.RemoteAddr(), c.backend, reason)
+	c.Close()
+}
+
+func (c *upgradedConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	if c.lifeTimer != nil {
+		c.lifeTimer.Stop()
+	}
+	c.mu.Unlock()
+	upgradedConnections.With(c.backend).Dec()
+	return c.Conn.Close()
+}
@@ -0,0 +1,308 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStaleOnError проверяет сохранение успешного ответа и выдачу копии при ошибке бэкенда.
+func TestStaleOnError(t *testing.T) {
+	status := http.StatusOK
+	body := "fresh"
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+	store := NewStore(10)
+	handler := StaleOnError(store, []StaleRule{{PathPrefix: "/catalog", MaxStale: time.Minute}}, 1024)(backend)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	assert.Equal(t, "fresh", serve("/catalog/items").Body.String())
+	assert.Equal(t, 1, store.Len())
+
+	status, body = http.StatusBadGateway, "Bad Gateway"
+	rr := serve("/catalog/items")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "fresh", rr.Body.String())
+	assert.Equal(t, "text/plain", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Values("Warning"), `110 - "Response is Stale"`)
+
+	assert.Equal(t, http.StatusBadGateway, serve("/catalog/other").Code, "No stale copy for a different URL")
+	assert.Equal(t, http.StatusBadGateway, serve("/orders").Code, "Routes without a rule are not affected")
+}
+
+// TestStaleOnError_NotStorable проверяет, что ответы с no-store и слишком большие ответы не сохраняются.
+func TestStaleOnError_NotStorable(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		_, _ = w.Write([]byte("0123456789"))
+	})
+	store := NewStore(10)
+	handler := StaleOnError(store, []StaleRule{{PathPrefix: "/", MaxStale: time.Minute}}, 5)(backend)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/private", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/large", nil))
+	assert.Zero(t, store.Len())
+}
+
+// TestStaleOnError_SetCookie проверяет, что ответ с Set-Cookie не сохраняется и не отдается
+// другим клиентам.
+func TestStaleOnError_SetCookie(t *testing.T) {
+	status := http.StatusOK
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/session" {
+			w.Header().Set("Set-Cookie", "session=alice")
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("profile"))
+	})
+	store := NewStore(10)
+	handler := StaleOnError(store, []StaleRule{{PathPrefix: "/", MaxStale: time.Minute}}, 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sticky" {
+			// Cookie sticky-сессии выставляется балансировщиком до проксирования.
+			w.Header().Set("Set-Cookie", "LB_STICKY=backend-1")
+		}
+		backend.ServeHTTP(w, r)
+	}))
+
+	for _, path := range []string{"/session", "/sticky"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Set-Cookie"), "Cookie still reaches its own client")
+	}
+	assert.Zero(t, store.Len())
+
+	status = http.StatusBadGateway
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/session", nil))
+	assert.Equal(t, http.StatusBadGateway, rr.Code, "No stale copy of a response with Set-Cookie")
+}
+
+// TestStaleOnError_Vary проверяет, что варианты ответа по заголовкам из Vary хранятся
+// отдельно и отдаются только клиентам с теми же значениями заголовков.
+func TestStaleOnError_Vary(t *testing.T) {
+	status := http.StatusOK
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Encoding, accept-language")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language") + "/" + r.Header.Get("Accept-Encoding")))
+	})
+	store := NewStore(10)
+	handler := StaleOnError(store, []StaleRule{{PathPrefix: "/", MaxStale: time.Minute}}, 1024)(backend)
+	serve := func(language, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/page", nil)
+		req.Header.Set("Accept-Language", language)
+		req.Header.Set("Accept-Encoding", encoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	serve("en", "gzip")
+	serve("ru", "gzip")
+	serve("en", "identity")
+	assert.Equal(t, 3, store.Len(), "Each variant is stored separately")
+
+	status = http.StatusServiceUnavailable
+	assert.Equal(t, "en/gzip", serve("en", "gzip").Body.String())
+	assert.Equal(t, "ru/gzip", serve("ru", "gzip").Body.String())
+	assert.Equal(t, "en/identity", serve("en", "identity").Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, serve("de", "gzip").Code, "No stale copy for an unseen variant")
+}
+
+// TestStore_Eviction проверяет вытеснение давно не использованных записей.
+func TestStore_Eviction(t *testing.T) {
+	store := NewStore(2)
+	store.Put("a", &Entry{})
+	store.Put("b", &Entry{})
+	store.Get("a")
+	store.Put("c", &Entry{})
+
+	_, ok := store.Get("b")
+	assert.False(t, ok)
+	_, ok = store.Get("a")
+	assert.True(t, ok)
+}
+
+// TestStaleOnError_ConditionalRequests проверяет генерацию ETag и ответы 304: без обращения
+// к бэкенду для свежей копии и вместо совпавшего ответа бэкенда после ее устаревания.
+func TestStaleOnError_ConditionalRequests(t *testing.T) {
+	backendCalls := 0
+	cacheControl := "max-age=60"
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendCalls++
+		w.Header().Set("Cache-Control", cacheControl)
+		_, _ = w.Write([]byte("body"))
+	})
+	handler := StaleOnError(NewStore(10), []StaleRule{{PathPrefix: "/", MaxStale: time.Minute}}, 1024)(backend)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "body", rr.Body.String())
+
+	conditional := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr = conditional()
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+	assert.Equal(t, 1, backendCalls, "Fresh copy must be revalidated without the backend")
+
+	cacheControl = "no-cache"
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/doc", nil))
+	rr = conditional()
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Equal(t, 3, backendCalls, "Copy that is not fresh must be revalidated by the backend")
+}
+
+// TestEdgeResponses проверяет ответы на OPTIONS и HEAD без обращения к бэкенду.
+func TestEdgeResponses(t *testing.T) {
+	backendCalls := 0
+	cacheControl := "max-age=60"
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendCalls++
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("body"))
+	})
+	store := NewStore(10)
+	stale := StaleOnError(store, []StaleRule{{PathPrefix: "/", MaxStale: time.Minute}}, 1024)(backend)
+	handler := EdgeResponses(store, []EdgeRule{
+		{PathPrefix: "/api/", Allow: []string{"GET", "HEAD", "OPTIONS"}, HeadFromCache: true},
+	})(stale)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	rr := serve(http.MethodOptions, "/api/items")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Allow"))
+	assert.Zero(t, backendCalls)
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/items", nil)
+	preflight.Header.Set("Access-Control-Request-Method", "GET")
+	handler.ServeHTTP(httptest.NewRecorder(), preflight)
+	assert.Equal(t, 1, backendCalls, "CORS preflight must be passed on")
+
+	serve(http.MethodHead, "/api/items")
+	assert.Equal(t, 2, backendCalls, "HEAD without a cached GET goes to the backend")
+
+	serve(http.MethodGet, "/api/items")
+	rr = serve(http.MethodHead, "/api/items")
+	assert.Equal(t, 3, backendCalls)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/plain", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "4", rr.Header().Get("Content-Length"))
+	assert.NotEmpty(t, rr.Header().Get("ETag"))
+	assert.Empty(t, rr.Body.String())
+
+	cacheControl = "no-cache"
+	serve(http.MethodGet, "/api/items")
+	serve(http.MethodHead, "/api/items")
+	assert.Equal(t, 5, backendCalls, "HEAD for a copy that is not fresh goes to the backend")
+
+	serve(http.MethodOptions, "/other")
+	assert.Equal(t, 6, backendCalls, "Routes without a rule are not affected")
+
+	handler = EdgeResponses(store, []EdgeRule{{PathPrefix: "/api", Allow: []string{"GET"}}})(stale)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodOptions, "/api").Code)
+	serve(http.MethodOptions, "/apix")
+	assert.Equal(t, 7, backendCalls, "Prefix matches on a segment boundary")
+}
+
+// TestEdgeResponses_HeadHeaders проверяет, что HEAD из кэша получает только разрешенные
+// заголовки сохраненного ответа.
+func TestEdgeResponses_HeadHeaders(t *testing.T) {
+	store := NewStore(10)
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	now := time.Now()
+	store.Save(req, &Entry{
+		Status: http.StatusOK,
+		Header: http.Header{
+			"Cache-Control": {"max-age=60"},
+			"Content-Type":  {"text/plain"},
+			"Etag":          {`"v1"`},
+			"Set-Cookie":    {"session=alice"},
+			"X-Request-Id":  {"abc"},
+		},
+		Body:       []byte("body"),
+		StoredAt:   now,
+		FreshUntil: now.Add(time.Minute),
+	})
+	handler := EdgeResponses(store, []EdgeRule{{PathPrefix: "/api/", HeadFromCache: true}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("HEAD must be answered from the cache")
+		}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodHead, "/api/items", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"v1"`, rr.Header().Get("ETag"))
+	assert.Equal(t, "text/plain", rr.Header().Get("Content-Type"))
+	assert.Empty(t, rr.Header().Values("Set-Cookie"))
+	assert.Empty(t, rr.Header().Get("X-Request-Id"))
+
+	conditional := httptest.NewRequest(http.MethodHead, "/api/items", nil)
+	conditional.Header.Set("If-None-Match", `"v1"`)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, conditional)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Header().Values("Set-Cookie"))
+}
+
+// TestEntityTag проверяет, что ETag вычисляется по распакованному телу и различается
+// для вариантов с разным Content-Encoding.
+func TestEntityTag(t *testing.T) {
+	body := []byte(strings.Repeat("body ", 100))
+	encoded := func(encoding string) http.Header {
+		return http.Header{"Content-Encoding": {encoding}}
+	}
+	gzipped := func(level int) []byte {
+		var buf bytes.Buffer
+		gz, err := gzip.NewWriterLevel(&buf, level)
+		require.NoError(t, err)
+		_, _ = gz.Write(body)
+		require.NoError(t, gz.Close())
+		return buf.Bytes()
+	}
+
+	plain := entityTag(body, http.Header{}, 1024)
+	assert.Equal(t, plain, entityTag(body, encoded("identity"), 1024))
+	assert.Equal(t, strings.TrimSuffix(plain, `"`)+`-gzip"`, entityTag(gzipped(gzip.BestSpeed), encoded("gzip"), 1024))
+	assert.Equal(t, entityTag(gzipped(gzip.BestSpeed), encoded("gzip"), 1024),
+		entityTag(gzipped(gzip.BestCompression), encoded("gzip"), 1024), "the same content compressed differently")
+
+	// Тело, которое нельзя распаковать, хешируется как есть.
+	raw := gzipped(gzip.BestSpeed)
+	assert.Equal(t, strings.TrimSuffix(httputil_pkg.StrongETag(raw), `"`)+`-gzip+br"`, entityTag(raw, encoded("gzip, br"), 1024))
+	assert.Equal(t, strings.TrimSuffix(httputil_pkg.StrongETag(raw), `"`)+`-gzip"`, entityTag(raw, encoded("gzip"), 100))
+}
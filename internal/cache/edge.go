@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+var edgeResponsesTotal = metrics.NewCounterVec("lb_edge_responses_total",
+	"OPTIONS and HEAD requests answered by the balancer without contacting backends, by method.", "method")
+
+// EdgeRule задает ответы балансировщика на OPTIONS и HEAD для запросов с путем, начинающимся
+// с PathPrefix.
+type EdgeRule struct {
+	PathPrefix string
+	// Методы для заголовка Allow в ответе на OPTIONS (пусто - OPTIONS передаются бэкенду).
+	Allow []string
+	// HEAD обслуживается по сохраненному свежему ответу на GET того же URL (без тела).
+	HeadFromCache bool
+}
+
+// EdgeResponses возвращает middleware, которое отвечает на простые запросы без обращения
+// к бэкендам: OPTIONS - ответом 204 с заголовком Allow из правила, HEAD - статусом
+// и заголовками свежей копии ответа на GET из store (условные запросы получают 304).
+// Preflight-запросы CORS (OPTIONS с Access-Control-Request-Method) и HEAD без свежей копии
+// передаются дальше. Правила проверяются по порядку; store может быть nil.
+func EdgeResponses(store *Store, rules []EdgeRule) func(http.Handler) http.Handler {
+	allow := make([]string, len(rules))
+	for i, rule := range rules {
+		allow[i] = strings.Join(rule.Allow, ", ")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			i, ok := matchEdgeRule(rules, r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch {
+			case r.Method == http.MethodOptions && allow[i] != "" && r.Header.Get("Access-Control-Request-Method") == "":
+				edgeResponsesTotal.With(http.MethodOptions).Inc()
+				w.Header().Set("Allow", allow[i])
+				w.WriteHeader(http.StatusNoContent)
+				return
+			case r.Method == http.MethodHead && rules[i].HeadFromCache && store != nil:
+				if entry, ok := store.Lookup(r); ok && entry.fresh(time.Now()) {
+					edgeResponsesTotal.With(http.MethodHead).Inc()
+					serveHead(w, r, entry)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchEdgeRule возвращает индекс первого правила, подходящего для пути.
+func matchEdgeRule(rules []EdgeRule, path string) (int, bool) {
+	for i, rule := range rules {
+		if httputil_pkg.PathHasPrefix(path, rule.PathPrefix) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// headHeaders - заголовки сохраненного ответа, которые попадают в ответ на HEAD из кэша.
+// Остальные (например, Set-Cookie) могли относиться к клиенту, чей GET был сохранен.
+// Content-Encoding нужен, чтобы Content-Length описывал то же представление, что и GET.
+var headHeaders = []string{"Cache-Control", "Content-Encoding", "Content-Type", "ETag", "Expires", "Last-Modified", "Vary"}
+
+// serveHead отдает разрешенные заголовки сохраненного ответа с Age и длиной сохраненного тела.
+func serveHead(w http.ResponseWriter, r *http.Request, entry *Entry) {
+	if httputil_pkg.NotModified(r, entry.Header.Get("ETag"), entry.lastModified()) {
+		notModifiedTotal.With("cache").Inc()
+		httputil_pkg.WriteNotModified(w, entry.Header)
+		return
+	}
+	header := w.Header()
+	for _, name := range headHeaders {
+		for _, value := range entry.Header.Values(name) {
+			header.Add(name, value)
+		}
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+	header.Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	w.WriteHeader(entry.Status)
+}
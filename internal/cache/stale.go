@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+var (
+	staleResponsesTotal = metrics.NewCounterVec("lb_stale_responses_total",
+		"Stale cached responses served instead of backend errors, by route prefix.", "route")
+	notModifiedTotal = metrics.NewCounterVec("lb_not_modified_responses_total",
+		"304 Not Modified responses produced at the balancer, by source (cache: without contacting the backend; backend: backend response replaced).", "source")
+)
+
+// StaleRule включает stale-on-error для запросов с путем, начинающимся с PathPrefix:
+// успешные ответы сохраняются, а при ошибке бэкенда отдается копия не старше MaxStale.
+type StaleRule struct {
+	PathPrefix string
+	MaxStale   time.Duration
+}
+
+// StaleOnError возвращает middleware, которое вместо ответа с ошибкой (500, 502, 503, 504)
+// отдает сохраненную копию ответа с заголовком Warning. Сохраняются ответы 200 на GET-запросы
+// размером не более maxBodyBytes, если ответ не запрещает хранение (Cache-Control: no-store,
+// private) и не содержит Set-Cookie, а запрос не содержит Authorization. Ответы с Vary
+// хранятся отдельно для каждого сочетания значений перечисленных заголовков запроса.
+// Правила проверяются по порядку.
+//
+// Сохраняемые ответы получают сильный ETag (если бэкенд его не задал), а условные запросы
+// (If-None-Match, If-Modified-Since) обслуживаются ответом 304 на балансировщике: без обращения
+// к бэкенду, пока сохраненная копия свежая (Cache-Control: max-age/s-maxage), иначе - вместо
+// совпавшего ответа бэкенда.
+func StaleOnError(store *Store, rules []StaleRule, maxBodyBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := matchRule(rules, r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if entry, ok := store.Lookup(r); ok && entry.fresh(time.Now()) &&
+				httputil_pkg.NotModified(r, entry.Header.Get("ETag"), entry.lastModified()) {
+				notModifiedTotal.With("cache").Inc()
+				httputil_pkg.WriteNotModified(w, entry.Header)
+				return
+			}
+
+			sw := &staleWriter{
+				ResponseWriter: w,
+				request:        r,
+				store:          store,
+				rule:           rule,
+				maxBodyBytes:   maxBodyBytes,
+			}
+			next.ServeHTTP(sw, r)
+
+			switch {
+			case sw.fallback != nil:
+				serveStale(w, r, sw.fallback)
+				staleResponsesTotal.With(rule.PathPrefix).Inc()
+				log.Printf("WARN: Backend responded %d for [%s %s], served stale copy from %s", sw.status, r.Method, r.URL.Path, sw.fallback.StoredAt.Format(time.RFC3339))
+			case sw.buffering:
+				sw.complete()
+			}
+		})
+	}
+}
+
+// matchRule возвращает первое правило, подходящее для запроса.
+func matchRule(rules []StaleRule, r *http.Request) (StaleRule, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return StaleRule{}, false
+	}
+	for _, rule := range rules {
+		if httputil_pkg.PathHasPrefix(r.URL.Path, rule.PathPrefix) {
+			return rule, true
+		}
+	}
+	return StaleRule{}, false
+}
+
+// isErrorStatus сообщает, заменяется ли ответ с таким кодом сохраненной копией.
+func isErrorStatus(code int) bool {
+	switch code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// storable сообщает, можно ли сохранить ответ на запрос. Ответ с Set-Cookie (включая cookie
+// sticky-сессии, выставленную балансировщиком) адресован одному клиенту и не сохраняется.
+func storable(r *http.Request, status int, header http.Header) bool {
+	if r.Method != http.MethodGet || status != http.StatusOK || r.Header.Get("Authorization") != "" {
+		return false
+	}
+	if len(header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return false
+	}
+	return header.Get("Vary") != "*"
+}
+
+// freshness возвращает, сколько ответ остается свежим согласно Cache-Control
+// (s-maxage имеет приоритет над max-age; no-cache - ответ не свежий).
+func freshness(header http.Header) time.Duration {
+	var maxAge, sMaxAge time.Duration = -1, -1
+	for _, directive := range strings.Split(strings.ToLower(header.Get("Cache-Control")), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		switch {
+		case name == "no-cache":
+			return 0
+		case name == "max-age" && err == nil:
+			maxAge = time.Duration(seconds) * time.Second
+		case name == "s-maxage" && err == nil:
+			sMaxAge = time.Duration(seconds) * time.Second
+		}
+	}
+	if sMaxAge >= 0 {
+		return sMaxAge
+	}
+	return max(maxAge, 0)
+}
+
+// entityTag возвращает сильный ETag сохраняемого тела. Хеш вычисляется по распакованному
+// содержимому, поэтому одинаковые данные, сжатые разными бэкендами по-разному, получают
+// одинаковый ETag; если тело не распаковывается (неизвестная кодировка или распакованное тело
+// больше limit), хешируются исходные байты. Для сжатого ответа к ETag добавляется
+// Content-Encoding, чтобы варианты одного ресурса с разным кодированием не совпадали
+// при сравнении с If-None-Match.
+func entityTag(body []byte, header http.Header, limit int64) string {
+	if decoded, err := httputil_pkg.InspectResponseBody(header, body, limit); err == nil {
+		body = decoded
+	}
+	etag := httputil_pkg.StrongETag(body)
+	encoding := strings.Join(header.Values("Content-Encoding"), ",")
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		return etag
+	}
+	// Запятые в ETag мешают разбору списка в If-None-Match.
+	encoding = strings.NewReplacer(" ", "", ",", "+").Replace(strings.ToLower(encoding))
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// serveStale отдает сохраненную копию с заголовками Age и Warning.
+func serveStale(w http.ResponseWriter, r *http.Request, entry *Entry) {
+	header := w.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range entry.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+	header.Add("Warning", `110 - "Response is Stale"`)
+	header.Add("Warning", `111 - "Revalidation Failed"`)
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(entry.Body)
+	}
+}
+
+// staleWriter буферизует сохраняемый ответ целиком (до maxBodyBytes), чтобы присвоить ему
+// ETag до отправки заголовков, и подавляет ответ с ошибкой, если есть подходящая копия.
+// Ответы, которые сохранять нельзя или которые превысили лимит, передаются клиенту без изменений.
+type staleWriter struct {
+	http.ResponseWriter
+	request      *http.Request
+	store        *Store
+	rule         StaleRule
+	maxBodyBytes int64
+
+	wroteHeader bool
+	status      int
+	fallback    *Entry // Копия, которая будет отдана вместо ответа с ошибкой.
+	buffering   bool   // Заголовки и тело накапливаются до завершения ответа.
+	body        bytes.Buffer
+}
+
+func (sw *staleWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	sw.status = code
+
+	if isErrorStatus(code) {
+		if entry, ok := sw.store.Lookup(sw.request); ok && time.Since(entry.StoredAt) <= sw.rule.MaxStale {
+			sw.fallback = entry
+			return
+		}
+	}
+	if storable(sw.request, code, sw.Header()) {
+		sw.buffering = true
+		return
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *staleWriter) Write(p []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.fallback != nil {
+		return len(p), nil
+	}
+	if sw.buffering {
+		if int64(sw.body.Len()+len(p)) <= sw.maxBodyBytes {
+			return sw.body.Write(p)
+		}
+		// Ответ слишком велик для сохранения - передаем без копии.
+		if err := sw.passThrough(); err != nil {
+			return 0, err
+		}
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// Flush отправляет накопленный ответ без сохранения: потоковые ответы не буферизуются.
+func (sw *staleWriter) Flush() {
+	if sw.fallback != nil {
+		return
+	}
+	if sw.buffering {
+		_ = sw.passThrough()
+	}
+	if !sw.wroteHeader {
+		return
+	}
+	_ = http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// passThrough прекращает буферизацию и отправляет клиенту накопленные заголовки и тело.
+func (sw *staleWriter) passThrough() error {
+	sw.buffering = false
+	sw.ResponseWriter.WriteHeader(sw.status)
+	_, err := sw.ResponseWriter.Write(sw.body.Bytes())
+	sw.body = bytes.Buffer{}
+	return err
+}
+
+// complete сохраняет полностью буферизованный ответ и отправляет его клиенту
+// (или 304, если условный запрос совпал с ETag ответа).
+func (sw *staleWriter) complete() {
+	header := sw.Header()
+	if header.Get("ETag") == "" {
+		header.Set("ETag", entityTag(sw.body.Bytes(), header, sw.maxBodyBytes))
+	}
+	now := time.Now()
+	entry := &Entry{
+		Status:     sw.status,
+		Header:     header.Clone(),
+		Body:       bytes.Clone(sw.body.Bytes()),
+		StoredAt:   now,
+		FreshUntil: now.Add(freshness(header)),
+	}
+	sw.store.Save(sw.request, entry)
+
+	if httputil_pkg.NotModified(sw.request, entry.Header.Get("ETag"), entry.lastModified()) {
+		notModifiedTotal.With("backend").Inc()
+		httputil_pkg.WriteNotModified(sw.ResponseWriter, header)
+		return
+	}
+	sw.ResponseWriter.WriteHeader(sw.status)
+	_, _ = sw.ResponseWriter.Write(entry.Body)
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (sw *staleWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,188 @@
+// Package cache хранит в памяти копии успешных ответов бэкендов, чтобы отдавать их
+// клиентам, когда бэкенды недоступны (stale-on-error), и отвечать на условные запросы
+// и HEAD без обращения к бэкенду.
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry - сохраненный ответ.
+type Entry struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+	// До этого момента ответ свежий (Cache-Control: max-age) и условные запросы
+	// обслуживаются без обращения к бэкенду.
+	FreshUntil time.Time
+}
+
+// fresh сообщает, свежий ли ответ в момент now.
+func (e *Entry) fresh(now time.Time) bool {
+	return now.Before(e.FreshUntil)
+}
+
+// lastModified возвращает значение Last-Modified ответа (нулевое время, если его нет).
+func (e *Entry) lastModified() time.Time {
+	t, err := http.ParseTime(e.Header.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Store - LRU-хранилище ответов с ограничением числа записей.
+type Store struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // Элементы - ключи, от недавно использованных к давним.
+	entries    map[string]*storeItem
+	variants   map[string]*variants // Ключ запроса (Key) -> заголовки Vary его ответов.
+}
+
+type storeItem struct {
+	entry   *Entry
+	element *list.Element
+	base    string // Ключ запроса без значений заголовков из Vary ("" - запись добавлена Put).
+}
+
+// variants - заголовки запроса из Vary последнего сохраненного ответа на URL и число
+// сохраненных вариантов этого URL (описание удаляется вместе с последним вариантом).
+type variants struct {
+	names []string
+	count int
+}
+
+// NewStore создает хранилище не более чем на maxEntries ответов.
+func NewStore(maxEntries int) *Store {
+	if maxEntries <= 0 {
+		maxEntries = 1
+	}
+	return &Store{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*storeItem),
+		variants:   make(map[string]*variants),
+	}
+}
+
+// Lookup возвращает сохраненный ответ на запрос r: вариант, совпадающий с запросом
+// по заголовкам из Vary сохраненного ответа.
+func (s *Store) Lookup(r *http.Request) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := Key(r)
+	v, ok := s.variants[base]
+	if !ok {
+		return nil, false
+	}
+	return s.getLocked(variantKey(base, r, v.names))
+}
+
+// Save сохраняет ответ entry на запрос r как вариант для значений заголовков запроса,
+// перечисленных в Vary ответа.
+func (s *Store) Save(r *http.Request, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := Key(r)
+	names := varyNames(entry.Header)
+	v, ok := s.variants[base]
+	if !ok {
+		v = &variants{}
+		s.variants[base] = v
+	}
+	v.names = names
+	key := variantKey(base, r, names)
+	if _, exists := s.entries[key]; !exists {
+		v.count++
+	}
+	s.putLocked(key, base, entry)
+}
+
+// Get возвращает сохраненный ответ по ключу.
+func (s *Store) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLocked(key)
+}
+
+func (s *Store) getLocked(key string) (*Entry, bool) {
+	item, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(item.element)
+	return item.entry, true
+}
+
+// Put сохраняет ответ, вытесняя давно не использованные записи при переполнении.
+func (s *Store) Put(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putLocked(key, "", entry)
+}
+
+func (s *Store) putLocked(key, base string, entry *Entry) {
+	if item, ok := s.entries[key]; ok {
+		item.entry = entry
+		s.order.MoveToFront(item.element)
+		return
+	}
+	s.entries[key] = &storeItem{entry: entry, element: s.order.PushFront(key), base: base}
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		evicted := oldest.Value.(string)
+		if v, ok := s.variants[s.entries[evicted].base]; ok {
+			if v.count--; v.count <= 0 {
+				delete(s.variants, s.entries[evicted].base)
+			}
+		}
+		delete(s.entries, evicted)
+	}
+}
+
+// Len возвращает число сохраненных ответов.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Key возвращает ключ ответа на запрос: хост и URI запроса.
+func Key(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+// varyNames возвращает заголовки запроса, перечисленные в Vary ответа, в каноническом виде.
+func varyNames(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// variantKey дополняет ключ запроса base значениями заголовков запроса names.
+func variantKey(base string, r *http.Request, names []string) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,192 @@
+// Package concurrency ограничивает число одновременно обрабатываемых балансировщиком
+// запросов. Запросы сверх лимита ожидают в ограниченной FIFO-очереди, а при заполненной
+// очереди или истечении времени ожидания отклоняются с кодом 503, поэтому при экстремальной
+// нагрузке балансировщик деградирует предсказуемо, а не накапливает горутины и память.
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+// Причины отклонения запроса (метка reason метрики lb_concurrency_rejected_total).
+const (
+	reasonQueueFull    = "queue_full"
+	reasonQueueTimeout = "queue_timeout"
+)
+
+var (
+	inFlightGauge = metrics.NewGaugeVec("lb_concurrency_in_flight",
+		"Requests currently being processed under the global concurrency limit.")
+	queueLengthGauge = metrics.NewGaugeVec("lb_concurrency_queue_length",
+		"Requests currently waiting in the concurrency limit queue.")
+	queueWaitSeconds = metrics.NewHistogramVec("lb_concurrency_queue_wait_seconds",
+		"Time requests spent in the concurrency limit queue, by result (admitted, timeout, canceled).",
+		metrics.DefaultLatencyBuckets, "result")
+	rejectedTotal = metrics.NewCounterVec("lb_concurrency_rejected_total",
+		"Requests rejected by the global concurrency limit, by reason (queue_full, queue_timeout).", "reason")
+)
+
+// Config содержит параметры ограничения.
+type Config struct {
+	MaxInFlight  int           // Максимум одновременно обрабатываемых запросов.
+	MaxQueue     int           // Максимум ожидающих запросов (0 - без очереди).
+	QueueTimeout time.Duration // Максимальное время ожидания в очереди.
+	// ObserveWait, если задан, получает время ожидания каждого допущенного или не дождавшегося
+	// запроса (ноль - допущен без очереди), например для сброса нагрузки.
+	ObserveWait func(time.Duration)
+}
+
+// Limiter ограничивает число одновременно обрабатываемых запросов. Освободившееся место
+// передается первому запросу в очереди, поэтому запросы допускаются в порядке поступления.
+type Limiter struct {
+	cfg        Config
+	retryAfter string // Значение заголовка Retry-After при отклонении.
+
+	mu       sync.Mutex
+	inFlight int
+	queue    list.List // Ожидающие запросы: chan struct{}, закрываемый при допуске.
+}
+
+// NewLimiter создает Limiter. Возвращает ошибку, если лимит не положителен, размер очереди
+// отрицателен или для очереди не задано время ожидания.
+func NewLimiter(cfg Config) (*Limiter, error) {
+	if cfg.MaxInFlight <= 0 {
+		return nil, fmt.Errorf("concurrency: max_in_flight must be positive")
+	}
+	if cfg.MaxQueue < 0 {
+		return nil, fmt.Errorf("concurrency: max_queue must not be negative")
+	}
+	if cfg.MaxQueue > 0 && cfg.QueueTimeout <= 0 {
+		return nil, fmt.Errorf("concurrency: queue_timeout must be positive")
+	}
+	// Клиенту предлагается повторить запрос не раньше, чем очередь успеет продвинуться.
+	retryAfter := max(int(math.Ceil(cfg.QueueTimeout.Seconds())), 1)
+	return &Limiter{cfg: cfg, retryAfter: strconv.Itoa(retryAfter)}, nil
+}
+
+// InFlight возвращает число обрабатываемых запросов.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// QueueLength возвращает число ожидающих запросов.
+func (l *Limiter) QueueLength() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queue.Len()
+}
+
+// acquire занимает место для запроса, при необходимости ожидая в очереди не дольше
+// QueueTimeout или до отмены ctx. Возвращает "" при допуске или причину отклонения
+// (для отмененного запроса - ctx.Err()).
+func (l *Limiter) acquire(ctx context.Context) (string, error) {
+	l.mu.Lock()
+	if l.inFlight < l.cfg.MaxInFlight && l.queue.Len() == 0 {
+		l.inFlight++
+		inFlightGauge.With().Set(float64(l.inFlight))
+		l.mu.Unlock()
+		l.observeWait(0)
+		return "", nil
+	}
+	if l.queue.Len() >= l.cfg.MaxQueue {
+		l.mu.Unlock()
+		return reasonQueueFull, nil
+	}
+	admitted := make(chan struct{})
+	elem := l.queue.PushBack(admitted)
+	queueLengthGauge.With().Set(float64(l.queue.Len()))
+	l.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	var result string
+	select {
+	case <-admitted:
+		l.observeQueueWait("admitted", time.Since(start))
+		return "", nil
+	case <-timer.C:
+		result = "timeout"
+	case <-ctx.Done():
+		result = "canceled"
+	}
+
+	l.mu.Lock()
+	select {
+	case <-admitted:
+		// Место передано одновременно с истечением ожидания: запрос допускается.
+		l.mu.Unlock()
+		l.observeQueueWait("admitted", time.Since(start))
+		return "", nil
+	default:
+		l.queue.Remove(elem)
+		queueLengthGauge.With().Set(float64(l.queue.Len()))
+	}
+	l.mu.Unlock()
+	l.observeQueueWait(result, time.Since(start))
+	if result == "canceled" {
+		return "", ctx.Err()
+	}
+	return reasonQueueTimeout, nil
+}
+
+// observeQueueWait учитывает время ожидания запроса в очереди с результатом result.
+func (l *Limiter) observeQueueWait(result string, d time.Duration) {
+	queueWaitSeconds.With(result).Observe(d.Seconds())
+	l.observeWait(d)
+}
+
+// observeWait передает время ожидания в Config.ObserveWait.
+func (l *Limiter) observeWait(d time.Duration) {
+	if l.cfg.ObserveWait != nil {
+		l.cfg.ObserveWait(d)
+	}
+}
+
+// release освобождает место запроса: оно передается первому запросу в очереди, если он есть.
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if front := l.queue.Front(); front != nil {
+		l.queue.Remove(front)
+		queueLengthGauge.With().Set(float64(l.queue.Len()))
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.inFlight--
+	inFlightGauge.With().Set(float64(l.inFlight))
+}
+
+// Middleware допускает запрос к обработке в пределах лимита. Если очередь заполнена или
+// время ожидания истекло, отвечает 503 с заголовком Retry-After; запрос, отмененный клиентом
+// во время ожидания, не обрабатывается.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason, err := l.acquire(r.Context())
+		if err != nil {
+			log.Printf("DEBUG: Request %s %s canceled while waiting in concurrency queue: %v", r.Method, r.URL.Path, err)
+			return
+		}
+		if reason != "" {
+			rejectedTotal.With(reason).Inc()
+			w.Header().Set("Retry-After", l.retryAfter)
+			httputil_pkg.RespondWithError(w, http.StatusServiceUnavailable, "Too many concurrent requests, please retry later")
+			return
+		}
+		defer l.release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package concurrency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLimiter_Queue проверяет ожидание в очереди сверх лимита, отклонение при заполненной
+// очереди и допуск ожидающих запросов в порядке поступления.
+func TestLimiter_Queue(t *testing.T) {
+	l, err := NewLimiter(Config{MaxInFlight: 1, MaxQueue: 2, QueueTimeout: 5 * time.Second})
+	require.NoError(t, err)
+
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- r.URL.Path
+		<-release
+	}))
+	serve := func(path string) <-chan int {
+		code := make(chan int, 1)
+		go func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			code <- rec.Code
+		}()
+		return code
+	}
+
+	first := serve("/1")
+	assert.Equal(t, "/1", <-started)
+	second := serve("/2")
+	require.Eventually(t, func() bool { return l.QueueLength() == 1 }, time.Second, time.Millisecond)
+	third := serve("/3")
+	require.Eventually(t, func() bool { return l.QueueLength() == 2 }, time.Second, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/4", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "Queue is full")
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+
+	release <- struct{}{}
+	assert.Equal(t, http.StatusOK, <-first)
+	assert.Equal(t, "/2", <-started, "Queued requests are admitted in FIFO order")
+	assert.Equal(t, 1, l.InFlight())
+	close(release)
+	assert.Equal(t, http.StatusOK, <-second)
+	assert.Equal(t, "/3", <-started)
+	assert.Equal(t, http.StatusOK, <-third)
+	assert.Zero(t, l.InFlight())
+	assert.Zero(t, l.QueueLength())
+}
+
+// TestLimiter_QueueTimeout проверяет отклонение запроса по истечении времени ожидания.
+func TestLimiter_QueueTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var waits []time.Duration
+	l, err := NewLimiter(Config{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 20 * time.Millisecond,
+		ObserveWait: func(d time.Duration) {
+			mu.Lock()
+			waits = append(waits, d)
+			mu.Unlock()
+		}})
+	require.NoError(t, err)
+	release := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	require.Eventually(t, func() bool { return l.InFlight() == 1 }, time.Second, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Zero(t, l.QueueLength(), "Timed out request leaves the queue")
+	mu.Lock()
+	require.Len(t, waits, 2)
+	assert.Zero(t, waits[0], "Request admitted without waiting")
+	assert.GreaterOrEqual(t, waits[1], 20*time.Millisecond)
+	mu.Unlock()
+
+	close(release)
+	<-done
+	assert.Zero(t, l.InFlight())
+
+	_, err = NewLimiter(Config{MaxInFlight: 1, MaxQueue: 1})
+	assert.Error(t, err, "Queue requires a timeout")
+}
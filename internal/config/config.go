@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -15,25 +17,676 @@ type DBConfig struct {
 	Path   string `yaml:"path"`
 }
 
+// BanConfig содержит параметры действия "бан" rate limiter: клиент, превысивший лимит
+// violations раз за window, блокируется на duration.
+type BanConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Violations  int           `yaml:"violations"`
+	WindowStr   string        `yaml:"window"`
+	DurationStr string        `yaml:"duration"`
+	Window      time.Duration `yaml:"-"`
+	Duration    time.Duration `yaml:"-"`
+}
+
+// TarpitConfig содержит параметры прогрессивного режима rate limiter: при использовании
+// более threshold (доля 0..1) емкости бакета запросы задерживаются, вплоть до max_delay.
+type TarpitConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Threshold   float64       `yaml:"threshold"`
+	MaxDelayStr string        `yaml:"max_delay"`
+	MaxDelay    time.Duration `yaml:"-"`
+}
+
+// AdaptiveThrottleConfig содержит параметры адаптивного ограничения клиентов по ответам
+// бэкендов: ответ 429/503 умножает долю пропускаемых запросов клиента на decrease
+// (не ниже min_factor), успешный ответ увеличивает ее на recovery.
+type AdaptiveThrottleConfig struct {
+	Enabled   bool    `yaml:"enabled"`
+	MinFactor float64 `yaml:"min_factor"`
+	Decrease  float64 `yaml:"decrease"`
+	Recovery  float64 `yaml:"recovery"`
+}
+
+// UsageConfig содержит параметры учета использования лимитов клиентами (/admin/usage).
+type UsageConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	Persist    bool `yaml:"persist"`     // Сохранять счетчики в rate_limiter.db между перезапусками.
+	MaxClients int  `yaml:"max_clients"` // 0 - ratelimiter.DefaultMaxUsageClients.
+}
+
+// BreachWebhookConfig содержит параметры уведомлений о злоупотреблениях: если запросы
+// клиента отклонены rejections раз за window, на url отправляется POST с JSON событием.
+// Повторное уведомление о том же клиенте - не раньше чем через debounce.
+type BreachWebhookConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	URL         string        `yaml:"url" secret:"true"`
+	Rejections  int           `yaml:"rejections"`
+	WindowStr   string        `yaml:"window"`
+	DebounceStr string        `yaml:"debounce"`
+	TimeoutStr  string        `yaml:"timeout"`
+	MaxClients  int           `yaml:"max_clients"` // 0 - ratelimiter.DefaultMaxBreachClients.
+	Window      time.Duration `yaml:"-"`
+	Debounce    time.Duration `yaml:"-"`
+	Timeout     time.Duration `yaml:"-"`
+}
+
+// TenantLimitConfig содержит параметры общих лимитов тенантов (организаций).
+type TenantLimitConfig struct {
+	Enabled    bool    `yaml:"enabled"`
+	Header     string  `yaml:"header"`
+	Capacity   int64   `yaml:"capacity"`
+	RefillRate float64 `yaml:"refill_rate"`
+	MaxTenants int     `yaml:"max_tenants"`
+}
+
+// BypassTokensConfig содержит параметры подписанных токенов обхода rate limiting.
+type BypassTokensConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Key       string        `yaml:"key" secret:"true"`
+	Header    string        `yaml:"header"`
+	MaxTTLStr string        `yaml:"max_ttl"`
+	MaxTTL    time.Duration `yaml:"-"`
+}
+
 type RateLimiterConfig struct {
-	Enabled            bool          `yaml:"enabled"`
-	DefaultCapacity    int64         `yaml:"default_capacity"`
-	DefaultRefillRate  float64       `yaml:"default_refill_rate"`
-	CleanupIntervalStr string        `yaml:"cleanup_interval"`
-	CleanupInterval    time.Duration `yaml:"-"`
-	DB                 DBConfig      `yaml:"db"`
+	Enabled            bool                   `yaml:"enabled"`
+	DefaultCapacity    int64                  `yaml:"default_capacity"`
+	DefaultRefillRate  float64                `yaml:"default_refill_rate"`
+	CleanupIntervalStr string                 `yaml:"cleanup_interval"`
+	CleanupInterval    time.Duration          `yaml:"-"`
+	CleanupMode        string                 `yaml:"cleanup_mode"`    // ticker или lazy.
+	SweepThreshold     int                    `yaml:"sweep_threshold"` // Число бакетов для внеочередной очистки (lazy).
+	KeyExpression      string                 `yaml:"key_expression"`  // Выражение идентификатора клиента ("" - IP-адрес).
+	DB                 DBConfig               `yaml:"db"`
+	Ban                BanConfig              `yaml:"ban"`
+	Tarpit             TarpitConfig           `yaml:"tarpit"`
+	Tenant             TenantLimitConfig      `yaml:"tenant"`
+	Bypass             BypassTokensConfig     `yaml:"bypass"`
+	Adaptive           AdaptiveThrottleConfig `yaml:"adaptive"`
+	Usage              UsageConfig            `yaml:"usage"`
+	BreachWebhook      BreachWebhookConfig    `yaml:"breach_webhook"`
+	// Отдельные лимиты по атрибутам запроса; применяется первое подходящее правило.
+	Rules []RateLimitRuleConfig `yaml:"rules"`
+}
+
+// RateLimitRuleConfig задает лимит для запросов с заданными методом, путем и Content-Type.
+type RateLimitRuleConfig struct {
+	Name        string   `yaml:"name"`
+	Methods     []string `yaml:"methods"`
+	PathPrefix  string   `yaml:"path_prefix"`
+	ContentType string   `yaml:"content_type"` // Например multipart/form-data или image/*
+	Capacity    int64    `yaml:"capacity"`
+	RefillRate  float64  `yaml:"refill_rate"`
+}
+
+// BackendConfig описывает бэкенд: URL и необязательное стабильное имя, по которому бэкенд
+// адресуется в Admin API, метриках и логах. В YAML допускается как строка с URL,
+// так и объект {name, url}.
+type BackendConfig struct {
+	Name   string  `yaml:"name"`
+	URL    string  `yaml:"url"`
+	MaxRPS float64 `yaml:"max_rps"` // Лимит запросов в секунду к бэкенду (0 - без ограничения).
+	// Лимит одновременных запросов к бэкенду (0 - без ограничения).
+	MaxConns int `yaml:"max_conns"`
+	// Переопределение параметров проверки состояния для бэкенда (пустые значения - общие).
+	HealthCheck BackendHealthCheckConfig `yaml:"health_check"`
+	// TLS-настройки соединений с https-бэкендом.
+	TLS BackendTLSConfig `yaml:"tls"`
+	// Прокси для соединений с бэкендом: socks5://host:port или http://host:port (CONNECT).
+	DialVia string `yaml:"dial_via"`
+	// Протокол соединений с бэкендом: auto | http1 | http2 ("" - протокол пула или backend_transport).
+	Protocol string `yaml:"protocol"`
+}
+
+// BackendTLSConfig задает параметры TLS-соединений с https-бэкендом.
+type BackendTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	CertFile           string `yaml:"cert_file"` // Клиентский сертификат (mTLS)
+	KeyFile            string `yaml:"key_file"`
+}
+
+// BackendHealthCheckConfig переопределяет общие параметры проверки состояния для бэкенда.
+type BackendHealthCheckConfig struct {
+	IntervalStr string        `yaml:"interval"`
+	TimeoutStr  string        `yaml:"timeout"`
+	Interval    time.Duration `yaml:"-"`
+	Timeout     time.Duration `yaml:"-"`
+	Mode        string        `yaml:"mode"`   // tcp | http | grpc
+	Path        string        `yaml:"path"`   // Путь HTTP-проверки
+	Scheme      string        `yaml:"scheme"` // http | https
+	// Заголовки проверки бэкенда; дополняют и переопределяют health_check.headers.
+	Headers map[string]string `yaml:"headers" secret:"true"`
+}
+
+// UnmarshalYAML позволяет задавать бэкенд строкой с URL (прежний формат) или объектом.
+func (b *BackendConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		b.Name = ""
+		return value.Decode(&b.URL)
+	}
+	type plain BackendConfig
+	return value.Decode((*plain)(b))
+}
+
+// FlapDetectionConfig содержит параметры обнаружения нестабильных ("мигающих") бэкендов.
+type FlapDetectionConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Transitions int           `yaml:"transitions"`
+	WindowStr   string        `yaml:"window"`
+	HoldDownStr string        `yaml:"hold_down"`
+	Window      time.Duration `yaml:"-"`
+	HoldDown    time.Duration `yaml:"-"`
+}
+
+// BackendTransportConfig содержит параметры пула соединений к бэкендам.
+type BackendTransportConfig struct {
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host"`
+	IdleConnTimeoutStr  string        `yaml:"idle_conn_timeout"`
+	IdleConnTimeout     time.Duration `yaml:"-"`
+	// Ожидание заголовков ответа бэкенда (0s - без ограничения).
+	ResponseHeaderTimeoutStr string        `yaml:"response_header_timeout"`
+	ResponseHeaderTimeout    time.Duration `yaml:"-"`
+	DialTimeoutStr           string        `yaml:"dial_timeout"`
+	DialTimeout              time.Duration `yaml:"-"`
+	TLSHandshakeTimeoutStr   string        `yaml:"tls_handshake_timeout"`
+	TLSHandshakeTimeout      time.Duration `yaml:"-"`
+	// Период TCP keep-alive соединений с бэкендами ("-1s" - отключен).
+	TCPKeepAliveStr   string        `yaml:"tcp_keepalive"`
+	TCPKeepAlive      time.Duration `yaml:"-"`
+	DisableKeepAlives bool          `yaml:"disable_keepalives"` // Без HTTP keep-alive: новое соединение на каждый запрос.
+	// Egress-прокси для соединений с бэкендами.
+	Proxy EgressProxyConfig `yaml:"proxy"`
+	// Протокол соединений с бэкендами: auto (HTTP/2 по ALPN для https), http1 или http2
+	// (для http-бэкендов - h2c).
+	Protocol string `yaml:"protocol"`
+}
+
+// EgressProxyConfig задает прокси для исходящих соединений с бэкендами.
+type EgressProxyConfig struct {
+	Mode    string   `yaml:"mode"`     // environment (HTTP_PROXY/HTTPS_PROXY/NO_PROXY) | static | none
+	URL     string   `yaml:"url"`      // Прокси для режима static
+	NoProxy []string `yaml:"no_proxy"` // Хосты, домены, IP и CIDR без прокси (режим static)
+}
+
+// HostHeaderConfig задает политику заголовка Host, отправляемого бэкендам.
+type HostHeaderConfig struct {
+	Mode     string `yaml:"mode"`
+	Override string `yaml:"override"`
+}
+
+// SlowRequestsConfig содержит параметры логирования медленных запросов.
+type SlowRequestsConfig struct {
+	ThresholdStr         string        `yaml:"threshold"`
+	Threshold            time.Duration `yaml:"-"`
+	SampledTraceResponse bool          `yaml:"sampled_traceresponse"`
+}
+
+// RetriesConfig содержит параметры повтора запросов на другом бэкенде при ошибке соединения
+// или ответе с одним из статусов RetryOnStatuses.
+type RetriesConfig struct {
+	MaxRetries        int    `yaml:"max_retries"`         // 0 - повтор отключен.
+	MemoryBufferBytes int64  `yaml:"memory_buffer_bytes"` // Часть тела запроса, хранимая в памяти.
+	MaxBodyBytes      int64  `yaml:"max_body_bytes"`      // Запрос с большим телом не повторяется.
+	TempDir           string `yaml:"temp_dir"`            // "" - системный каталог временных файлов.
+	RetryOnStatuses   []int  `yaml:"retry_on_statuses"`   // Статусы 5xx, при которых повторяется идемпотентный запрос.
+}
+
+// ProtocolConfig задает обработку Expect: 100-continue и клиентов HTTP/1.0.
+type ProtocolConfig struct {
+	ExpectContinue           string        `yaml:"expect_continue"`
+	ExpectContinueTimeoutStr string        `yaml:"expect_continue_timeout"`
+	ExpectContinueTimeout    time.Duration `yaml:"-"`
+	HTTP10Connection         string        `yaml:"http10_connection"`
+}
+
+// StaleRouteConfig включает stale-on-error для маршрутов с заданным префиксом пути.
+type StaleRouteConfig struct {
+	PathPrefix  string        `yaml:"path_prefix"`
+	MaxStaleStr string        `yaml:"max_stale"`
+	MaxStale    time.Duration `yaml:"-"`
+}
+
+// StaleOnErrorConfig содержит параметры выдачи сохраненных ответов при ошибках бэкендов.
+type StaleOnErrorConfig struct {
+	MaxEntries   int                `yaml:"max_entries"`
+	MaxBodyBytes int64              `yaml:"max_body_bytes"`
+	Routes       []StaleRouteConfig `yaml:"routes"`
+}
+
+// EdgeResponseConfig задает ответы балансировщика на OPTIONS и HEAD для маршрутов с заданным
+// префиксом пути.
+type EdgeResponseConfig struct {
+	PathPrefix string   `yaml:"path_prefix"`
+	Allow      []string `yaml:"allow"` // Заголовок Allow ответа на OPTIONS (пусто - OPTIONS передаются бэкенду).
+	// HEAD обслуживается по свежей копии ответа на GET из stale_on_error.
+	HeadFromCache bool `yaml:"head_from_cache"`
+}
+
+// RedisConfig содержит параметры подключения к Redis.
+type RedisConfig struct {
+	Addr       string        `yaml:"addr"`
+	Password   string        `yaml:"password" secret:"true"`
+	KeyPrefix  string        `yaml:"key_prefix"`
+	TimeoutStr string        `yaml:"timeout"`
+	Timeout    time.Duration `yaml:"-"`
+}
+
+// StickySessionsConfig содержит параметры сессионной привязки клиентов к бэкендам через cookie.
+type StickySessionsConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	CookieName string        `yaml:"cookie_name"`
+	TTLStr     string        `yaml:"ttl"`
+	TTL        time.Duration `yaml:"-"`
+	Secure     bool          `yaml:"secure"`
+	HTTPOnly   bool          `yaml:"http_only"`
+	CookieMode string        `yaml:"cookie_mode"`       // plain, signed или encrypted.
+	Key        string        `yaml:"key" secret:"true"` // Ключ для режимов signed и encrypted.
+	Storage    string        `yaml:"storage"`           // cookie, memory или redis.
+	Redis      RedisConfig   `yaml:"redis"`
+}
+
+// IdempotencyConfig содержит параметры дедупликации запросов по заголовку Idempotency-Key.
+type IdempotencyConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	WindowStr    string        `yaml:"window"`
+	Window       time.Duration `yaml:"-"`
+	LeaseStr     string        `yaml:"lease"`
+	Lease        time.Duration `yaml:"-"`
+	MaxBodyBytes int64         `yaml:"max_body_bytes"`
+	Storage      string        `yaml:"storage"` // memory или redis.
+	Redis        RedisConfig   `yaml:"redis"`
+}
+
+// AutoscaleConfig содержит параметры хука масштабирования пула бэкендов.
+type AutoscaleConfig struct {
+	Enabled                  bool          `yaml:"enabled"`
+	TargetRequestsPerBackend int           `yaml:"target_requests_per_backend"`
+	ScaleOutThreshold        float64       `yaml:"scale_out_threshold"`
+	ScaleInThreshold         float64       `yaml:"scale_in_threshold"`
+	CheckIntervalStr         string        `yaml:"check_interval"`
+	CooldownStr              string        `yaml:"cooldown"`
+	CheckInterval            time.Duration `yaml:"-"`
+	Cooldown                 time.Duration `yaml:"-"`
+	WebhookURL               string        `yaml:"webhook_url" secret:"true"`
+	Command                  string        `yaml:"command"`
+}
+
+// LoadSheddingConfig содержит параметры адаптивного сброса нагрузки.
+// Нулевой порог означает, что ресурс не учитывается.
+type LoadSheddingConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	MaxGoroutines    int           `yaml:"max_goroutines"`
+	MaxHeapMB        int           `yaml:"max_heap_mb"`
+	MaxLatencyStr    string        `yaml:"max_latency"`
+	CheckIntervalStr string        `yaml:"check_interval"`
+	MaxLatency       time.Duration `yaml:"-"`
+	CheckInterval    time.Duration `yaml:"-"`
+	StepPercent      float64       `yaml:"step_percent"`
+	MaxShedPercent   float64       `yaml:"max_shed_percent"`
+}
+
+// ConcurrencyLimitConfig содержит параметры глобального ограничения числа одновременно
+// обрабатываемых запросов с очередью ожидания.
+type ConcurrencyLimitConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	MaxInFlight     int           `yaml:"max_in_flight"`
+	MaxQueue        int           `yaml:"max_queue"`
+	QueueTimeoutStr string        `yaml:"queue_timeout"`
+	QueueTimeout    time.Duration `yaml:"-"`
+}
+
+// PriorityRuleConfig описывает правило отнесения запросов к классу приоритета.
+// Запрос подходит под правило, если выполнены все заданные условия.
+type PriorityRuleConfig struct {
+	Class       string   `yaml:"class"`
+	Header      string   `yaml:"header"`
+	HeaderValue string   `yaml:"header_value"`
+	PathPrefix  string   `yaml:"path_prefix"`
+	Clients     []string `yaml:"clients"`
+}
+
+// PriorityConfig содержит параметры классификации запросов по приоритету.
+type PriorityConfig struct {
+	Enabled      bool                 `yaml:"enabled"`
+	DefaultClass string               `yaml:"default_class"`
+	Rules        []PriorityRuleConfig `yaml:"rules"`
+	// Минимальная доля доступных бэкендов в процентах; ниже нее запросы класса low отклоняются (0 - отключено).
+	ShortageThreshold float64 `yaml:"shortage_threshold"`
+}
+
+// StaticResponseConfig описывает статический ответ, отдаваемый вместо проксирования запросов
+// с путем, начинающимся с PathPrefix.
+type StaticResponseConfig struct {
+	PathPrefix string            `yaml:"path_prefix"`
+	Status     int               `yaml:"status"` // 0 - 503.
+	Headers    map[string]string `yaml:"headers"`
+	Body       string            `yaml:"body"`
+}
+
+// NormalizationConfig содержит параметры нормализации URL входящих запросов.
+type NormalizationConfig struct {
+	Enabled            bool `yaml:"enabled"`
+	RejectEncodedSlash bool `yaml:"reject_encoded_slash"`
+}
+
+// MethodOverrideConfig содержит параметры поддержки заголовка X-HTTP-Method-Override.
+type MethodOverrideConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+}
+
+// ExtAuthConfig содержит параметры внешней авторизации запросов: перед проксированием
+// запрос проверяется сервисом url (2xx - разрешен, 401/403 - отклонен).
+type ExtAuthConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	URL             string        `yaml:"url"`
+	TimeoutStr      string        `yaml:"timeout"`
+	Timeout         time.Duration `yaml:"-"`
+	ForwardHeaders  []string      `yaml:"forward_headers"`  // Пусто - все заголовки запроса.
+	UpstreamHeaders []string      `yaml:"upstream_headers"` // Заголовки ответа сервиса для бэкенда.
+}
+
+// EtcdRegistryConfig содержит параметры реестра бэкендов в etcd: бэкенды регистрируются
+// ключами под prefix с lease, балансировщик отслеживает префикс.
+type EtcdRegistryConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Endpoints []string `yaml:"endpoints"` // Адреса JSON-шлюза etcd (http://etcd-1:2379).
+	Prefix    string   `yaml:"prefix"`
+	Username  string   `yaml:"username" secret:"true"`
+	Password  string   `yaml:"password" secret:"true"`
+}
+
+// BackendsFileConfig содержит параметры файла со списком бэкендов (один URL на строку или
+// YAML), изменения которого применяются без перезапуска.
+type BackendsFileConfig struct {
+	Path            string        `yaml:"path"`
+	PollIntervalStr string        `yaml:"poll_interval"`
+	PollInterval    time.Duration `yaml:"-"`
+}
+
+// RuntimeConfig содержит настройки памяти и сборщика мусора (аналоги GOMEMLIMIT и GOGC).
+type RuntimeConfig struct {
+	MemoryLimit string `yaml:"memory_limit"` // "512MiB" или доля лимита контейнера "90%" ("" - GOMEMLIMIT).
+	GCPercent   *int   `yaml:"gc_percent"`   // nil - GOGC.
+}
+
+// PolicyRuleConfig описывает правило политики на языке выражений: если выражение when
+// истинно, запрос отклоняется (reject_status) или изменяются его заголовки и бэкенды.
+type PolicyRuleConfig struct {
+	Name          string            `yaml:"name"`
+	When          string            `yaml:"when"`
+	Backends      []string          `yaml:"backends"`
+	SetHeaders    map[string]string `yaml:"set_headers"` // Значения - строковые выражения.
+	RemoveHeaders []string          `yaml:"remove_headers"`
+	RejectStatus  int               `yaml:"reject_status"`
+}
+
+// ServerTimeoutsConfig содержит таймауты HTTP-сервера слушающего адреса и время на
+// завершение активных запросов при остановке.
+type ServerTimeoutsConfig struct {
+	ReadStr     string        `yaml:"read"`
+	WriteStr    string        `yaml:"write"`
+	IdleStr     string        `yaml:"idle"`
+	ShutdownStr string        `yaml:"shutdown"`
+	Read        time.Duration `yaml:"-"`
+	Write       time.Duration `yaml:"-"`
+	Idle        time.Duration `yaml:"-"`
+	Shutdown    time.Duration `yaml:"-"`
+}
+
+// ClientConnectionsConfig ограничивает число запросов и время жизни keep-alive соединений
+// клиентов на основном адресе. Нулевое значение означает отсутствие ограничения.
+type ClientConnectionsConfig struct {
+	MaxRequests    int           `yaml:"max_requests"`
+	MaxLifetimeStr string        `yaml:"max_lifetime"`
+	MaxLifetime    time.Duration `yaml:"-"`
+}
+
+// WebSocketConfig ограничивает соединения клиентов, переключенные на другой протокол
+// (WebSocket). Таймауты server_timeouts к ним не применяются. Нулевое значение означает
+// отсутствие ограничения.
+type WebSocketConfig struct {
+	IdleTimeoutStr string        `yaml:"idle_timeout"`
+	MaxLifetimeStr string        `yaml:"max_lifetime"`
+	IdleTimeout    time.Duration `yaml:"-"`
+	MaxLifetime    time.Duration `yaml:"-"`
+}
+
+// PathRewriteConfig изменяет путь запросов с заданным префиксом при передаче бэкенду.
+type PathRewriteConfig struct {
+	PathPrefix  string `yaml:"path_prefix"`
+	StripPrefix bool   `yaml:"strip_prefix"`
+	AddPrefix   string `yaml:"add_prefix"`
+	Regex       string `yaml:"regex"`       // Применяется к пути после strip_prefix и add_prefix.
+	Replacement string `yaml:"replacement"` // Замена для regex ($1 - группа выражения).
+}
+
+// ResponseTimeoutConfig задает время на отправку ответа для запросов с путем, начинающимся
+// с PathPrefix, вместо server_timeouts.write ("0s" - без ограничения).
+type ResponseTimeoutConfig struct {
+	PathPrefix string        `yaml:"path_prefix"`
+	TimeoutStr string        `yaml:"timeout"`
+	Timeout    time.Duration `yaml:"-"`
+}
+
+// AdminListenerConfig задает отдельный адрес для Admin API и метрик со своими таймаутами.
+// Если адрес не задан, Admin API обслуживается на основном адресе.
+type AdminListenerConfig struct {
+	Addr     string               `yaml:"addr"`
+	Timeouts ServerTimeoutsConfig `yaml:"timeouts"`
+}
+
+// HealthCheckConfig содержит параметры способа проверки состояния бэкендов.
+type HealthCheckConfig struct {
+	Mode             string `yaml:"mode"` // tcp | http | grpc
+	Path             string `yaml:"path"`
+	Method           string `yaml:"method"`
+	ExpectedStatuses []int  `yaml:"expected_statuses"` // Пусто - любой статус 2xx.
+	// Число подряд успешных (неудачных) проверок для возврата в ротацию (вывода из нее).
+	HealthyThreshold   int `yaml:"healthy_threshold"`
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"`
+	// Подстрока и регулярное выражение, которым должно соответствовать тело ответа (пусто - не проверяется).
+	ExpectedBody      string `yaml:"expected_body"`
+	ExpectedBodyRegex string `yaml:"expected_body_regex"`
+	// Доля интервала (0..1) для случайного смещения сроков проверок.
+	Jitter float64 `yaml:"jitter"`
+	// Предельный интервал проверки неудачно проверяемого подряд бэкенда (0s - без увеличения).
+	MaxBackoffStr string        `yaml:"max_backoff"`
+	MaxBackoff    time.Duration `yaml:"-"`
+	// Длительность успешной проверки, после которой бэкенд считается degraded (0s - не используется).
+	DegradedLatencyStr string        `yaml:"degraded_latency"`
+	DegradedLatency    time.Duration `yaml:"-"`
+	// Имя сервиса для проверки по протоколу gRPC Health Checking (пусто - сервер в целом).
+	GRPCService string `yaml:"grpc_service"`
+	// Заголовки запроса проверки (Authorization, User-Agent; Host - имя хоста запроса).
+	Headers map[string]string `yaml:"headers" secret:"true"`
+}
+
+// StartupConfig задает ожидание доступных бэкендов после запуска.
+type StartupConfig struct {
+	MinHealthyBackends int           `yaml:"min_healthy_backends"` // 0 - готовность сразу
+	TimeoutStr         string        `yaml:"timeout"`              // Предельное время ожидания
+	Timeout            time.Duration `yaml:"-"`
+	DelayTraffic       bool          `yaml:"delay_traffic"` // Не принимать соединения до готовности
+}
+
+// ShutdownReportConfig задает отправку отчета об итогах работы при остановке.
+type ShutdownReportConfig struct {
+	WebhookURL        string        `yaml:"webhook_url" secret:"true"` // "" - отчет только выводится в лог.
+	WebhookTimeoutStr string        `yaml:"webhook_timeout"`
+	WebhookTimeout    time.Duration `yaml:"-"`
+}
+
+// AdminAccessConfig содержит параметры ограничения доступа к Admin API по адресу клиента.
+type AdminAccessConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	AllowedCIDRs []string `yaml:"allowed_cidrs"` // CIDR или отдельные IP-адреса.
+}
+
+// CORSRuleConfig описывает политику CORS для маршрутов с заданным префиксом пути.
+type CORSRuleConfig struct {
+	PathPrefix       string        `yaml:"path_prefix"`
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	MaxAgeStr        string        `yaml:"max_age"`
+	MaxAge           time.Duration `yaml:"-"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+}
+
+// HeaderActionsConfig описывает изменения заголовков: удаление, замену и добавление значений.
+type HeaderActionsConfig struct {
+	Remove []string          `yaml:"remove"`
+	Set    map[string]string `yaml:"set"`
+	Add    map[string]string `yaml:"add"`
+}
+
+// HeaderRuleConfig задает изменения заголовков запросов и ответов для маршрутов с заданным
+// префиксом пути.
+type HeaderRuleConfig struct {
+	PathPrefix string              `yaml:"path_prefix"` // Пусто - все запросы.
+	Request    HeaderActionsConfig `yaml:"request"`
+	Response   HeaderActionsConfig `yaml:"response"`
+}
+
+// PoolConfig описывает дополнительный пул бэкендов, который получает запросы с путями,
+// начинающимися с одного из PathPrefixes, и запросы к хостам, направленным в пул правилами
+// virtual_hosts. Остальные запросы обслуживает основной пул (backends).
+type PoolConfig struct {
+	Name         string          `yaml:"name"`
+	PathPrefixes []string        `yaml:"path_prefixes"` // Пусто - пул получает запросы только по virtual_hosts.
+	Strategy     string          `yaml:"strategy"`      // "" - общая strategy.
+	Protocol     string          `yaml:"protocol"`      // "" - backend_transport.protocol.
+	Backends     []BackendConfig `yaml:"backends"`
+	// Параметры проверки состояния бэкендов пула (пустые значения - общие). Переопределение
+	// в самом бэкенде имеет приоритет.
+	HealthCheck PoolHealthCheckConfig `yaml:"health_check"`
+}
+
+// PoolHealthCheckConfig содержит параметры проверки состояния бэкендов пула. Интервал,
+// таймаут, режим, путь, схема и заголовки переносятся в бэкенды пула, для которых они
+// не переопределены; остальные параметры задают политику проверок пула. Пустые значения -
+// общие из health_check.
+type PoolHealthCheckConfig struct {
+	BackendHealthCheckConfig `yaml:",inline"`
+	Method                   string `yaml:"method"`
+	ExpectedStatuses         []int  `yaml:"expected_statuses"`
+	HealthyThreshold         int    `yaml:"healthy_threshold"`
+	UnhealthyThreshold       int    `yaml:"unhealthy_threshold"`
+	ExpectedBody             string `yaml:"expected_body"`
+	ExpectedBodyRegex        string `yaml:"expected_body_regex"`
+	DegradedLatencyStr       string `yaml:"degraded_latency"`
+	GRPCService              string `yaml:"grpc_service"`
+	// Политика проверок пула: общий health_check с параметрами пула.
+	Policy HealthCheckConfig `yaml:"-"`
+}
+
+// VirtualHostsConfig задает выбор пула по заголовку Host: запросы к хосту Host обслуживает
+// пул Pool ("" - основной пул). Запросы к остальным хостам, не подошедшие под path_prefixes
+// пулов, обслуживает DefaultPool ("" - основной пул).
+type VirtualHostsConfig struct {
+	DefaultPool string              `yaml:"default_pool"`
+	Hosts       []VirtualHostConfig `yaml:"hosts"`
+}
+
+// VirtualHostConfig направляет запросы к хосту Host ("api.example.com" или "*.example.com")
+// в пул Pool.
+type VirtualHostConfig struct {
+	Host string `yaml:"host"`
+	Pool string `yaml:"pool"`
+}
+
+// RoutingRuleConfig направляет в пул Pool ("" - основной пул) запросы, которые соответствуют
+// всем заданным условиям: методу из Methods, значениям заголовков Headers и параметров
+// запроса Query (пустое значение - параметр или заголовок присутствует с любым значением),
+// а также Host и PathPrefix, если они заданы.
+type RoutingRuleConfig struct {
+	Name       string            `yaml:"name"`
+	Methods    []string          `yaml:"methods"`
+	Headers    map[string]string `yaml:"headers"`
+	Query      map[string]string `yaml:"query"`
+	Host       string            `yaml:"host"`
+	PathPrefix string            `yaml:"path_prefix"`
+	Pool       string            `yaml:"pool"`
 }
 
 // Config представляет основную конфигурацию приложения балансировщика нагрузки.
 // Загружается из YAML файла, может переопределяться переменными окружения.
 type Config struct {
-	Port                   string            `json:"port`
-	Backends               []string          `json:"backends"`
-	HealthCheckIntervalStr string            `yaml:"health_check_interval"`
-	HealthCheckTimeoutStr  string            `yaml:"health_check_timeout"`
-	HealthCheckInterval    time.Duration     `yaml:"-"`
-	HealthCheckTimeout     time.Duration     `yaml:"-"`
-	RateLimiter            RateLimiterConfig `yaml:"rate_limiter"`
+	Port                   string              `yaml:"port"`           // Адрес (":8080") или Unix-сокет ("unix:/run/lb.sock").
+	ListenNetwork          string              `yaml:"listen_network"` // tcp | tcp4 | tcp6
+	UnixSocketModeStr      string              `yaml:"unix_socket_mode"`
+	UnixSocketMode         os.FileMode         `yaml:"-"`
+	Backends               []BackendConfig     `yaml:"backends"`
+	Pools                  []PoolConfig        `yaml:"pools"` // Пулы для маршрутизации по префиксу пути и хосту.
+	VirtualHosts           VirtualHostsConfig  `yaml:"virtual_hosts"`
+	RoutingRules           []RoutingRuleConfig `yaml:"routing_rules"` // Проверяются по порядку до virtual_hosts.
+	Strategy               string              `yaml:"strategy"`
+	HashOn                 string              `yaml:"hash_on"` // header:<имя> или path ("" - отключено).
+	PanicThreshold         float64             `yaml:"panic_threshold"`
+	HealthCheckIntervalStr string              `yaml:"health_check_interval"`
+	HealthCheckTimeoutStr  string              `yaml:"health_check_timeout"`
+	HealthCheckInterval    time.Duration       `yaml:"-"`
+	HealthCheckTimeout     time.Duration       `yaml:"-"`
+	HealthCheck            HealthCheckConfig   `yaml:"health_check"`
+	RateLimiter            RateLimiterConfig   `yaml:"rate_limiter"`
+	FlapDetection          FlapDetectionConfig `yaml:"flap_detection"`
+	DrainTimeoutStr        string              `yaml:"drain_timeout"`
+	DrainTimeout           time.Duration       `yaml:"-"`
+	// Интервал повторного разрешения бэкендов, заданных DNS-именем (dns+http://...; "0s" - только при запуске).
+	DNSRefreshIntervalStr string                  `yaml:"dns_refresh_interval"`
+	DNSRefreshInterval    time.Duration           `yaml:"-"`
+	SlowStartStr          string                  `yaml:"slow_start"` // Окно медленного старта ("0s" - отключено).
+	SlowStart             time.Duration           `yaml:"-"`
+	BackendTransport      BackendTransportConfig  `yaml:"backend_transport"`
+	HostHeader            HostHeaderConfig        `yaml:"host_header"`
+	SlowRequests          SlowRequestsConfig      `yaml:"slow_requests"`
+	Retries               RetriesConfig           `yaml:"retries"`
+	Protocol              ProtocolConfig          `yaml:"protocol"`
+	StaleOnError          StaleOnErrorConfig      `yaml:"stale_on_error"`
+	EdgeResponses         []EdgeResponseConfig    `yaml:"edge_responses"`
+	StickySessions        StickySessionsConfig    `yaml:"sticky_sessions"`
+	Idempotency           IdempotencyConfig       `yaml:"idempotency"`
+	Autoscale             AutoscaleConfig         `yaml:"autoscale"`
+	LoadShedding          LoadSheddingConfig      `yaml:"load_shedding"`
+	ConcurrencyLimit      ConcurrencyLimitConfig  `yaml:"concurrency_limit"`
+	Priority              PriorityConfig          `yaml:"priority"`
+	StaticResponses       []StaticResponseConfig  `yaml:"static_responses"` // Используется ответ с самым длинным префиксом.
+	Normalization         NormalizationConfig     `yaml:"normalization"`
+	MethodOverride        MethodOverrideConfig    `yaml:"method_override"`
+	CORS                  []CORSRuleConfig        `yaml:"cors"`
+	HeaderRules           []HeaderRuleConfig      `yaml:"header_rules" secret:"true"` // Применяются все подходящие правила по порядку.
+	ExtAuth               ExtAuthConfig           `yaml:"ext_auth"`
+	EtcdRegistry          EtcdRegistryConfig      `yaml:"etcd_registry"`
+	BackendsFile          BackendsFileConfig      `yaml:"backends_file"`
+	Runtime               RuntimeConfig           `yaml:"runtime"`
+	ServerTimeouts        ServerTimeoutsConfig    `yaml:"server_timeouts"`
+	AdminListener         AdminListenerConfig     `yaml:"admin_listener"`
+	ClientConnections     ClientConnectionsConfig `yaml:"client_connections"`
+	WebSocket             WebSocketConfig         `yaml:"websocket"`
+	PathRewrites          []PathRewriteConfig     `yaml:"path_rewrites"` // Используется правило с самым длинным префиксом.
+	ResponseTimeouts      []ResponseTimeoutConfig `yaml:"response_timeouts"`
+	// Правила политик на языке выражений; применяется первое подходящее правило.
+	Policies []PolicyRuleConfig `yaml:"policies"`
+	// Доверенные прокси (CIDR или IP), от которых принимается X-Forwarded-For.
+	TrustedProxies []string             `yaml:"trusted_proxies"`
+	AdminAccess    AdminAccessConfig    `yaml:"admin_access"`
+	Startup        StartupConfig        `yaml:"startup"`
+	ShutdownReport ShutdownReportConfig `yaml:"shutdown_report"`
+
+	// Предупреждения разбора: некорректные значения, замененные значениями по умолчанию.
+	Warnings []string `yaml:"-"`
+}
+
+// warnf записывает предупреждение разбора конфигурации в лог и в Warnings.
+func (cfg *Config) warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("WARN: %s", msg)
+	cfg.Warnings = append(cfg.Warnings, msg)
 }
 
 // LoadConfig загружает конфигурацию из указанного файла YAML.
@@ -42,22 +695,7 @@ type Config struct {
 // Также выполняет парсинг строковых значений времени в time.Duration и валидацию.
 // Возвращает загруженную конфигурацию или ошибку, если конфигурация невалидна.
 func LoadConfig(configPath string) (*Config, error) {
-	cfg := &Config{
-		Port:                   ":8080",
-		HealthCheckIntervalStr: "10s",
-		HealthCheckTimeoutStr:  "2s",
-		Backends:               []string{},
-		RateLimiter: RateLimiterConfig{
-			Enabled:            false,
-			DefaultCapacity:    10,
-			DefaultRefillRate:  1,
-			CleanupIntervalStr: "5m",
-			DB: DBConfig{
-				Driver: "",
-				Path:   "",
-			},
-		},
-	}
+	cfg := defaultConfig()
 
 	fileData, err := os.ReadFile(configPath)
 	if err == nil {
@@ -73,25 +711,606 @@ func LoadConfig(configPath string) (*Config, error) {
 		log.Printf("INFO: Config file '%s' not found. Using defaults/env/flags.", configPath)
 	}
 
+	return finishConfig(cfg)
+}
+
+// ParseConfig разбирает конфигурацию из данных YAML так же, как LoadConfig (значения по
+// умолчанию, переменные окружения, разбор и валидация), но, в отличие от LoadConfig,
+// возвращает ошибку при некорректном YAML. Используется для проверки конфигурации-кандидата.
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := defaultConfig()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	return finishConfig(cfg)
+}
+
+// defaultConfig возвращает конфигурацию со значениями по умолчанию.
+func defaultConfig() *Config {
+	return &Config{
+		Port:                   ":8080",
+		ListenNetwork:          "tcp",
+		UnixSocketModeStr:      "0660",
+		HealthCheckIntervalStr: "10s",
+		HealthCheckTimeoutStr:  "2s",
+		HealthCheck: HealthCheckConfig{
+			Mode:               "tcp",
+			Path:               "/healthz",
+			Method:             "GET",
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 1,
+			MaxBackoffStr:      "0s",
+			DegradedLatencyStr: "0s",
+		},
+		DrainTimeoutStr:       "30s",
+		DNSRefreshIntervalStr: "30s",
+		ExtAuth: ExtAuthConfig{
+			TimeoutStr: "1s",
+		},
+		EtcdRegistry: EtcdRegistryConfig{
+			Prefix: "/lb/backends/",
+		},
+		BackendsFile: BackendsFileConfig{
+			PollIntervalStr: "2s",
+		},
+		ServerTimeouts: defaultServerTimeouts(),
+		AdminListener: AdminListenerConfig{
+			Timeouts: defaultServerTimeouts(),
+		},
+		ClientConnections: ClientConnectionsConfig{
+			MaxLifetimeStr: "0s",
+		},
+		WebSocket: WebSocketConfig{
+			IdleTimeoutStr: "10m",
+			MaxLifetimeStr: "0s",
+		},
+		Startup: StartupConfig{
+			TimeoutStr: "30s",
+		},
+		ShutdownReport: ShutdownReportConfig{
+			WebhookTimeoutStr: "5s",
+		},
+		SlowStartStr: "0s",
+		Strategy:     "round_robin",
+		Backends:     []BackendConfig{},
+		RateLimiter: RateLimiterConfig{
+			Enabled:            false,
+			DefaultCapacity:    10,
+			DefaultRefillRate:  1,
+			CleanupIntervalStr: "5m",
+			CleanupMode:        "ticker",
+			SweepThreshold:     10000,
+			DB: DBConfig{
+				Driver: "",
+				Path:   "",
+			},
+			Ban: BanConfig{
+				Enabled:     false,
+				Violations:  10,
+				WindowStr:   "1m",
+				DurationStr: "10m",
+			},
+			Tarpit: TarpitConfig{
+				Enabled:     false,
+				Threshold:   0.5,
+				MaxDelayStr: "2s",
+			},
+			Adaptive: AdaptiveThrottleConfig{
+				Enabled:   false,
+				MinFactor: 0.1,
+				Decrease:  0.5,
+				Recovery:  0.05,
+			},
+			Usage: UsageConfig{
+				MaxClients: 10000,
+			},
+			BreachWebhook: BreachWebhookConfig{
+				Enabled:     false,
+				Rejections:  100,
+				WindowStr:   "5m",
+				DebounceStr: "15m",
+				TimeoutStr:  "5s",
+				MaxClients:  10000,
+			},
+			Tenant: TenantLimitConfig{
+				Enabled:    false,
+				Header:     "X-Tenant-ID",
+				Capacity:   100,
+				RefillRate: 20,
+			},
+			Bypass: BypassTokensConfig{
+				Enabled:   false,
+				Header:    "X-RateLimit-Bypass",
+				MaxTTLStr: "1h",
+			},
+		},
+		FlapDetection: FlapDetectionConfig{
+			Enabled:     false,
+			Transitions: 4,
+			WindowStr:   "5m",
+			HoldDownStr: "0s",
+		},
+		BackendTransport: BackendTransportConfig{
+			MaxIdleConnsPerHost:      2,
+			MaxConnsPerHost:          0,
+			IdleConnTimeoutStr:       "90s",
+			ResponseHeaderTimeoutStr: "0s",
+			DialTimeoutStr:           "30s",
+			TLSHandshakeTimeoutStr:   "10s",
+			TCPKeepAliveStr:          "30s",
+			Proxy: EgressProxyConfig{
+				Mode: "environment",
+			},
+		},
+		HostHeader: HostHeaderConfig{
+			Mode: "preserve",
+		},
+		SlowRequests: SlowRequestsConfig{
+			ThresholdStr: "0s",
+		},
+		Retries: RetriesConfig{
+			MemoryBufferBytes: 1 << 20,
+			MaxBodyBytes:      100 << 20,
+		},
+		Protocol: ProtocolConfig{
+			ExpectContinue:           "forward",
+			ExpectContinueTimeoutStr: "1s",
+			HTTP10Connection:         "preserve",
+		},
+		StaleOnError: StaleOnErrorConfig{
+			MaxEntries:   1000,
+			MaxBodyBytes: 1 << 20,
+		},
+		StickySessions: StickySessionsConfig{
+			Enabled:    false,
+			CookieName: "LB_STICKY",
+			TTLStr:     "0s",
+			HTTPOnly:   true,
+			CookieMode: "plain",
+			Storage:    "cookie",
+			Redis: RedisConfig{
+				KeyPrefix:  "lb:sticky:",
+				TimeoutStr: "1s",
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			Enabled:      false,
+			WindowStr:    "24h",
+			LeaseStr:     "1m",
+			MaxBodyBytes: 1 << 20,
+			Storage:      "memory",
+			Redis: RedisConfig{
+				KeyPrefix:  "lb:idempotency:",
+				TimeoutStr: "1s",
+			},
+		},
+		Autoscale: AutoscaleConfig{
+			Enabled:                  false,
+			TargetRequestsPerBackend: 100,
+			ScaleOutThreshold:        0.8,
+			ScaleInThreshold:         0.2,
+			CheckIntervalStr:         "15s",
+			CooldownStr:              "5m",
+		},
+		LoadShedding: LoadSheddingConfig{
+			Enabled:          false,
+			MaxLatencyStr:    "0s",
+			CheckIntervalStr: "1s",
+			StepPercent:      10,
+			MaxShedPercent:   90,
+		},
+		ConcurrencyLimit: ConcurrencyLimitConfig{
+			Enabled:         false,
+			MaxInFlight:     1000,
+			MaxQueue:        1000,
+			QueueTimeoutStr: "1s",
+		},
+		Priority: PriorityConfig{
+			Enabled:      false,
+			DefaultClass: "normal",
+		},
+		MethodOverride: MethodOverrideConfig{
+			Enabled:        false,
+			AllowedMethods: []string{"PUT", "PATCH", "DELETE"},
+		},
+	}
+}
+
+// finishConfig применяет к cfg переменные окружения, разбирает строковые значения и
+// проверяет конфигурацию.
+func finishConfig(cfg *Config) (*Config, error) {
 	if addr := os.Getenv("LB_LISTEN_ADDR"); addr != "" {
 		cfg.Port = addr
 	}
 
 	var parseErr error
+	socketMode, parseErr := strconv.ParseUint(cfg.UnixSocketModeStr, 8, 32)
+	if parseErr != nil || socketMode > 0o777 {
+		cfg.warnf("Invalid unix_socket_mode '%s'. Using default 0660.", cfg.UnixSocketModeStr)
+		socketMode = 0o660
+	}
+	cfg.UnixSocketMode = os.FileMode(socketMode)
+
 	cfg.HealthCheckInterval, parseErr = time.ParseDuration(cfg.HealthCheckIntervalStr)
 	if parseErr != nil {
-		log.Printf("WARN: Invalid health_check_interval format '%s': %v. Using default 10s.", cfg.HealthCheckIntervalStr, parseErr)
+		cfg.warnf("Invalid health_check_interval format '%s': %v. Using default 10s.", cfg.HealthCheckIntervalStr, parseErr)
 		cfg.HealthCheckInterval = 10 * time.Second
 	}
 
 	cfg.HealthCheckTimeout, parseErr = time.ParseDuration(cfg.HealthCheckTimeoutStr)
 	if parseErr != nil {
-		log.Printf("WARN: Invalid health_check_timeout format '%s': %v. Using default 2s.", cfg.HealthCheckTimeoutStr, parseErr)
+		cfg.warnf("Invalid health_check_timeout format '%s': %v. Using default 2s.", cfg.HealthCheckTimeoutStr, parseErr)
 		cfg.HealthCheckTimeout = 2 * time.Second
 	}
 
-	if len(cfg.Backends) == 0 {
-		log.Fatal("FATAL: No backend servers configured. Please provide backends in config file or via environment variables.")
+	cfg.DrainTimeout, parseErr = time.ParseDuration(cfg.DrainTimeoutStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid drain_timeout format '%s': %v. Using default 30s.", cfg.DrainTimeoutStr, parseErr)
+		cfg.DrainTimeout = 30 * time.Second
+	}
+
+	cfg.parseServerTimeouts("server_timeouts", &cfg.ServerTimeouts)
+	cfg.parseServerTimeouts("admin_listener.timeouts", &cfg.AdminListener.Timeouts)
+
+	cfg.ClientConnections.MaxLifetime, parseErr = time.ParseDuration(cfg.ClientConnections.MaxLifetimeStr)
+	if parseErr != nil || cfg.ClientConnections.MaxLifetime < 0 {
+		cfg.warnf("Invalid client_connections.max_lifetime format '%s': %v. Connection lifetime is not limited.", cfg.ClientConnections.MaxLifetimeStr, parseErr)
+		cfg.ClientConnections.MaxLifetime = 0
+	}
+	if cfg.ClientConnections.MaxRequests < 0 {
+		cfg.warnf("Invalid client_connections.max_requests %d. Requests per connection are not limited.", cfg.ClientConnections.MaxRequests)
+		cfg.ClientConnections.MaxRequests = 0
+	}
+
+	cfg.WebSocket.IdleTimeout, parseErr = time.ParseDuration(cfg.WebSocket.IdleTimeoutStr)
+	if parseErr != nil || cfg.WebSocket.IdleTimeout < 0 {
+		cfg.warnf("Invalid websocket.idle_timeout format '%s': %v. Using default 10m.", cfg.WebSocket.IdleTimeoutStr, parseErr)
+		cfg.WebSocket.IdleTimeout = 10 * time.Minute
+	}
+	cfg.WebSocket.MaxLifetime, parseErr = time.ParseDuration(cfg.WebSocket.MaxLifetimeStr)
+	if parseErr != nil || cfg.WebSocket.MaxLifetime < 0 {
+		cfg.warnf("Invalid websocket.max_lifetime format '%s': %v. Upgraded connection lifetime is not limited.", cfg.WebSocket.MaxLifetimeStr, parseErr)
+		cfg.WebSocket.MaxLifetime = 0
+	}
+
+	cfg.ExtAuth.Timeout, parseErr = time.ParseDuration(cfg.ExtAuth.TimeoutStr)
+	if parseErr != nil || cfg.ExtAuth.Timeout <= 0 {
+		cfg.warnf("Invalid ext_auth.timeout format '%s': %v. Using default 1s.", cfg.ExtAuth.TimeoutStr, parseErr)
+		cfg.ExtAuth.Timeout = time.Second
+	}
+
+	cfg.DNSRefreshInterval, parseErr = time.ParseDuration(cfg.DNSRefreshIntervalStr)
+	if parseErr != nil || cfg.DNSRefreshInterval < 0 {
+		cfg.warnf("Invalid dns_refresh_interval format '%s': %v. Using default 30s.", cfg.DNSRefreshIntervalStr, parseErr)
+		cfg.DNSRefreshInterval = 30 * time.Second
+	}
+
+	cfg.Startup.Timeout, parseErr = time.ParseDuration(cfg.Startup.TimeoutStr)
+	if parseErr != nil || cfg.Startup.Timeout <= 0 {
+		cfg.warnf("Invalid startup.timeout '%s'. Using default 30s.", cfg.Startup.TimeoutStr)
+		cfg.Startup.Timeout = 30 * time.Second
+	}
+
+	cfg.ShutdownReport.WebhookTimeout, parseErr = time.ParseDuration(cfg.ShutdownReport.WebhookTimeoutStr)
+	if parseErr != nil || cfg.ShutdownReport.WebhookTimeout <= 0 {
+		cfg.warnf("Invalid shutdown_report.webhook_timeout '%s'. Using default 5s.", cfg.ShutdownReport.WebhookTimeoutStr)
+		cfg.ShutdownReport.WebhookTimeout = 5 * time.Second
+	}
+
+	cfg.HealthCheck.MaxBackoff, parseErr = time.ParseDuration(cfg.HealthCheck.MaxBackoffStr)
+	if parseErr != nil || cfg.HealthCheck.MaxBackoff < 0 {
+		cfg.warnf("Invalid health_check.max_backoff '%s'. Using default 0s (disabled).", cfg.HealthCheck.MaxBackoffStr)
+		cfg.HealthCheck.MaxBackoff = 0
+	}
+	cfg.HealthCheck.DegradedLatency, parseErr = time.ParseDuration(cfg.HealthCheck.DegradedLatencyStr)
+	if parseErr != nil || cfg.HealthCheck.DegradedLatency < 0 {
+		cfg.warnf("Invalid health_check.degraded_latency '%s'. Using default 0s (disabled).", cfg.HealthCheck.DegradedLatencyStr)
+		cfg.HealthCheck.DegradedLatency = 0
+	}
+
+	cfg.SlowStart, parseErr = time.ParseDuration(cfg.SlowStartStr)
+	if parseErr != nil || cfg.SlowStart < 0 {
+		cfg.warnf("Invalid slow_start '%s'. Using default 0s (disabled).", cfg.SlowStartStr)
+		cfg.SlowStart = 0
+	}
+
+	cfg.FlapDetection.Window, parseErr = time.ParseDuration(cfg.FlapDetection.WindowStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid flap_detection.window format '%s': %v. Using default 5m.", cfg.FlapDetection.WindowStr, parseErr)
+		cfg.FlapDetection.Window = 5 * time.Minute
+	}
+
+	cfg.FlapDetection.HoldDown, parseErr = time.ParseDuration(cfg.FlapDetection.HoldDownStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid flap_detection.hold_down format '%s': %v. Hold-down disabled.", cfg.FlapDetection.HoldDownStr, parseErr)
+		cfg.FlapDetection.HoldDown = 0
+	}
+
+	cfg.RateLimiter.CleanupInterval, parseErr = time.ParseDuration(cfg.RateLimiter.CleanupIntervalStr)
+	if parseErr != nil || cfg.RateLimiter.CleanupInterval <= 0 {
+		cfg.warnf("Invalid rate_limiter.cleanup_interval format '%s': %v. Using default 5m.", cfg.RateLimiter.CleanupIntervalStr, parseErr)
+		cfg.RateLimiter.CleanupInterval = 5 * time.Minute
+	}
+
+	cfg.RateLimiter.Bypass.MaxTTL, parseErr = time.ParseDuration(cfg.RateLimiter.Bypass.MaxTTLStr)
+	if parseErr != nil || cfg.RateLimiter.Bypass.MaxTTL <= 0 {
+		cfg.warnf("Invalid rate_limiter.bypass.max_ttl format '%s': %v. Using default 1h.", cfg.RateLimiter.Bypass.MaxTTLStr, parseErr)
+		cfg.RateLimiter.Bypass.MaxTTL = time.Hour
+	}
+
+	cfg.RateLimiter.Ban.Window, parseErr = time.ParseDuration(cfg.RateLimiter.Ban.WindowStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid rate_limiter.ban.window format '%s': %v. Using default 1m.", cfg.RateLimiter.Ban.WindowStr, parseErr)
+		cfg.RateLimiter.Ban.Window = time.Minute
+	}
+
+	cfg.RateLimiter.Ban.Duration, parseErr = time.ParseDuration(cfg.RateLimiter.Ban.DurationStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid rate_limiter.ban.duration format '%s': %v. Using default 10m.", cfg.RateLimiter.Ban.DurationStr, parseErr)
+		cfg.RateLimiter.Ban.Duration = 10 * time.Minute
+	}
+
+	cfg.RateLimiter.BreachWebhook.Window, parseErr = time.ParseDuration(cfg.RateLimiter.BreachWebhook.WindowStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid rate_limiter.breach_webhook.window format '%s': %v. Using default 5m.", cfg.RateLimiter.BreachWebhook.WindowStr, parseErr)
+		cfg.RateLimiter.BreachWebhook.Window = 5 * time.Minute
+	}
+
+	cfg.RateLimiter.BreachWebhook.Debounce, parseErr = time.ParseDuration(cfg.RateLimiter.BreachWebhook.DebounceStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid rate_limiter.breach_webhook.debounce format '%s': %v. Using default 15m.", cfg.RateLimiter.BreachWebhook.DebounceStr, parseErr)
+		cfg.RateLimiter.BreachWebhook.Debounce = 15 * time.Minute
+	}
+
+	cfg.RateLimiter.BreachWebhook.Timeout, parseErr = time.ParseDuration(cfg.RateLimiter.BreachWebhook.TimeoutStr)
+	if parseErr != nil || cfg.RateLimiter.BreachWebhook.Timeout <= 0 {
+		cfg.warnf("Invalid rate_limiter.breach_webhook.timeout format '%s': %v. Using default 5s.", cfg.RateLimiter.BreachWebhook.TimeoutStr, parseErr)
+		cfg.RateLimiter.BreachWebhook.Timeout = 5 * time.Second
+	}
+
+	cfg.RateLimiter.Tarpit.MaxDelay, parseErr = time.ParseDuration(cfg.RateLimiter.Tarpit.MaxDelayStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid rate_limiter.tarpit.max_delay format '%s': %v. Using default 2s.", cfg.RateLimiter.Tarpit.MaxDelayStr, parseErr)
+		cfg.RateLimiter.Tarpit.MaxDelay = 2 * time.Second
+	}
+
+	cfg.BackendTransport.IdleConnTimeout, parseErr = time.ParseDuration(cfg.BackendTransport.IdleConnTimeoutStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid backend_transport.idle_conn_timeout format '%s': %v. Using default 90s.", cfg.BackendTransport.IdleConnTimeoutStr, parseErr)
+		cfg.BackendTransport.IdleConnTimeout = 90 * time.Second
+	}
+
+	cfg.BackendTransport.ResponseHeaderTimeout, parseErr = time.ParseDuration(cfg.BackendTransport.ResponseHeaderTimeoutStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid backend_transport.response_header_timeout format '%s': %v. Timeout disabled.", cfg.BackendTransport.ResponseHeaderTimeoutStr, parseErr)
+		cfg.BackendTransport.ResponseHeaderTimeout = 0
+	}
+
+	cfg.BackendTransport.DialTimeout, parseErr = time.ParseDuration(cfg.BackendTransport.DialTimeoutStr)
+	if parseErr != nil || cfg.BackendTransport.DialTimeout <= 0 {
+		cfg.warnf("Invalid backend_transport.dial_timeout format '%s': %v. Using default 30s.", cfg.BackendTransport.DialTimeoutStr, parseErr)
+		cfg.BackendTransport.DialTimeout = 30 * time.Second
+	}
+
+	cfg.BackendTransport.TLSHandshakeTimeout, parseErr = time.ParseDuration(cfg.BackendTransport.TLSHandshakeTimeoutStr)
+	if parseErr != nil || cfg.BackendTransport.TLSHandshakeTimeout <= 0 {
+		cfg.warnf("Invalid backend_transport.tls_handshake_timeout format '%s': %v. Using default 10s.", cfg.BackendTransport.TLSHandshakeTimeoutStr, parseErr)
+		cfg.BackendTransport.TLSHandshakeTimeout = 10 * time.Second
+	}
+
+	cfg.BackendTransport.TCPKeepAlive, parseErr = time.ParseDuration(cfg.BackendTransport.TCPKeepAliveStr)
+	if parseErr != nil || cfg.BackendTransport.TCPKeepAlive == 0 {
+		cfg.warnf("Invalid backend_transport.tcp_keepalive format '%s': %v. Using default 30s.", cfg.BackendTransport.TCPKeepAliveStr, parseErr)
+		cfg.BackendTransport.TCPKeepAlive = 30 * time.Second
+	}
+
+	cfg.SlowRequests.Threshold, parseErr = time.ParseDuration(cfg.SlowRequests.ThresholdStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid slow_requests.threshold format '%s': %v. Slow request logging disabled.", cfg.SlowRequests.ThresholdStr, parseErr)
+		cfg.SlowRequests.Threshold = 0
+	}
+
+	cfg.Protocol.ExpectContinueTimeout, parseErr = time.ParseDuration(cfg.Protocol.ExpectContinueTimeoutStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid protocol.expect_continue_timeout format '%s': %v. Using default 1s.", cfg.Protocol.ExpectContinueTimeoutStr, parseErr)
+		cfg.Protocol.ExpectContinueTimeout = time.Second
+	}
+
+	cfg.Autoscale.CheckInterval, parseErr = time.ParseDuration(cfg.Autoscale.CheckIntervalStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid autoscale.check_interval format '%s': %v. Using default 15s.", cfg.Autoscale.CheckIntervalStr, parseErr)
+		cfg.Autoscale.CheckInterval = 15 * time.Second
+	}
+
+	cfg.Autoscale.Cooldown, parseErr = time.ParseDuration(cfg.Autoscale.CooldownStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid autoscale.cooldown format '%s': %v. Using default 5m.", cfg.Autoscale.CooldownStr, parseErr)
+		cfg.Autoscale.Cooldown = 5 * time.Minute
+	}
+
+	cfg.LoadShedding.MaxLatency, parseErr = time.ParseDuration(cfg.LoadShedding.MaxLatencyStr)
+	if parseErr != nil {
+		cfg.warnf("Invalid load_shedding.max_latency format '%s': %v. Latency threshold disabled.", cfg.LoadShedding.MaxLatencyStr, parseErr)
+		cfg.LoadShedding.MaxLatency = 0
+	}
+
+	cfg.LoadShedding.CheckInterval, parseErr = time.ParseDuration(cfg.LoadShedding.CheckIntervalStr)
+	if parseErr != nil || cfg.LoadShedding.CheckInterval <= 0 {
+		cfg.warnf("Invalid load_shedding.check_interval format '%s': %v. Using default 1s.", cfg.LoadShedding.CheckIntervalStr, parseErr)
+		cfg.LoadShedding.CheckInterval = time.Second
+	}
+
+	cfg.ConcurrencyLimit.QueueTimeout, parseErr = time.ParseDuration(cfg.ConcurrencyLimit.QueueTimeoutStr)
+	if parseErr != nil || cfg.ConcurrencyLimit.QueueTimeout <= 0 {
+		cfg.warnf("Invalid concurrency_limit.queue_timeout format '%s': %v. Using default 1s.", cfg.ConcurrencyLimit.QueueTimeoutStr, parseErr)
+		cfg.ConcurrencyLimit.QueueTimeout = time.Second
+	}
+	if cfg.LoadShedding.Enabled && cfg.LoadShedding.MaxLatency > 0 && (!cfg.ConcurrencyLimit.Enabled || cfg.ConcurrencyLimit.MaxQueue == 0) {
+		cfg.warnf("load_shedding.max_latency is measured as concurrency_limit queue wait, but the queue is disabled. Latency threshold has no effect.")
+	}
+
+	for i := range cfg.StaticResponses {
+		route := &cfg.StaticResponses[i]
+		if route.PathPrefix == "" {
+			return nil, fmt.Errorf("static_responses[%d].path_prefix must be specified", i)
+		}
+		if route.Status == 0 {
+			route.Status = 503
+		}
+	}
+
+	for i := range cfg.ResponseTimeouts {
+		route := &cfg.ResponseTimeouts[i]
+		if route.PathPrefix == "" {
+			return nil, fmt.Errorf("response_timeouts[%d].path_prefix must be specified", i)
+		}
+		route.Timeout, parseErr = time.ParseDuration(route.TimeoutStr)
+		if parseErr != nil || route.Timeout < 0 {
+			cfg.warnf("Invalid response_timeouts[%d].timeout format '%s': %v. Using server_timeouts.write %v.", i, route.TimeoutStr, parseErr, cfg.ServerTimeouts.Write)
+			route.Timeout = cfg.ServerTimeouts.Write
+		}
+	}
+
+	for i := range cfg.StaleOnError.Routes {
+		route := &cfg.StaleOnError.Routes[i]
+		if route.PathPrefix == "" {
+			return nil, fmt.Errorf("stale_on_error.routes[%d].path_prefix must be specified", i)
+		}
+		route.MaxStale, parseErr = time.ParseDuration(route.MaxStaleStr)
+		if parseErr != nil || route.MaxStale <= 0 {
+			cfg.warnf("Invalid stale_on_error.routes[%d].max_stale format '%s': %v. Using default 5m.", i, route.MaxStaleStr, parseErr)
+			route.MaxStale = 5 * time.Minute
+		}
+	}
+
+	for i, rw := range cfg.PathRewrites {
+		if !strings.HasPrefix(rw.PathPrefix, "/") {
+			return nil, fmt.Errorf("path_rewrites[%d].path_prefix must start with '/'", i)
+		}
+		if !rw.StripPrefix && rw.AddPrefix == "" && rw.Regex == "" {
+			return nil, fmt.Errorf("path_rewrites[%d] must set strip_prefix, add_prefix or regex", i)
+		}
+	}
+
+	for i := range cfg.EdgeResponses {
+		route := &cfg.EdgeResponses[i]
+		if route.PathPrefix == "" {
+			return nil, fmt.Errorf("edge_responses[%d].path_prefix must be specified", i)
+		}
+		if len(route.Allow) == 0 && !route.HeadFromCache {
+			return nil, fmt.Errorf("edge_responses[%d] must set allow or head_from_cache", i)
+		}
+		for j, m := range route.Allow {
+			route.Allow[j] = strings.ToUpper(strings.TrimSpace(m))
+			if route.Allow[j] == "" {
+				return nil, fmt.Errorf("edge_responses[%d].allow must not contain empty values", i)
+			}
+		}
+		if route.HeadFromCache && !staleRouteCovers(cfg.StaleOnError.Routes, route.PathPrefix) {
+			cfg.warnf("edge_responses[%d].head_from_cache: responses under '%s' are not stored by stale_on_error. HEAD requests will be passed to backends.", i, route.PathPrefix)
+		}
+	}
+
+	cfg.StickySessions.TTL, parseErr = time.ParseDuration(cfg.StickySessions.TTLStr)
+	if parseErr != nil || cfg.StickySessions.TTL < 0 {
+		cfg.warnf("Invalid sticky_sessions.ttl format '%s': %v. Using session cookie.", cfg.StickySessions.TTLStr, parseErr)
+		cfg.StickySessions.TTL = 0
+	}
+
+	cfg.StickySessions.Redis.Timeout, parseErr = time.ParseDuration(cfg.StickySessions.Redis.TimeoutStr)
+	if parseErr != nil || cfg.StickySessions.Redis.Timeout <= 0 {
+		cfg.warnf("Invalid sticky_sessions.redis.timeout format '%s': %v. Using default 1s.", cfg.StickySessions.Redis.TimeoutStr, parseErr)
+		cfg.StickySessions.Redis.Timeout = time.Second
+	}
+
+	cfg.Idempotency.Window, parseErr = time.ParseDuration(cfg.Idempotency.WindowStr)
+	if parseErr != nil || cfg.Idempotency.Window <= 0 {
+		cfg.warnf("Invalid idempotency.window format '%s': %v. Using default 24h.", cfg.Idempotency.WindowStr, parseErr)
+		cfg.Idempotency.Window = 24 * time.Hour
+	}
+
+	cfg.Idempotency.Lease, parseErr = time.ParseDuration(cfg.Idempotency.LeaseStr)
+	if parseErr != nil || cfg.Idempotency.Lease <= 0 {
+		cfg.warnf("Invalid idempotency.lease format '%s': %v. Using default 1m.", cfg.Idempotency.LeaseStr, parseErr)
+		cfg.Idempotency.Lease = time.Minute
+	}
+
+	cfg.Idempotency.Redis.Timeout, parseErr = time.ParseDuration(cfg.Idempotency.Redis.TimeoutStr)
+	if parseErr != nil || cfg.Idempotency.Redis.Timeout <= 0 {
+		cfg.warnf("Invalid idempotency.redis.timeout format '%s': %v. Using default 1s.", cfg.Idempotency.Redis.TimeoutStr, parseErr)
+		cfg.Idempotency.Redis.Timeout = time.Second
+	}
+
+	if cfg.ExtAuth.Enabled && cfg.ExtAuth.URL == "" {
+		return nil, fmt.Errorf("ext_auth.url must be specified when ext_auth is enabled")
+	}
+
+	for i := range cfg.CORS {
+		rule := &cfg.CORS[i]
+		if rule.PathPrefix == "" {
+			return nil, fmt.Errorf("cors[%d].path_prefix must be specified", i)
+		}
+		if len(rule.AllowedOrigins) == 0 {
+			return nil, fmt.Errorf("cors[%d].allowed_origins must not be empty", i)
+		}
+		if len(rule.AllowedMethods) == 0 {
+			rule.AllowedMethods = []string{"GET", "HEAD", "POST"}
+		}
+		if rule.MaxAgeStr != "" {
+			rule.MaxAge, parseErr = time.ParseDuration(rule.MaxAgeStr)
+			if parseErr != nil {
+				cfg.warnf("Invalid cors[%d].max_age format '%s': %v. Max-Age header disabled.", i, rule.MaxAgeStr, parseErr)
+				rule.MaxAge = 0
+			}
+		}
+	}
+
+	for i, rule := range cfg.HeaderRules {
+		if err := validateHeaderActions(rule.Request, true); err != nil {
+			return nil, fmt.Errorf("header_rules[%d].request: %w", i, err)
+		}
+		if err := validateHeaderActions(rule.Response, false); err != nil {
+			return nil, fmt.Errorf("header_rules[%d].response: %w", i, err)
+		}
+	}
+
+	if cfg.EtcdRegistry.Enabled && len(cfg.EtcdRegistry.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd_registry.endpoints must not be empty when etcd_registry is enabled")
+	}
+	if cfg.EtcdRegistry.Enabled && cfg.EtcdRegistry.Prefix == "" {
+		return nil, fmt.Errorf("etcd_registry.prefix must be specified when etcd_registry is enabled")
+	}
+
+	cfg.BackendsFile.PollInterval, parseErr = time.ParseDuration(cfg.BackendsFile.PollIntervalStr)
+	if parseErr != nil || cfg.BackendsFile.PollInterval <= 0 {
+		cfg.warnf("Invalid backends_file.poll_interval format '%s': %v. Using default 2s.", cfg.BackendsFile.PollIntervalStr, parseErr)
+		cfg.BackendsFile.PollInterval = 2 * time.Second
+	}
+
+	if len(cfg.Backends) == 0 && !cfg.EtcdRegistry.Enabled && cfg.BackendsFile.Path == "" {
+		return nil, fmt.Errorf("no backend servers configured: provide backends in config file or via environment variables")
+	}
+
+	names := make(map[string]bool, len(cfg.Backends))
+	cfg.parseBackendHealthChecks("backends", cfg.Backends)
+	if err := validateBackends("backends", cfg.Backends, names); err != nil {
+		return nil, err
+	}
+	if err := cfg.validatePools(names); err != nil {
+		return nil, err
+	}
+	if err := validateVirtualHosts(&cfg.VirtualHosts, cfg.Pools); err != nil {
+		return nil, err
+	}
+	if err := validateRoutingRules(cfg.RoutingRules, cfg.Pools); err != nil {
+		return nil, err
+	}
+	if err := validatePoolsUsed(cfg); err != nil {
+		return nil, err
+	}
+
+	if !validProtocol(cfg.BackendTransport.Protocol) {
+		return nil, fmt.Errorf("unsupported backend_transport.protocol: %s (expected 'auto', 'http1' or 'http2')", cfg.BackendTransport.Protocol)
 	}
 
 	if cfg.RateLimiter.Enabled {
@@ -101,6 +1320,45 @@ func LoadConfig(configPath string) (*Config, error) {
 		if cfg.RateLimiter.DefaultRefillRate <= 0 {
 			return nil, fmt.Errorf("rate_limiter.default_refill_rate must be positive")
 		}
+		if cfg.RateLimiter.CleanupMode != "ticker" && cfg.RateLimiter.CleanupMode != "lazy" {
+			return nil, fmt.Errorf("unsupported rate_limiter.cleanup_mode: %s (expected 'ticker' or 'lazy')", cfg.RateLimiter.CleanupMode)
+		}
+		if cfg.RateLimiter.SweepThreshold < 0 {
+			return nil, fmt.Errorf("rate_limiter.sweep_threshold must not be negative")
+		}
+		if cfg.RateLimiter.Ban.Enabled {
+			if cfg.RateLimiter.Ban.Violations < 1 {
+				return nil, fmt.Errorf("rate_limiter.ban.violations must be at least 1")
+			}
+			if cfg.RateLimiter.Ban.Window <= 0 || cfg.RateLimiter.Ban.Duration <= 0 {
+				return nil, fmt.Errorf("rate_limiter.ban.window and rate_limiter.ban.duration must be positive")
+			}
+		}
+		if cfg.RateLimiter.Usage.MaxClients < 0 {
+			return nil, fmt.Errorf("rate_limiter.usage.max_clients must not be negative")
+		}
+		if cfg.RateLimiter.BreachWebhook.Enabled {
+			if cfg.RateLimiter.BreachWebhook.URL == "" {
+				return nil, fmt.Errorf("rate_limiter.breach_webhook.url must be specified when breach_webhook is enabled")
+			}
+			if cfg.RateLimiter.BreachWebhook.Rejections < 1 {
+				return nil, fmt.Errorf("rate_limiter.breach_webhook.rejections must be at least 1")
+			}
+			if cfg.RateLimiter.BreachWebhook.Window <= 0 || cfg.RateLimiter.BreachWebhook.Debounce < 0 {
+				return nil, fmt.Errorf("rate_limiter.breach_webhook.window must be positive and debounce must not be negative")
+			}
+			if cfg.RateLimiter.BreachWebhook.MaxClients < 0 {
+				return nil, fmt.Errorf("rate_limiter.breach_webhook.max_clients must not be negative")
+			}
+		}
+		if cfg.RateLimiter.Tarpit.Enabled {
+			if cfg.RateLimiter.Tarpit.Threshold < 0 || cfg.RateLimiter.Tarpit.Threshold >= 1 {
+				return nil, fmt.Errorf("rate_limiter.tarpit.threshold must be in [0, 1)")
+			}
+			if cfg.RateLimiter.Tarpit.MaxDelay <= 0 {
+				return nil, fmt.Errorf("rate_limiter.tarpit.max_delay must be positive")
+			}
+		}
 		if cfg.RateLimiter.DB.Driver != "" {
 			if cfg.RateLimiter.DB.Driver != "sqlite" {
 				return nil, fmt.Errorf("unsupported rate_limiter.db.driver: %s (only 'sqlite' is supported)", cfg.RateLimiter.DB.Driver)
@@ -111,5 +1369,397 @@ func LoadConfig(configPath string) (*Config, error) {
 		}
 	}
 
+	if cfg.PanicThreshold < 0 || cfg.PanicThreshold > 100 {
+		return nil, fmt.Errorf("panic_threshold must be between 0 and 100")
+	}
+
+	if cfg.BackendTransport.MaxIdleConnsPerHost < 0 || cfg.BackendTransport.MaxConnsPerHost < 0 {
+		return nil, fmt.Errorf("backend_transport connection limits must not be negative")
+	}
+
+	if cfg.FlapDetection.Enabled {
+		if cfg.FlapDetection.Transitions < 2 {
+			return nil, fmt.Errorf("flap_detection.transitions must be at least 2")
+		}
+		if cfg.FlapDetection.Window <= 0 {
+			return nil, fmt.Errorf("flap_detection.window must be positive")
+		}
+	}
+
+	if cfg.StickySessions.Enabled {
+		switch cfg.StickySessions.Storage {
+		case "cookie", "memory":
+		case "redis":
+			if cfg.StickySessions.Redis.Addr == "" {
+				return nil, fmt.Errorf("sticky_sessions.redis.addr must be specified when storage is 'redis'")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported sticky_sessions.storage: %s (expected 'cookie', 'memory' or 'redis')", cfg.StickySessions.Storage)
+		}
+	}
+
+	if cfg.Idempotency.Enabled {
+		switch cfg.Idempotency.Storage {
+		case "memory":
+		case "redis":
+			if cfg.Idempotency.Redis.Addr == "" {
+				return nil, fmt.Errorf("idempotency.redis.addr must be specified when storage is 'redis'")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported idempotency.storage: %s (expected 'memory' or 'redis')", cfg.Idempotency.Storage)
+		}
+		if cfg.Idempotency.MaxBodyBytes <= 0 {
+			return nil, fmt.Errorf("idempotency.max_body_bytes must be positive")
+		}
+	}
+	if cfg.Retries.MaxRetries < 0 {
+		return nil, fmt.Errorf("retries.max_retries must not be negative")
+	}
+	if cfg.Retries.MaxRetries > 0 && (cfg.Retries.MaxBodyBytes <= 0 || cfg.Retries.MemoryBufferBytes < 0) {
+		return nil, fmt.Errorf("retries.max_body_bytes must be positive and retries.memory_buffer_bytes must not be negative")
+	}
+	for _, status := range cfg.Retries.RetryOnStatuses {
+		if status < 500 || status > 599 {
+			return nil, fmt.Errorf("retries.retry_on_statuses: %d is not a 5xx status", status)
+		}
+	}
+
 	return cfg, nil
 }
+
+// defaultServerTimeouts возвращает таймауты HTTP-сервера по умолчанию.
+func defaultServerTimeouts() ServerTimeoutsConfig {
+	return ServerTimeoutsConfig{ReadStr: "10s", WriteStr: "10s", IdleStr: "30s", ShutdownStr: "5s"}
+}
+
+// parseServerTimeouts разбирает таймауты секции section; некорректные значения заменяются
+// значениями по умолчанию.
+func (cfg *Config) parseServerTimeouts(section string, t *ServerTimeoutsConfig) {
+	defaults := defaultServerTimeouts()
+	for _, f := range []struct {
+		name string
+		str  string
+		dst  *time.Duration
+		def  string
+	}{
+		{"read", t.ReadStr, &t.Read, defaults.ReadStr},
+		{"write", t.WriteStr, &t.Write, defaults.WriteStr},
+		{"idle", t.IdleStr, &t.Idle, defaults.IdleStr},
+		{"shutdown", t.ShutdownStr, &t.Shutdown, defaults.ShutdownStr},
+	} {
+		d, err := time.ParseDuration(f.str)
+		if err != nil || d < 0 {
+			cfg.warnf("Invalid %s.%s format '%s': %v. Using default %s.", section, f.name, f.str, err, f.def)
+			d, _ = time.ParseDuration(f.def)
+		}
+		*f.dst = d
+	}
+}
+
+// parseBackendHealthChecks разбирает переопределения интервала и таймаута проверки бэкендов
+// секции section; некорректные значения заменяются общими.
+func (cfg *Config) parseBackendHealthChecks(section string, backends []BackendConfig) {
+	var parseErr error
+	for i := range backends {
+		hc := &backends[i].HealthCheck
+		if hc.IntervalStr != "" {
+			hc.Interval, parseErr = time.ParseDuration(hc.IntervalStr)
+			if parseErr != nil || hc.Interval <= 0 {
+				cfg.warnf("Invalid %s[%d].health_check.interval '%s'. Using health_check_interval.", section, i, hc.IntervalStr)
+				hc.Interval = 0
+			}
+		}
+		if hc.TimeoutStr != "" {
+			hc.Timeout, parseErr = time.ParseDuration(hc.TimeoutStr)
+			if parseErr != nil || hc.Timeout <= 0 {
+				cfg.warnf("Invalid %s[%d].health_check.timeout '%s'. Using health_check_timeout.", section, i, hc.TimeoutStr)
+				hc.Timeout = 0
+			}
+		}
+	}
+}
+
+// validateBackends проверяет бэкенды секции section. Имена бэкендов должны быть уникальны
+// во всех пулах, поэтому уже занятые имена передаются в names и дополняются. Бэкенды без
+// имени получают имя по URL при создании пулов, где уникальность проверяет balancer.JoinPools.
+func validateBackends(section string, backends []BackendConfig, names map[string]bool) error {
+	for i, b := range backends {
+		if b.URL == "" {
+			return fmt.Errorf("%s[%d].url must be specified", section, i)
+		}
+		if b.MaxRPS < 0 {
+			return fmt.Errorf("%s[%d].max_rps must not be negative", section, i)
+		}
+		if b.MaxConns < 0 {
+			return fmt.Errorf("%s[%d].max_conns must not be negative", section, i)
+		}
+		if !validProtocol(b.Protocol) {
+			return fmt.Errorf("unsupported %s[%d].protocol: %s (expected 'auto', 'http1' or 'http2')", section, i, b.Protocol)
+		}
+		if b.Name == "" {
+			continue
+		}
+		if names[b.Name] {
+			return fmt.Errorf("duplicate backend name %q", b.Name)
+		}
+		names[b.Name] = true
+	}
+	return nil
+}
+
+// validatePools проверяет пулы и переносит параметры проверки состояния пула в его бэкенды,
+// для которых они не переопределены.
+func (cfg *Config) validatePools(names map[string]bool) error {
+	pools := cfg.Pools
+	poolNames := make(map[string]bool, len(pools))
+	prefixes := make(map[string]string)
+	for i := range pools {
+		pool := &pools[i]
+		if pool.Name == "" {
+			return fmt.Errorf("pools[%d].name must be specified", i)
+		}
+		if poolNames[pool.Name] {
+			return fmt.Errorf("duplicate pool name %q", pool.Name)
+		}
+		poolNames[pool.Name] = true
+		for _, prefix := range pool.PathPrefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				return fmt.Errorf("pools[%d].path_prefixes: %q must start with '/'", i, prefix)
+			}
+			if other, ok := prefixes[prefix]; ok {
+				return fmt.Errorf("pools[%d].path_prefixes: %q is already routed to pool %q", i, prefix, other)
+			}
+			prefixes[prefix] = pool.Name
+		}
+		if len(pool.Backends) == 0 {
+			return fmt.Errorf("pools[%d].backends must not be empty", i)
+		}
+		if !validProtocol(pool.Protocol) {
+			return fmt.Errorf("unsupported pools[%d].protocol: %s (expected 'auto', 'http1' or 'http2')", i, pool.Protocol)
+		}
+		for j := range pool.Backends {
+			if pool.Backends[j].Protocol == "" {
+				pool.Backends[j].Protocol = pool.Protocol
+			}
+			hc := &pool.Backends[j].HealthCheck
+			for _, f := range []struct {
+				dst *string
+				def string
+			}{
+				{&hc.IntervalStr, pool.HealthCheck.IntervalStr},
+				{&hc.TimeoutStr, pool.HealthCheck.TimeoutStr},
+				{&hc.Mode, pool.HealthCheck.Mode},
+				{&hc.Path, pool.HealthCheck.Path},
+				{&hc.Scheme, pool.HealthCheck.Scheme},
+			} {
+				if *f.dst == "" {
+					*f.dst = f.def
+				}
+			}
+			for name, value := range pool.HealthCheck.Headers {
+				if !hasHeader(hc.Headers, name) {
+					if hc.Headers == nil {
+						hc.Headers = make(map[string]string)
+					}
+					hc.Headers[name] = value
+				}
+			}
+		}
+		cfg.applyPoolHealthCheck(i, &pool.HealthCheck)
+		section := fmt.Sprintf("pools[%d].backends", i)
+		cfg.parseBackendHealthChecks(section, pool.Backends)
+		if err := validateBackends(section, pool.Backends, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPoolHealthCheck вычисляет политику проверок пула pools[i]: общий health_check,
+// в котором заданные в пуле параметры заменяют общие.
+func (cfg *Config) applyPoolHealthCheck(i int, hc *PoolHealthCheckConfig) {
+	policy := cfg.HealthCheck
+	if hc.Method != "" {
+		policy.Method = hc.Method
+	}
+	if len(hc.ExpectedStatuses) > 0 {
+		policy.ExpectedStatuses = hc.ExpectedStatuses
+	}
+	if hc.HealthyThreshold != 0 {
+		policy.HealthyThreshold = hc.HealthyThreshold
+	}
+	if hc.UnhealthyThreshold != 0 {
+		policy.UnhealthyThreshold = hc.UnhealthyThreshold
+	}
+	if hc.ExpectedBody != "" {
+		policy.ExpectedBody = hc.ExpectedBody
+	}
+	if hc.ExpectedBodyRegex != "" {
+		policy.ExpectedBodyRegex = hc.ExpectedBodyRegex
+	}
+	if hc.GRPCService != "" {
+		policy.GRPCService = hc.GRPCService
+	}
+	if hc.DegradedLatencyStr != "" {
+		latency, err := time.ParseDuration(hc.DegradedLatencyStr)
+		if err != nil || latency < 0 {
+			cfg.warnf("Invalid pools[%d].health_check.degraded_latency '%s'. Using health_check.degraded_latency.", i, hc.DegradedLatencyStr)
+		} else {
+			policy.DegradedLatencyStr, policy.DegradedLatency = hc.DegradedLatencyStr, latency
+		}
+	}
+	hc.Policy = policy
+}
+
+// validateVirtualHosts проверяет правила virtual_hosts и приводит имена хостов к нижнему
+// регистру.
+func validateVirtualHosts(vh *VirtualHostsConfig, pools []PoolConfig) error {
+	if !knownPool(pools, vh.DefaultPool) {
+		return fmt.Errorf("virtual_hosts.default_pool: unknown pool %q", vh.DefaultPool)
+	}
+	hosts := make(map[string]bool, len(vh.Hosts))
+	for i := range vh.Hosts {
+		h := &vh.Hosts[i]
+		h.Host = normalizeHostPattern(h.Host)
+		if !validHostPattern(h.Host) {
+			return fmt.Errorf("virtual_hosts.hosts[%d].host %q must be a host name or a *.domain wildcard without port", i, h.Host)
+		}
+		if hosts[h.Host] {
+			return fmt.Errorf("virtual_hosts.hosts[%d]: duplicate host %q", i, h.Host)
+		}
+		hosts[h.Host] = true
+		if !knownPool(pools, h.Pool) {
+			return fmt.Errorf("virtual_hosts.hosts[%d].pool: unknown pool %q", i, h.Pool)
+		}
+	}
+	return nil
+}
+
+// normalizeHostPattern приводит имя хоста правила к нижнему регистру без завершающей точки.
+func normalizeHostPattern(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// validHostPattern сообщает, является ли host именем хоста или маской *.domain без порта.
+func validHostPattern(host string) bool {
+	return host != "" && !strings.Contains(host, ":") && !strings.Contains(host[1:], "*") &&
+		(!strings.HasPrefix(host, "*") || strings.HasPrefix(host, "*."))
+}
+
+// knownPool сообщает, задан ли пул name в pools ("" - основной пул).
+func knownPool(pools []PoolConfig, name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, p := range pools {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validProtocol сообщает, поддерживается ли протокол соединений с бэкендами ("" - по умолчанию).
+func validProtocol(protocol string) bool {
+	switch protocol {
+	case "", "auto", "http1", "http2":
+		return true
+	}
+	return false
+}
+
+// hasHeader сообщает, задан ли заголовок name (без учета регистра).
+func hasHeader(headers map[string]string, name string) bool {
+	for h := range headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHeaderActions проверяет имена и значения заголовков правила header_rules. Заголовок
+// Host запроса задается секцией host_header.
+func validateHeaderActions(actions HeaderActionsConfig, request bool) error {
+	names := append([]string(nil), actions.Remove...)
+	for _, values := range []map[string]string{actions.Set, actions.Add} {
+		for name, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("header %s must not contain line breaks", name)
+			}
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if request && strings.EqualFold(name, "Host") {
+			return fmt.Errorf("header Host is set by host_header")
+		}
+	}
+	return nil
+}
+
+// validatePoolsUsed проверяет, что каждый пул получает запросы по префиксу пути, правилу
+// virtual_hosts или правилу routing_rules.
+func validatePoolsUsed(cfg *Config) error {
+	used := map[string]bool{cfg.VirtualHosts.DefaultPool: true}
+	for _, h := range cfg.VirtualHosts.Hosts {
+		used[h.Pool] = true
+	}
+	for _, rule := range cfg.RoutingRules {
+		used[rule.Pool] = true
+	}
+	for i, p := range cfg.Pools {
+		if len(p.PathPrefixes) == 0 && !used[p.Name] {
+			return fmt.Errorf("pools[%d] receives no requests: specify path_prefixes or refer to it in virtual_hosts or routing_rules", i)
+		}
+	}
+	return nil
+}
+
+// staleRouteCovers сообщает, сохраняет ли stale_on_error ответы для путей с префиксом prefix.
+func staleRouteCovers(routes []StaleRouteConfig, prefix string) bool {
+	for _, route := range routes {
+		if strings.HasPrefix(prefix, route.PathPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRoutingRules проверяет правила routing_rules и приводит методы к верхнему регистру,
+// а имена хостов - к нижнему.
+func validateRoutingRules(rules []RoutingRuleConfig, pools []PoolConfig) error {
+	for i := range rules {
+		rule := &rules[i]
+		if len(rule.Methods) == 0 && len(rule.Headers) == 0 && len(rule.Query) == 0 {
+			return fmt.Errorf("routing_rules[%d] must match methods, headers or query parameters", i)
+		}
+		for j, m := range rule.Methods {
+			rule.Methods[j] = strings.ToUpper(strings.TrimSpace(m))
+			if rule.Methods[j] == "" {
+				return fmt.Errorf("routing_rules[%d].methods must not contain empty values", i)
+			}
+		}
+		for name := range rule.Headers {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("routing_rules[%d].headers must not contain empty names", i)
+			}
+		}
+		if rule.Host != "" {
+			rule.Host = normalizeHostPattern(rule.Host)
+			if !validHostPattern(rule.Host) {
+				return fmt.Errorf("routing_rules[%d].host %q must be a host name or a *.domain wildcard without port", i, rule.Host)
+			}
+		}
+		if rule.PathPrefix != "" && !strings.HasPrefix(rule.PathPrefix, "/") {
+			return fmt.Errorf("routing_rules[%d].path_prefix %q must start with '/'", i, rule.PathPrefix)
+		}
+		if !knownPool(pools, rule.Pool) {
+			return fmt.Errorf("routing_rules[%d].pool: unknown pool %q", i, rule.Pool)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package connlimit ограничивает число запросов и время жизни клиентских keep-alive
+// соединений. Долгоживущие соединения закрываются по исчерпании лимита, и клиент
+// переподключается, поэтому после развертывания новых экземпляров балансировщика (или за
+// внешним L4-балансировщиком) нагрузка перераспределяется, а не остается на старых соединениях.
+package connlimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+// Причины закрытия соединения (метка reason метрики lb_client_conn_limit_closes_total).
+const (
+	reasonMaxRequests = "max_requests"
+	reasonMaxLifetime = "max_lifetime"
+)
+
+var closesTotal = metrics.NewCounterVec("lb_client_conn_limit_closes_total",
+	"Client connections closed by connection limits, by reason (max_requests, max_lifetime).", "reason")
+
+// Limits задает ограничения соединения. Нулевое значение означает отсутствие ограничения.
+type Limits struct {
+	MaxRequests int           // Максимум запросов в одном соединении.
+	MaxLifetime time.Duration // Максимальное время жизни соединения.
+}
+
+// Enabled сообщает, задано ли хотя бы одно ограничение.
+func (l Limits) Enabled() bool {
+	return l.MaxRequests > 0 || l.MaxLifetime > 0
+}
+
+// conn - состояние клиентского соединения.
+type conn struct {
+	netConn  net.Conn
+	requests atomic.Int64
+	expired  atomic.Bool // Время жизни истекло.
+	closing  atomic.Bool // Последний ответ отправлен с Connection: close.
+	idle     atomic.Bool // Соединение ожидает следующего запроса.
+	timer    *time.Timer
+}
+
+type ctxKey struct{}
+
+// tracker отслеживает соединения одного сервера.
+type tracker struct {
+	limits Limits
+	conns  sync.Map // net.Conn -> *conn
+}
+
+// Apply включает ограничения limits для сервера srv: оборачивает его обработчик и
+// устанавливает ConnContext и ConnState (ранее заданные хуки вызываются). Должна вызываться
+// до запуска сервера.
+//
+// Соединение, исчерпавшее лимит запросов или время жизни, закрывается после текущего ответа
+// (заголовок Connection: close, для HTTP/2 - GOAWAY), активные запросы не прерываются.
+// Простаивающее соединение с истекшим временем жизни закрывается сразу.
+func Apply(srv *http.Server, limits Limits) {
+	if !limits.Enabled() {
+		return
+	}
+	t := &tracker{limits: limits}
+	srv.Handler = t.middleware(srv.Handler)
+
+	prevConnContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if prevConnContext != nil {
+			ctx = prevConnContext(ctx, c)
+		}
+		return context.WithValue(ctx, ctxKey{}, t.open(c))
+	}
+	prevConnState := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		t.setState(c, state)
+		if prevConnState != nil {
+			prevConnState(c, state)
+		}
+	}
+}
+
+// open регистрирует новое соединение и запускает таймер его времени жизни.
+func (t *tracker) open(c net.Conn) *conn {
+	info := &conn{netConn: c}
+	if t.limits.MaxLifetime > 0 {
+		info.timer = time.AfterFunc(t.limits.MaxLifetime, func() {
+			info.expired.Store(true)
+			if info.idle.Load() {
+				info.close(reasonMaxLifetime)
+			}
+		})
+	}
+	t.conns.Store(c, info)
+	return info
+}
+
+// setState учитывает переход соединения c в состояние state.
+func (t *tracker) setState(c net.Conn, state http.ConnState) {
+	value, ok := t.conns.Load(c)
+	if !ok {
+		return
+	}
+	info := value.(*conn)
+	switch state {
+	case http.StateActive:
+		info.idle.Store(false)
+	case http.StateIdle:
+		info.idle.Store(true)
+		// Истечение таймера во время обработки запроса не закрывает соединение; если ответ
+		// ушел без Connection: close (например, для HTTP/2 соединение закрывается только по
+		// GOAWAY), соединение закрывается здесь.
+		if info.expired.Load() && !info.closing.Load() {
+			info.close(reasonMaxLifetime)
+		}
+	case http.StateHijacked, http.StateClosed:
+		if info.timer != nil {
+			info.timer.Stop()
+		}
+		t.conns.Delete(c)
+	}
+}
+
+// close закрывает простаивающее соединение.
+func (c *conn) close(reason string) {
+	if c.closing.CompareAndSwap(false, true) {
+		closesTotal.With(reason).Inc()
+		_ = c.netConn.Close()
+	}
+}
+
+// middleware учитывает запросы соединения и добавляет в ответ Connection: close, если
+// соединение исчерпало лимит.
+func (t *tracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(ctxKey{}).(*conn); ok {
+			n := info.requests.Add(1)
+			reason := ""
+			switch {
+			case t.limits.MaxRequests > 0 && n >= int64(t.limits.MaxRequests):
+				reason = reasonMaxRequests
+			case info.expired.Load():
+				reason = reasonMaxLifetime
+			}
+			if reason != "" && info.closing.CompareAndSwap(false, true) {
+				closesTotal.With(reason).Inc()
+				w.Header().Set("Connection", "close")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
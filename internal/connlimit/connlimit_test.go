@@ -0,0 +1,68 @@
+package connlimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer запускает тестовый сервер с ограничениями limits.
+func newServer(t *testing.T, limits Limits) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	Apply(srv.Config, limits)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get выполняет запрос и сообщает, было ли переиспользовано keep-alive соединение и закрыто
+// ли оно сервером после ответа.
+func get(t *testing.T, client *http.Client, url string) (reused, closed bool) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+	}))
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return reused, resp.Close
+}
+
+// TestApply_MaxRequests проверяет закрытие соединения после MaxRequests запросов.
+func TestApply_MaxRequests(t *testing.T) {
+	srv := newServer(t, Limits{MaxRequests: 2})
+	client := srv.Client()
+
+	reused, closed := get(t, client, srv.URL)
+	assert.False(t, reused)
+	assert.False(t, closed)
+	reused, closed = get(t, client, srv.URL)
+	assert.True(t, reused)
+	assert.True(t, closed, "Last allowed request closes the connection")
+	reused, _ = get(t, client, srv.URL)
+	assert.False(t, reused, "Client reconnects after the limit")
+}
+
+// TestApply_MaxLifetime проверяет закрытие простаивающего соединения с истекшим временем
+// жизни.
+func TestApply_MaxLifetime(t *testing.T) {
+	srv := newServer(t, Limits{MaxLifetime: 50 * time.Millisecond})
+	client := srv.Client()
+
+	reused, _ := get(t, client, srv.URL)
+	assert.False(t, reused)
+	reused, _ = get(t, client, srv.URL)
+	assert.True(t, reused, "Connection is kept alive within its lifetime")
+
+	time.Sleep(150 * time.Millisecond)
+	reused, _ = get(t, client, srv.URL)
+	assert.False(t, reused, "Expired idle connection is closed")
+}
@@ -0,0 +1,61 @@
+package httputil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StrongETag возвращает сильный ETag содержимого (усеченный SHA-256 в кавычках).
+func StrongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified проверяет условия If-None-Match и If-Modified-Since запроса GET или HEAD
+// (RFC 7232) для ответа с указанными ETag и Last-Modified. Возвращает true, если клиенту
+// можно ответить 304 Not Modified. If-None-Match имеет приоритет над If-Modified-Since.
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// Для GET и HEAD используется слабое сравнение: префикс W/ не учитывается.
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// notModifiedHeaders - заголовки, сохраняемые в ответе 304 (RFC 7232, раздел 4.1).
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"}
+
+// WriteNotModified отправляет 304 Not Modified, оставляя из header только заголовки,
+// допустимые в таком ответе.
+func WriteNotModified(w http.ResponseWriter, header http.Header) {
+	header = header.Clone() // header может быть заголовками самого w.
+	dst := w.Header()
+	for name := range dst {
+		delete(dst, name)
+	}
+	for _, name := range notModifiedHeaders {
+		for _, value := range header.Values(name) {
+			dst.Add(name, value)
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
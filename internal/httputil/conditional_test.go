@@ -0,0 +1,44 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNotModified проверяет обработку If-None-Match и If-Modified-Since.
+func TestNotModified(t *testing.T) {
+	etag := StrongETag([]byte("content"))
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	assert.True(t, NotModified(req, etag, modified), "Weak comparison must match W/ prefix")
+
+	req.Header.Set("If-None-Match", `"other"`)
+	req.Header.Set("If-Modified-Since", modified.Format(http.TimeFormat))
+	assert.False(t, NotModified(req, etag, modified), "If-None-Match takes precedence over If-Modified-Since")
+
+	req.Header.Del("If-None-Match")
+	assert.True(t, NotModified(req, etag, modified))
+	assert.False(t, NotModified(req, etag, modified.Add(time.Hour)))
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("If-None-Match", "*")
+	assert.False(t, NotModified(req, etag, modified), "Only GET and HEAD are answered with 304")
+}
+
+// TestWriteNotModified проверяет, что в ответе 304 остаются только допустимые заголовки.
+func TestWriteNotModified(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("ETag", `"v1"`)
+	rr.Header().Set("Content-Type", "text/plain")
+
+	WriteNotModified(rr, rr.Header())
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Equal(t, `"v1"`, rr.Header().Get("ETag"))
+	assert.Empty(t, rr.Header().Get("Content-Type"))
+}
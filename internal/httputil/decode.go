@@ -0,0 +1,106 @@
+package httputil
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrBodyTooLarge возвращается, если тело (сжатое или распакованное) превышает лимит.
+	ErrBodyTooLarge = errors.New("body exceeds size limit")
+	// ErrUnsupportedEncoding возвращается для Content-Encoding, который нельзя распаковать.
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// DecodeBody распаковывает тело с указанным Content-Encoding (gzip, deflate или их цепочка)
+// для анализа функциями инспекции. limit ограничивает размер распакованных данных
+// и защищает от "zip-бомб"; при превышении возвращается ErrBodyTooLarge.
+func DecodeBody(raw []byte, contentEncoding string, limit int64) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	data := raw
+	// Кодировки применялись в порядке перечисления, снимаем их в обратном.
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		var reader io.Reader
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid gzip body: %w", err)
+			}
+			defer gz.Close()
+			reader = gz
+		case "deflate":
+			// По RFC 9110 deflate - это zlib-поток, но часть клиентов отправляет "сырой" deflate.
+			if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+				defer zr.Close()
+				reader = zr
+			} else {
+				fr := flate.NewReader(bytes.NewReader(data))
+				defer fr.Close()
+				reader = fr
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+		}
+
+		decoded, err := io.ReadAll(io.LimitReader(reader, limit+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s body: %w", encoding, err)
+		}
+		if int64(len(decoded)) > limit {
+			return nil, ErrBodyTooLarge
+		}
+		data = decoded
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+// InspectRequestBody возвращает распакованное тело запроса для анализа, не изменяя запрос:
+// исходные (сжатые) байты возвращаются в r.Body перед непрочитанным остатком, поэтому бэкенд
+// получает тело целиком и в той кодировке, которую выбрал клиент, даже если оно больше
+// лимита. limit ограничивает как сжатое, так и распакованное тело.
+func InspectRequestBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body := r.Body
+	raw, err := io.ReadAll(io.LimitReader(body, limit+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(raw), body), body}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if int64(len(raw)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return DecodeBody(raw, r.Header.Get("Content-Encoding"), limit)
+}
+
+// InspectResponseBody возвращает распакованное тело буферизованного ответа для анализа
+// (например, вычисления ETag по содержимому) с учетом Content-Encoding из header; body
+// не изменяется, клиенту и в кэш ответ передается в исходной кодировке. limit ограничивает
+// как сжатое, так и распакованное тело.
+func InspectResponseBody(header http.Header, body []byte, limit int64) ([]byte, error) {
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return DecodeBody(body, strings.Join(header.Values("Content-Encoding"), ","), limit)
+}
+
+// readCloser читает из Reader и закрывает исходное тело запроса.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
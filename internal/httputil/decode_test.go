@@ -0,0 +1,103 @@
+package httputil
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	}
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// TestDecodeBody проверяет распаковку поддерживаемых кодировок и соблюдение лимита размера.
+func TestDecodeBody(t *testing.T) {
+	plain := []byte(`{"user":"alice"}`)
+
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		header := encoding
+		if encoding == "raw-deflate" {
+			header = "deflate"
+		}
+		decoded, err := DecodeBody(compress(t, encoding, plain), header, 1024)
+		require.NoError(t, err, encoding)
+		assert.Equal(t, plain, decoded, encoding)
+	}
+
+	chained := compress(t, "gzip", compress(t, "deflate", plain))
+	decoded, err := DecodeBody(chained, "deflate, gzip", 1024)
+	require.NoError(t, err)
+	assert.Equal(t, plain, decoded)
+
+	bomb := compress(t, "gzip", bytes.Repeat([]byte("a"), 1<<20))
+	_, err = DecodeBody(bomb, "gzip", 1024)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	_, err = DecodeBody(plain, "br", 1024)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+// TestInspectRequestBody проверяет, что после инспекции запрос сохраняет исходное сжатое тело.
+func TestInspectRequestBody(t *testing.T) {
+	compressed := compress(t, "gzip", []byte("hello"))
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed))
+	r.Header.Set("Content-Encoding", "gzip")
+
+	decoded, err := InspectRequestBody(r, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(decoded))
+
+	forwarded, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, compressed, forwarded)
+
+	large := strings.Repeat("x", 2048)
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(large))
+	_, err = InspectRequestBody(r, 1024)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	forwarded, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, large, string(forwarded), "Body over the limit is forwarded in full")
+}
+
+// TestInspectResponseBody проверяет распаковку тела ответа без изменения исходных байтов.
+func TestInspectResponseBody(t *testing.T) {
+	compressed := compress(t, "gzip", []byte("hello"))
+	original := bytes.Clone(compressed)
+	header := http.Header{"Content-Encoding": {"gzip"}}
+
+	decoded, err := InspectResponseBody(header, compressed, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(decoded))
+	assert.Equal(t, original, compressed)
+
+	_, err = InspectResponseBody(header, compressed, 3)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	_, err = InspectResponseBody(http.Header{"Content-Encoding": {"br"}}, compressed, 1024)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
@@ -10,6 +10,8 @@ import (
 type APIError struct {
 	Code    int    `json:"code"`    // HTTP статус код ошибки.
 	Message string `json:"message"` // Описание ошибки для клиента.
+	// Errors - ошибки отдельных полей запроса (см. RespondWithValidationErrors).
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
 // RespondWithError отправляет JSON-ответ с ошибкой клиенту.
@@ -0,0 +1,15 @@
+package httputil
+
+import "strings"
+
+// PathHasPrefix сообщает, начинается ли путь path с префикса prefix по границе сегмента:
+// префикс заканчивается на "/" или за ним следует "/" либо конец пути. Так префикс "/api"
+// подходит для "/api" и "/api/users", но не для "/apix". Пустой префикс подходит для любого
+// пути. Так сравнивают путь запроса все правила с path_prefix.
+func PathHasPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	rest := path[len(prefix):]
+	return prefix == "" || strings.HasSuffix(prefix, "/") || rest == "" || rest[0] == '/'
+}
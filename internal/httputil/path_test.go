@@ -0,0 +1,19 @@
+package httputil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPathHasPrefix проверяет сравнение префикса пути по границе сегмента.
+func TestPathHasPrefix(t *testing.T) {
+	assert.True(t, PathHasPrefix("/api", "/api"))
+	assert.True(t, PathHasPrefix("/api/users", "/api"))
+	assert.False(t, PathHasPrefix("/apix", "/api"))
+	assert.True(t, PathHasPrefix("/api/users", "/api/"))
+	assert.False(t, PathHasPrefix("/api", "/api/"), "Prefix with a trailing slash needs the slash in the path")
+	assert.True(t, PathHasPrefix("/anything", ""))
+	assert.True(t, PathHasPrefix("/anything", "/"))
+	assert.False(t, PathHasPrefix("/v1", "/api"))
+}
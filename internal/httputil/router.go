@@ -0,0 +1,46 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Router - http.ServeMux, который не паникует при повторной или конфликтующей регистрации
+// маршрута, а запоминает ошибку. Это позволяет сообщить о всех конфликтах маршрутов
+// при самопроверке (см. Conflicts), а не аварийно завершиться на первом из них.
+type Router struct {
+	mux       *http.ServeMux
+	conflicts []error
+}
+
+// NewRouter создает пустой Router.
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Handle регистрирует обработчик для шаблона pattern. Конфликтующая регистрация
+// пропускается и запоминается.
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	defer func() {
+		if r := recover(); r != nil {
+			rt.conflicts = append(rt.conflicts, fmt.Errorf("route %q: %v", pattern, r))
+		}
+	}()
+	rt.mux.Handle(pattern, handler)
+}
+
+// HandleFunc регистрирует функцию-обработчик для шаблона pattern. См. Handle.
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// ServeHTTP передает запрос зарегистрированному обработчику.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Conflicts возвращает ошибку со всеми пропущенными конфликтующими регистрациями или nil.
+func (rt *Router) Conflicts() error {
+	return errors.Join(rt.conflicts...)
+}
@@ -0,0 +1,32 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRouter_Conflicts проверяет, что повторная регистрация маршрута не вызывает panic,
+// сообщается через Conflicts, а первый обработчик остается в силе.
+func TestRouter_Conflicts(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/admin/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	require.NoError(t, router.Conflicts())
+
+	router.HandleFunc("/admin/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.HandleFunc("/admin/traffic", func(w http.ResponseWriter, r *http.Request) {})
+	err := router.Conflicts()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"/admin/stats"`)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/stats", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
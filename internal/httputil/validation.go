@@ -0,0 +1,80 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// FieldError описывает ошибку валидации одного поля запроса: имя поля, нарушенное
+// ограничение и полученное значение.
+type FieldError struct {
+	Field      string `json:"field"`
+	Constraint string `json:"constraint"`
+	Value      any    `json:"value"`
+}
+
+// ValidationErrors - список ошибок валидации полей запроса. Реализует error, поэтому
+// может возвращаться функциями проверки и распознаваться через errors.As.
+type ValidationErrors []FieldError
+
+// Add добавляет ошибку поля field: ограничение constraint не выполнено для значения value.
+func (v *ValidationErrors) Add(field, constraint string, value any) {
+	*v = append(*v, FieldError{Field: field, Constraint: constraint, Value: value})
+}
+
+// Error возвращает ошибки всех полей одной строкой.
+func (v ValidationErrors) Error() string {
+	parts := make([]string, 0, len(v))
+	for _, fe := range v {
+		parts = append(parts, fmt.Sprintf("%s %s (got %v)", fe.Field, fe.Constraint, fe.Value))
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// RespondWithValidationErrors отправляет ответ 400 Bad Request со списком ошибок полей.
+func RespondWithValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	log.Printf("ERROR: Responding with error: code=%d, message=%s", http.StatusBadRequest, errs.Error())
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	resp := APIError{Code: http.StatusBadRequest, Message: "Validation failed", Errors: errs}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("ERROR: Could not encode error JSON response: %v", err)
+	}
+}
+
+// RespondWithValidationError отправляет ответ 400 Bad Request для ошибки err: список ошибок
+// полей, если err содержит ValidationErrors, иначе - текст ошибки.
+func RespondWithValidationError(w http.ResponseWriter, err error) {
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		RespondWithValidationErrors(w, errs)
+		return
+	}
+	RespondWithError(w, http.StatusBadRequest, err.Error())
+}
+
+// DecodeJSONBody декодирует JSON-тело запроса в dst. Значение неверного типа возвращается
+// как ValidationErrors с именем поля, остальные ошибки разбора - как есть.
+func DecodeJSONBody(r *http.Request, dst any) error {
+	defer r.Body.Close()
+	err := json.NewDecoder(r.Body).Decode(dst)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		var errs ValidationErrors
+		errs.Add(typeErr.Field, "must be of type "+typeErr.Type.String(), typeErr.Value)
+		return errs
+	case errors.Is(err, io.EOF):
+		return errors.New("invalid request body: body is empty")
+	default:
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+}
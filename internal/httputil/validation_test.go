@@ -0,0 +1,62 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRespondWithValidationErrors проверяет формат ответа с ошибками полей.
+func TestRespondWithValidationErrors(t *testing.T) {
+	var errs ValidationErrors
+	errs.Add("capacity", "must be positive", -1)
+	errs.Add("rate", "must be positive", 0)
+
+	rec := httptest.NewRecorder()
+	RespondWithValidationErrors(rec, errs)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Field      string `json:"field"`
+			Constraint string `json:"constraint"`
+			Value      any    `json:"value"`
+		} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Len(t, resp.Errors, 2)
+	assert.Equal(t, "capacity", resp.Errors[0].Field)
+	assert.Equal(t, "must be positive", resp.Errors[0].Constraint)
+	assert.Equal(t, -1.0, resp.Errors[0].Value)
+	assert.Equal(t, "rate", resp.Errors[1].Field)
+}
+
+// TestDecodeJSONBody проверяет, что значение неверного типа возвращается как ошибка поля.
+func TestDecodeJSONBody(t *testing.T) {
+	var dst struct {
+		Capacity int64 `json:"capacity"`
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"capacity": "ten"}`))
+	err := DecodeJSONBody(req, &dst)
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "capacity", errs[0].Field)
+	assert.Equal(t, "must be of type int64", errs[0].Constraint)
+
+	rec := httptest.NewRecorder()
+	RespondWithValidationError(rec, DecodeJSONBody(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{`)), &dst))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"errors"`, "Malformed JSON is not a field error")
+
+	require.NoError(t, DecodeJSONBody(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"capacity": 10}`)), &dst))
+	assert.Equal(t, int64(10), dst.Capacity)
+}
@@ -0,0 +1,233 @@
+// Package idempotency реализует дедупликацию неидемпотентных запросов по заголовку
+// Idempotency-Key: ответ на первый запрос сохраняется на время окна, а повторы
+// (например, ретраи клиента после таймаута) получают сохраненный ответ без обращения к бэкенду.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+const (
+	// HeaderKey - заголовок запроса с ключом идемпотентности.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed выставляется в ответах, отданных из сохраненной записи.
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// defaultLease - время резервирования ключа обрабатываемым запросом, если Config.Lease не задан.
+	defaultLease = time.Minute
+)
+
+var requestsTotal = metrics.NewCounterVec("lb_idempotency_requests_total",
+	"Requests carrying an Idempotency-Key, by outcome (stored, replayed, in_progress, mismatch, skipped, error).", "outcome")
+
+// Config - параметры дедупликации.
+type Config struct {
+	Window       time.Duration // Время хранения ответа.
+	Lease        time.Duration // Время резервирования ключа на время обработки запроса (0 - 1m).
+	MaxBodyBytes int64         // Максимальный размер тела запроса и ответа.
+}
+
+// Middleware возвращает middleware дедупликации запросов POST и PATCH с заголовком
+// Idempotency-Key. Повтор с тем же ключом получает сохраненный ответ с заголовком
+// Idempotent-Replayed: true; повтор во время обработки первого запроса - 409 Conflict;
+// повтор с тем же ключом, но другим запросом (метод, путь или тело) - 422.
+// Ответы 5xx не сохраняются, чтобы клиент мог повторить запрос; ключ освобождается и тогда,
+// когда обработчик завершился паникой (например, http.ErrAbortHandler при обрыве ответа
+// бэкенда). Резервирование ограничено сроком Lease, чтобы ключ, не освобожденный из-за
+// аварийной остановки реплики, не блокировал повторы на все окно Window. Запросы и ответы больше
+// MaxBodyBytes, а также запросы при недоступности хранилища обрабатываются без дедупликации.
+// Ключи разных клиентов не пересекаются (см. callerScope); Set-Cookie не сохраняется
+// и при повторе не отдается.
+func Middleware(store Store, cfg Config) func(http.Handler) http.Handler {
+	lease := cfg.Lease
+	if lease <= 0 {
+		lease = defaultLease
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				httputil_pkg.RespondWithError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			// Отпечаток вычисляется по распакованному телу: повтор того же запроса совпадает,
+			// даже если клиент сжал его иначе. Бэкенд получает тело в исходном виде.
+			body, err := httputil_pkg.InspectRequestBody(r, cfg.MaxBodyBytes)
+			if err != nil {
+				// Тело больше лимита или не распаковывается: запрос проксируется без дедупликации.
+				if !errors.Is(err, httputil_pkg.ErrBodyTooLarge) {
+					log.Printf("WARN: Cannot inspect body of [%s %s], processing without deduplication: %v", r.Method, r.URL.Path, err)
+				}
+				requestsTotal.With("skipped").Inc()
+				next.ServeHTTP(w, r)
+				return
+			}
+			fingerprint := requestFingerprint(r, body)
+			key = callerScope(r) + ":" + key
+
+			reserved, err := store.Reserve(key, fingerprint, lease)
+			if err != nil {
+				log.Printf("WARN: Idempotency store unavailable, processing [%s %s] without deduplication: %v", r.Method, r.URL.Path, err)
+				requestsTotal.With("error").Inc()
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !reserved {
+				respondExisting(w, r, store, key, fingerprint)
+				return
+			}
+
+			// Ключ освобождается при любом исходе, кроме сохраненного ответа, в том числе
+			// при панике обработчика.
+			stored := false
+			defer func() {
+				if stored {
+					return
+				}
+				if err := store.Delete(key); err != nil {
+					log.Printf("WARN: Failed to release Idempotency-Key for [%s %s]: %v", r.Method, r.URL.Path, err)
+				}
+			}()
+
+			rw := &recordingWriter{ResponseWriter: w, maxBodyBytes: cfg.MaxBodyBytes}
+			next.ServeHTTP(rw, r)
+
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+			if rw.status >= http.StatusInternalServerError || rw.overflow {
+				requestsTotal.With("skipped").Inc()
+				return
+			}
+			rec := &Record{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				Status:      rw.status,
+				Header:      rw.Header().Clone(),
+				Body:        rw.body.Bytes(),
+			}
+			// Cookie адресованы клиенту, выполнившему первый запрос, и в повтор не попадают.
+			rec.Header.Del("Set-Cookie")
+			if err := store.Save(key, rec, cfg.Window); err != nil {
+				log.Printf("WARN: Failed to store response for Idempotency-Key on [%s %s]: %v", r.Method, r.URL.Path, err)
+				requestsTotal.With("error").Inc()
+				return
+			}
+			stored = true
+			requestsTotal.With("stored").Inc()
+		})
+	}
+}
+
+// respondExisting отвечает на повтор запроса с уже занятым ключом.
+func respondExisting(w http.ResponseWriter, r *http.Request, store Store, key, fingerprint string) {
+	rec, err := store.Get(key)
+	if err != nil {
+		log.Printf("ERROR: Failed to read Idempotency-Key record for [%s %s]: %v", r.Method, r.URL.Path, err)
+		requestsTotal.With("error").Inc()
+		httputil_pkg.RespondWithError(w, http.StatusServiceUnavailable, "Idempotency store unavailable")
+		return
+	}
+	switch {
+	case rec == nil:
+		// Запись истекла или удалена между резервированием и чтением - клиент может повторить.
+		requestsTotal.With("in_progress").Inc()
+		w.Header().Set("Retry-After", "1")
+		httputil_pkg.RespondWithError(w, http.StatusConflict, "Request with this Idempotency-Key is being processed")
+	case rec.Fingerprint != fingerprint:
+		requestsTotal.With("mismatch").Inc()
+		httputil_pkg.RespondWithError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+	case !rec.Completed:
+		requestsTotal.With("in_progress").Inc()
+		w.Header().Set("Retry-After", "1")
+		httputil_pkg.RespondWithError(w, http.StatusConflict, "Request with this Idempotency-Key is being processed")
+	default:
+		requestsTotal.With("replayed").Inc()
+		for name, values := range rec.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(HeaderReplayed, "true")
+		w.WriteHeader(rec.Status)
+		_, _ = w.Write(rec.Body)
+	}
+}
+
+// callerScope возвращает пространство имен ключей идемпотентности для клиента: хеш
+// Authorization или X-API-Key, а без них - IP-адрес клиента. Одинаковые ключи разных
+// клиентов не совпадают, и клиент не может получить сохраненный ответ другого клиента.
+func callerScope(r *http.Request) string {
+	for _, name := range []string{"Authorization", "X-API-Key"} {
+		if value := r.Header.Get(name); value != "" {
+			sum := sha256.Sum256([]byte(value))
+			return "cred:" + hex.EncodeToString(sum[:16])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// requestFingerprint вычисляет отпечаток запроса: метод, путь с параметрами и тело.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter передает ответ клиенту и одновременно копирует его для сохранения.
+type recordingWriter struct {
+	http.ResponseWriter
+	status       int
+	body         bytes.Buffer
+	maxBodyBytes int64
+	overflow     bool // Ответ больше maxBodyBytes и не будет сохранен.
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if !rw.overflow {
+		if int64(rw.body.Len()+len(p)) > rw.maxBodyBytes {
+			rw.overflow = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(p)
+		}
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,255 @@
+package idempotency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud/load_balancer/internal/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(store Store, status int, calls *atomic.Int32) http.Handler {
+	cfg := Config{Window: time.Minute, MaxBodyBytes: 1024}
+	return Middleware(store, cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Order", "42")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("created:" + string(body)))
+	}))
+}
+
+func doRequest(h http.Handler, method, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestMiddleware_Replay проверяет, что повтор с тем же ключом получает сохраненный ответ
+// без повторного обращения к обработчику.
+func TestMiddleware_Replay(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestHandler(NewMemoryStore(), http.StatusCreated, &calls)
+
+	first := doRequest(h, http.MethodPost, "k1", "item")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(HeaderReplayed))
+
+	second := doRequest(h, http.MethodPost, "k1", "item")
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get(HeaderReplayed))
+	assert.Equal(t, "42", second.Header().Get("X-Order"))
+	assert.Equal(t, "created:item", second.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Без ключа и для GET дедупликация не выполняется.
+	doRequest(h, http.MethodPost, "", "item")
+	doRequest(h, http.MethodGet, "k1", "")
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+// TestMiddleware_Mismatch проверяет отклонение повторного использования ключа для другого запроса.
+func TestMiddleware_Mismatch(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestHandler(NewMemoryStore(), http.StatusCreated, &calls)
+
+	doRequest(h, http.MethodPost, "k1", "item")
+	rec := doRequest(h, http.MethodPost, "k1", "other")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+// TestMiddleware_InProgress проверяет ответ 409 на повтор во время обработки первого запроса.
+func TestMiddleware_InProgress(t *testing.T) {
+	store := NewMemoryStore()
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	ok, err := store.Reserve(callerScope(req)+":k1", requestFingerprint(req, []byte("item")), time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	var calls atomic.Int32
+	rec := doRequest(newTestHandler(store, http.StatusCreated, &calls), http.MethodPost, "k1", "item")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Zero(t, calls.Load())
+}
+
+// TestMiddleware_CallerScope проверяет, что одинаковые ключи разных клиентов не пересекаются,
+// а Set-Cookie первого ответа не попадает в повтор.
+func TestMiddleware_CallerScope(t *testing.T) {
+	var calls atomic.Int32
+	h := Middleware(NewMemoryStore(), Config{Window: time.Minute, MaxBodyBytes: 1024})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Set-Cookie", "session="+r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("order for " + r.Header.Get("Authorization")))
+		}))
+	send := func(auth, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("item"))
+		req.Header.Set(HeaderKey, "k1")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	alice := send("Bearer alice", "192.0.2.1:1000")
+	bob := send("Bearer bob", "192.0.2.1:1001")
+	assert.Equal(t, "order for Bearer alice", alice.Body.String())
+	assert.Equal(t, "order for Bearer bob", bob.Body.String())
+	assert.Empty(t, bob.Header().Get(HeaderReplayed))
+	assert.Equal(t, int32(2), calls.Load())
+
+	replay := send("Bearer alice", "198.51.100.7:2000")
+	assert.Equal(t, "true", replay.Header().Get(HeaderReplayed))
+	assert.Equal(t, "order for Bearer alice", replay.Body.String())
+	assert.Empty(t, replay.Header().Values("Set-Cookie"))
+
+	// Без учетных данных ключи разделяются по IP-адресу клиента.
+	send("", "192.0.2.1:1000")
+	send("", "192.0.2.2:1000")
+	assert.Equal(t, int32(4), calls.Load())
+	assert.Equal(t, "true", send("", "192.0.2.2:3000").Header().Get(HeaderReplayed))
+}
+
+// TestMiddleware_ServerErrorNotStored проверяет, что ответ 5xx освобождает ключ для повтора.
+func TestMiddleware_ServerErrorNotStored(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestHandler(NewMemoryStore(), http.StatusBadGateway, &calls)
+
+	doRequest(h, http.MethodPost, "k1", "item")
+	rec := doRequest(h, http.MethodPost, "k1", "item")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderReplayed))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+// TestMiddleware_HandlerPanic проверяет, что ключ резервируется на срок Lease и освобождается,
+// если обработчик завершился паникой (обрыв ответа бэкенда в ReverseProxy).
+func TestMiddleware_HandlerPanic(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	var calls atomic.Int32
+	h := Middleware(store, Config{Window: time.Hour, Lease: 10 * time.Second, MaxBodyBytes: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			assert.Len(t, store.records, 1)
+			for _, rec := range store.records {
+				assert.Equal(t, now.Add(10*time.Second), rec.expires, "Key is reserved for the lease")
+			}
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { doRequest(h, http.MethodPost, "k1", "item") })
+	assert.Empty(t, store.records, "Key is released after the panic")
+
+	rec := doRequest(h, http.MethodPost, "k1", "item")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, int32(2), calls.Load())
+	require.Len(t, store.records, 1)
+	for _, rec := range store.records {
+		assert.Equal(t, now.Add(time.Hour), rec.expires, "Stored response is kept for the window")
+	}
+}
+
+// TestMiddleware_CompressedBody проверяет, что отпечаток вычисляется по распакованному телу,
+// а бэкенд получает тело в исходной кодировке.
+func TestMiddleware_CompressedBody(t *testing.T) {
+	var calls atomic.Int32
+	var forwarded []byte
+	h := Middleware(NewMemoryStore(), Config{Window: time.Minute, MaxBodyBytes: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		forwarded, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	send := func(body []byte, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body))
+		req.Header.Set(HeaderKey, "k1")
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte("item"))
+	require.NoError(t, gz.Close())
+
+	assert.Equal(t, http.StatusCreated, send(compressed.Bytes(), "gzip").Code)
+	assert.Equal(t, compressed.Bytes(), forwarded, "Backend receives the body as sent by the client")
+	rec := send([]byte("item"), "identity")
+	assert.Equal(t, "true", rec.Header().Get(HeaderReplayed), "Same payload without compression is a retry of the same request")
+	assert.Equal(t, int32(1), calls.Load())
+
+	rec = send([]byte("not gzip"), "gzip")
+	assert.Equal(t, http.StatusCreated, rec.Code, "Undecodable body is processed without deduplication")
+	assert.Equal(t, "not gzip", string(forwarded))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+// TestMemoryStore_Expiry проверяет истечение записей по окончании окна.
+func TestMemoryStore_Expiry(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Save("k1", &Record{Completed: true, Status: http.StatusOK}, time.Minute))
+	rec, err := store.Get("k1")
+	require.NoError(t, err)
+	require.NotNil(t, rec)
+
+	now = now.Add(2 * time.Minute)
+	rec, err = store.Get("k1")
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+
+	ok, err := store.Reserve("k1", "fp", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// TestRedisStore_RESP проверяет резервирование, сохранение и удаление записей в Redis.
+func TestRedisStore_RESP(t *testing.T) {
+	srv := redistest.NewServer(t)
+	store := NewRedisStore(srv.Addr(), "", "lb:idem:", time.Second)
+	defer store.Close()
+
+	ok, err := store.Reserve("k1", "fp", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.Reserve("k1", "fp", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.Save("k1", &Record{Fingerprint: "fp", Completed: true, Status: http.StatusCreated, Body: []byte("done")}, time.Minute))
+	rec, err := store.Get("k1")
+	require.NoError(t, err)
+	require.NotNil(t, rec)
+	assert.True(t, rec.Completed)
+	assert.Equal(t, http.StatusCreated, rec.Status)
+	assert.Equal(t, "done", string(rec.Body))
+
+	require.NoError(t, store.Delete("k1"))
+	rec, err = store.Get("k1")
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+}
@@ -0,0 +1,175 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/redis"
+)
+
+// Record - состояние ключа идемпотентности: резервирование на время обработки первого
+// запроса (Completed=false) или сохраненный ответ для повторов.
+type Record struct {
+	Fingerprint string      `json:"fingerprint"` // Отпечаток запроса (метод, путь, тело).
+	Completed   bool        `json:"completed"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Store хранит записи ключей идемпотентности с ограниченным временем жизни.
+type Store interface {
+	// Get возвращает запись по ключу или nil, если запись отсутствует или истекла.
+	Get(key string) (*Record, error)
+	// Reserve атомарно создает незавершенную запись, если ключ свободен.
+	// Возвращает false, если запись с таким ключом уже существует.
+	Reserve(key, fingerprint string, ttl time.Duration) (bool, error)
+	// Save сохраняет завершенную запись на время ttl.
+	Save(key string, rec *Record, ttl time.Duration) error
+	// Delete удаляет запись (например, если ответ не подлежит повтору).
+	Delete(key string) error
+	// Close освобождает ресурсы хранилища.
+	Close() error
+}
+
+// MemoryStore - хранилище в памяти процесса. Подходит для одного экземпляра балансировщика.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	now     func() time.Time
+}
+
+type memoryRecord struct {
+	rec     *Record
+	expires time.Time
+}
+
+// NewMemoryStore создает пустое хранилище в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]memoryRecord), now: time.Now}
+}
+
+// Get реализует Store.
+func (s *MemoryStore) Get(key string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookupLocked(key), nil
+}
+
+// Reserve реализует Store. Истекшие записи удаляются при резервировании.
+func (s *MemoryStore) Reserve(key, fingerprint string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictExpiredLocked()
+	if s.lookupLocked(key) != nil {
+		return false, nil
+	}
+	s.records[key] = memoryRecord{rec: &Record{Fingerprint: fingerprint}, expires: s.now().Add(ttl)}
+	return true, nil
+}
+
+// Save реализует Store.
+func (s *MemoryStore) Save(key string, rec *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = memoryRecord{rec: rec, expires: s.now().Add(ttl)}
+	return nil
+}
+
+// Delete реализует Store.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// Close реализует Store.
+func (s *MemoryStore) Close() error { return nil }
+
+func (s *MemoryStore) lookupLocked(key string) *Record {
+	r, ok := s.records[key]
+	if !ok || !s.now().Before(r.expires) {
+		return nil
+	}
+	return r.rec
+}
+
+func (s *MemoryStore) evictExpiredLocked() {
+	now := s.now()
+	for key, r := range s.records {
+		if !now.Before(r.expires) {
+			delete(s.records, key)
+		}
+	}
+}
+
+// RedisStore - хранилище в Redis для нескольких экземпляров балансировщика. Записи хранятся
+// в JSON, резервирование выполняется командой SET ... NX PX.
+type RedisStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewRedisStore создает хранилище в Redis по адресу addr ("host:port").
+func NewRedisStore(addr, password, keyPrefix string, timeout time.Duration) *RedisStore {
+	return &RedisStore{client: redis.NewClient(addr, password, timeout), keyPrefix: keyPrefix}
+}
+
+// Get реализует Store.
+func (s *RedisStore) Get(key string) (*Record, error) {
+	reply, err := s.client.Do("GET", s.keyPrefix+key)
+	if err != nil {
+		return nil, fmt.Errorf("idempotency: %w", err)
+	}
+	if reply == nil {
+		return nil, nil
+	}
+	var rec Record
+	if err := json.Unmarshal([]byte(*reply), &rec); err != nil {
+		return nil, fmt.Errorf("idempotency: malformed record for key %q: %w", key, err)
+	}
+	return &rec, nil
+}
+
+// Reserve реализует Store.
+func (s *RedisStore) Reserve(key, fingerprint string, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(&Record{Fingerprint: fingerprint})
+	if err != nil {
+		return false, fmt.Errorf("idempotency: %w", err)
+	}
+	reply, err := s.client.Do("SET", s.keyPrefix+key, string(data), "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, fmt.Errorf("idempotency: %w", err)
+	}
+	return reply != nil, nil
+}
+
+// Save реализует Store.
+func (s *RedisStore) Save(key string, rec *Record, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("idempotency: %w", err)
+	}
+	if _, err := s.client.Do("SET", s.keyPrefix+key, string(data), "PX", strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+		return fmt.Errorf("idempotency: %w", err)
+	}
+	return nil
+}
+
+// Delete реализует Store.
+func (s *RedisStore) Delete(key string) error {
+	if _, err := s.client.Do("DEL", s.keyPrefix+key); err != nil {
+		return fmt.Errorf("idempotency: %w", err)
+	}
+	return nil
+}
+
+// Close реализует Store.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,148 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var componentUp = metrics.NewGaugeVec("lb_component_up",
+	"Whether an application component is running and healthy (1) or not (0).", "component")
+
+// Состояния компонента (см. ComponentStatus).
+const (
+	StatePending = "pending" // Зарегистрирован, еще не запущен.
+	StateRunning = "running"
+	StateFailed  = "failed" // Запуск или остановка завершились ошибкой.
+	StateStopped = "stopped"
+)
+
+// Component - компонент приложения (хранилище, rate limiter, пул бэкендов и т.п.).
+// Компоненты запускаются в порядке регистрации и останавливаются в обратном порядке, поэтому
+// компонент регистрируется после тех, от которых зависит.
+type Component struct {
+	Name string
+	// Запуск компонента (nil - компонент работает с момента создания).
+	Start func(ctx context.Context) error
+	// Остановка компонента (nil - не требуется).
+	Stop func(ctx context.Context) error
+	// Проверка состояния работающего компонента (nil - исправен, пока запущен).
+	Health func(ctx context.Context) error
+}
+
+// ComponentStatus - состояние компонента для отчета о здоровье приложения.
+type ComponentStatus struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type component struct {
+	Component
+	state string
+	err   error // Ошибка запуска или остановки.
+}
+
+// Add регистрирует компонент. Компоненты регистрируются до Start.
+func (m *Manager) Add(c Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, &component{Component: c, state: StatePending})
+	componentUp.With(c.Name).Set(0)
+}
+
+// Start запускает компоненты в порядке регистрации. Если компонент не запускается, уже
+// запущенные компоненты останавливаются в обратном порядке и возвращается ошибка.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	components := append([]*component(nil), m.components...)
+	m.mu.Unlock()
+
+	for i, c := range components {
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				m.setState(c, StateFailed, err)
+				m.stopComponents(components[:i], defaultShutdownTimeout)
+				return fmt.Errorf("component %s failed to start: %w", c.Name, err)
+			}
+		}
+		m.setState(c, StateRunning, nil)
+		log.Printf("INFO: Component %s started.", c.Name)
+	}
+	return nil
+}
+
+// stopComponents останавливает запущенные компоненты в обратном порядке, каждый не дольше
+// timeout, и возвращает ошибки остановки.
+func (m *Manager) stopComponents(components []*component, timeout time.Duration) []error {
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		m.mu.Lock()
+		running := c.state == StateRunning
+		m.mu.Unlock()
+		if !running {
+			continue
+		}
+		var err error
+		if c.Stop != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err = c.Stop(ctx)
+			cancel()
+		}
+		if err != nil {
+			m.setState(c, StateFailed, err)
+			errs = append(errs, fmt.Errorf("component %s failed to stop: %w", c.Name, err))
+			continue
+		}
+		m.setState(c, StateStopped, nil)
+		log.Printf("INFO: Component %s stopped.", c.Name)
+	}
+	return errs
+}
+
+func (m *Manager) setState(c *component, state string, err error) {
+	m.mu.Lock()
+	c.state, c.err = state, err
+	m.mu.Unlock()
+	if state != StateRunning {
+		componentUp.With(c.Name).Set(0)
+	} else if c.Health == nil {
+		componentUp.With(c.Name).Set(1)
+	}
+}
+
+// Health возвращает состояние компонентов в порядке регистрации, выполняя проверки
+// работающих компонентов. Второе значение - все ли компоненты запущены и исправны.
+func (m *Manager) Health(ctx context.Context) ([]ComponentStatus, bool) {
+	m.mu.Lock()
+	components := append([]*component(nil), m.components...)
+	m.mu.Unlock()
+
+	statuses := make([]ComponentStatus, 0, len(components))
+	allHealthy := true
+	for _, c := range components {
+		m.mu.Lock()
+		state, err := c.state, c.err
+		m.mu.Unlock()
+		if state == StateRunning && c.Health != nil {
+			err = c.Health(ctx)
+			if err != nil {
+				componentUp.With(c.Name).Set(0)
+			} else {
+				componentUp.With(c.Name).Set(1)
+			}
+		}
+		status := ComponentStatus{Name: c.Name, State: state, Healthy: state == StateRunning && err == nil}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		allHealthy = allHealthy && status.Healthy
+		statuses = append(statuses, status)
+	}
+	return statuses, allHealthy
+}
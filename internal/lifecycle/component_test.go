@@ -0,0 +1,75 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManager_ComponentOrder проверяет запуск компонентов в порядке регистрации и остановку
+// в обратном порядке после фоновых задач.
+func TestManager_ComponentOrder(t *testing.T) {
+	var events []string
+	m := New()
+	for _, name := range []string{"store", "limiter", "pool"} {
+		m.Add(Component{
+			Name:  name,
+			Start: func(context.Context) error { events = append(events, "start "+name); return nil },
+			Stop:  func(context.Context) error { events = append(events, "stop "+name); return nil },
+		})
+	}
+	taskDone := make(chan struct{})
+	m.Go("task", func(ctx context.Context) {
+		<-ctx.Done()
+		close(taskDone)
+	})
+
+	require.NoError(t, m.Start(context.Background()))
+	require.NoError(t, m.Shutdown(time.Second))
+	<-taskDone
+	assert.Equal(t, []string{"start store", "start limiter", "start pool", "stop pool", "stop limiter", "stop store"}, events)
+}
+
+// TestManager_ComponentStartFailure проверяет остановку запущенных компонентов при отказе.
+func TestManager_ComponentStartFailure(t *testing.T) {
+	var stopped []string
+	m := New()
+	m.Add(Component{Name: "store", Stop: func(context.Context) error { stopped = append(stopped, "store"); return nil }})
+	m.Add(Component{Name: "limiter", Start: func(context.Context) error { return errors.New("boom") }})
+	m.Add(Component{Name: "pool", Stop: func(context.Context) error { stopped = append(stopped, "pool"); return nil }})
+
+	assert.ErrorContains(t, m.Start(context.Background()), "component limiter failed to start: boom")
+	assert.Equal(t, []string{"store"}, stopped, "Only started components are stopped")
+
+	statuses, healthy := m.Health(context.Background())
+	assert.False(t, healthy)
+	assert.Equal(t, []ComponentStatus{
+		{Name: "store", State: StateStopped},
+		{Name: "limiter", State: StateFailed, Error: "boom"},
+		{Name: "pool", State: StatePending},
+	}, statuses)
+}
+
+// TestManager_Health проверяет отчет о состоянии работающих компонентов.
+func TestManager_Health(t *testing.T) {
+	var poolErr error
+	m := New()
+	m.Add(Component{Name: "store"})
+	m.Add(Component{Name: "pool", Health: func(context.Context) error { return poolErr }})
+
+	_, healthy := m.Health(context.Background())
+	assert.False(t, healthy, "Components are not healthy before start")
+
+	require.NoError(t, m.Start(context.Background()))
+	_, healthy = m.Health(context.Background())
+	assert.True(t, healthy)
+
+	poolErr = errors.New("no healthy backends")
+	statuses, healthy := m.Health(context.Background())
+	assert.False(t, healthy)
+	assert.Equal(t, ComponentStatus{Name: "pool", State: StateRunning, Error: "no healthy backends"}, statuses[1])
+}
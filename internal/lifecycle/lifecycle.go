@@ -0,0 +1,187 @@
+// Пакет lifecycle управляет запуском и остановкой компонентов, HTTP-серверов и фоновых задач
+// балансировщика: компоненты запускаются в порядке зависимостей, каждый сервер
+// останавливается независимо со своим таймаутом в заданном порядке, затем фоновые задачи и
+// компоненты в обратном порядке.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Server - HTTP-сервер на слушающем сокете.
+type Server struct {
+	Name     string
+	Server   *http.Server
+	Listener net.Listener
+	// Вызывается перед началом обслуживания (например, ожидание готовности пула); ctx
+	// отменяется при остановке. До возврата соединения ожидают в очереди сокета.
+	BeforeServe func(ctx context.Context)
+	// Порядок остановки: серверы с меньшим значением останавливаются раньше, с одинаковым -
+	// одновременно.
+	ShutdownOrder int
+	// Время на завершение активных запросов при остановке (0 - 5s).
+	ShutdownTimeout time.Duration
+}
+
+// defaultShutdownTimeout - время на завершение активных запросов, если оно не задано.
+const defaultShutdownTimeout = 5 * time.Second
+
+type task struct {
+	name string
+	done chan struct{}
+}
+
+// Manager запускает серверы и фоновые задачи и координирует их остановку.
+type Manager struct {
+	mu         sync.Mutex
+	servers    []Server
+	tasks      []task
+	components []*component
+	ctx        context.Context // Отменяется при остановке фоновых задач.
+	cancel     context.CancelFunc
+	// Контекст ожидания перед обслуживанием (см. Server.BeforeServe).
+	serveCtx    context.Context
+	cancelServe context.CancelFunc
+	errs        chan error // Ошибки обслуживания серверов.
+}
+
+// New создает Manager.
+func New() *Manager {
+	m := &Manager{errs: make(chan error, 16)}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.serveCtx, m.cancelServe = context.WithCancel(context.Background())
+	return m
+}
+
+// Go запускает фоновую задачу fn. Контекст задачи отменяется при остановке (см. Shutdown)
+// после остановки всех серверов; Shutdown ожидает завершения fn.
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	t := task{name: name, done: make(chan struct{})}
+	m.mu.Lock()
+	m.tasks = append(m.tasks, t)
+	m.mu.Unlock()
+	go func() {
+		defer close(t.done)
+		fn(m.ctx)
+	}()
+}
+
+// Serve запускает обслуживание сервера s. Ошибка обслуживания (кроме штатной остановки)
+// возвращается из Wait.
+func (m *Manager) Serve(s Server) {
+	if s.ShutdownTimeout <= 0 {
+		s.ShutdownTimeout = defaultShutdownTimeout
+	}
+	m.mu.Lock()
+	m.servers = append(m.servers, s)
+	m.mu.Unlock()
+
+	go func() {
+		if s.BeforeServe != nil {
+			s.BeforeServe(m.serveCtx)
+		}
+		log.Printf("INFO: Starting %s server on %s", s.Name, s.Listener.Addr())
+		if err := s.Server.Serve(s.Listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.errs <- fmt.Errorf("%s server on %s: %w", s.Name, s.Listener.Addr(), err)
+		}
+	}()
+}
+
+// Wait блокируется до получения сигнала из signals или ошибки обслуживания одного из
+// серверов. Возвращает эту ошибку (nil - получен сигнал).
+func (m *Manager) Wait(signals <-chan os.Signal) error {
+	select {
+	case sig := <-signals:
+		log.Printf("INFO: Received %v. Starting graceful shutdown...", sig)
+		return nil
+	case err := <-m.errs:
+		log.Printf("ERROR: %v. Shutting down.", err)
+		return err
+	}
+}
+
+// Shutdown останавливает серверы в порядке ShutdownOrder: каждый сервер перестает принимать
+// соединения и ожидает завершения активных запросов не дольше своего ShutdownTimeout, после
+// чего оставшиеся соединения закрываются. Затем отменяются фоновые задачи, завершения которых
+// Shutdown ожидает не дольше timeout, и останавливаются компоненты в порядке, обратном
+// запуску (каждый не дольше timeout). Возвращает ошибки серверов, не успевших завершить
+// запросы, имена незавершившихся задач и ошибки остановки компонентов.
+func (m *Manager) Shutdown(timeout time.Duration) error {
+	m.cancelServe()
+	m.mu.Lock()
+	servers := slices.Clone(m.servers)
+	tasks := slices.Clone(m.tasks)
+	components := slices.Clone(m.components)
+	m.mu.Unlock()
+
+	slices.SortStableFunc(servers, func(a, b Server) int { return a.ShutdownOrder - b.ShutdownOrder })
+	var (
+		errsMu sync.Mutex
+		errs   []error
+	)
+	for len(servers) > 0 {
+		n := 1
+		for n < len(servers) && servers[n].ShutdownOrder == servers[0].ShutdownOrder {
+			n++
+		}
+		var wg sync.WaitGroup
+		for _, s := range servers[:n] {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := shutdownServer(s); err != nil {
+					errsMu.Lock()
+					errs = append(errs, err)
+					errsMu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		servers = servers[n:]
+	}
+
+	m.cancel()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	expired := false
+	for _, t := range tasks {
+		if !expired {
+			select {
+			case <-t.done:
+				continue
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		// После истечения таймаута задачи проверяются без ожидания.
+		select {
+		case <-t.done:
+		default:
+			errs = append(errs, fmt.Errorf("background task %s did not stop within %v", t.name, timeout))
+		}
+	}
+	errs = append(errs, m.stopComponents(components, timeout)...)
+	return errors.Join(errs...)
+}
+
+// shutdownServer останавливает сервер s с его таймаутом.
+func shutdownServer(s Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	log.Printf("INFO: Shutting down %s server (timeout %v)...", s.Name, s.ShutdownTimeout)
+	if err := s.Server.Shutdown(ctx); err != nil {
+		_ = s.Server.Close()
+		return fmt.Errorf("%s server forced to shut down: %w", s.Name, err)
+	}
+	log.Printf("INFO: %s server stopped.", s.Name)
+	return nil
+}
@@ -0,0 +1,78 @@
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T, name string, order int, handler http.Handler) Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return Server{Name: name, Server: &http.Server{Handler: handler}, Listener: ln, ShutdownOrder: order, ShutdownTimeout: 2 * time.Second}
+}
+
+// TestManager_ShutdownOrder проверяет, что сервер с большим ShutdownOrder обслуживает
+// запросы, пока предыдущий завершает активные, а фоновые задачи отменяются последними.
+func TestManager_ShutdownOrder(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	traffic := newServer(t, "traffic", 0, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	admin := newServer(t, "admin", 1, http.NotFoundHandler())
+
+	m := New()
+	taskStopped := make(chan struct{})
+	m.Go("task", func(ctx context.Context) {
+		<-ctx.Done()
+		close(taskStopped)
+	})
+	m.Serve(admin)
+	m.Serve(traffic)
+
+	go func() { _, _ = http.Get("http://" + traffic.Listener.Addr().String()) }()
+	<-started
+
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- m.Shutdown(time.Second) }()
+
+	// Пока основной сервер завершает запрос, адрес Admin API доступен, а задачи работают.
+	time.Sleep(50 * time.Millisecond)
+	resp, err := http.Get("http://" + admin.Listener.Addr().String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	select {
+	case <-taskStopped:
+		t.Fatal("Task was cancelled before servers stopped")
+	default:
+	}
+
+	close(release)
+	require.NoError(t, <-shutdownDone)
+	<-taskStopped
+	_, err = http.Get("http://" + admin.Listener.Addr().String())
+	assert.Error(t, err, "Admin server is stopped after traffic server")
+}
+
+// TestManager_ServeError проверяет, что Wait возвращает ошибку обслуживания, а Shutdown
+// сообщает о незавершившейся задаче.
+func TestManager_ServeError(t *testing.T) {
+	m := New()
+	s := newServer(t, "traffic", 0, http.NotFoundHandler())
+	s.Listener.Close() // Serve завершается с ошибкой закрытого сокета.
+	m.Serve(s)
+	assert.ErrorContains(t, m.Wait(make(chan os.Signal)), "traffic server")
+
+	block := make(chan struct{})
+	defer close(block)
+	m.Go("stuck", func(context.Context) { <-block })
+	assert.ErrorContains(t, m.Shutdown(50*time.Millisecond), "background task stuck")
+}
@@ -0,0 +1,88 @@
+// Пакет listener создает слушающие сокеты балансировщика: TCP (с явным выбором IPv4/IPv6)
+// и Unix domain socket (для развертывания sidecar за другим прокси).
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Сети, поддерживаемые Listen.
+const (
+	NetworkTCP  = "tcp"  // IPv4 и IPv6 (dual-stack, если поддерживается системой).
+	NetworkTCP4 = "tcp4" // Только IPv4.
+	NetworkTCP6 = "tcp6" // Только IPv6.
+	NetworkUnix = "unix"
+)
+
+// unixPrefix - префикс адреса Unix-сокета: unix:/run/lb.sock или unix:///run/lb.sock.
+const unixPrefix = "unix:"
+
+// ParseAddr определяет сеть и адрес для прослушивания. Адрес с префиксом "unix:" задает
+// путь к Unix-сокету; для остальных адресов используется network (tcp, tcp4 или tcp6,
+// по умолчанию tcp).
+func ParseAddr(addr, network string) (string, string, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		path = strings.TrimPrefix(path, "//")
+		if path == "" {
+			return "", "", fmt.Errorf("missing unix socket path in %q", addr)
+		}
+		return NetworkUnix, path, nil
+	}
+	switch network {
+	case "":
+		return NetworkTCP, addr, nil
+	case NetworkTCP, NetworkTCP4, NetworkTCP6:
+		return network, addr, nil
+	default:
+		return "", "", fmt.Errorf("unknown listen network %q (expected %s, %s or %s)", network, NetworkTCP, NetworkTCP4, NetworkTCP6)
+	}
+}
+
+// Listen начинает прослушивание адреса addr (см. ParseAddr). Для Unix-сокета оставшийся
+// от предыдущего запуска файл сокета удаляется, если его никто не слушает, а созданному
+// сокету выставляются права socketMode.
+func Listen(addr, network string, socketMode os.FileMode) (net.Listener, error) {
+	network, address, err := ParseAddr(addr, network)
+	if err != nil {
+		return nil, err
+	}
+	if network != NetworkUnix {
+		return net.Listen(network, address)
+	}
+
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen(NetworkUnix, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", address, err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket удаляет файл сокета path, если он не используется другим процессом.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial(NetworkUnix, path); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
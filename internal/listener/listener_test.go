@@ -0,0 +1,72 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseAddr проверяет выбор сети по адресу и параметру network.
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr, network            string
+		wantNetwork, wantAddress string
+		wantErr                  bool
+	}{
+		{addr: ":8080", wantNetwork: "tcp", wantAddress: ":8080"},
+		{addr: "0.0.0.0:8080", network: "tcp4", wantNetwork: "tcp4", wantAddress: "0.0.0.0:8080"},
+		{addr: "[::]:8080", network: "tcp6", wantNetwork: "tcp6", wantAddress: "[::]:8080"},
+		{addr: "unix:/run/lb.sock", network: "tcp4", wantNetwork: "unix", wantAddress: "/run/lb.sock"},
+		{addr: "unix:///run/lb.sock", wantNetwork: "unix", wantAddress: "/run/lb.sock"},
+		{addr: "unix:", wantErr: true},
+		{addr: ":8080", network: "udp", wantErr: true},
+	}
+	for _, tt := range tests {
+		network, address, err := ParseAddr(tt.addr, tt.network)
+		if tt.wantErr {
+			assert.Error(t, err, tt.addr)
+			continue
+		}
+		require.NoError(t, err, tt.addr)
+		assert.Equal(t, tt.wantNetwork, network, tt.addr)
+		assert.Equal(t, tt.wantAddress, address, tt.addr)
+	}
+}
+
+// TestListen_Unix проверяет создание Unix-сокета с заданными правами и удаление
+// оставшегося от предыдущего запуска файла сокета.
+func TestListen_Unix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lb.sock")
+
+	ln, err := Listen("unix:"+path, "", 0o660)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), info.Mode().Perm())
+
+	_, err = Listen("unix:"+path, "", 0o660)
+	assert.Error(t, err, "Socket in use must not be replaced")
+
+	// Закрытие без удаления файла имитирует аварийное завершение.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, ln.Close())
+	ln, err = Listen("unix:"+path, "", 0o660)
+	require.NoError(t, err, "Stale socket file is removed")
+	require.NoError(t, ln.Close())
+
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	_, err = Listen("unix:"+path, "", 0o660)
+	assert.Error(t, err, "Regular file must not be removed")
+}
+
+// TestListen_TCP4 проверяет прослушивание только IPv4.
+func TestListen_TCP4(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0", NetworkTCP4, 0)
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.Equal(t, "tcp", ln.Addr().Network())
+}
@@ -0,0 +1,241 @@
+// Package loadshed реализует адаптивный сброс нагрузки: при превышении порогов давления
+// на ресурсы балансировщика (число горутин, объем памяти, время ожидания запросов в очереди)
+// часть запросов отклоняется с кодом 503, чтобы сохранить приемлемую задержку для остальных.
+package loadshed
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+	"cloud/load_balancer/internal/priority"
+)
+
+// latencySmoothing - вес нового замера в скользящем среднем задержки (EWMA).
+const latencySmoothing = 0.1
+
+var (
+	shedRatioGauge = metrics.NewGaugeVec("lb_load_shed_ratio",
+		"Fraction of requests currently being shed (0..1).")
+	shedRequestsTotal = metrics.NewCounterVec("lb_load_shed_requests_total",
+		"Requests rejected by adaptive load shedding, by priority class.", "class")
+	pressureGauge = metrics.NewGaugeVec("lb_load_shed_pressure",
+		"Resource pressure relative to the configured threshold (1 = at threshold), by resource.", "resource")
+)
+
+// Config содержит параметры сброса нагрузки. Нулевой порог означает, что ресурс не учитывается.
+type Config struct {
+	MaxGoroutines  int           // Порог числа горутин.
+	MaxHeapBytes   uint64        // Порог объема памяти кучи.
+	MaxLatency     time.Duration // Порог среднего времени ожидания запроса в очереди балансировщика.
+	CheckInterval  time.Duration // Как часто оценивать давление.
+	Step           float64       // На сколько меняется доля сбрасываемых запросов за интервал (0..1).
+	MaxShedPercent float64       // Максимальная доля сбрасываемых запросов в процентах.
+}
+
+// Pressure - замер давления на ресурсы.
+type Pressure struct {
+	Goroutines int
+	HeapBytes  uint64
+	Latency    time.Duration
+}
+
+// Shedder периодически оценивает давление на ресурсы и управляет долей сбрасываемых запросов.
+// Доля растет на Step за каждый интервал с превышением порогов и уменьшается на Step,
+// когда давление спадает.
+type Shedder struct {
+	cfg       Config
+	ratio     atomic.Uint64 // Доля сбрасываемых запросов (float64 в битах).
+	latencyNs atomic.Int64  // Скользящее среднее времени ожидания в очереди.
+	samples   atomic.Int64  // Число замеров ожидания с последней оценки.
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewShedder создает Shedder. Возвращает ошибку, если не задан ни один порог.
+// Для запуска фоновой оценки нужно вызвать Start.
+func NewShedder(cfg Config) (*Shedder, error) {
+	if cfg.MaxGoroutines <= 0 && cfg.MaxHeapBytes == 0 && cfg.MaxLatency <= 0 {
+		return nil, fmt.Errorf("loadshed: at least one threshold must be set")
+	}
+	if cfg.MaxShedPercent <= 0 || cfg.MaxShedPercent > 100 {
+		return nil, fmt.Errorf("loadshed: max_shed_percent must be in (0, 100]")
+	}
+	if cfg.Step <= 0 || cfg.Step > 1 {
+		cfg.Step = 0.1
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Second
+	}
+	return &Shedder{cfg: cfg, stopChan: make(chan struct{})}, nil
+}
+
+// Start запускает фоновую оценку давления.
+func (s *Shedder) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop останавливает фоновую оценку и ожидает ее завершения.
+func (s *Shedder) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// Ratio возвращает текущую долю сбрасываемых запросов (0..1).
+func (s *Shedder) Ratio() float64 {
+	return math.Float64frombits(s.ratio.Load())
+}
+
+func (s *Shedder) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	log.Printf("INFO: Load shedder started (interval: %v, max goroutines: %d, max heap: %d bytes, max latency: %v)",
+		s.cfg.CheckInterval, s.cfg.MaxGoroutines, s.cfg.MaxHeapBytes, s.cfg.MaxLatency)
+	for {
+		select {
+		case <-ticker.C:
+			s.evaluate(s.measure())
+			s.decayLatency()
+		case <-s.stopChan:
+			log.Println("INFO: Load shedder stopping.")
+			return
+		}
+	}
+}
+
+// measure снимает текущие показатели процесса.
+func (s *Shedder) measure() Pressure {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return Pressure{
+		Goroutines: runtime.NumGoroutine(),
+		HeapBytes:  mem.HeapAlloc,
+		Latency:    time.Duration(s.latencyNs.Load()),
+	}
+}
+
+// evaluate пересчитывает долю сбрасываемых запросов по замеру давления.
+func (s *Shedder) evaluate(p Pressure) {
+	overloaded := false
+	check := func(resource string, value, threshold float64) {
+		if threshold <= 0 {
+			return
+		}
+		pressure := value / threshold
+		pressureGauge.With(resource).Set(pressure)
+		if pressure > 1 {
+			overloaded = true
+		}
+	}
+	check("goroutines", float64(p.Goroutines), float64(s.cfg.MaxGoroutines))
+	check("heap", float64(p.HeapBytes), float64(s.cfg.MaxHeapBytes))
+	check("latency", float64(p.Latency), float64(s.cfg.MaxLatency))
+
+	old := s.Ratio()
+	ratio := old
+	if overloaded {
+		ratio = min(old+s.cfg.Step, s.cfg.MaxShedPercent/100)
+	} else {
+		ratio = max(old-s.cfg.Step, 0)
+	}
+	if ratio == old {
+		return
+	}
+	s.ratio.Store(math.Float64bits(ratio))
+	shedRatioGauge.With().Set(ratio)
+	switch {
+	case old == 0:
+		log.Printf("WARN: Load shedding started: shedding %.0f%% of requests (goroutines: %d, heap: %d bytes, latency: %v)",
+			ratio*100, p.Goroutines, p.HeapBytes, p.Latency)
+	case ratio == 0:
+		log.Println("INFO: Load shedding stopped: resource pressure is back to normal.")
+	}
+}
+
+// shouldShed решает, отклонить ли очередной запрос.
+// Если запрос классифицирован по приоритету (см. пакет priority), доля сброса распределяется
+// по классам снизу вверх: сначала отклоняются запросы класса low (до 100% при доле 0.5),
+// затем normal; запросы класса high не отклоняются. Без классификации каждый запрос
+// отклоняется с вероятностью, равной доле сброса.
+func (s *Shedder) shouldShed(r *http.Request) bool {
+	ratio := s.Ratio()
+	if ratio <= 0 {
+		return false
+	}
+	if class, ok := priority.FromContext(r.Context()); ok {
+		ratio = classShedRatio(ratio, class)
+	}
+	return ratio > 0 && rand.Float64() < ratio
+}
+
+// classShedRatio возвращает вероятность сброса запроса класса class при общей доле ratio.
+func classShedRatio(ratio float64, class priority.Class) float64 {
+	if class >= priority.High {
+		return 0
+	}
+	// Доля 0..1 разворачивается в уровень 0..2: первая половина приходится на low, вторая - на normal.
+	level := ratio*float64(priority.High) - float64(class)
+	return min(max(level, 0), 1)
+}
+
+// Middleware отклоняет часть запросов с кодом 503 при перегрузке.
+func (s *Shedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.shouldShed(r) {
+			shedRequestsTotal.With(requestClass(r)).Inc()
+			w.Header().Set("Retry-After", "1")
+			httputil_pkg.RespondWithError(w, http.StatusServiceUnavailable, "Service overloaded, please retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestClass возвращает имя класса приоритета запроса для метрик ("none" - не классифицирован).
+func requestClass(r *http.Request) string {
+	if class, ok := priority.FromContext(r.Context()); ok {
+		return class.String()
+	}
+	return "none"
+}
+
+// ObserveQueueWait учитывает время ожидания запроса в очереди балансировщика (см.
+// concurrency.Config.ObserveWait). Время ответа бэкенда в замер не входит: медленный
+// бэкенд не должен приводить к сбросу запросов ко всем бэкендам.
+func (s *Shedder) ObserveQueueWait(d time.Duration) {
+	s.observeLatency(d)
+	s.samples.Add(1)
+}
+
+// decayLatency снижает скользящее среднее, если за интервал не было замеров: без допущенных
+// запросов среднее иначе сохранило бы последнее высокое значение, и сброс не прекратился бы.
+func (s *Shedder) decayLatency() {
+	if s.samples.Swap(0) == 0 {
+		s.observeLatency(0)
+	}
+}
+
+// observeLatency обновляет скользящее среднее времени ожидания.
+func (s *Shedder) observeLatency(d time.Duration) {
+	for {
+		old := s.latencyNs.Load()
+		updated := int64(d)
+		if old > 0 {
+			updated = int64(float64(old)*(1-latencySmoothing) + float64(d)*latencySmoothing)
+		}
+		if s.latencyNs.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
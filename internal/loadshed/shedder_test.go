@@ -0,0 +1,92 @@
+package loadshed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud/load_balancer/internal/priority"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShedder_RatioFollowsPressure проверяет рост доли сброса при превышении порога,
+// ограничение MaxShedPercent и снижение после спада давления.
+func TestShedder_RatioFollowsPressure(t *testing.T) {
+	s, err := NewShedder(Config{MaxGoroutines: 100, Step: 0.25, MaxShedPercent: 60})
+	require.NoError(t, err)
+
+	overloaded := Pressure{Goroutines: 150}
+	s.evaluate(overloaded)
+	assert.InDelta(t, 0.25, s.Ratio(), 1e-9)
+	s.evaluate(overloaded)
+	s.evaluate(overloaded)
+	assert.InDelta(t, 0.6, s.Ratio(), 1e-9, "ratio must be capped by MaxShedPercent")
+
+	normal := Pressure{Goroutines: 50}
+	s.evaluate(normal)
+	assert.InDelta(t, 0.35, s.Ratio(), 1e-9)
+	s.evaluate(normal)
+	s.evaluate(normal)
+	assert.Zero(t, s.Ratio())
+}
+
+// TestShedder_Middleware проверяет отклонение запросов с 503 при полном сбросе
+// и пропуск запросов без давления.
+func TestShedder_Middleware(t *testing.T) {
+	s, err := NewShedder(Config{MaxLatency: 100 * time.Millisecond, Step: 1, MaxShedPercent: 100})
+	require.NoError(t, err)
+	handler := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	s.evaluate(Pressure{Latency: time.Second})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+}
+
+// TestShedder_LatencyDecay проверяет, что среднее время ожидания снижается за интервалы
+// без замеров и сброс прекращается без новых запросов.
+func TestShedder_LatencyDecay(t *testing.T) {
+	s, err := NewShedder(Config{MaxLatency: 100 * time.Millisecond, Step: 1, MaxShedPercent: 100})
+	require.NoError(t, err)
+
+	s.ObserveQueueWait(time.Second)
+	s.evaluate(s.measure())
+	require.Equal(t, 1.0, s.Ratio())
+	s.decayLatency()
+	assert.Equal(t, time.Second, s.measure().Latency, "Interval with samples is not decayed")
+
+	for range 100 {
+		s.decayLatency()
+		s.evaluate(s.measure())
+		if s.Ratio() == 0 {
+			break
+		}
+	}
+	assert.Zero(t, s.Ratio(), "Shedding stops without admitted requests")
+	assert.Less(t, s.measure().Latency, 100*time.Millisecond)
+}
+
+// TestNewShedder_RequiresThreshold проверяет, что без порогов Shedder не создается.
+func TestNewShedder_RequiresThreshold(t *testing.T) {
+	_, err := NewShedder(Config{MaxShedPercent: 50})
+	assert.Error(t, err)
+}
+
+// TestClassShedRatio проверяет распределение доли сброса по классам приоритета.
+func TestClassShedRatio(t *testing.T) {
+	assert.InDelta(t, 0.6, classShedRatio(0.3, priority.Low), 1e-9)
+	assert.Zero(t, classShedRatio(0.3, priority.Normal))
+	assert.InDelta(t, 1, classShedRatio(0.8, priority.Low), 1e-9)
+	assert.InDelta(t, 0.6, classShedRatio(0.8, priority.Normal), 1e-9)
+	assert.Zero(t, classShedRatio(1, priority.High))
+}
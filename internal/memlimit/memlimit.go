@@ -0,0 +1,147 @@
+// Package memlimit применяет настройки памяти и сборщика мусора из конфигурации (аналоги
+// GOMEMLIMIT и GOGC) и публикует метрики потребления памяти.
+package memlimit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+
+	lbmetrics "cloud/load_balancer/internal/metrics"
+)
+
+// Settings - настройки памяти процесса.
+type Settings struct {
+	// Мягкий лимит памяти: размер ("512MiB", "1GiB", "268435456") или доля лимита памяти
+	// контейнера (cgroup), например "90%". Пусто - не изменяется (действует GOMEMLIMIT).
+	MemoryLimit string
+	// Целевой прирост кучи между сборками мусора в процентах (-1 - сборка только по лимиту
+	// памяти). nil - не изменяется (действует GOGC).
+	GCPercent *int
+}
+
+// cgroupLimitFiles - файлы с лимитом памяти контейнера (cgroup v2 и v1).
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// errNoCgroupLimit - лимит памяти контейнера не задан или недоступен.
+var errNoCgroupLimit = errors.New("container memory limit is not set")
+
+// cgroupMemoryLimit возвращает лимит памяти контейнера (подменяется в тестах).
+var cgroupMemoryLimit = func() (int64, error) {
+	for _, path := range cgroupLimitFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		raw := strings.TrimSpace(string(data))
+		if raw == "max" {
+			return 0, errNoCgroupLimit
+		}
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		// cgroup v1 без лимита сообщает значение, близкое к MaxInt64.
+		if err != nil || limit <= 0 || limit >= math.MaxInt64/2 {
+			return 0, errNoCgroupLimit
+		}
+		return limit, nil
+	}
+	return 0, errNoCgroupLimit
+}
+
+// sizeUnits - суффиксы размеров в формате GOMEMLIMIT.
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1},
+}
+
+// ParseLimit разбирает мягкий лимит памяти (см. Settings.MemoryLimit) в байтах.
+func ParseLimit(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid memory limit %q: percent must be in (0, 100]", s)
+		}
+		limit, err := cgroupMemoryLimit()
+		if err != nil {
+			return 0, fmt.Errorf("invalid memory limit %q: %w", s, err)
+		}
+		return int64(float64(limit) * p / 100), nil
+	}
+	factor := int64(1)
+	for _, u := range sizeUnits {
+		if number, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, factor = number, u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 || n*float64(factor) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid memory limit %q (expected e.g. 512MiB, 2GiB or 90%%)", s)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// Apply применяет настройки памяти и сборщика мусора. Возвращает ошибку, если лимит задан
+// некорректно; в этом случае настройки не изменяются.
+func Apply(s Settings) error {
+	var limit int64
+	if s.MemoryLimit != "" {
+		var err error
+		if limit, err = ParseLimit(s.MemoryLimit); err != nil {
+			return err
+		}
+	}
+	if s.GCPercent != nil && *s.GCPercent < -1 {
+		return fmt.Errorf("invalid gc_percent %d (expected -1 or a non-negative value)", *s.GCPercent)
+	}
+	if limit > 0 {
+		debug.SetMemoryLimit(limit)
+		log.Printf("INFO: Soft memory limit set to %d MiB (%s).", limit>>20, s.MemoryLimit)
+	}
+	if s.GCPercent != nil {
+		debug.SetGCPercent(*s.GCPercent)
+		if *s.GCPercent < 0 {
+			log.Println("INFO: Garbage collection is driven by the memory limit only (gc_percent: -1).")
+		} else {
+			log.Printf("INFO: GC target percentage set to %d.", *s.GCPercent)
+		}
+	}
+	if s.GCPercent != nil && *s.GCPercent < 0 && debug.SetMemoryLimit(-1) == math.MaxInt64 {
+		log.Println("WARN: gc_percent is -1 without a memory limit. The heap will grow without bounds.")
+	}
+	return nil
+}
+
+// readRuntime возвращает значение метрики runtime name.
+func readRuntime(name string) float64 {
+	sample := []metrics.Sample{{Name: name}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return math.NaN()
+	}
+	return float64(sample[0].Value.Uint64())
+}
+
+// Метрики памяти читаются из runtime/metrics при выдаче /metrics.
+var (
+	memoryUsedBytes = lbmetrics.NewGaugeFunc("lb_memory_used_bytes",
+		"Memory mapped by the Go runtime and not released to the OS (what the soft memory limit constrains).",
+		func() float64 {
+			return readRuntime("/memory/classes/total:bytes") - readRuntime("/memory/classes/heap/released:bytes")
+		})
+	memoryHeapObjectsBytes = lbmetrics.NewGaugeFunc("lb_memory_heap_objects_bytes", "Memory occupied by live and not yet collected heap objects.",
+		func() float64 { return readRuntime("/memory/classes/heap/objects:bytes") })
+	memoryLimitBytes = lbmetrics.NewGaugeFunc("lb_memory_limit_bytes", "Current soft memory limit of the Go runtime.",
+		func() float64 { return readRuntime("/gc/gomemlimit:bytes") })
+)
@@ -0,0 +1,57 @@
+package memlimit
+
+import (
+	"bytes"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	lbmetrics "cloud/load_balancer/internal/metrics"
+)
+
+func TestParseLimit(t *testing.T) {
+	defer func(orig func() (int64, error)) { cgroupMemoryLimit = orig }(cgroupMemoryLimit)
+	cgroupMemoryLimit = func() (int64, error) { return 1 << 30, nil }
+
+	for s, want := range map[string]int64{
+		"268435456": 256 << 20,
+		"512MiB":    512 << 20,
+		"1.5GiB":    3 << 29,
+		"64KiB":     64 << 10,
+		"90%":       966367641,
+	} {
+		got, err := ParseLimit(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "512MB", "-1GiB", "0", "150%", "abc"} {
+		_, err := ParseLimit(s)
+		assert.Error(t, err, s)
+	}
+
+	cgroupMemoryLimit = func() (int64, error) { return 0, errNoCgroupLimit }
+	_, err := ParseLimit("90%")
+	assert.ErrorContains(t, err, "container memory limit is not set")
+}
+
+func TestApply(t *testing.T) {
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	gc := 50
+	require.NoError(t, Apply(Settings{MemoryLimit: "256MiB", GCPercent: &gc}))
+	assert.Equal(t, int64(256<<20), debug.SetMemoryLimit(-1))
+	assert.Equal(t, 50, debug.SetGCPercent(50))
+
+	var buf bytes.Buffer
+	lbmetrics.Default.WriteText(&buf)
+	assert.Contains(t, buf.String(), "lb_memory_limit_bytes 2.68435456e+08\n")
+	assert.Contains(t, buf.String(), "lb_memory_used_bytes ")
+
+	bad := -5
+	assert.Error(t, Apply(Settings{GCPercent: &bad}))
+	assert.Error(t, Apply(Settings{MemoryLimit: "lots"}))
+	assert.Equal(t, int64(256<<20), debug.SetMemoryLimit(-1), "Invalid settings are not applied")
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultLatencyBuckets - границы бакетов (в секундах) для гистограмм задержек.
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogramVec хранит гистограммы по наборам значений меток.
+type histogramVec struct {
+	metricName string
+	help       string
+	buckets    []float64
+	labelNames []string
+	mu         sync.RWMutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []atomic.Uint64 // Наблюдения по бакетам (не накопительно); последний - +Inf.
+	count       atomic.Uint64
+	sum         value
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames []string) *histogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &histogramVec{
+		metricName: name,
+		help:       help,
+		buckets:    sorted,
+		labelNames: labelNames,
+		series:     make(map[string]*histogramSeries),
+	}
+}
+
+func (h *histogramVec) name() string { return h.metricName }
+
+func (h *histogramVec) get(labelValues []string) *histogramSeries {
+	if len(labelValues) != len(h.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.metricName, len(h.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.RLock()
+	s, ok := h.series[key]
+	h.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok = h.series[key]; !ok {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]atomic.Uint64, len(h.buckets)+1),
+		}
+		h.series[key] = s
+	}
+	return s
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.metricName, h.help, h.metricName)
+	bucketLabels := append(append([]string(nil), h.labelNames...), "le")
+	for _, k := range keys {
+		s := h.series[k]
+		var cumulative uint64
+		for i := range s.counts {
+			cumulative += s.counts[i].Load()
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			values := append(append([]string(nil), s.labelValues...), formatValue(le))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(bucketLabels, values), cumulative)
+		}
+		labels := formatLabels(h.labelNames, s.labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labels, formatValue(s.sum.load()))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labels, s.count.Load())
+	}
+}
+
+// Histogram распределяет наблюдения по бакетам.
+type Histogram struct {
+	s       *histogramSeries
+	buckets []float64
+}
+
+// Observe учитывает наблюдение v.
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v) // Первый бакет с границей >= v.
+	h.s.counts[i].Add(1)
+	h.s.count.Add(1)
+	h.s.sum.add(v)
+}
+
+// HistogramVec - семейство гистограмм с метками.
+type HistogramVec struct{ h *histogramVec }
+
+// NewHistogramVec создает семейство гистограмм с заданными верхними границами бакетов
+// и регистрирует его в реестре Default. Бакет +Inf добавляется автоматически.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{h: newHistogramVec(name, help, buckets, labelNames)}
+	Default.register(h.h)
+	return h
+}
+
+// With возвращает гистограмму для заданных значений меток.
+func (h *HistogramVec) With(labelValues ...string) Histogram {
+	return Histogram{s: h.h.get(labelValues), buckets: h.h.buckets}
+}
+
+// Delete удаляет серию с заданными значениями меток.
+func (h *HistogramVec) Delete(labelValues ...string) {
+	h.h.mu.Lock()
+	delete(h.h.series, strings.Join(labelValues, "\xff"))
+	h.h.mu.Unlock()
+}
+
+// DeleteLabel удаляет все серии, в которых метка name имеет значение value.
+func (h *HistogramVec) DeleteLabel(name, value string) {
+	i := slices.Index(h.h.labelNames, name)
+	if i < 0 {
+		return
+	}
+	h.h.mu.Lock()
+	maps.DeleteFunc(h.h.series, func(_ string, s *histogramSeries) bool { return s.labelValues[i] == value })
+	h.h.mu.Unlock()
+}
@@ -0,0 +1,295 @@
+// Package metrics предоставляет минимальный реестр метрик (counter, gauge, histogram)
+// с выдачей в текстовом формате Prometheus, без внешних зависимостей.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry хранит зарегистрированные семейства метрик и отдает их по HTTP.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	names    map[string]struct{}
+}
+
+// family - общее представление семейства метрик для вывода.
+type family interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Default - реестр по умолчанию, в котором регистрируются метрики всех пакетов.
+var Default = NewRegistry()
+
+// NewRegistry создает пустой реестр.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.names[f.name()]; exists {
+		panic("metrics: duplicate metric name " + f.name())
+	}
+	r.names[f.name()] = struct{}{}
+	r.families = append(r.families, f)
+}
+
+// WriteText выводит все метрики реестра в текстовом формате Prometheus.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	families := make([]family, len(r.families))
+	copy(families, r.families)
+	r.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// Handler возвращает http.Handler, отдающий метрики реестра (эндпоинт /metrics).
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// value - атомарно изменяемое значение float64.
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) load() float64 { return math.Float64frombits(v.bits.Load()) }
+
+func (v *value) store(f float64) { v.bits.Store(math.Float64bits(f)) }
+
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if v.bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+// vec хранит значения метрики по наборам значений меток.
+type vec struct {
+	metricName string
+	help       string
+	kind       string
+	labelNames []string
+	mu         sync.RWMutex
+	series     map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	val         value
+}
+
+func newVec(name, help, kind string, labelNames []string) *vec {
+	return &vec{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		series:     make(map[string]*series),
+	}
+}
+
+func (v *vec) name() string { return v.metricName }
+
+func (v *vec) get(labelValues []string) *value {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.metricName, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return &s.val
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return &s.val
+}
+
+func (v *vec) delete(labelValues []string) {
+	v.mu.Lock()
+	delete(v.series, strings.Join(labelValues, "\xff"))
+	v.mu.Unlock()
+}
+
+func (v *vec) deleteLabel(name, value string) {
+	i := slices.Index(v.labelNames, name)
+	if i < 0 {
+		return
+	}
+	v.mu.Lock()
+	maps.DeleteFunc(v.series, func(_ string, s *series) bool { return s.labelValues[i] == value })
+	v.mu.Unlock()
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.metricName, v.help, v.metricName, v.kind)
+	for _, k := range keys {
+		s := v.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, formatLabels(v.labelNames, s.labelValues), formatValue(s.val.load()))
+	}
+	v.mu.RUnlock()
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatValue(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return fmt.Sprintf("%g", f)
+}
+
+// Counter - монотонно возрастающий счетчик.
+type Counter struct{ v *value }
+
+// Inc увеличивает счетчик на 1.
+func (c Counter) Inc() { c.v.add(1) }
+
+// Add увеличивает счетчик на delta (delta не должна быть отрицательной).
+func (c Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta)
+}
+
+// CounterVec - семейство счетчиков с метками.
+type CounterVec struct{ v *vec }
+
+// NewCounterVec создает семейство счетчиков и регистрирует его в реестре Default.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{v: newVec(name, help, "counter", labelNames)}
+	Default.register(c.v)
+	return c
+}
+
+// With возвращает счетчик для заданных значений меток.
+func (c *CounterVec) With(labelValues ...string) Counter {
+	return Counter{v: c.v.get(labelValues)}
+}
+
+// Delete удаляет серию с заданными значениями меток (например, для удаленного бэкенда).
+func (c *CounterVec) Delete(labelValues ...string) { c.v.delete(labelValues) }
+
+// DeleteLabel удаляет все серии, в которых метка name имеет значение value, при любых
+// значениях остальных меток.
+func (c *CounterVec) DeleteLabel(name, value string) { c.v.deleteLabel(name, value) }
+
+// Gauge - значение, которое может как расти, так и уменьшаться.
+type Gauge struct{ v *value }
+
+// Set устанавливает значение.
+func (g Gauge) Set(f float64) { g.v.store(f) }
+
+// Add изменяет значение на delta.
+func (g Gauge) Add(delta float64) { g.v.add(delta) }
+
+// Inc увеличивает значение на 1.
+func (g Gauge) Inc() { g.v.add(1) }
+
+// Dec уменьшает значение на 1.
+func (g Gauge) Dec() { g.v.add(-1) }
+
+// GaugeVec - семейство gauge-метрик с метками.
+type GaugeVec struct{ v *vec }
+
+// NewGaugeVec создает семейство gauge-метрик и регистрирует его в реестре Default.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec(name, help, "gauge", labelNames)}
+	Default.register(g.v)
+	return g
+}
+
+// With возвращает gauge для заданных значений меток.
+func (g *GaugeVec) With(labelValues ...string) Gauge {
+	return Gauge{v: g.v.get(labelValues)}
+}
+
+// Delete удаляет серию с заданными значениями меток.
+func (g *GaugeVec) Delete(labelValues ...string) { g.v.delete(labelValues) }
+
+// DeleteLabel удаляет все серии, в которых метка name имеет значение value.
+func (g *GaugeVec) DeleteLabel(name, value string) { g.v.deleteLabel(name, value) }
+
+// GaugeFunc - gauge без меток, значение которого вычисляется при выдаче метрик.
+type GaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() float64
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.metricName, g.help, g.metricName, g.metricName, formatValue(g.fn()))
+}
+
+// NewGaugeFunc создает gauge, значение которого возвращает fn при каждой выдаче метрик
+// (например, текущее потребление памяти), и регистрирует его в реестре Default.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, fn: fn}
+	Default.register(g)
+	return g
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRegistry_WriteText проверяет вывод счетчиков и gauge в текстовом формате Prometheus.
+func TestRegistry_WriteText(t *testing.T) {
+	reg := NewRegistry()
+	requests := &CounterVec{v: newVec("test_requests_total", "Total requests.", "counter", []string{"backend"})}
+	inflight := &GaugeVec{v: newVec("test_inflight", "In-flight requests.", "gauge", nil)}
+	reg.register(requests.v)
+	reg.register(inflight.v)
+
+	requests.With("b\"1").Inc()
+	requests.With("b2").Add(2.5)
+	requests.With("b2").Add(-1) // отрицательные значения игнорируются
+	inflight.With().Set(3)
+	inflight.With().Dec()
+
+	var buf bytes.Buffer
+	reg.WriteText(&buf)
+
+	expected := "# HELP test_inflight In-flight requests.\n" +
+		"# TYPE test_inflight gauge\n" +
+		"test_inflight 2\n" +
+		"# HELP test_requests_total Total requests.\n" +
+		"# TYPE test_requests_total counter\n" +
+		"test_requests_total{backend=\"b\\\"1\"} 1\n" +
+		"test_requests_total{backend=\"b2\"} 2.5\n"
+	assert.Equal(t, expected, buf.String())
+
+	requests.Delete("b2")
+	buf.Reset()
+	reg.WriteText(&buf)
+	assert.NotContains(t, buf.String(), "b2")
+
+	requests.DeleteLabel("backend", "b\"1")
+	requests.DeleteLabel("unknown", "b3")
+	buf.Reset()
+	reg.WriteText(&buf)
+	assert.NotContains(t, buf.String(), "test_requests_total{")
+}
+
+// TestHistogram_WriteText проверяет накопительные бакеты, сумму и количество наблюдений.
+func TestHistogram_WriteText(t *testing.T) {
+	reg := NewRegistry()
+	latency := &HistogramVec{h: newHistogramVec("test_latency_seconds", "Latency.", []float64{0.5, 0.1}, []string{"phase"})}
+	reg.register(latency.h)
+
+	latency.With("dns").Observe(0.05)
+	latency.With("dns").Observe(0.1)
+	latency.With("dns").Observe(2)
+
+	var buf bytes.Buffer
+	reg.WriteText(&buf)
+
+	expected := "# HELP test_latency_seconds Latency.\n" +
+		"# TYPE test_latency_seconds histogram\n" +
+		"test_latency_seconds_bucket{phase=\"dns\",le=\"0.1\"} 2\n" +
+		"test_latency_seconds_bucket{phase=\"dns\",le=\"0.5\"} 2\n" +
+		"test_latency_seconds_bucket{phase=\"dns\",le=\"+Inf\"} 3\n" +
+		"test_latency_seconds_sum{phase=\"dns\"} 2.15\n" +
+		"test_latency_seconds_count{phase=\"dns\"} 3\n"
+	assert.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+var adminAccessDeniedTotal = metrics.NewCounterVec("lb_admin_access_denied_total",
+	"Admin API requests rejected by source address restriction.")
+
+// AdminAccess является middleware-функцией, которая разрешает запросы к Admin API (/admin
+// и /admin/*) и метрикам (/metrics) только с адресов из allowedCIDRs (CIDR или отдельные
+// IP-адреса). Адрес клиента определяется резолвером resolver с учетом доверенных прокси.
+// Остальные такие запросы отклоняются с 403 Forbidden до обработчиков; прочие пути
+// (включая /readyz для внешних балансировщиков) не затрагиваются.
+func AdminAccess(allowedCIDRs []string, resolver *ClientIPResolver) (func(http.Handler) http.Handler, error) {
+	allowed, err := parsePrefixes(allowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin CIDR: %w", err)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isAdminPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			client := resolver.ClientIP(r)
+			if !client.IsValid() || !containsAddr(allowed, client) {
+				log.Printf("WARN: Admin API access denied for %s (remote %s): %s %s", client, r.RemoteAddr, r.Method, r.URL.Path)
+				adminAccessDeniedTotal.With().Inc()
+				httputil_pkg.RespondWithError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// isAdminPath сообщает, относится ли путь к Admin API или метрикам.
+func isAdminPath(path string) bool {
+	return path == "/admin" || strings.HasPrefix(path, "/admin/") || path == "/metrics"
+}
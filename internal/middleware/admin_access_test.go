@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientIPResolver проверяет определение адреса клиента с учетом доверенных прокси.
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		remote   string
+		xff      []string
+		expected string
+	}{
+		{remote: "203.0.113.5:1234", expected: "203.0.113.5"},
+		{remote: "203.0.113.5:1234", xff: []string{"198.51.100.1"}, expected: "203.0.113.5"},
+		{remote: "10.1.2.3:1234", xff: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+		{remote: "10.1.2.3:1234", xff: []string{"1.1.1.1, 198.51.100.1, 192.168.1.1"}, expected: "198.51.100.1"},
+		{remote: "10.1.2.3:1234", xff: []string{"1.1.1.1", "198.51.100.1"}, expected: "198.51.100.1"},
+		{remote: "10.1.2.3:1234", xff: []string{"garbage, 10.0.0.7"}, expected: "10.0.0.7"},
+		{remote: "10.1.2.3:1234", expected: "10.1.2.3"},
+		{remote: "[::ffff:10.1.2.3]:1234", xff: []string{"198.51.100.1"}, expected: "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		for _, v := range tt.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		assert.Equal(t, tt.expected, resolver.ClientIP(req).String(), "remote %s, xff %v", tt.remote, tt.xff)
+	}
+
+	_, err = NewClientIPResolver([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+// TestAdminAccess проверяет, что к Admin API допускаются только разрешенные адреса,
+// а остальные пути не ограничиваются.
+func TestAdminAccess(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.1"})
+	require.NoError(t, err)
+	mw, err := AdminAccess([]string{"127.0.0.1", "172.16.0.0/12"}, resolver)
+	require.NoError(t, err)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path     string
+		remote   string
+		xff      string
+		expected int
+	}{
+		{path: "/admin/stats", remote: "127.0.0.1:5000", expected: http.StatusOK},
+		{path: "/admin/stats", remote: "172.20.1.1:5000", expected: http.StatusOK},
+		{path: "/admin", remote: "203.0.113.5:5000", expected: http.StatusForbidden},
+		{path: "/admin/backends/app-1", remote: "203.0.113.5:5000", expected: http.StatusForbidden},
+		{path: "/admin/stats", remote: "203.0.113.5:5000", xff: "127.0.0.1", expected: http.StatusForbidden},
+		{path: "/admin/stats", remote: "10.0.0.1:5000", xff: "172.16.0.9", expected: http.StatusOK},
+		{path: "/admin/stats", remote: "10.0.0.1:5000", xff: "203.0.113.5", expected: http.StatusForbidden},
+		{path: "/metrics", remote: "203.0.113.5:5000", expected: http.StatusForbidden},
+		{path: "/metrics", remote: "127.0.0.1:5000", expected: http.StatusOK},
+		{path: "/readyz", remote: "203.0.113.5:5000", expected: http.StatusOK},
+		{path: "/administrator", remote: "203.0.113.5:5000", expected: http.StatusOK},
+		{path: "/api/users", remote: "203.0.113.5:5000", expected: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.expected, rec.Code, "%s from %s (xff %q)", tt.path, tt.remote, tt.xff)
+	}
+
+	_, err = AdminAccess([]string{"not-a-cidr"}, resolver)
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPResolver определяет IP-адрес клиента с учетом доверенных прокси: если запрос
+// пришел от доверенного прокси, адрес клиента берется из X-Forwarded-For - это самый
+// правый адрес, не принадлежащий доверенным прокси. Заголовок от остальных источников
+// игнорируется, так как клиент может подделать его.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver создает ClientIPResolver для доверенных прокси trustedProxies
+// (CIDR или отдельные IP-адреса). Пустой список - X-Forwarded-For не учитывается.
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	trusted, err := parsePrefixes(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+	}
+	return &ClientIPResolver{trusted: trusted}, nil
+}
+
+// ClientIP возвращает IP-адрес клиента запроса r или невалидный адрес, если его не удалось
+// определить. Nil-резолвер использует только адрес соединения.
+func (c *ClientIPResolver) ClientIP(r *http.Request) netip.Addr {
+	addr := remoteAddr(r)
+	if c == nil || !addr.IsValid() || !containsAddr(c.trusted, addr) {
+		return addr
+	}
+	hops := r.Header.Values("X-Forwarded-For")
+	for i := len(hops) - 1; i >= 0; i-- {
+		parts := strings.Split(hops[i], ",")
+		for j := len(parts) - 1; j >= 0; j-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(parts[j]))
+			if err != nil {
+				// Цепочка повреждена: дальше нее адресам доверять нельзя.
+				return addr
+			}
+			hop = hop.Unmap()
+			if !containsAddr(c.trusted, hop) {
+				return hop
+			}
+			addr = hop
+		}
+	}
+	return addr
+}
+
+// remoteAddr возвращает адрес соединения запроса r.
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// parsePrefixes разбирает список CIDR и отдельных IP-адресов (как префиксы /32 или /128).
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// containsAddr сообщает, входит ли addr в один из префиксов.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
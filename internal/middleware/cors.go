@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+)
+
+// CORSRule описывает политику CORS для маршрутов с заданным префиксом пути.
+type CORSRule struct {
+	PathPrefix       string
+	AllowedOrigins   []string // "*" разрешает любой источник.
+	AllowedMethods   []string
+	AllowedHeaders   []string // "*" разрешает любые заголовки.
+	ExposedHeaders   []string
+	MaxAge           time.Duration
+	AllowCredentials bool
+}
+
+func (rule *CORSRule) originAllowed(origin string) bool {
+	for _, o := range rule.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *CORSRule) methodAllowed(method string) bool {
+	for _, m := range rule.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOriginValue возвращает значение Access-Control-Allow-Origin для источника.
+// При разрешенных credentials "*" недопустим, поэтому источник возвращается явно.
+func (rule *CORSRule) allowOriginValue(origin string) string {
+	for _, o := range rule.AllowedOrigins {
+		if o == "*" && !rule.AllowCredentials {
+			return "*"
+		}
+	}
+	return origin
+}
+
+// CORS является middleware-функцией, применяющей политики CORS по префиксам пути.
+// Preflight-запросы (OPTIONS с Access-Control-Request-Method) обрабатываются балансировщиком
+// напрямую и не доходят до бэкендов; для обычных запросов CORS-заголовки бэкенда заменяются
+// заголовками политики. Используется правило с самым длинным совпадающим префиксом.
+func CORS(rules []CORSRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			rule := matchCORSRule(rules, r.URL.Path)
+			if origin == "" || rule == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			isPreflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if isPreflight {
+				handlePreflight(w, r, rule, origin)
+				return
+			}
+
+			if !rule.originAllowed(origin) {
+				// Запрос передается бэкенду, но без CORS-заголовков браузер не отдаст ответ скрипту.
+				next.ServeHTTP(&corsWriter{ResponseWriter: w}, r)
+				return
+			}
+			next.ServeHTTP(&corsWriter{ResponseWriter: w, rule: rule, origin: origin}, r)
+		})
+	}
+}
+
+func matchCORSRule(rules []CORSRule, path string) *CORSRule {
+	var best *CORSRule
+	for i := range rules {
+		if httputil_pkg.PathHasPrefix(path, rules[i].PathPrefix) && (best == nil || len(rules[i].PathPrefix) > len(best.PathPrefix)) {
+			best = &rules[i]
+		}
+	}
+	return best
+}
+
+func handlePreflight(w http.ResponseWriter, r *http.Request, rule *CORSRule, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	requestedMethod := r.Header.Get("Access-Control-Request-Method")
+	if !rule.originAllowed(origin) || !rule.methodAllowed(requestedMethod) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", rule.allowOriginValue(origin))
+	h.Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+	if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		if allowed := allowedRequestHeaders(rule, requested); allowed != "" {
+			h.Set("Access-Control-Allow-Headers", allowed)
+		}
+	}
+	if rule.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if rule.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(rule.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowedRequestHeaders возвращает подмножество запрошенных заголовков, разрешенных правилом.
+func allowedRequestHeaders(rule *CORSRule, requested string) string {
+	var allowed []string
+	for _, name := range strings.Split(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		for _, h := range rule.AllowedHeaders {
+			if h == "*" || strings.EqualFold(h, name) {
+				allowed = append(allowed, name)
+				break
+			}
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// corsWriter перед отправкой заголовков ответа удаляет CORS-заголовки бэкенда
+// и устанавливает заголовки политики (если rule не nil).
+type corsWriter struct {
+	http.ResponseWriter
+	rule        *CORSRule
+	origin      string
+	wroteHeader bool
+}
+
+func (cw *corsWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		h := cw.Header()
+		for name := range h {
+			if strings.HasPrefix(name, "Access-Control-") {
+				h.Del(name)
+			}
+		}
+		h.Add("Vary", "Origin")
+		if cw.rule != nil {
+			h.Set("Access-Control-Allow-Origin", cw.rule.allowOriginValue(cw.origin))
+			if cw.rule.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if len(cw.rule.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(cw.rule.ExposedHeaders, ", "))
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *corsWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush поддерживает потоковые ответы через обертку.
+func (cw *corsWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (cw *corsWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCORS_PreflightAndSimpleRequest проверяет ответ на preflight без обращения к бэкенду
+// и замену CORS-заголовков бэкенда заголовками политики.
+func TestCORS_PreflightAndSimpleRequest(t *testing.T) {
+	backendCalls := 0
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendCalls++
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := CORS([]CORSRule{{
+		PathPrefix:       "/api/",
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"Content-Type"},
+		MaxAge:           10 * time.Minute,
+		AllowCredentials: true,
+	}})(backend)
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", "PUT")
+	preflight.Header.Set("Access-Control-Request-Headers", "content-type, x-secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, preflight)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "content-type", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Zero(t, backendCalls, "Preflight must be answered by the balancer")
+
+	preflight.Header.Set("Access-Control-Request-Method", "DELETE")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, preflight)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, 1, backendCalls)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), "Backend CORS headers must be stripped for disallowed origins")
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+var extAuthRequestsTotal = metrics.NewCounterVec("lb_ext_auth_requests_total",
+	"Requests checked by the external auth service, by result (allowed, denied, error).", "result")
+
+// maxExtAuthDenyBody ограничивает размер тела отказа сервиса авторизации, передаваемого клиенту.
+const maxExtAuthDenyBody = 64 << 10
+
+// extAuthHopHeaders - заголовки соединения, которые не передаются сервису авторизации.
+var extAuthHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length", "Expect",
+}
+
+// ExtAuthConfig задает внешнюю авторизацию запросов (аналог auth_request в Nginx и ext_authz в Envoy).
+type ExtAuthConfig struct {
+	URL     string        // Адрес сервиса авторизации.
+	Timeout time.Duration // Таймаут запроса к сервису (0 - 1s).
+	// Заголовки запроса, передаваемые сервису (пусто - все, кроме заголовков соединения).
+	ForwardHeaders []string
+	// Заголовки ответа сервиса, копируемые в запрос к бэкенду при разрешении. Одноименные
+	// заголовки клиента удаляются, чтобы их нельзя было подделать.
+	UpstreamHeaders []string
+}
+
+// ExtAuth является middleware-функцией, которая перед проксированием запрашивает у сервиса
+// авторизации решение по запросу: сервису отправляется GET с заголовками запроса и
+// X-Forwarded-Method, X-Forwarded-Uri, X-Forwarded-Host, X-Forwarded-Proto (тело не передается).
+// Ответ 2xx разрешает запрос, 401/403 - отклоняет: клиент получает статус, тело и заголовок
+// WWW-Authenticate ответа сервиса. Другие ответы и недоступность сервиса отклоняют запрос
+// с 503 Service Unavailable.
+func ExtAuth(cfg ExtAuthConfig) (func(http.Handler) http.Handler, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid auth service URL %q", cfg.URL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		// Перенаправление сервиса авторизации (например, на страницу входа) не выполняется.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, cfg.URL, nil)
+			if err != nil {
+				extAuthRequestsTotal.With("error").Inc()
+				httputil_pkg.RespondWithError(w, http.StatusServiceUnavailable, "Authentication service unavailable")
+				return
+			}
+			copyAuthHeaders(authReq.Header, r.Header, cfg.ForwardHeaders)
+			proto := "http"
+			if r.TLS != nil {
+				proto = "https"
+			}
+			authReq.Header.Set("X-Forwarded-Method", r.Method)
+			authReq.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+			authReq.Header.Set("X-Forwarded-Host", r.Host)
+			authReq.Header.Set("X-Forwarded-Proto", proto)
+
+			resp, err := client.Do(authReq)
+			if err != nil {
+				log.Printf("ERROR: External auth request for %s %s failed: %v", r.Method, r.URL.Path, err)
+				extAuthRequestsTotal.With("error").Inc()
+				httputil_pkg.RespondWithError(w, http.StatusServiceUnavailable, "Authentication service unavailable")
+				return
+			}
+			defer resp.Body.Close()
+
+			switch {
+			case resp.StatusCode >= 200 && resp.StatusCode < 300:
+				extAuthRequestsTotal.With("allowed").Inc()
+				_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxExtAuthDenyBody))
+				if len(cfg.UpstreamHeaders) > 0 {
+					r = r.Clone(r.Context())
+					for _, h := range cfg.UpstreamHeaders {
+						r.Header.Del(h)
+						for _, v := range resp.Header.Values(h) {
+							r.Header.Add(h, v)
+						}
+					}
+				}
+				next.ServeHTTP(w, r)
+			case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+				extAuthRequestsTotal.With("denied").Inc()
+				log.Printf("DEBUG: External auth denied %s %s with status %d", r.Method, r.URL.Path, resp.StatusCode)
+				for _, h := range []string{"WWW-Authenticate", "Content-Type"} {
+					for _, v := range resp.Header.Values(h) {
+						w.Header().Add(h, v)
+					}
+				}
+				w.WriteHeader(resp.StatusCode)
+				_, _ = io.Copy(w, io.LimitReader(resp.Body, maxExtAuthDenyBody))
+			default:
+				log.Printf("ERROR: External auth service returned unexpected status %d for %s %s", resp.StatusCode, r.Method, r.URL.Path)
+				extAuthRequestsTotal.With("error").Inc()
+				httputil_pkg.RespondWithError(w, http.StatusServiceUnavailable, "Authentication service unavailable")
+			}
+		})
+	}, nil
+}
+
+// copyAuthHeaders копирует в dst заголовки names из src (пусто - все, кроме заголовков соединения).
+func copyAuthHeaders(dst, src http.Header, names []string) {
+	if len(names) > 0 {
+		for _, name := range names {
+			for _, v := range src.Values(name) {
+				dst.Add(name, v)
+			}
+		}
+		return
+	}
+	for name, values := range src {
+		dst[name] = append([]string(nil), values...)
+	}
+	for _, name := range extAuthHopHeaders {
+		dst.Del(name)
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtAuth проверяет разрешение, отказ и недоступность сервиса авторизации.
+func TestExtAuth(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Empty(t, r.Header.Get("Connection"))
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			assert.Equal(t, "DELETE", r.Header.Get("X-Forwarded-Method"))
+			assert.Equal(t, "/api/items/1?force=1", r.Header.Get("X-Forwarded-Uri"))
+			w.Header().Set("X-User-ID", "42")
+			w.WriteHeader(http.StatusOK)
+		case "Bearer broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, "token expired")
+		}
+	}))
+	defer auth.Close()
+
+	var upstream *http.Request
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { upstream = r })
+	mw, err := ExtAuth(ExtAuthConfig{URL: auth.URL, UpstreamHeaders: []string{"X-User-ID"}})
+	require.NoError(t, err)
+	handler := mw(backend)
+
+	send := func(token string) *httptest.ResponseRecorder {
+		upstream = nil
+		req := httptest.NewRequest(http.MethodDelete, "/api/items/1?force=1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Connection", "keep-alive")
+		req.Header.Set("X-User-ID", "spoofed")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("good")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, upstream)
+	assert.Equal(t, []string{"42"}, upstream.Header.Values("X-User-ID"), "Identity comes from the auth service only")
+
+	rec = send("bad")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="api"`, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "token expired", rec.Body.String())
+	assert.Nil(t, upstream)
+
+	rec = send("broken")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Nil(t, upstream)
+
+	auth.Close()
+	rec = send("good")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "Unreachable auth service fails closed")
+	assert.Nil(t, upstream)
+
+	_, err = ExtAuth(ExtAuthConfig{URL: "auth.internal/check"})
+	assert.Error(t, err)
+}
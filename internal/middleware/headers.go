@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+)
+
+// HeaderActions описывает изменения набора заголовков. Применяются в порядке: удаление,
+// замена, добавление.
+type HeaderActions struct {
+	Remove []string
+	Set    map[string]string // Заменяет все значения заголовка.
+	Add    map[string]string // Добавляет значение к существующим.
+}
+
+func (a *HeaderActions) empty() bool {
+	return len(a.Remove) == 0 && len(a.Set) == 0 && len(a.Add) == 0
+}
+
+func (a *HeaderActions) apply(header http.Header) {
+	for _, name := range a.Remove {
+		header.Del(name)
+	}
+	for name, value := range a.Set {
+		header.Set(name, value)
+	}
+	for name, value := range a.Add {
+		header.Add(name, value)
+	}
+}
+
+// HeaderRule задает изменения заголовков запросов с путем, начинающимся с PathPrefix
+// ("" - все запросы), и ответов на них.
+type HeaderRule struct {
+	PathPrefix string
+	Request    HeaderActions // Заголовки запроса до передачи бэкенду.
+	Response   HeaderActions // Заголовки ответа до отправки клиенту.
+}
+
+// HeaderRewrite является middleware-функцией, изменяющей заголовки запросов и ответов по
+// правилам. Применяются все подходящие правила по порядку, поэтому общее правило можно
+// дополнить правилами для отдельных маршрутов. Изменения ответа применяются и к ответам,
+// сформированным самим балансировщиком (ошибки, отказы Rate Limiter).
+func HeaderRewrite(rules []HeaderRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var matched []*HeaderRule
+			rewriteRequest := false
+			for i := range rules {
+				if httputil_pkg.PathHasPrefix(r.URL.Path, rules[i].PathPrefix) {
+					matched = append(matched, &rules[i])
+					rewriteRequest = rewriteRequest || !rules[i].Request.empty()
+				}
+			}
+			if len(matched) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if rewriteRequest {
+				r = r.Clone(r.Context())
+				for _, rule := range matched {
+					rule.Request.apply(r.Header)
+				}
+			}
+			next.ServeHTTP(&headerWriter{ResponseWriter: w, rules: matched}, r)
+		})
+	}
+}
+
+// headerWriter применяет изменения заголовков ответа перед отправкой его заголовков.
+type headerWriter struct {
+	http.ResponseWriter
+	rules       []*HeaderRule
+	wroteHeader bool
+}
+
+func (hw *headerWriter) WriteHeader(code int) {
+	if !hw.wroteHeader && code >= http.StatusOK {
+		hw.wroteHeader = true
+		for _, rule := range hw.rules {
+			rule.Response.apply(hw.Header())
+		}
+	}
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *headerWriter) Write(p []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(p)
+}
+
+// Flush отправляет заголовки с изменениями, если они еще не отправлены.
+func (hw *headerWriter) Flush() {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(hw.ResponseWriter).Flush()
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (hw *headerWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHeaderRewrite проверяет изменение заголовков запроса и ответа подходящими правилами.
+func TestHeaderRewrite(t *testing.T) {
+	var received http.Header
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Server", "nginx/1.25")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := HeaderRewrite([]HeaderRule{
+		{
+			Request:  HeaderActions{Remove: []string{"X-Debug"}, Set: map[string]string{"X-Source": "lb"}},
+			Response: HeaderActions{Remove: []string{"Server"}, Add: map[string]string{"X-Env": "prod"}},
+		},
+		{
+			PathPrefix: "/static/",
+			Response:   HeaderActions{Set: map[string]string{"Cache-Control": "max-age=3600"}},
+		},
+		{
+			PathPrefix: "/api",
+			Response:   HeaderActions{Set: map[string]string{"X-Api": "1"}},
+		},
+	})(backend)
+
+	req := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Source", "client")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, received.Get("X-Debug"))
+	assert.Equal(t, []string{"lb"}, received.Values("X-Source"))
+	assert.Equal(t, "1", req.Header.Get("X-Debug"), "Original request must not be modified")
+	assert.Empty(t, rec.Header().Get("Server"))
+	assert.Equal(t, "prod", rec.Header().Get("X-Env"))
+	assert.Equal(t, "max-age=3600", rec.Header().Get("Cache-Control"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"), "Rules for other prefixes must not apply")
+	assert.Equal(t, "prod", rec.Header().Get("X-Env"))
+	assert.Equal(t, "1", rec.Header().Get("X-Api"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apix", nil))
+	assert.Empty(t, rec.Header().Get("X-Api"), "Prefix matches on a segment boundary")
+}
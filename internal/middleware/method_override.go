@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+)
+
+// MethodOverrideHeader - заголовок, через который клиент может указать реальный метод запроса.
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+// MethodOverride является middleware-функцией, которая позволяет клиентам за ограничивающими
+// прокси выполнять PUT/DELETE и другие методы через POST, передавая реальный метод
+// в заголовке X-HTTP-Method-Override. Допустимые методы задаются allowlist.
+// Подмена выполняется до маршрутизации и rate limiting, а заголовок не передается бэкенду.
+// В запросах с методом, отличным от POST, заголовок игнорируется (и также удаляется).
+func MethodOverride(allowedMethods []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]struct{}, len(allowedMethods))
+	for _, m := range allowedMethods {
+		allowed[strings.ToUpper(strings.TrimSpace(m))] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			override := r.Header.Get(MethodOverrideHeader)
+			if override == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method != http.MethodPost {
+				r2 := r.Clone(r.Context())
+				r2.Header.Del(MethodOverrideHeader)
+				next.ServeHTTP(w, r2)
+				return
+			}
+
+			method := strings.ToUpper(strings.TrimSpace(override))
+			if _, ok := allowed[method]; !ok {
+				log.Printf("WARN: Rejected method override to %q from %s", override, r.RemoteAddr)
+				httputil_pkg.RespondWithError(w, http.StatusBadRequest, "Method override not allowed: "+method)
+				return
+			}
+
+			log.Printf("DEBUG: Method override POST -> %s for %s", method, r.URL.Path)
+			r2 := r.Clone(r.Context())
+			r2.Method = method
+			r2.Header.Del(MethodOverrideHeader)
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMethodOverride проверяет подмену метода POST-запроса, отклонение методов вне allowlist
+// и игнорирование заголовка в запросах с другими методами.
+func TestMethodOverride(t *testing.T) {
+	var method, header string
+	called := false
+	handler := MethodOverride([]string{"put", " DELETE "})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		method, header = r.Method, r.Header.Get(MethodOverrideHeader)
+	}))
+	serve := func(reqMethod, override string) *httptest.ResponseRecorder {
+		called, method, header = false, "", ""
+		req := httptest.NewRequest(reqMethod, "/items/1", nil)
+		req.Header.Set(MethodOverrideHeader, override)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "delete").Code)
+	assert.Equal(t, http.MethodDelete, method, "Allowed override is applied")
+	assert.Empty(t, header, "Override header is not forwarded")
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "PATCH").Code)
+	assert.False(t, called, "Method outside the allowlist is rejected")
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "DELETE").Code)
+	assert.Equal(t, http.MethodGet, method, "Override is ignored for non-POST requests")
+	assert.Empty(t, header)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "").Code)
+	assert.Equal(t, http.MethodPost, method)
+}
+
+// TestMethodOverride_BeforeRoutingAndRateLimit проверяет, что маршрутизация и правила rate
+// limiting видят подмененный метод.
+func TestMethodOverride_BeforeRoutingAndRateLimit(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 100, 1, time.Minute)
+	require.NoError(t, limiter.SetRequestRules([]rl.RequestRule{{Name: "deletes", Methods: []string{http.MethodDelete}, Capacity: 1, RefillRate: 0.001}}))
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := MethodOverride([]string{http.MethodDelete})(RateLimit(limiter)(mux))
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/items/1", nil)
+		req.Header.Set(MethodOverrideHeader, http.MethodDelete)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(), "Request is routed as DELETE")
+	assert.Equal(t, http.StatusTooManyRequests, serve(), "Request is charged to the DELETE rule")
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+var normalizationRejectedTotal = metrics.NewCounterVec("lb_normalization_rejected_total",
+	"Requests rejected by URL normalization, by reason.", "reason")
+
+// NormalizeOptions задает параметры нормализации URL запроса.
+type NormalizeOptions struct {
+	// RejectEncodedSlash отклоняет пути, содержащие закодированный слеш (%2F).
+	// Иначе он декодируется и участвует в нормализации как обычный разделитель.
+	RejectEncodedSlash bool
+}
+
+// Normalize является middleware-функцией, которая нормализует путь запроса до маршрутизации
+// и проксирования: проверяет корректность percent-кодирования, отклоняет нулевые байты,
+// схлопывает повторяющиеся слеши и разрешает сегменты "." и "..".
+// Это защищает бэкенды от атак, основанных на разной интерпретации путей (path confusion).
+func Normalize(opts NormalizeOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			normalized, reason := normalizePath(r.URL, opts)
+			if reason != "" {
+				log.Printf("WARN: Rejecting request with malformed path %q from %s: %s", r.URL.EscapedPath(), r.RemoteAddr, reason)
+				normalizationRejectedTotal.With(reason).Inc()
+				httputil_pkg.RespondWithError(w, http.StatusBadRequest, "Bad Request: "+reason)
+				return
+			}
+
+			if normalized != r.URL.Path || r.URL.RawPath != "" {
+				log.Printf("DEBUG: Normalized request path %q -> %q", r.URL.EscapedPath(), normalized)
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = normalized
+				r2.URL.RawPath = ""
+				r2.RequestURI = r2.URL.RequestURI()
+				r = r2
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// normalizePath возвращает нормализованный путь или непустую причину отказа.
+func normalizePath(u *url.URL, opts NormalizeOptions) (string, string) {
+	raw := u.EscapedPath()
+	if opts.RejectEncodedSlash && strings.Contains(strings.ToLower(raw), "%2f") {
+		return "", "encoded slash in path"
+	}
+
+	decoded, err := url.PathUnescape(raw)
+	if err != nil {
+		return "", "invalid percent-encoding"
+	}
+	if strings.ContainsRune(decoded, 0) {
+		return "", "null byte in path"
+	}
+
+	if decoded == "" {
+		return "/", ""
+	}
+	cleaned := path.Clean("/" + decoded)
+	if strings.HasSuffix(decoded, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned, ""
+}
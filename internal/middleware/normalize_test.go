@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizePath проверяет нормализацию путей и отклонение опасных запросов.
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		rawPath  string
+		opts     NormalizeOptions
+		expected string
+		reason   string
+	}{
+		{rawPath: "/api//users///1", expected: "/api/users/1"},
+		{rawPath: "/static/../admin/./x", expected: "/admin/x"},
+		{rawPath: "/%2e%2e/%2e%2e/etc/passwd", expected: "/etc/passwd"},
+		{rawPath: "/dir/", expected: "/dir/"},
+		{rawPath: "/a%2Fb", expected: "/a/b"},
+		{rawPath: "/a%2Fb", opts: NormalizeOptions{RejectEncodedSlash: true}, reason: "encoded slash in path"},
+		{rawPath: "/file%00.txt", reason: "null byte in path"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.rawPath)
+		require.NoError(t, err)
+		normalized, reason := normalizePath(u, tt.opts)
+		assert.Equal(t, tt.reason, reason, "reason for %s", tt.rawPath)
+		if tt.reason == "" {
+			assert.Equal(t, tt.expected, normalized, "normalized path for %s", tt.rawPath)
+		}
+	}
+}
@@ -2,16 +2,32 @@ package middleware
 
 import (
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	httputil_pkg "cloud/load_balancer/internal/httputil"
 	rl "cloud/load_balancer/internal/ratelimiter"
 )
 
 // RateLimit является middleware-функцией, которая применяет rate limiting
-// к входящим запросам на основе IP-адреса клиента.
+// к входящим запросам на основе IP-адреса клиента. Если включены лимиты тенантов
+// (см. ratelimiter.TenantPolicy), запрос также расходует общий лимит тенанта из заголовка.
+// Запросы, подходящие под правила по методу, пути или Content-Type (см.
+// ratelimiter.RequestRule), ограничиваются отдельным бакетом правила.
 func RateLimit(limiter *rl.Limiter) func(http.Handler) http.Handler {
+	return RateLimitByKey(limiter, nil)
+}
+
+// RateLimitByKey работает как RateLimit, но идентификатор клиента для лимитов вычисляется
+// функцией key (например, по ключу API из заголовка). Если key равна nil или возвращает
+// пустую строку, используется IP-адрес клиента.
+func RateLimitByKey(limiter *rl.Limiter, key func(*http.Request) string) func(http.Handler) http.Handler {
+	tenantHeader := limiter.TenantHeader()
+	bypassHeader := limiter.BypassHeader()
+	adaptive := limiter.AdaptiveEnabled()
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ip := r.RemoteAddr
@@ -22,15 +38,90 @@ func RateLimit(limiter *rl.Limiter) func(http.Handler) http.Handler {
 			if strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]") {
 				ip = ip[1 : len(ip)-1]
 			}
+			if key != nil {
+				if k := key(r); k != "" {
+					ip = k
+				}
+			}
 
-			if !limiter.Allow(ip) {
+			if bypassHeader != "" {
+				if token := r.Header.Get(bypassHeader); token != "" {
+					// Токен не передается бэкенду.
+					r.Header.Del(bypassHeader)
+					subject, err := limiter.VerifyBypassToken(token)
+					if err == nil {
+						log.Printf("INFO: AUDIT: Rate limit bypass token accepted for %q (client %s) on %s %s", subject, ip, r.Method, r.URL.Path)
+						next.ServeHTTP(w, r)
+						return
+					}
+					// Недействительный токен не дает обхода: запрос ограничивается как обычно.
+					log.Printf("WARN: AUDIT: Rejected rate limit bypass token from client %s on %s: %v", ip, r.URL.Path, err)
+				}
+			}
+
+			tenant := ""
+			if tenantHeader != "" {
+				tenant = r.Header.Get(tenantHeader)
+			}
+
+			decision := limiter.CheckRequest(ip, tenant, rl.RequestAttributes{
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				ContentType: r.Header.Get("Content-Type"),
+			})
+			if decision.Banned {
+				retryAfter := int(math.Ceil(time.Until(decision.BannedUntil).Seconds()))
+				if retryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				}
+				httputil_pkg.RespondWithError(w, http.StatusForbidden, "Client is temporarily banned for exceeding rate limits")
+				return
+			}
+			if decision.TenantLimited {
+				log.Printf("WARN: Tenant rate limit exceeded for tenant %s (client %s) on %s", tenant, ip, r.URL.Path)
+				httputil_pkg.RespondWithError(w, http.StatusTooManyRequests, "Tenant rate limit exceeded")
+				return
+			}
+			if decision.Throttled {
+				log.Printf("WARN: Client %s throttled on %s (effective rate reduced to %.0f%% after backend overload responses)", ip, r.URL.Path, limiter.ThrottleFactor(ip)*100)
+				httputil_pkg.RespondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			if !decision.Allowed && decision.Rule != "" {
+				log.Printf("WARN: Rate limit rule %s exceeded for client %s on %s %s", decision.Rule, ip, r.Method, r.URL.Path)
+				httputil_pkg.RespondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			if !decision.Allowed {
 				log.Printf("WARN: Rate limit exceeded for client %s on %s", ip, r.URL.Path)
 				httputil_pkg.RespondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
 				return
 			}
 
+			if decision.Delay > 0 {
+				timer := time.NewTimer(decision.Delay)
+				select {
+				case <-timer.C:
+				case <-r.Context().Done():
+					// Клиент отключился во время задержки - обрабатывать запрос незачем.
+					timer.Stop()
+					return
+				}
+				log.Printf("DEBUG: Request from client %s on %s delayed by %v (tarpit)", ip, r.URL.Path, decision.Delay)
+			}
+
 			log.Printf("DEBUG: Request allowed for client %s on %s", ip, r.URL.Path)
+			if !adaptive {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Учитываются только ответы бэкендов: ошибки самого балансировщика (нет доступных
+			// бэкендов, сброс нагрузки, переполнение очереди) не говорят о перегрузке клиентом.
+			r, upstreamStatus := rl.TrackUpstreamStatus(r)
 			next.ServeHTTP(w, r)
+			if status := upstreamStatus(); status != 0 {
+				limiter.RecordResponse(ip, status)
+			}
 		})
 	}
 }
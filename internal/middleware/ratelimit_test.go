@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRateLimit_AdaptiveUpstreamOnly проверяет, что адаптивное ограничение учитывает только
+// ответы бэкендов, а не ошибки, сформированные самим балансировщиком.
+func TestRateLimit_AdaptiveUpstreamOnly(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 1000, 1, time.Minute)
+	require.NoError(t, limiter.SetAdaptivePolicy(rl.AdaptivePolicy{
+		Enabled: true, MinFactor: 0.1, Decrease: 0.5, Recovery: 0.25,
+	}))
+	upstream := false
+	handler := RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if upstream {
+			rl.RecordUpstreamStatus(r, http.StatusServiceUnavailable)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	serve := func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve()
+	assert.Equal(t, 1.0, limiter.ThrottleFactor("192.0.2.1"), "Balancer-generated 503 does not throttle")
+
+	upstream = true
+	serve()
+	assert.Equal(t, 0.5, limiter.ThrottleFactor("192.0.2.1"), "Backend 503 throttles the client")
+}
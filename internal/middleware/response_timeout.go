@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+)
+
+// ResponseTimeoutRoute задает время на отправку ответа для запросов с путем, начинающимся
+// с PathPrefix.
+type ResponseTimeoutRoute struct {
+	PathPrefix string
+	Timeout    time.Duration // 0 - без ограничения (например, для потоковых ответов и загрузок).
+}
+
+// ResponseTimeouts является middleware-функцией, которая заменяет общий WriteTimeout сервера
+// дедлайном записи ответа для маршрута с самым длинным подходящим префиксом (через
+// http.ResponseController.SetWriteDeadline). Дедлайн отсчитывается от начала обработки
+// запроса; запись ответа после него завершается ошибкой и соединение закрывается. Запросы,
+// не подошедшие ни под один маршрут, ограничиваются WriteTimeout сервера.
+func ResponseTimeouts(routes []ResponseTimeoutRoute) func(http.Handler) http.Handler {
+	sorted := append([]ResponseTimeoutRoute(nil), routes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].PathPrefix) > len(sorted[j].PathPrefix) })
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, route := range sorted {
+				if !httputil_pkg.PathHasPrefix(r.URL.Path, route.PathPrefix) {
+					continue
+				}
+				var deadline time.Time
+				if route.Timeout > 0 {
+					deadline = time.Now().Add(route.Timeout)
+				}
+				if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+					log.Printf("WARN: Failed to set response deadline for %s %s: %v", r.Method, r.URL.Path, err)
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
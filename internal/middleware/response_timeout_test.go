@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResponseTimeouts проверяет, что дедлайн маршрута заменяет WriteTimeout сервера:
+// маршрут без ограничения и маршрут с большим таймаутом получают ответ, остальные запросы
+// обрываются по WriteTimeout.
+func TestResponseTimeouts(t *testing.T) {
+	handler := ResponseTimeouts([]ResponseTimeoutRoute{
+		{PathPrefix: "/downloads", Timeout: 0},
+		{PathPrefix: "/reports", Timeout: time.Second},
+		{PathPrefix: "/reports/fast", Timeout: 20 * time.Millisecond},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	}))
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	get := func(path string) (string, error) {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	body, err := get("/downloads/big.iso")
+	require.NoError(t, err)
+	assert.Equal(t, "done", body, "Route without a deadline is exempt from WriteTimeout")
+	body, err = get("/reports/monthly")
+	require.NoError(t, err)
+	assert.Equal(t, "done", body)
+
+	_, err = get("/reports/fast")
+	assert.Error(t, err, "Longest prefix wins")
+	_, err = get("/downloadsx")
+	assert.Error(t, err, "Prefix matches on a segment boundary")
+	_, err = get("/api")
+	assert.Error(t, err, "Other routes keep the server WriteTimeout")
+}
@@ -0,0 +1,470 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Язык выражений политик: строковые и логические значения, атрибуты запроса и функции.
+//
+//	выражение := или
+//	или       := и { "||" и }
+//	и         := сравнение { "&&" сравнение }
+//	сравнение := сумма [ ("==" | "!=") сумма ]
+//	сумма     := унарное { "+" унарное }        // конкатенация строк
+//	унарное   := "!" унарное | первичное
+//	первичное := строка | true | false | атрибут | функция "(" [аргументы] ")" | "(" выражение ")"
+//
+// Типы проверяются при компиляции, поэтому ошибки в конфигурации обнаруживаются при запуске.
+
+// Type - тип значения выражения.
+type Type int
+
+const (
+	TypeString Type = iota
+	TypeBool
+)
+
+func (t Type) String() string {
+	if t == TypeBool {
+		return "bool"
+	}
+	return "string"
+}
+
+// env - контекст вычисления выражения.
+type env struct {
+	r        *http.Request
+	clientIP string
+}
+
+// node - скомпилированный узел выражения.
+type node struct {
+	typ      Type
+	eval     func(*env) any
+	constant bool // Значение не зависит от запроса (литерал).
+}
+
+// Expr - скомпилированное выражение.
+type Expr struct {
+	src  string
+	root node
+}
+
+// attributes - атрибуты запроса, доступные в выражениях.
+var attributes = map[string]func(*env) any{
+	"method":    func(e *env) any { return e.r.Method },
+	"path":      func(e *env) any { return e.r.URL.Path },
+	"query":     func(e *env) any { return e.r.URL.RawQuery },
+	"host":      func(e *env) any { return e.r.Host },
+	"client_ip": func(e *env) any { return e.clientIP },
+	"scheme": func(e *env) any {
+		if e.r.TLS != nil {
+			return "https"
+		}
+		return "http"
+	},
+}
+
+// function - функция языка выражений: типы аргументов, тип результата и реализация.
+type function struct {
+	args     []Type
+	variadic bool // Последний тип аргумента может повторяться (не менее одного раза).
+	result   Type
+	call     func(e *env, args []node) any
+}
+
+func strArg(e *env, n node) string { return n.eval(e).(string) }
+
+var functions = map[string]function{
+	"header": {args: []Type{TypeString}, result: TypeString, call: func(e *env, a []node) any {
+		return e.r.Header.Get(strArg(e, a[0]))
+	}},
+	"query_param": {args: []Type{TypeString}, result: TypeString, call: func(e *env, a []node) any {
+		return e.r.URL.Query().Get(strArg(e, a[0]))
+	}},
+	"cookie": {args: []Type{TypeString}, result: TypeString, call: func(e *env, a []node) any {
+		if c, err := e.r.Cookie(strArg(e, a[0])); err == nil {
+			return c.Value
+		}
+		return ""
+	}},
+	"starts_with": {args: []Type{TypeString, TypeString}, result: TypeBool, call: func(e *env, a []node) any {
+		return strings.HasPrefix(strArg(e, a[0]), strArg(e, a[1]))
+	}},
+	"ends_with": {args: []Type{TypeString, TypeString}, result: TypeBool, call: func(e *env, a []node) any {
+		return strings.HasSuffix(strArg(e, a[0]), strArg(e, a[1]))
+	}},
+	"contains": {args: []Type{TypeString, TypeString}, result: TypeBool, call: func(e *env, a []node) any {
+		return strings.Contains(strArg(e, a[0]), strArg(e, a[1]))
+	}},
+	"lower": {args: []Type{TypeString}, result: TypeString, call: func(e *env, a []node) any {
+		return strings.ToLower(strArg(e, a[0]))
+	}},
+	"upper": {args: []Type{TypeString}, result: TypeString, call: func(e *env, a []node) any {
+		return strings.ToUpper(strArg(e, a[0]))
+	}},
+	// coalesce возвращает первый непустой аргумент (например, ключ API или адрес клиента).
+	"coalesce": {args: []Type{TypeString}, variadic: true, result: TypeString, call: func(e *env, a []node) any {
+		for _, n := range a {
+			if s := strArg(e, n); s != "" {
+				return s
+			}
+		}
+		return ""
+	}},
+	// matches реализуется отдельно (см. compileMatches): шаблон компилируется один раз.
+}
+
+// Compile компилирует выражение src.
+func Compile(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// CompileBool компилирует выражение src, которое должно возвращать логическое значение.
+func CompileBool(src string) (*Expr, error) {
+	return compileTyped(src, TypeBool)
+}
+
+// CompileString компилирует выражение src, которое должно возвращать строку.
+func CompileString(src string) (*Expr, error) {
+	return compileTyped(src, TypeString)
+}
+
+func compileTyped(src string, typ Type) (*Expr, error) {
+	e, err := Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	if e.root.typ != typ {
+		return nil, fmt.Errorf("expression %q must be %s, got %s", src, typ, e.root.typ)
+	}
+	return e, nil
+}
+
+// Type возвращает тип значения выражения.
+func (x *Expr) Type() Type { return x.root.typ }
+
+// String возвращает исходный текст выражения.
+func (x *Expr) String() string { return x.src }
+
+// EvalBool вычисляет логическое выражение для запроса r.
+func (x *Expr) EvalBool(r *http.Request) bool {
+	v, _ := x.root.eval(newEnv(r)).(bool)
+	return v
+}
+
+// EvalString вычисляет строковое выражение для запроса r.
+func (x *Expr) EvalString(r *http.Request) string {
+	v, _ := x.root.eval(newEnv(r)).(string)
+	return v
+}
+
+// newEnv создает контекст вычисления; адрес клиента берется из RemoteAddr.
+func newEnv(r *http.Request) *env {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return &env{r: r, clientIP: ip}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // Для строк - значение без кавычек.
+	pos  int
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("expression %q: position %d: %s", p.src, tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// lex разбивает исходный текст на лексемы.
+func (p *parser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return p.errorf(token{pos: i}, "unterminated string")
+			}
+			p.tokens = append(p.tokens, token{kind: tokString, text: b.String(), pos: i})
+			i = j + 1
+		case isIdentByte(s[i]) && !('0' <= s[i] && s[i] <= '9'):
+			j := i
+			for j < len(s) && isIdentByte(s[j]) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "&&", "||", "!", "+", "(", ")", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return p.errorf(token{pos: i}, "unexpected character %q", c)
+			}
+			p.tokens = append(p.tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokEOF, text: "end of expression", pos: len(s)})
+	return nil
+}
+
+// isIdentByte сообщает, может ли байт входить в имя атрибута или функции.
+func isIdentByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept пропускает оператор op, если он следующий.
+func (p *parser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		tok := p.peek()
+		return p.errorf(tok, "expected %q, got %q", op, tok.text)
+	}
+	return nil
+}
+
+// parseLogical разбирает цепочку операндов с логическим оператором op.
+func (p *parser) parseLogical(op string, operand func() (node, error)) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		tok := p.peek()
+		if !p.accept(op) {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return node{}, err
+		}
+		if left.typ != TypeBool || right.typ != TypeBool {
+			return node{}, p.errorf(tok, "operator %s requires bool operands", op)
+		}
+		l, r := left.eval, right.eval
+		if op == "&&" {
+			left = node{typ: TypeBool, eval: func(e *env) any { return l(e).(bool) && r(e).(bool) }}
+		} else {
+			left = node{typ: TypeBool, eval: func(e *env) any { return l(e).(bool) || r(e).(bool) }}
+		}
+	}
+}
+
+func (p *parser) parseOr() (node, error) { return p.parseLogical("||", p.parseAnd) }
+
+func (p *parser) parseAnd() (node, error) { return p.parseLogical("&&", p.parseComparison) }
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return node{}, err
+	}
+	tok := p.peek()
+	if !p.accept("==") && !p.accept("!=") {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return node{}, err
+	}
+	if left.typ != right.typ {
+		return node{}, p.errorf(tok, "cannot compare %s with %s", left.typ, right.typ)
+	}
+	l, r := left.eval, right.eval
+	if tok.text == "==" {
+		return node{typ: TypeBool, eval: func(e *env) any { return l(e) == r(e) }}, nil
+	}
+	return node{typ: TypeBool, eval: func(e *env) any { return l(e) != r(e) }}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		tok := p.peek()
+		if !p.accept("+") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return node{}, err
+		}
+		if left.typ != TypeString || right.typ != TypeString {
+			return node{}, p.errorf(tok, "operator + requires string operands")
+		}
+		l, r := left.eval, right.eval
+		left = node{typ: TypeString, eval: func(e *env) any { return l(e).(string) + r(e).(string) }, constant: left.constant && right.constant}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if !p.accept("!") {
+		return p.parsePrimary()
+	}
+	operand, err := p.parseUnary()
+	if err != nil {
+		return node{}, err
+	}
+	if operand.typ != TypeBool {
+		return node{}, p.errorf(tok, "operator ! requires a bool operand")
+	}
+	eval := operand.eval
+	return node{typ: TypeBool, eval: func(e *env) any { return !eval(e).(bool) }}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		s := tok.text
+		return node{typ: TypeString, eval: func(*env) any { return s }, constant: true}, nil
+	case tokOp:
+		if tok.text != "(" {
+			return node{}, p.errorf(tok, "unexpected %q", tok.text)
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return node{}, err
+		}
+		return inner, p.expect(")")
+	case tokIdent:
+		if tok.text == "true" || tok.text == "false" {
+			b := tok.text == "true"
+			return node{typ: TypeBool, eval: func(*env) any { return b }, constant: true}, nil
+		}
+		if !p.accept("(") {
+			attr, ok := attributes[tok.text]
+			if !ok {
+				return node{}, p.errorf(tok, "unknown attribute %q", tok.text)
+			}
+			return node{typ: TypeString, eval: attr}, nil
+		}
+		return p.parseCall(tok)
+	default:
+		return node{}, p.errorf(tok, "unexpected end of expression")
+	}
+}
+
+// parseCall разбирает аргументы вызова функции name (открывающая скобка уже пропущена).
+func (p *parser) parseCall(name token) (node, error) {
+	var args []node
+	if !p.accept(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return node{}, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return node{}, err
+			}
+		}
+	}
+	if name.text == "matches" {
+		return p.compileMatches(name, args)
+	}
+
+	fn, ok := functions[name.text]
+	if !ok {
+		return node{}, p.errorf(name, "unknown function %q", name.text)
+	}
+	if len(args) < len(fn.args) || (!fn.variadic && len(args) != len(fn.args)) {
+		return node{}, p.errorf(name, "%s expects %d argument(s), got %d", name.text, len(fn.args), len(args))
+	}
+	for i, arg := range args {
+		want := fn.args[min(i, len(fn.args)-1)]
+		if arg.typ != want {
+			return node{}, p.errorf(name, "argument %d of %s must be %s", i+1, name.text, want)
+		}
+	}
+	call := fn.call
+	return node{typ: fn.result, eval: func(e *env) any { return call(e, args) }}, nil
+}
+
+// compileMatches компилирует matches(строка, "регулярное выражение"); шаблон должен быть литералом.
+func (p *parser) compileMatches(name token, args []node) (node, error) {
+	if len(args) != 2 || args[0].typ != TypeString || args[1].typ != TypeString {
+		return node{}, p.errorf(name, "matches expects (string, pattern)")
+	}
+	if !args[1].constant {
+		return node{}, p.errorf(name, "pattern of matches must be a string literal")
+	}
+	re, err := regexp.Compile(args[1].eval(nil).(string))
+	if err != nil {
+		return node{}, p.errorf(name, "invalid pattern: %v", err)
+	}
+	subject := args[0].eval
+	return node{typ: TypeBool, eval: func(e *env) any { return re.MatchString(subject(e).(string)) }}, nil
+}
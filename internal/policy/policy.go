@@ -0,0 +1,154 @@
+// Package policy реализует правила обработки запросов, заданные выражениями в конфигурации:
+// маршрутизацию на выбранные бэкенды, изменение заголовков, отклонение запросов и ключи
+// rate limiting (см. Compile).
+package policy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"cloud/load_balancer/internal/balancer"
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+var ruleMatchesTotal = metrics.NewCounterVec("lb_policy_rule_matches_total",
+	"Requests matched by policy rules, by rule.", "rule")
+
+// RuleSpec описывает правило политики. Все выражения компилируются в NewEngine.
+type RuleSpec struct {
+	Name string
+	// Логическое выражение условия ("" - любой запрос).
+	When string
+	// Бэкенды, среди которых выбирается бэкенд для запроса (пусто - все бэкенды пула).
+	Backends []string
+	// Заголовки запроса к бэкенду: имя -> строковое выражение значения.
+	SetHeaders map[string]string
+	// Заголовки, удаляемые из запроса до передачи бэкенду.
+	RemoveHeaders []string
+	// Статус ответа для отклонения запроса (0 - запрос не отклоняется).
+	RejectStatus int
+}
+
+type header struct {
+	name  string
+	value *Expr
+}
+
+type rule struct {
+	name          string
+	when          *Expr // nil - любой запрос.
+	backends      []string
+	setHeaders    []header
+	removeHeaders []string
+	rejectStatus  int
+}
+
+// Engine применяет к запросу первое подходящее правило.
+type Engine struct {
+	rules []rule
+}
+
+// NewEngine компилирует правила в порядке проверки. Возвращает ошибку с именем правила,
+// если выражение некорректно или статус отклонения не является кодом ошибки 4xx/5xx.
+func NewEngine(specs []RuleSpec) (*Engine, error) {
+	e := &Engine{rules: make([]rule, 0, len(specs))}
+	for i, spec := range specs {
+		name := spec.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		compiled := rule{name: name, backends: spec.Backends, removeHeaders: spec.RemoveHeaders, rejectStatus: spec.RejectStatus}
+		if spec.When != "" {
+			when, err := CompileBool(spec.When)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: when: %w", name, err)
+			}
+			compiled.when = when
+		}
+		// Порядок заголовков не важен, но сортировка делает поведение воспроизводимым.
+		names := make([]string, 0, len(spec.SetHeaders))
+		for h := range spec.SetHeaders {
+			names = append(names, h)
+		}
+		sort.Strings(names)
+		for _, h := range names {
+			value, err := CompileString(spec.SetHeaders[h])
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: set_headers %s: %w", name, h, err)
+			}
+			compiled.setHeaders = append(compiled.setHeaders, header{name: h, value: value})
+		}
+		if spec.RejectStatus != 0 && (spec.RejectStatus < 400 || spec.RejectStatus > 599) {
+			return nil, fmt.Errorf("policy %s: reject_status must be between 400 and 599", name)
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	return e, nil
+}
+
+// Backends возвращает имена бэкендов, на которые ссылаются правила.
+func (e *Engine) Backends() []string {
+	var names []string
+	for _, r := range e.rules {
+		names = append(names, r.backends...)
+	}
+	return names
+}
+
+// Middleware применяет к запросу первое подходящее правило: отклоняет запрос с RejectStatus
+// или изменяет заголовки и ограничивает выбор бэкенда (см. balancer.WithRoute).
+// Значения заголовков вычисляются по исходному запросу до удаления заголовков.
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range e.rules {
+			if rule.when != nil && !rule.when.EvalBool(r) {
+				continue
+			}
+			ruleMatchesTotal.With(rule.name).Inc()
+			if rule.rejectStatus != 0 {
+				log.Printf("INFO: Request %s %s rejected by policy %s with status %d", r.Method, r.URL.Path, rule.name, rule.rejectStatus)
+				httputil_pkg.RespondWithError(w, rule.rejectStatus, http.StatusText(rule.rejectStatus))
+				return
+			}
+			r = rule.apply(r)
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apply возвращает копию запроса с изменениями правила.
+func (rule rule) apply(r *http.Request) *http.Request {
+	if len(rule.setHeaders) == 0 && len(rule.removeHeaders) == 0 && len(rule.backends) == 0 {
+		return r
+	}
+	values := make([]string, len(rule.setHeaders))
+	for i, h := range rule.setHeaders {
+		values[i] = h.value.EvalString(r)
+	}
+	r = r.Clone(r.Context())
+	for _, h := range rule.removeHeaders {
+		r.Header.Del(h)
+	}
+	for i, h := range rule.setHeaders {
+		r.Header.Set(h.name, values[i])
+	}
+	if len(rule.backends) > 0 {
+		log.Printf("DEBUG: Request %s %s routed by policy %s to %v", r.Method, r.URL.Path, rule.name, rule.backends)
+		r = balancer.WithRoute(r, rule.backends)
+	}
+	return r
+}
+
+// KeyFunc возвращает функцию ключа rate limiting по строковому выражению src. Если значение
+// выражения пустое, используется ключ по умолчанию (адрес клиента).
+func KeyFunc(src string) (func(*http.Request) string, error) {
+	key, err := CompileString(src)
+	if err != nil {
+		return nil, err
+	}
+	return key.EvalString, nil
+}
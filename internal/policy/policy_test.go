@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile_Eval(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "http://api.example.com/api/v2/items?tenant=acme", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set("X-API-Key", "k-1")
+	r.AddCookie(&http.Cookie{Name: "beta", Value: "1"})
+
+	for src, want := range map[string]bool{
+		`method == "POST" && starts_with(path, "/api/")`:               true,
+		`!(method == "GET") || false`:                                  true,
+		`query_param("tenant") == 'acme' && cookie("beta") == "1"`:     true,
+		`matches(path, "^/api/v[0-9]+/") && host == "api.example.com"`: true,
+		`contains(lower(header("x-api-key")), "K")`:                    false,
+		`ends_with(path, "items") && header("Missing") == ""`:          true,
+		`client_ip + ":" + scheme == "203.0.113.7:http"`:               true,
+	} {
+		expr, err := CompileBool(src)
+		require.NoError(t, err, src)
+		assert.Equal(t, want, expr.EvalBool(r), src)
+	}
+
+	key, err := CompileString(`coalesce(header("X-Tenant"), header("X-API-Key"), client_ip)`)
+	require.NoError(t, err)
+	assert.Equal(t, "k-1", key.EvalString(r))
+	r.Header.Del("X-API-Key")
+	assert.Equal(t, "203.0.113.7", key.EvalString(r))
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, src := range []string{
+		`path ==`,
+		`method == "GET`,
+		`unknown == "x"`,
+		`header()`,
+		`starts_with(path)`,
+		`method == true`,
+		`!path`,
+		`path + true`,
+		`matches(path, header("X-Re"))`,
+		`matches(path, "(")`,
+		`path == "a" "b"`,
+		`method # "GET"`,
+	} {
+		_, err := Compile(src)
+		assert.Error(t, err, src)
+	}
+	_, err := CompileBool(`path`)
+	assert.Error(t, err, "Type of a condition must be bool")
+	_, err = CompileString(`path == "/"`)
+	assert.Error(t, err, "Type of a key must be string")
+}
+
+func TestEngine_Middleware(t *testing.T) {
+	engine, err := NewEngine([]RuleSpec{
+		{Name: "scanners", When: `matches(header("User-Agent"), "(?i)sqlmap")`, RejectStatus: http.StatusForbidden},
+		{
+			Name:          "beta",
+			When:          `cookie("beta") == "1"`,
+			Backends:      []string{"app-2"},
+			SetHeaders:    map[string]string{"X-Route": `"beta"`, "X-Debug-Copy": `header("X-Debug")`},
+			RemoveHeaders: []string{"X-Debug"},
+		},
+		{Name: "default", SetHeaders: map[string]string{"X-Route": `"default"`}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app-2"}, engine.Backends())
+
+	var upstream *http.Request
+	handler := engine.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { upstream = r }))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "SQLMap/1.7")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "beta", Value: "1"})
+	req.Header.Set("X-Debug", "on")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, upstream)
+	assert.Equal(t, "beta", upstream.Header.Get("X-Route"))
+	assert.Equal(t, "on", upstream.Header.Get("X-Debug-Copy"), "Values are computed before headers are removed")
+	assert.Empty(t, upstream.Header.Get("X-Debug"))
+	assert.Equal(t, "on", req.Header.Get("X-Debug"), "Original request is not modified")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "default", upstream.Header.Get("X-Route"), "First matching rule only")
+
+	_, err = NewEngine([]RuleSpec{{Name: "bad", When: `path`}})
+	assert.ErrorContains(t, err, "policy bad")
+	_, err = NewEngine([]RuleSpec{{RejectStatus: 200}})
+	assert.Error(t, err)
+}
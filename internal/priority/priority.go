@@ -0,0 +1,167 @@
+// Package priority классифицирует входящие запросы по классам приоритета (по заголовку,
+// пути или клиенту). При перегрузке или нехватке бэкендов запросы низкого приоритета
+// отклоняются первыми, а высокоприоритетный трафик продолжает обслуживаться.
+package priority
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+// Class - класс приоритета запроса. Большее значение означает более высокий приоритет.
+type Class int
+
+const (
+	Low Class = iota
+	Normal
+	High
+)
+
+var (
+	requestsByClassTotal = metrics.NewCounterVec("lb_priority_requests_total",
+		"Requests classified by priority class.", "class")
+	shortageRejectsTotal = metrics.NewCounterVec("lb_priority_shortage_rejects_total",
+		"Low-priority requests rejected because of backend shortage.")
+)
+
+// String возвращает имя класса, используемое в конфигурации, метриках и логах.
+func (c Class) String() string {
+	switch c {
+	case Low:
+		return "low"
+	case High:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParseClass разбирает имя класса (low, normal, high).
+func ParseClass(name string) (Class, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "low":
+		return Low, nil
+	case "normal", "":
+		return Normal, nil
+	case "high":
+		return High, nil
+	}
+	return Normal, fmt.Errorf("unknown priority class '%s' (expected low, normal or high)", name)
+}
+
+// Rule относит запрос к классу Class, если выполнены все заданные условия.
+// Пустое условие не проверяется; хотя бы одно условие должно быть задано.
+type Rule struct {
+	Class       Class
+	Header      string   // Имя заголовка, который должен присутствовать в запросе.
+	HeaderValue string   // Требуемое значение заголовка ("" - любое).
+	PathPrefix  string   // Префикс пути запроса.
+	Clients     []string // IP-адреса клиентов.
+}
+
+// matches проверяет, подходит ли запрос под правило.
+func (rule Rule) matches(r *http.Request, client string) bool {
+	if rule.Header != "" {
+		value := r.Header.Get(rule.Header)
+		if value == "" || (rule.HeaderValue != "" && !strings.EqualFold(value, rule.HeaderValue)) {
+			return false
+		}
+	}
+	if rule.PathPrefix != "" && !httputil_pkg.PathHasPrefix(r.URL.Path, rule.PathPrefix) {
+		return false
+	}
+	if len(rule.Clients) > 0 {
+		found := false
+		for _, c := range rule.Clients {
+			if c == client {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Classifier определяет класс запроса по первому подходящему правилу.
+type Classifier struct {
+	rules        []Rule
+	defaultClass Class
+}
+
+// NewClassifier создает Classifier с правилами в порядке проверки и классом по умолчанию
+// для запросов, не подошедших ни под одно правило.
+// Возвращает ошибку, если в правиле не задано ни одного условия.
+func NewClassifier(rules []Rule, defaultClass Class) (*Classifier, error) {
+	for i, rule := range rules {
+		if rule.Header == "" && rule.PathPrefix == "" && len(rule.Clients) == 0 {
+			return nil, fmt.Errorf("priority rule %d has no conditions", i)
+		}
+	}
+	return &Classifier{rules: rules, defaultClass: defaultClass}, nil
+}
+
+// Classify возвращает класс приоритета запроса.
+func (c *Classifier) Classify(r *http.Request) Class {
+	client := clientIP(r)
+	for _, rule := range c.rules {
+		if rule.matches(r, client) {
+			return rule.Class
+		}
+	}
+	return c.defaultClass
+}
+
+// Middleware сохраняет класс приоритета запроса в контексте (см. FromContext).
+func (c *Classifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := c.Classify(r)
+		requestsByClassTotal.With(class.String()).Inc()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, class)))
+	})
+}
+
+type ctxKey struct{}
+
+// FromContext возвращает класс приоритета, определенный Classifier.Middleware.
+// Второе значение равно false, если запрос не классифицировался.
+func FromContext(ctx context.Context) (Class, bool) {
+	class, ok := ctx.Value(ctxKey{}).(Class)
+	return class, ok
+}
+
+// ShortageGuard возвращает middleware, отклоняющее запросы класса Low с кодом 503,
+// пока доля доступных бэкендов (значение available, от 0 до 1) ниже minPercent процентов.
+// Так оставшиеся бэкенды обслуживают в первую очередь более приоритетный трафик.
+func ShortageGuard(available func() float64, minPercent float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if class, ok := FromContext(r.Context()); ok && class == Low && available()*100 < minPercent {
+				shortageRejectsTotal.With().Inc()
+				log.Printf("WARN: Rejecting low-priority request to %s: backend shortage", r.URL.Path)
+				w.Header().Set("Retry-After", "1")
+				httputil_pkg.RespondWithError(w, http.StatusServiceUnavailable, "Service degraded, low-priority requests are rejected")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP возвращает IP-адрес клиента без порта.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,60 @@
+package priority
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClassifier_Classify проверяет выбор класса по первому подходящему правилу.
+func TestClassifier_Classify(t *testing.T) {
+	c, err := NewClassifier([]Rule{
+		{Class: High, Header: "X-Priority", HeaderValue: "high"},
+		{Class: High, PathPrefix: "/checkout", Clients: []string{"10.0.0.1"}},
+		{Class: Low, PathPrefix: "/reports"},
+	}, Normal)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/reports/daily", nil)
+	assert.Equal(t, Low, c.Classify(req))
+
+	req.Header.Set("X-Priority", "HIGH")
+	assert.Equal(t, High, c.Classify(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/checkout", nil)
+	req.RemoteAddr = "10.0.0.1:4000"
+	assert.Equal(t, High, c.Classify(req))
+
+	req.RemoteAddr = "10.0.0.2:4000"
+	assert.Equal(t, Normal, c.Classify(req), "all rule conditions must match")
+}
+
+// TestShortageGuard проверяет отклонение запросов класса low при нехватке бэкендов.
+func TestShortageGuard(t *testing.T) {
+	c, err := NewClassifier([]Rule{{Class: Low, PathPrefix: "/batch"}}, Normal)
+	require.NoError(t, err)
+
+	share := 0.25
+	handler := c.Middleware(ShortageGuard(func() float64 { return share }, 50)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })))
+
+	serve := func(path string) int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/batch/job"))
+	assert.Equal(t, http.StatusOK, serve("/api"))
+
+	share = 1
+	assert.Equal(t, http.StatusOK, serve("/batch/job"))
+}
+
+// TestNewClassifier_RuleWithoutConditions проверяет отказ для правила без условий.
+func TestNewClassifier_RuleWithoutConditions(t *testing.T) {
+	_, err := NewClassifier([]Rule{{Class: High}}, Normal)
+	assert.Error(t, err)
+}
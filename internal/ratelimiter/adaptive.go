@@ -0,0 +1,167 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var (
+	adaptiveThrottledTotal = metrics.NewCounterVec("lb_ratelimit_adaptive_throttled_total",
+		"Requests rejected by adaptive per-client throttling.")
+	adaptiveThrottledClients = metrics.NewGaugeVec("lb_ratelimit_adaptive_throttled_clients",
+		"Clients whose effective rate is currently reduced by adaptive throttling.")
+)
+
+// AdaptivePolicy задает адаптивное ограничение клиентов по ответам бэкендов: каждый ответ
+// 429 или 503 на запрос клиента умножает его долю пропускаемых запросов на Decrease (но не
+// ниже MinFactor), а каждый другой ответ увеличивает ее на Recovery до полной. Запрос,
+// разрешенный бакетом клиента, пропускается с вероятностью, равной этой доле, поэтому
+// эффективный лимит клиента снижается, пока бэкенды перегружены его запросами.
+type AdaptivePolicy struct {
+	Enabled   bool
+	MinFactor float64 // Минимальная доля пропускаемых запросов (0..1].
+	Decrease  float64 // Множитель доли при ответе 429/503 (0..1).
+	Recovery  float64 // Прибавка к доле при успешном ответе (0..1].
+}
+
+// adaptiveThrottle хранит доли пропускаемых запросов клиентов с пониженным лимитом.
+type adaptiveThrottle struct {
+	mu      sync.Mutex
+	policy  AdaptivePolicy
+	clients map[string]*throttleState
+}
+
+type throttleState struct {
+	factor    float64
+	updatedAt time.Time
+}
+
+// SetAdaptivePolicy включает или изменяет адаптивное ограничение клиентов (см. AdaptivePolicy).
+// Должен вызываться до начала обработки запросов.
+func (l *Limiter) SetAdaptivePolicy(policy AdaptivePolicy) error {
+	if policy.Enabled {
+		if policy.MinFactor <= 0 || policy.MinFactor > 1 {
+			return fmt.Errorf("adaptive min factor must be in (0, 1]")
+		}
+		if policy.Decrease <= 0 || policy.Decrease >= 1 {
+			return fmt.Errorf("adaptive decrease must be in (0, 1)")
+		}
+		if policy.Recovery <= 0 || policy.Recovery > 1 {
+			return fmt.Errorf("adaptive recovery must be in (0, 1]")
+		}
+	}
+	l.adaptive.mu.Lock()
+	defer l.adaptive.mu.Unlock()
+	l.adaptive.policy = policy
+	l.adaptive.clients = make(map[string]*throttleState)
+	adaptiveThrottledClients.With().Set(0)
+	if policy.Enabled {
+		log.Printf("INFO: Adaptive client throttling enabled: decrease x%.2f on 429/503, recovery +%.2f per success, min factor %.2f",
+			policy.Decrease, policy.Recovery, policy.MinFactor)
+	}
+	return nil
+}
+
+// AdaptiveEnabled сообщает, включено ли адаптивное ограничение клиентов.
+func (l *Limiter) AdaptiveEnabled() bool {
+	l.adaptive.mu.Lock()
+	defer l.adaptive.mu.Unlock()
+	return l.adaptive.policy.Enabled
+}
+
+// ThrottleFactor возвращает текущую долю пропускаемых запросов клиента (1 - без ограничения).
+func (l *Limiter) ThrottleFactor(clientID string) float64 {
+	l.adaptive.mu.Lock()
+	defer l.adaptive.mu.Unlock()
+	if state, ok := l.adaptive.clients[clientID]; ok {
+		return state.factor
+	}
+	return 1
+}
+
+type upstreamStatusKey struct{}
+
+// TrackUpstreamStatus возвращает запрос, для которого запоминается статус последнего ответа
+// бэкенда (см. RecordUpstreamStatus), и функцию, возвращающую этот статус (0 - бэкенд
+// не отвечал, например ответ сформирован самим балансировщиком).
+func TrackUpstreamStatus(r *http.Request) (*http.Request, func() int) {
+	status := new(atomic.Int64)
+	r = r.WithContext(context.WithValue(r.Context(), upstreamStatusKey{}, status))
+	return r, func() int { return int(status.Load()) }
+}
+
+// RecordUpstreamStatus запоминает статус ответа бэкенда на запрос r, если запрос
+// отслеживается (см. TrackUpstreamStatus). Вызывается прокси для каждого ответа бэкенда.
+func RecordUpstreamStatus(r *http.Request, status int) {
+	if tracked, ok := r.Context().Value(upstreamStatusKey{}).(*atomic.Int64); ok {
+		tracked.Store(int64(status))
+	}
+}
+
+// RecordResponse учитывает статус ответа бэкенда на запрос клиента в его доле пропускаемых
+// запросов. Без включенного адаптивного ограничения ничего не делает.
+func (l *Limiter) RecordResponse(clientID string, status int) {
+	t := &l.adaptive
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.policy.Enabled {
+		return
+	}
+	state, ok := t.clients[clientID]
+	overloaded := status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+	switch {
+	case overloaded && !ok:
+		state = &throttleState{factor: 1}
+		t.clients[clientID] = state
+		log.Printf("WARN: Backends return %d for client %s. Reducing its effective rate.", status, clientID)
+	case !ok:
+		return
+	}
+	if overloaded {
+		state.factor = max(state.factor*t.policy.Decrease, t.policy.MinFactor)
+	} else {
+		state.factor += t.policy.Recovery
+	}
+	state.updatedAt = l.store.clock.Now()
+	if state.factor >= 1 {
+		delete(t.clients, clientID)
+		log.Printf("INFO: Client %s recovered from adaptive throttling.", clientID)
+	}
+	adaptiveThrottledClients.With().Set(float64(len(t.clients)))
+}
+
+// admit сообщает, пропускается ли разрешенный бакетом запрос клиента с учетом его доли.
+func (t *adaptiveThrottle) admit(clientID string) bool {
+	t.mu.Lock()
+	state, ok := t.clients[clientID]
+	factor := 1.0
+	if ok {
+		factor = state.factor
+	}
+	t.mu.Unlock()
+	if factor >= 1 || rand.Float64() < factor {
+		return true
+	}
+	adaptiveThrottledTotal.With().Inc()
+	return false
+}
+
+// cleanup снимает ограничение с клиентов, от которых не было ответов дольше threshold.
+func (t *adaptiveThrottle) cleanup(now time.Time, threshold time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for clientID, state := range t.clients {
+		if now.Sub(state.updatedAt) > threshold {
+			delete(t.clients, clientID)
+		}
+	}
+	adaptiveThrottledClients.With().Set(float64(len(t.clients)))
+}
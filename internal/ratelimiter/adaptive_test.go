@@ -0,0 +1,79 @@
+package ratelimiter_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLimiter_AdaptiveThrottle проверяет снижение доли пропускаемых запросов клиента
+// при ответах 429/503 и ее восстановление при успешных ответах.
+func TestLimiter_AdaptiveThrottle(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 1000, 1, time.Minute)
+	require.NoError(t, limiter.SetAdaptivePolicy(rl.AdaptivePolicy{
+		Enabled: true, MinFactor: 0.1, Decrease: 0.5, Recovery: 0.25,
+	}))
+	assert.True(t, limiter.AdaptiveEnabled())
+
+	limiter.RecordResponse("client", http.StatusOK)
+	assert.Equal(t, 1.0, limiter.ThrottleFactor("client"), "Successful responses don't throttle")
+
+	limiter.RecordResponse("client", http.StatusServiceUnavailable)
+	assert.Equal(t, 0.5, limiter.ThrottleFactor("client"))
+	for range 5 {
+		limiter.RecordResponse("client", http.StatusTooManyRequests)
+	}
+	assert.Equal(t, 0.1, limiter.ThrottleFactor("client"), "Factor is bounded by MinFactor")
+	assert.Equal(t, 1.0, limiter.ThrottleFactor("other"), "Throttling is per client")
+
+	// При доле 0.1 пропускается примерно каждый десятый разрешенный бакетом запрос.
+	admitted := 0
+	for range 500 {
+		decision := limiter.Check("client")
+		if decision.Allowed {
+			admitted++
+		} else {
+			assert.True(t, decision.Throttled)
+		}
+	}
+	assert.InDelta(t, 50, admitted, 35)
+
+	for range 4 {
+		limiter.RecordResponse("client", http.StatusOK)
+	}
+	assert.Equal(t, 1.0, limiter.ThrottleFactor("client"), "Factor recovers after successful responses")
+	assert.True(t, limiter.Check("client").Allowed)
+}
+
+// TestLimiter_AdaptiveThrottleDisabled проверяет, что без включенной политики ответы не учитываются.
+func TestLimiter_AdaptiveThrottleDisabled(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 10, 1, time.Minute)
+	assert.False(t, limiter.AdaptiveEnabled())
+
+	limiter.RecordResponse("client", http.StatusServiceUnavailable)
+	assert.Equal(t, 1.0, limiter.ThrottleFactor("client"))
+	assert.True(t, limiter.Check("client").Allowed)
+}
+
+// TestLimiter_SetAdaptivePolicyValidation проверяет валидацию параметров политики.
+func TestLimiter_SetAdaptivePolicyValidation(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 10, 1, time.Minute)
+	valid := rl.AdaptivePolicy{Enabled: true, MinFactor: 0.1, Decrease: 0.5, Recovery: 0.05}
+	require.NoError(t, limiter.SetAdaptivePolicy(valid))
+
+	invalid := []rl.AdaptivePolicy{
+		{Enabled: true, MinFactor: 0, Decrease: 0.5, Recovery: 0.05},
+		{Enabled: true, MinFactor: 0.1, Decrease: 1, Recovery: 0.05},
+		{Enabled: true, MinFactor: 0.1, Decrease: 0.5, Recovery: 0},
+	}
+	for _, policy := range invalid {
+		assert.Error(t, limiter.SetAdaptivePolicy(policy), "%+v", policy)
+	}
+	assert.NoError(t, limiter.SetAdaptivePolicy(rl.AdaptivePolicy{}), "Disabled policy is not validated")
+}
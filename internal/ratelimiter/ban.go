@@ -0,0 +1,178 @@
+package ratelimiter
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var (
+	bansTotal = metrics.NewCounterVec("lb_ratelimit_bans_total",
+		"Clients banned after repeatedly exceeding their rate limit.")
+	bannedClients = metrics.NewGaugeVec("lb_ratelimit_banned_clients",
+		"Clients currently banned by the rate limiter.")
+)
+
+// BanPolicy задает действие "бан": если клиент превысил лимит Violations раз
+// за окно Window, все его запросы отклоняются в течение Duration.
+type BanPolicy struct {
+	Enabled    bool
+	Violations int
+	Window     time.Duration
+	Duration   time.Duration
+}
+
+// Ban описывает активный бан клиента.
+type Ban struct {
+	ClientID string    `json:"client_id"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+}
+
+// Decision - результат проверки запроса лимитером.
+type Decision struct {
+	Allowed     bool
+	Banned      bool          // Запрос отклонен из-за бана клиента.
+	BannedUntil time.Time     // Время окончания бана (если Banned).
+	Delay       time.Duration // Искусственная задержка перед обработкой (tarpit).
+	// Запрос отклонен, так как исчерпан общий лимит тенанта (см. CheckTenant).
+	TenantLimited bool
+	// Запрос отклонен адаптивным ограничением клиента (см. SetAdaptivePolicy).
+	Throttled bool
+	// Имя правила лимита по атрибутам запроса, по которому проверен запрос ("" - основной лимит).
+	Rule string
+}
+
+// banList хранит нарушения лимита и активные баны клиентов.
+type banList struct {
+	mu         sync.Mutex
+	policy     BanPolicy
+	violations map[string][]time.Time // Моменты превышения лимита в пределах окна.
+	bans       map[string]Ban
+}
+
+func newBanList() *banList {
+	return &banList{violations: make(map[string][]time.Time), bans: make(map[string]Ban)}
+}
+
+// banned возвращает активный бан клиента; истекшие баны удаляются.
+func (b *banList) banned(clientID string, now time.Time) (Ban, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ban, ok := b.bans[clientID]
+	if !ok {
+		return Ban{}, false
+	}
+	if !now.Before(ban.Until) {
+		delete(b.bans, clientID)
+		bannedClients.With().Set(float64(len(b.bans)))
+		return Ban{}, false
+	}
+	return ban, true
+}
+
+// recordViolation учитывает превышение лимита и банит клиента при достижении порога.
+func (b *banList) recordViolation(clientID string, now time.Time) (Ban, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.policy.Enabled {
+		return Ban{}, false
+	}
+
+	recent := trimBefore(b.violations[clientID], now.Add(-b.policy.Window))
+	recent = append(recent, now)
+	if len(recent) < b.policy.Violations {
+		b.violations[clientID] = recent
+		return Ban{}, false
+	}
+
+	delete(b.violations, clientID)
+	ban := Ban{ClientID: clientID, Since: now, Until: now.Add(b.policy.Duration)}
+	b.bans[clientID] = ban
+	bansTotal.With().Inc()
+	bannedClients.With().Set(float64(len(b.bans)))
+	log.Printf("WARN: Client %s banned until %s after %d rate limit violations within %v",
+		clientID, ban.Until.Format(time.RFC3339), b.policy.Violations, b.policy.Window)
+	return ban, true
+}
+
+// cleanup удаляет истекшие баны и устаревшие нарушения.
+func (b *banList) cleanup(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, ban := range b.bans {
+		if !now.Before(ban.Until) {
+			delete(b.bans, id)
+		}
+	}
+	for id, v := range b.violations {
+		if recent := trimBefore(v, now.Add(-b.policy.Window)); len(recent) == 0 {
+			delete(b.violations, id)
+		} else {
+			b.violations[id] = recent
+		}
+	}
+	bannedClients.With().Set(float64(len(b.bans)))
+}
+
+func trimBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// SetBanPolicy включает или изменяет действие "бан". Активные баны сохраняются.
+func (l *Limiter) SetBanPolicy(policy BanPolicy) {
+	l.bans.mu.Lock()
+	defer l.bans.mu.Unlock()
+	l.bans.policy = policy
+	if policy.Enabled {
+		log.Printf("INFO: Rate limiter ban enabled: %d violations within %v -> ban for %v", policy.Violations, policy.Window, policy.Duration)
+	}
+}
+
+// Bans возвращает список активных банов, упорядоченный по времени окончания.
+func (l *Limiter) Bans() []Ban {
+	now := l.store.clock.Now()
+	l.bans.mu.Lock()
+	defer l.bans.mu.Unlock()
+	result := make([]Ban, 0, len(l.bans.bans))
+	for _, ban := range l.bans.bans {
+		if now.Before(ban.Until) {
+			result = append(result, ban)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Until.Before(result[j].Until) })
+	return result
+}
+
+// Unban снимает бан с клиента. Возвращает false, если клиент не был забанен.
+func (l *Limiter) Unban(clientID string) bool {
+	l.bans.mu.Lock()
+	defer l.bans.mu.Unlock()
+	_, ok := l.bans.bans[clientID]
+	delete(l.bans.bans, clientID)
+	delete(l.bans.violations, clientID)
+	bannedClients.With().Set(float64(len(l.bans.bans)))
+	if ok {
+		log.Printf("INFO: Client %s unbanned", clientID)
+	}
+	return ok
+}
+
+// ClearBans снимает все активные баны и возвращает их количество.
+func (l *Limiter) ClearBans() int {
+	l.bans.mu.Lock()
+	defer l.bans.mu.Unlock()
+	n := len(l.bans.bans)
+	l.bans.bans = make(map[string]Ban)
+	l.bans.violations = make(map[string][]time.Time)
+	bannedClients.With().Set(0)
+	log.Printf("INFO: Cleared %d rate limiter bans", n)
+	return n
+}
@@ -0,0 +1,299 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var (
+	breachesTotal = metrics.NewCounterVec("lb_ratelimit_breaches_total",
+		"Clients reported for exceeding the rejection threshold.")
+	breachWebhooksTotal = metrics.NewCounterVec("lb_ratelimit_breach_webhooks_total",
+		"Rate limit breach webhook deliveries, by result (success, error, dropped).", "result")
+	breachUntrackedTotal = metrics.NewCounterVec("lb_ratelimit_breach_untracked_total",
+		"Rejections not counted for breach detection because max_clients clients are already tracked.")
+)
+
+const (
+	// breachWebhookQueue - число событий, ожидающих отправки; при переполнении события отбрасываются.
+	breachWebhookQueue = 256
+	// DefaultMaxBreachClients - число отслеживаемых клиентов по умолчанию (см. BreachPolicy.MaxClients).
+	DefaultMaxBreachClients = 10000
+)
+
+// BreachPolicy задает уведомления о злоупотреблениях: если запросы клиента отклонены
+// Rejections раз за окно Window, вызывается Notify. Повторное уведомление о том же клиенте
+// отправляется не раньше чем через Debounce.
+type BreachPolicy struct {
+	Enabled    bool
+	Rejections int
+	Window     time.Duration
+	Debounce   time.Duration
+	// Максимальное число клиентов, отказы которых учитываются одновременно (0 -
+	// DefaultMaxBreachClients). Когда оно достигнуто, отказы новых клиентов не учитываются,
+	// пока очистка не удалит клиентов без отказов за окно.
+	MaxClients int
+	// Notify получает событие превышения порога. Вызывается в обработке запроса, поэтому
+	// не должен блокироваться (см. BreachWebhook).
+	Notify func(BreachEvent)
+}
+
+// BreachEvent описывает превышение порога отказов клиентом. Отправляется в теле webhook
+// в формате JSON.
+type BreachEvent struct {
+	ClientID   string    `json:"client_id"`
+	Rejections int       `json:"rejections"`     // Число отказов за окно (порог BreachPolicy.Rejections).
+	Window     float64   `json:"window_seconds"` // Длительность окна.
+	Reason     string    `json:"reason"`         // Причина последнего отказа (rate_limit, rule:<name>, tenant_limit, adaptive_throttle, banned).
+	Time       time.Time `json:"time"`
+}
+
+// breachDetector считает отказы клиентов в пределах окна. Для клиента хранятся моменты
+// не более чем Rejections последних отказов: порог достигнут, если самый ранний из них
+// попадает в окно.
+type breachDetector struct {
+	mu         sync.Mutex
+	policy     BreachPolicy
+	rejections map[string][]time.Time // Моменты последних отказов в пределах окна.
+	notified   map[string]time.Time   // Время последнего уведомления о клиенте.
+	overflow   bool                   // Достигнут MaxClients (предупреждение уже записано в лог).
+}
+
+// SetBreachPolicy включает или изменяет уведомления о превышении порога отказов.
+// Должен вызываться до начала обработки запросов.
+func (l *Limiter) SetBreachPolicy(policy BreachPolicy) error {
+	if policy.Enabled {
+		if policy.Rejections < 1 {
+			return fmt.Errorf("breach rejections must be at least 1")
+		}
+		if policy.Window <= 0 {
+			return fmt.Errorf("breach window must be positive")
+		}
+		if policy.Debounce < 0 {
+			return fmt.Errorf("breach debounce must not be negative")
+		}
+		if policy.Notify == nil {
+			return fmt.Errorf("breach notify function must be set")
+		}
+		if policy.MaxClients < 0 {
+			return fmt.Errorf("breach max clients must not be negative")
+		}
+	}
+	if policy.MaxClients == 0 {
+		policy.MaxClients = DefaultMaxBreachClients
+	}
+	d := &l.breaches
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.policy = policy
+	d.rejections = make(map[string][]time.Time)
+	d.notified = make(map[string]time.Time)
+	d.overflow = false
+	return nil
+}
+
+// rejectReason возвращает причину отказа для BreachEvent.
+func rejectReason(d Decision) string {
+	switch {
+	case d.Banned:
+		return "banned"
+	case d.TenantLimited:
+		return "tenant_limit"
+	case d.Throttled:
+		return "adaptive_throttle"
+	case d.Rule != "":
+		return "rule:" + d.Rule
+	default:
+		return "rate_limit"
+	}
+}
+
+// record учитывает отказ клиенту (разрешенные запросы пропускаются) и уведомляет
+// о превышении порога.
+func (d *breachDetector) record(clientID string, decision Decision, now time.Time) {
+	if decision.Allowed {
+		return
+	}
+	d.mu.Lock()
+	if !d.policy.Enabled {
+		d.mu.Unlock()
+		return
+	}
+	tracked, ok := d.rejections[clientID]
+	if !ok && len(d.rejections) >= d.policy.MaxClients {
+		if !d.overflow {
+			d.overflow = true
+			log.Printf("WARN: Rate limit breach detection tracks %d clients: rejections of new clients are not counted until inactive clients expire", d.policy.MaxClients)
+		}
+		d.mu.Unlock()
+		breachUntrackedTotal.With().Inc()
+		return
+	}
+	recent := trimBefore(tracked, now.Add(-d.policy.Window))
+	if len(recent) >= d.policy.Rejections {
+		// Хранятся только последние Rejections отказов: самый ранний вытесняется.
+		copy(recent, recent[1:])
+		recent = recent[:len(recent)-1]
+	}
+	recent = append(recent, now)
+	d.rejections[clientID] = recent
+	if len(recent) < d.policy.Rejections {
+		d.mu.Unlock()
+		return
+	}
+	if last, ok := d.notified[clientID]; ok && now.Sub(last) < d.policy.Debounce {
+		d.mu.Unlock()
+		return
+	}
+	d.notified[clientID] = now
+	event := BreachEvent{
+		ClientID:   clientID,
+		Rejections: len(recent),
+		Window:     d.policy.Window.Seconds(),
+		Reason:     rejectReason(decision),
+		Time:       now,
+	}
+	notify := d.policy.Notify
+	d.mu.Unlock()
+
+	breachesTotal.With().Inc()
+	log.Printf("WARN: Client %s exceeded rejection threshold: %d rejections within %v (last reason: %s)",
+		clientID, event.Rejections, d.policy.Window, event.Reason)
+	notify(event)
+}
+
+// cleanup удаляет устаревшие отказы и истекшие отметки уведомлений.
+func (d *breachDetector) cleanup(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, v := range d.rejections {
+		if recent := trimBefore(v, now.Add(-d.policy.Window)); len(recent) == 0 {
+			delete(d.rejections, id)
+		} else {
+			d.rejections[id] = recent
+		}
+	}
+	for id, last := range d.notified {
+		if now.Sub(last) >= d.policy.Debounce {
+			delete(d.notified, id)
+		}
+	}
+	if d.overflow && len(d.rejections) < d.policy.MaxClients {
+		d.overflow = false
+		log.Printf("INFO: Rate limit breach detection tracks fewer than %d clients again", d.policy.MaxClients)
+	}
+}
+
+// BreachWebhook отправляет события BreachEvent POST-запросом с JSON на заданный URL.
+// Отправка выполняется в фоне, чтобы не задерживать обработку запросов; если очередь
+// переполнена (webhook недоступен или медленный), события отбрасываются.
+type BreachWebhook struct {
+	url      string
+	client   *http.Client
+	queue    chan BreachEvent
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewBreachWebhook создает и запускает отправку событий на webhookURL с таймаутом запроса
+// timeout. Для остановки нужно вызвать Stop.
+func NewBreachWebhook(webhookURL string, timeout time.Duration) (*BreachWebhook, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		// URL может содержать секрет, поэтому в ошибку не включается.
+		return nil, errors.New("invalid breach webhook URL: expected http or https URL with a host")
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	w := &BreachWebhook{
+		url:      webhookURL,
+		client:   &http.Client{Timeout: timeout},
+		queue:    make(chan BreachEvent, breachWebhookQueue),
+		stopChan: make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Notify ставит событие в очередь отправки. Реализует BreachPolicy.Notify.
+func (w *BreachWebhook) Notify(event BreachEvent) {
+	select {
+	case w.queue <- event:
+	default:
+		breachWebhooksTotal.With("dropped").Inc()
+		log.Printf("WARN: Breach webhook queue is full. Dropping event for client %s.", event.ClientID)
+	}
+}
+
+// Stop отправляет события, уже поставленные в очередь, и останавливает отправку.
+func (w *BreachWebhook) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *BreachWebhook) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case event := <-w.queue:
+			w.deliver(event)
+		case <-w.stopChan:
+			for {
+				select {
+				case event := <-w.queue:
+					w.deliver(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver отправляет одно событие и учитывает результат в метриках.
+func (w *BreachWebhook) deliver(event BreachEvent) {
+	if err := w.post(event); err != nil {
+		breachWebhooksTotal.With("error").Inc()
+		log.Printf("ERROR: Breach webhook for client %s failed: %v", event.ClientID, err)
+		return
+	}
+	breachWebhooksTotal.With("success").Inc()
+}
+
+func (w *BreachWebhook) post(event BreachEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// *url.Error содержит URL запроса, который может содержать секрет.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package ratelimiter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLimiter_BreachNotify проверяет уведомление о превышении порога отказов
+// и подавление повторных уведомлений в пределах debounce.
+func TestLimiter_BreachNotify(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 1, 0.001, time.Hour)
+	var events []rl.BreachEvent
+	require.NoError(t, limiter.SetBreachPolicy(rl.BreachPolicy{
+		Enabled:    true,
+		Rejections: 3,
+		Window:     time.Minute,
+		Debounce:   10 * time.Minute,
+		Notify:     func(e rl.BreachEvent) { events = append(events, e) },
+	}))
+
+	require.True(t, limiter.Check("client").Allowed)
+	limiter.Check("client")
+	limiter.Check("client")
+	assert.Empty(t, events, "Below threshold")
+
+	// Отказы за пределами окна не учитываются.
+	clock.Advance(2 * time.Minute)
+	limiter.Check("client")
+	limiter.Check("client")
+	assert.Empty(t, events, "Old rejections expire")
+	limiter.Check("client")
+	require.Len(t, events, 1)
+	assert.Equal(t, "client", events[0].ClientID)
+	assert.Equal(t, 3, events[0].Rejections)
+	assert.Equal(t, 60.0, events[0].Window)
+	assert.Equal(t, "rate_limit", events[0].Reason)
+
+	for range 10 {
+		limiter.Check("client")
+	}
+	assert.Len(t, events, 1, "Repeated breaches are debounced")
+
+	clock.Advance(10 * time.Minute)
+	for range 3 {
+		limiter.Check("client")
+	}
+	assert.Len(t, events, 2, "Notified again after debounce")
+}
+
+// TestLimiter_BreachMaxClients проверяет, что отказы клиентов сверх MaxClients не учитываются.
+func TestLimiter_BreachMaxClients(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 1, 0.001, time.Hour)
+	var events []rl.BreachEvent
+	require.NoError(t, limiter.SetBreachPolicy(rl.BreachPolicy{
+		Enabled:    true,
+		Rejections: 2,
+		Window:     time.Minute,
+		Debounce:   time.Hour,
+		MaxClients: 1,
+		Notify:     func(e rl.BreachEvent) { events = append(events, e) },
+	}))
+
+	for _, client := range []string{"first", "second"} {
+		for range 5 {
+			limiter.Check(client)
+		}
+	}
+	require.Len(t, events, 1, "Rejections of clients over the limit are not tracked")
+	assert.Equal(t, "first", events[0].ClientID)
+	assert.Equal(t, 2, events[0].Rejections)
+}
+
+func TestLimiter_SetBreachPolicyValidation(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 1, 1, time.Hour)
+	notify := func(rl.BreachEvent) {}
+	assert.Error(t, limiter.SetBreachPolicy(rl.BreachPolicy{Enabled: true, Rejections: 0, Window: time.Minute, Notify: notify}))
+	assert.Error(t, limiter.SetBreachPolicy(rl.BreachPolicy{Enabled: true, Rejections: 1, Notify: notify}))
+	assert.Error(t, limiter.SetBreachPolicy(rl.BreachPolicy{Enabled: true, Rejections: 1, Window: time.Minute}))
+	assert.Error(t, limiter.SetBreachPolicy(rl.BreachPolicy{Enabled: true, Rejections: 1, Window: time.Minute, MaxClients: -1, Notify: notify}))
+	assert.NoError(t, limiter.SetBreachPolicy(rl.BreachPolicy{}))
+}
+
+func TestBreachWebhook(t *testing.T) {
+	received := make(chan rl.BreachEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var event rl.BreachEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event
+	}))
+	defer server.Close()
+
+	_, err := rl.NewBreachWebhook("ftp://example.com", time.Second)
+	assert.Error(t, err)
+
+	webhook, err := rl.NewBreachWebhook(server.URL, time.Second)
+	require.NoError(t, err)
+	webhook.Notify(rl.BreachEvent{ClientID: "10.0.0.1", Rejections: 5, Reason: "banned"})
+	webhook.Stop()
+
+	select {
+	case event := <-received:
+		assert.Equal(t, "10.0.0.1", event.ClientID)
+		assert.Equal(t, 5, event.Rejections)
+		assert.Equal(t, "banned", event.Reason)
+	default:
+		t.Fatal("Webhook was not delivered before Stop returned")
+	}
+}
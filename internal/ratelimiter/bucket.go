@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
@@ -11,30 +12,52 @@ type Bucket struct {
 	refillRate float64
 	lastRefill time.Time
 	lastAccess time.Time
+	clock      Clock
 	mu         sync.Mutex
 }
 
 // NewBucket создает новый экземпляр Bucket с заданными параметрами.
 // Бакет инициализируется полным количеством токенов.
-// Возвращает nil, если capacity или rate не положительные.
-func NewBucket(capacity int64, rate float64) *Bucket {
-	if capacity <= 0 || rate <= 0 {
-		return nil
+// Возвращает ErrInvalidCapacity или ErrInvalidRate, если capacity или rate не положительные.
+func NewBucket(capacity int64, rate float64) (*Bucket, error) {
+	return NewBucketWithClock(capacity, rate, RealClock)
+}
+
+// NewBucketWithClock создает бакет, использующий указанный источник времени.
+// Если clock равен nil, используется RealClock.
+func NewBucketWithClock(capacity int64, rate float64, clock Clock) (*Bucket, error) {
+	if err := validateLimits(capacity, rate); err != nil {
+		return nil, err
 	}
-	now := time.Now()
+	if clock == nil {
+		clock = RealClock
+	}
+	now := clock.Now()
 	return &Bucket{
 		capacity:   capacity,
 		tokens:     capacity,
 		refillRate: rate,
 		lastRefill: now,
 		lastAccess: now,
+		clock:      clock,
+	}, nil
+}
+
+// validateLimits проверяет параметры бакета и возвращает типизированную ошибку.
+func validateLimits(capacity int64, rate float64) error {
+	if capacity <= 0 {
+		return fmt.Errorf("%w: got %d", ErrInvalidCapacity, capacity)
+	}
+	if rate <= 0 {
+		return fmt.Errorf("%w: got %.2f", ErrInvalidRate, rate)
 	}
+	return nil
 }
 
 // refill вычисляет и добавляет токены в бакет, прошедшие с момента lastRefill.
 // Количество токенов не превышает capacity.
 func (b *Bucket) refill() {
-	now := time.Now()
+	now := b.clock.Now()
 	duration := now.Sub(b.lastRefill)
 	if duration <= 0 {
 		return
@@ -58,13 +81,46 @@ func (b *Bucket) Allow() bool {
 
 	if b.tokens >= 1 {
 		b.tokens--
-		b.lastAccess = time.Now()
+		b.lastAccess = b.clock.Now()
 		return true
 	}
 
 	return false
 }
 
+// AllowWithLevel работает как Allow и дополнительно возвращает долю емкости,
+// оставшуюся после запроса (от 0 до 1). Используется для прогрессивных задержек (tarpit).
+func (b *Bucket) AllowWithLevel() (allowed bool, remaining float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.lastAccess = b.clock.Now()
+		allowed = true
+	}
+	return allowed, float64(b.tokens) / float64(b.capacity)
+}
+
+// level возвращает текущее состояние бакета с учетом пополнения.
+func (b *Bucket) level() BucketLevel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return BucketLevel{Capacity: b.capacity, RefillRate: b.refillRate, Tokens: b.tokens}
+}
+
+// refund возвращает в бакет токен, израсходованный запросом, который в итоге был отклонен.
+func (b *Bucket) refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < b.capacity {
+		b.tokens++
+	}
+}
+
 // IsInactive проверяет, был ли бакет неактивен (не было вызовов Allow) дольше заданного времени.
 // Используется для определения бакетов, которые можно удалить при очистке.
 func (b *Bucket) IsInactive(threshold time.Duration) bool {
@@ -72,5 +128,5 @@ func (b *Bucket) IsInactive(threshold time.Duration) bool {
 	lastAccessTime := b.lastAccess
 	b.mu.Unlock()
 
-	return time.Since(lastAccessTime) > threshold
+	return b.clock.Now().Sub(lastAccessTime) > threshold
 }
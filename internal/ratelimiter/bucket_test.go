@@ -1,19 +1,23 @@
-package ratelimiter
+package ratelimiter_test
 
 import (
+	"errors"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
 )
 
 // TestBucket_AllowBasic проверяет базовую логику потребления токенов.
 func TestBucket_AllowBasic(t *testing.T) {
 	capacity := int64(5)
 	rate := 1.0
-	bucket := NewBucket(capacity, rate)
-	if bucket == nil {
-		t.Fatal("NewBucket returned nil")
+	bucket, err := rl.NewBucket(capacity, rate)
+	if err != nil {
+		t.Fatalf("NewBucket returned error: %v", err)
 	}
 
 	for i := int64(0); i < capacity; i++ {
@@ -31,9 +35,10 @@ func TestBucket_AllowBasic(t *testing.T) {
 func TestBucket_Refill(t *testing.T) {
 	capacity := int64(2)
 	rate := 1.0
-	bucket := NewBucket(capacity, rate)
-	if bucket == nil {
-		t.Fatal("NewBucket returned nil")
+	clock := ratelimitertest.NewFakeClock(time.Now())
+	bucket, err := rl.NewBucketWithClock(capacity, rate, clock)
+	if err != nil {
+		t.Fatalf("NewBucketWithClock returned error: %v", err)
 	}
 
 	if !bucket.Allow() {
@@ -46,7 +51,7 @@ func TestBucket_Refill(t *testing.T) {
 		t.Error("Allow succeeded after consuming all tokens")
 	}
 
-	time.Sleep(1100 * time.Millisecond)
+	clock.Advance(1100 * time.Millisecond)
 
 	if !bucket.Allow() {
 		t.Errorf("Allow() failed after 1.1 second wait, expected 1 token to be refilled")
@@ -56,7 +61,7 @@ func TestBucket_Refill(t *testing.T) {
 		t.Errorf("Allow() succeeded again immediately, expected no more tokens")
 	}
 
-	time.Sleep(2100 * time.Millisecond)
+	clock.Advance(2100 * time.Millisecond)
 
 	if !bucket.Allow() {
 		t.Error("Allow failed on 1st token after long wait")
@@ -74,9 +79,9 @@ func TestBucket_Refill(t *testing.T) {
 func TestBucket_AllowConcurrent(t *testing.T) {
 	capacity := int64(100)
 	rate := 10.0 // Довольно быстрая скорость пополнения
-	bucket := NewBucket(capacity, rate)
-	if bucket == nil {
-		t.Fatal("NewBucket returned nil")
+	bucket, err := rl.NewBucket(capacity, rate)
+	if err != nil {
+		t.Fatalf("NewBucket returned error: %v", err)
 	}
 
 	numGoroutines := 50
@@ -110,3 +115,19 @@ func TestBucket_AllowConcurrent(t *testing.T) {
 	}
 	t.Logf("Concurrent Allow test finished. Successful requests: %d / %d", successfulRequests, totalRequests)
 }
+
+// TestNewBucket_InvalidParams проверяет типизированные ошибки при невалидных параметрах.
+func TestNewBucket_InvalidParams(t *testing.T) {
+	if _, err := rl.NewBucket(0, 1); !errors.Is(err, rl.ErrInvalidCapacity) {
+		t.Errorf("Expected ErrInvalidCapacity, got %v", err)
+	}
+	if _, err := rl.NewBucket(1, 0); !errors.Is(err, rl.ErrInvalidRate) {
+		t.Errorf("Expected ErrInvalidRate, got %v", err)
+	}
+	if _, err := rl.NewBucketStore(-1, 1, nil); !errors.Is(err, rl.ErrInvalidCapacity) {
+		t.Errorf("Expected ErrInvalidCapacity from NewBucketStore, got %v", err)
+	}
+	if _, err := rl.NewLimiter(nil, time.Minute); !errors.Is(err, rl.ErrNilStore) {
+		t.Errorf("Expected ErrNilStore, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimiter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var bypassRequestsTotal = metrics.NewCounterVec("lb_ratelimit_bypass_requests_total",
+	"Requests carrying a rate limit bypass token, by result (accepted, rejected).", "result")
+
+// ErrInvalidBypassToken возвращается, если токен обхода поврежден, подпись не совпадает
+// или срок его действия истек.
+var ErrInvalidBypassToken = errors.New("invalid or expired bypass token")
+
+// BypassPolicy задает обход rate limiting по подписанным токенам: запрос с действительным
+// токеном в заголовке Header не расходует токены бакетов и не ограничивается. Токены выдаются
+// доверенным внутренним задачам (см. IssueBypassToken) и действуют не дольше MaxTTL.
+type BypassPolicy struct {
+	Enabled bool
+	Key     string        // Ключ HMAC-SHA256 для подписи токенов.
+	Header  string        // Заголовок запроса с токеном.
+	MaxTTL  time.Duration // Максимальный срок действия выдаваемого токена.
+}
+
+// BypassToken - выданный токен обхода.
+type BypassToken struct {
+	Token     string    `json:"token"`
+	Subject   string    `json:"subject"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Header    string    `json:"header"`
+}
+
+// bypassTokens подписывает и проверяет токены обхода.
+// Формат токена: base64url(subject) "." unix-время окончания "." base64url(HMAC-SHA256).
+type bypassTokens struct {
+	policy BypassPolicy
+	key    []byte
+}
+
+// SetBypassPolicy включает или изменяет обход rate limiting по токенам (см. BypassPolicy).
+// Смена ключа делает ранее выданные токены недействительными.
+// Должен вызываться до начала обработки запросов.
+func (l *Limiter) SetBypassPolicy(policy BypassPolicy) error {
+	if !policy.Enabled {
+		l.bypass = nil
+		return nil
+	}
+	if policy.Key == "" {
+		return errors.New("bypass token key must be specified")
+	}
+	if policy.Header == "" {
+		return errors.New("bypass token header must be specified")
+	}
+	if policy.MaxTTL <= 0 {
+		return errors.New("bypass token max TTL must be positive")
+	}
+	l.bypass = &bypassTokens{policy: policy, key: []byte(policy.Key)}
+	log.Printf("INFO: Rate limiter bypass tokens enabled (header %s, max TTL %v)", policy.Header, policy.MaxTTL)
+	return nil
+}
+
+// BypassHeader возвращает заголовок с токеном обхода ("" - обход отключен).
+func (l *Limiter) BypassHeader() string {
+	if l.bypass == nil {
+		return ""
+	}
+	return l.bypass.policy.Header
+}
+
+// BypassMaxTTL возвращает максимальный срок действия токенов обхода (0, если они отключены).
+func (l *Limiter) BypassMaxTTL() time.Duration {
+	if l.bypass == nil {
+		return 0
+	}
+	return l.bypass.policy.MaxTTL
+}
+
+// IssueBypassToken выдает токен обхода для subject (имя задачи или сервиса) на время ttl.
+// Нулевой ttl означает максимальный срок (BypassPolicy.MaxTTL), больший - ошибка.
+// issuer - автор выдачи для журнала аудита.
+func (l *Limiter) IssueBypassToken(subject string, ttl time.Duration, issuer string) (BypassToken, error) {
+	if l.bypass == nil {
+		return BypassToken{}, errors.New("bypass tokens are disabled")
+	}
+	if subject == "" || strings.ContainsAny(subject, "\r\n") {
+		return BypassToken{}, errors.New("subject must be a non-empty single line")
+	}
+	if ttl == 0 {
+		ttl = l.bypass.policy.MaxTTL
+	}
+	if ttl < 0 || ttl > l.bypass.policy.MaxTTL {
+		return BypassToken{}, fmt.Errorf("ttl must be between 0 and %v", l.bypass.policy.MaxTTL)
+	}
+	expires := l.store.clock.Now().Add(ttl).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(subject)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(l.bypass.sign(payload))
+	log.Printf("INFO: AUDIT: Rate limit bypass token issued for %q by %s, expires %s", subject, issuer, expires.Format(time.RFC3339))
+	return BypassToken{Token: token, Subject: subject, ExpiresAt: expires, Header: l.bypass.policy.Header}, nil
+}
+
+// VerifyBypassToken проверяет токен обхода и возвращает subject, для которого он выдан.
+// Результаты проверок учитываются в метрике; отклоненные токены записываются в журнал.
+func (l *Limiter) VerifyBypassToken(token string) (string, error) {
+	if l.bypass == nil {
+		return "", ErrInvalidBypassToken
+	}
+	subject, err := l.bypass.verify(token, l.store.clock.Now())
+	if err != nil {
+		bypassRequestsTotal.With("rejected").Inc()
+		return "", err
+	}
+	bypassRequestsTotal.With("accepted").Inc()
+	return subject, nil
+}
+
+func (t *bypassTokens) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (t *bypassTokens) verify(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidBypassToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.sign(parts[0]+"."+parts[1])) {
+		return "", ErrInvalidBypassToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !now.Before(time.Unix(expires, 0)) {
+		return "", ErrInvalidBypassToken
+	}
+	subject, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidBypassToken
+	}
+	return string(subject), nil
+}
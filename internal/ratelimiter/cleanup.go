@@ -0,0 +1,86 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Режимы очистки неактивных бакетов.
+const (
+	// CleanupTicker - периодическая очистка фоновой горутиной (по умолчанию).
+	CleanupTicker = "ticker"
+	// CleanupLazy - ленивая очистка: неактивный бакет пересоздается при обращении клиента,
+	// а при росте числа бакетов выше порога запускается внеочередная очистка. Подходит для
+	// длинного интервала очистки и резких всплесков числа клиентов.
+	CleanupLazy = "lazy"
+)
+
+// DefaultSweepThreshold - порог числа бакетов для внеочередной очистки по умолчанию.
+const DefaultSweepThreshold = 10000
+
+// CleanupPolicy задает способ удаления неактивных бакетов. Бакет считается неактивным,
+// если к нему не обращались дольше двух интервалов очистки.
+type CleanupPolicy struct {
+	Mode string // CleanupTicker или CleanupLazy.
+	// Число бакетов, при достижении которого в режиме lazy запускается очистка
+	// (0 - DefaultSweepThreshold).
+	SweepThreshold int
+}
+
+// lazyCleanup - состояние ленивой очистки хранилища.
+type lazyCleanup struct {
+	enabled   bool
+	threshold time.Duration // Порог неактивности бакета.
+	minSweep  int64         // Порог числа бакетов из политики.
+	nextSweep atomic.Int64  // Число бакетов, при котором запускается следующая очистка.
+	sweeping  atomic.Bool
+}
+
+// SetCleanupPolicy выбирает режим очистки неактивных бакетов (см. CleanupPolicy).
+// Фоновая горутина продолжает работать в обоих режимах (она очищает истекшие баны),
+// но в режиме lazy не перебирает бакеты. Должен вызываться до начала обработки запросов.
+func (l *Limiter) SetCleanupPolicy(policy CleanupPolicy) error {
+	switch policy.Mode {
+	case "", CleanupTicker:
+		l.store.lazy.enabled = false
+		l.lazyCleanup.Store(false)
+		return nil
+	case CleanupLazy:
+	default:
+		return fmt.Errorf("unknown cleanup mode: %s", policy.Mode)
+	}
+	if policy.SweepThreshold <= 0 {
+		policy.SweepThreshold = DefaultSweepThreshold
+	}
+	lazy := &l.store.lazy
+	lazy.enabled = true
+	lazy.threshold = l.cleanupInterval * 2
+	lazy.minSweep = int64(policy.SweepThreshold)
+	lazy.nextSweep.Store(int64(policy.SweepThreshold))
+	l.lazyCleanup.Store(true)
+	log.Printf("INFO: Rate limiter lazy cleanup enabled: buckets expire after %v of inactivity, sweep at %d buckets", lazy.threshold, policy.SweepThreshold)
+	return nil
+}
+
+// expired сообщает, истек ли бакет при ленивой очистке.
+func (s *BucketStore) expired(bucket *Bucket) bool {
+	return s.lazy.enabled && bucket.IsInactive(s.lazy.threshold)
+}
+
+// maybeSweep запускает внеочередную очистку, если число бакетов достигло порога.
+// Следующий порог - удвоенное число оставшихся бакетов (но не меньше порога из политики),
+// чтобы при большом числе активных клиентов очистка не запускалась на каждое создание бакета.
+func (s *BucketStore) maybeSweep() {
+	lazy := &s.lazy
+	if !lazy.enabled || s.count.Load() < lazy.nextSweep.Load() || !lazy.sweeping.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer lazy.sweeping.Store(false)
+		removed := s.removeInactive(lazy.threshold)
+		lazy.nextSweep.Store(max(lazy.minSweep, 2*s.count.Load()))
+		log.Printf("INFO: Rate limiter sweep triggered by bucket count removed %d inactive buckets (%d remaining).", removed, s.count.Load())
+	}()
+}
@@ -0,0 +1,35 @@
+package ratelimiter
+
+import "time"
+
+// Clock абстрагирует источник времени для бакетов и фоновой очистки.
+// Позволяет тестам и встраивающим приложениям подменять реальное время (см. пакет ratelimitertest).
+type Clock interface {
+	// Now возвращает текущее время.
+	Now() time.Time
+	// NewTicker создает тикер с заданным периодом.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker - абстракция над time.Ticker.
+type Ticker interface {
+	// C возвращает канал, в который поступают тики.
+	C() <-chan time.Time
+	// Stop останавливает тикер.
+	Stop()
+}
+
+// RealClock - реализация Clock на основе пакета time.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+
+func (t realTicker) Stop() { t.t.Stop() }
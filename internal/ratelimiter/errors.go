@@ -0,0 +1,16 @@
+package ratelimiter
+
+import "errors"
+
+// Ошибки, возвращаемые конструкторами пакета и реализациями LimitManager. Проверяются через errors.Is.
+var (
+	// ErrInvalidCapacity - емкость бакета не положительна.
+	ErrInvalidCapacity = errors.New("capacity must be positive")
+	// ErrInvalidRate - скорость пополнения не положительна.
+	ErrInvalidRate = errors.New("refill rate must be positive")
+	// ErrNilStore - Limiter создается без BucketStore.
+	ErrNilStore = errors.New("bucket store cannot be nil")
+	// ErrVersionConflict - лимит был изменен (или создан) другим запросом после чтения
+	// его версии. См. ClientLimit.Version.
+	ErrVersionConflict = errors.New("limit version conflict")
+)
@@ -3,6 +3,7 @@ package ratelimiter
 import (
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,16 +15,24 @@ type Limiter struct {
 	stopChan        chan struct{}
 	cleanupInterval time.Duration
 	wg              sync.WaitGroup
+	bans            *banList // Нарушения лимита и активные баны клиентов (см. SetBanPolicy).
+	tarpit          TarpitPolicy
+	tenants         tenantLimits     // Общие лимиты тенантов (см. SetTenantPolicy).
+	rules           requestRules     // Лимиты по атрибутам запроса (см. SetRequestRules).
+	adaptive        adaptiveThrottle // Адаптивное ограничение по ответам бэкендов (см. SetAdaptivePolicy).
+	usage           usageTracker     // Счетчики использования лимитов клиентами (см. SetUsagePolicy).
+	breaches        breachDetector   // Уведомления о превышении порога отказов (см. SetBreachPolicy).
+	bypass          *bypassTokens    // Токены обхода лимитов (nil - отключено, см. SetBypassPolicy).
+	lazyCleanup     atomic.Bool      // Бакеты очищаются лениво (см. SetCleanupPolicy).
 }
 
 // NewLimiter создает, инициализирует и запускает новый Limiter.
 // Принимает BucketStore и интервал очистки.
 // Запускает горутину для периодической очистки.
-// Возвращает nil, если store равен nil.
-func NewLimiter(store *BucketStore, cleanupInterval time.Duration) *Limiter {
+// Возвращает ErrNilStore, если store равен nil.
+func NewLimiter(store *BucketStore, cleanupInterval time.Duration) (*Limiter, error) {
 	if store == nil {
-		log.Println("ERROR: Cannot create Limiter with a nil BucketStore")
-		return nil
+		return nil, ErrNilStore
 	}
 	if cleanupInterval <= 0 {
 		log.Printf("WARN: Invalid cleanupInterval (%v) for Limiter, using default 5m", cleanupInterval)
@@ -34,31 +43,72 @@ func NewLimiter(store *BucketStore, cleanupInterval time.Duration) *Limiter {
 		store:           store,
 		stopChan:        make(chan struct{}),
 		cleanupInterval: cleanupInterval,
+		bans:            newBanList(),
 	}
 
+	// Тикер создается синхронно, чтобы подменные часы (Clock) учитывали его сразу.
+	ticker := store.clock.NewTicker(cleanupInterval)
 	limiter.wg.Add(1)
-	go limiter.runCleanup()
+	go limiter.runCleanup(ticker)
 
-	return limiter
+	return limiter, nil
 }
 
 // Allow проверяет, разрешен ли запрос для данного clientID.
 // Получает или создает бакет для клиента из BucketStore и вызывает его метод Allow.
 // Возвращает true, если запрос разрешен, иначе false.
 func (l *Limiter) Allow(clientID string) bool {
-	bucket := l.store.GetOrCreateBucket(clientID)
+	return l.Check(clientID).Allowed
+}
+
+// Check проверяет запрос клиента с учетом банов: запросы забаненного клиента отклоняются
+// без расхода токенов, а каждое превышение лимита учитывается политикой бана (см. SetBanPolicy).
+// Для разрешенных запросов в прогрессивном режиме (см. SetTarpitPolicy) возвращается задержка.
+func (l *Limiter) Check(clientID string) Decision {
+	decision := l.checkBucket(clientID, l.store.GetOrCreateBucket(clientID))
+	now := l.store.clock.Now()
+	l.usage.record(clientID, decision.Allowed, now)
+	l.breaches.record(clientID, decision, now)
+	return decision
+}
+
+// checkBucket проверяет запрос клиента clientID по бакету bucket (см. Check).
+func (l *Limiter) checkBucket(clientID string, bucket *Bucket) Decision {
+	now := l.store.clock.Now()
+	if ban, ok := l.bans.banned(clientID, now); ok {
+		return Decision{Banned: true, BannedUntil: ban.Until}
+	}
+
 	if bucket == nil {
-		log.Printf("ERROR: Could not get or create bucket for client %s in Limiter.Allow", clientID)
-		return false
+		log.Printf("ERROR: Could not get or create bucket for client %s in Limiter.Check", clientID)
+		return Decision{}
+	}
+	allowed, remaining := bucket.AllowWithLevel()
+	if allowed && !l.adaptive.admit(clientID) {
+		return Decision{Throttled: true}
 	}
-	return bucket.Allow()
+	if allowed {
+		delay := l.tarpit.delay(remaining)
+		if delay > 0 {
+			recordTarpit(delay)
+		}
+		return Decision{Allowed: true, Delay: delay}
+	}
+	if ban, ok := l.bans.recordViolation(clientID, now); ok {
+		return Decision{Banned: true, BannedUntil: ban.Until}
+	}
+	return Decision{}
+}
+
+// StoreStats возвращает состояние хранилища бакетов (см. BucketStore.Stats).
+func (l *Limiter) StoreStats() StoreStats {
+	return l.store.Stats()
 }
 
 // runCleanup - это фоновая горутина, которая периодически удаляет старые/неактивные бакеты из хранилища.
 // Это предотвращает утечку памяти при большом количестве уникальных клиентов.
-func (l *Limiter) runCleanup() {
+func (l *Limiter) runCleanup(ticker Ticker) {
 	defer l.wg.Done()
-	ticker := time.NewTicker(l.cleanupInterval)
 	defer ticker.Stop()
 
 	inactivityThreshold := l.cleanupInterval * 2
@@ -66,19 +116,18 @@ func (l *Limiter) runCleanup() {
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			log.Println("DEBUG: Running limiter cleanup...")
 			cleanedCount := 0
-
-			l.store.mu.Lock()
-			for id, bucket := range l.store.buckets {
-				if bucket.IsInactive(inactivityThreshold) {
-					delete(l.store.buckets, id)
-					cleanedCount++
-					log.Printf("DEBUG: Cleaned up inactive bucket for client %s", id)
-				}
+			if !l.lazyCleanup.Load() {
+				cleanedCount = l.store.removeInactive(inactivityThreshold)
 			}
-			l.store.mu.Unlock()
+			l.bans.cleanup(l.store.clock.Now())
+			l.tenants.cleanup(inactivityThreshold)
+			l.rules.cleanup(inactivityThreshold)
+			l.adaptive.cleanup(l.store.clock.Now(), inactivityThreshold)
+			l.usage.cleanup(l.store.clock.Now())
+			l.breaches.cleanup(l.store.clock.Now())
 
 			if cleanedCount > 0 {
 				log.Printf("INFO: Limiter cleanup finished. Removed %d inactive buckets.", cleanedCount)
@@ -96,5 +145,6 @@ func (l *Limiter) Stop() {
 	log.Println("INFO: Stopping Limiter...")
 	close(l.stopChan)
 	l.wg.Wait()
+	l.usage.persist(l.store.clock.Now())
 	log.Println("INFO: Limiter stopped gracefully.")
 }
@@ -0,0 +1,228 @@
+package ratelimiter_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLimiter_CleanupInactiveBuckets проверяет, что фоновая очистка удаляет бакеты,
+// неактивные дольше двух интервалов очистки, и не трогает активные.
+func TestLimiter_CleanupInactiveBuckets(t *testing.T) {
+	limiter, store, clock := ratelimitertest.NewLimiter(t, 5, 1, time.Minute)
+
+	assert.True(t, limiter.Allow("idle-client"))
+	assert.True(t, limiter.Allow("active-client"))
+	require.Equal(t, 2, store.Len())
+
+	clock.Advance(90 * time.Second)
+	assert.True(t, limiter.Allow("active-client"))
+	clock.Advance(60 * time.Second)
+
+	require.Eventually(t, func() bool { return store.Len() == 1 }, time.Second, 5*time.Millisecond,
+		"Inactive bucket should be removed by cleanup")
+	assert.True(t, limiter.Allow("active-client"))
+}
+
+// TestLimiter_CustomLimitProvider проверяет применение кастомных лимитов из провайдера.
+func TestLimiter_CustomLimitProvider(t *testing.T) {
+	provider := ratelimitertest.NewStaticLimitProvider()
+	provider.Set("vip", 3, 1)
+	store, clock := ratelimitertest.NewStore(t, 1, 1, provider)
+
+	vip := store.GetOrCreateBucket("vip")
+	regular := store.GetOrCreateBucket("regular")
+	for i := 0; i < 3; i++ {
+		assert.True(t, vip.Allow(), "VIP request %d should be allowed", i+1)
+	}
+	assert.False(t, vip.Allow())
+	assert.True(t, regular.Allow())
+	assert.False(t, regular.Allow())
+
+	clock.Advance(time.Second)
+	assert.True(t, vip.Allow())
+	assert.True(t, regular.Allow())
+}
+
+// TestLimiter_Ban проверяет, что повторные превышения лимита приводят к бану
+// на заданное время, а снятый бан перестает действовать.
+func TestLimiter_Ban(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 1, 1, time.Hour)
+	limiter.SetBanPolicy(rl.BanPolicy{Enabled: true, Violations: 2, Window: time.Minute, Duration: 10 * time.Minute})
+
+	assert.True(t, limiter.Check("abuser").Allowed)
+	first := limiter.Check("abuser")
+	assert.False(t, first.Allowed)
+	assert.False(t, first.Banned, "A single violation only throttles")
+
+	second := limiter.Check("abuser")
+	assert.True(t, second.Banned)
+	assert.Equal(t, clock.Now().Add(10*time.Minute), second.BannedUntil)
+
+	// Во время бана запросы отклоняются даже после пополнения бакета.
+	clock.Advance(5 * time.Minute)
+	assert.True(t, limiter.Check("abuser").Banned)
+	require.Len(t, limiter.Bans(), 1)
+	assert.Equal(t, "abuser", limiter.Bans()[0].ClientID)
+
+	clock.Advance(5 * time.Minute)
+	assert.True(t, limiter.Check("abuser").Allowed, "Ban expires after its duration")
+
+	assert.False(t, limiter.Check("abuser").Allowed)
+	assert.True(t, limiter.Check("abuser").Banned)
+	assert.True(t, limiter.Unban("abuser"))
+	assert.Empty(t, limiter.Bans())
+	assert.False(t, limiter.Unban("abuser"))
+}
+
+// TestLimiter_Tarpit проверяет, что задержка появляется после порога использования
+// бакета и растет по мере приближения к лимиту.
+func TestLimiter_Tarpit(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 4, 1, time.Hour)
+	limiter.SetTarpitPolicy(rl.TarpitPolicy{Enabled: true, Threshold: 0.5, MaxDelay: time.Second})
+
+	delays := make([]time.Duration, 0, 4)
+	for i := 0; i < 4; i++ {
+		d := limiter.Check("client")
+		require.True(t, d.Allowed)
+		delays = append(delays, d.Delay)
+	}
+	assert.Equal(t, []time.Duration{0, 0, 500 * time.Millisecond, time.Second}, delays)
+	assert.False(t, limiter.Check("client").Allowed)
+}
+
+// TestLimiter_StoreStats проверяет учет созданных и удаленных бакетов, заполненность шардов
+// и оценку памяти хранилища.
+func TestLimiter_StoreStats(t *testing.T) {
+	limiter, store, clock := ratelimitertest.NewLimiter(t, 5, 1, time.Minute)
+
+	for _, id := range []string{"client-a", "client-b", "client-c"} {
+		assert.True(t, limiter.Allow(id))
+	}
+	stats := limiter.StoreStats()
+	assert.Equal(t, int64(3), stats.Buckets)
+	assert.Equal(t, uint64(3), stats.CreatedTotal)
+	assert.Zero(t, stats.EvictedTotal)
+	occupied := 0
+	for _, n := range stats.Shards {
+		occupied += n
+	}
+	assert.Equal(t, 3, occupied)
+	assert.Positive(t, stats.EstimatedBytes)
+
+	clock.Advance(150 * time.Second)
+	require.Eventually(t, func() bool { return store.Len() == 0 }, time.Second, 5*time.Millisecond)
+	stats = limiter.StoreStats()
+	assert.Equal(t, uint64(3), stats.EvictedTotal)
+	assert.Zero(t, stats.EstimatedBytes)
+}
+
+// TestLimiter_LazyCleanup проверяет ленивую очистку: фоновая горутина не удаляет бакеты,
+// неактивный бакет пересоздается при обращении, а рост числа бакетов запускает очистку.
+func TestLimiter_LazyCleanup(t *testing.T) {
+	limiter, store, clock := ratelimitertest.NewLimiter(t, 1, 1, time.Minute)
+	require.NoError(t, limiter.SetCleanupPolicy(rl.CleanupPolicy{Mode: rl.CleanupLazy, SweepThreshold: 3}))
+	assert.Error(t, limiter.SetCleanupPolicy(rl.CleanupPolicy{Mode: "unknown"}))
+
+	assert.True(t, limiter.Allow("client-a"))
+	assert.True(t, limiter.Allow("client-b"))
+	assert.False(t, limiter.Allow("client-a"), "Bucket should be exhausted")
+
+	clock.Advance(150 * time.Second)
+	// Тикер сработал, но в режиме lazy бакеты не удаляются.
+	assert.Never(t, func() bool { return store.Len() < 2 }, 50*time.Millisecond, 5*time.Millisecond)
+
+	assert.True(t, limiter.Allow("client-a"), "Expired bucket should be recreated on access")
+	assert.Equal(t, uint64(1), limiter.StoreStats().EvictedTotal)
+
+	// Третий бакет достигает порога и запускает очистку: client-b неактивен.
+	assert.True(t, limiter.Allow("client-c"))
+	require.Eventually(t, func() bool { return store.Len() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+// TestLimiter_TenantLimits проверяет двухуровневое ограничение: клиент не может исчерпать
+// квоту тенанта сверх своего лимита, а исчерпанная квота тенанта ограничивает всех его клиентов
+// без расхода их собственных токенов.
+func TestLimiter_TenantLimits(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 2, 1, time.Minute)
+	require.NoError(t, limiter.SetTenantPolicy(rl.TenantPolicy{Enabled: true, Header: "X-Tenant-ID", Capacity: 3, RefillRate: 1}))
+	assert.Equal(t, "X-Tenant-ID", limiter.TenantHeader())
+
+	// Лимит клиента исчерпывается раньше лимита тенанта.
+	assert.True(t, limiter.CheckTenant("user-1", "acme").Allowed)
+	assert.True(t, limiter.CheckTenant("user-1", "acme").Allowed)
+	d := limiter.CheckTenant("user-1", "acme")
+	assert.False(t, d.Allowed)
+	assert.False(t, d.TenantLimited, "User limit should be hit first")
+
+	// Второй клиент исчерпывает оставшуюся квоту тенанта.
+	assert.True(t, limiter.CheckTenant("user-2", "acme").Allowed)
+	d = limiter.CheckTenant("user-2", "acme")
+	assert.False(t, d.Allowed)
+	assert.True(t, d.TenantLimited)
+
+	// Токен user-2 был возвращен: после пополнения тенанта запрос проходит.
+	assert.True(t, limiter.CheckTenant("user-3", "other").Allowed, "Other tenants are not affected")
+	clock.Advance(time.Second)
+	assert.True(t, limiter.CheckTenant("user-2", "acme").Allowed)
+}
+
+// TestLimiter_TenantLimitsBounded проверяет, что число бакетов тенантов ограничено
+// MaxTenants, невалидные идентификаторы игнорируются, а место освобождается очисткой.
+func TestLimiter_TenantLimitsBounded(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 5, 1, time.Minute)
+	require.NoError(t, limiter.SetTenantPolicy(rl.TenantPolicy{Enabled: true, Header: "X-Tenant-ID", Capacity: 1, RefillRate: 1, MaxTenants: 1}))
+
+	assert.True(t, limiter.CheckTenant("user-1", "acme").Allowed)
+	assert.True(t, limiter.CheckTenant("user-1", "acme").TenantLimited)
+
+	// Лимит числа тенантов достигнут: новый тенант проверяется только лимитом клиента.
+	assert.True(t, limiter.CheckTenant("user-2", "other").Allowed)
+	assert.True(t, limiter.CheckTenant("user-2", "other").Allowed)
+	assert.True(t, limiter.CheckTenant("user-3", "bad tenant!").Allowed)
+	assert.True(t, limiter.CheckTenant("user-3", "bad tenant!").Allowed)
+
+	// Бакет неактивного тенанта удаляется, и новый тенант получает собственный лимит.
+	clock.Advance(3 * time.Minute)
+	client := 0
+	require.Eventually(t, func() bool {
+		client++
+		limiter.CheckTenant(fmt.Sprintf("client-%d-a", client), "other")
+		return limiter.CheckTenant(fmt.Sprintf("client-%d-b", client), "other").TenantLimited
+	}, time.Second, 5*time.Millisecond, "Tenant bucket should be created after cleanup")
+}
+
+// TestLimiter_BypassTokens проверяет выдачу и проверку токенов обхода: подделанные
+// и истекшие токены отклоняются, срок действия ограничен MaxTTL.
+func TestLimiter_BypassTokens(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 1, 1, time.Minute)
+	_, err := limiter.IssueBypassToken("nightly-export", time.Minute, "admin")
+	assert.Error(t, err, "Tokens cannot be issued while bypass is disabled")
+
+	require.NoError(t, limiter.SetBypassPolicy(rl.BypassPolicy{Enabled: true, Key: "secret", Header: "X-RateLimit-Bypass", MaxTTL: time.Hour}))
+	assert.Equal(t, "X-RateLimit-Bypass", limiter.BypassHeader())
+
+	_, err = limiter.IssueBypassToken("nightly-export", 2*time.Hour, "admin")
+	assert.Error(t, err, "TTL above MaxTTL should be rejected")
+
+	token, err := limiter.IssueBypassToken("nightly-export", 10*time.Minute, "admin")
+	require.NoError(t, err)
+	subject, err := limiter.VerifyBypassToken(token.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "nightly-export", subject)
+
+	_, err = limiter.VerifyBypassToken(token.Token + "x")
+	assert.ErrorIs(t, err, rl.ErrInvalidBypassToken)
+	_, err = limiter.VerifyBypassToken("bm90LWEtdG9rZW4.0.c2ln")
+	assert.ErrorIs(t, err, rl.ErrInvalidBypassToken)
+
+	clock.Advance(11 * time.Minute)
+	_, err = limiter.VerifyBypassToken(token.Token)
+	assert.ErrorIs(t, err, rl.ErrInvalidBypassToken, "Expired token should be rejected")
+}
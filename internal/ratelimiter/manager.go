@@ -1,16 +1,49 @@
 package ratelimiter
 
+import "time"
+
+// ClientLimit описывает кастомный лимит клиента вместе с метаданными,
+// позволяющими операторам зафиксировать, зачем и кем лимит был установлен.
+type ClientLimit struct {
+	ClientID    string
+	Capacity    int64
+	Rate        float64
+	Description string    // Причина установки лимита (необязательно).
+	CreatedBy   string    // Кто создал лимит; заполняется хранилищем при создании из UpdatedBy.
+	UpdatedBy   string    // Кто последним изменил лимит.
+	UpdatedAt   time.Time // Время последнего изменения; заполняется хранилищем.
+	// Version увеличивается при каждом изменении записи. При чтении - текущая версия,
+	// в SetLimit - ожидаемая версия (0 - лимит создается и не должен существовать).
+	Version int64
+}
+
 // LimitManager определяет интерфейс для управления кастомными лимитами клиентов.
 // Этот интерфейс используется компонентами, отвечающими за администрирование лимитов (например, Admin API).
 type LimitManager interface {
-	// GetLimit получает текущие лимиты для клиента.
-	GetLimit(clientID string) (capacity int64, rate float64, found bool)
-	// SetLimit устанавливает или обновляет лимиты для клиента.
-	SetLimit(clientID string, capacity int64, rate float64) error
+	// GetClientLimit получает текущий лимит клиента вместе с метаданными.
+	// Возвращает found=false, если лимит не найден.
+	GetClientLimit(clientID string) (limit ClientLimit, found bool, err error)
+	// SetLimit создает или обновляет лимит клиента с проверкой версии (см. ClientLimit.Version).
+	// При несовпадении версии возвращает ErrVersionConflict.
+	// CreatedBy и UpdatedAt заполняются хранилищем.
+	SetLimit(limit ClientLimit) error
 	// DeleteLimit удаляет кастомные лимиты для клиента.
 	// После удаления будут использоваться лимиты по умолчанию.
 	DeleteLimit(clientID string) error
-	// Возможно, в будущем: ListLimits() ([]ClientLimit, error)
+	// RestoreLimit восстанавливает удаленный лимит клиента.
+	// Возвращает found=false, если восстанавливать нечего.
+	RestoreLimit(clientID string) (found bool, err error)
+	// ListLimits возвращает лимиты, удовлетворяющие фильтру, начиная с недавно измененных.
+	ListLimits(filter LimitFilter) ([]ClientLimit, error)
+}
+
+// LimitFilter задает условия поиска лимитов. Нулевые значения полей означают отсутствие условия.
+type LimitFilter struct {
+	MinRate      float64
+	MaxRate      float64
+	MinCapacity  int64
+	MaxCapacity  int64
+	UpdatedSince time.Time
 }
 
 // Примечание: Closer() не включен сюда, так как закрытие ресурсов (БД)
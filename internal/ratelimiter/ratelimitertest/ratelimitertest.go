@@ -0,0 +1,134 @@
+// Package ratelimitertest предоставляет вспомогательные средства для тестирования кода,
+// использующего пакет ratelimiter: управляемые вручную часы и статический провайдер лимитов.
+package ratelimitertest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+)
+
+// FakeClock - управляемая вручную реализация ratelimiter.Clock.
+// Время изменяется только вызовами Advance/Set; тикеры срабатывают при продвижении времени.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFakeClock создает часы, показывающие указанное время.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now возвращает текущее время часов.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker создает тикер, срабатывающий при продвижении часов на период d.
+func (c *FakeClock) NewTicker(d time.Duration) rl.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, period: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance продвигает часы на d и срабатывает тикеры, чей момент наступил.
+// Как и time.Ticker, пропущенные тики не накапливаются (в канале не более одного).
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if t.stopped || t.next.After(c.now) {
+			continue
+		}
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock   *FakeClock
+	period  time.Duration
+	next    time.Time
+	ch      chan time.Time
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	t.stopped = true
+	t.clock.mu.Unlock()
+}
+
+// StaticLimitProvider - реализация ratelimiter.LimitProvider на основе map.
+type StaticLimitProvider struct {
+	mu     sync.RWMutex
+	limits map[string]limit
+}
+
+type limit struct {
+	capacity int64
+	rate     float64
+}
+
+// NewStaticLimitProvider создает пустой провайдер.
+func NewStaticLimitProvider() *StaticLimitProvider {
+	return &StaticLimitProvider{limits: make(map[string]limit)}
+}
+
+// Set задает лимит для клиента.
+func (p *StaticLimitProvider) Set(clientID string, capacity int64, rate float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limits[clientID] = limit{capacity: capacity, rate: rate}
+}
+
+// GetLimit реализует ratelimiter.LimitProvider.
+func (p *StaticLimitProvider) GetLimit(clientID string) (capacity int64, rate float64, found bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	l, ok := p.limits[clientID]
+	return l.capacity, l.rate, ok
+}
+
+// Closer реализует ratelimiter.LimitProvider.
+func (p *StaticLimitProvider) Closer() error { return nil }
+
+// NewStore создает BucketStore, использующий FakeClock.
+func NewStore(t testing.TB, capacity int64, rate float64, provider rl.LimitProvider) (*rl.BucketStore, *FakeClock) {
+	t.Helper()
+	store, err := rl.NewBucketStore(capacity, rate, provider)
+	if err != nil {
+		t.Fatalf("ratelimitertest: failed to create store: %v", err)
+	}
+	clock := NewFakeClock(time.Unix(0, 0))
+	store.SetClock(clock)
+	return store, clock
+}
+
+// NewLimiter создает Limiter с FakeClock и регистрирует его остановку в t.Cleanup.
+func NewLimiter(t testing.TB, capacity int64, rate float64, cleanupInterval time.Duration) (*rl.Limiter, *rl.BucketStore, *FakeClock) {
+	t.Helper()
+	store, clock := NewStore(t, capacity, rate, nil)
+	limiter, err := rl.NewLimiter(store, cleanupInterval)
+	if err != nil {
+		t.Fatalf("ratelimitertest: failed to create limiter: %v", err)
+	}
+	t.Cleanup(limiter.Stop)
+	return limiter, store, clock
+}
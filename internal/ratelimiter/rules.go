@@ -0,0 +1,142 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	httputil_pkg "cloud/load_balancer/internal/httputil"
+	"cloud/load_balancer/internal/metrics"
+)
+
+var ruleRejectsTotal = metrics.NewCounterVec("lb_ratelimit_rule_rejects_total",
+	"Requests rejected by a request attribute rate limit rule.", "rule")
+
+// RequestAttributes - атрибуты запроса, по которым выбирается правило лимита (см. RequestRule).
+type RequestAttributes struct {
+	Method      string
+	Path        string
+	ContentType string // Значение заголовка Content-Type (параметры игнорируются).
+}
+
+// RequestRule задает отдельный лимит для запросов клиента с заданными атрибутами, например
+// более строгий лимит для POST или отдельный бакет для multipart-загрузок. Запрос, подходящий
+// под правило, расходует токен из бакета клиента для этого правила вместо основного бакета.
+// Пустое условие подходит под любое значение; должно быть задано хотя бы одно условие.
+type RequestRule struct {
+	Name        string   // Имя правила (используется в логах и метриках).
+	Methods     []string // HTTP-методы.
+	PathPrefix  string   // Префикс пути, например "/api/".
+	ContentType string   // Тип содержимого, например "multipart/form-data" или "image/*".
+	Capacity    int64
+	RefillRate  float64 // Токенов в секунду.
+}
+
+// matches сообщает, подходит ли запрос под правило.
+func (r RequestRule) matches(req RequestAttributes) bool {
+	if len(r.Methods) > 0 && !slices.ContainsFunc(r.Methods, func(m string) bool { return strings.EqualFold(m, req.Method) }) {
+		return false
+	}
+	if r.PathPrefix != "" && !httputil_pkg.PathHasPrefix(req.Path, r.PathPrefix) {
+		return false
+	}
+	if r.ContentType != "" {
+		mediaType, _, _ := strings.Cut(req.ContentType, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		want := strings.ToLower(r.ContentType)
+		if prefix, ok := strings.CutSuffix(want, "/*"); ok {
+			if !strings.HasPrefix(mediaType, prefix+"/") {
+				return false
+			}
+		} else if mediaType != want {
+			return false
+		}
+	}
+	return true
+}
+
+// requestRules хранит правила и бакеты клиентов для каждого правила.
+type requestRules struct {
+	mu      sync.Mutex
+	rules   []RequestRule
+	buckets map[ruleKey]*Bucket
+}
+
+type ruleKey struct {
+	rule     int // Индекс правила.
+	clientID string
+}
+
+// SetRequestRules задает правила лимитов по атрибутам запроса. Правила проверяются по
+// порядку, применяется первое подходящее. Должен вызываться до начала обработки запросов.
+func (l *Limiter) SetRequestRules(rules []RequestRule) error {
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d: name must be specified", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+		if len(rule.Methods) == 0 && rule.PathPrefix == "" && rule.ContentType == "" {
+			return fmt.Errorf("rule %q: at least one of methods, path_prefix or content_type must be specified", rule.Name)
+		}
+		if rule.PathPrefix != "" && !strings.HasPrefix(rule.PathPrefix, "/") {
+			return fmt.Errorf("rule %q: path prefix must start with '/'", rule.Name)
+		}
+		if rule.ContentType != "" && !strings.Contains(rule.ContentType, "/") {
+			return fmt.Errorf("rule %q: content type must be in type/subtype form", rule.Name)
+		}
+		if err := validateLimits(rule.Capacity, rule.RefillRate); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+	}
+	l.rules.mu.Lock()
+	defer l.rules.mu.Unlock()
+	l.rules.rules = slices.Clone(rules)
+	l.rules.buckets = make(map[ruleKey]*Bucket)
+	for _, rule := range rules {
+		log.Printf("INFO: Rate limit rule %s: methods=%v path_prefix=%q content_type=%q capacity=%d rate=%.2f/s",
+			rule.Name, rule.Methods, rule.PathPrefix, rule.ContentType, rule.Capacity, rule.RefillRate)
+	}
+	return nil
+}
+
+// ruleBucket возвращает имя первого подходящего под запрос правила и бакет клиента для него
+// ("" и nil, если подходящего правила нет).
+func (l *Limiter) ruleBucket(clientID string, req RequestAttributes) (string, *Bucket) {
+	l.rules.mu.Lock()
+	defer l.rules.mu.Unlock()
+	for i, rule := range l.rules.rules {
+		if !rule.matches(req) {
+			continue
+		}
+		key := ruleKey{rule: i, clientID: clientID}
+		if bucket, ok := l.rules.buckets[key]; ok {
+			return rule.Name, bucket
+		}
+		bucket, err := NewBucketWithClock(rule.Capacity, rule.RefillRate, l.store.clock)
+		if err != nil {
+			log.Printf("ERROR: Failed to create bucket for client %s and rule %s: %v", clientID, rule.Name, err)
+			return "", nil
+		}
+		l.rules.buckets[key] = bucket
+		return rule.Name, bucket
+	}
+	return "", nil
+}
+
+// cleanup удаляет бакеты правил, неактивные дольше threshold.
+func (r *requestRules) cleanup(threshold time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, bucket := range r.buckets {
+		if bucket.IsInactive(threshold) {
+			delete(r.buckets, key)
+		}
+	}
+}
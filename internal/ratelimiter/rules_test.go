@@ -0,0 +1,74 @@
+package ratelimiter_test
+
+import (
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLimiter_RequestRules проверяет, что запросы, подходящие под правило, ограничиваются
+// отдельным бакетом правила и не расходуют основной лимит клиента.
+func TestLimiter_RequestRules(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 3, 1, time.Minute)
+	require.NoError(t, limiter.SetRequestRules([]rl.RequestRule{
+		{Name: "writes", Methods: []string{"POST"}, PathPrefix: "/api/", Capacity: 1, RefillRate: 1},
+		{Name: "uploads", ContentType: "multipart/form-data", Capacity: 2, RefillRate: 1},
+	}))
+
+	post := rl.RequestAttributes{Method: "post", Path: "/api/orders"}
+	get := rl.RequestAttributes{Method: "GET", Path: "/api/orders"}
+	upload := rl.RequestAttributes{Method: "PUT", Path: "/files", ContentType: "multipart/form-data; boundary=x"}
+
+	decision := limiter.CheckRequest("client", "", post)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "writes", decision.Rule)
+	decision = limiter.CheckRequest("client", "", post)
+	assert.False(t, decision.Allowed, "POST has a stricter limit")
+	assert.Equal(t, "writes", decision.Rule)
+	assert.True(t, limiter.CheckRequest("other", "", post).Allowed, "Rule buckets are per client")
+
+	for range 3 {
+		decision = limiter.CheckRequest("client", "", get)
+		assert.True(t, decision.Allowed, "GET uses the client's main bucket")
+		assert.Empty(t, decision.Rule)
+	}
+	assert.False(t, limiter.CheckRequest("client", "", get).Allowed)
+
+	assert.True(t, limiter.CheckRequest("client", "", upload).Allowed, "Uploads have a separate bucket")
+	assert.True(t, limiter.CheckRequest("client", "", upload).Allowed)
+	assert.False(t, limiter.CheckRequest("client", "", upload).Allowed)
+
+	clock.Advance(time.Second)
+	assert.True(t, limiter.CheckRequest("client", "", post).Allowed)
+}
+
+// TestLimiter_SetRequestRulesValidation проверяет валидацию правил.
+func TestLimiter_SetRequestRulesValidation(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 3, 1, time.Minute)
+	tests := []struct {
+		name string
+		rule rl.RequestRule
+	}{
+		{name: "no name", rule: rl.RequestRule{Methods: []string{"POST"}, Capacity: 1, RefillRate: 1}},
+		{name: "no conditions", rule: rl.RequestRule{Name: "all", Capacity: 1, RefillRate: 1}},
+		{name: "relative path", rule: rl.RequestRule{Name: "api", PathPrefix: "api", Capacity: 1, RefillRate: 1}},
+		{name: "bad content type", rule: rl.RequestRule{Name: "ct", ContentType: "json", Capacity: 1, RefillRate: 1}},
+		{name: "zero capacity", rule: rl.RequestRule{Name: "zero", Methods: []string{"POST"}, RefillRate: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, limiter.SetRequestRules([]rl.RequestRule{tt.rule}))
+		})
+	}
+	dup := rl.RequestRule{Name: "dup", Methods: []string{"POST"}, Capacity: 1, RefillRate: 1}
+	assert.Error(t, limiter.SetRequestRules([]rl.RequestRule{dup, dup}))
+
+	require.NoError(t, limiter.SetRequestRules([]rl.RequestRule{{Name: "images", ContentType: "image/*", Capacity: 1, RefillRate: 1}}))
+	decision := limiter.CheckRequest("client", "", rl.RequestAttributes{Method: "POST", Path: "/", ContentType: "Image/PNG"})
+	assert.Equal(t, "images", decision.Rule)
+}
@@ -1,8 +1,16 @@
 package ratelimiter
 
 import (
+	"fmt"
+	"hash/fnv"
 	"log"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"cloud/load_balancer/internal/metrics"
 )
 
 // LimitProvider определяет интерфейс для получения кастомных лимитов (емкость и скорость)
@@ -17,37 +25,118 @@ type LimitProvider interface {
 	Closer() error
 }
 
+var (
+	storeBuckets = metrics.NewGaugeVec("lb_ratelimit_store_buckets",
+		"Token buckets currently held by the rate limiter store.")
+	storeShardBuckets = metrics.NewGaugeVec("lb_ratelimit_store_shard_buckets",
+		"Token buckets per rate limiter store shard.", "shard")
+	storeMemoryBytes = metrics.NewGaugeVec("lb_ratelimit_store_memory_bytes",
+		"Estimated memory used by rate limiter buckets and their keys.")
+	storeBucketsCreatedTotal = metrics.NewCounterVec("lb_ratelimit_store_buckets_created_total",
+		"Token buckets created for new clients.")
+	storeBucketsEvictedTotal = metrics.NewCounterVec("lb_ratelimit_store_buckets_evicted_total",
+		"Inactive token buckets removed by cleanup.")
+)
+
+// storeShards - число шардов хранилища. Каждый шард защищен собственным мьютексом,
+// поэтому создание бакетов для разных клиентов меньше конкурирует за блокировку.
+const storeShards = 16
+
+// bucketOverheadBytes - оценка памяти на один бакет без учета ключа: структура Bucket,
+// указатель на нее и служебные данные записи map.
+const bucketOverheadBytes = int64(unsafe.Sizeof(Bucket{})) + 8 + 48
+
+// storeShard - часть хранилища бакетов со своей блокировкой.
+type storeShard struct {
+	mu      sync.RWMutex
+	buckets map[string]*Bucket // Ключ - clientID.
+	label   string             // Номер шарда для метрик.
+}
+
 // BucketStore управляет коллекцией бакетов токенов для разных клиентов.
 // Он отвечает за создание новых бакетов (с параметрами по умолчанию или кастомными из LimitProvider)
-// и предоставление доступа к существующим бакетам. Доступ к map бакетов защищен мьютексом.
+// и предоставление доступа к существующим бакетам. Бакеты распределены по шардам
+// по хешу clientID, доступ к каждому шарду защищен мьютексом.
 type BucketStore struct {
-	buckets           map[string]*Bucket // Map для хранения бакетов, ключ - clientID.
-	mu                sync.RWMutex       // Мьютекс для потокобезопасного доступа к map бакетов.
-	defaultCapacity   int64              // Емкость бакета по умолчанию.
-	defaultRefillRate float64            // Скорость пополнения по умолчанию (токенов в секунду).
-	limitProvider     LimitProvider      // Необязательный провайдер для получения кастомных лимитов.
+	shards            [storeShards]storeShard
+	defaultCapacity   int64         // Емкость бакета по умолчанию.
+	defaultRefillRate float64       // Скорость пополнения по умолчанию (токенов в секунду).
+	limitProvider     LimitProvider // Необязательный провайдер для получения кастомных лимитов.
+	clock             Clock         // Источник времени для бакетов и очистки.
+	lazy              lazyCleanup   // Ленивая очистка (см. Limiter.SetCleanupPolicy).
+
+	count    atomic.Int64  // Текущее количество бакетов.
+	keyBytes atomic.Int64  // Суммарная длина ключей (clientID).
+	created  atomic.Uint64 // Создано бакетов с момента запуска.
+	evicted  atomic.Uint64 // Удалено неактивных бакетов с момента запуска.
+	// Значения счетчиков на момент последней очистки - база для расчета скоростей в Stats.
+	sample atomic.Pointer[rateSample]
+}
+
+// rateSample - значения счетчиков создания и удаления бакетов в момент времени.
+type rateSample struct {
+	at      time.Time
+	created uint64
+	evicted uint64
+}
+
+// StoreStats - состояние хранилища бакетов для Admin API.
+type StoreStats struct {
+	Buckets        int64   `json:"buckets"`
+	Shards         []int   `json:"shard_occupancy"` // Количество бакетов в каждом шарде.
+	CreatedTotal   uint64  `json:"created_total"`
+	EvictedTotal   uint64  `json:"evicted_total"`
+	CreationRate   float64 `json:"creation_rate_per_second"` // С момента последней очистки.
+	EvictionRate   float64 `json:"eviction_rate_per_second"` // За последний интервал очистки.
+	EstimatedBytes int64   `json:"estimated_memory_bytes"`
 }
 
 // NewBucketStore создает новое, пустое хранилище BucketStore.
 // Принимает параметры по умолчанию (capacity, rate) и необязательный LimitProvider.
-// Возвращает nil, если параметры по умолчанию невалидны.
-func NewBucketStore(defaultCapacity int64, defaultRefillRate float64, provider LimitProvider) *BucketStore {
-	if defaultCapacity <= 0 || defaultRefillRate <= 0 {
-		log.Printf("ERROR: Invalid default parameters for NewBucketStore: capacity=%d, rate=%.2f", defaultCapacity, defaultRefillRate)
-		return nil
+// Возвращает ErrInvalidCapacity или ErrInvalidRate, если параметры по умолчанию невалидны.
+func NewBucketStore(defaultCapacity int64, defaultRefillRate float64, provider LimitProvider) (*BucketStore, error) {
+	if err := validateLimits(defaultCapacity, defaultRefillRate); err != nil {
+		return nil, fmt.Errorf("invalid default limits: %w", err)
 	}
 	store := &BucketStore{
-		buckets:           make(map[string]*Bucket),
 		defaultCapacity:   defaultCapacity,
 		defaultRefillRate: defaultRefillRate,
 		limitProvider:     provider,
+		clock:             RealClock,
+	}
+	for i := range store.shards {
+		store.shards[i].buckets = make(map[string]*Bucket)
+		store.shards[i].label = strconv.Itoa(i)
 	}
+	store.sample.Store(&rateSample{at: store.clock.Now()})
 	if provider != nil {
 		log.Println("INFO: BucketStore initialized with a custom LimitProvider.")
 	} else {
 		log.Println("INFO: BucketStore initialized without a custom LimitProvider (using defaults only).")
 	}
-	return store
+	return store, nil
+}
+
+// SetClock задает источник времени для создаваемых бакетов и фоновой очистки Limiter.
+// Должен вызываться до начала использования хранилища.
+func (s *BucketStore) SetClock(clock Clock) {
+	if clock == nil {
+		clock = RealClock
+	}
+	s.clock = clock
+	s.sample.Store(&rateSample{at: clock.Now()})
+}
+
+// Len возвращает текущее количество бакетов в хранилище.
+func (s *BucketStore) Len() int {
+	return int(s.count.Load())
+}
+
+// shard возвращает шард, в котором хранится бакет клиента.
+func (s *BucketStore) shard(clientID string) *storeShard {
+	h := fnv.New32a()
+	h.Write([]byte(clientID))
+	return &s.shards[h.Sum32()%storeShards]
 }
 
 // GetOrCreateBucket возвращает существующий Bucket для данного clientID или создает новый,
@@ -55,20 +144,26 @@ func NewBucketStore(defaultCapacity int64, defaultRefillRate float64, provider L
 // кастомные лимиты через limitProvider. Если они не найдены или невалидны,
 // используются лимиты по умолчанию. Метод потокобезопасен.
 func (s *BucketStore) GetOrCreateBucket(clientID string) *Bucket {
-	s.mu.RLock()
-	bucket, exists := s.buckets[clientID]
-	s.mu.RUnlock()
+	shard := s.shard(clientID)
+	shard.mu.RLock()
+	bucket, exists := shard.buckets[clientID]
+	shard.mu.RUnlock()
 
-	if exists {
+	if exists && !s.expired(bucket) {
 		return bucket
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	bucket, exists = s.buckets[clientID]
+	bucket, exists = shard.buckets[clientID]
 	if exists {
-		return bucket
+		if !s.expired(bucket) {
+			return bucket
+		}
+		// Ленивая очистка: бакет неактивного клиента пересоздается с актуальными лимитами.
+		delete(shard.buckets, clientID)
+		s.recordEvicted(shard, clientID)
 	}
 
 	capacity := s.defaultCapacity
@@ -89,15 +184,105 @@ func (s *BucketStore) GetOrCreateBucket(clientID string) *Bucket {
 		}
 	}
 
-	newBucket := NewBucket(capacity, rate)
-	if newBucket == nil {
-		log.Printf("ERROR: Failed to create new bucket for client %s with capacity %d, rate %.2f", clientID, capacity, rate)
+	newBucket, err := NewBucketWithClock(capacity, rate, s.clock)
+	if err != nil {
+		log.Printf("ERROR: Failed to create new bucket for client %s: %v", clientID, err)
 		return nil
 	}
 
-	s.buckets[clientID] = newBucket
+	shard.buckets[clientID] = newBucket
+	s.recordCreated(shard, clientID)
+	s.maybeSweep()
 	if !isCustom {
 		log.Printf("INFO: Created new bucket for client %s (Default Capacity: %d, Default Rate: %.2f/s)", clientID, capacity, rate)
 	}
 	return newBucket
 }
+
+// peekBucket возвращает существующий актуальный бакет клиента, не создавая новый
+// (nil, если бакета нет).
+func (s *BucketStore) peekBucket(clientID string) *Bucket {
+	shard := s.shard(clientID)
+	shard.mu.RLock()
+	bucket, exists := shard.buckets[clientID]
+	shard.mu.RUnlock()
+	if !exists || s.expired(bucket) {
+		return nil
+	}
+	return bucket
+}
+
+// removeInactive удаляет бакеты, неактивные дольше threshold, и возвращает их количество.
+// Фиксирует базу для расчета скоростей создания и удаления бакетов (см. Stats).
+func (s *BucketStore) removeInactive(threshold time.Duration) int {
+	removed := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for id, bucket := range shard.buckets {
+			if bucket.IsInactive(threshold) {
+				delete(shard.buckets, id)
+				s.recordEvicted(shard, id)
+				removed++
+				log.Printf("DEBUG: Cleaned up inactive bucket for client %s", id)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	s.sample.Store(&rateSample{at: s.clock.Now(), created: s.created.Load(), evicted: s.evicted.Load()})
+	return removed
+}
+
+// Stats возвращает текущее состояние хранилища: количество бакетов, заполненность шардов,
+// счетчики и скорости создания и удаления бакетов, а также оценку занимаемой памяти.
+// Скорости рассчитываются с момента последней очистки неактивных бакетов.
+func (s *BucketStore) Stats() StoreStats {
+	stats := StoreStats{
+		Buckets:        s.count.Load(),
+		Shards:         make([]int, storeShards),
+		CreatedTotal:   s.created.Load(),
+		EvictedTotal:   s.evicted.Load(),
+		EstimatedBytes: s.estimatedBytes(),
+	}
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		stats.Shards[i] = len(shard.buckets)
+		shard.mu.RUnlock()
+	}
+	sample := s.sample.Load()
+	if elapsed := s.clock.Now().Sub(sample.at).Seconds(); elapsed > 0 {
+		stats.CreationRate = float64(stats.CreatedTotal-sample.created) / elapsed
+		stats.EvictionRate = float64(stats.EvictedTotal-sample.evicted) / elapsed
+	}
+	return stats
+}
+
+// estimatedBytes оценивает память, занимаемую бакетами и их ключами.
+func (s *BucketStore) estimatedBytes() int64 {
+	return s.count.Load()*bucketOverheadBytes + s.keyBytes.Load()
+}
+
+// recordCreated учитывает новый бакет в счетчиках и метриках. Вызывается под блокировкой шарда.
+func (s *BucketStore) recordCreated(shard *storeShard, clientID string) {
+	s.count.Add(1)
+	s.keyBytes.Add(int64(len(clientID)))
+	s.created.Add(1)
+	s.updateMetrics(shard)
+	storeBucketsCreatedTotal.With().Inc()
+}
+
+// recordEvicted учитывает удаленный бакет в счетчиках и метриках. Вызывается под блокировкой шарда.
+func (s *BucketStore) recordEvicted(shard *storeShard, clientID string) {
+	s.count.Add(-1)
+	s.keyBytes.Add(-int64(len(clientID)))
+	s.evicted.Add(1)
+	s.updateMetrics(shard)
+	storeBucketsEvictedTotal.With().Inc()
+}
+
+func (s *BucketStore) updateMetrics(shard *storeShard) {
+	storeShardBuckets.With(shard.label).Set(float64(len(shard.buckets)))
+	storeBuckets.With().Set(float64(s.count.Load()))
+	storeMemoryBytes.With().Set(float64(s.estimatedBytes()))
+}
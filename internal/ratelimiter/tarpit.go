@@ -0,0 +1,56 @@
+package ratelimiter
+
+import (
+	"log"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var (
+	tarpitRequestsTotal = metrics.NewCounterVec("lb_ratelimit_tarpit_requests_total",
+		"Requests delayed by the rate limiter tarpit.")
+	tarpitDelaySecondsTotal = metrics.NewCounterVec("lb_ratelimit_tarpit_delay_seconds_total",
+		"Total artificial delay injected by the rate limiter tarpit.")
+)
+
+// TarpitPolicy задает прогрессивный режим: когда клиент израсходовал больше Threshold
+// (доля от 0 до 1) емкости своего бакета, запрос задерживается, и задержка линейно растет
+// до MaxDelay по мере приближения к лимиту. Так злоупотребляющие клиенты замедляются
+// плавно, а не упираются сразу в 429.
+type TarpitPolicy struct {
+	Enabled   bool
+	Threshold float64
+	MaxDelay  time.Duration
+}
+
+// delay вычисляет задержку для запроса по доле оставшейся емкости бакета.
+func (p TarpitPolicy) delay(remaining float64) time.Duration {
+	if !p.Enabled || p.MaxDelay <= 0 {
+		return 0
+	}
+	used := 1 - remaining
+	if used <= p.Threshold {
+		return 0
+	}
+	fraction := (used - p.Threshold) / (1 - p.Threshold)
+	if fraction > 1 {
+		fraction = 1
+	}
+	return time.Duration(fraction * float64(p.MaxDelay))
+}
+
+// SetTarpitPolicy включает или изменяет прогрессивный режим (см. TarpitPolicy).
+// Должен вызываться до начала обработки запросов.
+func (l *Limiter) SetTarpitPolicy(policy TarpitPolicy) {
+	l.tarpit = policy
+	if policy.Enabled {
+		log.Printf("INFO: Rate limiter tarpit enabled: delay starts at %.0f%% bucket usage, up to %v", policy.Threshold*100, policy.MaxDelay)
+	}
+}
+
+// recordTarpit учитывает задержку в метриках.
+func recordTarpit(delay time.Duration) {
+	tarpitRequestsTotal.With().Inc()
+	tarpitDelaySecondsTotal.With().Add(delay.Seconds())
+}
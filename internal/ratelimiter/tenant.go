@@ -0,0 +1,239 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var (
+	tenantRejectsTotal = metrics.NewCounterVec("lb_ratelimit_tenant_rejects_total",
+		"Requests rejected because the tenant's shared limit was exhausted.")
+	tenantIgnoredTotal = metrics.NewCounterVec("lb_ratelimit_tenant_ignored_total",
+		"Requests checked without a tenant limit, by reason (invalid, overflow).", "reason")
+)
+
+const (
+	// TenantLimitPrefix - префикс идентификатора, под которым кастомные лимиты тенантов
+	// запрашиваются у LimitProvider (например, "tenant:acme").
+	TenantLimitPrefix = "tenant:"
+	// DefaultMaxTenants - число бакетов тенантов по умолчанию (см. TenantPolicy.MaxTenants).
+	DefaultMaxTenants = 10000
+
+	maxTenantLength = 128
+)
+
+// TenantPolicy задает двухуровневое ограничение: запрос расходует токен из бакета клиента
+// и из общего бакета его тенанта (организации), который определяется по заголовку Header.
+// Так один активный клиент не исчерпает квоту всей организации, а организация в целом
+// не превысит свою квоту, сколько бы клиентов у нее ни было.
+//
+// Заголовок Header должен выставляться (или перезаписываться) доверенным прокси перед
+// балансировщиком: иначе клиент выбирает тенанта сам. Идентификаторы длиннее 128 символов
+// или с символами вне [A-Za-z0-9._:@-] игнорируются.
+type TenantPolicy struct {
+	Enabled    bool
+	Header     string  // Заголовок запроса с идентификатором тенанта.
+	Capacity   int64   // Емкость бакета тенанта по умолчанию.
+	RefillRate float64 // Скорость пополнения бакета тенанта по умолчанию (токенов в секунду).
+	// Максимальное число бакетов тенантов (0 - DefaultMaxTenants). Когда оно достигнуто,
+	// запросы новых тенантов проверяются только лимитом клиента, пока очистка не удалит
+	// неактивные бакеты.
+	MaxTenants int
+}
+
+// tenantLimits хранит бакеты тенантов в одной map без шардирования; ее размер ограничен
+// TenantPolicy.MaxTenants, а неактивные бакеты удаляются фоновой очисткой лимитера.
+type tenantLimits struct {
+	mu       sync.Mutex
+	policy   TenantPolicy
+	buckets  map[string]*Bucket
+	overflow bool // Достигнут MaxTenants (предупреждение уже записано в лог).
+}
+
+// SetTenantPolicy включает или изменяет лимиты тенантов (см. TenantPolicy).
+// Кастомные лимиты тенанта запрашиваются у LimitProvider по идентификатору
+// TenantLimitPrefix + tenant. Должен вызываться до начала обработки запросов.
+func (l *Limiter) SetTenantPolicy(policy TenantPolicy) error {
+	if policy.Enabled {
+		if policy.Header == "" {
+			return errors.New("tenant header must be specified")
+		}
+		if err := validateLimits(policy.Capacity, policy.RefillRate); err != nil {
+			return fmt.Errorf("invalid tenant limits: %w", err)
+		}
+		if policy.MaxTenants < 0 {
+			return errors.New("max tenants must not be negative")
+		}
+	}
+	if policy.MaxTenants == 0 {
+		policy.MaxTenants = DefaultMaxTenants
+	}
+	l.tenants.mu.Lock()
+	defer l.tenants.mu.Unlock()
+	l.tenants.policy = policy
+	l.tenants.buckets = make(map[string]*Bucket)
+	l.tenants.overflow = false
+	if policy.Enabled {
+		log.Printf("INFO: Rate limiter tenant limits enabled: header %s, capacity=%d, rate=%.2f/s, max tenants %d", policy.Header, policy.Capacity, policy.RefillRate, policy.MaxTenants)
+	}
+	return nil
+}
+
+// TenantHeader возвращает заголовок с идентификатором тенанта ("" - лимиты тенантов отключены).
+func (l *Limiter) TenantHeader() string {
+	l.tenants.mu.Lock()
+	defer l.tenants.mu.Unlock()
+	if !l.tenants.policy.Enabled {
+		return ""
+	}
+	return l.tenants.policy.Header
+}
+
+// CheckTenant работает как Check и дополнительно расходует токен из бакета тенанта.
+// Если бакет тенанта пуст, запрос отклоняется (Decision.TenantLimited), а токен клиента
+// возвращается. Отказы по лимиту тенанта не учитываются политикой бана клиента.
+// Пустой tenant означает проверку только лимита клиента.
+func (l *Limiter) CheckTenant(clientID, tenant string) Decision {
+	return l.CheckRequest(clientID, tenant, RequestAttributes{})
+}
+
+// CheckRequest работает как CheckTenant, но если запрос с атрибутами req подходит под одно
+// из правил (см. SetRequestRules), токен расходуется из бакета клиента для этого правила
+// вместо основного. Имя правила возвращается в Decision.Rule.
+func (l *Limiter) CheckRequest(clientID, tenant string, req RequestAttributes) Decision {
+	decision := l.checkRequest(clientID, tenant, req)
+	now := l.store.clock.Now()
+	l.usage.record(clientID, decision.Allowed, now)
+	l.breaches.record(clientID, decision, now)
+	return decision
+}
+
+// checkRequest выполняет проверку CheckRequest без учета в счетчиках использования
+// и уведомлениях о превышении порога отказов.
+func (l *Limiter) checkRequest(clientID, tenant string, req RequestAttributes) Decision {
+	rule, userBucket := l.ruleBucket(clientID, req)
+	if rule == "" {
+		userBucket = l.store.GetOrCreateBucket(clientID)
+	}
+	decision := l.checkBucket(clientID, userBucket)
+	decision.Rule = rule
+	if !decision.Allowed {
+		if rule != "" && !decision.Banned {
+			ruleRejectsTotal.With(rule).Inc()
+		}
+		return decision
+	}
+	if tenant == "" {
+		return decision
+	}
+	bucket := l.tenantBucket(tenant)
+	if bucket == nil || bucket.Allow() {
+		return decision
+	}
+	if userBucket != nil {
+		userBucket.refund()
+	}
+	tenantRejectsTotal.With().Inc()
+	return Decision{TenantLimited: true, Rule: rule}
+}
+
+// tenantBucket возвращает бакет тенанта, создавая его при первом обращении (nil, если
+// лимиты тенантов отключены, идентификатор тенанта невалиден или достигнут MaxTenants).
+// Кастомный лимит запрашивается у LimitProvider без блокировки: провайдер может обращаться
+// к внешнему хранилищу.
+func (l *Limiter) tenantBucket(tenant string) *Bucket {
+	policy, bucket := l.tenants.get(tenant)
+	if !policy.Enabled || bucket != nil {
+		return bucket
+	}
+	if !validTenant(tenant) {
+		tenantIgnoredTotal.With("invalid").Inc()
+		return nil
+	}
+
+	capacity, rate := policy.Capacity, policy.RefillRate
+	custom := false
+	if provider := l.store.limitProvider; provider != nil {
+		if c, r, found := provider.GetLimit(TenantLimitPrefix + tenant); found && c > 0 && r > 0 {
+			capacity, rate, custom = c, r, true
+		}
+	}
+	bucket, err := NewBucketWithClock(capacity, rate, l.store.clock)
+	if err != nil {
+		log.Printf("ERROR: Failed to create bucket for tenant %s: %v", tenant, err)
+		return nil
+	}
+	bucket, created := l.tenants.add(tenant, bucket)
+	if created && custom {
+		log.Printf("INFO: Using custom rate limit for tenant %s: capacity=%d, rate=%.2f/s", tenant, capacity, rate)
+	}
+	return bucket
+}
+
+// get возвращает текущую политику и бакет тенанта (nil, если бакета еще нет).
+func (t *tenantLimits) get(tenant string) (TenantPolicy, *Bucket) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.policy, t.buckets[tenant]
+}
+
+// add сохраняет бакет тенанта, если его не создал параллельный запрос, и возвращает
+// сохраненный бакет; created сообщает, что сохранен именно bucket. Если достигнут
+// MaxTenants, бакет не сохраняется и возвращается nil.
+func (t *tenantLimits) add(tenant string, bucket *Bucket) (saved *Bucket, created bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.policy.Enabled {
+		return nil, false
+	}
+	if existing, ok := t.buckets[tenant]; ok {
+		return existing, false
+	}
+	if len(t.buckets) >= t.policy.MaxTenants {
+		if !t.overflow {
+			t.overflow = true
+			log.Printf("WARN: Rate limiter tenant limit reached (%d tenants): new tenants are checked by client limits only until inactive tenants expire", t.policy.MaxTenants)
+		}
+		tenantIgnoredTotal.With("overflow").Inc()
+		return nil, false
+	}
+	t.buckets[tenant] = bucket
+	return bucket, true
+}
+
+// cleanup удаляет бакеты тенантов, неактивные дольше threshold.
+func (t *tenantLimits) cleanup(threshold time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for tenant, bucket := range t.buckets {
+		if bucket.IsInactive(threshold) {
+			delete(t.buckets, tenant)
+		}
+	}
+	if t.overflow && len(t.buckets) < t.policy.MaxTenants {
+		t.overflow = false
+		log.Printf("INFO: Rate limiter tenant buckets below the limit again (%d tenants)", len(t.buckets))
+	}
+}
+
+// validTenant сообщает, допустим ли идентификатор тенанта из заголовка запроса.
+func validTenant(tenant string) bool {
+	if len(tenant) > maxTenantLength {
+		return false
+	}
+	for _, c := range tenant {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("._:@-", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
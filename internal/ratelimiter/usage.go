@@ -0,0 +1,443 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud/load_balancer/internal/metrics"
+)
+
+var usageEvictedTotal = metrics.NewCounterVec("lb_ratelimit_usage_evicted_total",
+	"Clients whose usage counters were dropped to make room for new clients because max_clients clients are already tracked.")
+
+// Кольцевые счетчики использования лимитов: минутные слоты за последний час и часовые
+// слоты за последние сутки.
+const (
+	usageMinuteSlots = 60
+	usageHourSlots   = 24
+	usageRetention   = usageHourSlots * time.Hour
+	// DefaultMaxUsageClients - число клиентов со счетчиками по умолчанию (см. UsagePolicy.MaxClients).
+	DefaultMaxUsageClients = 10000
+	// usageShards - число шардов счетчиков: как и в BucketStore, запросы разных клиентов
+	// обновляют счетчики под разными мьютексами.
+	usageShards = 16
+)
+
+// UsageWindows - окна, за которые сообщается использование лимитов клиента (см. Limiter.Usage).
+// Окна до часа считаются по минутным слотам, окно в сутки - по часовым.
+var UsageWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 24 * time.Hour}
+
+// UsagePolicy задает учет использования лимитов клиентами.
+type UsagePolicy struct {
+	Enabled bool
+	// Максимальное число клиентов со счетчиками (0 - DefaultMaxUsageClients). Когда оно
+	// достигнуто, для нового клиента удаляются счетчики десятой части клиентов с самым
+	// давним последним запросом.
+	MaxClients int
+	// Store сохраняет счетчики между перезапусками (nil - только в памяти). Счетчики
+	// сохраняются при каждой очистке лимитера и при остановке (см. Stop).
+	Store UsageStore
+}
+
+// UsageStore - хранилище счетчиков использования лимитов.
+type UsageStore interface {
+	// SaveUsage заменяет сохраненные счетчики клиентов clientIDs на records (клиент без
+	// записей в records удаляется из хранилища) и удаляет счетчики слотов, начавшихся раньше
+	// before. Счетчики остальных клиентов не изменяются.
+	SaveUsage(clientIDs []string, records []UsageRecord, before time.Time) error
+	// LoadUsage возвращает сохраненные счетчики слотов, начавшихся не раньше since.
+	LoadUsage(since time.Time) ([]UsageRecord, error)
+}
+
+// UsageRecord - счетчики одного слота использования лимитов клиента.
+type UsageRecord struct {
+	ClientID string
+	Start    time.Time     // Начало слота.
+	Period   time.Duration // Длительность слота: минута или час.
+	Allowed  int64
+	Denied   int64
+}
+
+// WindowUsage - число разрешенных и отклоненных запросов клиента за окно Window.
+type WindowUsage struct {
+	Window  time.Duration
+	Allowed int64
+	Denied  int64
+}
+
+// BucketLevel - текущее состояние бакета клиента.
+type BucketLevel struct {
+	Capacity   int64
+	RefillRate float64
+	Tokens     int64 // Доступные токены.
+}
+
+// ClientUsage - использование лимитов клиентом за окна UsageWindows.
+type ClientUsage struct {
+	ClientID string
+	LastSeen time.Time
+	Windows  []WindowUsage
+	// Состояние основного бакета клиента (nil - бакет не создан или удален как неактивный).
+	Bucket *BucketLevel
+}
+
+// usageSlot - счетчики слота с номером index (время начала, деленное на длительность слота).
+type usageSlot struct {
+	index   int64
+	allowed int64
+	denied  int64
+}
+
+type clientUsage struct {
+	minutes  [usageMinuteSlots]usageSlot
+	hours    [usageHourSlots]usageSlot
+	lastSeen time.Time
+	stored   bool // Счетчики клиента могут быть в хранилище.
+}
+
+// usageShard - часть счетчиков клиентов со своей блокировкой.
+type usageShard struct {
+	mu      sync.Mutex
+	clients map[string]*clientUsage
+	changed map[string]struct{} // Клиенты, счетчики которых изменились или удалены после сохранения.
+}
+
+// usageTracker хранит кольцевые счетчики использования лимитов клиентов, распределенные
+// по шардам по хешу clientID. Учет запроса блокирует только шард клиента; операции над
+// всеми клиентами (вытеснение, очистка, смена политики) упорядочены мьютексом mu, который
+// захватывается раньше мьютексов шардов.
+type usageTracker struct {
+	mu       sync.Mutex
+	policy   atomic.Pointer[UsagePolicy] // nil - учет отключен.
+	shards   [usageShards]usageShard
+	count    atomic.Int64 // Число клиентов со счетчиками.
+	overflow bool         // Достигнут MaxClients (предупреждение уже записано в лог). Защищен mu.
+}
+
+// shard возвращает шард, в котором хранятся счетчики клиента.
+func (u *usageTracker) shard(clientID string) *usageShard {
+	h := fnv.New32a()
+	h.Write([]byte(clientID))
+	return &u.shards[h.Sum32()%usageShards]
+}
+
+// lockShards захватывает мьютексы всех шардов и возвращает функцию их освобождения.
+func (u *usageTracker) lockShards() func() {
+	for i := range u.shards {
+		u.shards[i].mu.Lock()
+	}
+	return func() {
+		for i := range u.shards {
+			u.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// SetUsagePolicy включает учет использования лимитов клиентами (см. Usage). Если задано
+// хранилище, из него загружаются счетчики за последние сутки. Должен вызываться до начала
+// обработки запросов.
+func (l *Limiter) SetUsagePolicy(policy UsagePolicy) error {
+	if policy.MaxClients < 0 {
+		return fmt.Errorf("usage max clients must not be negative")
+	}
+	if policy.MaxClients == 0 {
+		policy.MaxClients = DefaultMaxUsageClients
+	}
+	u := &l.usage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	unlock := u.lockShards()
+	for i := range u.shards {
+		u.shards[i].clients = make(map[string]*clientUsage)
+		u.shards[i].changed = make(map[string]struct{})
+	}
+	u.count.Store(0)
+	u.overflow = false
+	u.policy.Store(&policy)
+	if !policy.Enabled || policy.Store == nil {
+		unlock()
+		return nil
+	}
+	now := l.store.clock.Now()
+	records, err := policy.Store.LoadUsage(now.Add(-usageRetention))
+	if err != nil {
+		unlock()
+		return err
+	}
+	for _, r := range records {
+		u.restore(r)
+	}
+	if extra := int(u.count.Load()) - policy.MaxClients; extra > 0 {
+		u.evict(extra)
+	}
+	unlock()
+	log.Printf("INFO: Restored %d usage counters for %d clients.", len(records), u.count.Load())
+	return nil
+}
+
+// UsageEnabled сообщает, включен ли учет использования лимитов.
+func (l *Limiter) UsageEnabled() bool {
+	policy := l.usage.policy.Load()
+	return policy != nil && policy.Enabled
+}
+
+// Usage возвращает использование лимитов клиентом за окна UsageWindows. Возвращает
+// found=false, если учет отключен или запросов клиента за последние сутки не было.
+func (l *Limiter) Usage(clientID string) (ClientUsage, bool) {
+	now := l.store.clock.Now()
+	shard := l.usage.shard(clientID)
+	shard.mu.Lock()
+	c, ok := shard.clients[clientID]
+	if !ok {
+		shard.mu.Unlock()
+		return ClientUsage{}, false
+	}
+	usage := ClientUsage{ClientID: clientID, LastSeen: c.lastSeen}
+	for _, window := range UsageWindows {
+		allowed, denied := c.sum(now, window)
+		usage.Windows = append(usage.Windows, WindowUsage{Window: window, Allowed: allowed, Denied: denied})
+	}
+	shard.mu.Unlock()
+
+	if bucket := l.store.peekBucket(clientID); bucket != nil {
+		level := bucket.level()
+		usage.Bucket = &level
+	}
+	return usage, true
+}
+
+// record учитывает решение по запросу клиента. Блокирует только шард клиента; место для
+// нового клиента при достижении MaxClients освобождает makeRoom.
+func (u *usageTracker) record(clientID string, allowed bool, now time.Time) {
+	policy := u.policy.Load()
+	if policy == nil || !policy.Enabled {
+		return
+	}
+	shard := u.shard(clientID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	c, ok := shard.clients[clientID]
+	for !ok {
+		// Место для клиента резервируется атомарно, чтобы параллельные запросы новых
+		// клиентов не превысили MaxClients.
+		if n := u.count.Load(); n < int64(policy.MaxClients) {
+			if u.count.CompareAndSwap(n, n+1) {
+				c = &clientUsage{}
+				shard.clients[clientID] = c
+				break
+			}
+			continue
+		}
+		// Вытеснение захватывает мьютексы всех шардов, поэтому шард клиента освобождается.
+		shard.mu.Unlock()
+		u.makeRoom(policy.MaxClients)
+		shard.mu.Lock()
+		c, ok = shard.clients[clientID]
+	}
+	c.lastSeen = now
+	if policy.Store != nil {
+		shard.changed[clientID] = struct{}{}
+	}
+	for _, slot := range []*usageSlot{
+		c.slot(c.minutes[:], now, time.Minute),
+		c.slot(c.hours[:], now, time.Hour),
+	} {
+		if allowed {
+			slot.allowed++
+		} else {
+			slot.denied++
+		}
+	}
+}
+
+// makeRoom удаляет счетчики десятой части клиентов с самым давним последним запросом,
+// если отслеживается maxClients клиентов или больше.
+func (u *usageTracker) makeRoom(maxClients int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	count := int(u.count.Load())
+	if count < maxClients {
+		// Место уже освобождено другим запросом.
+		return
+	}
+	if !u.overflow {
+		u.overflow = true
+		log.Printf("WARN: Rate limit usage tracks %d clients: counters of the least active clients are dropped for new clients", maxClients)
+	}
+	unlock := u.lockShards()
+	u.evict(max(count/10, 1))
+	unlock()
+}
+
+// slot возвращает слот кольца ring длительностью period, содержащий момент now,
+// сбрасывая устаревший слот.
+func (c *clientUsage) slot(ring []usageSlot, now time.Time, period time.Duration) *usageSlot {
+	index := now.Unix() / int64(period.Seconds())
+	slot := &ring[index%int64(len(ring))]
+	if slot.index != index {
+		*slot = usageSlot{index: index}
+	}
+	return slot
+}
+
+// sum возвращает счетчики за окно window, заканчивающееся в now.
+func (c *clientUsage) sum(now time.Time, window time.Duration) (allowed, denied int64) {
+	ring, period := c.minutes[:], time.Minute
+	if window > time.Hour {
+		ring, period = c.hours[:], time.Hour
+	}
+	current := now.Unix() / int64(period.Seconds())
+	oldest := current - int64(window/period) + 1
+	for _, slot := range ring {
+		if slot.index >= oldest && slot.index <= current {
+			allowed += slot.allowed
+			denied += slot.denied
+		}
+	}
+	return allowed, denied
+}
+
+// restore добавляет сохраненный слот к счетчикам клиента. Вызывается с захваченными
+// мьютексами всех шардов.
+func (u *usageTracker) restore(r UsageRecord) {
+	shard := u.shard(r.ClientID)
+	c, ok := shard.clients[r.ClientID]
+	if !ok {
+		c = &clientUsage{stored: true}
+		shard.clients[r.ClientID] = c
+		u.count.Add(1)
+	}
+	ring := c.minutes[:]
+	if r.Period == time.Hour {
+		ring = c.hours[:]
+	}
+	slot := c.slot(ring, r.Start, r.Period)
+	slot.allowed += r.Allowed
+	slot.denied += r.Denied
+	if end := r.Start.Add(r.Period); end.After(c.lastSeen) {
+		c.lastSeen = end
+	}
+}
+
+// evict удаляет счетчики count клиентов с самым давним последним запросом.
+// Вызывается с захваченными мьютексами всех шардов.
+func (u *usageTracker) evict(count int) {
+	type candidate struct {
+		clientID string
+		shard    *usageShard
+		lastSeen time.Time
+	}
+	var candidates []candidate
+	for i := range u.shards {
+		shard := &u.shards[i]
+		for clientID, c := range shard.clients {
+			candidates = append(candidates, candidate{clientID, shard, c.lastSeen})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastSeen.Before(candidates[j].lastSeen)
+	})
+	for _, c := range candidates[:min(count, len(candidates))] {
+		u.remove(c.shard, c.clientID)
+		usageEvictedTotal.With().Inc()
+	}
+}
+
+// remove удаляет счетчики клиента из шарда shard; если они могут быть в хранилище, они
+// удаляются из него при следующем сохранении. Вызывается с захваченным shard.mu.
+func (u *usageTracker) remove(shard *usageShard, clientID string) {
+	c := shard.clients[clientID]
+	if c == nil {
+		return
+	}
+	if c.stored {
+		shard.changed[clientID] = struct{}{}
+	} else {
+		delete(shard.changed, clientID)
+	}
+	delete(shard.clients, clientID)
+	u.count.Add(-1)
+}
+
+// cleanup удаляет счетчики клиентов без запросов за последние сутки и сохраняет изменения
+// в хранилище (если оно задано).
+func (u *usageTracker) cleanup(now time.Time) {
+	u.mu.Lock()
+	for i := range u.shards {
+		shard := &u.shards[i]
+		shard.mu.Lock()
+		for clientID, c := range shard.clients {
+			if now.Sub(c.lastSeen) > usageRetention {
+				u.remove(shard, clientID)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	if policy := u.policy.Load(); u.overflow && policy != nil && u.count.Load() < int64(policy.MaxClients) {
+		u.overflow = false
+	}
+	u.mu.Unlock()
+	u.persist(now)
+}
+
+// persist сохраняет в хранилище (если оно задано) счетчики клиентов, изменившиеся после
+// предыдущего сохранения. Если сохранить не удалось, они сохраняются в следующий раз.
+func (u *usageTracker) persist(now time.Time) {
+	policy := u.policy.Load()
+	if policy == nil || !policy.Enabled || policy.Store == nil {
+		return
+	}
+	var clientIDs []string
+	var records []UsageRecord
+	for i := range u.shards {
+		shard := &u.shards[i]
+		shard.mu.Lock()
+		for clientID := range shard.changed {
+			clientIDs = append(clientIDs, clientID)
+			if c := shard.clients[clientID]; c != nil {
+				c.stored = true
+				records = c.appendRecords(records, clientID, now)
+			}
+		}
+		shard.changed = make(map[string]struct{})
+		shard.mu.Unlock()
+	}
+
+	if err := policy.Store.SaveUsage(clientIDs, records, now.Add(-usageRetention)); err != nil {
+		log.Printf("ERROR: Failed to persist rate limit usage counters: %v", err)
+		for _, clientID := range clientIDs {
+			shard := u.shard(clientID)
+			shard.mu.Lock()
+			shard.changed[clientID] = struct{}{}
+			shard.mu.Unlock()
+		}
+	}
+}
+
+// appendRecords добавляет к records непустые актуальные слоты клиента.
+func (c *clientUsage) appendRecords(records []UsageRecord, clientID string, now time.Time) []UsageRecord {
+	for _, ring := range []struct {
+		slots  []usageSlot
+		period time.Duration
+	}{{c.minutes[:], time.Minute}, {c.hours[:], time.Hour}} {
+		current := now.Unix() / int64(ring.period.Seconds())
+		for _, slot := range ring.slots {
+			if slot.allowed+slot.denied == 0 || current-slot.index >= int64(len(ring.slots)) {
+				continue
+			}
+			records = append(records, UsageRecord{
+				ClientID: clientID,
+				Start:    time.Unix(slot.index*int64(ring.period.Seconds()), 0).UTC(),
+				Period:   ring.period,
+				Allowed:  slot.allowed,
+				Denied:   slot.denied,
+			})
+		}
+	}
+	return records
+}
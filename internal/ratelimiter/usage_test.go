@@ -0,0 +1,216 @@
+package ratelimiter_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+	"cloud/load_balancer/internal/ratelimiter/ratelimitertest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryUsageStore - хранилище счетчиков использования в памяти для тестов.
+type memoryUsageStore struct {
+	records []rl.UsageRecord
+	saved   [][]string // Клиенты каждого сохранения.
+}
+
+func (s *memoryUsageStore) SaveUsage(clientIDs []string, records []rl.UsageRecord, before time.Time) error {
+	replaced := make(map[string]bool)
+	for _, clientID := range clientIDs {
+		replaced[clientID] = true
+	}
+	kept := records
+	for _, r := range s.records {
+		if !replaced[r.ClientID] && !r.Start.Before(before) {
+			kept = append(kept, r)
+		}
+	}
+	s.records = kept
+	s.saved = append(s.saved, clientIDs)
+	return nil
+}
+
+func (s *memoryUsageStore) LoadUsage(since time.Time) ([]rl.UsageRecord, error) {
+	var records []rl.UsageRecord
+	for _, r := range s.records {
+		if !r.Start.Before(since) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func windowUsage(t *testing.T, usage rl.ClientUsage, window time.Duration) rl.WindowUsage {
+	t.Helper()
+	for _, w := range usage.Windows {
+		if w.Window == window {
+			return w
+		}
+	}
+	t.Fatalf("window %v not reported", window)
+	return rl.WindowUsage{}
+}
+
+// TestLimiter_Usage проверяет учет разрешенных и отклоненных запросов по окнам.
+func TestLimiter_Usage(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 2, 1, time.Hour)
+	require.NoError(t, limiter.SetUsagePolicy(rl.UsagePolicy{Enabled: true}))
+
+	_, found := limiter.Usage("client")
+	assert.False(t, found)
+
+	for range 3 {
+		limiter.Check("client")
+	}
+	clock.Advance(10 * time.Minute)
+	limiter.CheckRequest("client", "", rl.RequestAttributes{})
+
+	usage, found := limiter.Usage("client")
+	require.True(t, found)
+	assert.Equal(t, rl.WindowUsage{Window: time.Minute, Allowed: 1}, windowUsage(t, usage, time.Minute))
+	assert.Equal(t, rl.WindowUsage{Window: 15 * time.Minute, Allowed: 3, Denied: 1}, windowUsage(t, usage, 15*time.Minute))
+	assert.Equal(t, rl.WindowUsage{Window: 24 * time.Hour, Allowed: 3, Denied: 1}, windowUsage(t, usage, 24*time.Hour))
+	require.NotNil(t, usage.Bucket)
+	assert.Equal(t, int64(2), usage.Bucket.Capacity)
+	assert.Equal(t, int64(1), usage.Bucket.Tokens)
+
+	clock.Advance(2 * time.Hour)
+	usage, _ = limiter.Usage("client")
+	assert.Zero(t, windowUsage(t, usage, time.Hour).Allowed, "Old minutes leave the hour window")
+	assert.Equal(t, int64(3), windowUsage(t, usage, 24*time.Hour).Allowed)
+}
+
+// TestLimiter_UsagePersistence проверяет сохранение счетчиков при остановке лимитера
+// и их восстановление при запуске.
+func TestLimiter_UsagePersistence(t *testing.T) {
+	store := &memoryUsageStore{}
+	bucketStore, clock := ratelimitertest.NewStore(t, 10, 1, nil)
+	limiter, err := rl.NewLimiter(bucketStore, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, limiter.SetUsagePolicy(rl.UsagePolicy{Enabled: true, Store: store}))
+	for range 4 {
+		limiter.Check("client")
+	}
+	limiter.Stop()
+	require.NotEmpty(t, store.records)
+
+	restored, err := rl.NewLimiter(bucketStore, time.Hour)
+	require.NoError(t, err)
+	defer restored.Stop()
+	require.NoError(t, restored.SetUsagePolicy(rl.UsagePolicy{Enabled: true, Store: store}))
+	clock.Advance(time.Minute)
+
+	usage, found := restored.Usage("client")
+	require.True(t, found)
+	assert.Equal(t, int64(4), windowUsage(t, usage, 5*time.Minute).Allowed)
+	assert.Equal(t, int64(4), windowUsage(t, usage, 24*time.Hour).Allowed)
+}
+
+// TestLimiter_UsageIncrementalPersistence проверяет, что сохраняются только клиенты,
+// счетчики которых изменились, а удаленные клиенты удаляются из хранилища.
+func TestLimiter_UsageIncrementalPersistence(t *testing.T) {
+	store := &memoryUsageStore{}
+	bucketStore, clock := ratelimitertest.NewStore(t, 10, 1, nil)
+	restart := func() *rl.Limiter {
+		limiter, err := rl.NewLimiter(bucketStore, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, limiter.SetUsagePolicy(rl.UsagePolicy{Enabled: true, Store: store}))
+		return limiter
+	}
+
+	limiter := restart()
+	limiter.Check("a")
+	limiter.Check("b")
+	limiter.Stop()
+	require.Len(t, store.saved, 1)
+	assert.ElementsMatch(t, []string{"a", "b"}, store.saved[0])
+
+	limiter = restart()
+	limiter.Check("b")
+	limiter.Stop()
+	require.Len(t, store.saved, 2)
+	assert.Equal(t, []string{"b"}, store.saved[1], "Unchanged clients are not saved again")
+
+	limiter = restart()
+	limiter.Stop()
+	assert.Empty(t, store.saved[2])
+
+	clock.Advance(25 * time.Hour)
+	limiter = restart()
+	limiter.Check("c")
+	limiter.Stop()
+	assert.Equal(t, []string{"c"}, store.saved[3])
+	records, err := store.LoadUsage(time.Time{})
+	require.NoError(t, err)
+	for _, r := range records {
+		assert.Equal(t, "c", r.ClientID, "Counters older than a day are deleted")
+	}
+}
+
+// TestLimiter_UsageMaxClients проверяет, что при достижении MaxClients удаляются счетчики
+// наименее активных клиентов.
+func TestLimiter_UsageMaxClients(t *testing.T) {
+	limiter, _, clock := ratelimitertest.NewLimiter(t, 10, 1, time.Hour)
+	require.NoError(t, limiter.SetUsagePolicy(rl.UsagePolicy{Enabled: true, MaxClients: 2}))
+
+	limiter.Check("a")
+	clock.Advance(time.Second)
+	limiter.Check("b")
+	clock.Advance(time.Second)
+	limiter.Check("a")
+	limiter.Check("c")
+
+	_, found := limiter.Usage("b")
+	assert.False(t, found, "The least recently active client is dropped")
+	_, found = limiter.Usage("a")
+	assert.True(t, found)
+	_, found = limiter.Usage("c")
+	assert.True(t, found)
+
+	assert.Error(t, limiter.SetUsagePolicy(rl.UsagePolicy{Enabled: true, MaxClients: -1}))
+}
+
+// TestLimiter_UsageConcurrent проверяет учет запросов многих клиентов из параллельных
+// горутин: счетчики шардов не теряют запросы, а вытеснение соблюдает MaxClients.
+func TestLimiter_UsageConcurrent(t *testing.T) {
+	limiter, _, _ := ratelimitertest.NewLimiter(t, 500, 1, time.Hour)
+	clientID := func(g, i int) string { return "client-" + strconv.Itoa(g) + "-" + strconv.Itoa(i) }
+	run := func() {
+		var wg sync.WaitGroup
+		for g := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range 100 {
+					limiter.Check("shared")
+					limiter.Check(clientID(g, i))
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	require.NoError(t, limiter.SetUsagePolicy(rl.UsagePolicy{Enabled: true, MaxClients: 1000}))
+	run()
+	usage, found := limiter.Usage("shared")
+	require.True(t, found)
+	assert.Equal(t, rl.WindowUsage{Window: time.Minute, Allowed: 500, Denied: 300}, windowUsage(t, usage, time.Minute))
+
+	require.NoError(t, limiter.SetUsagePolicy(rl.UsagePolicy{Enabled: true, MaxClients: 50}))
+	run()
+	tracked := 0
+	for g := range 8 {
+		for i := range 100 {
+			if _, found := limiter.Usage(clientID(g, i)); found {
+				tracked++
+			}
+		}
+	}
+	assert.Positive(t, tracked)
+	assert.LessOrEqual(t, tracked, 50, "Eviction keeps at most MaxClients clients")
+}
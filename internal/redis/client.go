@@ -0,0 +1,144 @@
+// Package redis содержит минимальный клиент Redis (протокол RESP) без внешних зависимостей:
+// одно переиспользуемое соединение, достаточное для простых команд хранилищ балансировщика.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Client выполняет команды Redis поверх одного соединения. Соединение устанавливается
+// при первом обращении и восстанавливается после ошибок. Безопасен для конкурентного
+// использования (команды выполняются последовательно).
+type Client struct {
+	addr     string
+	password string
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewClient создает клиент Redis по адресу addr ("host:port").
+// timeout ограничивает подключение и каждую команду (по умолчанию 1s).
+func NewClient(addr, password string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &Client{addr: addr, password: password, timeout: timeout}
+}
+
+// Do выполняет команду и возвращает ответ в виде строки: простую строку, число или
+// bulk string. Для nil bulk string (например, GET отсутствующего ключа) возвращает nil.
+func (c *Client) Do(args ...string) (*string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.connectLocked(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTripLocked(args)
+	if err != nil {
+		var replyErr ReplyError
+		if !errors.As(err, &replyErr) {
+			// Соединение могло быть разорвано - закрываем, следующий вызов переподключится.
+			_ = c.closeLocked()
+		}
+		return nil, fmt.Errorf("redis: %s failed: %w", args[0], err)
+	}
+	return reply, nil
+}
+
+// Close закрывает соединение.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeLocked()
+}
+
+func (c *Client) closeLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.reader = nil, nil
+	return err
+}
+
+func (c *Client) connectLocked() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return fmt.Errorf("redis: failed to connect to %s: %w", c.addr, err)
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+	if c.password != "" {
+		if _, err := c.roundTripLocked([]string{"AUTH", c.password}); err != nil {
+			_ = c.closeLocked()
+			return fmt.Errorf("redis: AUTH failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) roundTripLocked(args []string) (*string, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(a))+"\r\n"+a+"\r\n"...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(c.reader)
+}
+
+// ReplyError - ошибка, которую вернул сервер Redis (соединение при этом остается исправным).
+type ReplyError string
+
+func (e ReplyError) Error() string { return string(e) }
+
+// readReply читает один ответ RESP: простую строку, ошибку, число или bulk string.
+func readReply(r *bufio.Reader) (*string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("malformed reply")
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+', ':':
+		v := line[1:]
+		return &v, nil
+	case '-':
+		return nil, ReplyError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		v := string(data[:n])
+		return &v, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", line[0])
+	}
+}
@@ -0,0 +1,154 @@
+// Package redistest предоставляет фейковый сервер Redis для тестов кода, использующего
+// пакет redis. Поддерживаются команды GET, SET (с опциями NX и PX), DEL и AUTH.
+package redistest
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server - фейковый сервер Redis, хранящий данные в памяти.
+type Server struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string]entry
+}
+
+type entry struct {
+	value   string
+	expires time.Time // Нулевое время - без срока действия.
+}
+
+// NewServer запускает фейковый сервер на случайном локальном порту.
+// Сервер останавливается по завершении теста.
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("redistest: failed to listen: %v", err)
+	}
+	s := &Server{ln: ln, data: make(map[string]entry)}
+	t.Cleanup(func() { _ = ln.Close() })
+	go s.serve()
+	return s
+}
+
+// Addr возвращает адрес сервера ("host:port").
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Get возвращает значение ключа напрямую из хранилища сервера.
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookupLocked(key)
+	return e.value, ok
+}
+
+func (s *Server) lookupLocked(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(s.data, key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte(s.execute(args)))
+	}
+}
+
+// execute выполняет команду и возвращает ответ в формате RESP.
+func (s *Server) execute(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		return "+OK\r\n"
+	case "GET":
+		e, ok := s.lookupLocked(args[1])
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(e.value)) + "\r\n" + e.value + "\r\n"
+	case "SET":
+		e := entry{value: args[2]}
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				if i+1 < len(args) {
+					ms, _ := strconv.Atoi(args[i+1])
+					e.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+					i++
+				}
+			}
+		}
+		if _, exists := s.lookupLocked(args[1]); exists && nx {
+			return "$-1\r\n"
+		}
+		s.data[args[1]] = e
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.lookupLocked(key); ok {
+				delete(s.data, key)
+				deleted++
+			}
+		}
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// readCommand читает массив bulk-строк RESP, отправленный клиентом.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args, nil
+}
@@ -0,0 +1,63 @@
+// Пакет selftest выполняет самопроверку балансировщика при запуске: все проверки
+// выполняются до конца, и отказы сообщаются вместе, а не по одному.
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Check - одна проверка самотестирования.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Run выполняет все проверки с общим таймаутом timeout и записывает результат каждой в лог.
+// Возвращает nil, если все проверки пройдены, иначе - ошибку, перечисляющую все отказы.
+func Run(checks []Check, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var failures []error
+	for _, c := range checks {
+		start := time.Now()
+		if err := c.Run(ctx); err != nil {
+			log.Printf("ERROR: Self-test: %s failed: %v", c.Name, err)
+			failures = append(failures, fmt.Errorf("%s: %w", c.Name, err))
+			continue
+		}
+		log.Printf("INFO: Self-test: %s ok (%v)", c.Name, time.Since(start).Round(time.Millisecond))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d self-test checks failed:\n%w", len(failures), len(checks), errors.Join(failures...))
+	}
+	return nil
+}
+
+// ResolveAnyBackend проверяет, что хост хотя бы одного бэкенда разрешается в адрес.
+func ResolveAnyBackend(ctx context.Context, backends []*url.URL) error {
+	if len(backends) == 0 {
+		return errors.New("no backends configured")
+	}
+	var errs []error
+	for _, u := range backends {
+		host := u.Hostname()
+		// Unix-сокеты и IP-адреса не требуют разрешения имени.
+		if strings.EqualFold(u.Scheme, "unix") || net.ParseIP(host) != nil {
+			return nil
+		}
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("no backend host resolves: %w", errors.Join(errs...))
+}
@@ -0,0 +1,50 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRun проверяет, что выполняются все проверки и отказы сообщаются вместе.
+func TestRun(t *testing.T) {
+	var ran []string
+	check := func(name string, err error) Check {
+		return Check{Name: name, Run: func(context.Context) error {
+			ran = append(ran, name)
+			return err
+		}}
+	}
+
+	require.NoError(t, Run([]Check{check("a", nil)}, time.Second))
+
+	ran = nil
+	err := Run([]Check{
+		check("listener", errors.New("address already in use")),
+		check("routes", nil),
+		check("limit store", errors.New("database is locked")),
+	}, time.Second)
+	require.Error(t, err)
+	assert.Equal(t, []string{"listener", "routes", "limit store"}, ran, "All checks run after the first failure")
+	assert.Contains(t, err.Error(), "2 of 3 self-test checks failed")
+	assert.Contains(t, err.Error(), "listener: address already in use")
+	assert.Contains(t, err.Error(), "limit store: database is locked")
+}
+
+// TestResolveAnyBackend проверяет, что достаточно одного разрешимого бэкенда.
+func TestResolveAnyBackend(t *testing.T) {
+	ctx := context.Background()
+	parse := func(raw string) *url.URL {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		return u
+	}
+	assert.Error(t, ResolveAnyBackend(ctx, nil))
+	assert.NoError(t, ResolveAnyBackend(ctx, []*url.URL{parse("http://backend.invalid:8081"), parse("http://127.0.0.1:8082")}))
+	assert.Error(t, ResolveAnyBackend(ctx, []*url.URL{parse("http://backend.invalid:8081")}))
+}
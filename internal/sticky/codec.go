@@ -0,0 +1,132 @@
+// Package sticky содержит средства для вынесения состояния сессионной привязки (sticky sessions)
+// за пределы процесса балансировщика: подпись и шифрование cookie привязки, а также хранилища
+// соответствия сессия -> бэкенд (в памяти или в Redis). Благодаря этому привязка переживает
+// перезапуск балансировщика и работает между несколькими репликами.
+package sticky
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrInvalidCookie возвращается, если значение cookie повреждено или подпись не совпадает.
+var ErrInvalidCookie = errors.New("invalid sticky cookie")
+
+// Codec кодирует идентификатор бэкенда (или сессии) в значение cookie и обратно.
+type Codec interface {
+	Encode(value string) (string, error)
+	Decode(cookie string) (string, error)
+}
+
+// NewCodec создает Codec для указанного режима: "plain" (без защиты), "signed" (HMAC-SHA256)
+// или "encrypted" (AES-256-GCM). Для "signed" и "encrypted" ключ обязателен;
+// из него с помощью SHA-256 выводится ключ нужной длины.
+func NewCodec(mode, key string) (Codec, error) {
+	switch mode {
+	case "", "plain":
+		return plainCodec{}, nil
+	case "signed":
+		if key == "" {
+			return nil, fmt.Errorf("sticky: key is required for signed cookies")
+		}
+		k := sha256.Sum256([]byte("sign:" + key))
+		return &signedCodec{key: k[:]}, nil
+	case "encrypted":
+		if key == "" {
+			return nil, fmt.Errorf("sticky: key is required for encrypted cookies")
+		}
+		k := sha256.Sum256([]byte("encrypt:" + key))
+		block, err := aes.NewCipher(k[:])
+		if err != nil {
+			return nil, fmt.Errorf("sticky: failed to create cipher: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("sticky: failed to create GCM: %w", err)
+		}
+		return &encryptedCodec{aead: aead}, nil
+	default:
+		return nil, fmt.Errorf("sticky: unknown cookie mode %q (expected plain, signed or encrypted)", mode)
+	}
+}
+
+type plainCodec struct{}
+
+func (plainCodec) Encode(value string) (string, error) {
+	return base64.RawURLEncoding.EncodeToString([]byte(value)), nil
+}
+
+func (plainCodec) Decode(cookie string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	return string(raw), nil
+}
+
+// signedCodec: base64(value) + "." + base64(HMAC-SHA256(value)).
+type signedCodec struct {
+	key []byte
+}
+
+func (c *signedCodec) mac(value []byte) []byte {
+	m := hmac.New(sha256.New, c.key)
+	m.Write(value)
+	return m.Sum(nil)
+}
+
+func (c *signedCodec) Encode(value string) (string, error) {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(value)) + "." + enc.EncodeToString(c.mac([]byte(value))), nil
+}
+
+func (c *signedCodec) Decode(cookie string) (string, error) {
+	payload, sig, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+	value, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, c.mac(value)) {
+		return "", ErrInvalidCookie
+	}
+	return string(value), nil
+}
+
+// encryptedCodec: base64(nonce || AES-GCM(value)). Значение скрыто от клиента и защищено от подделки.
+type encryptedCodec struct {
+	aead cipher.AEAD
+}
+
+func (c *encryptedCodec) Encode(value string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("sticky: failed to generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *encryptedCodec) Decode(cookie string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cookie)
+	if err != nil || len(raw) < c.aead.NonceSize() {
+		return "", ErrInvalidCookie
+	}
+	nonce, ciphertext := raw[:c.aead.NonceSize()], raw[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,95 @@
+package sticky
+
+import (
+	"testing"
+	"time"
+
+	"cloud/load_balancer/internal/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCodec_RoundTrip проверяет кодирование и декодирование во всех режимах,
+// а также отклонение подделанных cookie.
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, mode := range []string{"plain", "signed", "encrypted"} {
+		t.Run(mode, func(t *testing.T) {
+			codec, err := NewCodec(mode, "secret")
+			require.NoError(t, err)
+
+			cookie, err := codec.Encode("backend1:8081")
+			require.NoError(t, err)
+			value, err := codec.Decode(cookie)
+			require.NoError(t, err)
+			assert.Equal(t, "backend1:8081", value)
+
+			if mode != "plain" {
+				assert.NotContains(t, cookie, "backend1:8081")
+				other, err := NewCodec(mode, "other-secret")
+				require.NoError(t, err)
+				_, err = other.Decode(cookie)
+				assert.ErrorIs(t, err, ErrInvalidCookie, "Cookie signed with another key must be rejected")
+			}
+		})
+	}
+
+	_, err := NewCodec("signed", "")
+	assert.Error(t, err)
+	_, err = NewCodec("rot13", "secret")
+	assert.Error(t, err)
+}
+
+// TestMemoryStore_TTL проверяет сохранение привязки и ее истечение.
+func TestMemoryStore_TTL(t *testing.T) {
+	s := NewMemoryStore()
+	defer s.Close()
+	require.NoError(t, s.Set("sess", "backend1", time.Hour))
+	backend, found, err := s.Get("sess")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "backend1", backend)
+
+	require.NoError(t, s.Set("old", "backend2", -time.Second))
+	_, found, err = s.Get("old")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+// TestMemoryStore_Sweep проверяет удаление истекших записей, к которым больше не обращаются.
+func TestMemoryStore_Sweep(t *testing.T) {
+	s := NewMemoryStore()
+	require.NoError(t, s.Set("live", "backend1", time.Hour))
+	for _, id := range []string{"gone-1", "gone-2"} {
+		require.NoError(t, s.Set(id, "backend2", time.Minute))
+	}
+	s.sweep(time.Now().Add(2 * time.Minute))
+
+	s.mu.Lock()
+	assert.Len(t, s.entries, 1)
+	assert.Contains(t, s.entries, "live")
+	s.mu.Unlock()
+
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close(), "Close is idempotent")
+}
+
+// TestRedisStore_RESP проверяет обмен командами с Redis на примере фейкового сервера.
+func TestRedisStore_RESP(t *testing.T) {
+	srv := redistest.NewServer(t)
+	s := NewRedisStore(srv.Addr(), "", "lb:sticky:", time.Second)
+	defer s.Close()
+
+	_, found, err := s.Get("sess")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, s.Set("sess", "backend1", time.Minute))
+	stored, _ := srv.Get("lb:sticky:sess")
+	assert.Equal(t, "backend1", stored)
+
+	backend, found, err := s.Get("sess")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "backend1", backend)
+}
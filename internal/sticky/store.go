@@ -0,0 +1,151 @@
+package sticky
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/redis"
+)
+
+// SessionStore хранит соответствие идентификатора сессии бэкенду.
+type SessionStore interface {
+	// Get возвращает имя бэкенда для сессии; found=false, если запись отсутствует или истекла.
+	Get(sessionID string) (backend string, found bool, err error)
+	// Set сохраняет привязку сессии к бэкенду на время ttl.
+	Set(sessionID, backend string, ttl time.Duration) error
+	// Close освобождает ресурсы хранилища.
+	Close() error
+}
+
+// NewSessionID генерирует случайный идентификатор сессии.
+func NewSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("sticky: failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// memorySweepInterval - период удаления истекших записей MemoryStore. Записи сессий, к которым
+// больше не обращаются, иначе накапливались бы в памяти.
+const memorySweepInterval = time.Minute
+
+// MemoryStore - хранилище в памяти процесса (не переживает перезапуск, не разделяется между репликами).
+// Истекшие записи удаляются при обращении и фоновой горутиной раз в memorySweepInterval.
+type MemoryStore struct {
+	mu       sync.Mutex
+	entries  map[string]memoryEntry
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type memoryEntry struct {
+	backend string
+	expires time.Time
+}
+
+// NewMemoryStore создает пустое хранилище в памяти и запускает удаление истекших записей.
+// Для остановки нужно вызвать Close.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{entries: make(map[string]memoryEntry), stopChan: make(chan struct{})}
+	s.wg.Add(1)
+	go s.runSweep()
+	return s
+}
+
+// Get реализует SessionStore. Истекшие записи удаляются при обращении.
+func (s *MemoryStore) Get(sessionID string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[sessionID]
+	if !ok {
+		return "", false, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(s.entries, sessionID)
+		return "", false, nil
+	}
+	return e.backend, true, nil
+}
+
+// Set реализует SessionStore.
+func (s *MemoryStore) Set(sessionID, backend string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[sessionID] = memoryEntry{backend: backend, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// Close реализует SessionStore: останавливает удаление истекших записей.
+func (s *MemoryStore) Close() error {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+	s.wg.Wait()
+	return nil
+}
+
+func (s *MemoryStore) runSweep() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(memorySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.sweep(now)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// sweep удаляет записи, истекшие к моменту now.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// RedisStore - хранилище в Redis (команды GET и SET ... PX). См. пакет redis.
+type RedisStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewRedisStore создает хранилище в Redis по адресу addr ("host:port").
+// Соединение устанавливается при первом обращении и восстанавливается после ошибок.
+func NewRedisStore(addr, password, keyPrefix string, timeout time.Duration) *RedisStore {
+	return &RedisStore{client: redis.NewClient(addr, password, timeout), keyPrefix: keyPrefix}
+}
+
+// Get реализует SessionStore.
+func (s *RedisStore) Get(sessionID string) (string, bool, error) {
+	reply, err := s.client.Do("GET", s.keyPrefix+sessionID)
+	if err != nil {
+		return "", false, fmt.Errorf("sticky: %w", err)
+	}
+	if reply == nil {
+		return "", false, nil
+	}
+	return *reply, true, nil
+}
+
+// Set реализует SessionStore.
+func (s *RedisStore) Set(sessionID, backend string, ttl time.Duration) error {
+	if _, err := s.client.Do("SET", s.keyPrefix+sessionID, backend, "PX", strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+		return fmt.Errorf("sticky: %w", err)
+	}
+	return nil
+}
+
+// Close реализует SessionStore.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
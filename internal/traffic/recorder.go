@@ -0,0 +1,243 @@
+// Package traffic собирает в памяти скользящую сводку трафика балансировщика за последнюю
+// минуту (RPS, распределение кодов ответа, самые активные клиенты и пути, доли бэкендов)
+// для разбора инцидентов без внешних инструментов, а также итоги работы для отчета при остановке.
+package traffic
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud/load_balancer/internal/balancer"
+)
+
+const (
+	// Window - длительность окна сводки; окно состоит из посекундных корзин.
+	Window     = time.Minute
+	numBuckets = int(Window / time.Second)
+	// maxKeysPerBucket ограничивает число различных клиентов и путей в одной корзине,
+	// чтобы поток уникальных значений не расходовал память без ограничений.
+	maxKeysPerBucket = 1000
+	// OtherKey - ключ, под которым учитываются значения сверх maxKeysPerBucket.
+	OtherKey = "(other)"
+)
+
+// Entry описывает обработанный запрос.
+type Entry struct {
+	Status  int
+	Client  string
+	Path    string
+	Backend string // "" - запрос не был направлен на бэкенд.
+}
+
+// bucket содержит счетчики запросов за одну секунду.
+type bucket struct {
+	second   int64
+	requests int
+	statuses map[int]int
+	clients  map[string]int
+	paths    map[string]int
+	backends map[string]int
+}
+
+func (b *bucket) reset(second int64) {
+	b.second = second
+	b.requests = 0
+	b.statuses = make(map[int]int)
+	b.clients = make(map[string]int)
+	b.paths = make(map[string]int)
+	b.backends = make(map[string]int)
+}
+
+// Recorder хранит кольцевой буфер посекундных корзин за последнюю минуту и итоги
+// с момента создания (см. ShutdownReport).
+type Recorder struct {
+	mu      sync.Mutex
+	buckets [numBuckets]bucket
+	now     func() time.Time
+
+	started       time.Time
+	totalRequests int64
+	rateLimited   int64 // Ответы 429 балансировщика (запрос не был направлен на бэкенд).
+	backendTotals map[string]int64
+}
+
+// NewRecorder создает пустой Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{now: time.Now, started: time.Now(), backendTotals: make(map[string]int64)}
+}
+
+// Record учитывает обработанный запрос в текущей секунде.
+func (rec *Recorder) Record(e Entry) {
+	second := rec.now().Unix()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	b := &rec.buckets[second%int64(numBuckets)]
+	if b.second != second || b.statuses == nil {
+		b.reset(second)
+	}
+	b.requests++
+	b.statuses[e.Status]++
+	incrementBounded(b.clients, e.Client)
+	incrementBounded(b.paths, e.Path)
+	if e.Backend != "" {
+		b.backends[e.Backend]++
+	}
+
+	rec.totalRequests++
+	switch {
+	case e.Backend != "":
+		rec.backendTotals[e.Backend]++
+	case e.Status == http.StatusTooManyRequests:
+		rec.rateLimited++
+	}
+}
+
+// incrementBounded увеличивает счетчик key, учитывая новые ключи сверх лимита под OtherKey.
+func incrementBounded(m map[string]int, key string) {
+	if _, ok := m[key]; !ok && len(m) >= maxKeysPerBucket {
+		key = OtherKey
+	}
+	m[key]++
+}
+
+// Count - значение и количество запросов с ним.
+type Count struct {
+	Key      string `json:"key"`
+	Requests int    `json:"requests"`
+}
+
+// BackendShare - доля запросов, направленных на бэкенд.
+type BackendShare struct {
+	Backend  string  `json:"backend"`
+	Requests int     `json:"requests"`
+	Share    float64 `json:"share"` // Доля от всех запросов, направленных на бэкенды (0..1).
+}
+
+// Snapshot - сводка трафика за окно.
+type Snapshot struct {
+	WindowSeconds int            `json:"window_seconds"`
+	Requests      int            `json:"requests"`
+	RPS           float64        `json:"rps"`
+	Statuses      map[string]int `json:"statuses"`
+	TopClients    []Count        `json:"top_clients"`
+	TopPaths      []Count        `json:"top_paths"`
+	Backends      []BackendShare `json:"backends"`
+}
+
+// Snapshot возвращает сводку за последнюю минуту с top самыми активными клиентами и путями.
+func (rec *Recorder) Snapshot(top int) Snapshot {
+	now := rec.now().Unix()
+	statuses := make(map[int]int)
+	clients := make(map[string]int)
+	paths := make(map[string]int)
+	backends := make(map[string]int)
+	requests := 0
+
+	rec.mu.Lock()
+	for i := range rec.buckets {
+		b := &rec.buckets[i]
+		if b.statuses == nil || now-b.second >= int64(numBuckets) || b.second > now {
+			continue
+		}
+		requests += b.requests
+		mergeCounts(statuses, b.statuses)
+		mergeCounts(clients, b.clients)
+		mergeCounts(paths, b.paths)
+		mergeCounts(backends, b.backends)
+	}
+	rec.mu.Unlock()
+
+	snap := Snapshot{
+		WindowSeconds: numBuckets,
+		Requests:      requests,
+		RPS:           float64(requests) / float64(numBuckets),
+		Statuses:      make(map[string]int, len(statuses)),
+		TopClients:    topCounts(clients, top),
+		TopPaths:      topCounts(paths, top),
+		Backends:      make([]BackendShare, 0, len(backends)),
+	}
+	for code, n := range statuses {
+		snap.Statuses[strconv.Itoa(code)] = n
+	}
+	proxied := 0
+	for _, n := range backends {
+		proxied += n
+	}
+	for _, c := range topCounts(backends, len(backends)) {
+		snap.Backends = append(snap.Backends, BackendShare{
+			Backend:  c.Key,
+			Requests: c.Requests,
+			Share:    float64(c.Requests) / float64(proxied),
+		})
+	}
+	return snap
+}
+
+func mergeCounts[K comparable](dst, src map[K]int) {
+	for k, n := range src {
+		dst[k] += n
+	}
+}
+
+// topCounts возвращает не более limit значений с наибольшим числом запросов.
+func topCounts(m map[string]int, limit int) []Count {
+	counts := make([]Count, 0, len(m))
+	for k, n := range m {
+		counts = append(counts, Count{Key: k, Requests: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Requests != counts[j].Requests {
+			return counts[i].Requests > counts[j].Requests
+		}
+		return counts[i].Key < counts[j].Key
+	})
+	if limit >= 0 && len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts
+}
+
+// Middleware учитывает каждый запрос: код ответа, клиента, путь и выбранный бэкенд.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		tracked, peer := balancer.WithPeerTracking(r)
+		next.ServeHTTP(sw, tracked)
+
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		rec.Record(Entry{Status: sw.status, Client: client, Path: r.URL.Path, Backend: peer()})
+	})
+}
+
+// statusWriter запоминает код ответа.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.status = code
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(p)
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter (Flush и т.п.).
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,99 @@
+package traffic
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecorder_Snapshot проверяет агрегацию за окно и вытеснение устаревших корзин.
+func TestRecorder_Snapshot(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	rec := NewRecorder()
+	rec.now = func() time.Time { return now }
+
+	rec.Record(Entry{Status: 200, Client: "10.0.0.1", Path: "/a", Backend: "b1"})
+	rec.Record(Entry{Status: 200, Client: "10.0.0.1", Path: "/a", Backend: "b2"})
+	now = now.Add(30 * time.Second)
+	rec.Record(Entry{Status: 503, Client: "10.0.0.2", Path: "/b"})
+	rec.Record(Entry{Status: 200, Client: "10.0.0.1", Path: "/b", Backend: "b1"})
+
+	snap := rec.Snapshot(1)
+	assert.Equal(t, 4, snap.Requests)
+	assert.InDelta(t, 4.0/60, snap.RPS, 1e-9)
+	assert.Equal(t, map[string]int{"200": 3, "503": 1}, snap.Statuses)
+	assert.Equal(t, []Count{{Key: "10.0.0.1", Requests: 3}}, snap.TopClients)
+	require.Len(t, snap.Backends, 2)
+	assert.Equal(t, "b1", snap.Backends[0].Backend)
+	assert.InDelta(t, 2.0/3, snap.Backends[0].Share, 1e-9)
+
+	// Через минуту после первых запросов они выходят из окна.
+	now = now.Add(31 * time.Second)
+	snap = rec.Snapshot(10)
+	assert.Equal(t, 2, snap.Requests)
+	assert.Equal(t, map[string]int{"200": 1, "503": 1}, snap.Statuses)
+}
+
+// TestRecorder_Middleware проверяет учет кода ответа и клиента запроса.
+func TestRecorder_Middleware(t *testing.T) {
+	rec := NewRecorder()
+	handler := rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	snap := rec.Snapshot(10)
+	assert.Equal(t, map[string]int{"418": 1}, snap.Statuses)
+	assert.Equal(t, []Count{{Key: "192.0.2.7", Requests: 1}}, snap.TopClients)
+	assert.Empty(t, snap.Backends)
+}
+
+// TestRecorder_ShutdownReport проверяет итоги работы и отправку отчета на webhook.
+func TestRecorder_ShutdownReport(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	rec := NewRecorder()
+	rec.started = now
+	rec.now = func() time.Time { return now }
+
+	rec.Record(Entry{Status: 200, Backend: "b1"})
+	rec.Record(Entry{Status: 200, Backend: "b2"})
+	now = now.Add(2 * time.Minute)
+	rec.Record(Entry{Status: 502, Backend: "b2"})
+	rec.Record(Entry{Status: 429})
+	rec.Record(Entry{Status: 429, Backend: "b1"})
+
+	report := rec.ShutdownReport(nil)
+	assert.Equal(t, int64(5), report.Requests)
+	assert.Equal(t, int64(1), report.RateLimited, "429 from a backend is not a rate limit rejection")
+	assert.Equal(t, []BackendTotal{{Backend: "b1", Requests: 2}, {Backend: "b2", Requests: 2}}, report.Backends)
+	assert.Equal(t, 120.0, report.UptimeSeconds)
+	assert.True(t, report.DrainClean)
+
+	var received ShutdownReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	report = rec.ShutdownReport(errors.New("server traffic: context deadline exceeded"))
+	require.NoError(t, report.Send(server.URL, time.Second))
+	assert.False(t, received.DrainClean)
+	assert.Equal(t, "server traffic: context deadline exceeded", received.DrainError)
+	assert.Equal(t, int64(5), received.Requests)
+
+	server.Close()
+	err := report.Send(server.URL+"/hooks?token=secret", time.Second)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret", "Webhook URL must not leak into the error")
+	err = report.Send("http://[::1/hooks?token=secret", time.Second)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
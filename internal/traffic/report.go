@@ -0,0 +1,106 @@
+package traffic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// BackendTotal - число запросов, направленных на бэкенд за время работы.
+type BackendTotal struct {
+	Backend  string `json:"backend"`
+	Requests int64  `json:"requests"`
+}
+
+// ShutdownReport - итоги работы балансировщика, формируемые при остановке для проверки
+// после развертывания. Отправляется в теле webhook в формате JSON.
+type ShutdownReport struct {
+	StartedAt     time.Time      `json:"started_at"`
+	StoppedAt     time.Time      `json:"stopped_at"`
+	UptimeSeconds float64        `json:"uptime_seconds"`
+	Requests      int64          `json:"requests"`
+	RateLimited   int64          `json:"rate_limited"` // Запросы, отклоненные Rate Limiter (429).
+	Backends      []BackendTotal `json:"backends"`
+	// Серверы завершили обработку запросов и компоненты остановлены до истечения таймаутов.
+	DrainClean bool   `json:"drain_clean"`
+	DrainError string `json:"drain_error,omitempty"`
+}
+
+// ShutdownReport возвращает итоги работы с момента создания Recorder. shutdownErr - результат
+// остановки серверов и компонентов (nil - остановка прошла без ошибок).
+func (rec *Recorder) ShutdownReport(shutdownErr error) ShutdownReport {
+	now := rec.now()
+	rec.mu.Lock()
+	report := ShutdownReport{
+		StartedAt:     rec.started,
+		StoppedAt:     now,
+		UptimeSeconds: now.Sub(rec.started).Seconds(),
+		Requests:      rec.totalRequests,
+		RateLimited:   rec.rateLimited,
+		Backends:      make([]BackendTotal, 0, len(rec.backendTotals)),
+		DrainClean:    shutdownErr == nil,
+	}
+	for name, n := range rec.backendTotals {
+		report.Backends = append(report.Backends, BackendTotal{Backend: name, Requests: n})
+	}
+	rec.mu.Unlock()
+
+	sort.Slice(report.Backends, func(i, j int) bool {
+		if report.Backends[i].Requests != report.Backends[j].Requests {
+			return report.Backends[i].Requests > report.Backends[j].Requests
+		}
+		return report.Backends[i].Backend < report.Backends[j].Backend
+	})
+	if shutdownErr != nil {
+		report.DrainError = shutdownErr.Error()
+	}
+	return report
+}
+
+// Log выводит отчет в лог одной строкой JSON.
+func (r ShutdownReport) Log() {
+	body, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("ERROR: Failed to encode shutdown report: %v", err)
+		return
+	}
+	log.Printf("INFO: Shutdown report: %s", body)
+}
+
+// Send отправляет отчет POST-запросом на webhookURL и ожидает ответ 2xx не дольше timeout.
+// URL может содержать секрет (токен в пути или параметрах), поэтому возвращаемые ошибки
+// его не включают.
+func (r ShutdownReport) Send(webhookURL string, timeout time.Duration) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// *url.Error содержит URL запроса.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 	"log"
 	"time"
 
+	rl "cloud/load_balancer/internal/ratelimiter"
+
 	// Импортируем драйвер SQLite3. Пустой идентификатор (_) используется,
 	// так как мы обращаемся к драйверу через интерфейс database/sql,
 	// но пакет драйвера должен быть скомпилирован в бинарник.
@@ -29,18 +31,50 @@ const (
 		rate REAL NOT NULL,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
+	// Запросы чтения исключают мягко удаленные записи (deleted_at IS NOT NULL).
 	// getLimitSQL выбирает лимиты (capacity, rate) для заданного client_id.
-	getLimitSQL = `SELECT capacity, rate FROM client_limits WHERE client_id = ?;`
-	// setLimitSQL вставляет новую запись или обновляет существующую (UPSERT)
-	// для заданного client_id с новыми значениями capacity и rate.
-	setLimitSQL = `
-	INSERT INTO client_limits (client_id, capacity, rate, updated_at)
-	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	getLimitSQL = `SELECT capacity, rate FROM client_limits WHERE client_id = ? AND deleted_at IS NULL;`
+	// getClientLimitSQL выбирает лимит вместе с метаданными для заданного client_id.
+	getClientLimitSQL = `
+	SELECT client_id, capacity, rate, description, created_by, updated_by, updated_at, version
+	FROM client_limits WHERE client_id = ? AND deleted_at IS NULL;`
+	// listLimitsSQL выбирает лимиты с метаданными; условия фильтра добавляются в ListLimits.
+	listLimitsSQL = `
+	SELECT client_id, capacity, rate, description, created_by, updated_by, updated_at, version
+	FROM client_limits WHERE deleted_at IS NULL`
+	// createLimitSQL создает запись для заданного client_id. Существующая активная запись
+	// не изменяется (0 затронутых строк); мягко удаленная запись перезаписывается
+	// с сохранением created_by и снятием пометки удаления.
+	createLimitSQL = `
+	INSERT INTO client_limits (client_id, capacity, rate, description, created_by, updated_by, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	ON CONFLICT(client_id) DO UPDATE SET
 		capacity = excluded.capacity,
 		rate = excluded.rate,
-		updated_at = CURRENT_TIMESTAMP;`
-	deleteLimitSQL = `DELETE FROM client_limits WHERE client_id = ?;`
+		description = excluded.description,
+		updated_by = excluded.updated_by,
+		updated_at = CURRENT_TIMESTAMP,
+		version = client_limits.version + 1,
+		deleted_at = NULL
+	WHERE client_limits.deleted_at IS NOT NULL;`
+	// updateLimitSQL обновляет активную запись, только если ее версия совпадает с ожидаемой.
+	updateLimitSQL = `
+	UPDATE client_limits SET
+		capacity = ?,
+		rate = ?,
+		description = ?,
+		updated_by = ?,
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1
+	WHERE client_id = ? AND version = ? AND deleted_at IS NULL;`
+	// deleteLimitSQL мягко удаляет лимит: запись остается в БД и может быть восстановлена.
+	deleteLimitSQL = `
+	UPDATE client_limits SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE client_id = ? AND deleted_at IS NULL;`
+	// restoreLimitSQL снимает пометку удаления.
+	restoreLimitSQL = `
+	UPDATE client_limits SET deleted_at = NULL, version = version + 1
+	WHERE client_id = ? AND deleted_at IS NOT NULL;`
 )
 
 // SQLiteLimitStore реализует интерфейс ratelimiter.LimitProvider,
@@ -51,7 +85,7 @@ type SQLiteLimitStore struct {
 
 // New создает и инициализирует новый SQLiteLimitStore.
 // Открывает соединение с БД по указанному пути dbPath,
-// проверяет соединение и создает таблицу client_limits, если она не существует.
+// проверяет соединение и применяет недостающие миграции схемы (см. migrations).
 // Возвращает созданный store или ошибку.
 func New(dbPath string) (*SQLiteLimitStore, error) {
 	log.Printf("INFO: Initializing SQLite limit store at %s", dbPath)
@@ -63,9 +97,9 @@ func New(dbPath string) (*SQLiteLimitStore, error) {
 		db.Close()
 		return nil, fmt.Errorf("failed to ping sqlite database at %s: %w", dbPath, err)
 	}
-	if _, err := db.Exec(createTableSQL); err != nil {
+	if err := migrate(context.Background(), db); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create client_limits table: %w", err)
+		return nil, fmt.Errorf("failed to migrate sqlite schema: %w", err)
 	}
 	log.Printf("INFO: SQLite limit store initialized successfully.")
 	return &SQLiteLimitStore{db: db}, nil
@@ -90,20 +124,119 @@ func (s *SQLiteLimitStore) GetLimit(clientID string) (capacity int64, rate float
 	return capacity, rate, true
 }
 
-// SetLimit устанавливает или обновляет кастомные лимиты для заданного clientID в БД
-func (s *SQLiteLimitStore) SetLimit(clientID string, capacity int64, rate float64) error {
+// GetClientLimit извлекает лимит вместе с метаданными для заданного clientID из БД.
+// Реализует метод интерфейса ratelimiter.LimitManager.
+func (s *SQLiteLimitStore) GetClientLimit(clientID string) (rl.ClientLimit, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	limit, err := scanClientLimit(s.db.QueryRowContext(ctx, getClientLimitSQL, clientID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return rl.ClientLimit{}, false, nil
+		}
+		log.Printf("ERROR: Failed to query limit for client %s: %v", clientID, err)
+		return rl.ClientLimit{}, false, fmt.Errorf("failed to query limit: %w", err)
+	}
+	return limit, true, nil
+}
+
+// ListLimits возвращает лимиты, удовлетворяющие фильтру, в порядке убывания времени изменения.
+// Реализует метод интерфейса ratelimiter.LimitManager.
+func (s *SQLiteLimitStore) ListLimits(filter rl.LimitFilter) ([]rl.ClientLimit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	query := listLimitsSQL
+	var args []any
+	if filter.MinRate > 0 {
+		query += " AND rate >= ?"
+		args = append(args, filter.MinRate)
+	}
+	if filter.MaxRate > 0 {
+		query += " AND rate <= ?"
+		args = append(args, filter.MaxRate)
+	}
+	if filter.MinCapacity > 0 {
+		query += " AND capacity >= ?"
+		args = append(args, filter.MinCapacity)
+	}
+	if filter.MaxCapacity > 0 {
+		query += " AND capacity <= ?"
+		args = append(args, filter.MaxCapacity)
+	}
+	if !filter.UpdatedSince.IsZero() {
+		// CURRENT_TIMESTAMP хранится как текст в UTC, сравниваем в том же формате.
+		query += " AND updated_at >= datetime(?)"
+		args = append(args, filter.UpdatedSince.UTC().Format(time.DateTime))
+	}
+	query += " ORDER BY updated_at DESC, client_id;"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Printf("ERROR: Failed to list limits: %v", err)
+		return nil, fmt.Errorf("failed to query limits: %w", err)
+	}
+	defer rows.Close()
+
+	limits := make([]rl.ClientLimit, 0)
+	for rows.Next() {
+		limit, err := scanClientLimit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan limit: %w", err)
+		}
+		limits = append(limits, limit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate limits: %w", err)
+	}
+	return limits, nil
+}
+
+// scanClientLimit читает строку с колонками getClientLimitSQL/listLimitsSQL.
+func scanClientLimit(row interface{ Scan(dest ...any) error }) (rl.ClientLimit, error) {
+	var limit rl.ClientLimit
+	err := row.Scan(&limit.ClientID, &limit.Capacity, &limit.Rate, &limit.Description,
+		&limit.CreatedBy, &limit.UpdatedBy, &limit.UpdatedAt, &limit.Version)
+	return limit, err
+}
+
+// SetLimit создает или обновляет кастомный лимит клиента в БД с оптимистичной блокировкой:
+// при limit.Version == 0 лимит создается (если активного лимита нет), иначе обновляется,
+// только если текущая версия записи равна limit.Version. В остальных случаях
+// возвращается ratelimiter.ErrVersionConflict.
+// Реализует метод интерфейса ratelimiter.LimitManager.
+func (s *SQLiteLimitStore) SetLimit(limit rl.ClientLimit) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, setLimitSQL, clientID, capacity, rate)
+
+	var result sql.Result
+	var err error
+	if limit.Version == 0 {
+		result, err = s.db.ExecContext(ctx, createLimitSQL, limit.ClientID, limit.Capacity, limit.Rate,
+			limit.Description, limit.UpdatedBy, limit.UpdatedBy)
+	} else {
+		result, err = s.db.ExecContext(ctx, updateLimitSQL, limit.Capacity, limit.Rate,
+			limit.Description, limit.UpdatedBy, limit.ClientID, limit.Version)
+	}
 	if err != nil {
-		log.Printf("ERROR: Failed to set limit for client %s (capacity=%d, rate=%.2f): %v", clientID, capacity, rate, err)
+		log.Printf("ERROR: Failed to set limit for client %s (capacity=%d, rate=%.2f): %v", limit.ClientID, limit.Capacity, limit.Rate, err)
 		return fmt.Errorf("failed to execute set limit statement: %w", err)
 	}
-	log.Printf("INFO: Set custom limit for client %s: capacity=%d, rate=%.2f/s", clientID, capacity, rate)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		log.Printf("WARN: Version conflict while setting limit for client %s (expected version %d)", limit.ClientID, limit.Version)
+		return rl.ErrVersionConflict
+	}
+	log.Printf("INFO: Set custom limit for client %s: capacity=%d, rate=%.2f/s (by %q)", limit.ClientID, limit.Capacity, limit.Rate, limit.UpdatedBy)
 	return nil
 }
 
-// DeleteLimit удаляет кастомные лимиты для заданного clientID из БД.
+// DeleteLimit мягко удаляет кастомные лимиты для заданного clientID: запись помечается
+// удаленной и перестает использоваться, но может быть восстановлена через RestoreLimit.
 // Реализует метод интерфейса ratelimiter.LimitManager.
 func (s *SQLiteLimitStore) DeleteLimit(clientID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
@@ -127,6 +260,41 @@ func (s *SQLiteLimitStore) DeleteLimit(clientID string) error {
 	return nil
 }
 
+// RestoreLimit восстанавливает мягко удаленный лимит для заданного clientID.
+// Возвращает found=false, если удаленного лимита для клиента нет.
+// Реализует метод интерфейса ratelimiter.LimitManager.
+func (s *SQLiteLimitStore) RestoreLimit(clientID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, restoreLimitSQL, clientID)
+	if err != nil {
+		log.Printf("ERROR: Failed to restore limit for client %s: %v", clientID, err)
+		return false, fmt.Errorf("failed to execute restore limit statement: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+	log.Printf("INFO: Restored custom limit for client %s", clientID)
+	return true, nil
+}
+
+// Ping проверяет, что база данных отвечает и схема лимитов доступна.
+func (s *SQLiteLimitStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping sqlite database: %w", err)
+	}
+	var n int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM client_limits WHERE 0").Scan(&n); err != nil {
+		return fmt.Errorf("failed to query client_limits: %w", err)
+	}
+	return nil
+}
+
 // Closer закрывает соединение с базой данных SQLite.
 // Реализует метод интерфейса ratelimiter.LimitProvider.
 func (s *SQLiteLimitStore) Closer() error {
@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *SQLiteLimitStore {
+	t.Helper()
+	store, err := New(filepath.Join(t.TempDir(), "limits.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Closer() })
+	return store
+}
+
+// TestMigrate_LegacySchema проверяет, что БД со схемой до введения миграций
+// обновляется без потери данных.
+func TestMigrate_LegacySchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(createTableSQL)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO client_limits (client_id, capacity, rate) VALUES ('10.0.0.1', 50, 5);`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	store, err := New(path)
+	require.NoError(t, err)
+	defer store.Closer()
+
+	limit, found, err := store.GetClientLimit("10.0.0.1")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, int64(50), limit.Capacity)
+	assert.Empty(t, limit.Description)
+
+	// Повторное открытие не применяет миграции заново.
+	require.NoError(t, store.Closer())
+	store, err = New(path)
+	require.NoError(t, err)
+	var version int
+	require.NoError(t, store.db.QueryRow(currentVersionSQL).Scan(&version))
+	assert.Equal(t, len(migrations), version)
+}
+
+// TestSetLimit_Metadata проверяет сохранение описания и авторов лимита.
+func TestSetLimit_Metadata(t *testing.T) {
+	store := newTestStore(t)
+
+	require.NoError(t, store.SetLimit(rl.ClientLimit{
+		ClientID: "partner", Capacity: 100, Rate: 10, Description: "contract #42", UpdatedBy: "alice",
+	}))
+	require.NoError(t, store.SetLimit(rl.ClientLimit{
+		ClientID: "partner", Capacity: 200, Rate: 20, Description: "contract #42, upgraded", UpdatedBy: "bob", Version: 1,
+	}))
+
+	limit, found, err := store.GetClientLimit("partner")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, int64(200), limit.Capacity)
+	assert.Equal(t, "contract #42, upgraded", limit.Description)
+	assert.Equal(t, "alice", limit.CreatedBy)
+	assert.Equal(t, "bob", limit.UpdatedBy)
+	assert.False(t, limit.UpdatedAt.IsZero())
+
+	capacity, rate, found := store.GetLimit("partner")
+	assert.True(t, found)
+	assert.Equal(t, int64(200), capacity)
+	assert.Equal(t, 20.0, rate)
+}
+
+// TestListLimits_Filter проверяет поиск лимитов по скорости, емкости и времени изменения.
+func TestListLimits_Filter(t *testing.T) {
+	store := newTestStore(t)
+	for _, l := range []rl.ClientLimit{
+		{ClientID: "basic", Capacity: 10, Rate: 1},
+		{ClientID: "partner", Capacity: 100, Rate: 50},
+		{ClientID: "burst", Capacity: 1000, Rate: 5},
+	} {
+		require.NoError(t, store.SetLimit(l))
+	}
+	_, err := store.db.Exec(`UPDATE client_limits SET updated_at = datetime('now', '-60 days') WHERE client_id = 'burst';`)
+	require.NoError(t, err)
+
+	ids := func(limits []rl.ClientLimit) []string {
+		out := make([]string, 0, len(limits))
+		for _, l := range limits {
+			out = append(out, l.ClientID)
+		}
+		return out
+	}
+
+	all, err := store.ListLimits(rl.LimitFilter{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"basic", "partner", "burst"}, ids(all))
+
+	elevated, err := store.ListLimits(rl.LimitFilter{MinRate: 5})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"partner", "burst"}, ids(elevated))
+
+	small, err := store.ListLimits(rl.LimitFilter{MaxCapacity: 100})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"basic", "partner"}, ids(small))
+
+	recent, err := store.ListLimits(rl.LimitFilter{MinRate: 5, UpdatedSince: time.Now().Add(-30 * 24 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"partner"}, ids(recent))
+}
+
+// TestDeleteLimit_SoftDeleteAndRestore проверяет, что удаленный лимит не используется,
+// но может быть восстановлен со всеми данными.
+func TestDeleteLimit_SoftDeleteAndRestore(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetLimit(rl.ClientLimit{ClientID: "vip", Capacity: 500, Rate: 50, Description: "key customer"}))
+
+	require.NoError(t, store.DeleteLimit("vip"))
+	_, _, found := store.GetLimit("vip")
+	assert.False(t, found)
+	_, found, err := store.GetClientLimit("vip")
+	require.NoError(t, err)
+	assert.False(t, found)
+	all, err := store.ListLimits(rl.LimitFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	restored, err := store.RestoreLimit("vip")
+	require.NoError(t, err)
+	assert.True(t, restored)
+	limit, found, err := store.GetClientLimit("vip")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, int64(500), limit.Capacity)
+	assert.Equal(t, "key customer", limit.Description)
+
+	restored, err = store.RestoreLimit("vip")
+	require.NoError(t, err)
+	assert.False(t, restored, "Active limit cannot be restored")
+}
+
+// TestSetLimit_OptimisticConcurrency проверяет, что обновление с устаревшей версией
+// и повторное создание существующего лимита отклоняются.
+func TestSetLimit_OptimisticConcurrency(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.SetLimit(rl.ClientLimit{ClientID: "c1", Capacity: 10, Rate: 1}))
+	assert.ErrorIs(t, store.SetLimit(rl.ClientLimit{ClientID: "c1", Capacity: 20, Rate: 2}), rl.ErrVersionConflict)
+
+	limit, _, err := store.GetClientLimit("c1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), limit.Version)
+
+	// Два оператора прочитали версию 1; побеждает первое обновление.
+	require.NoError(t, store.SetLimit(rl.ClientLimit{ClientID: "c1", Capacity: 20, Rate: 2, Version: 1}))
+	assert.ErrorIs(t, store.SetLimit(rl.ClientLimit{ClientID: "c1", Capacity: 30, Rate: 3, Version: 1}), rl.ErrVersionConflict)
+
+	limit, _, err = store.GetClientLimit("c1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), limit.Version)
+	assert.Equal(t, int64(20), limit.Capacity)
+
+	// После удаления лимит можно создать заново без версии.
+	require.NoError(t, store.DeleteLimit("c1"))
+	require.NoError(t, store.SetLimit(rl.ClientLimit{ClientID: "c1", Capacity: 5, Rate: 1}))
+	limit, _, err = store.GetClientLimit("c1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), limit.Version)
+}
+
+// TestPing проверяет проверку доступности хранилища при самопроверке.
+func TestPing(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.Ping(context.Background()))
+
+	require.NoError(t, store.Closer())
+	assert.Error(t, store.Ping(context.Background()))
+}
+
+// TestUsage_SaveAndLoad проверяет сохранение счетчиков использования лимитов.
+func TestUsage_SaveAndLoad(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	require.NoError(t, store.SaveUsage([]string{"a", "b"}, []rl.UsageRecord{
+		{ClientID: "a", Start: now, Period: time.Minute, Allowed: 5, Denied: 1},
+		{ClientID: "a", Start: now.Truncate(time.Hour), Period: time.Hour, Allowed: 50, Denied: 2},
+		{ClientID: "b", Start: now.Add(-2 * time.Hour), Period: time.Minute, Allowed: 1},
+	}, now.Add(-24*time.Hour)))
+	records, err := store.LoadUsage(now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []rl.UsageRecord{
+		{ClientID: "a", Start: now, Period: time.Minute, Allowed: 5, Denied: 1},
+		{ClientID: "a", Start: now.Truncate(time.Hour), Period: time.Hour, Allowed: 50, Denied: 2},
+	}, records)
+
+	// Сохранение заменяет счетчики только переданных клиентов и удаляет устаревшие слоты.
+	require.NoError(t, store.SaveUsage([]string{"a", "c"}, []rl.UsageRecord{
+		{ClientID: "c", Start: now, Period: time.Minute, Allowed: 1},
+	}, now.Add(-time.Hour)))
+	records, err = store.LoadUsage(time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []rl.UsageRecord{{ClientID: "c", Start: now, Period: time.Minute, Allowed: 1}}, records)
+
+	require.NoError(t, store.SaveUsage([]string{"d"}, []rl.UsageRecord{
+		{ClientID: "d", Start: now, Period: time.Minute, Allowed: 2},
+	}, now.Add(-time.Hour)))
+	records, err = store.LoadUsage(time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, records, 2, "Counters of other clients are kept")
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration - шаг изменения схемы БД. Шаги применяются строго по порядку, и каждый
+// применяется ровно один раз; номер последнего примененного шага хранится в schema_migrations.
+// Уже выпущенные шаги нельзя изменять - только добавлять новые в конец списка.
+type migration struct {
+	description string
+	statements  []string
+}
+
+var migrations = []migration{
+	{
+		description: "create client_limits table",
+		statements:  []string{createTableSQL},
+	},
+	{
+		description: "add description, created_by and updated_by columns",
+		statements: []string{
+			`ALTER TABLE client_limits ADD COLUMN description TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE client_limits ADD COLUMN created_by TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE client_limits ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';`,
+		},
+	},
+	{
+		description: "add deleted_at column for soft deletion",
+		statements: []string{
+			`ALTER TABLE client_limits ADD COLUMN deleted_at DATETIME;`,
+		},
+	},
+	{
+		description: "add version column for optimistic concurrency",
+		statements: []string{
+			`ALTER TABLE client_limits ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+		},
+	},
+	{
+		description: "create client_usage table",
+		statements:  []string{createUsageTableSQL},
+	},
+	{
+		description: "index client_usage by slot start",
+		statements:  []string{createUsageStartIndexSQL},
+	},
+}
+
+const (
+	createMigrationsTableSQL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	currentVersionSQL = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`
+	recordVersionSQL  = `INSERT INTO schema_migrations (version) VALUES (?);`
+)
+
+// migrate приводит схему БД к актуальной версии, применяя недостающие миграции.
+// Каждая миграция выполняется в отдельной транзакции вместе с записью ее версии.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, createMigrationsTableSQL); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, currentVersionSQL).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		m := migrations[i]
+		if err := applyMigration(ctx, db, version, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", version, m.description, err)
+		}
+		log.Printf("INFO: Applied SQLite schema migration %d: %s", version, m.description)
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, version int, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, recordVersionSQL, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
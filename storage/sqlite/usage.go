@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	rl "cloud/load_balancer/internal/ratelimiter"
+)
+
+// SQL запросы для работы с таблицей счетчиков использования лимитов.
+const (
+	// createUsageTableSQL создает таблицу client_usage: счетчики разрешенных и отклоненных
+	// запросов клиента за слот, начавшийся в start_unix и длящийся period_seconds.
+	createUsageTableSQL = `
+	CREATE TABLE IF NOT EXISTS client_usage (
+		client_id TEXT NOT NULL,
+		period_seconds INTEGER NOT NULL,
+		start_unix INTEGER NOT NULL,
+		allowed INTEGER NOT NULL,
+		denied INTEGER NOT NULL,
+		PRIMARY KEY (client_id, period_seconds, start_unix)
+	);`
+	createUsageStartIndexSQL = `CREATE INDEX IF NOT EXISTS client_usage_start_unix ON client_usage (start_unix);`
+	deleteClientUsageSQL     = `DELETE FROM client_usage WHERE client_id = ?;`
+	deleteOldUsageSQL        = `DELETE FROM client_usage WHERE start_unix < ?;`
+	insertUsageSQL           = `
+	INSERT INTO client_usage (client_id, period_seconds, start_unix, allowed, denied)
+	VALUES (?, ?, ?, ?, ?);`
+	loadUsageSQL = `
+	SELECT client_id, period_seconds, start_unix, allowed, denied
+	FROM client_usage WHERE start_unix >= ?;`
+)
+
+// SaveUsage заменяет сохраненные счетчики использования лимитов клиентов clientIDs
+// на records и удаляет счетчики слотов, начавшихся раньше before.
+// Реализует метод интерфейса ratelimiter.UsageStore.
+func (s *SQLiteLimitStore) SaveUsage(clientIDs []string, records []rl.UsageRecord, before time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteOldUsageSQL, before.Unix()); err != nil {
+		return fmt.Errorf("failed to delete old usage counters: %w", err)
+	}
+	deleteStmt, err := tx.Prepare(deleteClientUsageSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare usage delete: %w", err)
+	}
+	defer deleteStmt.Close()
+	for _, clientID := range clientIDs {
+		if _, err := deleteStmt.Exec(clientID); err != nil {
+			return fmt.Errorf("failed to delete usage counters for client %s: %w", clientID, err)
+		}
+	}
+	stmt, err := tx.Prepare(insertUsageSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare usage insert: %w", err)
+	}
+	defer stmt.Close()
+	for _, r := range records {
+		if _, err := stmt.Exec(r.ClientID, int64(r.Period.Seconds()), r.Start.Unix(), r.Allowed, r.Denied); err != nil {
+			return fmt.Errorf("failed to save usage counters for client %s: %w", r.ClientID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadUsage возвращает сохраненные счетчики слотов, начавшихся не раньше since.
+// Реализует метод интерфейса ratelimiter.UsageStore.
+func (s *SQLiteLimitStore) LoadUsage(since time.Time) ([]rl.UsageRecord, error) {
+	rows, err := s.db.Query(loadUsageSQL, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load usage counters: %w", err)
+	}
+	defer rows.Close()
+
+	var records []rl.UsageRecord
+	for rows.Next() {
+		var r rl.UsageRecord
+		var period, start int64
+		if err := rows.Scan(&r.ClientID, &period, &start, &r.Allowed, &r.Denied); err != nil {
+			return nil, fmt.Errorf("failed to scan usage counters: %w", err)
+		}
+		r.Period = time.Duration(period) * time.Second
+		r.Start = time.Unix(start, 0).UTC()
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}